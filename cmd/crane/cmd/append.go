@@ -35,6 +35,16 @@ func NewCmdAppend(options *[]crane.Option) *cobra.Command {
 		Short: "Append contents of a tarball to a remote image",
 		Args:  cobra.NoArgs,
 		RunE: func(_ *cobra.Command, args []string) error {
+			if baseRef != "" && outFile == "" {
+				// Only push the new layers, without pulling the base's.
+				d, err := crane.AppendRemote(baseRef, newTag, newLayers, *options...)
+				if err != nil {
+					return err
+				}
+				fmt.Println(d)
+				return nil
+			}
+
 			var base v1.Image
 			var err error
 
@@ -23,21 +23,22 @@ import (
 
 // NewCmdCatalog creates a new cobra.Command for the repos subcommand.
 func NewCmdCatalog(options *[]crane.Option) *cobra.Command {
-	return &cobra.Command{
+	var prefix string
+	cmd := &cobra.Command{
 		Use:   "catalog",
 		Short: "List the repos in a registry",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(_ *cobra.Command, args []string) error {
 			reg := args[0]
-			repos, err := crane.Catalog(reg, *options...)
-			if err != nil {
-				return fmt.Errorf("reading repos for %s: %v", reg, err)
-			}
-
-			for _, repo := range repos {
+			if err := crane.CatalogFunc(reg, prefix, func(repo string) error {
 				fmt.Println(repo)
+				return nil
+			}, *options...); err != nil {
+				return fmt.Errorf("reading repos for %s: %v", reg, err)
 			}
 			return nil
 		},
 	}
+	cmd.Flags().StringVar(&prefix, "prefix", "", "Only list the repos that start with this prefix")
+	return cmd
 }
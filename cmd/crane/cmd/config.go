@@ -15,7 +15,9 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/crane"
 	"github.com/spf13/cobra"
@@ -23,11 +25,23 @@ import (
 
 // NewCmdConfig creates a new cobra.Command for the config subcommand.
 func NewCmdConfig(options *[]crane.Option) *cobra.Command {
-	return &cobra.Command{
+	var created bool
+	cmd := &cobra.Command{
 		Use:   "config IMAGE",
 		Short: "Get the config of an image",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(_ *cobra.Command, args []string) error {
+			if created {
+				t, err := crane.Created(args[0], *options...)
+				if err != nil {
+					return fmt.Errorf("fetching created time: %v", err)
+				}
+				if t.IsZero() {
+					return errors.New("image has no created time")
+				}
+				fmt.Println(t.UTC().Format(time.RFC3339))
+				return nil
+			}
 			cfg, err := crane.Config(args[0], *options...)
 			if err != nil {
 				return fmt.Errorf("fetching config: %v", err)
@@ -36,4 +50,6 @@ func NewCmdConfig(options *[]crane.Option) *cobra.Command {
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&created, "created", false, "Print only the time the image was created, the newest of its images for an index")
+	return cmd
 }
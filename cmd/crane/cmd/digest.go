@@ -24,18 +24,21 @@ import (
 
 // NewCmdDigest creates a new cobra.Command for the digest subcommand.
 func NewCmdDigest(options *[]crane.Option) *cobra.Command {
-	var tarball string
+	var tarball, ociLayout string
 	cmd := &cobra.Command{
 		Use:   "digest IMAGE",
 		Short: "Get the digest of an image",
 		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if tarball == "" && len(args) == 0 {
+			if tarball != "" && ociLayout != "" {
+				return errors.New("--tarball and --oci-layout are mutually exclusive")
+			}
+			if tarball == "" && ociLayout == "" && len(args) == 0 {
 				cmd.Help()
-				return errors.New("image reference required without --tarball")
+				return errors.New("image reference required without --tarball or --oci-layout")
 			}
 
-			digest, err := getDigest(tarball, args, options)
+			digest, err := getDigest(tarball, ociLayout, args, options)
 			if err != nil {
 				return err
 			}
@@ -45,14 +48,22 @@ func NewCmdDigest(options *[]crane.Option) *cobra.Command {
 	}
 
 	cmd.Flags().StringVar(&tarball, "tarball", "", "(Optional) path to tarball containing the image")
+	cmd.Flags().StringVar(&ociLayout, "oci-layout", "", "(Optional) path to OCI image layout containing the image, selected by its ref name annotation")
 
 	return cmd
 }
 
-func getDigest(tarball string, args []string, options *[]crane.Option) (string, error) {
+func getDigest(tarball, ociLayout string, args []string, options *[]crane.Option) (string, error) {
 	if tarball != "" {
 		return getTarballDigest(tarball, args, options)
 	}
+	if ociLayout != "" {
+		tag := ""
+		if len(args) > 0 {
+			tag = args[0]
+		}
+		return crane.LayoutDigest(ociLayout, tag, *options...)
+	}
 
 	return crane.Digest(args[0], *options...)
 }
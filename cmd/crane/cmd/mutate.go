@@ -28,15 +28,19 @@ import (
 // NewCmdMutate creates a new cobra.Command for the mutate subcommand.
 func NewCmdMutate(options *[]crane.Option) *cobra.Command {
 	var lbls []string
-	var entrypoint string
+	var entrypoint, cmd []string
+	var envs []string
+	var replaceEnv bool
+	var workdir, user string
+	var ports []string
 	var newRef string
 	var anntns []string
 
 	mutateCmd := &cobra.Command{
 		Use:   "mutate",
-		Short: "Modify image labels and annotations",
+		Short: "Modify image config and annotations",
 		Args:  cobra.ExactArgs(1),
-		Run: func(_ *cobra.Command, args []string) {
+		Run: func(c *cobra.Command, args []string) {
 			// Pull image and get config.
 			ref := args[0]
 
@@ -54,39 +58,39 @@ func NewCmdMutate(options *[]crane.Option) *cobra.Command {
 			if err != nil {
 				log.Fatalf("pulling %s: %v", ref, err)
 			}
-			cfg, err := img.ConfigFile()
-			if err != nil {
-				log.Fatalf("getting config: %v", err)
-			}
-			cfg = cfg.DeepCopy()
-
-			// Set labels.
-			if cfg.Config.Labels == nil {
-				cfg.Config.Labels = map[string]string{}
-			}
 
 			labels, err := splitKeyVals(lbls)
 			if err != nil {
 				log.Fatal(err)
 			}
 
-			for k, v := range labels {
-				cfg.Config.Labels[k] = v
-			}
-
 			annotations, err := splitKeyVals(anntns)
 			if err != nil {
 				log.Fatal(err)
 			}
 
-			// Set entrypoint.
-			if entrypoint != "" {
-				// NB: This doesn't attempt to do anything smart about splitting the string into multiple entrypoint elements.
-				cfg.Config.Entrypoint = []string{entrypoint}
+			// Passing an empty value, e.g. --entrypoint=, clears the field.
+			opts := crane.MutateOptions{
+				Env:          envs,
+				ReplaceEnv:   replaceEnv,
+				ExposedPorts: ports,
+				Labels:       labels,
+			}
+			if c.Flags().Changed("entrypoint") {
+				opts.Entrypoint = nonEmpty(entrypoint)
+			}
+			if c.Flags().Changed("cmd") {
+				opts.Cmd = nonEmpty(cmd)
+			}
+			if c.Flags().Changed("workdir") {
+				opts.WorkingDir = &workdir
+			}
+			if c.Flags().Changed("user") {
+				opts.User = &user
 			}
 
 			// Mutate and write image.
-			img, err = mutate.Config(img, cfg.Config)
+			img, err = crane.Mutate(img, opts)
 			if err != nil {
 				log.Fatalf("mutating config: %v", err)
 			}
@@ -119,11 +123,25 @@ func NewCmdMutate(options *[]crane.Option) *cobra.Command {
 	}
 	mutateCmd.Flags().StringSliceVarP(&anntns, "annotation", "a", nil, "New annotations to add")
 	mutateCmd.Flags().StringSliceVarP(&lbls, "label", "l", nil, "New labels to add")
-	mutateCmd.Flags().StringVar(&entrypoint, "entrypoint", "", "New entrypoing to set")
+	mutateCmd.Flags().StringArrayVar(&entrypoint, "entrypoint", nil, "New entrypoint to set, one argument per flag, empty to clear")
+	mutateCmd.Flags().StringArrayVar(&cmd, "cmd", nil, "New cmd to set, one argument per flag, empty to clear")
+	mutateCmd.Flags().StringSliceVarP(&envs, "env", "e", nil, "New environment variables to set, as KEY=VALUE")
+	mutateCmd.Flags().BoolVar(&replaceEnv, "replace-env", false, "Replace the environment with the --env values instead of merging them")
+	mutateCmd.Flags().StringVarP(&workdir, "workdir", "w", "", "New working directory to set")
+	mutateCmd.Flags().StringVarP(&user, "user", "u", "", "New user to set")
+	mutateCmd.Flags().StringSliceVar(&ports, "exposed-ports", nil, "New ports to expose, e.g. 8080/tcp")
 	mutateCmd.Flags().StringVarP(&newRef, "tag", "t", "", "New tag to apply to mutated image. If not provided, push by digest to the original image repository.")
 	return mutateCmd
 }
 
+// nonEmpty returns an empty, non-nil slice for a flag that was set to "".
+func nonEmpty(vals []string) []string {
+	if len(vals) == 1 && vals[0] == "" {
+		return []string{}
+	}
+	return vals
+}
+
 // splitKeyVals splits key value pairs which is in form hello=world
 func splitKeyVals(kvPairs []string) (map[string]string, error) {
 	m := map[string]string{}
@@ -15,13 +15,19 @@
 package cmd
 
 import (
+	"compress/gzip"
+
 	"github.com/google/go-containerregistry/pkg/crane"
 	"github.com/spf13/cobra"
 )
 
 // NewCmdOptimize creates a new cobra.Command for the optimize subcommand.
 func NewCmdOptimize(options *[]crane.Option) *cobra.Command {
-	var files []string
+	var (
+		files            []string
+		estargz, reorder bool
+		level            int
+	)
 
 	cmd := &cobra.Command{
 		Use:     "optimize SRC DST",
@@ -31,12 +37,26 @@ func NewCmdOptimize(options *[]crane.Option) *cobra.Command {
 		Args:    cobra.ExactArgs(2),
 		RunE: func(_ *cobra.Command, args []string) error {
 			src, dst := args[0], args[1]
-			return crane.Optimize(src, dst, files, *options...)
+			opts := append([]crane.Option{}, *options...)
+			opts = append(opts, crane.WithEstargz(estargz))
+			if reorder {
+				opts = append(opts, crane.WithLayerReordering)
+			}
+			if level != gzip.BestSpeed {
+				opts = append(opts, crane.WithCompressionLevel(level))
+			}
+			return crane.Optimize(src, dst, files, opts...)
 		},
 	}
 
 	cmd.Flags().StringSliceVar(&files, "prioritize", nil,
 		"The list of files to prioritize in the optimized image.")
+	cmd.Flags().BoolVar(&estargz, "estargz", true,
+		"Whether to convert the layers to estargz.")
+	cmd.Flags().BoolVar(&reorder, "reorder", false,
+		"Move larger layers to the bottom of the image, where that doesn't change its filesystem.")
+	cmd.Flags().IntVar(&level, "compression-level", gzip.BestSpeed,
+		"The gzip compression level to recompress layers with.")
 
 	return cmd
 }
@@ -19,7 +19,6 @@ import (
 
 	"github.com/google/go-containerregistry/pkg/crane"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
-	"github.com/google/go-containerregistry/pkg/v1/cache"
 	"github.com/spf13/cobra"
 )
 
@@ -34,14 +33,15 @@ func NewCmdPull(options *[]crane.Option) *cobra.Command {
 		RunE: func(_ *cobra.Command, args []string) error {
 			imageMap := map[string]v1.Image{}
 			srcList, path := args[:len(args)-1], args[len(args)-1]
+			opts := append([]crane.Option{}, *options...)
+			if cachePath != "" {
+				opts = append(opts, crane.WithCache(cachePath))
+			}
 			for _, src := range srcList {
-				img, err := crane.Pull(src, *options...)
+				img, err := crane.Pull(src, opts...)
 				if err != nil {
 					return fmt.Errorf("pulling %s: %v", src, err)
 				}
-				if cachePath != "" {
-					img = cache.Image(img, cache.NewFilesystemCache(cachePath))
-				}
 
 				imageMap[src] = img
 			}
@@ -18,7 +18,6 @@ import (
 	"fmt"
 
 	"github.com/google/go-containerregistry/pkg/crane"
-	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/spf13/cobra"
 )
 
@@ -27,49 +26,37 @@ func NewCmdRebase(options *[]crane.Option) *cobra.Command {
 	var orig, oldBase, newBase, rebased string
 
 	rebaseCmd := &cobra.Command{
-		Use:   "rebase",
+		Use:   "rebase [ORIGINAL]",
 		Short: "Rebase an image onto a new base image",
-		Args:  cobra.NoArgs,
-		RunE: func(*cobra.Command, []string) error {
-			origImg, err := crane.Pull(orig, *options...)
-			if err != nil {
-				return fmt.Errorf("pulling %s: %v", orig, err)
-			}
-
-			oldBaseImg, err := crane.Pull(oldBase, *options...)
-			if err != nil {
-				return fmt.Errorf("pulling %s: %v", oldBase, err)
-			}
-
-			newBaseImg, err := crane.Pull(newBase, *options...)
-			if err != nil {
-				return fmt.Errorf("pulling %s: %v", newBase, err)
-			}
-
-			img, err := mutate.Rebase(origImg, oldBaseImg, newBaseImg)
-			if err != nil {
-				return fmt.Errorf("rebasing: %v", err)
+		Long: `Rebase an image onto a new base image.
+
+If --old_base is omitted, it's inferred from the org.opencontainers.image.base.name
+and org.opencontainers.image.base.digest annotations of the original image.`,
+		Example: `  crane rebase app:latest --new_base newbase:latest --rebased app:rebased`,
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				if orig != "" {
+					return fmt.Errorf("original image given as both argument and --original flag")
+				}
+				orig = args[0]
 			}
-
-			if err := crane.Push(img, rebased, *options...); err != nil {
-				return fmt.Errorf("pushing %s: %v", rebased, err)
+			if orig == "" {
+				return fmt.Errorf("must specify the original image, as argument or with --original")
 			}
-
-			digest, err := img.Digest()
+			digest, err := crane.Rebase(orig, oldBase, newBase, rebased, *options...)
 			if err != nil {
-				return fmt.Errorf("digesting rebased: %v", err)
+				return err
 			}
 			fmt.Println(digest.String())
 			return nil
 		},
 	}
 	rebaseCmd.Flags().StringVarP(&orig, "original", "", "", "Original image to rebase")
-	rebaseCmd.Flags().StringVarP(&oldBase, "old_base", "", "", "Old base image to remove")
+	rebaseCmd.Flags().StringVarP(&oldBase, "old_base", "", "", "Old base image to remove (default from the annotations of the original image)")
 	rebaseCmd.Flags().StringVarP(&newBase, "new_base", "", "", "New base image to insert")
 	rebaseCmd.Flags().StringVarP(&rebased, "rebased", "", "", "Tag to apply to rebased image")
 
-	rebaseCmd.MarkFlagRequired("original")
-	rebaseCmd.MarkFlagRequired("old_base")
 	rebaseCmd.MarkFlagRequired("new_base")
 	rebaseCmd.MarkFlagRequired("rebased")
 	return rebaseCmd
@@ -39,6 +39,9 @@ func platformToString(p *v1.Platform) string {
 	if p.Variant != "" {
 		platform += "/" + p.Variant
 	}
+	if p.OSVersion != "" {
+		platform += ":" + p.OSVersion
+	}
 	return platform
 }
 
@@ -48,10 +51,14 @@ func parsePlatform(platform string) (*v1.Platform, error) {
 	}
 
 	p := &v1.Platform{}
+	if i := strings.Index(platform, ":"); i >= 0 {
+		p.OSVersion = platform[i+1:]
+		platform = platform[:i]
+	}
 	parts := strings.Split(platform, "/")
 
 	if len(parts) < 2 {
-		return nil, fmt.Errorf("failed to parse platform '%s': expected format os/arch[/variant]", platform)
+		return nil, fmt.Errorf("failed to parse platform '%s': expected format os/arch[/variant][:osversion]", platform)
 	}
 	if len(parts) > 3 {
 		return nil, fmt.Errorf("failed to parse platform '%s': too many slashes", platform)
@@ -0,0 +1,67 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package compression provides helpers for detecting the compression
+// algorithm of a blob by peeking at its magic bytes.
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/google/go-containerregistry/internal/gzip"
+	"github.com/google/go-containerregistry/internal/zstd"
+	"github.com/google/go-containerregistry/pkg/compression"
+)
+
+// The number of bytes we need to peek at to detect any supported compression.
+const peekSize = 4
+
+// Peek detects the compression of the input stream, consuming up to the first
+// few bytes of it.
+func Peek(r io.Reader) (compression.Compression, error) {
+	b := make([]byte, peekSize)
+	n, err := io.ReadFull(r, b)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return compression.None, err
+	}
+	return detect(b[:n])
+}
+
+// PeekReader detects the compression of the input stream, returning a reader
+// that still yields the entire stream.
+func PeekReader(r io.Reader) (compression.Compression, io.Reader, error) {
+	br := bufio.NewReaderSize(r, peekSize)
+	b, err := br.Peek(peekSize)
+	if err != nil && err != io.EOF {
+		return compression.None, br, err
+	}
+	comp, err := detect(b)
+	return comp, br, err
+}
+
+func detect(b []byte) (compression.Compression, error) {
+	if isGzip, err := gzip.Is(bytes.NewReader(b)); err != nil {
+		return compression.None, err
+	} else if isGzip {
+		return compression.GZip, nil
+	}
+	if isZstd, err := zstd.Is(bytes.NewReader(b)); err != nil {
+		return compression.None, err
+	} else if isZstd {
+		return compression.ZStd, nil
+	}
+	return compression.None, nil
+}
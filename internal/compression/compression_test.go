@@ -0,0 +1,82 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compression
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/internal/gzip"
+	"github.com/google/go-containerregistry/internal/zstd"
+	"github.com/google/go-containerregistry/pkg/compression"
+)
+
+func TestPeekReader(t *testing.T) {
+	content := "This is the input string."
+	for _, tc := range []struct {
+		name string
+		blob func() []byte
+		want compression.Compression
+	}{{
+		name: "none",
+		blob: func() []byte { return []byte(content) },
+		want: compression.None,
+	}, {
+		name: "empty",
+		blob: func() []byte { return []byte{} },
+		want: compression.None,
+	}, {
+		name: "gzip",
+		blob: func() []byte {
+			b, _ := ioutil.ReadAll(gzip.ReadCloser(ioutil.NopCloser(strings.NewReader(content))))
+			return b
+		},
+		want: compression.GZip,
+	}, {
+		name: "zstd",
+		blob: func() []byte {
+			b, _ := ioutil.ReadAll(zstd.ReadCloser(ioutil.NopCloser(strings.NewReader(content))))
+			return b
+		},
+		want: compression.ZStd,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			blob := tc.blob()
+			got, r, err := PeekReader(bytes.NewReader(blob))
+			if err != nil {
+				t.Fatalf("PeekReader() = %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("PeekReader(); got %v, want %v", got, tc.want)
+			}
+			// The returned reader must still yield the entire blob.
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, blob) {
+				t.Errorf("PeekReader() consumed part of the blob")
+			}
+
+			if got, err := Peek(bytes.NewReader(blob)); err != nil {
+				t.Errorf("Peek() = %v", err)
+			} else if got != tc.want {
+				t.Errorf("Peek(); got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
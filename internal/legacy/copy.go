@@ -20,20 +20,21 @@ import (
 	"encoding/json"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 )
 
 // CopySchema1 allows `[g]crane cp` to work with old images without adding
 // full support for schema 1 images to this package.
 func CopySchema1(desc *remote.Descriptor, srcRef, dstRef name.Reference, opts ...remote.Option) error {
-	m := schema1{}
-	if err := json.NewDecoder(bytes.NewReader(desc.Manifest)).Decode(&m); err != nil {
+	blobs, err := Schema1Blobs(desc.Manifest)
+	if err != nil {
 		return err
 	}
 
-	for _, layer := range m.FSLayers {
-		src := srcRef.Context().Digest(layer.BlobSum)
-		dst := dstRef.Context().Digest(layer.BlobSum)
+	for _, h := range blobs {
+		src := srcRef.Context().Digest(h.String())
+		dst := dstRef.Context().Digest(h.String())
 
 		blob, err := remote.Layer(src, opts...)
 		if err != nil {
@@ -48,6 +49,24 @@ func CopySchema1(desc *remote.Descriptor, srcRef, dstRef name.Reference, opts ..
 	return remote.Put(dstRef, desc, opts...)
 }
 
+// Schema1Blobs returns the digests of the layers of a schema 1 manifest, in
+// the order of the manifest, which lists them top down.
+func Schema1Blobs(manifest []byte) ([]v1.Hash, error) {
+	m := schema1{}
+	if err := json.NewDecoder(bytes.NewReader(manifest)).Decode(&m); err != nil {
+		return nil, err
+	}
+	blobs := make([]v1.Hash, 0, len(m.FSLayers))
+	for _, layer := range m.FSLayers {
+		h, err := v1.NewHash(layer.BlobSum)
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, h)
+	}
+	return blobs, nil
+}
+
 type fslayer struct {
 	BlobSum string `json:"blobSum"`
 }
@@ -86,3 +86,57 @@ func TestBadSize(t *testing.T) {
 		})
 	}
 }
+
+func TestVerificationSizeUnknown(t *testing.T) {
+	want := "This is the input string."
+
+	verified, err := ReadCloser(ioutil.NopCloser(strings.NewReader(want)), SizeUnknown, mustHash(want, t))
+	if err != nil {
+		t.Fatal("ReadCloser() =", err)
+	}
+	if _, err := ioutil.ReadAll(verified); err != nil {
+		t.Error("ReadAll() =", err)
+	}
+
+	verified, err = ReadCloser(ioutil.NopCloser(strings.NewReader(want)), SizeUnknown, mustHash("not the same", t))
+	if err != nil {
+		t.Fatal("ReadCloser() =", err)
+	}
+	if b, err := ioutil.ReadAll(verified); err == nil {
+		t.Errorf("ReadAll() = %q; want verification error", string(b))
+	}
+}
+
+func TestDescriptor(t *testing.T) {
+	data := []byte("This is the input string.")
+	good := v1.Descriptor{
+		Size:   int64(len(data)),
+		Digest: mustHash(string(data), t),
+		Data:   data,
+	}
+	if err := Descriptor(good); err != nil {
+		t.Errorf("Descriptor() = %v", err)
+	}
+
+	sha512 := good
+	h, _, err := v1.SHA512(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha512.Digest = h
+	if err := Descriptor(sha512); err != nil {
+		t.Errorf("Descriptor(sha512) = %v", err)
+	}
+
+	noData := good
+	noData.Data = nil
+	badDigest := good
+	badDigest.Digest = mustHash("not the same", t)
+	badSize := good
+	badSize.Size = 3
+	for _, d := range []v1.Descriptor{noData, badDigest, badSize} {
+		if err := Descriptor(d); err == nil {
+			t.Errorf("Descriptor(%+v) = nil, wanted err", d)
+		}
+	}
+}
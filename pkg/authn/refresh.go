@@ -0,0 +1,86 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"sync"
+)
+
+// Refresher is an Authenticator whose credentials can be refreshed, e.g.
+// after the registry rejected them because they expired.
+type Refresher interface {
+	Authenticator
+
+	// Refresh obtains new credentials, which subsequent calls to
+	// Authorization return.
+	Refresh() error
+}
+
+type refreshingKeychain struct {
+	inner Keychain
+}
+
+// RefreshingKeychain returns a Keychain that resolves credentials using
+// inner, returning Refreshers that resolve them again using inner when they
+// are refreshed. This lets long-running operations replace credentials that
+// expire, such as those of cloud credential helpers.
+//
+// Anonymous is returned as is, since it can't expire.
+func RefreshingKeychain(inner Keychain) Keychain {
+	if _, ok := inner.(*refreshingKeychain); ok {
+		return inner
+	}
+	return &refreshingKeychain{inner: inner}
+}
+
+// Resolve implements Keychain.
+func (rk *refreshingKeychain) Resolve(target Resource) (Authenticator, error) {
+	auth, err := rk.inner.Resolve(target)
+	if err != nil {
+		return nil, err
+	}
+	if auth == Anonymous {
+		return auth, nil
+	}
+	return &refreshingAuthenticator{keychain: rk.inner, target: target, auth: auth}, nil
+}
+
+type refreshingAuthenticator struct {
+	keychain Keychain
+	target   Resource
+
+	mu   sync.Mutex
+	auth Authenticator
+}
+
+// Authorization implements Authenticator.
+func (ra *refreshingAuthenticator) Authorization() (*AuthConfig, error) {
+	ra.mu.Lock()
+	auth := ra.auth
+	ra.mu.Unlock()
+	return auth.Authorization()
+}
+
+// Refresh implements Refresher.
+func (ra *refreshingAuthenticator) Refresh() error {
+	auth, err := ra.keychain.Resolve(ra.target)
+	if err != nil {
+		return err
+	}
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	ra.auth = auth
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authn
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// countingKeychain returns a new password every time it resolves credentials.
+type countingKeychain struct {
+	resolves int
+	err      error
+}
+
+func (ck *countingKeychain) Resolve(target Resource) (Authenticator, error) {
+	if ck.err != nil {
+		return nil, ck.err
+	}
+	ck.resolves++
+	return FromConfig(AuthConfig{
+		Username: "user",
+		Password: fmt.Sprintf("password-%d", ck.resolves),
+	}), nil
+}
+
+func TestRefreshingKeychain(t *testing.T) {
+	reg, err := name.NewRegistry("gcr.io", name.StrictValidation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := &countingKeychain{}
+	kc := RefreshingKeychain(inner)
+	if RefreshingKeychain(kc) != kc {
+		t.Error("RefreshingKeychain(RefreshingKeychain()) wrapped twice")
+	}
+
+	auth, err := kc.Resolve(reg)
+	if err != nil {
+		t.Fatalf("Resolve() = %v", err)
+	}
+	password := func() string {
+		t.Helper()
+		cfg, err := auth.Authorization()
+		if err != nil {
+			t.Fatalf("Authorization() = %v", err)
+		}
+		return cfg.Password
+	}
+
+	// Credentials are resolved once, until they are refreshed.
+	for i := 0; i < 2; i++ {
+		if got, want := password(), "password-1"; got != want {
+			t.Errorf("Authorization().Password = %q, want %q", got, want)
+		}
+	}
+	r, ok := auth.(Refresher)
+	if !ok {
+		t.Fatalf("Resolve() = %T, want a Refresher", auth)
+	}
+	if err := r.Refresh(); err != nil {
+		t.Fatalf("Refresh() = %v", err)
+	}
+	if got, want := password(), "password-2"; got != want {
+		t.Errorf("Authorization().Password = %q, want %q", got, want)
+	}
+
+	// Failing to refresh keeps the old credentials.
+	inner.err = errors.New("boom")
+	if err := r.Refresh(); err == nil {
+		t.Error("Refresh() = nil, wanted error")
+	}
+	if got, want := password(), "password-2"; got != want {
+		t.Errorf("Authorization().Password = %q, want %q", got, want)
+	}
+	if _, err := kc.Resolve(reg); err == nil {
+		t.Error("Resolve() = nil, wanted error")
+	}
+
+	// Anonymous can't expire.
+	auth, err = RefreshingKeychain(fixedKeychain{}).Resolve(reg)
+	if err != nil {
+		t.Fatalf("Resolve() = %v", err)
+	}
+	if auth != Anonymous {
+		t.Errorf("Resolve() = %v, want Anonymous", auth)
+	}
+}
@@ -18,8 +18,10 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/stream"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
 )
@@ -39,6 +41,36 @@ func Append(base v1.Image, paths ...string) (v1.Image, error) {
 	return mutate.AppendLayers(base, layers...)
 }
 
+// AppendRemote appends the layers read from paths to the remote image base
+// and pushes the result as dst, returning its digest.
+//
+// Only the new layers are uploaded: the layers of base are mounted from its
+// repository, or left alone if dst's repository has them already, so their
+// contents are never downloaded unless dst is on another registry.
+func AppendRemote(base, dst string, paths []string, opt ...Option) (name.Digest, error) {
+	o := makeOptions(opt...)
+	dstRef, err := name.ParseReference(dst, o.name...)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("parsing reference %q: %v", dst, err)
+	}
+	img, err := Pull(base, opt...)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("pulling %s: %v", base, err)
+	}
+	img, err = Append(img, paths...)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("appending %v: %v", paths, err)
+	}
+	if err := remote.Write(dstRef, img, o.remote...); err != nil {
+		return name.Digest{}, fmt.Errorf("pushing image %s: %v", dstRef, err)
+	}
+	d, err := img.Digest()
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("digest: %v", err)
+	}
+	return dstRef.Context().Digest(d.String()), nil
+}
+
 func getLayer(path string) (v1.Layer, error) {
 	f, err := streamFile(path)
 	if err != nil {
@@ -16,6 +16,7 @@ package crane
 
 import (
 	"context"
+	"strings"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
@@ -33,3 +34,64 @@ func Catalog(src string, opt ...Option) (res []string, err error) {
 	// crane.WithContext.
 	return remote.Catalog(context.Background(), reg, o.remote...)
 }
+
+// catalogPageSize is the number of repositories CatalogFunc requests at once.
+const catalogPageSize = 10000
+
+// CatalogFunc calls f with each repository in a registry's catalog whose name
+// starts with prefix, as the pages of the catalog arrive. If f returns an
+// error, CatalogFunc stops and returns it.
+//
+// Pages are requested with the "last" parameter, starting just before
+// prefix, so that most of a large catalog doesn't need to be listed.
+// Repositories that are returned more than once are only passed to f once,
+// and repositories that are out of order are tolerated.
+func CatalogFunc(src, prefix string, f func(repo string) error, opt ...Option) error {
+	o := makeOptions(opt...)
+	reg, err := name.NewRegistry(src, o.name...)
+	if err != nil {
+		return err
+	}
+
+	// Registries return the repositories after last, which would exclude a
+	// repository that is named prefix exactly.
+	last := ""
+	if prefix != "" {
+		last = prefix[:len(prefix)-1]
+	}
+	seen := map[string]bool{}
+	for {
+		page, err := remote.CatalogPage(reg, last, catalogPageSize, o.remote...)
+		if err != nil {
+			return err
+		}
+
+		next, fresh, past := last, false, true
+		for _, repo := range page {
+			if repo > next {
+				next = repo
+			}
+			if seen[repo] {
+				continue
+			}
+			seen[repo] = true
+			fresh = true
+
+			if strings.HasPrefix(repo, prefix) {
+				past = false
+				if err := f(repo); err != nil {
+					return err
+				}
+			} else if repo < prefix {
+				past = false
+			}
+		}
+
+		// Stop once a page has nothing new, e.g. because the registry
+		// ignores last, or everything in it sorts after the prefix.
+		if !fresh || next == last || (prefix != "" && past) {
+			return nil
+		}
+		last = next
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/crane"
+)
+
+// catalogServer serves the sorted repos two at a time, in reverse order,
+// repeating the last repository of the previous page, like a sloppy registry
+// would.
+func catalogServer(t *testing.T, repos []string, requests *int) *url.URL {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if r.URL.Path != "/v2/_catalog" {
+			t.Errorf("Unexpected path: %v", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		*requests++
+		last := r.URL.Query().Get("last")
+		var page []string
+		for _, repo := range repos {
+			if repo > last && len(page) < 2 {
+				page = append([]string{repo}, page...)
+			}
+		}
+		for _, repo := range repos {
+			if repo == last {
+				page = append(page, repo)
+			}
+		}
+		if err := json.NewEncoder(w).Encode(map[string][]string{"repositories": page}); err != nil {
+			t.Error(err)
+		}
+	}))
+	t.Cleanup(s.Close)
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func sortStrings(in []string) []string {
+	out := append([]string{}, in...)
+	sort.Strings(out)
+	return out
+}
+
+func TestCatalogFunc(t *testing.T) {
+	repos := []string{"a", "foo", "foo-x", "foo/bar", "foo/baz", "fop", "z1", "z2", "z3", "z4", "z5"}
+
+	for _, tc := range []struct {
+		prefix   string
+		want     []string
+		requests int
+	}{{
+		prefix:   "",
+		want:     repos,
+		requests: 7,
+	}, {
+		prefix: "foo",
+		want:   []string{"foo", "foo-x", "foo/bar", "foo/baz"},
+		// Stop after the page containing fop and z1.
+		requests: 3,
+	}, {
+		prefix:   "foo/",
+		want:     []string{"foo/bar", "foo/baz"},
+		requests: 3,
+	}} {
+		t.Run(tc.prefix, func(t *testing.T) {
+			var requests int
+			u := catalogServer(t, repos, &requests)
+
+			var got []string
+			if err := crane.CatalogFunc(u.Host, tc.prefix, func(repo string) error {
+				got = append(got, repo)
+				return nil
+			}); err != nil {
+				t.Fatalf("CatalogFunc() = %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.Transformer("sort", sortStrings)); diff != "" {
+				t.Errorf("CatalogFunc() (-want +got) = %s", diff)
+			}
+			if requests != tc.requests {
+				t.Errorf("CatalogFunc() made %d requests, want %d", requests, tc.requests)
+			}
+		})
+	}
+
+	var requests int
+	u := catalogServer(t, repos, &requests)
+	errStop := errors.New("stop")
+	if err := crane.CatalogFunc(u.Host, "", func(string) error { return errStop }); err != errStop {
+		t.Errorf("CatalogFunc() = %v, want %v", err, errStop)
+	}
+}
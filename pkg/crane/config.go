@@ -22,3 +22,18 @@ func Config(ref string, opt ...Option) ([]byte, error) {
 	}
 	return i.RawConfigFile()
 }
+
+// ListLabels returns the labels in the config file of the remote image ref,
+// which may be nil. For an index, it's the image for the platform of
+// WithPlatform, linux/amd64 by default.
+func ListLabels(ref string, opt ...Option) (map[string]string, error) {
+	i, _, err := getImage(ref, opt...)
+	if err != nil {
+		return nil, err
+	}
+	cf, err := i.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	return cf.Config.Labels, nil
+}
@@ -15,12 +15,17 @@
 package crane
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/google/go-containerregistry/internal/legacy"
 	"github.com/google/go-containerregistry/pkg/logs"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/cache"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
@@ -37,6 +42,8 @@ func Copy(src, dst string, opt ...Option) error {
 		return fmt.Errorf("parsing reference for %q: %v", dst, err)
 	}
 
+	o.remote = shareTokens(o.remote, srcRef.Context(), dstRef.Context())
+
 	logs.Progress.Printf("Copying from %v to %v", srcRef, dstRef)
 	desc, err := remote.Get(srcRef, o.remote...)
 	if err != nil {
@@ -58,6 +65,9 @@ func Copy(src, dst string, opt ...Option) error {
 		}
 	case types.DockerManifestSchema1, types.DockerManifestSchema1Signed:
 		// Handle schema 1 images separately.
+		if o.copyAnnotations != nil {
+			return fmt.Errorf("cannot annotate schema 1 image %q", src)
+		}
 		if err := legacy.CopySchema1(desc, srcRef, dstRef, o.remote...); err != nil {
 			return fmt.Errorf("failed to copy schema 1 image: %v", err)
 		}
@@ -71,8 +81,128 @@ func Copy(src, dst string, opt ...Option) error {
 	return nil
 }
 
+// TagResult is the outcome of copying one tag with CopyRepository.
+type TagResult struct {
+	// Tag is the tag that was copied.
+	Tag string
+	// Digest is the digest of the manifest that Tag points to.
+	Digest v1.Hash
+	// Err is why the tag wasn't copied, or nil if it was.
+	Err error
+}
+
+// CopyRepository copies the tags of the src repository for which filter
+// returns true, or all of them if filter is nil, to the dst repository,
+// preserving their digests. For example, to copy the tags matching a glob:
+//
+//	crane.CopyRepository(src, dst, func(tag string) bool {
+//		ok, _ := path.Match("v1.*", tag)
+//		return ok
+//	})
+//
+// The blobs of all the images and indexes are uploaded once, even if several
+// tags share them, and mounted rather than uploaded if both repositories are
+// on the same registry. The result of each tag is reported in the returned
+// TagResults, in the order of the tags, which may have failed individually
+// even when the returned error is nil.
+func CopyRepository(src, dst string, filter func(tag string) bool, opt ...Option) ([]TagResult, error) {
+	o := makeOptions(opt...)
+	srcRepo, err := name.NewRepository(src, o.name...)
+	if err != nil {
+		return nil, fmt.Errorf("parsing repo %q: %v", src, err)
+	}
+	dstRepo, err := name.NewRepository(dst, o.name...)
+	if err != nil {
+		return nil, fmt.Errorf("parsing repo %q: %v", dst, err)
+	}
+
+	o.remote = shareTokens(o.remote, srcRepo, dstRepo)
+
+	tags, err := remote.List(srcRepo, o.remote...)
+	if err != nil {
+		return nil, fmt.Errorf("listing tags of %s: %v", srcRepo, err)
+	}
+
+	var results []TagResult
+	m := map[name.Reference]remote.Taggable{}
+	pending := map[name.Reference]int{}
+	for _, tag := range tags {
+		if filter != nil && !filter(tag) {
+			continue
+		}
+		srcRef, dstRef := srcRepo.Tag(tag), dstRepo.Tag(tag)
+		logs.Progress.Printf("Copying from %v to %v", srcRef, dstRef)
+		result := TagResult{Tag: tag}
+		desc, err := remote.Get(srcRef, o.remote...)
+		if err != nil {
+			result.Err = fmt.Errorf("fetching %q: %v", srcRef, err)
+			results = append(results, result)
+			continue
+		}
+		result.Digest = desc.Digest
+
+		var t remote.Taggable
+		switch desc.MediaType {
+		case types.OCIImageIndex, types.DockerManifestList:
+			if o.platform != nil {
+				t, err = imageToCopy(desc, o)
+			} else {
+				t, err = indexToCopy(desc, o)
+			}
+		case types.DockerManifestSchema1, types.DockerManifestSchema1Signed:
+			if o.copyAnnotations != nil {
+				result.Err = fmt.Errorf("cannot annotate schema 1 image %q", srcRef)
+				results = append(results, result)
+				continue
+			}
+			// MultiWrite can't handle these, so copy them one by one.
+			if err := legacy.CopySchema1(desc, srcRef, dstRef, o.remote...); err != nil {
+				result.Err = fmt.Errorf("failed to copy schema 1 image: %v", err)
+			}
+			results = append(results, result)
+			continue
+		default:
+			t, err = imageToCopy(desc, o)
+		}
+		if err != nil {
+			result.Err = err
+			results = append(results, result)
+			continue
+		}
+		m[dstRef] = t
+		pending[dstRef] = len(results)
+		results = append(results, result)
+	}
+
+	if len(m) == 0 {
+		return results, nil
+	}
+	if err := remote.MultiWrite(m, o.remote...); err != nil {
+		var mwerr *remote.MultiWriteError
+		if !errors.As(err, &mwerr) {
+			return results, fmt.Errorf("copying to %s: %v", dstRepo, err)
+		}
+		for ref, err := range mwerr.Errors {
+			results[pending[ref]].Err = err
+		}
+	}
+	return results, nil
+}
+
+// shareTokens returns opts with a token cache for copying from src to dst, so
+// that tokens are reused across the reads and writes. If both are on the same
+// registry, the first token is requested for pushing to dst too, so that it's
+// the only one.
+func shareTokens(opts []remote.Option, src, dst name.Repository) []remote.Option {
+	opts = append(opts, remote.WithTokenCache(transport.NewTokenCache()))
+	if src.Registry == dst.Registry {
+		opts = append(opts, remote.WithScopes(src.Scope(transport.PullScope), dst.Scope(transport.PushScope)))
+	}
+	return opts
+}
+
 func copyImage(desc *remote.Descriptor, dstRef name.Reference, o options) error {
-	img, err := desc.Image()
+	img, err := imageToCopy(desc, o)
 	if err != nil {
 		return err
 	}
@@ -80,9 +210,40 @@ func copyImage(desc *remote.Descriptor, dstRef name.Reference, o options) error
 }
 
 func copyIndex(desc *remote.Descriptor, dstRef name.Reference, o options) error {
-	idx, err := desc.ImageIndex()
+	idx, err := indexToCopy(desc, o)
 	if err != nil {
 		return err
 	}
 	return remote.WriteIndex(dstRef, idx, o.remote...)
 }
+
+// imageToCopy returns the image of desc, wrapped with the cache of WithCache
+// and the annotations of WithCopyAnnotations, if any.
+func imageToCopy(desc *remote.Descriptor, o options) (v1.Image, error) {
+	img, err := desc.Image()
+	if err != nil {
+		return nil, err
+	}
+	if o.cache != nil {
+		img = cache.Image(img, o.cache)
+	}
+	if o.copyAnnotations != nil {
+		img = mutate.Annotations(img, o.copyAnnotations)
+	}
+	return img, nil
+}
+
+// indexToCopy is like imageToCopy, for the index of desc.
+func indexToCopy(desc *remote.Descriptor, o options) (v1.ImageIndex, error) {
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	if o.cache != nil {
+		idx = cache.ImageIndex(idx, o.cache)
+	}
+	if o.copyAnnotations != nil {
+		idx = mutate.IndexAnnotations(idx, o.copyAnnotations)
+	}
+	return idx, nil
+}
@@ -25,9 +25,13 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-containerregistry/internal/compare"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/crane"
@@ -35,9 +39,12 @@ import (
 	"github.com/google/go-containerregistry/pkg/registry"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
 )
 
 // TODO(jonjohnsonjr): Test crane.Copy failures.
@@ -255,6 +262,285 @@ func TestCraneCopyIndex(t *testing.T) {
 	}
 }
 
+func TestPlan(t *testing.T) {
+	// The registry shares blobs across repositories, so pretend that the
+	// destination repository doesn't have the hidden ones.
+	reg := registry.New()
+	var mu sync.Mutex
+	hidden := map[string]bool{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hide := hidden[path.Base(r.URL.Path)] && strings.HasPrefix(r.URL.Path, "/v2/test/dst/blobs/")
+		mu.Unlock()
+		if hide {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Anything but reads would mean that Plan transfers something.
+	other := registry.New()
+	s2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+		}
+		other.ServeHTTP(w, r)
+	}))
+	defer s2.Close()
+	u2, err := url.Parse(s2.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := fmt.Sprintf("%s/test/src:tag", u.Host)
+	idx, err := random.Index(1024, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(ref, idx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Put one of the images at the destination already.
+	dst := fmt.Sprintf("%s/test/dst:tag", u.Host)
+	im, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := idx.Image(im.Manifests[0].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := fmt.Sprintf("%s/test/dst@%s", u.Host, im.Manifests[0].Digest)
+	if err := crane.Push(img, existing); err != nil {
+		t.Fatal(err)
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imgSize := m.Config.Size
+	for _, l := range m.Layers {
+		imgSize += l.Size
+	}
+	missing, err := idx.Image(im.Manifests[1].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	om, err := missing.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	hidden[om.Config.Digest.String()] = true
+	for _, l := range om.Layers {
+		hidden[l.Digest.String()] = true
+	}
+	mu.Unlock()
+
+	plan, err := crane.Plan(src, dst)
+	if err != nil {
+		t.Fatalf("Plan() = %v", err)
+	}
+	if got, want := len(plan.Manifests), 3; got != want {
+		t.Errorf("len(Manifests) = %d, want %d", got, want)
+	}
+	if got, want := len(plan.Blobs), 6; got != want {
+		t.Errorf("len(Blobs) = %d, want %d", got, want)
+	}
+	actions := map[crane.BlobAction]int{}
+	var total int64
+	for _, b := range plan.Blobs {
+		actions[b.Action]++
+		total += b.Size
+	}
+	if diff := cmp.Diff(map[crane.BlobAction]int{crane.BlobPresent: 3, crane.BlobMount: 3}, actions); diff != "" {
+		t.Errorf("Blob actions (-want +got) = %s", diff)
+	}
+	if plan.PresentBytes != imgSize || plan.MountBytes != total-imgSize || plan.UploadBytes != 0 {
+		t.Errorf("Bytes = %d present, %d mount, %d upload, want %d, %d, 0", plan.PresentBytes, plan.MountBytes, plan.UploadBytes, imgSize, total-imgSize)
+	}
+	for _, m := range plan.Manifests {
+		if want := m.Digest == im.Manifests[0].Digest; m.Exists != want {
+			t.Errorf("Manifest %s Exists = %t, want %t", m.Digest, m.Exists, want)
+		}
+	}
+	if _, err := crane.Digest(dst); err == nil {
+		t.Error("Plan() pushed the tag")
+	}
+
+	// Nothing can be mounted across registries.
+	plan, err = crane.Plan(src, fmt.Sprintf("%s/test/dst:tag", u2.Host))
+	if err != nil {
+		t.Fatalf("Plan() = %v", err)
+	}
+	for _, b := range plan.Blobs {
+		if b.Action != crane.BlobUpload {
+			t.Errorf("Blob %s Action = %s, want %s", b.Digest, b.Action, crane.BlobUpload)
+		}
+	}
+	if plan.UploadBytes != total {
+		t.Errorf("UploadBytes = %d, want %d", plan.UploadBytes, total)
+	}
+
+	// After copying, everything is there.
+	mu.Lock()
+	hidden = map[string]bool{}
+	mu.Unlock()
+	if err := crane.Copy(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	plan, err = crane.Plan(src, dst)
+	if err != nil {
+		t.Fatalf("Plan() = %v", err)
+	}
+	if plan.PresentBytes != total {
+		t.Errorf("PresentBytes = %d, want %d", plan.PresentBytes, total)
+	}
+	for _, m := range plan.Manifests {
+		if !m.Exists {
+			t.Errorf("Manifest %s Exists = false after Copy()", m.Digest)
+		}
+	}
+}
+
+func TestCopyAnnotations(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := fmt.Sprintf("%s/test/src", u.Host)
+	dst := fmt.Sprintf("%s/test/dst", u.Host)
+
+	idx, err := random.Index(1024, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(src + ":idx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(ref, idx); err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Push(img, src+":img"); err != nil {
+		t.Fatal(err)
+	}
+
+	annotations := map[string]string{
+		"org.opencontainers.image.ref.name": src,
+		"com.example.copied-at":             "2021-01-01T00:00:00Z",
+	}
+	for _, tag := range []string{"idx", "img"} {
+		if err := crane.Copy(src+":"+tag, dst+":"+tag, crane.WithCopyAnnotations(annotations)); err != nil {
+			t.Fatalf("Copy(%s) = %v", tag, err)
+		}
+	}
+
+	m, err := crane.Manifest(dst + ":img")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := v1.ParseManifest(bytes.NewReader(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(annotations, got.Annotations); diff != "" {
+		t.Errorf("image annotations (-want +got) = %s", diff)
+	}
+
+	m, err = crane.Manifest(dst + ":idx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := v1.ParseIndexManifest(bytes.NewReader(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(annotations, im.Annotations); diff != "" {
+		t.Errorf("index annotations (-want +got) = %s", diff)
+	}
+
+	// The children are copied as they are.
+	want, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want.Manifests, im.Manifests); diff != "" {
+		t.Errorf("children (-want +got) = %s", diff)
+	}
+	for _, desc := range want.Manifests {
+		if _, err := crane.Manifest(dst + "@" + desc.Digest.String()); err != nil {
+			t.Errorf("Manifest(%s) = %v", desc.Digest, err)
+		}
+	}
+
+	// The source is untouched.
+	d, err := idx.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := crane.Digest(src + ":idx"); err != nil {
+		t.Fatal(err)
+	} else if got != d.String() {
+		t.Errorf("Digest(src) = %s, want %s", got, d)
+	}
+}
+
+func TestListLabels(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := fmt.Sprintf("%s/test/labels", u.Host)
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Push(img, ref); err != nil {
+		t.Fatal(err)
+	}
+	if labels, err := crane.ListLabels(ref); err != nil {
+		t.Fatal(err)
+	} else if labels != nil {
+		t.Errorf("ListLabels() = %v, want nil", labels)
+	}
+
+	want := map[string]string{"maintainer": "x"}
+	img, err = mutate.Labels(img, want, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Push(img, ref); err != nil {
+		t.Fatal(err)
+	}
+	labels, err := crane.ListLabels(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, labels); diff != "" {
+		t.Errorf("ListLabels() (-want +got) = %s", diff)
+	}
+}
+
 func TestWithPlatform(t *testing.T) {
 	// Set up a fake registry with a platform-specific image.
 	s := httptest.NewServer(registry.New())
@@ -332,115 +618,410 @@ func TestWithPlatform(t *testing.T) {
 	}
 }
 
-func TestCraneTarball(t *testing.T) {
-	t.Parallel()
-	// Write an image as a tarball.
-	tmp, err := ioutil.TempFile("", "")
+func TestCopyWithPlatformFilter(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer os.Remove(tmp.Name())
 
-	img, err := random.Image(1024, 5)
+	imgs := []mutate.IndexAddendum{}
+	for _, plat := range []string{
+		"linux/amd64",
+		"linux/arm64",
+		"linux/s390x",
+	} {
+		img, err := crane.Image(map[string][]byte{
+			"platform.txt": []byte(plat),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.Split(plat, "/")
+		imgs = append(imgs, mutate.IndexAddendum{
+			Add: img,
+			Descriptor: v1.Descriptor{
+				Platform: &v1.Platform{
+					OS:           parts[0],
+					Architecture: parts[1],
+				},
+			},
+		})
+	}
+	idx := mutate.AppendManifests(empty.Index, imgs...)
+
+	src := path.Join(u.Host, "src")
+	dst := path.Join(u.Host, "dst")
+	ref, err := name.ParseReference(src)
 	if err != nil {
 		t.Fatal(err)
 	}
-	digest, err := img.Digest()
-	if err != nil {
+	if err := remote.WriteIndex(ref, idx); err != nil {
 		t.Fatal(err)
 	}
-	src := fmt.Sprintf("test/crane@%s", digest)
 
-	if err := crane.Save(img, src, tmp.Name()); err != nil {
-		t.Errorf("Save: %v", err)
+	platforms := []v1.Platform{*imgs[0].Platform, *imgs[1].Platform}
+	if err := crane.Copy(src, dst, crane.WithPlatformFilter(platforms)); err != nil {
+		t.Fatal(err)
 	}
 
-	// Make sure the image we load has a matching digest.
-	img, err = crane.Load(tmp.Name())
+	b, err := crane.Manifest(dst)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	d, err := img.Digest()
+	m, err := v1.ParseIndexManifest(bytes.NewReader(b))
 	if err != nil {
 		t.Fatal(err)
 	}
-	if d != digest {
-		t.Errorf("digest mismatch: %v != %v", d, digest)
+	if len(m.Manifests) != 2 {
+		t.Fatalf("copied index has %d manifests, want 2", len(m.Manifests))
+	}
+	for i, desc := range m.Manifests {
+		if !desc.Platform.Equals(platforms[i]) {
+			t.Errorf("Manifests[%d].Platform = %v, want %v", i, desc.Platform, platforms[i])
+		}
 	}
 }
 
-func TestCraneSaveLegacy(t *testing.T) {
-	t.Parallel()
-	// Write an image as a legacy tarball.
-	tmp, err := ioutil.TempFile("", "")
+func TestWithCache(t *testing.T) {
+	// Set up a fake registry that counts the layer blobs it serves.
+	var mu sync.Mutex
+	fetched := map[string]int{}
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+			mu.Lock()
+			fetched[path.Base(r.URL.Path)]++
+			mu.Unlock()
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer os.Remove(tmp.Name())
+	src := fmt.Sprintf("%s/test/crane", u.Host)
 
-	img, err := random.Image(1024, 5)
+	// Copy to another registry, so the layers have to be fetched.
+	ds := httptest.NewServer(registry.New())
+	defer ds.Close()
+	du, err := url.Parse(ds.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
+	dst := fmt.Sprintf("%s/test/crane", du.Host)
 
-	if err := crane.SaveLegacy(img, "test/crane", tmp.Name()); err != nil {
-		t.Errorf("SaveOCI: %v", err)
-	}
-}
-
-func TestCraneSaveOCI(t *testing.T) {
-	t.Parallel()
-	// Write an image as an OCI image layout.
-	tmp, err := ioutil.TempDir("", "")
+	img, err := random.Image(1024, 2)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer os.RemoveAll(tmp)
-
-	img, err := random.Image(1024, 5)
-	if err != nil {
+	if err := crane.Push(img, src); err != nil {
 		t.Fatal(err)
 	}
-	if err := crane.SaveOCI(img, tmp); err != nil {
-		t.Errorf("SaveLegacy: %v", err)
-	}
-}
-
-func TestCraneFilesystem(t *testing.T) {
-	t.Parallel()
-	tmp, err := ioutil.TempFile("", "")
+	layers, err := img.Layers()
 	if err != nil {
 		t.Fatal(err)
 	}
-	img, err := random.Image(1024, 5)
+
+	dir, err := ioutil.TempDir("", "crane-cache")
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer os.RemoveAll(dir)
 
-	name := "/some/file"
-	content := []byte("sentinel")
-
-	tw := tar.NewWriter(tmp)
-	if err := tw.WriteHeader(&tar.Header{
-		Size: int64(len(content)),
-		Name: name,
-	}); err != nil {
-		t.Fatal(err)
+	// Copying populates the cache.
+	if err := crane.Copy(src, dst, crane.WithCache(dir)); err != nil {
+		t.Fatalf("Copy(): %v", err)
 	}
-	if _, err := tw.Write(content); err != nil {
-		t.Fatal(err)
+	for _, l := range layers {
+		digest, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(path.Join(dir, digest.String())); err != nil {
+			t.Errorf("layer %s was not cached: %v", digest, err)
+		}
 	}
-	tw.Flush()
-	tw.Close()
 
-	img, err = crane.Append(img, tmp.Name())
+	// Corrupt the first layer in the cache.
+	corrupt, err := layers[0].Digest()
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	var buf bytes.Buffer
-	if err := crane.Export(img, &buf); err != nil {
+	if err := ioutil.WriteFile(path.Join(dir, corrupt.String()), []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	fetched = map[string]int{}
+	mu.Unlock()
+
+	pulled, err := crane.Pull(src, crane.WithCache(dir))
+	if err != nil {
+		t.Fatalf("Pull(): %v", err)
+	}
+	pulledLayers, err := pulled.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range pulledLayers {
+		digest, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := l.Compressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _, err := v1.SHA256(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got != digest {
+			t.Errorf("Compressed() of %s hashes to %s", digest, got)
+		}
+
+		// Only the corrupted layer is fetched again.
+		want := 0
+		if digest == corrupt {
+			want = 1
+		}
+		mu.Lock()
+		n := fetched[digest.String()]
+		mu.Unlock()
+		if n != want {
+			t.Errorf("layer %s was fetched %d times, want %d", digest, n, want)
+		}
+	}
+
+	// The corrupted layer has been replaced.
+	b, err := ioutil.ReadFile(path.Join(dir, corrupt.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _, err := v1.SHA256(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	} else if got != corrupt {
+		t.Errorf("cached layer hashes to %s, want %s", got, corrupt)
+	}
+}
+
+func TestCraneTarball(t *testing.T) {
+	t.Parallel()
+	// Write an image as a tarball.
+	tmp, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	img, err := random.Image(1024, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := fmt.Sprintf("test/crane@%s", digest)
+
+	if err := crane.Save(img, src, tmp.Name()); err != nil {
+		t.Errorf("Save: %v", err)
+	}
+
+	// Make sure the image we load has a matching digest.
+	img, err = crane.Load(tmp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != digest {
+		t.Errorf("digest mismatch: %v != %v", d, digest)
+	}
+}
+
+func TestCraneSaveLegacy(t *testing.T) {
+	t.Parallel()
+	// Write an image as a legacy tarball.
+	tmp, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	img, err := random.Image(1024, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := crane.SaveLegacy(img, "test/crane", tmp.Name()); err != nil {
+		t.Errorf("SaveOCI: %v", err)
+	}
+}
+
+func TestCraneSaveOCI(t *testing.T) {
+	t.Parallel()
+	// Write an image as an OCI image layout.
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	img, err := random.Image(1024, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.SaveOCI(img, tmp); err != nil {
+		t.Errorf("SaveLegacy: %v", err)
+	}
+}
+
+func TestPullOCI(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		blobs int
+	)
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+			mu.Lock()
+			blobs++
+			mu.Unlock()
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := fmt.Sprintf("%s/test/src", u.Host)
+	dst := fmt.Sprintf("%s/test/dst", u.Host)
+
+	idx, err := random.Index(1024, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(src + ":v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(ref, idx); err != nil {
+		t.Fatal(err)
+	}
+	want, err := idx.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// The second time, only the configs are fetched, to find the layers.
+	for i, wantBlobs := range []int{4, 2} {
+		mu.Lock()
+		blobs = 0
+		mu.Unlock()
+		if err := crane.PullOCI(src+":v1", tmp); err != nil {
+			t.Fatalf("PullOCI() = %v", err)
+		}
+		mu.Lock()
+		if blobs != wantBlobs {
+			t.Errorf("pull %d fetched %d blobs, want %d", i, blobs, wantBlobs)
+		}
+		mu.Unlock()
+	}
+
+	p, err := layout.FromPath(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ii, err := p.ImageIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := ii.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(im.Manifests) != 1 {
+		t.Fatalf("index.json lists %d manifests, want 1", len(im.Manifests))
+	}
+	if got := im.Manifests[0].Annotations["org.opencontainers.image.ref.name"]; got != "v1" {
+		t.Errorf("ref.name = %q, want v1", got)
+	}
+	got, err := ii.ImageIndex(im.Manifests[0].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validate.Index(got); err != nil {
+		t.Errorf("validate.Index() = %v", err)
+	}
+
+	// Pushing the layout back gives the same manifest.
+	dstRef, err := name.ParseReference(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(dstRef, got); err != nil {
+		t.Fatal(err)
+	}
+	b, err := crane.Manifest(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, want) {
+		t.Errorf("pushed manifest = %s, want %s", b, want)
+	}
+}
+
+func TestCraneFilesystem(t *testing.T) {
+	t.Parallel()
+	tmp, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := "/some/file"
+	content := []byte("sentinel")
+
+	tw := tar.NewWriter(tmp)
+	if err := tw.WriteHeader(&tar.Header{
+		Size: int64(len(content)),
+		Name: name,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	tw.Flush()
+	tw.Close()
+
+	img, err = crane.Append(img, tmp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := crane.Export(img, &buf); err != nil {
 		t.Fatal(err)
 	}
 
@@ -465,6 +1046,275 @@ func TestCraneFilesystem(t *testing.T) {
 	}
 }
 
+// tarEntry is a file for mustTarLayer, whose contents are in Linkname for
+// regular files.
+type tarEntry = tar.Header
+
+func mustTarLayer(t *testing.T, entries ...tarEntry) v1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range entries {
+		var content []byte
+		if hdr.Typeflag == tar.TypeReg {
+			content = []byte(hdr.Linkname)
+			hdr.Linkname = ""
+			hdr.Size = int64(len(content))
+		}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	l, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestExportWhiteouts(t *testing.T) {
+	img, err := mutate.AppendLayers(empty.Image,
+		mustTarLayer(t,
+			tarEntry{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755},
+			tarEntry{Name: "dir/old", Typeflag: tar.TypeReg, Mode: 0644, Linkname: "old"},
+			tarEntry{Name: "file", Typeflag: tar.TypeReg, Mode: 0644, Linkname: "file"},
+		),
+		mustTarLayer(t,
+			tarEntry{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755},
+			tarEntry{Name: "dir/.wh..wh..opq", Typeflag: tar.TypeReg},
+			tarEntry{Name: "dir/new", Typeflag: tar.TypeReg, Mode: 0644, Linkname: "new"},
+			tarEntry{Name: "file", Typeflag: tar.TypeSymlink, Linkname: "dir/new"},
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := crane.Export(img, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]byte{}
+	tr := tar.NewReader(&buf)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got[header.Name] = header.Typeflag
+	}
+	want := map[string]byte{
+		"dir/":    tar.TypeDir,
+		"dir/new": tar.TypeReg,
+		"file":    tar.TypeSymlink,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Export() (-want +got) = %s", diff)
+	}
+}
+
+func TestExtractToDir(t *testing.T) {
+	mtime := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	img, err := mutate.AppendLayers(empty.Image,
+		mustTarLayer(t,
+			tarEntry{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0750, ModTime: mtime},
+			tarEntry{Name: "etc/passwd", Typeflag: tar.TypeReg, Mode: 0644, Linkname: "root"},
+			tarEntry{Name: "etc/alternative", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+			tarEntry{Name: "bin/sh", Typeflag: tar.TypeReg, Mode: 04755, Linkname: "#!", ModTime: mtime},
+			tarEntry{Name: "bin/bash", Typeflag: tar.TypeLink, Linkname: "bin/sh"},
+			tarEntry{Name: "run/fifo", Typeflag: tar.TypeFifo, Mode: 0600},
+			tarEntry{Name: "tmp/deleted", Typeflag: tar.TypeReg, Mode: 0644, Linkname: "gone"},
+		),
+		mustTarLayer(t,
+			tarEntry{Name: "etc/passwd", Typeflag: tar.TypeReg, Mode: 0600, Linkname: "toor"},
+			tarEntry{Name: "tmp/.wh.deleted", Typeflag: tar.TypeReg},
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "crane-extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := crane.ExtractToDir(img, dir); err != nil {
+		t.Fatalf("ExtractToDir() = %v", err)
+	}
+
+	for name, want := range map[string]string{
+		"etc/passwd": "toor",
+		"bin/sh":     "#!",
+		"bin/bash":   "#!",
+	} {
+		if b, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil {
+			t.Errorf("ReadFile(%s) = %v", name, err)
+		} else if string(b) != want {
+			t.Errorf("ReadFile(%s) = %q, want %q", name, b, want)
+		}
+	}
+	for name, want := range map[string]os.FileMode{
+		"etc":        os.ModeDir | 0750,
+		"etc/passwd": 0600,
+		"bin":        os.ModeDir | 0755,
+		"bin/sh":     os.ModeSetuid | 0755,
+		"run/fifo":   os.ModeNamedPipe | 0600,
+	} {
+		if fi, err := os.Lstat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Lstat(%s) = %v", name, err)
+		} else if fi.Mode() != want {
+			t.Errorf("Lstat(%s).Mode() = %v, want %v", name, fi.Mode(), want)
+		}
+	}
+	for _, name := range []string{"etc", "bin/sh"} {
+		if fi, err := os.Lstat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Lstat(%s) = %v", name, err)
+		} else if !fi.ModTime().Equal(mtime) {
+			t.Errorf("Lstat(%s).ModTime() = %v, want %v", name, fi.ModTime(), mtime)
+		}
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "etc/alternative")); err != nil {
+		t.Errorf("Readlink() = %v", err)
+	} else if target != "/etc/passwd" {
+		t.Errorf("Readlink() = %s, want /etc/passwd", target)
+	}
+	sh, err := os.Stat(filepath.Join(dir, "bin/sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bash, err := os.Stat(filepath.Join(dir, "bin/bash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(sh, bash) {
+		t.Error("bin/bash isn't a hardlink to bin/sh")
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "tmp/deleted")); !os.IsNotExist(err) {
+		t.Errorf("Lstat(tmp/deleted) = %v, wanted it to be whited out", err)
+	}
+}
+
+func TestExtractToDirEscape(t *testing.T) {
+	outside, err := ioutil.TempDir("", "crane-outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	if err := ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		desc    string
+		entries []tarEntry
+		wantErr bool
+	}{{
+		desc:    "dot dot",
+		entries: []tarEntry{{Name: "../pwned", Typeflag: tar.TypeReg, Mode: 0644}},
+		wantErr: true,
+	}, {
+		desc: "absolute symlink",
+		entries: []tarEntry{
+			{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: outside},
+			{Name: "escape/pwned", Typeflag: tar.TypeReg, Mode: 0644},
+		},
+		wantErr: true,
+	}, {
+		desc: "relative symlink",
+		entries: []tarEntry{
+			{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: "../" + filepath.Base(outside)},
+			{Name: "escape/pwned", Typeflag: tar.TypeReg, Mode: 0644},
+		},
+		wantErr: true,
+	}, {
+		// Hardlinks to paths outside of the image are dropped like any other
+		// dangling hardlink.
+		desc: "hardlink through symlink",
+		entries: []tarEntry{
+			{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: outside},
+			{Name: "pwned", Typeflag: tar.TypeLink, Linkname: "escape/secret"},
+		},
+	}, {
+		desc:    "hardlink dot dot",
+		entries: []tarEntry{{Name: "pwned", Typeflag: tar.TypeLink, Linkname: "../secret"}},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			img, err := mutate.AppendLayers(empty.Image, mustTarLayer(t, tc.entries...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Next to outside, so that "../" + its name reaches it.
+			dir, err := ioutil.TempDir(filepath.Dir(outside), "crane-extract")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			if err := crane.ExtractToDir(img, dir); (err != nil) != tc.wantErr {
+				t.Errorf("ExtractToDir() = %v, wanted error: %t", err, tc.wantErr)
+			}
+			for _, p := range []string{filepath.Join(outside, "pwned"), filepath.Join(filepath.Dir(dir), "pwned"), filepath.Join(dir, "pwned")} {
+				if _, err := os.Lstat(p); !os.IsNotExist(err) {
+					t.Errorf("Lstat(%s) = %v, wanted it not to exist", p, err)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractToDirReplacedDir(t *testing.T) {
+	outside, err := ioutil.TempDir("", "crane-outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	victim := filepath.Join(outside, "victim")
+	if err := os.Mkdir(victim, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// x/victim's metadata is applied after everything is extracted, by which
+	// time x is a symlink to outside.
+	img, err := mutate.AppendLayers(empty.Image, mustTarLayer(t,
+		tarEntry{Name: "x/", Typeflag: tar.TypeDir, Mode: 0755},
+		tarEntry{Name: "x/victim/", Typeflag: tar.TypeDir, Mode: 0777},
+		tarEntry{Name: "x", Typeflag: tar.TypeSymlink, Linkname: outside},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "crane-extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := crane.ExtractToDir(img, dir); err == nil {
+		t.Error("ExtractToDir() = nil, wanted error")
+	}
+	fi, err := os.Stat(victim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fi.Mode().Perm(); got != 0700 {
+		t.Errorf("mode of %s = %v, want %v", victim, got, os.FileMode(0700))
+	}
+}
+
 func TestStreamingAppend(t *testing.T) {
 	// Stdin will be an uncompressed layer.
 	layer, err := crane.Layer(map[string][]byte{
@@ -508,6 +1358,319 @@ func TestStreamingAppend(t *testing.T) {
 	}
 }
 
+func TestAppendRemote(t *testing.T) {
+	base, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseLayers, err := base.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	isBase := map[string]bool{}
+	for _, l := range baseLayers {
+		h, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		isBase[h.String()] = true
+	}
+
+	// Set up a fake registry that records the blobs it serves, mounts and
+	// uploads. The registry stores blobs globally, so pretend that the base
+	// layers are missing from the destination repository until they are
+	// mounted there.
+	var mu sync.Mutex
+	fetched := map[string]int{}
+	mounted := map[string]string{}
+	uploaded := map[string]int{}
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		digest := path.Base(r.URL.Path)
+		switch {
+		case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/"):
+			fetched[digest]++
+		case r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/v2/test/appended/blobs/"):
+			if _, ok := mounted[digest]; isBase[digest] && !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+		case r.Method == http.MethodPost && r.URL.Query().Get("mount") != "":
+			mount, from := r.URL.Query().Get("mount"), r.URL.Query().Get("from")
+			mounted[mount] = from
+			if from == "test/base" && isBase[mount] {
+				w.Header().Set("Docker-Content-Digest", mount)
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		case r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/blobs/uploads/"):
+			uploaded[r.URL.Query().Get("digest")]++
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := fmt.Sprintf("%s/test/base:latest", u.Host)
+	dst := fmt.Sprintf("%s/test/appended:latest", u.Host)
+
+	if err := crane.Push(base, src); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	uploaded = map[string]int{}
+	mu.Unlock()
+
+	layer, err := crane.Layer(map[string][]byte{
+		"hello": []byte(`world`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp, err := ioutil.TempFile("", "crane-append")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(tmp, rc); err != nil {
+		t.Fatal(err)
+	}
+	tmp.Close()
+
+	d, err := crane.AppendRemote(src, dst, []string{tmp.Name()})
+	if err != nil {
+		t.Fatalf("AppendRemote() = %v", err)
+	}
+
+	pulled, err := crane.Pull(d.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := pulled.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(layers), 3; got != want {
+		t.Errorf("len(layers) = %d, want %d", got, want)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for digest := range isBase {
+		if n := fetched[digest]; n != 0 {
+			t.Errorf("base layer %s fetched %d times, want 0", digest, n)
+		}
+		if from, ok := mounted[digest]; !ok {
+			t.Errorf("base layer %s was not mounted", digest)
+		} else if from != "test/base" {
+			t.Errorf("base layer %s mounted from %s, want test/base", digest, from)
+		}
+		if n := uploaded[digest]; n != 0 {
+			t.Errorf("base layer %s uploaded %d times, want 0", digest, n)
+		}
+	}
+}
+
+func TestCopyRepository(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := fmt.Sprintf("%s/test/src", u.Host)
+	dst := fmt.Sprintf("%s/test/dst", u.Host)
+
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := random.Index(1024, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"v1.0", "v1.1"} {
+		if err := crane.Push(img, src+":"+tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ref, err := name.ParseReference(src + ":v1.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.WriteIndex(ref, idx); err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Push(img, src+":v2.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := crane.CopyRepository(src, dst, func(tag string) bool {
+		ok, _ := path.Match("v1.*", tag)
+		return ok
+	})
+	if err != nil {
+		t.Fatalf("CopyRepository() = %v", err)
+	}
+	imgDigest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idxDigest, err := idx.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []crane.TagResult{
+		{Tag: "v1.0", Digest: imgDigest},
+		{Tag: "v1.1", Digest: imgDigest},
+		{Tag: "v1.2", Digest: idxDigest},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("CopyRepository() = %v, want %v", results, want)
+	}
+	for i, r := range results {
+		if r != want[i] {
+			t.Errorf("results[%d] = %v, want %v", i, r, want[i])
+		}
+		d, err := crane.Digest(dst + ":" + r.Tag)
+		if err != nil {
+			t.Errorf("Digest(%s) = %v", r.Tag, err)
+		} else if d != r.Digest.String() {
+			t.Errorf("Digest(%s) = %s, want %s", r.Tag, d, r.Digest)
+		}
+	}
+
+	tags, err := crane.ListTags(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(tags, ","), "v1.0,v1.1,v1.2"; got != want {
+		t.Errorf("ListTags() = %s, want %s", got, want)
+	}
+}
+
+func TestCopyRepositoryWithCache(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := fmt.Sprintf("%s/test/src", u.Host)
+
+	// Copy to another registry, so the layers have to be fetched.
+	ds := httptest.NewServer(registry.New())
+	defer ds.Close()
+	du, err := url.Parse(ds.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := fmt.Sprintf("%s/test/dst", du.Host)
+
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Push(img, src+":latest"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "crane-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	results, err := crane.CopyRepository(src, dst, nil, crane.WithCache(dir))
+	if err != nil {
+		t.Fatalf("CopyRepository() = %v", err)
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("CopyRepository(%s) = %v", r.Tag, r.Err)
+		}
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range layers {
+		digest, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(path.Join(dir, digest.String())); err != nil {
+			t.Errorf("layer %s was not cached: %v", digest, err)
+		}
+	}
+}
+
+func TestCopySharesTokens(t *testing.T) {
+	reg := registry.New()
+	var (
+		mu     sync.Mutex
+		scopes [][]string
+		s      *httptest.Server
+	)
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			mu.Lock()
+			scopes = append(scopes, r.URL.Query()["scope"])
+			mu.Unlock()
+			w.Write([]byte(`{"token": "secret"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, s.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := fmt.Sprintf("%s/src", u.Host)
+	dst := fmt.Sprintf("%s/dst", u.Host)
+
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Push(img, src); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	scopes = nil
+	mu.Unlock()
+	if err := crane.Copy(src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	// The read and the write share a token for both repositories.
+	mu.Lock()
+	defer mu.Unlock()
+	if len(scopes) != 1 {
+		t.Fatalf("requested %d tokens, want 1: %v", len(scopes), scopes)
+	}
+	want := []string{"repository:src:pull", "repository:dst:push,pull"}
+	if diff := cmp.Diff(want, scopes[0]); diff != "" {
+		t.Errorf("scopes (-want +got): %s", diff)
+	}
+}
+
 func TestBadInputs(t *testing.T) {
 	t.Parallel()
 	invalid := "/dev/null/@@@@@@"
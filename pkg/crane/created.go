@@ -0,0 +1,119 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/legacy"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Created returns the time at which the remote image ref was created,
+// according to the created field of its config file, or the zero time if the
+// config file doesn't have one.
+//
+// For an index, it's the newest time of any of its images, including those of
+// nested indexes, unless WithPlatform selects one of them. For a schema 1
+// image, it's the time of its top layer, without reading any layers.
+func Created(ref string, opt ...Option) (time.Time, error) {
+	o := makeOptions(opt...)
+	desc, err := getManifest(ref, opt...)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	switch desc.MediaType {
+	case types.DockerManifestSchema1, types.DockerManifestSchema1Signed:
+		return schema1Created(desc.Manifest)
+	case types.OCIImageIndex, types.DockerManifestList:
+		if o.platform == nil {
+			idx, err := desc.ImageIndex()
+			if err != nil {
+				return time.Time{}, err
+			}
+			return indexCreated(idx)
+		}
+	}
+	img, err := desc.Image()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return imageCreated(img)
+}
+
+func imageCreated(img v1.Image) (time.Time, error) {
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cf.Created.Time, nil
+}
+
+// indexCreated returns the newest created time of the images in idx.
+func indexCreated(idx v1.ImageIndex) (time.Time, error) {
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return time.Time{}, err
+	}
+	var newest time.Time
+	for _, desc := range im.Manifests {
+		var created time.Time
+		switch {
+		case desc.MediaType.IsImage():
+			img, err := idx.Image(desc.Digest)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if created, err = imageCreated(img); err != nil {
+				return time.Time{}, fmt.Errorf("reading config of %s: %v", desc.Digest, err)
+			}
+		case desc.MediaType.IsIndex():
+			child, err := idx.ImageIndex(desc.Digest)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if created, err = indexCreated(child); err != nil {
+				return time.Time{}, err
+			}
+		default:
+			continue
+		}
+		if created.After(newest) {
+			newest = created
+		}
+	}
+	return newest, nil
+}
+
+// schema1Created returns the created time in the v1Compatibility of the top
+// layer of a schema 1 manifest, which is that of the image.
+func schema1Created(manifest []byte) (time.Time, error) {
+	var m legacy.Schema1
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return time.Time{}, fmt.Errorf("parsing schema 1 manifest: %v", err)
+	}
+	if len(m.History) == 0 {
+		return time.Time{}, nil
+	}
+	var lcf legacy.LayerConfigFile
+	if err := json.Unmarshal([]byte(m.History[0].V1Compatibility), &lcf); err != nil {
+		return time.Time{}, fmt.Errorf("parsing v1Compatibility of top layer: %v", err)
+	}
+	return lcf.Created.Time, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func TestCreated(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	older := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	createdAt := func(created time.Time, platform v1.Platform) v1.Image {
+		t.Helper()
+		img, err := random.Image(1024, 1, random.WithPlatform(platform))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err = mutate.CreatedAt(img, v1.Time{Time: created})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img
+	}
+	amd64 := v1.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := v1.Platform{OS: "linux", Architecture: "arm64"}
+	img := createdAt(older, amd64)
+	idx := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: &amd64}},
+		mutate.IndexAddendum{Add: createdAt(newer, arm64), Descriptor: v1.Descriptor{Platform: &arm64}},
+	)
+	zero, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	push := func(tag string, obj remote.Taggable) string {
+		t.Helper()
+		ref, err := name.ParseReference(fmt.Sprintf("%s/test/created:%s", u.Host, tag))
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch obj := obj.(type) {
+		case v1.Image:
+			err = remote.Write(ref, obj)
+		case v1.ImageIndex:
+			err = remote.WriteIndex(ref, obj)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ref.String()
+	}
+
+	for _, tc := range []struct {
+		desc string
+		ref  string
+		opts []crane.Option
+		want time.Time
+	}{
+		{"image", push("image", img), nil, older},
+		{"index", push("index", idx), nil, newer},
+		{"platform", push("index", idx), []crane.Option{crane.WithPlatform(&amd64)}, older},
+		{"zero", push("zero", zero), nil, time.Time{}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := crane.Created(tc.ref, tc.opts...)
+			if err != nil {
+				t.Fatalf("Created() = %v", err)
+			}
+			if !got.Equal(tc.want) {
+				t.Errorf("Created() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCreatedSchema1(t *testing.T) {
+	manifest := `{
+   "schemaVersion": 1,
+   "name": "test/schema1",
+   "tag": "latest",
+   "fsLayers": [{"blobSum": "sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4"}],
+   "history": [{"v1Compatibility": "{\"id\":\"abc\",\"created\":\"2016-06-14T23:44:47.000Z\"}"}]
+}`
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/test/schema1/manifests/latest":
+			w.Header().Set("Content-Type", string(types.DockerManifestSchema1))
+			w.Write([]byte(manifest))
+		default:
+			t.Errorf("Unexpected path: %v", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := crane.Created(fmt.Sprintf("%s/test/schema1:latest", u.Host))
+	if err != nil {
+		t.Fatalf("Created() = %v", err)
+	}
+	if want := time.Date(2016, 6, 14, 23, 44, 47, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Created() = %v, want %v", got, want)
+	}
+}
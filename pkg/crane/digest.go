@@ -14,7 +14,15 @@
 
 package crane
 
-import "github.com/google/go-containerregistry/pkg/logs"
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/logs"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+)
 
 // Digest returns the sha256 hash of the remote image at ref.
 func Digest(ref string, opt ...Option) (string, error) {
@@ -50,3 +58,58 @@ func Digest(ref string, opt ...Option) (string, error) {
 	}
 	return desc.Digest.String(), nil
 }
+
+// LayoutDigest returns the digest of the image or index in the OCI image
+// layout at path, without any network access. This is the digest a registry
+// reports once it has been pushed.
+//
+// If tag is not empty, it selects the manifest whose
+// "org.opencontainers.image.ref.name" annotation is tag, otherwise the layout
+// must contain exactly one manifest. With WithPlatform, an index resolves to
+// the digest of its image for that platform, like Digest.
+func LayoutDigest(path, tag string, opt ...Option) (string, error) {
+	o := makeOptions(opt...)
+	p, err := layout.FromPath(path)
+	if err != nil {
+		return "", err
+	}
+	ii, err := p.ImageIndex()
+	if err != nil {
+		return "", err
+	}
+	// The referrers indexes of layout.WithReferrers aren't manifests of
+	// their own.
+	matcher := func(desc v1.Descriptor) bool { return !layout.IsReferrers(desc) }
+	if tag != "" {
+		matcher = match.Name(tag)
+	}
+	descs, err := partial.FindManifests(ii, matcher)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case len(descs) == 0 && tag != "":
+		return "", fmt.Errorf("no manifest tagged %q in %s", tag, path)
+	case len(descs) == 0:
+		return "", fmt.Errorf("no manifests in %s", path)
+	case len(descs) > 1:
+		return "", fmt.Errorf("found %d manifests in %s, select one with a tag", len(descs), path)
+	}
+
+	desc := descs[0]
+	if o.platform == nil || !desc.MediaType.IsIndex() {
+		return desc.Digest.String(), nil
+	}
+	child, err := ii.ImageIndex(desc.Digest)
+	if err != nil {
+		return "", err
+	}
+	children, err := partial.FindManifests(child, match.Platforms(*o.platform))
+	if err != nil {
+		return "", err
+	}
+	if len(children) == 0 {
+		return "", fmt.Errorf("no child with platform %s/%s in index %s", o.platform.OS, o.platform.Architecture, desc.Digest)
+	}
+	return children[0].Digest.String(), nil
+}
@@ -16,11 +16,21 @@ package crane
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"strings"
 	"testing"
 
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
@@ -59,3 +69,126 @@ func TestDigest_MissingDigest(t *testing.T) {
 		t.Errorf("Digest: expected GET to be called")
 	}
 }
+
+func TestLayoutDigest(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "crane-layout-digest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	platform := v1.Platform{OS: "linux", Architecture: "arm64"}
+	idx := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+		Add:        child,
+		Descriptor: v1.Descriptor{Platform: &platform},
+	})
+
+	p, err := layout.Write(tmp, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AppendImage(img); err != nil {
+		t.Fatal(err)
+	}
+
+	// A single manifest is selected without a tag.
+	got, err := LayoutDigest(tmp, "")
+	if err != nil {
+		t.Fatalf("LayoutDigest() = %v", err)
+	}
+
+	// The digest matches the registry's after a push.
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := fmt.Sprintf("%s/test/layout", u.Host)
+	if err := Push(img, dst); err != nil {
+		t.Fatal(err)
+	}
+	want, err := Digest(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("LayoutDigest() = %s, want %s", got, want)
+	}
+
+	if err := p.AppendIndex(idx, layout.WithAnnotations(map[string]string{
+		"org.opencontainers.image.ref.name": "multi",
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LayoutDigest(tmp, ""); err == nil || !strings.Contains(err.Error(), "found 2 manifests") {
+		t.Errorf("LayoutDigest() = %v, wanted error about multiple manifests", err)
+	}
+	if _, err := LayoutDigest(tmp, "missing"); err == nil {
+		t.Error("LayoutDigest(missing) = nil, wanted error")
+	}
+
+	idxDigest, err := idx.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := LayoutDigest(tmp, "multi"); err != nil {
+		t.Errorf("LayoutDigest(multi) = %v", err)
+	} else if got != idxDigest.String() {
+		t.Errorf("LayoutDigest(multi) = %s, want %s", got, idxDigest)
+	}
+
+	childDigest, err := child.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := LayoutDigest(tmp, "multi", WithPlatform(&platform)); err != nil {
+		t.Errorf("LayoutDigest(multi, %v) = %v", platform, err)
+	} else if got != childDigest.String() {
+		t.Errorf("LayoutDigest(multi, %v) = %s, want %s", platform, got, childDigest)
+	}
+	if _, err := LayoutDigest(tmp, "multi", WithPlatform(&v1.Platform{OS: "windows", Architecture: "amd64"})); err == nil {
+		t.Error("LayoutDigest(multi, windows) = nil, wanted error")
+	}
+}
+
+func TestLayoutDigestReferrers(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "crane-layout-digest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := layout.Write(tmp, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AppendImage(img); err != nil {
+		t.Fatal(err)
+	}
+	subject, err := partial.Descriptor(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := mutate.Subject(mutate.MediaType(empty.Image, types.OCIManifestSchema1), *subject)
+	if err := p.AppendImage(sig, layout.WithReferrers()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The referrers index of img isn't counted.
+	if _, err := LayoutDigest(tmp, ""); err == nil || !strings.Contains(err.Error(), "found 2 manifests") {
+		t.Errorf("LayoutDigest() = %v, wanted error about 2 manifests", err)
+	}
+}
@@ -22,6 +22,8 @@ import (
 )
 
 // Export writes the filesystem contents (as a tarball) of img to w.
+// Whiteouts, including opaque directories, are applied, so the result is
+// equivalent to "docker export".
 func Export(img v1.Image, w io.Writer) error {
 	fs := mutate.Extract(img)
 	_, err := io.Copy(w, fs)
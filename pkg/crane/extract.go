@@ -0,0 +1,348 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/internal/verify"
+	"github.com/google/go-containerregistry/pkg/logs"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/cache"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"golang.org/x/sync/errgroup"
+)
+
+// extractJobs is how many layers ExtractToDir fetches at once.
+const extractJobs = 4
+
+// ExtractToDir writes the flattened filesystem of img into dir, with
+// whiteouts applied, e.g. to build a rootfs bundle without a container
+// runtime. It's like Export, but creates the files, directories, symlinks,
+// hardlinks, fifos and device nodes instead of writing a tarball.
+//
+// The layers are first fetched in parallel into a temporary directory, and
+// verified against their digests. Permissions and timestamps are preserved,
+// and so is ownership if the process runs as root; device nodes are only
+// created as root, and skipped otherwise.
+//
+// Entries are never written outside of dir: names with ".." components are
+// rejected, as are entries under a symlink, so that symlinks in the image,
+// relative or absolute, can't be used to escape. Symlinks are created as they
+// are, since they're meant to be resolved relative to the root of the bundle.
+func ExtractToDir(img v1.Image, dir string) error {
+	tmp, err := ioutil.TempDir("", "crane-extract-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	c := cache.NewFilesystemCache(tmp)
+	if err := fetchLayers(img, c); err != nil {
+		return err
+	}
+
+	rc := mutate.Extract(cache.Image(img, c))
+	defer rc.Close()
+
+	x := &extractor{dir: dir, privileged: os.Geteuid() == 0}
+	tr := tar.NewReader(rc)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := x.extract(header, tr); err != nil {
+			return fmt.Errorf("extracting %q: %v", header.Name, err)
+		}
+	}
+	return x.finish()
+}
+
+// fetchLayers populates c with the verified compressed contents of the
+// layers of img, fetching at most extractJobs at once.
+func fetchLayers(img v1.Image, c cache.Cache) error {
+	layers, err := img.Layers()
+	if err != nil {
+		return fmt.Errorf("retrieving image layers: %v", err)
+	}
+
+	var g errgroup.Group
+	sem := make(chan struct{}, extractJobs)
+	fetched := map[v1.Hash]bool{}
+	for _, l := range layers {
+		h, err := l.Digest()
+		if err != nil {
+			return err
+		}
+		if fetched[h] {
+			continue
+		}
+		fetched[h] = true
+
+		l := l
+		sem <- struct{}{}
+		g.Go(func() error {
+			defer func() { <-sem }()
+			return fetchLayer(c, l)
+		})
+	}
+	return g.Wait()
+}
+
+func fetchLayer(c cache.Cache, l v1.Layer) error {
+	h, err := l.Digest()
+	if err != nil {
+		return err
+	}
+	size, err := l.Size()
+	if err != nil {
+		return err
+	}
+	cl, err := c.Put(l)
+	if err != nil {
+		return err
+	}
+	rc, err := cl.Compressed()
+	if err != nil {
+		return err
+	}
+	vrc, err := verify.ReadCloser(rc, size, h)
+	if err != nil {
+		rc.Close()
+		return err
+	}
+	if _, err := io.Copy(ioutil.Discard, vrc); err != nil {
+		vrc.Close()
+		return fmt.Errorf("fetching layer %s: %v", h, err)
+	}
+	return vrc.Close()
+}
+
+// extractor creates the entries of a flattened filesystem under dir.
+type extractor struct {
+	dir        string
+	privileged bool
+
+	// dirs are the directories extracted so far, whose metadata is set once
+	// everything has been extracted, since creating their contents would
+	// change their timestamps, and their permissions might not allow it.
+	dirs []*tar.Header
+}
+
+func (x *extractor) extract(header *tar.Header, r io.Reader) error {
+	name, err := safeName(header.Name)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		// The root is dir itself, which we leave alone.
+		return nil
+	}
+	if err := x.mkdirParents(name); err != nil {
+		return err
+	}
+	target := x.path(name)
+
+	// Replace whatever is in the way, without following symlinks, unless
+	// it's a directory that stays one.
+	if fi, err := os.Lstat(target); err == nil {
+		if !fi.IsDir() || header.Typeflag != tar.TypeDir {
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if err := os.Mkdir(target, 0700); err != nil && !os.IsExist(err) {
+			return err
+		}
+		x.dirs = append(x.dirs, header)
+		return nil
+	case tar.TypeReg, tar.TypeRegA:
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		if err := os.Symlink(header.Linkname, target); err != nil {
+			return err
+		}
+		return x.lchown(target, header)
+	case tar.TypeLink:
+		linkname, err := safeName(header.Linkname)
+		if err != nil {
+			return err
+		}
+		// Linking resolves symlinks along the target's parents, too.
+		if err := x.checkParents(linkname); err != nil {
+			return err
+		}
+		// Hardlinks share the target's metadata.
+		return os.Link(x.path(linkname), target)
+	case tar.TypeChar, tar.TypeBlock:
+		if !x.privileged {
+			logs.Warn.Printf("skipping device %s, which requires root", header.Name)
+			return nil
+		}
+		if err := mknod(target, header); err != nil {
+			return err
+		}
+	case tar.TypeFifo:
+		if err := mknod(target, header); err != nil {
+			return err
+		}
+	default:
+		logs.Warn.Printf("skipping %s of unsupported type %q", header.Name, header.Typeflag)
+		return nil
+	}
+	return x.setMetadata(target, header)
+}
+
+// finish sets the metadata of the extracted directories, children first.
+func (x *extractor) finish() error {
+	for i := len(x.dirs) - 1; i >= 0; i-- {
+		header := x.dirs[i]
+		name, err := safeName(header.Name)
+		if err != nil {
+			return err
+		}
+		if err := x.setDirMetadata(name, header); err != nil {
+			return fmt.Errorf("extracting %q: %v", header.Name, err)
+		}
+	}
+	return nil
+}
+
+// setDirMetadata applies the metadata of header to the directory called name,
+// unless a later entry replaced it, or one of its parents, with something
+// else, e.g. a symlink to a directory outside of dir.
+func (x *extractor) setDirMetadata(name string, header *tar.Header) error {
+	if err := x.checkParents(name); err != nil {
+		return err
+	}
+	target := x.path(name)
+	fi, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return nil
+	}
+	return x.setMetadata(target, header)
+}
+
+// setMetadata applies the ownership, permissions and timestamps of header to
+// target, which must not be a symlink.
+func (x *extractor) setMetadata(target string, header *tar.Header) error {
+	// Changing the owner clears setuid and setgid bits, so do it first.
+	if err := x.lchown(target, header); err != nil {
+		return err
+	}
+	if err := os.Chmod(target, header.FileInfo().Mode()); err != nil {
+		return err
+	}
+	atime := header.AccessTime
+	if atime.IsZero() {
+		atime = header.ModTime
+	}
+	return os.Chtimes(target, atime, header.ModTime)
+}
+
+// lchown sets the ownership of target, if we are privileged.
+func (x *extractor) lchown(target string, header *tar.Header) error {
+	if !x.privileged {
+		return nil
+	}
+	return os.Lchown(target, header.Uid, header.Gid)
+}
+
+// mkdirParents creates the missing parent directories of name, which some
+// tarballs have no entries for, and makes sure none of them is a symlink.
+func (x *extractor) mkdirParents(name string) error {
+	return x.walkParents(name, func(p string) error {
+		return os.Mkdir(p, 0755)
+	})
+}
+
+// checkParents makes sure that the parent directories of name exist, and
+// that none of them is a symlink.
+func (x *extractor) checkParents(name string) error {
+	return x.walkParents(name, func(p string) error {
+		return &os.PathError{Op: "lstat", Path: p, Err: os.ErrNotExist}
+	})
+}
+
+func (x *extractor) walkParents(name string, missing func(p string) error) error {
+	parts := strings.Split(name, "/")
+	for i := 1; i < len(parts); i++ {
+		parent := strings.Join(parts[:i], "/")
+		p := x.path(parent)
+		fi, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			if err := missing(p); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to write through symlink %q", parent)
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("parent %q is not a directory", parent)
+		}
+	}
+	return nil
+}
+
+// path returns where the entry called name, as returned by safeName, goes.
+func (x *extractor) path(name string) string {
+	return filepath.Join(x.dir, filepath.FromSlash(name))
+}
+
+// safeName cleans the name of a tar entry into a path relative to the root of
+// the filesystem, and rejects names that would escape it.
+func safeName(name string) (string, error) {
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("path %q escapes the root", name)
+		}
+	}
+	return strings.TrimPrefix(path.Clean("/"+name), "/"), nil
+}
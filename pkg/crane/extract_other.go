@@ -0,0 +1,29 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package crane
+
+import (
+	"archive/tar"
+	"fmt"
+	"runtime"
+)
+
+// mknod creates the device node or fifo described by header at target.
+func mknod(target string, header *tar.Header) error {
+	return fmt.Errorf("creating special files isn't supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,127 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// MutateOptions describes the changes Mutate makes to the config of an image.
+//
+// Fields that are nil are left as they are. Non-nil but empty values clear
+// the corresponding field, e.g. Entrypoint: []string{} removes the entrypoint.
+type MutateOptions struct {
+	// Entrypoint replaces the entrypoint.
+	Entrypoint []string
+
+	// Cmd replaces the default arguments.
+	Cmd []string
+
+	// Env contains KEY=VALUE pairs that are merged into the environment,
+	// replacing existing values of the same keys, unless ReplaceEnv is set.
+	Env []string
+
+	// ReplaceEnv replaces the whole environment with Env.
+	ReplaceEnv bool
+
+	// WorkingDir replaces the working directory.
+	WorkingDir *string
+
+	// User replaces the user.
+	User *string
+
+	// ExposedPorts are added to the exposed ports, e.g. "8080/tcp".
+	ExposedPorts []string
+
+	// Labels are merged into the labels.
+	Labels map[string]string
+}
+
+// Mutate returns a new v1.Image with the config of img changed as described
+// by opts.
+func Mutate(img v1.Image, opts MutateOptions) (v1.Image, error) {
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("getting config: %v", err)
+	}
+	cfg := *cf.Config.DeepCopy()
+
+	if opts.Entrypoint != nil {
+		cfg.Entrypoint = opts.Entrypoint
+	}
+	if opts.Cmd != nil {
+		cfg.Cmd = opts.Cmd
+	}
+	if opts.ReplaceEnv {
+		cfg.Env = opts.Env
+	} else if opts.Env != nil {
+		env, err := mergeEnv(cfg.Env, opts.Env)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Env = env
+	}
+	if opts.WorkingDir != nil {
+		cfg.WorkingDir = *opts.WorkingDir
+	}
+	if opts.User != nil {
+		cfg.User = *opts.User
+	}
+	if len(opts.ExposedPorts) != 0 {
+		if cfg.ExposedPorts == nil {
+			cfg.ExposedPorts = map[string]struct{}{}
+		}
+		for _, p := range opts.ExposedPorts {
+			cfg.ExposedPorts[p] = struct{}{}
+		}
+	}
+	if len(opts.Labels) != 0 {
+		if cfg.Labels == nil {
+			cfg.Labels = map[string]string{}
+		}
+		for k, v := range opts.Labels {
+			cfg.Labels[k] = v
+		}
+	}
+
+	return mutate.Config(img, cfg)
+}
+
+// mergeEnv sets the KEY=VALUE pairs of add in env, keeping the position of
+// existing keys.
+func mergeEnv(env, add []string) ([]string, error) {
+	merged := append([]string{}, env...)
+	index := map[string]int{}
+	for i, kv := range merged {
+		index[strings.SplitN(kv, "=", 2)[0]] = i
+	}
+	for _, kv := range add {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("parsing env %q, want KEY=VALUE", kv)
+		}
+		if i, ok := index[parts[0]]; ok {
+			merged[i] = kv
+			continue
+		}
+		index[parts[0]] = len(merged)
+		merged = append(merged, kv)
+	}
+	return merged, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/crane"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestMutate(t *testing.T) {
+	rnd, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := mutate.Config(rnd, v1.Config{
+		Entrypoint:   []string{"/bin/app"},
+		Cmd:          []string{"--serve"},
+		Env:          []string{"PATH=/bin", "HOME=/root"},
+		WorkingDir:   "/work",
+		User:         "root",
+		ExposedPorts: map[string]struct{}{"80/tcp": {}},
+		Labels:       map[string]string{"keep": "me"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseName, err := base.ConfigName()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	empty := ""
+	img, err := crane.Mutate(base, crane.MutateOptions{
+		Entrypoint:   []string{},
+		Env:          []string{"HOME=/home/app", "DEBUG=1"},
+		WorkingDir:   &empty,
+		ExposedPorts: []string{"8080/tcp"},
+		Labels:       map[string]string{"new": "label"},
+	})
+	if err != nil {
+		t.Fatalf("Mutate() = %v", err)
+	}
+	if name, err := img.ConfigName(); err != nil {
+		t.Fatal(err)
+	} else if name == baseName {
+		t.Error("Mutate() didn't change the config digest")
+	}
+
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := v1.Config{
+		Entrypoint:   []string{},
+		Cmd:          []string{"--serve"},
+		Env:          []string{"PATH=/bin", "HOME=/home/app", "DEBUG=1"},
+		User:         "root",
+		ExposedPorts: map[string]struct{}{"80/tcp": {}, "8080/tcp": {}},
+		Labels:       map[string]string{"keep": "me", "new": "label"},
+	}
+	if diff := cmp.Diff(want, cf.Config); diff != "" {
+		t.Errorf("Mutate() config (-want +got) = %s", diff)
+	}
+
+	// The base is left alone.
+	if cf, err := base.ConfigFile(); err != nil {
+		t.Fatal(err)
+	} else if diff := cmp.Diff([]string{"PATH=/bin", "HOME=/root"}, cf.Config.Env); diff != "" {
+		t.Errorf("Mutate() changed the base (-want +got) = %s", diff)
+	}
+
+	img, err = crane.Mutate(base, crane.MutateOptions{
+		Env:        []string{"ONLY=this"},
+		ReplaceEnv: true,
+	})
+	if err != nil {
+		t.Fatalf("Mutate() = %v", err)
+	}
+	if cf, err := img.ConfigFile(); err != nil {
+		t.Fatal(err)
+	} else if diff := cmp.Diff([]string{"ONLY=this"}, cf.Config.Env); diff != "" {
+		t.Errorf("Mutate(ReplaceEnv) env (-want +got) = %s", diff)
+	}
+
+	if _, err := crane.Mutate(base, crane.MutateOptions{Env: []string{"NOVALUE"}}); err == nil {
+		t.Error("Mutate(NOVALUE) = nil, wanted error")
+	}
+}
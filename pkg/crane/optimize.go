@@ -15,8 +15,12 @@
 package crane
 
 import (
+	"archive/tar"
 	"errors"
 	"fmt"
+	"io"
+	"path"
+	"strings"
 
 	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/google/go-containerregistry/pkg/logs"
@@ -30,10 +34,20 @@ import (
 )
 
 // Optimize optimizes a remote image or index from src to dst.
+//
+// By default, the layers are converted to estargz, with the prioritized files
+// first, so that they can be lazily pulled. See WithEstargz,
+// WithCompressionLevel and WithLayerReordering to change how the layers are
+// recompressed and ordered. Whatever the options, the flattened filesystem of
+// the optimized image is the same as that of src.
+//
 // THIS API IS EXPERIMENTAL AND SUBJECT TO CHANGE WITHOUT WARNING.
 func Optimize(src, dst string, prioritize []string, opt ...Option) error {
 	pset := newStringSet(prioritize)
 	o := makeOptions(opt...)
+	if o.noEstargz && len(prioritize) > 0 {
+		return errors.New("prioritizing files requires estargz")
+	}
 	srcRef, err := name.ParseReference(src, o.name...)
 	if err != nil {
 		return fmt.Errorf("parsing reference %q: %v", src, err)
@@ -83,7 +97,7 @@ func optimizeAndPushImage(desc *remote.Descriptor, dstRef name.Reference, priori
 		return err
 	}
 
-	missing, oimg, err := optimizeImage(img, prioritize)
+	missing, oimg, err := optimizeImage(img, prioritize, o)
 	if err != nil {
 		return err
 	}
@@ -95,7 +109,7 @@ func optimizeAndPushImage(desc *remote.Descriptor, dstRef name.Reference, priori
 	return remote.Write(dstRef, oimg, o.remote...)
 }
 
-func optimizeImage(img v1.Image, prioritize stringSet) (stringSet, v1.Image, error) {
+func optimizeImage(img v1.Image, prioritize stringSet, o options) (stringSet, v1.Image, error) {
 	cfg, err := img.ConfigFile()
 	if err != nil {
 		return nil, nil, err
@@ -113,17 +127,29 @@ func optimizeImage(img v1.Image, prioritize stringSet) (stringSet, v1.Image, err
 	if err != nil {
 		return nil, nil, err
 	}
+	if o.reorderLayers {
+		if layers, err = reorderLayers(layers); err != nil {
+			return nil, nil, err
+		}
+	}
 
 	missingFromImage := newStringSet(prioritize.List())
 	olayers := make([]mutate.Addendum, 0, len(layers))
 	for _, layer := range layers {
+		lopts := []tarball.LayerOption{}
+		if o.compressionLevel != nil {
+			lopts = append(lopts, tarball.WithCompressionLevel(*o.compressionLevel))
+		}
 		missingFromLayer := []string{}
-		olayer, err := tarball.LayerFromOpener(layer.Uncompressed,
-			tarball.WithEstargz,
-			tarball.WithEstargzOptions(
-				estargz.WithPrioritizedFiles(prioritize.List()),
-				estargz.WithAllowPrioritizeNotFound(&missingFromLayer),
-			))
+		if !o.noEstargz {
+			lopts = append(lopts,
+				tarball.WithEstargz,
+				tarball.WithEstargzOptions(
+					estargz.WithPrioritizedFiles(prioritize.List()),
+					estargz.WithAllowPrioritizeNotFound(&missingFromLayer),
+				))
+		}
+		olayer, err := tarball.LayerFromOpener(layer.Uncompressed, lopts...)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -148,7 +174,7 @@ func optimizeAndPushIndex(desc *remote.Descriptor, dstRef name.Reference, priori
 		return err
 	}
 
-	missing, oidx, err := optimizeIndex(idx, prioritize)
+	missing, oidx, err := optimizeIndex(idx, prioritize, o)
 	if err != nil {
 		return err
 	}
@@ -160,7 +186,7 @@ func optimizeAndPushIndex(desc *remote.Descriptor, dstRef name.Reference, priori
 	return remote.WriteIndex(dstRef, oidx, o.remote...)
 }
 
-func optimizeIndex(idx v1.ImageIndex, prioritize stringSet) (stringSet, v1.ImageIndex, error) {
+func optimizeIndex(idx v1.ImageIndex, prioritize stringSet, o options) (stringSet, v1.ImageIndex, error) {
 	im, err := idx.IndexManifest()
 	if err != nil {
 		return nil, nil, err
@@ -176,7 +202,7 @@ func optimizeIndex(idx v1.ImageIndex, prioritize stringSet) (stringSet, v1.Image
 			return nil, nil, err
 		}
 
-		missingFromImage, oimg, err := optimizeImage(img, prioritize)
+		missingFromImage, oimg, err := optimizeImage(img, prioritize, o)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -200,6 +226,135 @@ func optimizeIndex(idx v1.ImageIndex, prioritize stringSet) (stringSet, v1.Image
 	return missingFromIndex, mutate.IndexMediaType(mutate.AppendManifests(empty.Index, adds...), idxType), nil
 }
 
+// reorderLayers moves larger layers towards the bottom, by swapping adjacent
+// layers whose paths don't overlap, which doesn't change the flattened
+// filesystem.
+func reorderLayers(layers []v1.Layer) ([]v1.Layer, error) {
+	sizes := make([]int64, len(layers))
+	paths := make([]*layerPaths, len(layers))
+	for i, layer := range layers {
+		size, err := layer.Size()
+		if err != nil {
+			return nil, err
+		}
+		sizes[i] = size
+		if paths[i], err = readLayerPaths(layer); err != nil {
+			return nil, err
+		}
+	}
+
+	// Insertion sort by descending size, where layers stop moving down when
+	// they hit one they conflict with.
+	order := make([]int, 0, len(layers))
+	for i := range layers {
+		order = append(order, i)
+		for j := len(order) - 1; j > 0; j-- {
+			below, above := order[j-1], order[j]
+			if sizes[below] >= sizes[above] || paths[below].conflicts(paths[above]) {
+				break
+			}
+			order[j-1], order[j] = above, below
+		}
+	}
+
+	reordered := make([]v1.Layer, 0, len(layers))
+	for _, i := range order {
+		reordered = append(reordered, layers[i])
+	}
+	return reordered, nil
+}
+
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = whiteoutPrefix + whiteoutPrefix + ".opq"
+)
+
+// layerPaths records the paths that a layer writes or deletes.
+type layerPaths struct {
+	// entries maps the paths that the layer writes to the metadata of
+	// directories, which two layers can write the same way, or to "" for
+	// anything else.
+	entries map[string]string
+	// deleted holds the paths that the layer's whiteouts delete, along with
+	// everything under them.
+	deleted map[string]bool
+}
+
+func readLayerPaths(layer v1.Layer) (*layerPaths, error) {
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	lp := &layerPaths{
+		entries: map[string]string{},
+		deleted: map[string]bool{},
+	}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return lp, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		p := path.Clean("/" + hdr.Name)
+		dir, base := path.Split(p)
+		if base == opaqueWhiteout {
+			// An opaque whiteout deletes everything in its directory.
+			lp.deleted[path.Clean(dir)] = true
+			continue
+		} else if strings.HasPrefix(base, whiteoutPrefix) {
+			lp.deleted[path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))] = true
+			continue
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			lp.entries[p] = fmt.Sprint(hdr.Mode, hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname, hdr.ModTime.UnixNano(), hdr.PAXRecords)
+		case tar.TypeLink:
+			// Treat the target of a hardlink as written, too, so the layer doesn't
+			// move past one that writes it.
+			lp.entries[path.Clean("/"+hdr.Linkname)] = ""
+			lp.entries[p] = ""
+		default:
+			lp.entries[p] = ""
+		}
+	}
+}
+
+// conflicts returns whether applying lp and other in a different order can
+// result in a different filesystem.
+func (lp *layerPaths) conflicts(other *layerPaths) bool {
+	return lp.shadows(other) || other.shadows(lp)
+}
+
+// shadows returns whether lp writes a path that other writes differently,
+// or that is under a path that other deletes or writes as a non-directory.
+func (lp *layerPaths) shadows(other *layerPaths) bool {
+	for p, meta := range lp.entries {
+		if otherMeta, ok := other.entries[p]; ok && (meta == "" || meta != otherMeta) {
+			return true
+		}
+		for q := p; ; q = path.Dir(q) {
+			if other.deleted[q] {
+				return true
+			}
+			if q != p {
+				if otherMeta, ok := other.entries[q]; ok && otherMeta == "" {
+					return true
+				}
+			}
+			if q == "/" {
+				break
+			}
+		}
+	}
+	return false
+}
+
 type stringSet map[string]struct{}
 
 func newStringSet(in []string) stringSet {
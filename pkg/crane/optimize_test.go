@@ -15,6 +15,12 @@
 package crane
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
 	"net/http/httptest"
 	"net/url"
 	"path"
@@ -177,3 +183,101 @@ func TestOptimize(t *testing.T) {
 		}
 	}
 }
+
+func TestOptimizeReorderLayers(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Random content, so that the compressed sizes differ as much.
+	rnd := rand.New(rand.NewSource(0))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rnd.Read(b)
+		return b
+	}
+	var layers []v1.Layer
+	for _, fm := range []map[string][]byte{
+		{"small": []byte("small")},
+		// Overwrites small, so it can't move below it.
+		{"small": random(10 << 10)},
+		{"big": random(100 << 10)},
+		// Deletes big, so it can't move below it.
+		{".wh.big": nil, "tiny": []byte("tiny")},
+	} {
+		layer, err := Layer(fm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		layers = append(layers, layer)
+	}
+	img, err := mutate.AppendLayers(empty.Image, layers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := path.Join(u.Host, "src")
+	dst := path.Join(u.Host, "dst")
+	if err := Push(img, src); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Optimize(src, dst, []string{"small"}, WithEstargz(false)); err == nil {
+		t.Error("Optimize(prioritize, WithEstargz(false)) = nil, wanted error")
+	}
+	if err := Optimize(src, dst, nil, WithEstargz(false), WithLayerReordering, WithCompressionLevel(gzip.BestCompression)); err != nil {
+		t.Fatal(err)
+	}
+	oimg, err := Pull(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The big layer moves to the bottom, past the small ones that don't
+	// conflict with it.
+	ocfg, err := oimg.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []v1.Hash
+	for _, i := range []int{2, 0, 1, 3} {
+		diffID, err := layers[i].DiffID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, diffID)
+	}
+	if diff := cmp.Diff(want, ocfg.RootFS.DiffIDs); diff != "" {
+		t.Errorf("DiffIDs (-want +got): %s", diff)
+	}
+
+	if diff := cmp.Diff(flattened(t, img), flattened(t, oimg)); diff != "" {
+		t.Errorf("flattened filesystem (-want +got): %s", diff)
+	}
+}
+
+// flattened returns the headers and contents of the flattened filesystem of
+// img, by path.
+func flattened(t *testing.T, img v1.Image) map[string]string {
+	t.Helper()
+	rc := mutate.Extract(img)
+	defer rc.Close()
+
+	fs := map[string]string{}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fs
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fs[hdr.Name] = fmt.Sprintf("%+v %x", *hdr, b)
+	}
+}
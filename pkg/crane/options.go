@@ -21,6 +21,7 @@ import (
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/cache"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 )
 
@@ -28,6 +29,15 @@ type options struct {
 	name     []name.Option
 	remote   []remote.Option
 	platform *v1.Platform
+	cache    cache.Cache
+
+	// See Copy.
+	copyAnnotations map[string]string
+
+	// See Optimize.
+	compressionLevel *int
+	noEstargz        bool
+	reorderLayers    bool
 }
 
 func makeOptions(opts ...Option) options {
@@ -68,6 +78,14 @@ func WithPlatform(platform *v1.Platform) Option {
 	}
 }
 
+// WithPlatformFilter is an Option to copy only the children of an index that
+// match one of the given platforms. See remote.WithPlatformFilter.
+func WithPlatformFilter(platforms []v1.Platform) Option {
+	return func(o *options) {
+		o.remote = append(o.remote, remote.WithPlatformFilter(platforms))
+	}
+}
+
 // WithAuthFromKeychain is a functional option for overriding the default
 // authenticator for remote operations, using an authn.Keychain to find
 // credentials.
@@ -105,3 +123,61 @@ func WithContext(ctx context.Context) Option {
 		o.remote = append(o.remote, remote.WithContext(ctx))
 	}
 }
+
+// WithCache is a functional option for caching layers on disk at path, see
+// cache.NewFilesystemCache.
+//
+// Pull, Copy and CopyRepository serve layers that are already cached from
+// disk, and cache the layers they fetch as they are read. Cached layers are
+// keyed by their digest, and are verified against it when they are read.
+func WithCache(path string) Option {
+	return func(o *options) {
+		o.cache = cache.NewFilesystemCache(path)
+	}
+}
+
+// WithCopyAnnotations is an Option for Copy and CopyRepository to merge the
+// given annotations into the manifest of each image or index they push, e.g.
+// to record where and when it was copied from:
+//
+//	crane.WithCopyAnnotations(map[string]string{
+//		"org.opencontainers.image.ref.name": src,
+//		"com.example.copied-at": time.Now().UTC().Format(time.RFC3339),
+//	})
+//
+// Only the top-level manifest is annotated, so the layers, and the children
+// of an index, keep their digests, and can still be pulled from the
+// destination by the digests they have in the source. The top-level manifest
+// gets a new digest, so it can't be copied to a digest reference, and schema
+// 1 images, which have no annotations, can't be copied at all.
+func WithCopyAnnotations(annotations map[string]string) Option {
+	return func(o *options) {
+		o.copyAnnotations = annotations
+	}
+}
+
+// WithCompressionLevel is an Option to set the gzip compression level that
+// Optimize recompresses layers with, e.g. gzip.BestCompression. The default
+// is gzip.BestSpeed.
+func WithCompressionLevel(level int) Option {
+	return func(o *options) {
+		o.compressionLevel = &level
+	}
+}
+
+// WithEstargz is an Option to set whether Optimize converts layers to
+// estargz, so that they can be lazily pulled. It does by default.
+func WithEstargz(enabled bool) Option {
+	return func(o *options) {
+		o.noEstargz = !enabled
+	}
+}
+
+// WithLayerReordering is an Option for Optimize to move larger layers towards
+// the bottom of the image, where they are less likely to change, so that
+// pulls of later versions of the image can reuse them. Layers only move past
+// layers whose paths they don't overlap, so the flattened filesystem of the
+// image stays the same.
+func WithLayerReordering(o *options) {
+	o.reorderLayers = true
+}
@@ -0,0 +1,317 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-containerregistry/internal/legacy"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"golang.org/x/sync/errgroup"
+)
+
+// planJobs is how many HEAD requests Plan makes at once.
+const planJobs = 4
+
+// BlobAction is what Copy would do with a blob, see Plan.
+type BlobAction string
+
+const (
+	// BlobPresent means that the blob already exists at the destination.
+	BlobPresent BlobAction = "present"
+	// BlobMount means that the blob would be mounted from the source
+	// repository, because it's on the same registry as the destination.
+	// Registries may refuse to mount, in which case it's uploaded.
+	BlobMount BlobAction = "mount"
+	// BlobUpload means that the blob would be uploaded to the destination.
+	BlobUpload BlobAction = "upload"
+)
+
+// PlannedBlob is a blob that Copy would need at the destination.
+type PlannedBlob struct {
+	Digest    v1.Hash
+	Size      int64
+	MediaType types.MediaType
+	Action    BlobAction
+}
+
+// PlannedManifest is a manifest that Copy would push to the destination.
+type PlannedManifest struct {
+	Digest    v1.Hash
+	Size      int64
+	MediaType types.MediaType
+	// Exists is whether the destination already has the manifest, which
+	// Copy pushes anyway, e.g. to update the tag.
+	Exists bool
+}
+
+// CopyPlan is what Copy would transfer, as returned by Plan.
+type CopyPlan struct {
+	// Manifests are all the manifests Copy would push, children first.
+	Manifests []PlannedManifest
+	// Blobs are all the blobs the manifests refer to, once each.
+	Blobs []PlannedBlob
+
+	// UploadBytes, MountBytes and PresentBytes are the total sizes of the
+	// Blobs with BlobUpload, BlobMount and BlobPresent.
+	UploadBytes, MountBytes, PresentBytes int64
+}
+
+// Plan works out what Copy(src, dst, opt...) would transfer, without
+// transferring anything, e.g. to estimate the cost of mirroring images. It
+// reads the manifests of src, and makes HEAD requests to dst for each of its
+// blobs and manifests, to tell which blobs already exist there, which can be
+// mounted from src and which would be uploaded.
+//
+// Foreign layers, which Copy doesn't upload by default, are left out.
+func Plan(src, dst string, opt ...Option) (*CopyPlan, error) {
+	o := makeOptions(opt...)
+	srcRef, err := name.ParseReference(src, o.name...)
+	if err != nil {
+		return nil, fmt.Errorf("parsing reference %q: %v", src, err)
+	}
+	dstRef, err := name.ParseReference(dst, o.name...)
+	if err != nil {
+		return nil, fmt.Errorf("parsing reference for %q: %v", dst, err)
+	}
+
+	o.remote = shareTokens(o.remote, srcRef.Context(), dstRef.Context())
+
+	desc, err := remote.Get(srcRef, o.remote...)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %q: %v", src, err)
+	}
+
+	p := &planner{plan: &CopyPlan{}, seen: map[v1.Hash]bool{}, o: o}
+	switch desc.MediaType {
+	case types.OCIImageIndex, types.DockerManifestList:
+		if o.platform != nil {
+			err = p.addTaggable(imageToCopy(desc, o))
+		} else {
+			err = p.addTaggable(indexToCopy(desc, o))
+		}
+	case types.DockerManifestSchema1, types.DockerManifestSchema1Signed:
+		if o.copyAnnotations != nil {
+			return nil, fmt.Errorf("cannot annotate schema 1 image %q", src)
+		}
+		err = p.addSchema1(desc, srcRef.Context())
+	default:
+		err = p.addTaggable(imageToCopy(desc, o))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("planning copy of %q: %v", src, err)
+	}
+	if err := p.check(srcRef.Context(), dstRef.Context()); err != nil {
+		return nil, fmt.Errorf("checking %q: %v", dst, err)
+	}
+	return p.plan, nil
+}
+
+// planner collects the manifests and blobs of a CopyPlan.
+type planner struct {
+	plan *CopyPlan
+	// seen are the digests of the blobs and manifests that were added.
+	seen map[v1.Hash]bool
+	o    options
+}
+
+// addTaggable adds the image or index returned along with err.
+func (p *planner) addTaggable(t remote.Taggable, err error) error {
+	if err != nil {
+		return err
+	}
+	switch t := t.(type) {
+	case v1.Image:
+		return p.addImage(t)
+	case v1.ImageIndex:
+		return p.addIndex(t)
+	}
+	return fmt.Errorf("unexpected %T", t)
+}
+
+func (p *planner) addImage(img v1.Image) error {
+	m, err := img.Manifest()
+	if err != nil {
+		return err
+	}
+	p.addBlob(m.Config)
+	for _, l := range m.Layers {
+		if l.MediaType.IsDistributable() {
+			p.addBlob(l)
+		}
+	}
+	return p.addManifest(img)
+}
+
+func (p *planner) addIndex(idx v1.ImageIndex) error {
+	m, err := idx.IndexManifest()
+	if err != nil {
+		return err
+	}
+	for _, desc := range m.Manifests {
+		if p.seen[desc.Digest] {
+			continue
+		}
+		switch {
+		case desc.MediaType.IsImage():
+			img, err := idx.Image(desc.Digest)
+			if err != nil {
+				return err
+			}
+			if err := p.addImage(img); err != nil {
+				return err
+			}
+		case desc.MediaType.IsIndex():
+			child, err := idx.ImageIndex(desc.Digest)
+			if err != nil {
+				return err
+			}
+			if err := p.addIndex(child); err != nil {
+				return err
+			}
+		default:
+			// Copied as they are, without looking inside.
+			p.addManifestDescriptor(desc)
+		}
+	}
+	return p.addManifest(idx)
+}
+
+// addSchema1 adds the blobs of a schema 1 manifest, whose sizes aren't in the
+// manifest, so they are looked up in src.
+func (p *planner) addSchema1(desc *remote.Descriptor, src name.Repository) error {
+	digests, err := legacy.Schema1Blobs(desc.Manifest)
+	if err != nil {
+		return err
+	}
+	for _, h := range digests {
+		if p.seen[h] {
+			continue
+		}
+		l, err := remote.Layer(src.Digest(h.String()), p.o.remote...)
+		if err != nil {
+			return err
+		}
+		size, err := l.Size()
+		if err != nil {
+			return err
+		}
+		p.addBlob(v1.Descriptor{Digest: h, Size: size, MediaType: types.DockerLayer})
+	}
+	p.addManifestDescriptor(desc.Descriptor)
+	return nil
+}
+
+func (p *planner) addBlob(desc v1.Descriptor) {
+	if p.seen[desc.Digest] {
+		return
+	}
+	p.seen[desc.Digest] = true
+	p.plan.Blobs = append(p.plan.Blobs, PlannedBlob{
+		Digest:    desc.Digest,
+		Size:      desc.Size,
+		MediaType: desc.MediaType,
+	})
+}
+
+func (p *planner) addManifest(t partial.Describable) error {
+	desc, err := partial.Descriptor(t)
+	if err != nil {
+		return err
+	}
+	p.addManifestDescriptor(*desc)
+	return nil
+}
+
+func (p *planner) addManifestDescriptor(desc v1.Descriptor) {
+	if p.seen[desc.Digest] {
+		return
+	}
+	p.seen[desc.Digest] = true
+	p.plan.Manifests = append(p.plan.Manifests, PlannedManifest{
+		Digest:    desc.Digest,
+		Size:      desc.Size,
+		MediaType: desc.MediaType,
+	})
+}
+
+// check looks up the blobs and manifests of the plan in dst.
+func (p *planner) check(src, dst name.Repository) error {
+	blobs, err := remote.Blobs(dst, p.o.remote...)
+	if err != nil {
+		return err
+	}
+	mountable := src.Registry == dst.Registry && src.RepositoryStr() != dst.RepositoryStr()
+
+	var g errgroup.Group
+	sem := make(chan struct{}, planJobs)
+	for i := range p.plan.Blobs {
+		b := &p.plan.Blobs[i]
+		sem <- struct{}{}
+		g.Go(func() error {
+			defer func() { <-sem }()
+			exists, err := blobs.Exists(b.Digest)
+			switch {
+			case err != nil:
+				return err
+			case exists:
+				b.Action = BlobPresent
+			case mountable:
+				b.Action = BlobMount
+			default:
+				b.Action = BlobUpload
+			}
+			return nil
+		})
+	}
+	for i := range p.plan.Manifests {
+		m := &p.plan.Manifests[i]
+		sem <- struct{}{}
+		g.Go(func() error {
+			defer func() { <-sem }()
+			_, err := remote.Head(dst.Digest(m.Digest.String()), p.o.remote...)
+			var terr *transport.Error
+			if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			m.Exists = true
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	for _, b := range p.plan.Blobs {
+		switch b.Action {
+		case BlobUpload:
+			p.plan.UploadBytes += b.Size
+		case BlobMount:
+			p.plan.MountBytes += b.Size
+		case BlobPresent:
+			p.plan.PresentBytes += b.Size
+		}
+	}
+	return nil
+}
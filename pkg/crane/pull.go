@@ -21,10 +21,14 @@ import (
 	legacy "github.com/google/go-containerregistry/pkg/legacy/tarball"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/cache"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // Tag applied to images that were pulled by digest. This denotes that the
@@ -40,7 +44,14 @@ func Pull(src string, opt ...Option) (v1.Image, error) {
 		return nil, fmt.Errorf("parsing reference %q: %v", src, err)
 	}
 
-	return remote.Image(ref, o.remote...)
+	img, err := remote.Image(ref, o.remote...)
+	if err != nil {
+		return nil, err
+	}
+	if o.cache != nil {
+		img = cache.Image(img, o.cache)
+	}
+	return img, nil
 }
 
 // Save writes the v1.Image img as a tarball at path with tag src.
@@ -139,3 +150,84 @@ func MultiSaveOCI(imgMap map[string]v1.Image, path string) error {
 	}
 	return nil
 }
+
+// PullOCI writes the remote image or index src, with all of its platforms
+// unless WithPlatform selects one, into the OCI Image Layout at path, creating
+// it if it doesn't exist. Its manifests, configs and layers are written
+// as they are, so that the layout can be pushed back without changing any
+// digests, and blobs that the layout already has are not fetched again.
+//
+// If src is a tag, the manifest is listed in the index.json of the layout
+// with the tag as its "org.opencontainers.image.ref.name" annotation,
+// replacing any that was listed with that tag before, see LayoutDigest.
+func PullOCI(src, path string, opt ...Option) error {
+	o := makeOptions(opt...)
+	ref, err := name.ParseReference(src, o.name...)
+	if err != nil {
+		return fmt.Errorf("parsing reference %q: %v", src, err)
+	}
+	desc, err := remote.Get(ref, o.remote...)
+	if err != nil {
+		return fmt.Errorf("fetching %q: %v", src, err)
+	}
+
+	p, err := layout.FromPath(path)
+	if os.IsNotExist(err) {
+		p, err = layout.Write(path, empty.Index)
+	}
+	if err != nil {
+		return err
+	}
+
+	var (
+		matcher match.Matcher
+		options []layout.Option
+	)
+	if tag, ok := ref.(name.Tag); ok {
+		matcher = match.Name(tag.TagStr())
+		options = append(options, layout.WithAnnotations(map[string]string{
+			imagespec.AnnotationRefName: tag.TagStr(),
+		}))
+	}
+
+	switch {
+	case desc.MediaType.IsIndex() && o.platform == nil:
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return err
+		}
+		if o.cache != nil {
+			idx = cache.ImageIndex(idx, o.cache)
+		}
+		if matcher == nil {
+			matcher = untagged(desc.Digest)
+		}
+		return p.ReplaceIndex(idx, matcher, options...)
+	case desc.MediaType == types.DockerManifestSchema1, desc.MediaType == types.DockerManifestSchema1Signed:
+		return fmt.Errorf("cannot write schema 1 image %q to an OCI Image Layout", src)
+	default:
+		img, err := desc.Image()
+		if err != nil {
+			return err
+		}
+		if o.cache != nil {
+			img = cache.Image(img, o.cache)
+		}
+		if matcher == nil {
+			d, err := img.Digest()
+			if err != nil {
+				return err
+			}
+			matcher = untagged(d)
+		}
+		return p.ReplaceImage(img, matcher, options...)
+	}
+}
+
+// untagged matches the descriptor of the manifest h in the index.json of a
+// layout if it isn't tagged, so that the same manifest isn't listed twice.
+func untagged(h v1.Hash) match.Matcher {
+	return func(desc v1.Descriptor) bool {
+		return desc.Digest == h && desc.Annotations[imagespec.AnnotationRefName] == ""
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// The annotations that record the base image of an image, see:
+// https://github.com/opencontainers/image-spec/blob/main/annotations.md
+const (
+	baseNameAnnotation   = "org.opencontainers.image.base.name"
+	baseDigestAnnotation = "org.opencontainers.image.base.digest"
+)
+
+// Rebase replaces the layers of oldBase at the bottom of the remote image orig
+// with the layers of newBase, see mutate.Rebase, and pushes the result as
+// rebased, returning its digest.
+//
+// If oldBase is empty, it is inferred from the base image annotations of
+// orig's manifest, and it's an error if orig has none. The rebased image is
+// annotated with newBase, so that it can be rebased again the same way.
+//
+// Only orig's own layers are pushed: those of newBase are mounted from its
+// repository, or left alone if rebased's repository has them already.
+func Rebase(orig, oldBase, newBase, rebased string, opt ...Option) (name.Digest, error) {
+	o := makeOptions(opt...)
+	dst, err := name.ParseReference(rebased, o.name...)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("parsing reference %q: %v", rebased, err)
+	}
+
+	origImg, err := Pull(orig, opt...)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("pulling %s: %v", orig, err)
+	}
+	if oldBase == "" {
+		m, err := origImg.Manifest()
+		if err != nil {
+			return name.Digest{}, fmt.Errorf("reading manifest of %s: %v", orig, err)
+		}
+		if oldBase, err = baseFromAnnotations(m.Annotations, o.name...); err != nil {
+			return name.Digest{}, fmt.Errorf("inferring old base of %s: %v", orig, err)
+		}
+	}
+	oldBaseImg, err := Pull(oldBase, opt...)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("pulling %s: %v", oldBase, err)
+	}
+	newBaseRef, err := name.ParseReference(newBase, o.name...)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("parsing reference %q: %v", newBase, err)
+	}
+	newBaseImg, err := remote.Image(newBaseRef, o.remote...)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("pulling %s: %v", newBase, err)
+	}
+
+	img, err := mutate.Rebase(origImg, oldBaseImg, newBaseImg)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("rebasing: %v", err)
+	}
+	newBaseDigest, err := newBaseImg.Digest()
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("digesting %s: %v", newBase, err)
+	}
+	img = mutate.Annotations(img, map[string]string{
+		baseNameAnnotation:   newBaseRef.Name(),
+		baseDigestAnnotation: newBaseDigest.String(),
+	})
+
+	if err := remote.Write(dst, img, o.remote...); err != nil {
+		return name.Digest{}, fmt.Errorf("pushing %s: %v", dst, err)
+	}
+	d, err := img.Digest()
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("digesting rebased: %v", err)
+	}
+	return dst.Context().Digest(d.String()), nil
+}
+
+// baseFromAnnotations returns the reference to the base image recorded in
+// annotations, pinned to its digest if that's recorded too.
+func baseFromAnnotations(annotations map[string]string, opt ...name.Option) (string, error) {
+	base, digest := annotations[baseNameAnnotation], annotations[baseDigestAnnotation]
+	if base == "" {
+		return "", fmt.Errorf("no %s annotation, specify the old base explicitly", baseNameAnnotation)
+	}
+	if digest == "" {
+		return base, nil
+	}
+	ref, err := name.ParseReference(base, opt...)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s annotation %q: %v", baseNameAnnotation, base, err)
+	}
+	return ref.Context().Digest(digest).String(), nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crane_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestRebase(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldRef := fmt.Sprintf("%s/test/base:old", u.Host)
+	newRef := fmt.Sprintf("%s/test/base:new", u.Host)
+	origRef := fmt.Sprintf("%s/test/app:orig", u.Host)
+	rebasedRef := fmt.Sprintf("%s/test/app:rebased", u.Host)
+
+	oldBase, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newBase, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ref, img := range map[string]v1.Image{oldRef: oldBase, newRef: newBase} {
+		if err := crane.Push(img, ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	layer, err := random.Layer(1024, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, err := mutate.AppendLayers(oldBase, layer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crane.Push(orig, origRef); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without annotations, the old base can't be inferred.
+	if _, err := crane.Rebase(origRef, "", newRef, rebasedRef); err == nil {
+		t.Error("Rebase() without old base or annotations: expected error")
+	}
+
+	oldDigest, err := oldBase.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	annotated := mutate.Annotations(orig, map[string]string{
+		"org.opencontainers.image.base.name":   oldRef,
+		"org.opencontainers.image.base.digest": oldDigest.String(),
+	})
+	if err := crane.Push(annotated, origRef); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := crane.Rebase(origRef, "", newRef, rebasedRef)
+	if err != nil {
+		t.Fatalf("Rebase() = %v", err)
+	}
+	rebased, err := crane.Pull(d.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := rebased.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(layers), 4; got != want {
+		t.Errorf("len(layers) = %d, want %d", got, want)
+	}
+	m, err := rebased.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newDigest, err := newBase.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Annotations["org.opencontainers.image.base.digest"], newDigest.String(); got != want {
+		t.Errorf("base digest annotation = %q, want %q", got, want)
+	}
+
+	// The annotations of the rebased image allow rebasing it back.
+	if _, err := crane.Rebase(d.String(), "", oldRef, rebasedRef); err != nil {
+		t.Errorf("Rebase() back onto the old base = %v", err)
+	}
+}
@@ -15,6 +15,9 @@
 package legacy
 
 import (
+	"encoding/json"
+	"strings"
+
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 )
 
@@ -31,3 +34,53 @@ type LayerConfigFile struct {
 	Throwaway bool   `json:"throwaway,omitempty"`
 	Comment   string `json:"comment,omitempty"`
 }
+
+// layerOnly are the fields of a LayerConfigFile that don't belong in an image
+// config file.
+var layerOnly = []string{"id", "parent", "parent_id", "layer_id", "Size", "throwaway"}
+
+// LayerHistory returns the history entry of the layer described by lcf, the
+// way Docker records it when converting v1 images.
+func LayerHistory(lcf *LayerConfigFile) v1.History {
+	return v1.History{
+		Author:     lcf.Author,
+		Created:    lcf.Created,
+		CreatedBy:  strings.Join(lcf.ContainerConfig.Cmd, " "),
+		Comment:    lcf.Comment,
+		EmptyLayer: lcf.Throwaway,
+	}
+}
+
+// ImageConfig returns the config file of an image, given the raw
+// LayerConfigFile of its top layer, and the diff_ids and history of all of
+// its layers, the way Docker converts v1 images. The fields that only apply to
+// the layer are removed, and the fields that v1.ConfigFile doesn't know kept.
+func ImageConfig(top []byte, diffIDs []v1.Hash, history []v1.History) ([]byte, error) {
+	config, err := imageConfig(top, diffIDs, history)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(config)
+}
+
+func imageConfig(top []byte, diffIDs []v1.Hash, history []v1.History) (map[string]json.RawMessage, error) {
+	config := map[string]json.RawMessage{}
+	if err := json.Unmarshal(top, &config); err != nil {
+		return nil, err
+	}
+	for _, k := range layerOnly {
+		delete(config, k)
+	}
+
+	rootfs, err := json.Marshal(v1.RootFS{Type: "layers", DiffIDs: diffIDs})
+	if err != nil {
+		return nil, err
+	}
+	config["rootfs"] = rootfs
+	h, err := json.Marshal(history)
+	if err != nil {
+		return nil, err
+	}
+	config["history"] = h
+	return config, nil
+}
@@ -0,0 +1,271 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package legacy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/google/go-containerregistry/internal/gzip"
+	"github.com/google/go-containerregistry/internal/verify"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Schema1 is a Docker image manifest, schema version 1, see:
+// https://docs.docker.com/registry/spec/manifest-v2-1/
+//
+// The signatures of signed manifests are ignored.
+type Schema1 struct {
+	SchemaVersion int64            `json:"schemaVersion"`
+	Name          string           `json:"name,omitempty"`
+	Tag           string           `json:"tag,omitempty"`
+	Architecture  string           `json:"architecture,omitempty"`
+	FSLayers      []FSLayer        `json:"fsLayers"`
+	History       []Schema1History `json:"history"`
+}
+
+// FSLayer is a layer of a Schema1 manifest, by the digest of its blob.
+type FSLayer struct {
+	BlobSum v1.Hash `json:"blobSum"`
+}
+
+// Schema1History is the history of a layer of a Schema1 manifest, as the JSON
+// of its LayerConfigFile.
+type Schema1History struct {
+	V1Compatibility string `json:"v1Compatibility"`
+}
+
+// ImageFromSchema1 converts the schema 1 manifest, signed or not, to a v1.Image
+// with a schema 2 manifest, e.g. to re-push an image that was pushed with an
+// old client. The blobs of the layers are read from blobs, e.g. a
+// remote.BlobStore of the repository the manifest was read from:
+//
+//	desc, err := remote.Get(ref)
+//	blobs, err := remote.Blobs(ref.Context())
+//	img, err := legacy.ImageFromSchema1(desc.Manifest, blobs)
+//	err = remote.Write(ref, img)
+//
+// The config file is reconstructed from the v1Compatibility of the top layer,
+// with the history of all layers. Schema 1 lists layers top-most first, and
+// gives throwaway layers, like those of ENV instructions, an empty blob; these
+// are recorded as empty layers in the history instead.
+//
+// Each layer is read once, to compute its size and diff_id.
+func ImageFromSchema1(manifest []byte, blobs partial.WithBlob) (v1.Image, error) {
+	var m Schema1
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return nil, fmt.Errorf("parsing schema 1 manifest: %v", err)
+	}
+	if m.SchemaVersion != 1 {
+		return nil, fmt.Errorf("unexpected schema version %d, want 1", m.SchemaVersion)
+	}
+	if len(m.FSLayers) == 0 {
+		return nil, errors.New("schema 1 manifest has no layers")
+	}
+	if len(m.FSLayers) != len(m.History) {
+		return nil, fmt.Errorf("schema 1 manifest has %d layers but %d history entries", len(m.FSLayers), len(m.History))
+	}
+
+	img := &schema1Image{layers: map[v1.Hash]*schema1Layer{}}
+	var (
+		history []v1.History
+		diffIDs []v1.Hash
+		descs   []v1.Descriptor
+	)
+	for i := len(m.History) - 1; i >= 0; i-- {
+		var lcf LayerConfigFile
+		if err := json.Unmarshal([]byte(m.History[i].V1Compatibility), &lcf); err != nil {
+			return nil, fmt.Errorf("parsing v1Compatibility of layer %d: %v", i, err)
+		}
+		history = append(history, LayerHistory(&lcf))
+		if lcf.Throwaway {
+			continue
+		}
+
+		h := m.FSLayers[i].BlobSum
+		l, ok := img.layers[h]
+		if !ok {
+			var err error
+			if l, err = newSchema1Layer(blobs, h); err != nil {
+				return nil, fmt.Errorf("reading layer %s: %v", h, err)
+			}
+			img.layers[h] = l
+		}
+		diffIDs = append(diffIDs, l.diffID)
+		descs = append(descs, v1.Descriptor{
+			MediaType: types.DockerLayer,
+			Size:      l.size,
+			Digest:    h,
+		})
+	}
+
+	config, err := schema1Config(m, history, diffIDs)
+	if err != nil {
+		return nil, err
+	}
+	img.config = config
+	cfgHash, cfgSize, err := v1.SHA256(bytes.NewReader(config))
+	if err != nil {
+		return nil, err
+	}
+	img.manifest, err = json.Marshal(&v1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     types.DockerManifestSchema2,
+		Config: v1.Descriptor{
+			MediaType: types.DockerConfigJSON,
+			Size:      cfgSize,
+			Digest:    cfgHash,
+		},
+		Layers: descs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return partial.CompressedToImage(img)
+}
+
+// schema1Config returns the config file of the top layer, with the rootfs and
+// history of the image, see ImageConfig, falling back to the architecture of
+// the manifest.
+func schema1Config(m Schema1, history []v1.History, diffIDs []v1.Hash) ([]byte, error) {
+	config, err := imageConfig([]byte(m.History[0].V1Compatibility), diffIDs, history)
+	if err != nil {
+		return nil, fmt.Errorf("parsing v1Compatibility of top layer: %v", err)
+	}
+	if _, ok := config["architecture"]; !ok && m.Architecture != "" {
+		b, err := json.Marshal(m.Architecture)
+		if err != nil {
+			return nil, err
+		}
+		config["architecture"] = b
+	}
+	return json.Marshal(config)
+}
+
+type schema1Image struct {
+	config   []byte
+	manifest []byte
+	layers   map[v1.Hash]*schema1Layer
+}
+
+var _ partial.CompressedImageCore = (*schema1Image)(nil)
+
+// RawConfigFile implements partial.CompressedImageCore.
+func (i *schema1Image) RawConfigFile() ([]byte, error) {
+	return i.config, nil
+}
+
+// MediaType implements partial.CompressedImageCore.
+func (i *schema1Image) MediaType() (types.MediaType, error) {
+	return types.DockerManifestSchema2, nil
+}
+
+// RawManifest implements partial.CompressedImageCore.
+func (i *schema1Image) RawManifest() ([]byte, error) {
+	return i.manifest, nil
+}
+
+// LayerByDigest implements partial.CompressedImageCore.
+func (i *schema1Image) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	if l, ok := i.layers[h]; ok {
+		return l, nil
+	}
+	return nil, fmt.Errorf("unknown blob %s", h)
+}
+
+type schema1Layer struct {
+	blobs  partial.WithBlob
+	digest v1.Hash
+	diffID v1.Hash
+	size   int64
+}
+
+// newSchema1Layer reads the blob h to compute its size and diff_id.
+func newSchema1Layer(blobs partial.WithBlob, h v1.Hash) (*schema1Layer, error) {
+	rc, err := blobs.Blob(h)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	vrc, err := verify.ReadCloser(rc, verify.SizeUnknown, h)
+	if err != nil {
+		return nil, err
+	}
+	cr := &countingReader{r: vrc}
+	ur, err := gzip.UnzipReadCloser(ioutil.NopCloser(cr))
+	if err != nil {
+		return nil, err
+	}
+	diffID, _, err := v1.SHA256(ur)
+	if err != nil {
+		return nil, err
+	}
+	// Read any trailing data, to count and verify the whole blob.
+	if _, err := io.Copy(ioutil.Discard, cr); err != nil {
+		return nil, err
+	}
+	return &schema1Layer{
+		blobs:  blobs,
+		digest: h,
+		diffID: diffID,
+		size:   cr.n,
+	}, nil
+}
+
+// Digest implements partial.CompressedLayer.
+func (l *schema1Layer) Digest() (v1.Hash, error) {
+	return l.digest, nil
+}
+
+// DiffID implements partial.WithDiffID.
+func (l *schema1Layer) DiffID() (v1.Hash, error) {
+	return l.diffID, nil
+}
+
+// Compressed implements partial.CompressedLayer.
+func (l *schema1Layer) Compressed() (io.ReadCloser, error) {
+	rc, err := l.blobs.Blob(l.digest)
+	if err != nil {
+		return nil, err
+	}
+	return verify.ReadCloser(rc, l.size, l.digest)
+}
+
+// Size implements partial.CompressedLayer.
+func (l *schema1Layer) Size() (int64, error) {
+	return l.size, nil
+}
+
+// MediaType implements partial.CompressedLayer.
+func (l *schema1Layer) MediaType() (types.MediaType, error) {
+	return types.DockerLayer, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,185 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package legacy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+// layerBlobs serves the compressed contents of layers by digest.
+type layerBlobs map[v1.Hash]v1.Layer
+
+func (lb layerBlobs) Blob(h v1.Hash) (io.ReadCloser, error) {
+	l, ok := lb[h]
+	if !ok {
+		return nil, fmt.Errorf("blob %s not found", h)
+	}
+	return l.Compressed()
+}
+
+func TestImageFromSchema1(t *testing.T) {
+	blobs := layerBlobs{}
+	var layers []v1.Layer
+	for i := 0; i < 2; i++ {
+		l, err := random.Layer(1024, types.DockerLayer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		blobs[d] = l
+		layers = append(layers, l)
+	}
+	digest := func(l v1.Layer) v1.Hash {
+		d, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	// Throwaway layers have an empty blob, which we don't need to read.
+	emptyBlob := v1.Hash{Algorithm: "sha256", Hex: "a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4"}
+
+	// Top-most layer first.
+	m := Schema1{
+		SchemaVersion: 1,
+		Name:          "test/schema1",
+		Tag:           "latest",
+		Architecture:  "amd64",
+		FSLayers: []FSLayer{
+			{BlobSum: digest(layers[1])},
+			{BlobSum: emptyBlob},
+			{BlobSum: digest(layers[0])},
+		},
+		History: []Schema1History{
+			{V1Compatibility: `{"id":"c","parent":"b","os":"linux","created":"2021-01-03T00:00:00Z","config":{"Env":["A=b"],"Cmd":["sh"]},"container_config":{"Cmd":["/bin/sh","-c","#(nop) ADD file:top in /"]},"docker_version":"1.13.1"}`},
+			{V1Compatibility: `{"id":"b","parent":"a","created":"2021-01-02T00:00:00Z","container_config":{"Cmd":["/bin/sh","-c","#(nop) ENV A=b"]},"throwaway":true}`},
+			{V1Compatibility: `{"id":"a","created":"2021-01-01T00:00:00Z","container_config":{"Cmd":["/bin/sh","-c","#(nop) ADD file:base in /"]}}`},
+		},
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := ImageFromSchema1(b, blobs)
+	if err != nil {
+		t.Fatalf("ImageFromSchema1() = %v", err)
+	}
+	if err := validate.Image(img); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+
+	if mt, err := img.MediaType(); err != nil {
+		t.Fatal(err)
+	} else if mt != types.DockerManifestSchema2 {
+		t.Errorf("MediaType() = %s, want %s", mt, types.DockerManifestSchema2)
+	}
+
+	got, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("len(Layers()) = %d, want 2", len(got))
+	}
+	var wantDiffIDs []v1.Hash
+	for i, l := range layers {
+		if digest(got[i]) != digest(l) {
+			t.Errorf("Layers()[%d] = %s, want %s", i, digest(got[i]), digest(l))
+		}
+		diffID, err := l.DiffID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantDiffIDs = append(wantDiffIDs, diffID)
+	}
+
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(wantDiffIDs, cf.RootFS.DiffIDs); diff != "" {
+		t.Errorf("DiffIDs (-want +got) = %s", diff)
+	}
+	if cf.OS != "linux" || cf.Architecture != "amd64" {
+		t.Errorf("platform = %s/%s, want linux/amd64", cf.OS, cf.Architecture)
+	}
+	if diff := cmp.Diff([]string{"A=b"}, cf.Config.Env); diff != "" {
+		t.Errorf("Env (-want +got) = %s", diff)
+	}
+	var createdBy []string
+	var empty []bool
+	for _, h := range cf.History {
+		createdBy = append(createdBy, h.CreatedBy)
+		empty = append(empty, h.EmptyLayer)
+	}
+	if diff := cmp.Diff([]string{
+		"/bin/sh -c #(nop) ADD file:base in /",
+		"/bin/sh -c #(nop) ENV A=b",
+		"/bin/sh -c #(nop) ADD file:top in /",
+	}, createdBy); diff != "" {
+		t.Errorf("History CreatedBy (-want +got) = %s", diff)
+	}
+	if diff := cmp.Diff([]bool{false, true, false}, empty); diff != "" {
+		t.Errorf("History EmptyLayer (-want +got) = %s", diff)
+	}
+
+	raw, err := img.RawConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"id", "parent"} {
+		if _, ok := fields[k]; ok {
+			t.Errorf("config has v1Compatibility field %q", k)
+		}
+	}
+	if _, ok := fields["docker_version"]; !ok {
+		t.Error("config lost docker_version")
+	}
+}
+
+func TestImageFromSchema1Errors(t *testing.T) {
+	for _, tc := range []struct {
+		desc, manifest, want string
+	}{
+		{"invalid", "{", "parsing schema 1 manifest"},
+		{"schema 2", `{"schemaVersion":2}`, "unexpected schema version 2"},
+		{"no layers", `{"schemaVersion":1}`, "no layers"},
+		{"mismatch", `{"schemaVersion":1,"fsLayers":[{"blobSum":"sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4"}]}`, "1 layers but 0 history entries"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			if _, err := ImageFromSchema1([]byte(tc.manifest), layerBlobs{}); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("ImageFromSchema1() = %v, want error containing %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -12,7 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package tarball provides facilities for writing v1 docker images
+// Package tarball provides facilities for reading and writing v1 docker images
 // (https://github.com/moby/moby/blob/master/image/spec/v1.md) from/to a tarball
 // on-disk.
 package tarball
@@ -0,0 +1,280 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tarball
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/google/go-containerregistry/internal/tarfile"
+	"github.com/google/go-containerregistry/internal/verify"
+	"github.com/google/go-containerregistry/pkg/legacy"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// ImageFromPath returns a v1.Image from a `docker save` tarball located on
+// path, see Image.
+func ImageFromPath(path string, tag *name.Tag) (v1.Image, error) {
+	return Image(func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}, tag)
+}
+
+// Image returns the image tagged tag from a `docker save` tarball, or its only
+// image if tag is nil.
+//
+// Tarballs with a manifest.json, like those written by Docker 1.10 and later
+// and by Write, are read with tarball.Image. Older tarballs only have the
+// "repositories" file, which maps tags to the ID of their top layer, and a
+// directory for every layer, with its layer.tar and json config, which names
+// its parent. The image is reconstructed from the chain of parents of the top
+// layer, like `docker load` does: the config is that of the top layer, with
+// the history of all layers, and the diff_ids are computed by reading every
+// layer.tar once. Without a "repositories" file, the tarball must hold a
+// single image.
+func Image(opener tarball.Opener, tag *name.Tag) (v1.Image, error) {
+	t, err := scan(opener)
+	if err != nil {
+		return nil, err
+	}
+	if t.hasManifest {
+		return tarball.Image(opener, tag)
+	}
+
+	top, err := t.topLayerID(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk from the top layer down to the base layer.
+	var chain []string
+	seen := map[string]bool{}
+	for id := top; id != ""; {
+		if seen[id] {
+			return nil, fmt.Errorf("layer %s is its own ancestor", id)
+		}
+		seen[id] = true
+		lcf, ok := t.layers[id]
+		if !ok {
+			return nil, fmt.Errorf("layer %s not found in tarball", id)
+		}
+		chain = append(chain, id)
+		id = lcf.Parent
+	}
+
+	img := &v1Image{layers: map[v1.Hash]*v1TarLayer{}}
+	var (
+		history []v1.History
+		diffIDs []v1.Hash
+	)
+	for i := len(chain) - 1; i >= 0; i-- {
+		id := chain[i]
+		lcf := t.layers[id]
+		history = append(history, legacy.LayerHistory(lcf))
+		if lcf.Throwaway {
+			continue
+		}
+		l, err := newV1TarLayer(opener, path.Join(id, "layer.tar"))
+		if err != nil {
+			return nil, fmt.Errorf("reading layer %s: %v", id, err)
+		}
+		img.layers[l.diffID] = l
+		diffIDs = append(diffIDs, l.diffID)
+	}
+
+	img.config, err = legacy.ImageConfig(t.configs[top], diffIDs, history)
+	if err != nil {
+		return nil, fmt.Errorf("parsing config of layer %s: %v", top, err)
+	}
+	return partial.UncompressedToImage(img)
+}
+
+// v1Tarball is the metadata of a `docker save` tarball.
+type v1Tarball struct {
+	hasManifest  bool
+	repositories repositoriesTarDescriptor
+	// configs and layers hold the raw and parsed json of every layer, by ID.
+	configs map[string][]byte
+	layers  map[string]*legacy.LayerConfigFile
+}
+
+// scan reads the metadata of the tarball opened by opener.
+func scan(opener tarball.Opener) (*v1Tarball, error) {
+	f, err := opener()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t := &v1Tarball{
+		configs: map[string][]byte{},
+		layers:  map[string]*legacy.LayerConfigFile{},
+	}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return t, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch p := path.Clean(hdr.Name); {
+		case p == "manifest.json":
+			t.hasManifest = true
+		case p == "repositories":
+			if err := json.NewDecoder(tr).Decode(&t.repositories); err != nil {
+				return nil, fmt.Errorf("parsing repositories: %v", err)
+			}
+		case path.Base(p) == "json" && path.Dir(p) != ".":
+			b, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			var lcf legacy.LayerConfigFile
+			if err := json.Unmarshal(b, &lcf); err != nil {
+				return nil, fmt.Errorf("parsing %s: %v", p, err)
+			}
+			id := path.Dir(p)
+			t.configs[id] = b
+			t.layers[id] = &lcf
+		}
+	}
+}
+
+// topLayerID returns the ID of the top layer of the image tagged tag, or of
+// the only image if tag is nil.
+func (t *v1Tarball) topLayerID(tag *name.Tag) (string, error) {
+	if tag != nil {
+		for repo, tags := range t.repositories {
+			for tagStr, id := range tags {
+				repoTag, err := name.NewTag(repo + ":" + tagStr)
+				if err != nil {
+					return "", err
+				}
+				// Compare the resolved names, since there are several ways to specify the same tag.
+				if repoTag.Name() == tag.Name() {
+					return id, nil
+				}
+			}
+		}
+		return "", fmt.Errorf("tag %s not found in tarball", tag)
+	}
+
+	tops := map[string]bool{}
+	if len(t.repositories) != 0 {
+		for _, tags := range t.repositories {
+			for _, id := range tags {
+				tops[id] = true
+			}
+		}
+	} else {
+		// Without tags, the top layers are those that aren't a parent.
+		for id := range t.layers {
+			tops[id] = true
+		}
+		for _, lcf := range t.layers {
+			delete(tops, lcf.Parent)
+		}
+	}
+	if len(tops) != 1 {
+		return "", errors.New("tarball must contain only a single image to be used with tarball.Image")
+	}
+	var top string
+	for id := range tops {
+		top = id
+	}
+	return top, nil
+}
+
+// v1Image implements partial.UncompressedImageCore.
+type v1Image struct {
+	config []byte
+	layers map[v1.Hash]*v1TarLayer
+}
+
+var _ partial.UncompressedImageCore = (*v1Image)(nil)
+
+// RawConfigFile implements partial.UncompressedImageCore.
+func (i *v1Image) RawConfigFile() ([]byte, error) {
+	return i.config, nil
+}
+
+// MediaType implements partial.UncompressedImageCore.
+func (i *v1Image) MediaType() (types.MediaType, error) {
+	return types.DockerManifestSchema2, nil
+}
+
+// LayerByDiffID implements partial.UncompressedImageCore.
+func (i *v1Image) LayerByDiffID(h v1.Hash) (partial.UncompressedLayer, error) {
+	if l, ok := i.layers[h]; ok {
+		return l, nil
+	}
+	return nil, fmt.Errorf("diff id %q not found", h)
+}
+
+// v1TarLayer implements partial.UncompressedLayer for a layer.tar.
+type v1TarLayer struct {
+	opener   tarball.Opener
+	filePath string
+	diffID   v1.Hash
+}
+
+// newV1TarLayer reads the layer.tar at filePath to compute its diff_id.
+func newV1TarLayer(opener tarball.Opener, filePath string) (*v1TarLayer, error) {
+	rc, err := tarfile.Open(opener, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	diffID, _, err := v1.SHA256(rc)
+	if err != nil {
+		return nil, err
+	}
+	return &v1TarLayer{
+		opener:   opener,
+		filePath: filePath,
+		diffID:   diffID,
+	}, nil
+}
+
+// DiffID implements partial.UncompressedLayer.
+func (l *v1TarLayer) DiffID() (v1.Hash, error) {
+	return l.diffID, nil
+}
+
+// Uncompressed implements partial.UncompressedLayer.
+func (l *v1TarLayer) Uncompressed() (io.ReadCloser, error) {
+	rc, err := tarfile.Open(l.opener, l.filePath)
+	if err != nil {
+		return nil, err
+	}
+	return verify.ReadCloser(rc, verify.SizeUnknown, l.diffID)
+}
+
+// MediaType implements partial.UncompressedLayer.
+func (l *v1TarLayer) MediaType() (types.MediaType, error) {
+	return types.DockerLayer, nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tarball
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/internal/compare"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+// legacyTarball writes the images with MultiWrite, and keeps only the files
+// for which keep returns true, to get tarballs like those written by Docker
+// before 1.10.
+func legacyTarball(t *testing.T, refToImage map[name.Reference]v1.Image, keep func(string) bool) func() (io.ReadCloser, error) {
+	t.Helper()
+	var full bytes.Buffer
+	if err := MultiWrite(refToImage, &full); err != nil {
+		t.Fatalf("MultiWrite() = %v", err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tr := tar.NewReader(&full)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !keep(hdr.Name) {
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	}
+}
+
+// layerDirs keeps only the layer directories and the repositories file.
+func layerDirs(p string) bool {
+	return p == "repositories" || path.Dir(p) != "."
+}
+
+func mustTag(t *testing.T, s string) name.Tag {
+	t.Helper()
+	tag, err := name.NewTag(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tag
+}
+
+func TestImageLegacy(t *testing.T) {
+	base, err := random.Image(256, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := base.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf = cf.DeepCopy()
+	cf.Config.Env = []string{"FOO=bar"}
+	cf.Config.Cmd = []string{"/bin/sh"}
+	cf.OS = "linux"
+	cf.Architecture = "amd64"
+	cf.History = []v1.History{{CreatedBy: "ADD a"}, {CreatedBy: "ADD b"}, {CreatedBy: "ADD c"}}
+	img, err := mutate.ConfigFile(base, cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag := mustTag(t, "gcr.io/foo/bar:latest")
+	otherTag := mustTag(t, "gcr.io/foo/other:latest")
+	opener := legacyTarball(t, map[name.Reference]v1.Image{tag: img, otherTag: other}, layerDirs)
+
+	got, err := Image(opener, &tag)
+	if err != nil {
+		t.Fatalf("Image() = %v", err)
+	}
+	if err := validate.Image(got); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+	gotCf, err := got.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(cf.RootFS, gotCf.RootFS); diff != "" {
+		t.Errorf("RootFS (-want +got) = %s", diff)
+	}
+	if diff := cmp.Diff(cf.Config, gotCf.Config); diff != "" {
+		t.Errorf("Config (-want +got) = %s", diff)
+	}
+	if gotCf.OS != cf.OS || gotCf.Architecture != cf.Architecture {
+		t.Errorf("platform = %s/%s, want %s/%s", gotCf.OS, gotCf.Architecture, cf.OS, cf.Architecture)
+	}
+	var createdBy []string
+	for _, h := range gotCf.History {
+		createdBy = append(createdBy, h.CreatedBy)
+	}
+	if diff := cmp.Diff([]string{"ADD a", "ADD b", "ADD c"}, createdBy); diff != "" {
+		t.Errorf("History (-want +got) = %s", diff)
+	}
+
+	// There are two images, so a tag is needed.
+	if _, err := Image(opener, nil); err == nil {
+		t.Error("Image(nil) = nil, wanted error with two images")
+	}
+	missing := mustTag(t, "gcr.io/foo/missing:latest")
+	if _, err := Image(opener, &missing); err == nil {
+		t.Errorf("Image(%s) = nil, wanted error", missing)
+	}
+}
+
+func TestImageLegacyNoRepositories(t *testing.T) {
+	img, err := random.Image(256, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := mustTag(t, "gcr.io/foo/bar:latest")
+	opener := legacyTarball(t, map[name.Reference]v1.Image{tag: img}, func(p string) bool {
+		return path.Dir(p) != "."
+	})
+
+	got, err := Image(opener, nil)
+	if err != nil {
+		t.Fatalf("Image() = %v", err)
+	}
+	if err := validate.Image(got); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+	if _, err := Image(opener, &tag); err == nil {
+		t.Errorf("Image(%s) = nil, wanted error without repositories", tag)
+	}
+}
+
+func TestImageManifest(t *testing.T) {
+	img, err := random.Image(256, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := mustTag(t, "gcr.io/foo/bar:latest")
+	opener := legacyTarball(t, map[name.Reference]v1.Image{tag: img}, func(string) bool { return true })
+
+	got, err := Image(opener, &tag)
+	if err != nil {
+		t.Fatalf("Image() = %v", err)
+	}
+	if err := compare.Images(img, got); err != nil {
+		t.Errorf("compare.Images() = %v", err)
+	}
+}
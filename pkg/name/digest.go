@@ -94,3 +94,73 @@ func NewDigest(name string, opts ...Option) (Digest, error) {
 		original:   name,
 	}, nil
 }
+
+// digestHexLengths are the number of hex characters in the digests of the
+// supported algorithms, which are those of v1.Hasher. They are repeated here
+// so that this package doesn't depend on pkg/v1.
+var digestHexLengths = map[string]int{
+	"sha256": 64,
+	"sha512": 128,
+}
+
+// IsDigest reports whether s is a bare digest, i.e. a supported algorithm
+// (see v1.Hasher) followed by as many lowercase hex characters as its hashes
+// have, without a repository.
+func IsDigest(s string) bool {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return false
+	}
+	n, ok := digestHexLengths[parts[0]]
+	if !ok || len(parts[1]) != n {
+		return false
+	}
+	return strings.Trim(parts[1], "0123456789abcdef") == ""
+}
+
+// BareDigest stores a digest that isn't qualified by a repository yet.
+type BareDigest struct {
+	digest string
+}
+
+// NewBareDigest returns a new BareDigest representing the given digest, e.g.
+// "sha256:deadb33f...".
+func NewBareDigest(digest string) (BareDigest, error) {
+	if !IsDigest(digest) {
+		return BareDigest{}, NewErrBadName("a bare digest must have the form <algorithm>:<hex>, e.g. sha256:<64 hex characters>, saw: %s", digest)
+	}
+	return BareDigest{digest: digest}, nil
+}
+
+// DigestStr returns the digest.
+func (d BareDigest) DigestStr() string {
+	return d.digest
+}
+
+func (d BareDigest) String() string {
+	return d.digest
+}
+
+// In returns a Digest of d in the given Repository.
+func (d BareDigest) In(repo Repository) Digest {
+	return repo.Digest(d.digest)
+}
+
+// SplitDigest splits a reference of the form repository@digest into the
+// repository and the digest, which it validates like IsDigest. The registry
+// of the repository may have a port, and the repository may have a tag, which
+// are returned as part of base, e.g. "localhost:5000/foo/bar:v1".
+func SplitDigest(s string) (base string, digest string, err error) {
+	i := strings.LastIndex(s, digestDelim)
+	if i < 0 {
+		return "", "", NewErrBadName("a digest reference must contain an '@' separator (e.g. registry/repository@digest) saw: %s", s)
+	}
+	base, digest = s[:i], s[i+1:]
+	if base == "" || strings.Contains(base, digestDelim) {
+		return "", "", NewErrBadName("a digest reference must contain exactly one repository before the '@' separator, saw: %s", s)
+	}
+	if !IsDigest(digest) {
+		return "", "", NewErrBadName("a digest must have the form <algorithm>:<hex>, e.g. sha256:<64 hex characters>, saw: %s", digest)
+	}
+	return base, digest, nil
+}
@@ -146,3 +146,86 @@ func TestDigestScopes(t *testing.T) {
 		t.Errorf("scope was incorrect for %v. Wanted: `%s` Got: `%s`", digest, expectedScope, actualScope)
 	}
 }
+
+func TestIsDigest(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  bool
+	}{
+		{validDigest, true},
+		{"sha512:" + strings.Repeat("a", 128), true},
+		{"sha512:" + strings.Repeat("a", 64), false},
+		{"sha256:d34db33fd34db33f", false},
+		{"sha256:" + strings.Repeat("D", 64), false},
+		{"unknown:" + strings.Repeat("a", 64), false},
+		{strings.Repeat("a", 64), false},
+		{"ubuntu@" + validDigest, false},
+		{"", false},
+	} {
+		if got := IsDigest(tc.input); got != tc.want {
+			t.Errorf("IsDigest(%q) = %t, want %t", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestNewBareDigest(t *testing.T) {
+	d, err := NewBareDigest(validDigest)
+	if err != nil {
+		t.Fatalf("NewBareDigest() = %v", err)
+	}
+	if d.DigestStr() != validDigest || d.String() != validDigest {
+		t.Errorf("NewBareDigest() = %v, want %s", d, validDigest)
+	}
+
+	repo, err := NewRepository("localhost:5000/foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "localhost:5000/foo/bar@" + validDigest
+	if got := d.In(repo); got.Name() != want {
+		t.Errorf("In() = %s, want %s", got.Name(), want)
+	}
+	if _, err := NewDigest(d.In(repo).String()); err != nil {
+		t.Errorf("NewDigest(In()) = %v", err)
+	}
+
+	for _, bad := range append([]string{"", "ubuntu@" + validDigest}, badDigestNames...) {
+		if _, err := NewBareDigest(bad); err == nil {
+			t.Errorf("NewBareDigest(%q) = nil, want error", bad)
+		}
+	}
+}
+
+func TestSplitDigest(t *testing.T) {
+	for _, base := range []string{
+		"ubuntu",
+		"gcr.io/project-id/sub-repo",
+		"localhost:5000/foo/bar",
+		"example.text:8443/foo/bar:latest",
+		"[::1]:5000/foo",
+	} {
+		gotBase, gotDigest, err := SplitDigest(base + "@" + validDigest)
+		if err != nil {
+			t.Errorf("SplitDigest(%q) = %v", base, err)
+			continue
+		}
+		if gotBase != base || gotDigest != validDigest {
+			t.Errorf("SplitDigest(%q) = %q, %q, want %q, %q", base, gotBase, gotDigest, base, validDigest)
+		}
+	}
+
+	sha512 := "sha512:" + strings.Repeat("a", 128)
+	if _, got, err := SplitDigest("ubuntu@" + sha512); err != nil || got != sha512 {
+		t.Errorf("SplitDigest(sha512) = %q, %v, want %q", got, err, sha512)
+	}
+
+	for _, bad := range append([]string{
+		validDigest,
+		"@" + validDigest,
+		"foo@bar@" + validDigest,
+	}, badDigestNames...) {
+		if _, _, err := SplitDigest(bad); err == nil {
+			t.Errorf("SplitDigest(%q) = nil, want error", bad)
+		}
+	}
+}
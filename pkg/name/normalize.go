@@ -0,0 +1,84 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package name
+
+import (
+	"strings"
+)
+
+type normalizeOptions struct {
+	defaultTag bool
+}
+
+// NormalizeOption is a functional option for Normalize.
+type NormalizeOption func(*normalizeOptions)
+
+// IncludeDefaultTag is a NormalizeOption that includes the tag of references
+// that didn't specify one, e.g. "ubuntu" normalizes to
+// "index.docker.io/library/ubuntu:latest" instead of
+// "index.docker.io/library/ubuntu".
+func IncludeDefaultTag(opts *normalizeOptions) {
+	opts.defaultTag = true
+}
+
+// Normalize returns the fully-qualified form of ref, i.e.
+// registry/repository:tag or registry/repository@digest, so that equivalent
+// references normalize to the same string.
+//
+// The registry host is lowercased and "docker.io" is spelled as
+// DefaultRegistry. The "library/" namespace is only added for repositories on
+// DefaultRegistry, never for other registries, such as one set with
+// WithDefaultRegistry. A digest takes precedence over a tag.
+//
+// A bare digest, e.g. "sha256:deadb33f...", which ParseReference reads as a
+// tag of a repository named "sha256", is returned as is, see IsDigest.
+func Normalize(ref Reference, opts ...NormalizeOption) string {
+	o := normalizeOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if t, ok := ref.(Tag); ok && IsDigest(t.original) {
+		return t.original
+	}
+
+	repo := ref.Context()
+	reg := Registry{
+		registry: normalizeRegistry(repo.RegistryStr()),
+		insecure: repo.insecure,
+	}
+	s := Repository{Registry: reg, repository: repo.repository}.Name()
+
+	switch r := ref.(type) {
+	case Digest:
+		return s + digestDelim + r.DigestStr()
+	case Tag:
+		if r.implicit && !o.defaultTag {
+			return s
+		}
+		return s + tagDelim + r.TagStr()
+	}
+	return s
+}
+
+// normalizeRegistry lowercases the host of registry, which is
+// case-insensitive, and resolves the Docker Hub alias.
+func normalizeRegistry(registry string) string {
+	registry = strings.ToLower(registry)
+	if registry == defaultRegistryAlias {
+		return DefaultRegistry
+	}
+	return registry
+}
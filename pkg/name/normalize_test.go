@@ -0,0 +1,94 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package name
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	for _, tc := range []struct {
+		input          string
+		opts           []Option
+		want           string
+		wantDefaultTag string
+	}{{
+		input:          "ubuntu",
+		want:           "index.docker.io/library/ubuntu",
+		wantDefaultTag: "index.docker.io/library/ubuntu:latest",
+	}, {
+		input: "docker.io/library/ubuntu:18.04",
+		want:  "index.docker.io/library/ubuntu:18.04",
+	}, {
+		input: "Docker.IO/ubuntu:latest",
+		want:  "index.docker.io/library/ubuntu:latest",
+	}, {
+		input:          "GCR.io/foo/bar",
+		want:           "gcr.io/foo/bar",
+		wantDefaultTag: "gcr.io/foo/bar:latest",
+	}, {
+		input: "LOCALHOST:5000/foo:v1",
+		want:  "localhost:5000/foo:v1",
+	}, {
+		input: "ubuntu@" + validDigest,
+		want:  "index.docker.io/library/ubuntu@" + validDigest,
+	}, {
+		// Bare digests have no repository to qualify.
+		input: validDigest,
+		want:  validDigest,
+	}, {
+		input: "localhost:5000/foo:v1@" + validDigest,
+		want:  "localhost:5000/foo@" + validDigest,
+	}, {
+		// No library/ for other default registries.
+		input:          "ubuntu",
+		opts:           []Option{WithDefaultRegistry("registry.example.com"), WithDefaultTag("stable")},
+		want:           "registry.example.com/ubuntu",
+		wantDefaultTag: "registry.example.com/ubuntu:stable",
+	}} {
+		ref, err := ParseReference(tc.input, tc.opts...)
+		if err != nil {
+			t.Fatalf("ParseReference(%q) = %v", tc.input, err)
+		}
+		if got := Normalize(ref); got != tc.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+		wantDefaultTag := tc.wantDefaultTag
+		if wantDefaultTag == "" {
+			wantDefaultTag = tc.want
+		}
+		if got := Normalize(ref, IncludeDefaultTag); got != wantDefaultTag {
+			t.Errorf("Normalize(%q, IncludeDefaultTag) = %q, want %q", tc.input, got, wantDefaultTag)
+		}
+
+		// Normalizing is idempotent.
+		normalized, err := ParseReference(Normalize(ref))
+		if err != nil {
+			t.Fatalf("ParseReference(%q) = %v", Normalize(ref), err)
+		}
+		if got := Normalize(normalized); got != tc.want {
+			t.Errorf("Normalize(Normalize(%q)) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+
+	// References constructed from a Repository have an explicit tag.
+	repo, err := NewRepository("gcr.io/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Normalize(repo.Tag("latest")), "gcr.io/foo:latest"; got != want {
+		t.Errorf("Normalize(Tag()) = %q, want %q", got, want)
+	}
+}
@@ -16,6 +16,7 @@ package name
 
 import (
 	"fmt"
+	"strings"
 )
 
 // Reference defines the interface that consumers use when they can
@@ -74,3 +75,25 @@ func MustParseReference(s stringConst, opts ...Option) Reference {
 	}
 	return ref
 }
+
+// Rewrite returns ref with its registry replaced by reg, keeping its
+// repository and its tag or digest, e.g. to refer to the copy of an image on a
+// mirror. The "library/" namespace of repositories on DefaultRegistry is kept,
+// so "ubuntu" on a mirror is "mirror.example.com/library/ubuntu".
+func Rewrite(ref Reference, reg Registry) Reference {
+	repo := Repository{Registry: reg, repository: ref.Context().RepositoryStr()}
+	switch r := ref.(type) {
+	case Tag:
+		t := repo.Tag(r.TagStr())
+		t.implicit = r.implicit
+		return t
+	case Digest:
+		return repo.Digest(r.DigestStr())
+	}
+	// Some other implementation of Reference. Unlike tags, digests contain a
+	// colon.
+	if strings.Contains(ref.Identifier(), ":") {
+		return repo.Digest(ref.Identifier())
+	}
+	return repo.Tag(ref.Identifier())
+}
@@ -152,6 +152,48 @@ func TestMustParseReference(t *testing.T) {
 	}
 }
 
+func TestRewrite(t *testing.T) {
+	mirror, err := NewRegistry("mirror.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		input string
+		want  string
+	}{
+		{"gcr.io/foo/bar:v1", "mirror.example.com/foo/bar:v1"},
+		{"gcr.io/foo/bar@" + validDigest, "mirror.example.com/foo/bar@" + validDigest},
+		{"ubuntu", "mirror.example.com/library/ubuntu:latest"},
+		{"localhost:5000/foo", "mirror.example.com/foo:latest"},
+	} {
+		ref, err := ParseReference(tc.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := Rewrite(ref, mirror)
+		if got.Name() != tc.want {
+			t.Errorf("Rewrite(%q) = %q, want %q", tc.input, got.Name(), tc.want)
+		}
+		if got.Identifier() != ref.Identifier() {
+			t.Errorf("Rewrite(%q).Identifier() = %q, want %q", tc.input, got.Identifier(), ref.Identifier())
+		}
+		if reparsed, err := ParseReference(got.String()); err != nil {
+			t.Errorf("ParseReference(%q) = %v", got, err)
+		} else if reparsed.Name() != got.Name() {
+			t.Errorf("ParseReference(%q) = %q", got, reparsed.Name())
+		}
+	}
+
+	// An implicit tag stays implicit.
+	ref, err := ParseReference("gcr.io/foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Normalize(Rewrite(ref, mirror)), "mirror.example.com/foo/bar"; got != want {
+		t.Errorf("Normalize(Rewrite()) = %q, want %q", got, want)
+	}
+}
+
 // Test that MustParseReference can accept a const string or string value.
 const str = "valid/string"
 
@@ -29,6 +29,9 @@ type Tag struct {
 	Repository
 	tag      string
 	original string
+
+	// implicit is set if tag was defaulted rather than given.
+	implicit bool
 }
 
 // Ensure Tag implements Reference
@@ -92,7 +95,8 @@ func NewTag(name string, opts ...Option) (Tag, error) {
 		}
 	}
 
-	if tag == "" {
+	implicit := tag == ""
+	if implicit {
 		tag = opt.defaultTag
 	}
 
@@ -104,5 +108,6 @@ func NewTag(name string, opts ...Option) (Tag, error) {
 		Repository: repo,
 		tag:        tag,
 		original:   name,
+		implicit:   implicit,
 	}, nil
 }
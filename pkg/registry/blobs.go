@@ -90,6 +90,27 @@ func (b *blobs) handle(resp http.ResponseWriter, req *http.Request) *regError {
 		return nil
 	}
 
+	if req.Method == "GET" && service == "uploads" {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		l, ok := b.uploads[target]
+		if !ok {
+			return &regError{
+				Status:  http.StatusNotFound,
+				Code:    "BLOB_UPLOAD_UNKNOWN",
+				Message: "Unknown upload",
+			}
+		}
+
+		resp.Header().Set("Location", "/"+path.Join("v2", path.Join(elem[1:len(elem)-3]...), "blobs/uploads", target))
+		// The range is inclusive, so there is none while nothing has been received.
+		if len(l) > 0 {
+			resp.Header().Set("Range", fmt.Sprintf("0-%d", len(l)-1))
+		}
+		resp.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
 	if req.Method == "GET" {
 		b.lock.Lock()
 		defer b.lock.Unlock()
@@ -132,8 +153,11 @@ func (b *blobs) handle(resp http.ResponseWriter, req *http.Request) *regError {
 
 	if req.Method == "POST" && target == "uploads" && digest == "" {
 		id := fmt.Sprint(rand.Int63())
+		b.lock.Lock()
+		b.uploads[id] = []byte{}
+		b.lock.Unlock()
 		resp.Header().Set("Location", "/"+path.Join("v2", path.Join(elem[1:len(elem)-2]...), "blobs/uploads", id))
-		resp.Header().Set("Range", "0-0")
+		resp.Header().Set("OCI-Chunk-Min-Length", "1")
 		resp.WriteHeader(http.StatusAccepted)
 		return nil
 	}
@@ -168,7 +192,7 @@ func (b *blobs) handle(resp http.ResponseWriter, req *http.Request) *regError {
 	if req.Method == "PATCH" && service == "uploads" && contentRange == "" {
 		b.lock.Lock()
 		defer b.lock.Unlock()
-		if _, ok := b.uploads[target]; ok {
+		if len(b.uploads[target]) > 0 {
 			return &regError{
 				Status:  http.StatusBadRequest,
 				Code:    "BLOB_UPLOAD_INVALID",
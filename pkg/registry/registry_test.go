@@ -145,14 +145,14 @@ func TestCalls(t *testing.T) {
 			Method:      "POST",
 			URL:         "/v2/foo/blobs/uploads",
 			Code:        http.StatusAccepted,
-			Header:      map[string]string{"Range": "0-0"},
+			Header:      map[string]string{"Range": "", "OCI-Chunk-Min-Length": "1"},
 		},
 		{
 			Description: "uploadurl",
 			Method:      "POST",
 			URL:         "/v2/foo/blobs/uploads/",
 			Code:        http.StatusAccepted,
-			Header:      map[string]string{"Range": "0-0"},
+			Header:      map[string]string{"Range": "", "OCI-Chunk-Min-Length": "1"},
 		},
 		{
 			Description: "upload put missing digest",
@@ -217,6 +217,34 @@ func TestCalls(t *testing.T) {
 			Code:        http.StatusCreated,
 			Header:      map[string]string{"Docker-Content-Digest": "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"},
 		},
+		{
+			Description: "upload status",
+			Method:      "GET",
+			URL:         "/v2/foo/blobs/uploads/1",
+			BlobStream:  map[string]string{"1": "foo"},
+			Code:        http.StatusNoContent,
+			Header: map[string]string{
+				"Range":    "0-2",
+				"Location": "/v2/foo/blobs/uploads/1",
+			},
+		},
+		{
+			Description: "upload status with nothing received",
+			Method:      "GET",
+			URL:         "/v2/foo/blobs/uploads/1",
+			BlobStream:  map[string]string{"1": ""},
+			Code:        http.StatusNoContent,
+			Header: map[string]string{
+				"Range":    "",
+				"Location": "/v2/foo/blobs/uploads/1",
+			},
+		},
+		{
+			Description: "upload status unknown upload",
+			Method:      "GET",
+			URL:         "/v2/foo/blobs/uploads/1",
+			Code:        http.StatusNotFound,
+		},
 		{
 			Description: "get missing manifest",
 			Method:      "GET",
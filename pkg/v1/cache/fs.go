@@ -3,9 +3,11 @@ package cache
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
@@ -13,14 +15,35 @@ import (
 
 type fscache struct {
 	path string
+
+	// verified records the blobs whose contents have been checked against
+	// their hash, so that each is only read in full once.
+	mu       sync.Mutex
+	verified map[v1.Hash]bool
 }
 
 // NewFilesystemCache returns a Cache implementation backed by files.
 func NewFilesystemCache(path string) Cache {
-	return &fscache{path}
+	return &fscache{
+		path:     path,
+		verified: map[v1.Hash]bool{},
+	}
 }
 
 func (fs *fscache) Put(l v1.Layer) (v1.Layer, error) {
+	return put(fs.path, l, func(h v1.Hash, tmp string, _ int64) error {
+		// The new contents haven't been verified yet.
+		fs.mu.Lock()
+		delete(fs.verified, h)
+		fs.mu.Unlock()
+		return os.Rename(tmp, cachepath(fs.path, h))
+	})
+}
+
+// put returns a layer that writes its contents to the cache directory as it
+// is consumed. Once a blob has been written completely, commit is called to
+// move the temporary file at tmp into place.
+func put(path string, l v1.Layer, commit func(h v1.Hash, tmp string, size int64) error) (v1.Layer, error) {
 	digest, err := l.Digest()
 	if err != nil {
 		return nil, err
@@ -31,9 +54,10 @@ func (fs *fscache) Put(l v1.Layer) (v1.Layer, error) {
 	}
 	return &layer{
 		Layer:  l,
-		path:   fs.path,
+		path:   path,
 		digest: digest,
 		diffID: diffID,
+		commit: commit,
 	}, nil
 }
 
@@ -41,69 +65,93 @@ type layer struct {
 	v1.Layer
 	path           string
 	digest, diffID v1.Hash
-}
-
-func (l *layer) create(h v1.Hash) (io.WriteCloser, error) {
-	if err := os.MkdirAll(l.path, 0700); err != nil {
-		return nil, err
-	}
-	return os.Create(cachepath(l.path, h))
+	commit         func(h v1.Hash, tmp string, size int64) error
 }
 
 func (l *layer) Compressed() (io.ReadCloser, error) {
-	f, err := l.create(l.digest)
-	if err != nil {
-		return nil, err
-	}
-	rc, err := l.Layer.Compressed()
-	if err != nil {
-		return nil, err
-	}
-	return &readcloser{
-		t:      io.TeeReader(rc, f),
-		closes: []func() error{rc.Close, f.Close},
-	}, nil
+	return l.tee(l.digest, l.Layer.Compressed)
 }
 
 func (l *layer) Uncompressed() (io.ReadCloser, error) {
-	f, err := l.create(l.diffID)
+	return l.tee(l.diffID, l.Layer.Uncompressed)
+}
+
+// tee writes the contents returned by open to a temporary file as they are
+// read, which is committed to the cache as h once everything has been read.
+func (l *layer) tee(h v1.Hash, open func() (io.ReadCloser, error)) (io.ReadCloser, error) {
+	if err := os.MkdirAll(l.path, 0700); err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile(l.path, tmpPrefix)
 	if err != nil {
 		return nil, err
 	}
-	rc, err := l.Layer.Uncompressed()
+	rc, err := open()
 	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
 		return nil, err
 	}
 	return &readcloser{
-		t:      io.TeeReader(rc, f),
-		closes: []func() error{rc.Close, f.Close},
+		t:  io.TeeReader(rc, f),
+		rc: rc,
+		f:  f,
+		commit: func(size int64) error {
+			return l.commit(h, f.Name(), size)
+		},
 	}, nil
 }
 
+// Temporary files are prefixed with a dot, so they can't be confused with
+// cached blobs.
+const tmpPrefix = ".tmp-"
+
 type readcloser struct {
 	t      io.Reader
-	closes []func() error
+	rc     io.ReadCloser
+	f      *os.File
+	commit func(size int64) error
+
+	// size is the number of bytes read so far, and done is set once we've
+	// read everything.
+	size int64
+	done bool
 }
 
 func (rc *readcloser) Read(b []byte) (int, error) {
-	return rc.t.Read(b)
+	n, err := rc.t.Read(b)
+	rc.size += int64(n)
+	if err == io.EOF {
+		rc.done = true
+	}
+	return n, err
 }
 
 func (rc *readcloser) Close() error {
 	// Call all Close methods, even if any returned an error. Return the
 	// first returned error.
-	var err error
-	for _, c := range rc.closes {
-		lastErr := c()
-		if err == nil {
-			err = lastErr
-		}
+	err := rc.rc.Close()
+	if ferr := rc.f.Close(); err == nil {
+		err = ferr
+	}
+
+	// Don't leave partially written blobs in the cache.
+	if err == nil && rc.done {
+		err = rc.commit(rc.size)
+	}
+	if err != nil || !rc.done {
+		os.Remove(rc.f.Name())
 	}
 	return err
 }
 
 func (fs *fscache) Get(h v1.Hash) (v1.Layer, error) {
-	l, err := tarball.LayerFromFile(cachepath(fs.path, h))
+	p := cachepath(fs.path, h)
+	if err := fs.verify(p, h); err != nil {
+		return nil, err
+	}
+
+	l, err := tarball.LayerFromFile(p)
 	if os.IsNotExist(err) {
 		return nil, ErrNotFound
 	}
@@ -117,7 +165,49 @@ func (fs *fscache) Get(h v1.Hash) (v1.Layer, error) {
 	return l, err
 }
 
+// verify checks the file at p against h the first time it is read, and
+// deletes it if it was corrupted.
+func (fs *fscache) verify(p string, h v1.Hash) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.verified[h] {
+		return nil
+	}
+	ok, err := verifyFile(p, h)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	if !ok {
+		// Delete and return ErrNotFound because the layer was corrupted.
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return ErrNotFound
+	}
+	fs.verified[h] = true
+	return nil
+}
+
+// verifyFile reports whether the contents of the file at p hash to h.
+func verifyFile(p string, h v1.Hash) (bool, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	got, _, err := v1.Compute(h.Algorithm, f)
+	if err != nil {
+		return false, err
+	}
+	return got == h, nil
+}
+
 func (fs *fscache) Delete(h v1.Hash) error {
+	fs.mu.Lock()
+	delete(fs.verified, h)
+	fs.mu.Unlock()
 	err := os.Remove(cachepath(fs.path, h))
 	if os.IsNotExist(err) {
 		return ErrNotFound
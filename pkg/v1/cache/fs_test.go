@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"bytes"
 	"io"
 	"io/ioutil"
 	"os"
@@ -197,3 +198,119 @@ func TestErrUnexpectedEOF(t *testing.T) {
 		t.Errorf("os.Stat(%q): %v", p, err)
 	}
 }
+
+func TestPartialRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ggcr-cache")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := random.Layer(1000, types.DockerLayer)
+	if err != nil {
+		t.Fatalf("random.Layer: %v", err)
+	}
+	c := NewFilesystemCache(dir)
+	cl, err := c.Put(l)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	rc, err := cl.Compressed()
+	if err != nil {
+		t.Fatalf("Compressed: %v", err)
+	}
+	if _, err := rc.Read(make([]byte, 10)); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// The partially read layer should not be cached.
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if got, want := len(files), 0; got != want {
+		t.Errorf("Got %d cached files, want %d", got, want)
+	}
+}
+
+func TestCorrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ggcr-cache")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir) // Remove the tempdir.
+
+	l, err := random.Layer(10, types.DockerLayer)
+	if err != nil {
+		t.Fatalf("random.Layer: %v", err)
+	}
+	h, err := l.Digest()
+	if err != nil {
+		t.Fatalf("layer.Digest(): %v", err)
+	}
+
+	// Cache a different, valid layer under the digest of l.
+	other, err := random.Layer(10, types.DockerLayer)
+	if err != nil {
+		t.Fatalf("random.Layer: %v", err)
+	}
+	rc, err := other.Compressed()
+	if err != nil {
+		t.Fatalf("layer.Compressed(): %v", err)
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	p := cachepath(dir, h)
+	if err := ioutil.WriteFile(p, b, 0644); err != nil {
+		t.Fatalf("ioutil.WriteFile(%s): %v", p, err)
+	}
+
+	c := NewFilesystemCache(dir)
+	if _, err := c.Get(h); err != ErrNotFound {
+		t.Errorf("Get(%q): %v", h, err)
+	}
+
+	// The corrupted layer should have been deleted.
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Errorf("os.Stat(%q): %v", p, err)
+	}
+}
+
+func TestVerifyOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ggcr-cache")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir) // Remove the tempdir.
+
+	content := []byte("blob")
+	for _, algorithm := range []string{"sha256", "sha512"} {
+		h, _, err := v1.Compute(algorithm, bytes.NewReader(content))
+		if err != nil {
+			t.Fatalf("v1.Compute(%s): %v", algorithm, err)
+		}
+		p := cachepath(dir, h)
+		if err := ioutil.WriteFile(p, content, 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile(%s): %v", p, err)
+		}
+
+		c := NewFilesystemCache(dir)
+		if _, err := c.Get(h); err != nil {
+			t.Fatalf("Get(%q): %v", h, err)
+		}
+
+		// Once verified, the contents aren't read again.
+		if err := ioutil.WriteFile(p, []byte("corrupted"), 0644); err != nil {
+			t.Fatalf("ioutil.WriteFile(%s): %v", p, err)
+		}
+		if _, err := c.Get(h); err != nil {
+			t.Errorf("Get(%q): %v", h, err)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// LimitedCache is a Cache that bounds the total size of the blobs it holds.
+type LimitedCache interface {
+	Cache
+
+	// Stats returns the current usage of the cache.
+	Stats() Stats
+}
+
+// Stats describes the usage of a LimitedCache.
+type Stats struct {
+	// Bytes is the total size of the cached blobs.
+	Bytes int64
+
+	// MaxBytes is the limit passed to NewFilesystemWithLimit.
+	MaxBytes int64
+
+	// Blobs is the number of cached blobs.
+	Blobs int
+
+	// Evictions is the number of blobs evicted to stay within MaxBytes.
+	Evictions int64
+}
+
+type lruCache struct {
+	path     string
+	maxBytes int64
+
+	mu        sync.Mutex
+	lru       *list.List // of *lruEntry, least recently used at the back.
+	entries   map[v1.Hash]*list.Element
+	bytes     int64
+	evictions int64
+}
+
+type lruEntry struct {
+	h    v1.Hash
+	size int64
+}
+
+// NewFilesystemWithLimit returns a Cache implementation backed by files, like
+// NewFilesystemCache, that evicts the least recently used blobs when their
+// total size exceeds maxBytes.
+//
+// Blobs that are already in path are accounted for, using their modification
+// times, which Get updates, to determine their order of use.
+func NewFilesystemWithLimit(path string, maxBytes int64) (LimitedCache, error) {
+	if maxBytes <= 0 {
+		return nil, errors.New("maxBytes must be greater than zero")
+	}
+	c := &lruCache{
+		path:     path,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  map[v1.Hash]*list.Element{},
+	}
+
+	fis, err := ioutil.ReadDir(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	sort.Slice(fis, func(i, j int) bool {
+		return fis[i].ModTime().Before(fis[j].ModTime())
+	})
+	for _, fi := range fis {
+		h, err := parseCachepath(fi.Name())
+		if err != nil || !fi.Mode().IsRegular() {
+			// Not a blob, e.g. a temporary file.
+			continue
+		}
+		c.entries[h] = c.lru.PushFront(&lruEntry{h: h, size: fi.Size()})
+		c.bytes += fi.Size()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.evict(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *lruCache) Put(l v1.Layer) (v1.Layer, error) {
+	return put(c.path, l, c.commit)
+}
+
+// commit moves a completely written blob into place, and evicts other blobs
+// until we're within the limit again.
+func (c *lruCache) commit(h v1.Hash, tmp string, size int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.Rename(tmp, cachepath(c.path, h)); err != nil {
+		return err
+	}
+	if el, ok := c.entries[h]; ok {
+		// We've written the same blob concurrently, or again.
+		e := el.Value.(*lruEntry)
+		c.bytes -= e.size
+		e.size = size
+		c.lru.MoveToFront(el)
+	} else {
+		c.entries[h] = c.lru.PushFront(&lruEntry{h: h, size: size})
+	}
+	c.bytes += size
+
+	return c.evict()
+}
+
+// evict removes the least recently used blobs until we're within the limit.
+// A blob that is larger than the limit on its own is evicted, too.
+//
+// c.mu must be held.
+func (c *lruCache) evict() error {
+	for c.bytes > c.maxBytes {
+		el := c.lru.Back()
+		if el == nil {
+			return nil
+		}
+		e := el.Value.(*lruEntry)
+		if err := os.Remove(cachepath(c.path, e.h)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		c.remove(el)
+		c.evictions++
+	}
+	return nil
+}
+
+// remove forgets about the blob in el.
+//
+// c.mu must be held.
+func (c *lruCache) remove(el *list.Element) {
+	e := el.Value.(*lruEntry)
+	c.lru.Remove(el)
+	delete(c.entries, e.h)
+	c.bytes -= e.size
+}
+
+// Get returns the cached layer and marks it as the most recently used.
+//
+// The returned layer holds on to the blob, so it can still be read after it
+// has been evicted, on platforms that allow removing open files. Each reader
+// of the layer gets its own file descriptor, which is closed along with it.
+func (c *lruCache) Get(h v1.Hash) (v1.Layer, error) {
+	f, size, err := c.open(h)
+	if err != nil {
+		return nil, err
+	}
+	l, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		rf, err := reopen(f)
+		if err != nil {
+			return nil, err
+		}
+		return &sectionReadCloser{
+			SectionReader: io.NewSectionReader(rf, 0, size),
+			Closer:        rf,
+		}, nil
+	})
+	if err != nil {
+		f.Close()
+	}
+	if err == io.ErrUnexpectedEOF {
+		// Delete and return ErrNotFound because the layer was incomplete.
+		if err := c.Delete(h); err != nil && err != ErrNotFound {
+			return nil, err
+		}
+		return nil, ErrNotFound
+	}
+	return l, err
+}
+
+// sectionReadCloser reads a section of a file, and closes the file.
+type sectionReadCloser struct {
+	*io.SectionReader
+	io.Closer
+}
+
+func (c *lruCache) open(h v1.Hash) (*os.File, int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[h]
+	if !ok {
+		return nil, 0, ErrNotFound
+	}
+	p := cachepath(c.path, h)
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		// Somebody else removed it.
+		c.remove(el)
+		return nil, 0, ErrNotFound
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	// Record the access, so that the order survives restarts.
+	now := time.Now()
+	if err := os.Chtimes(p, now, now); err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	c.lru.MoveToFront(el)
+	return f, el.Value.(*lruEntry).size, nil
+}
+
+func (c *lruCache) Delete(h v1.Hash) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[h]; ok {
+		c.remove(el)
+	}
+	err := os.Remove(cachepath(c.path, h))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (c *lruCache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Bytes:     c.bytes,
+		MaxBytes:  c.maxBytes,
+		Blobs:     len(c.entries),
+		Evictions: c.evictions,
+	}
+}
+
+// parseCachepath is the inverse of cachepath.
+func parseCachepath(file string) (v1.Hash, error) {
+	if runtime.GOOS == "windows" {
+		file = strings.Replace(file, "-", ":", 1)
+	}
+	return v1.NewHash(file)
+}
@@ -0,0 +1,387 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func mustLayers(t *testing.T, n int) []v1.Layer {
+	t.Helper()
+	var ls []v1.Layer
+	for i := 0; i < n; i++ {
+		l, err := random.Layer(1000, types.DockerLayer)
+		if err != nil {
+			t.Fatalf("random.Layer: %v", err)
+		}
+		ls = append(ls, l)
+	}
+	return ls
+}
+
+func mustSize(t *testing.T, l v1.Layer) int64 {
+	t.Helper()
+	size, err := l.Size()
+	if err != nil {
+		t.Fatalf("Size: %v", err)
+	}
+	return size
+}
+
+// consume puts l in the cache and reads its compressed contents.
+func consume(t *testing.T, c Cache, l v1.Layer) {
+	t.Helper()
+	cl, err := c.Put(l)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	rc, err := cl.Compressed()
+	if err != nil {
+		t.Fatalf("Compressed: %v", err)
+	}
+	if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+		t.Fatalf("Error reading contents: %v", err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func mustDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "ggcr-cache")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func dirFiles(t *testing.T, dir string) []os.FileInfo {
+	t.Helper()
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	return files
+}
+
+func TestFilesystemWithLimit(t *testing.T) {
+	dir := mustDir(t)
+	ls := mustLayers(t, 3)
+
+	// Leave room for two of the layers.
+	max := mustSize(t, ls[0]) + mustSize(t, ls[1]) + mustSize(t, ls[2]) - 1
+	c, err := NewFilesystemWithLimit(dir, max)
+	if err != nil {
+		t.Fatalf("NewFilesystemWithLimit: %v", err)
+	}
+
+	consume(t, c, ls[0])
+	consume(t, c, ls[1])
+
+	// Use the first layer, so that the second one is the oldest.
+	h0, err := ls[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(h0); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	consume(t, c, ls[2])
+
+	h1, err := ls[1].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(h1); err != ErrNotFound {
+		t.Errorf("Get(evicted) = %v, want %v", err, ErrNotFound)
+	}
+	for _, l := range []v1.Layer{ls[0], ls[2]} {
+		h, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Get(h); err != nil {
+			t.Errorf("Get(%s) = %v", h, err)
+		}
+	}
+
+	want := Stats{
+		Bytes:     mustSize(t, ls[0]) + mustSize(t, ls[2]),
+		MaxBytes:  max,
+		Blobs:     2,
+		Evictions: 1,
+	}
+	if got := c.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	if got := len(dirFiles(t, dir)); got != 2 {
+		t.Errorf("Got %d cached files, want 2", got)
+	}
+
+	// A new cache picks up the existing blobs, in order, and shrinks to fit.
+	hour := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(cachepath(dir, h0), hour, hour); err != nil {
+		t.Fatal(err)
+	}
+	c, err = NewFilesystemWithLimit(dir, mustSize(t, ls[2]))
+	if err != nil {
+		t.Fatalf("NewFilesystemWithLimit: %v", err)
+	}
+	if got := c.Stats(); got.Blobs != 1 || got.Bytes != mustSize(t, ls[2]) {
+		t.Errorf("Stats() = %+v, want only the most recently used blob", got)
+	}
+}
+
+func TestFilesystemWithLimitInvalid(t *testing.T) {
+	if _, err := NewFilesystemWithLimit(mustDir(t), 0); err == nil {
+		t.Error("NewFilesystemWithLimit(0) = nil, wanted error")
+	}
+}
+
+// failingLayer fails after returning some of its compressed contents.
+type failingLayer struct {
+	v1.Layer
+}
+
+func (l *failingLayer) Compressed() (io.ReadCloser, error) {
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	return &failingReader{rc: rc}, nil
+}
+
+type failingReader struct {
+	rc   io.ReadCloser
+	read bool
+}
+
+func (r *failingReader) Read(b []byte) (int, error) {
+	if r.read {
+		return 0, errors.New("boom")
+	}
+	r.read = true
+	return r.rc.Read(b[:10])
+}
+
+func (r *failingReader) Close() error { return r.rc.Close() }
+
+func TestFilesystemWithLimitPartial(t *testing.T) {
+	dir := mustDir(t)
+	ls := mustLayers(t, 2)
+	c, err := NewFilesystemWithLimit(dir, 1<<20)
+	if err != nil {
+		t.Fatalf("NewFilesystemWithLimit: %v", err)
+	}
+
+	// Stop reading early.
+	cl, err := c.Put(ls[0])
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	rc, err := cl.Compressed()
+	if err != nil {
+		t.Fatalf("Compressed: %v", err)
+	}
+	if _, err := rc.Read(make([]byte, 10)); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Fail while reading.
+	cl, err = c.Put(&failingLayer{ls[1]})
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	rc, err = cl.Compressed()
+	if err != nil {
+		t.Fatalf("Compressed: %v", err)
+	}
+	if _, err := io.Copy(ioutil.Discard, rc); err == nil {
+		t.Error("Read: wanted error")
+	}
+	rc.Close()
+
+	if files := dirFiles(t, dir); len(files) != 0 {
+		t.Errorf("Got %d cached files, want 0", len(files))
+	}
+	if got := c.Stats(); got.Blobs != 0 || got.Bytes != 0 {
+		t.Errorf("Stats() = %+v, want empty", got)
+	}
+}
+
+func TestFilesystemWithLimitConcurrent(t *testing.T) {
+	dir := mustDir(t)
+	ls := mustLayers(t, 10)
+	max := 3 * mustSize(t, ls[0])
+	c, err := NewFilesystemWithLimit(dir, max)
+	if err != nil {
+		t.Fatalf("NewFilesystemWithLimit: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 3; j++ {
+				for _, l := range ls {
+					h, err := l.Digest()
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					cl, err := c.Get(h)
+					if err == ErrNotFound {
+						if cl, err = c.Put(l); err != nil {
+							t.Error(err)
+							return
+						}
+					} else if err != nil {
+						t.Error(err)
+						return
+					}
+					rc, err := cl.Compressed()
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+						t.Error(err)
+					}
+					if err := rc.Close(); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := c.Stats()
+	if stats.Bytes > max {
+		t.Errorf("Stats().Bytes = %d, want at most %d", stats.Bytes, max)
+	}
+	var total int64
+	for _, fi := range dirFiles(t, dir) {
+		total += fi.Size()
+	}
+	if total != stats.Bytes {
+		t.Errorf("cached files total %d bytes, Stats().Bytes = %d", total, stats.Bytes)
+	}
+}
+
+func TestFilesystemWithLimitEvictedWhileInUse(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("open files can't be removed on windows")
+	}
+	dir := mustDir(t)
+	ls := mustLayers(t, 2)
+	c, err := NewFilesystemWithLimit(dir, mustSize(t, ls[0])+1)
+	if err != nil {
+		t.Fatalf("NewFilesystemWithLimit: %v", err)
+	}
+
+	consume(t, c, ls[0])
+	h, err := ls[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl, err := c.Get(h)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	// Evict the layer we're holding on to.
+	consume(t, c, ls[1])
+	if _, err := c.Get(h); err != ErrNotFound {
+		t.Fatalf("Get(evicted) = %v, want %v", err, ErrNotFound)
+	}
+
+	rc, err := cl.Compressed()
+	if err != nil {
+		t.Fatalf("Compressed: %v", err)
+	}
+	defer rc.Close()
+	got, _, err := v1.SHA256(rc)
+	if err != nil {
+		t.Fatalf("SHA256: %v", err)
+	}
+	if got != h {
+		t.Errorf("evicted layer digest = %s, want %s", got, h)
+	}
+}
+
+func TestFilesystemWithLimitClosesReaders(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("counts open files in /proc")
+	}
+	openFiles := func() int {
+		fis, err := ioutil.ReadDir("/proc/self/fd")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(fis)
+	}
+
+	dir := mustDir(t)
+	ls := mustLayers(t, 1)
+	c, err := NewFilesystemWithLimit(dir, mustSize(t, ls[0])+1)
+	if err != nil {
+		t.Fatalf("NewFilesystemWithLimit: %v", err)
+	}
+	consume(t, c, ls[0])
+	h, err := ls[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl, err := c.Get(h)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	before := openFiles()
+	for i := 0; i < 10; i++ {
+		rc, err := cl.Compressed()
+		if err != nil {
+			t.Fatalf("Compressed: %v", err)
+		}
+		if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+			t.Fatal(err)
+		}
+		if err := rc.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+	if after := openFiles(); after != before {
+		t.Errorf("%d files open after reading the layer, want %d", after, before)
+	}
+}
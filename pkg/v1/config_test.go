@@ -36,3 +36,18 @@ func TestParseConfig(t *testing.T) {
 		t.Errorf("expected error, got: %v", got)
 	}
 }
+
+func TestConfigFilePlatform(t *testing.T) {
+	cf, err := ParseConfigFile(strings.NewReader(`{"os":"linux","architecture":"arm","variant":"v7","os.version":"1.2"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Platform{OS: "linux", Architecture: "arm", Variant: "v7", OSVersion: "1.2"}
+	if diff := cmp.Diff(want, cf.Platform()); diff != "" {
+		t.Errorf("Platform() (-want +got) %s", diff)
+	}
+
+	if got := (&ConfigFile{}).Platform(); got != nil {
+		t.Errorf("Platform() = %v, want nil", got)
+	}
+}
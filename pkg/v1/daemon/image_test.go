@@ -41,6 +41,7 @@ type MockClient struct {
 
 	loadErr  error
 	loadBody io.ReadCloser
+	loadJSON bool
 
 	saveErr  error
 	saveBody io.ReadCloser
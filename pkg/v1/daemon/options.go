@@ -33,6 +33,8 @@ type options struct {
 	ctx      context.Context
 	client   Client
 	buffered bool
+
+	loadProgress func(LoadProgress)
 }
 
 var defaultClient = func() (Client, error) {
@@ -92,6 +94,14 @@ func WithContext(ctx context.Context) Option {
 	}
 }
 
+// WithLoadProgress is a functional option to receive the progress messages
+// that the daemon reports while Write loads an image.
+func WithLoadProgress(f func(LoadProgress)) Option {
+	return func(o *options) {
+		o.loadProgress = f
+	}
+}
+
 // Client represents the subset of a docker client that the daemon
 // package uses.
 type Client interface {
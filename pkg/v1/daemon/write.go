@@ -15,6 +15,8 @@
 package daemon
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -34,7 +36,30 @@ func Tag(src, dest name.Tag, options ...Option) error {
 	return o.client.ImageTag(o.ctx, src.String(), dest.String())
 }
 
+// LoadProgress is a message from the JSON stream that the daemon reports
+// while loading an image, see WithLoadProgress.
+type LoadProgress struct {
+	Stream   string `json:"stream,omitempty"`
+	Status   string `json:"status,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Progress string `json:"progress,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// loadMessage is a LoadProgress as the daemon encodes it.
+type loadMessage struct {
+	LoadProgress
+	ErrorDetail *struct {
+		Message string `json:"message"`
+	} `json:"errorDetail,omitempty"`
+}
+
 // Write saves the image into the daemon as the given tag.
+//
+// The image is streamed to the daemon in the format of "docker save" as it
+// is produced, without writing it to a temporary file first. Errors that the
+// daemon reports in its progress stream, e.g. when it runs out of disk space,
+// are returned along with the response.
 func Write(tag name.Tag, img v1.Image, options ...Option) (string, error) {
 	o, err := makeOptions(options...)
 	if err != nil {
@@ -42,20 +67,45 @@ func Write(tag name.Tag, img v1.Image, options ...Option) (string, error) {
 	}
 
 	pr, pw := io.Pipe()
+	// Unblock the writer if the daemon stops reading early.
+	defer pr.Close()
 	go func() {
 		pw.CloseWithError(tarball.Write(tag, img, pw))
 	}()
 
-	// write the image in docker save format first, then load it
+	// write the image in docker save format, while it is being loaded
 	resp, err := o.client.ImageLoad(o.ctx, pr, false)
 	if err != nil {
 		return "", fmt.Errorf("error loading image: %v", err)
 	}
 	defer resp.Body.Close()
-	b, err := ioutil.ReadAll(resp.Body)
-	response := string(b)
-	if err != nil {
-		return response, fmt.Errorf("error reading load response body: %v", err)
+
+	if !resp.JSON {
+		b, err := ioutil.ReadAll(resp.Body)
+		response := string(b)
+		if err != nil {
+			return response, fmt.Errorf("error reading load response body: %v", err)
+		}
+		return response, nil
+	}
+
+	var buf bytes.Buffer
+	dec := json.NewDecoder(io.TeeReader(resp.Body, &buf))
+	for {
+		var m loadMessage
+		if err := dec.Decode(&m); err == io.EOF {
+			return buf.String(), nil
+		} else if err != nil {
+			return buf.String(), fmt.Errorf("error reading load response body: %v", err)
+		}
+		if m.Error == "" && m.ErrorDetail != nil {
+			m.Error = m.ErrorDetail.Message
+		}
+		if o.loadProgress != nil {
+			o.loadProgress(m.LoadProgress)
+		}
+		if m.Error != "" {
+			return buf.String(), fmt.Errorf("error loading image: %s", m.Error)
+		}
 	}
-	return response, nil
 }
@@ -24,6 +24,7 @@ import (
 	"testing"
 
 	"github.com/docker/docker/api/types"
+	"github.com/google/go-cmp/cmp"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
@@ -49,6 +50,7 @@ func (m *MockClient) ImageLoad(ctx context.Context, r io.Reader, _ bool) (types.
 	_, _ = io.Copy(ioutil.Discard, r)
 	return types.ImageLoadResponse{
 		Body: m.loadBody,
+		JSON: m.loadJSON,
 	}, m.loadErr
 }
 
@@ -124,6 +126,72 @@ func TestWriteImage(t *testing.T) {
 	}
 }
 
+func TestWriteProgress(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		body    string
+		want    []LoadProgress
+		wantErr string
+	}{{
+		name: "success",
+		body: `{"status":"Loading layer","id":"abc","progress":"[==>  ]"}
+{"stream":"Loaded image: test_image_2:latest\n"}
+`,
+		want: []LoadProgress{
+			{Status: "Loading layer", ID: "abc", Progress: "[==>  ]"},
+			{Stream: "Loaded image: test_image_2:latest\n"},
+		},
+	}, {
+		name: "daemon error",
+		body: `{"status":"Loading layer","id":"abc"}
+{"errorDetail":{"message":"write /var/lib/docker/tmp: no space left on device"},"error":"write /var/lib/docker/tmp: no space left on device"}
+{"stream":"ignored"}
+`,
+		want: []LoadProgress{
+			{Status: "Loading layer", ID: "abc"},
+			{Error: "write /var/lib/docker/tmp: no space left on device"},
+		},
+		wantErr: "no space left on device",
+	}, {
+		name:    "error detail only",
+		body:    `{"errorDetail":{"message":"unexpected EOF"}}`,
+		want:    []LoadProgress{{Error: "unexpected EOF"}},
+		wantErr: "unexpected EOF",
+	}, {
+		name:    "invalid json",
+		body:    `{"stream":`,
+		wantErr: "error reading load response body",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			tag, err := name.NewTag("test_image_2:latest")
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := &MockClient{
+				loadBody: ioutil.NopCloser(strings.NewReader(tc.body)),
+				loadJSON: true,
+			}
+			var got []LoadProgress
+			response, err := Write(tag, empty.Image, WithClient(client), WithLoadProgress(func(p LoadProgress) {
+				got = append(got, p)
+			}))
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("Write() = %v", err)
+				}
+				if response != tc.body {
+					t.Errorf("Write() response = %q, want %q", response, tc.body)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Write() = %v, want error containing %q", err, tc.wantErr)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("progress (-want +got) = %s", diff)
+			}
+		})
+	}
+}
+
 func TestWriteDefaultClient(t *testing.T) {
 	wantErr := fmt.Errorf("bad client")
 	defaultClient = func() (Client, error) {
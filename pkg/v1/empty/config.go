@@ -0,0 +1,75 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package empty
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// JSON is the content of the empty descriptor.
+const JSON = "{}"
+
+// Descriptor is the empty descriptor that the OCI image spec defines for the
+// config of artifacts that have none, and for artifacts without layers, see:
+// https://github.com/opencontainers/image-spec/blob/main/manifest.md#guidance-for-an-empty-descriptor
+var Descriptor = v1.Descriptor{
+	MediaType: types.OCIEmptyJSON,
+	Size:      int64(len(JSON)),
+	Digest: v1.Hash{
+		Algorithm: "sha256",
+		Hex:       "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a",
+	},
+}
+
+// Config is the blob of Descriptor, as a v1.Layer so that it can be written
+// like any other blob.
+var Config v1.Layer = emptyJSON{}
+
+type emptyJSON struct{}
+
+// Digest implements v1.Layer
+func (emptyJSON) Digest() (v1.Hash, error) {
+	return Descriptor.Digest, nil
+}
+
+// DiffID implements v1.Layer
+func (emptyJSON) DiffID() (v1.Hash, error) {
+	return Descriptor.Digest, nil
+}
+
+// Compressed implements v1.Layer
+func (emptyJSON) Compressed() (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader(JSON)), nil
+}
+
+// Uncompressed implements v1.Layer
+func (emptyJSON) Uncompressed() (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader(JSON)), nil
+}
+
+// Size implements v1.Layer
+func (emptyJSON) Size() (int64, error) {
+	return Descriptor.Size, nil
+}
+
+// MediaType implements v1.Layer
+func (emptyJSON) MediaType() (types.MediaType, error) {
+	return Descriptor.MediaType, nil
+}
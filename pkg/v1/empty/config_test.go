@@ -0,0 +1,48 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package empty
+
+import (
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestDescriptor(t *testing.T) {
+	// The well-known value from the OCI image spec.
+	if got, want := Descriptor.Digest.String(), "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"; got != want {
+		t.Errorf("Digest = %s, want %s", got, want)
+	}
+
+	d, size, err := v1.SHA256(strings.NewReader(JSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != Descriptor.Digest || size != Descriptor.Size {
+		t.Errorf("%q has digest %s and size %d, want %s and %d", JSON, d, size, Descriptor.Digest, Descriptor.Size)
+	}
+
+	rc, err := Config.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if d, _, err := v1.SHA256(rc); err != nil {
+		t.Fatal(err)
+	} else if d != Descriptor.Digest {
+		t.Errorf("Config has digest %s, want %s", d, Descriptor.Digest)
+	}
+}
@@ -12,5 +12,6 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package empty provides an implementation of v1.Image equivalent to "FROM scratch".
+// Package empty provides an implementation of v1.Image equivalent to "FROM scratch",
+// and the empty descriptor of OCI artifacts.
 package empty
@@ -16,6 +16,7 @@ package v1
 
 import (
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -74,13 +75,15 @@ func (h *Hash) UnmarshalText(text []byte) error {
 	return h.parse(string(text))
 }
 
-// Hasher returns a hash.Hash for the named algorithm (e.g. "sha256")
+// Hasher returns a hash.Hash for the named algorithm (e.g. "sha256" or "sha512")
 func Hasher(name string) (hash.Hash, error) {
 	switch name {
 	case "sha256":
 		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
 	default:
-		return nil, fmt.Errorf("unsupported hash: %q", name)
+		return nil, fmt.Errorf("unsupported algorithm: %q", name)
 	}
 }
 
@@ -111,13 +114,27 @@ func (h *Hash) parse(unquoted string) error {
 
 // SHA256 computes the Hash of the provided io.Reader's content.
 func SHA256(r io.Reader) (Hash, int64, error) {
-	hasher := sha256.New()
+	return Compute("sha256", r)
+}
+
+// SHA512 computes the sha512 Hash of the provided io.Reader's content.
+func SHA512(r io.Reader) (Hash, int64, error) {
+	return Compute("sha512", r)
+}
+
+// Compute computes the Hash of the provided io.Reader's content using the
+// named algorithm (see Hasher).
+func Compute(algorithm string, r io.Reader) (Hash, int64, error) {
+	hasher, err := Hasher(algorithm)
+	if err != nil {
+		return Hash{}, 0, err
+	}
 	n, err := io.Copy(hasher, r)
 	if err != nil {
 		return Hash{}, 0, err
 	}
 	return Hash{
-		Algorithm: "sha256",
+		Algorithm: algorithm,
 		Hex:       hex.EncodeToString(hasher.Sum(make([]byte, 0, hasher.Size()))),
 	}, n, nil
 }
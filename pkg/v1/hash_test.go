@@ -25,6 +25,7 @@ func TestGoodHashes(t *testing.T) {
 	good := []string{
 		"sha256:deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef",
 		"sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		"sha512:" + strings.Repeat("0123456789abcdef", 8),
 	}
 
 	for _, s := range good {
@@ -49,6 +50,8 @@ func TestBadHashes(t *testing.T) {
 	bad := []string{
 		// Too short
 		"sha256:deadbeef",
+		// Too short for sha512
+		"sha512:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
 		// Bad character
 		"sha256:o123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
 		// Unknown algorithm
@@ -84,6 +87,40 @@ func TestSHA256(t *testing.T) {
 	}
 }
 
+func TestSHA512(t *testing.T) {
+	input := "asdf"
+	h, n, err := SHA512(strings.NewReader(input))
+	if err != nil {
+		t.Error("SHA512(asdf) =", err)
+	}
+	if got, want := h.Algorithm, "sha512"; got != want {
+		t.Errorf("Algorithm; got %v, want %v", got, want)
+	}
+	if got, want := h.Hex, "401b09eab3c013d4ca54922bb802bec8fd5318192b0a75f201d8b3727429080fb337591abd3e44453b954555b7a0812e1081c39b740293f765eae731f5a65ed1"; got != want {
+		t.Errorf("Hex; got %v, want %v", got, want)
+	}
+	if got, want := n, int64(len(input)); got != want {
+		t.Errorf("n; got %v, want %v", got, want)
+	}
+}
+
+func TestUnsupportedAlgorithm(t *testing.T) {
+	for _, f := range []func() error{
+		func() error {
+			_, err := NewHash("md5:0123456789abcdef0123456789abcdef")
+			return err
+		},
+		func() error {
+			_, _, err := Compute("md5", strings.NewReader("asdf"))
+			return err
+		},
+	} {
+		if err := f(); err == nil || !strings.Contains(err.Error(), "unsupported algorithm") {
+			t.Errorf("got %v, want unsupported algorithm error", err)
+		}
+	}
+}
+
 // This tests that you can use Hash as a key in a map (needs to implement both
 // MarshalText and UnmarshalText).
 func TestTextMarshalling(t *testing.T) {
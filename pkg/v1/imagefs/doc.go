@@ -0,0 +1,24 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package imagefs exposes the flattened filesystem of a v1.Image as an
+// io/fs.FS, so that individual files can be read without extracting the
+// whole image, e.g.:
+//
+//	fsys, err := imagefs.New(img)
+//	...
+//	b, err := fs.ReadFile(fsys, "etc/os-release")
+//
+// This requires go 1.16 or later.
+package imagefs
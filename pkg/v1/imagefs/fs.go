@@ -0,0 +1,476 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.16
+// +build go1.16
+
+package imagefs
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = whiteoutPrefix + whiteoutPrefix + ".opq"
+
+	// maxSymlinks is the number of symlinks we follow before giving up, like
+	// Linux's MAXSYMLINKS.
+	maxSymlinks = 40
+)
+
+var errLoop = errors.New("too many levels of symbolic links")
+
+// FS is an fs.FS of the flattened filesystem of an image, with whiteouts
+// applied and symlinks resolved within the image.
+//
+// Opening a file only decompresses the layers from the top down to the first
+// one that contains it. Listing a directory reads every layer.
+type FS struct {
+	// layers are ordered from the top layer to the base layer.
+	layers []v1.Layer
+}
+
+var _ fs.FS = (*FS)(nil)
+
+// New returns an FS of the filesystem of img.
+func New(img v1.Image) (*FS, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("retrieving image layers: %v", err)
+	}
+	top := make([]v1.Layer, len(layers))
+	for i, l := range layers {
+		top[len(layers)-1-i] = l
+	}
+	return &FS{layers: top}, nil
+}
+
+// Open implements fs.FS.
+func (f *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	file, err := f.open(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return file, nil
+}
+
+func (f *FS) open(name string) (fs.File, error) {
+	e, err := f.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	// Report the name that was opened, rather than that of a symlink's or
+	// hardlink's target.
+	base := path.Base(name)
+	if e.hdr == nil || e.hdr.Typeflag == tar.TypeDir {
+		e.close()
+		return &dir{fs: f, name: e.name, info: renamed{FileInfo: e.info(), name: base}}, nil
+	}
+	if e.hdr.Typeflag == tar.TypeLink {
+		e.close()
+		if e, err = f.hardlink(e); err != nil {
+			return nil, err
+		}
+	}
+	return &file{info: renamed{FileInfo: e.info(), name: base}, entry: e}, nil
+}
+
+// entry is a tar entry of one of the layers, or an implicit directory.
+type entry struct {
+	// name is the cleaned path of the entry.
+	name string
+
+	// hdr is nil for directories that only exist because of their contents.
+	hdr *tar.Header
+
+	// layer is the index of the layer containing the entry.
+	layer int
+
+	// For regular files, tr is positioned at the contents of the entry, and
+	// rc needs to be closed.
+	tr *tar.Reader
+	rc io.ReadCloser
+}
+
+func (e *entry) info() fs.FileInfo {
+	if e.hdr == nil {
+		return implicitDir(path.Base(e.name))
+	}
+	return renamed{FileInfo: e.hdr.FileInfo(), name: path.Base(e.name)}
+}
+
+func (e *entry) close() error {
+	if e.rc == nil {
+		return nil
+	}
+	err := e.rc.Close()
+	e.rc, e.tr = nil, nil
+	return err
+}
+
+// resolve looks up name, following symlinks.
+func (f *FS) resolve(name string) (*entry, error) {
+	for hops := 0; hops < maxSymlinks; hops++ {
+		e, err := f.lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		if e.hdr == nil || e.hdr.Typeflag != tar.TypeSymlink {
+			return e, nil
+		}
+
+		// Either name or one of its ancestors is a symlink, so replace that
+		// part of name with the symlink's target and try again.
+		e.close()
+		target := e.hdr.Linkname
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(e.name), target)
+		}
+		name = clean(target + strings.TrimPrefix(name, e.name))
+	}
+	return nil, errLoop
+}
+
+// lookup returns the topmost visible entry for name, without following
+// symlinks. If one of the ancestors of name is a symlink, it returns that
+// instead, so that the caller can resolve it.
+func (f *FS) lookup(name string) (*entry, error) {
+	if name == "." {
+		return &entry{name: name}, nil
+	}
+
+	// Ancestors that are directories in an upper layer, which hides any
+	// other type of file with that name in lower layers.
+	dirs := map[string]bool{}
+	for i, l := range f.layers {
+		rc, err := l.Uncompressed()
+		if err != nil {
+			return nil, err
+		}
+		tr := tar.NewReader(rc)
+
+		// Whiteouts only affect the layers below this one.
+		hidden, implicit := false, false
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				rc.Close()
+				return nil, err
+			}
+			n := clean(hdr.Name)
+
+			if n == name {
+				e := &entry{name: n, hdr: hdr, layer: i}
+				if hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA {
+					e.tr, e.rc = tr, rc
+				} else {
+					rc.Close()
+				}
+				return e, nil
+			}
+
+			dir, base := path.Dir(n), path.Base(n)
+			if base == opaqueWhiteout {
+				if within(name, dir) {
+					hidden = true
+				}
+				continue
+			}
+			if strings.HasPrefix(base, whiteoutPrefix) {
+				target := path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+				if target == name || within(name, target) {
+					hidden = true
+				}
+				continue
+			}
+
+			if within(name, n) && !dirs[n] {
+				switch hdr.Typeflag {
+				case tar.TypeDir:
+					dirs[n] = true
+				case tar.TypeSymlink:
+					rc.Close()
+					return &entry{name: n, hdr: hdr, layer: i}, nil
+				default:
+					// An ancestor of name is not a directory.
+					rc.Close()
+					return nil, fs.ErrNotExist
+				}
+			}
+			if within(n, name) {
+				implicit = true
+			}
+		}
+		if err := rc.Close(); err != nil {
+			return nil, err
+		}
+		if implicit {
+			return &entry{name: name, layer: i}, nil
+		}
+		if hidden {
+			return nil, fs.ErrNotExist
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+// hardlink returns the regular file that the hardlink e points to, which
+// must precede it in the same layer.
+func (f *FS) hardlink(e *entry) (*entry, error) {
+	target := clean(e.hdr.Linkname)
+	rc, err := f.layers[e.layer].Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		if clean(hdr.Name) == target && (hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA) {
+			return &entry{name: e.name, hdr: hdr, layer: e.layer, tr: tr, rc: rc}, nil
+		}
+	}
+	rc.Close()
+	return nil, fmt.Errorf("hardlink %s: target %s not found", e.name, target)
+}
+
+// child is a candidate for an entry of a directory listing.
+type child struct {
+	info     fs.FileInfo
+	layer    int
+	implicit bool
+}
+
+// readDir lists the contents of the directory name, which must not contain
+// any symlinks.
+func (f *FS) readDir(name string) ([]fs.DirEntry, error) {
+	children := map[string]child{}
+
+	// Names of children that were removed in an upper layer.
+	hidden := map[string]bool{}
+	for i, l := range f.layers {
+		rc, err := l.Uncompressed()
+		if err != nil {
+			return nil, err
+		}
+		tr := tar.NewReader(rc)
+
+		// Whiteouts only affect the layers below this one.
+		removed, opaque := map[string]bool{}, false
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				rc.Close()
+				return nil, err
+			}
+			n := clean(hdr.Name)
+			if !within(n, name) {
+				// Removing name, or one of its ancestors, hides the contents
+				// of name in the layers below.
+				dir, base := path.Dir(n), path.Base(n)
+				if base == opaqueWhiteout && within(name, dir) {
+					opaque = true
+				} else if strings.HasPrefix(base, whiteoutPrefix) {
+					target := path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+					if target == name || within(name, target) {
+						opaque = true
+					}
+				}
+				continue
+			}
+			rel := n
+			if name != "." {
+				rel = strings.TrimPrefix(n, name+"/")
+			}
+			c := strings.SplitN(rel, "/", 2)[0]
+			if hidden[c] {
+				continue
+			}
+
+			if path.Dir(n) == name {
+				base := path.Base(n)
+				if base == opaqueWhiteout {
+					opaque = true
+					continue
+				}
+				if strings.HasPrefix(base, whiteoutPrefix) {
+					removed[strings.TrimPrefix(base, whiteoutPrefix)] = true
+					continue
+				}
+			}
+			if strings.HasPrefix(path.Base(n), whiteoutPrefix) {
+				continue
+			}
+
+			// The topmost entry wins, but an explicit entry replaces an
+			// implicit one from the same layer.
+			implicit := rel != c
+			if existing, ok := children[c]; ok && !(existing.layer == i && existing.implicit && !implicit) {
+				continue
+			}
+			if implicit {
+				children[c] = child{info: implicitDir(c), layer: i, implicit: true}
+			} else {
+				children[c] = child{info: renamed{FileInfo: hdr.FileInfo(), name: c}, layer: i}
+			}
+		}
+		if err := rc.Close(); err != nil {
+			return nil, err
+		}
+		if opaque {
+			break
+		}
+		for c := range removed {
+			hidden[c] = true
+		}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, c := range children {
+		entries = append(entries, dirEntry{c.info})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// file is an open regular file.
+type file struct {
+	info  fs.FileInfo
+	entry *entry
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *file) Read(b []byte) (int, error) {
+	if f.entry.tr == nil {
+		return 0, fs.ErrClosed
+	}
+	return f.entry.tr.Read(b)
+}
+
+func (f *file) Close() error { return f.entry.close() }
+
+// dir is an open directory, whose entries are listed on demand.
+type dir struct {
+	fs      *FS
+	name    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	listed  bool
+	offset  int
+}
+
+var _ fs.ReadDirFile = (*dir)(nil)
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error { return nil }
+
+// ReadDir implements fs.ReadDirFile.
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.fs.readDir(d.name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: err}
+		}
+		d.entries, d.listed = entries, true
+	}
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
+
+// renamed overrides the name of a FileInfo, e.g. for symlinks and entries
+// with trailing slashes.
+type renamed struct {
+	fs.FileInfo
+	name string
+}
+
+func (r renamed) Name() string { return r.name }
+
+// implicitDir is the FileInfo of a directory without a tar entry.
+type implicitDir string
+
+func (d implicitDir) Name() string       { return string(d) }
+func (d implicitDir) Size() int64        { return 0 }
+func (d implicitDir) Mode() fs.FileMode  { return fs.ModeDir | 0755 }
+func (d implicitDir) ModTime() time.Time { return time.Time{} }
+func (d implicitDir) IsDir() bool        { return true }
+func (d implicitDir) Sys() interface{}   { return nil }
+
+// dirEntry adapts a FileInfo to a DirEntry.
+type dirEntry struct {
+	fs.FileInfo
+}
+
+func (d dirEntry) Type() fs.FileMode          { return d.Mode().Type() }
+func (d dirEntry) Info() (fs.FileInfo, error) { return d.FileInfo, nil }
+
+// clean turns a tar entry name or symlink target into a path relative to the
+// root of the filesystem, as used by fs.FS, without escaping the root.
+func clean(name string) string {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return "."
+	}
+	return name[1:]
+}
+
+// within returns whether name is inside the directory dir.
+func within(name, dir string) bool {
+	if dir == "." {
+		return name != "."
+	}
+	return strings.HasPrefix(name, dir+"/")
+}
@@ -0,0 +1,241 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.16
+// +build go1.16
+
+package imagefs
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// countingLayer counts the calls to Uncompressed.
+type countingLayer struct {
+	v1.Layer
+	opened int
+}
+
+func (l *countingLayer) Uncompressed() (io.ReadCloser, error) {
+	l.opened++
+	return l.Layer.Uncompressed()
+}
+
+func layer(t *testing.T, hdrs ...*tar.Header) *countingLayer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range hdrs {
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(hdr.Linkname))
+		}
+		contents := hdr.Linkname
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Linkname = ""
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(contents)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	l, err := tarball.LayerFromReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &countingLayer{Layer: l}
+}
+
+// regHdr, dirHdr, symlinkHdr and hardlinkHdr construct headers for layer;
+// the contents of regular files are passed as Linkname.
+func regHdr(name, contents string) *tar.Header {
+	return &tar.Header{Name: name, Typeflag: tar.TypeReg, Linkname: contents}
+}
+
+func dirHdr(name string) *tar.Header {
+	return &tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755}
+}
+
+func symlinkHdr(name, target string) *tar.Header {
+	return &tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target}
+}
+
+func hardlinkHdr(name, target string) *tar.Header {
+	return &tar.Header{Name: name, Typeflag: tar.TypeLink, Linkname: target}
+}
+
+func image(t *testing.T, layers ...*countingLayer) *FS {
+	t.Helper()
+	var ls []v1.Layer
+	for _, l := range layers {
+		ls = append(ls, l)
+	}
+	img, err := mutate.AppendLayers(empty.Image, ls...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := New(img)
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	return fsys
+}
+
+func TestFS(t *testing.T) {
+	base := layer(t,
+		dirHdr("etc/"),
+		symlinkHdr("etc/os-release", "../usr/lib/os-release"),
+		dirHdr("usr/"),
+		dirHdr("usr/lib/"),
+		regHdr("usr/lib/os-release", "ID=base"),
+		dirHdr("usr/bin/"),
+		regHdr("usr/bin/sh", "sh"),
+		symlinkHdr("bin", "usr/bin"),
+		hardlinkHdr("usr/bin/bash", "usr/bin/sh"),
+		regHdr("a/x", "x"),
+		regHdr("a/y", "y"),
+		regHdr("d/old", "old"),
+		dirHdr("gone/"),
+		regHdr("gone/file", "gone"),
+	)
+	middle := layer(t,
+		regHdr("a/.wh.x", ""),
+		regHdr("d/.wh..wh..opq", ""),
+		regHdr("d/new", "new"),
+		regHdr(".wh.gone", ""),
+		symlinkHdr("loop1", "loop2"),
+		symlinkHdr("loop2", "/loop1"),
+		symlinkHdr("escape", "../../../bin/sh"),
+	)
+	top := layer(t,
+		regHdr("top", "top"),
+	)
+	fsys := image(t, base, middle, top)
+
+	for _, tc := range []struct {
+		name, want string
+	}{
+		{"top", "top"},
+		{"etc/os-release", "ID=base"},
+		{"bin/sh", "sh"},
+		{"usr/bin/bash", "sh"},
+		{"a/y", "y"},
+		{"d/new", "new"},
+		{"escape", "sh"},
+	} {
+		got, err := fs.ReadFile(fsys, tc.name)
+		if err != nil {
+			t.Errorf("ReadFile(%s) = %v", tc.name, err)
+		} else if string(got) != tc.want {
+			t.Errorf("ReadFile(%s) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	for _, name := range []string{"a/x", "d/old", "gone", "gone/file", "nope", "top/child"} {
+		if _, err := fs.Stat(fsys, name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(%s) = %v, want %v", name, err, fs.ErrNotExist)
+		}
+	}
+	if _, err := fsys.Open("loop1"); err == nil || !errors.Is(err, errLoop) {
+		t.Errorf("Open(loop1) = %v, want %v", err, errLoop)
+	}
+	if _, err := fsys.Open("/etc/os-release"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Open(/etc/os-release) = %v, want %v", err, fs.ErrInvalid)
+	}
+
+	for _, tc := range []struct {
+		name string
+		want []string
+	}{
+		{".", []string{"a", "bin", "d", "escape", "etc", "loop1", "loop2", "top", "usr"}},
+		{"a", []string{"y"}},
+		{"d", []string{"new"}},
+		{"bin", []string{"bash", "sh"}},
+	} {
+		entries, err := fs.ReadDir(fsys, tc.name)
+		if err != nil {
+			t.Errorf("ReadDir(%s) = %v", tc.name, err)
+			continue
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Name())
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("ReadDir(%s) (-want +got) = %s", tc.name, diff)
+		}
+	}
+
+	if fi, err := fs.Stat(fsys, "bin"); err != nil {
+		t.Errorf("Stat(bin) = %v", err)
+	} else if !fi.IsDir() || fi.Name() != "bin" {
+		t.Errorf("Stat(bin) = %s (dir: %t), want directory bin", fi.Name(), fi.IsDir())
+	}
+}
+
+func TestFSLazy(t *testing.T) {
+	base := layer(t, regHdr("etc/os-release", "ID=base"))
+	top := layer(t, regHdr("etc/os-release", "ID=top"))
+	fsys := image(t, base, top)
+
+	got, err := fs.ReadFile(fsys, "etc/os-release")
+	if err != nil {
+		t.Fatalf("ReadFile() = %v", err)
+	}
+	if string(got) != "ID=top" {
+		t.Errorf("ReadFile() = %q, want %q", got, "ID=top")
+	}
+	if base.opened != 0 {
+		t.Errorf("base layer was read %d times, want 0", base.opened)
+	}
+}
+
+func TestFSConformance(t *testing.T) {
+	base := layer(t,
+		dirHdr("etc/"),
+		regHdr("etc/hostname", "base"),
+		regHdr("etc/passwd", "root"),
+		regHdr("var/log/old", "old"),
+	)
+	top := layer(t,
+		regHdr("etc/hostname", "top"),
+		regHdr("etc/.wh.passwd", ""),
+		regHdr("var/.wh..wh..opq", ""),
+		regHdr("var/new", "new"),
+	)
+	if err := fstest.TestFS(image(t, base, top), "etc/hostname", "var/new"); err != nil {
+		t.Error(err)
+	}
+}
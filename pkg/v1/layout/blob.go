@@ -20,6 +20,12 @@ import (
 	"os"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+)
+
+var (
+	_ partial.WithBlob      = Path("")
+	_ partial.WithWriteBlob = Path("")
 )
 
 // Blob returns a blob with the given hash from the Path.
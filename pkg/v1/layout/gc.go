@@ -0,0 +1,154 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// GarbageCollect removes the blobs from the Path that are not reachable from
+// its index.json, e.g. after RemoveDescriptors, and returns their digests.
+//
+// Every manifest, config and layer that is referenced, directly or through
+// nested indexes, by a descriptor in index.json is kept.
+func (l Path) GarbageCollect() ([]v1.Hash, error) {
+	unreferenced, err := l.GarbageCollectDryRun()
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range unreferenced {
+		if err := l.RemoveBlob(h); err != nil {
+			return nil, err
+		}
+	}
+	return unreferenced, nil
+}
+
+// GarbageCollectDryRun returns the digests of the blobs that GarbageCollect
+// would remove, without removing them.
+func (l Path) GarbageCollectDryRun() ([]v1.Hash, error) {
+	rawIndex, err := ioutil.ReadFile(l.path("index.json"))
+	if err != nil {
+		return nil, err
+	}
+	index, err := v1.ParseIndexManifest(bytes.NewReader(rawIndex))
+	if err != nil {
+		return nil, err
+	}
+
+	reachable := map[v1.Hash]bool{}
+	for _, desc := range index.Manifests {
+		if err := l.mark(desc, reachable); err != nil {
+			return nil, err
+		}
+	}
+
+	blobs, err := l.blobs()
+	if err != nil {
+		return nil, err
+	}
+	var unreferenced []v1.Hash
+	for _, h := range blobs {
+		if !reachable[h] {
+			unreferenced = append(unreferenced, h)
+		}
+	}
+	return unreferenced, nil
+}
+
+// mark adds desc and everything it references to reachable.
+func (l Path) mark(desc v1.Descriptor, reachable map[v1.Hash]bool) error {
+	if reachable[desc.Digest] {
+		return nil
+	}
+	reachable[desc.Digest] = true
+
+	if !desc.MediaType.IsIndex() && !desc.MediaType.IsImage() {
+		return nil
+	}
+	b, err := l.Bytes(desc.Digest)
+	if os.IsNotExist(err) {
+		// There is nothing to keep for a manifest that isn't in the layout.
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var children []v1.Descriptor
+	if desc.MediaType.IsIndex() {
+		index, err := v1.ParseIndexManifest(bytes.NewReader(b))
+		if err != nil {
+			return fmt.Errorf("parsing index %s: %v", desc.Digest, err)
+		}
+		children = index.Manifests
+		if index.Subject != nil {
+			children = append(children, *index.Subject)
+		}
+	} else {
+		manifest, err := v1.ParseManifest(bytes.NewReader(b))
+		if err != nil {
+			return fmt.Errorf("parsing manifest %s: %v", desc.Digest, err)
+		}
+		children = append([]v1.Descriptor{manifest.Config}, manifest.Layers...)
+		if manifest.Subject != nil {
+			children = append(children, *manifest.Subject)
+		}
+	}
+	for _, child := range children {
+		if err := l.mark(child, reachable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blobs returns the digests of all the blobs in the Path, sorted.
+func (l Path) blobs() ([]v1.Hash, error) {
+	algorithms, err := ioutil.ReadDir(l.path("blobs"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var hs []v1.Hash
+	for _, algorithm := range algorithms {
+		if !algorithm.IsDir() {
+			continue
+		}
+		fis, err := ioutil.ReadDir(l.path("blobs", algorithm.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range fis {
+			h, err := v1.NewHash(algorithm.Name() + ":" + fi.Name())
+			if err != nil || !fi.Mode().IsRegular() {
+				// Not a blob.
+				continue
+			}
+			hs = append(hs, h)
+		}
+	}
+	sort.Slice(hs, func(i, j int) bool {
+		return hs[i].String() < hs[j].String()
+	})
+	return hs, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+// imageBlobs returns the digests of the manifest, config and layers of img.
+func imageBlobs(t *testing.T, img v1.Image) []v1.Hash {
+	t.Helper()
+	d, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := []v1.Hash{d, m.Config.Digest}
+	for _, l := range m.Layers {
+		hs = append(hs, l.Digest)
+	}
+	return hs
+}
+
+func TestGarbageCollect(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "garbage-collect-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(tmp)
+
+	l, err := Write(tmp, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keep, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.AppendImage(keep, WithAnnotations(map[string]string{
+		"org.opencontainers.image.ref.name": "keep",
+	})); err != nil {
+		t.Fatal(err)
+	}
+	remove, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.AppendImage(remove); err != nil {
+		t.Fatal(err)
+	}
+	nested, err := random.Index(1024, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.AppendIndex(nested); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is unreferenced yet.
+	if got, err := l.GarbageCollectDryRun(); err != nil {
+		t.Fatalf("GarbageCollectDryRun() = %v", err)
+	} else if len(got) != 0 {
+		t.Errorf("GarbageCollectDryRun() = %v, want nothing", got)
+	}
+
+	digest, err := remove.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.RemoveDescriptors(match.Digests(digest)); err != nil {
+		t.Fatal(err)
+	}
+	want := imageBlobs(t, remove)
+	sort.Slice(want, func(i, j int) bool {
+		return want[i].String() < want[j].String()
+	})
+
+	got, err := l.GarbageCollectDryRun()
+	if err != nil {
+		t.Fatalf("GarbageCollectDryRun() = %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GarbageCollectDryRun() (-want +got) = %s", diff)
+	}
+	for _, h := range want {
+		if _, err := os.Stat(l.blobPath(h)); err != nil {
+			t.Errorf("dry run removed %s: %v", h, err)
+		}
+	}
+
+	got, err = l.GarbageCollect()
+	if err != nil {
+		t.Fatalf("GarbageCollect() = %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GarbageCollect() (-want +got) = %s", diff)
+	}
+	for _, h := range want {
+		if _, err := os.Stat(l.blobPath(h)); !os.IsNotExist(err) {
+			t.Errorf("GarbageCollect() kept %s", h)
+		}
+	}
+
+	// Everything that's still referenced, including the children of the
+	// nested index, is intact.
+	ii, err := l.ImageIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validate.Index(ii); err != nil {
+		t.Errorf("validate.Index() = %v", err)
+	}
+	for _, h := range imageBlobs(t, keep) {
+		if _, err := os.Stat(l.blobPath(h)); err != nil {
+			t.Errorf("GarbageCollect() removed referenced blob %s: %v", h, err)
+		}
+	}
+
+	// Collecting again is a no-op.
+	if got, err := l.GarbageCollect(); err != nil {
+		t.Fatalf("GarbageCollect() = %v", err)
+	} else if len(got) != 0 {
+		t.Errorf("GarbageCollect() = %v, want nothing", got)
+	}
+}
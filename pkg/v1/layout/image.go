@@ -15,11 +15,14 @@
 package layout
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"sync"
 
+	"github.com/google/go-containerregistry/internal/verify"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/types"
@@ -75,6 +78,13 @@ func (li *layoutImage) RawConfigFile() ([]byte, error) {
 		return nil, err
 	}
 
+	if manifest.Config.Data != nil {
+		if err := verify.Descriptor(manifest.Config); err != nil {
+			return nil, err
+		}
+		return manifest.Config.Data, nil
+	}
+
 	return li.path.Bytes(manifest.Config.Digest)
 }
 
@@ -94,7 +104,7 @@ func (li *layoutImage) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error)
 	for _, desc := range manifest.Layers {
 		if h == desc.Digest {
 			switch desc.MediaType {
-			case types.OCILayer, types.DockerLayer:
+			case types.OCILayer, types.OCILayerZStd, types.DockerLayer, types.OCIEmptyJSON:
 				return &compressedBlob{
 					path: li.path,
 					desc: desc,
@@ -120,6 +130,9 @@ func (b *compressedBlob) Digest() (v1.Hash, error) {
 }
 
 func (b *compressedBlob) Compressed() (io.ReadCloser, error) {
+	if b.desc.Data != nil {
+		return verify.ReadCloser(ioutil.NopCloser(bytes.NewReader(b.desc.Data)), b.desc.Size, b.desc.Digest)
+	}
 	return b.path.Blob(b.desc.Digest)
 }
 
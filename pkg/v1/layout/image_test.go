@@ -15,11 +15,16 @@
 package layout
 
 import (
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"testing"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
 )
@@ -145,3 +150,47 @@ func TestImageErrors(t *testing.T) {
 		t.Errorf("Image(%s, %s) = nil, expected err", bogusPath, bogusDigest)
 	}
 }
+
+func TestImageInlineData(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "inline-data-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	rnd, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := mutate.InlineData(rnd, 1<<20)
+	lp, err := Write(tmp, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lp.AppendImage(img); err != nil {
+		t.Fatal(err)
+	}
+
+	// Remove the blobs, which are embedded in the manifest.
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, desc := range append(m.Layers, m.Config) {
+		if err := os.Remove(lp.blobPath(desc.Digest)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := lp.Image(h)
+	if err != nil {
+		t.Fatalf("Image() = %v", err)
+	}
+	if err := validate.Image(got); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+}
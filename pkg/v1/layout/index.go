@@ -139,13 +139,42 @@ func (i *layoutIndex) findDescriptor(h v1.Hash) (*v1.Descriptor, error) {
 		return &(im.Manifests)[0], nil
 	}
 
+	if desc := i.findNested(im, h, map[v1.Hash]bool{}); desc != nil {
+		return desc, nil
+	}
+
+	return nil, fmt.Errorf("could not find descriptor in index: %s", h)
+}
+
+// findNested looks for h in im and then, depth first, in the nested indexes
+// that are in the layout, so that manifests buried in sub-indexes can be
+// found, too.
+func (i *layoutIndex) findNested(im *v1.IndexManifest, h v1.Hash, seen map[v1.Hash]bool) *v1.Descriptor {
 	for _, desc := range im.Manifests {
 		if desc.Digest == h {
-			return &desc, nil
+			return &desc
 		}
 	}
-
-	return nil, fmt.Errorf("could not find descriptor in index: %s", h)
+	for _, desc := range im.Manifests {
+		if !desc.MediaType.IsIndex() || seen[desc.Digest] {
+			continue
+		}
+		seen[desc.Digest] = true
+		// Layouts don't have to contain every child, so skip those that are
+		// missing or broken.
+		rawIndex, err := i.path.Bytes(desc.Digest)
+		if err != nil {
+			continue
+		}
+		var child v1.IndexManifest
+		if err := json.Unmarshal(rawIndex, &child); err != nil {
+			continue
+		}
+		if found := i.findNested(&child, h, seen); found != nil {
+			return found
+		}
+	}
+	return nil
 }
 
 // TODO: Pull this out into methods on types.MediaType? e.g. instead, have:
@@ -15,9 +15,14 @@
 package layout
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
 )
@@ -57,6 +62,67 @@ func TestIndex(t *testing.T) {
 	}
 }
 
+func TestNestedIndex(t *testing.T) {
+	img, err := random.Image(100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img})
+	root := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: sub})
+
+	tmp, err := ioutil.TempDir("", "layout-nested")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if _, err := Write(tmp, root); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+
+	idx, err := ImageIndexFromPath(tmp)
+	if err != nil {
+		t.Fatalf("ImageIndexFromPath() = %v", err)
+	}
+	subDigest, err := sub.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imgDigest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotSub, err := idx.ImageIndex(subDigest)
+	if err != nil {
+		t.Fatalf("ImageIndex(sub) = %v", err)
+	}
+	if err := validate.Index(gotSub); err != nil {
+		t.Errorf("validate.Index() = %v", err)
+	}
+
+	// The image is only a child of the sub-index.
+	gotImg, err := idx.Image(imgDigest)
+	if err != nil {
+		t.Fatalf("Image(leaf) = %v", err)
+	}
+	if err := validate.Image(gotImg); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+	if d, err := gotImg.Digest(); err != nil {
+		t.Fatal(err)
+	} else if d != imgDigest {
+		t.Errorf("Digest() = %s, want %s", d, imgDigest)
+	}
+
+	// The wrong media type is still an error, however deep the manifest is.
+	if _, err := idx.ImageIndex(imgDigest); err == nil {
+		t.Error("ImageIndex(leaf) = nil, wanted error")
+	}
+	if _, err := idx.Image(subDigest); err == nil {
+		t.Error("Image(sub) = nil, wanted error")
+	}
+}
+
 func TestIndexErrors(t *testing.T) {
 	idx, err := ImageIndexFromPath(testPath)
 	if err != nil {
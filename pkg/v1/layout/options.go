@@ -6,7 +6,9 @@ import v1 "github.com/google/go-containerregistry/pkg/v1"
 type Option func(*options)
 
 type options struct {
-	descOpts []descriptorOption
+	descOpts    []descriptorOption
+	referrers   bool
+	verifyBlobs bool
 }
 
 func makeOptions(opts ...Option) *options {
@@ -55,3 +57,22 @@ func WithPlatform(platform v1.Platform) Option {
 		})
 	}
 }
+
+// WithBlobVerification checks the digest of blobs that already exist in the
+// layout before skipping them, and rewrites those that are corrupt, as well as
+// the digest of the blobs that are written. By default, existing blobs are
+// trusted, which avoids reading them.
+func WithBlobVerification() Option {
+	return func(o *options) {
+		o.verifyBlobs = true
+	}
+}
+
+// WithReferrers keeps the referrers index of the artifact's subject up to
+// date, so that Path.Referrers finds the artifact. It is a no-op for
+// artifacts without a subject.
+func WithReferrers() Option {
+	return func(o *options) {
+		o.referrers = true
+	}
+}
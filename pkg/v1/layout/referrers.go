@@ -0,0 +1,222 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Referrers returns an index of the manifests in the Path that refer to the
+// given subject digest, like remote.Referrers does for a registry.
+//
+// The Path only knows about the referrers that were appended with the
+// WithReferrers option. They are kept in a regular OCI image index, which
+// index.json refers to under the name "<alg>-<hex>" of the tag schema for
+// registries without the referrers API, so the layout stays portable.
+func (l Path) Referrers(subject v1.Hash) (v1.ImageIndex, error) {
+	ii, err := l.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	index, err := ii.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	i := findReferrers(index, subject)
+	if i < 0 {
+		return mutate.IndexMediaType(empty.Index, types.OCIImageIndex), nil
+	}
+	return ii.ImageIndex(index.Manifests[i].Digest)
+}
+
+// referrersName returns the name of the descriptor for the referrers index
+// of subject in index.json.
+func referrersName(subject v1.Hash) string {
+	return subject.Algorithm + "-" + subject.Hex
+}
+
+// IsReferrers reports whether desc is the entry of a referrers index in
+// index.json, which the WithReferrers option maintains, rather than a
+// manifest that was appended to the Path.
+func IsReferrers(desc v1.Descriptor) bool {
+	if desc.MediaType != types.OCIImageIndex {
+		return false
+	}
+	name := desc.Annotations[imagespec.AnnotationRefName]
+	i := strings.Index(name, "-")
+	if i < 0 {
+		return false
+	}
+	subject, err := v1.NewHash(name[:i] + ":" + name[i+1:])
+	return err == nil && referrersName(subject) == name
+}
+
+// findReferrers returns the position of the referrers index of subject in
+// index, or -1 if there is none.
+func findReferrers(index *v1.IndexManifest, subject v1.Hash) int {
+	name := referrersName(subject)
+	for i, desc := range index.Manifests {
+		if desc.MediaType == types.OCIImageIndex && desc.Annotations[imagespec.AnnotationRefName] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// referrer reads the manifest that desc points to, and returns its subject,
+// if any, along with the descriptor to list it under in the referrers index.
+func (l Path) referrer(desc v1.Descriptor) (*v1.Descriptor, v1.Descriptor, error) {
+	if !desc.MediaType.IsImage() && !desc.MediaType.IsIndex() {
+		return nil, v1.Descriptor{}, nil
+	}
+	b, err := l.Bytes(desc.Digest)
+	if err != nil {
+		return nil, v1.Descriptor{}, err
+	}
+
+	var subject *v1.Descriptor
+	var annotations map[string]string
+	var artifactType string
+	if desc.MediaType.IsIndex() {
+		index, err := v1.ParseIndexManifest(bytes.NewReader(b))
+		if err != nil {
+			return nil, v1.Descriptor{}, fmt.Errorf("parsing index %s: %v", desc.Digest, err)
+		}
+		subject, annotations, artifactType = index.Subject, index.Annotations, index.ArtifactType
+	} else {
+		manifest, err := v1.ParseManifest(bytes.NewReader(b))
+		if err != nil {
+			return nil, v1.Descriptor{}, fmt.Errorf("parsing manifest %s: %v", desc.Digest, err)
+		}
+		subject, annotations, artifactType = manifest.Subject, manifest.Annotations, manifest.ArtifactType
+		// Per the spec, the artifactType falls back to the config's mediaType.
+		if artifactType == "" {
+			artifactType = string(manifest.Config.MediaType)
+		}
+	}
+	return subject, v1.Descriptor{
+		MediaType:    desc.MediaType,
+		Size:         desc.Size,
+		Digest:       desc.Digest,
+		Annotations:  annotations,
+		ArtifactType: artifactType,
+	}, nil
+}
+
+// addReferrer adds desc to the referrers index of its subject, if it has one.
+func (l Path) addReferrer(desc v1.Descriptor) error {
+	subject, ref, err := l.referrer(desc)
+	if err != nil || subject == nil {
+		return err
+	}
+	return l.updateReferrers(subject.Digest, func(manifests []v1.Descriptor) []v1.Descriptor {
+		return append(withoutDigest(manifests, ref.Digest), ref)
+	})
+}
+
+// removeReferrer removes desc from the referrers index of its subject, if it
+// has one.
+func (l Path) removeReferrer(desc v1.Descriptor) error {
+	subject, ref, err := l.referrer(desc)
+	if os.IsNotExist(err) {
+		// The manifest is gone, so we can't tell what it refers to.
+		return nil
+	} else if err != nil || subject == nil {
+		return err
+	}
+	return l.updateReferrers(subject.Digest, func(manifests []v1.Descriptor) []v1.Descriptor {
+		return withoutDigest(manifests, ref.Digest)
+	})
+}
+
+func withoutDigest(manifests []v1.Descriptor, h v1.Hash) []v1.Descriptor {
+	out := []v1.Descriptor{}
+	for _, desc := range manifests {
+		if desc.Digest != h {
+			out = append(out, desc)
+		}
+	}
+	return out
+}
+
+// updateReferrers writes the referrers index of subject, as changed by update,
+// and points index.json to it. If no referrers are left, index.json no longer
+// refers to it; the old index blob is left for GarbageCollect.
+func (l Path) updateReferrers(subject v1.Hash, update func([]v1.Descriptor) []v1.Descriptor) error {
+	ii, err := l.ImageIndex()
+	if err != nil {
+		return err
+	}
+	index, err := ii.IndexManifest()
+	if err != nil {
+		return err
+	}
+
+	referrers := &v1.IndexManifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIImageIndex,
+	}
+	i := findReferrers(index, subject)
+	if i >= 0 {
+		b, err := l.Bytes(index.Manifests[i].Digest)
+		if err != nil {
+			return err
+		}
+		if referrers, err = v1.ParseIndexManifest(bytes.NewReader(b)); err != nil {
+			return err
+		}
+		index.Manifests = append(index.Manifests[:i], index.Manifests[i+1:]...)
+	}
+	referrers.Manifests = update(referrers.Manifests)
+
+	if len(referrers.Manifests) != 0 {
+		b, err := json.Marshal(referrers)
+		if err != nil {
+			return err
+		}
+		h, size, err := v1.SHA256(bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		if err := l.WriteBlob(h, ioutil.NopCloser(bytes.NewReader(b))); err != nil {
+			return err
+		}
+		index.Manifests = append(index.Manifests, v1.Descriptor{
+			MediaType: types.OCIImageIndex,
+			Size:      size,
+			Digest:    h,
+			Annotations: map[string]string{
+				imagespec.AnnotationRefName: referrersName(subject),
+			},
+		})
+	}
+
+	rawIndex, err := json.MarshalIndent(index, "", "   ")
+	if err != nil {
+		return err
+	}
+	return l.WriteFile("index.json", rawIndex, os.ModePerm)
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package layout
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func referrerDigests(t *testing.T, l Path, subject v1.Hash) []v1.Hash {
+	t.Helper()
+	idx, err := l.Referrers(subject)
+	if err != nil {
+		t.Fatalf("Referrers() = %v", err)
+	}
+	m, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hs []v1.Hash
+	for _, desc := range m.Manifests {
+		hs = append(hs, desc.Digest)
+	}
+	return hs
+}
+
+func TestReferrers(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "referrers-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	l, err := Write(tmp, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.AppendImage(img); err != nil {
+		t.Fatal(err)
+	}
+	subject, err := partial.Descriptor(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := referrerDigests(t, l, subject.Digest); len(got) != 0 {
+		t.Errorf("Referrers() = %v, want none", got)
+	}
+
+	sig := mutate.ArtifactType(mutate.Subject(mutate.MediaType(empty.Image, types.OCIManifestSchema1), *subject), "application/vnd.example.sig")
+	sbom := mutate.ArtifactType(mutate.Subject(mutate.MediaType(empty.Image, types.OCIManifestSchema1), *subject), "application/vnd.example.sbom")
+	for _, a := range []v1.Image{sig, sbom} {
+		if err := l.AppendImage(a, WithReferrers()); err != nil {
+			t.Fatalf("AppendImage() = %v", err)
+		}
+	}
+	// Appending an artifact again doesn't list it twice.
+	if err := l.AppendImage(sig, WithReferrers()); err != nil {
+		t.Fatalf("AppendImage() = %v", err)
+	}
+
+	sigDigest, err := sig.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbomDigest, err := sbom.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := referrerDigests(t, l, subject.Digest)
+	if len(got) != 2 || got[0] != sbomDigest || got[1] != sigDigest {
+		t.Errorf("Referrers() = %v, want [%s %s]", got, sbomDigest, sigDigest)
+	}
+
+	ii, err := l.ImageIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := ii.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	referrers := 0
+	for _, desc := range im.Manifests {
+		if IsReferrers(desc) {
+			referrers++
+		}
+	}
+	if got, want := referrers, 1; got != want {
+		t.Errorf("IsReferrers() matched %d of %d manifests, want %d", got, len(im.Manifests), want)
+	}
+
+	idx, err := l.Referrers(subject.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if at := m.Manifests[0].ArtifactType; at != "application/vnd.example.sbom" {
+		t.Errorf("ArtifactType = %q, want %q", at, "application/vnd.example.sbom")
+	}
+	sbomImg, err := idx.Image(sbomDigest)
+	if err != nil {
+		t.Fatalf("Image(sbom) = %v", err)
+	}
+	// The empty descriptor of the artifact is written, too.
+	ls, err := sbomImg.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 1 {
+		t.Fatalf("len(Layers()) = %d, want 1", len(ls))
+	}
+	rc, err := ls[0].Compressed()
+	if err != nil {
+		t.Fatalf("Compressed(empty descriptor) = %v", err)
+	}
+	rc.Close()
+
+	if err := l.RemoveDescriptors(match.Digests(sbomDigest, sigDigest), WithReferrers()); err != nil {
+		t.Fatalf("RemoveDescriptors() = %v", err)
+	}
+	if got := referrerDigests(t, l, subject.Digest); len(got) != 0 {
+		t.Errorf("Referrers() = %v, want none after removal", got)
+	}
+
+	// Only the subject is left.
+	ii, err = l.ImageIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err = ii.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(im.Manifests) != 1 || im.Manifests[0].Digest != subject.Digest {
+		t.Errorf("index.json = %v, want only the subject", im.Manifests)
+	}
+}
@@ -17,10 +17,13 @@ package layout
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/match"
@@ -37,7 +40,7 @@ var layoutFile = `{
 // AppendImage writes a v1.Image to the Path and updates
 // the index.json to reference it.
 func (l Path) AppendImage(img v1.Image, options ...Option) error {
-	if err := l.WriteImage(img); err != nil {
+	if err := l.WriteImage(img, options...); err != nil {
 		return err
 	}
 
@@ -67,13 +70,19 @@ func (l Path) AppendImage(img v1.Image, options ...Option) error {
 		opt(&desc)
 	}
 
-	return l.AppendDescriptor(desc)
+	if err := l.AppendDescriptor(desc); err != nil {
+		return err
+	}
+	if o.referrers {
+		return l.addReferrer(desc)
+	}
+	return nil
 }
 
 // AppendIndex writes a v1.ImageIndex to the Path and updates
 // the index.json to reference it.
 func (l Path) AppendIndex(ii v1.ImageIndex, options ...Option) error {
-	if err := l.WriteIndex(ii); err != nil {
+	if err := l.WriteIndex(ii, options...); err != nil {
 		return err
 	}
 
@@ -103,7 +112,13 @@ func (l Path) AppendIndex(ii v1.ImageIndex, options ...Option) error {
 		opt(&desc)
 	}
 
-	return l.AppendDescriptor(desc)
+	if err := l.AppendDescriptor(desc); err != nil {
+		return err
+	}
+	if o.referrers {
+		return l.addReferrer(desc)
+	}
+	return nil
 }
 
 // AppendDescriptor adds a descriptor to the index.json of the Path.
@@ -131,7 +146,7 @@ func (l Path) AppendDescriptor(desc v1.Descriptor) error {
 // ReplaceImage writes a v1.Image to the Path and updates
 // the index.json to reference it, replacing any existing one that matches matcher, if found.
 func (l Path) ReplaceImage(img v1.Image, matcher match.Matcher, options ...Option) error {
-	if err := l.WriteImage(img); err != nil {
+	if err := l.WriteImage(img, options...); err != nil {
 		return err
 	}
 
@@ -141,7 +156,7 @@ func (l Path) ReplaceImage(img v1.Image, matcher match.Matcher, options ...Optio
 // ReplaceIndex writes a v1.ImageIndex to the Path and updates
 // the index.json to reference it, replacing any existing one that matches matcher, if found.
 func (l Path) ReplaceIndex(ii v1.ImageIndex, matcher match.Matcher, options ...Option) error {
-	if err := l.WriteIndex(ii); err != nil {
+	if err := l.WriteIndex(ii, options...); err != nil {
 		return err
 	}
 
@@ -182,15 +197,28 @@ func (l Path) replaceDescriptor(append mutate.Appendable, matcher match.Matcher,
 		return err
 	}
 
-	return l.WriteFile("index.json", rawIndex, os.ModePerm)
+	if err := l.WriteFile("index.json", rawIndex, os.ModePerm); err != nil {
+		return err
+	}
+	if o.referrers {
+		return l.addReferrer(*desc)
+	}
+	return nil
 }
 
 // RemoveDescriptors removes any descriptors that match the match.Matcher from the index.json of the Path.
-func (l Path) RemoveDescriptors(matcher match.Matcher) error {
+//
+// With WithReferrers, the removed artifacts are also removed from the
+// referrers index of their subject.
+func (l Path) RemoveDescriptors(matcher match.Matcher, options ...Option) error {
 	ii, err := l.ImageIndex()
 	if err != nil {
 		return err
 	}
+	before, err := ii.IndexManifest()
+	if err != nil {
+		return err
+	}
 	ii = mutate.RemoveManifests(ii, matcher)
 
 	index, err := ii.IndexManifest()
@@ -203,7 +231,23 @@ func (l Path) RemoveDescriptors(matcher match.Matcher) error {
 		return err
 	}
 
-	return l.WriteFile("index.json", rawIndex, os.ModePerm)
+	if err := l.WriteFile("index.json", rawIndex, os.ModePerm); err != nil {
+		return err
+	}
+
+	o := makeOptions(options...)
+	if !o.referrers {
+		return nil
+	}
+	for _, desc := range before.Manifests {
+		if !matcher(desc) {
+			continue
+		}
+		if err := l.removeReferrer(desc); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // WriteFile write a file with arbitrary data at an arbitrary location in a v1
@@ -221,7 +265,15 @@ func (l Path) WriteFile(name string, data []byte, perm os.FileMode) error {
 
 // WriteBlob copies a file to the blobs/ directory in the Path from the given ReadCloser at
 // blobs/{hash.Algorithm}/{hash.Hex}.
+//
+// If the blob already exists, it is trusted and not written again. The blob is
+// written to a temporary file that is renamed into place, so concurrent writers
+// of the same blob don't corrupt it, and a failed write leaves nothing behind.
 func (l Path) WriteBlob(hash v1.Hash, r io.ReadCloser) error {
+	return l.writeBlob(hash, r, makeOptions())
+}
+
+func (l Path) writeBlob(hash v1.Hash, r io.ReadCloser, o *options) error {
 	dir := l.path("blobs", hash.Algorithm)
 	if err := os.MkdirAll(dir, os.ModePerm); err != nil && !os.IsExist(err) {
 		return err
@@ -229,17 +281,77 @@ func (l Path) WriteBlob(hash v1.Hash, r io.ReadCloser) error {
 
 	file := filepath.Join(dir, hash.Hex)
 	if _, err := os.Stat(file); err == nil {
-		// Blob already exists, that's fine.
-		return nil
+		// Blob already exists, that's fine, unless it's corrupt.
+		if !o.verifyBlobs {
+			return nil
+		}
+		if err := verifyBlob(file, hash); err == nil {
+			return nil
+		}
+	}
+
+	// The name of the temporary file isn't a valid hex digest, so it's never
+	// mistaken for a blob.
+	w, err := createTemp(dir, hash.Hex)
+	if err != nil {
+		return err
+	}
+	tmp := w.Name()
+	if err := copyBlob(w, r, hash, o); err != nil {
+		// Don't leave a truncated or corrupt blob behind.
+		w.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := w.Close(); err != nil {
+		os.Remove(tmp)
+		return err
 	}
-	w, err := os.Create(file)
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// createTemp is like ioutil.TempFile, but creates the file with the same mode
+// as os.Create, subject to the umask, rather than one only the owner can read.
+func createTemp(dir, prefix string) (*os.File, error) {
+	for i := 0; i < 10000; i++ {
+		name := filepath.Join(dir, prefix+"."+strconv.FormatUint(uint64(rand.Uint32()), 10)+".tmp")
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		}
+		return f, err
+	}
+	return nil, fmt.Errorf("creating a temporary file in %s: too many attempts", dir)
+}
+
+// copyBlob copies r to w, checking that it has the given hash if o says so.
+func copyBlob(w io.Writer, r io.Reader, hash v1.Hash, o *options) error {
+	if !o.verifyBlobs {
+		_, err := io.Copy(w, r)
+		return err
+	}
+	h, _, err := v1.Compute(hash.Algorithm, io.TeeReader(r, w))
 	if err != nil {
 		return err
 	}
-	defer w.Close()
+	if h != hash {
+		return fmt.Errorf("blob has digest %s, expected %s", h, hash)
+	}
+	return nil
+}
 
-	_, err = io.Copy(w, r)
-	return err
+// verifyBlob checks that the file has the given hash.
+func verifyBlob(file string, hash v1.Hash) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return copyBlob(ioutil.Discard, f, hash, &options{verifyBlobs: true})
 }
 
 // TODO: A streaming version of WriteBlob so we don't have to know the hash
@@ -247,18 +359,26 @@ func (l Path) WriteBlob(hash v1.Hash, r io.ReadCloser) error {
 
 // TODO: For streaming layers we should write to a tmp file then Rename to the
 // final digest.
-func (l Path) writeLayer(layer v1.Layer) error {
+func (l Path) writeLayer(layer v1.Layer, o *options) error {
 	d, err := layer.Digest()
 	if err != nil {
 		return err
 	}
 
+	// Don't fetch layers that we already have.
+	if !o.verifyBlobs {
+		if _, err := os.Stat(l.path("blobs", d.Algorithm, d.Hex)); err == nil {
+			return nil
+		}
+	}
+
 	r, err := layer.Compressed()
 	if err != nil {
 		return err
 	}
+	defer r.Close()
 
-	return l.WriteBlob(d, r)
+	return l.writeBlob(d, r, o)
 }
 
 // RemoveBlob removes a file from the blobs directory in the Path
@@ -280,7 +400,13 @@ func (l Path) RemoveBlob(hash v1.Hash) error {
 // This function does *not* update the `index.json` file. If you want to write the
 // image and also update the `index.json`, call AppendImage(), which wraps this
 // and also updates the `index.json`.
-func (l Path) WriteImage(img v1.Image) error {
+//
+// Of the options, only WithBlobVerification applies.
+func (l Path) WriteImage(img v1.Image, options ...Option) error {
+	return l.writeImage(img, makeOptions(options...))
+}
+
+func (l Path) writeImage(img v1.Image, o *options) error {
 	layers, err := img.Layers()
 	if err != nil {
 		return err
@@ -291,13 +417,43 @@ func (l Path) WriteImage(img v1.Image) error {
 	for _, layer := range layers {
 		layer := layer
 		g.Go(func() error {
-			return l.writeLayer(layer)
+			return l.writeLayer(layer, o)
 		})
 	}
 	if err := g.Wait(); err != nil {
 		return err
 	}
 
+	// Write the blobs that only the manifest refers to, like the empty
+	// descriptor of an artifact without layers.
+	m, err := img.Manifest()
+	if err != nil {
+		return err
+	}
+	if len(m.Layers) != len(layers) {
+		seen := map[v1.Hash]bool{}
+		for _, layer := range layers {
+			d, err := layer.Digest()
+			if err != nil {
+				return err
+			}
+			seen[d] = true
+		}
+		for _, desc := range m.Layers {
+			if seen[desc.Digest] {
+				continue
+			}
+			seen[desc.Digest] = true
+			layer, err := img.LayerByDigest(desc.Digest)
+			if err != nil {
+				return err
+			}
+			if err := l.writeLayer(layer, o); err != nil {
+				return err
+			}
+		}
+	}
+
 	// Write the config.
 	cfgName, err := img.ConfigName()
 	if err != nil {
@@ -307,7 +463,7 @@ func (l Path) WriteImage(img v1.Image) error {
 	if err != nil {
 		return err
 	}
-	if err := l.WriteBlob(cfgName, ioutil.NopCloser(bytes.NewReader(cfgBlob))); err != nil {
+	if err := l.writeBlob(cfgName, ioutil.NopCloser(bytes.NewReader(cfgBlob)), o); err != nil {
 		return err
 	}
 
@@ -321,7 +477,7 @@ func (l Path) WriteImage(img v1.Image) error {
 		return err
 	}
 
-	return l.WriteBlob(d, ioutil.NopCloser(bytes.NewReader(manifest)))
+	return l.writeBlob(d, ioutil.NopCloser(bytes.NewReader(manifest)), o)
 }
 
 type withLayer interface {
@@ -332,7 +488,7 @@ type withBlob interface {
 	Blob(v1.Hash) (io.ReadCloser, error)
 }
 
-func (l Path) writeIndexToFile(indexFile string, ii v1.ImageIndex) error {
+func (l Path) writeIndexToFile(indexFile string, ii v1.ImageIndex, o *options) error {
 	index, err := ii.IndexManifest()
 	if err != nil {
 		return err
@@ -347,7 +503,7 @@ func (l Path) writeIndexToFile(indexFile string, ii v1.ImageIndex) error {
 			if err != nil {
 				return err
 			}
-			if err := l.WriteIndex(ii); err != nil {
+			if err := l.writeIndex(ii, o); err != nil {
 				return err
 			}
 		case types.OCIManifestSchema1, types.DockerManifestSchema2:
@@ -355,7 +511,7 @@ func (l Path) writeIndexToFile(indexFile string, ii v1.ImageIndex) error {
 			if err != nil {
 				return err
 			}
-			if err := l.WriteImage(img); err != nil {
+			if err := l.writeImage(img, o); err != nil {
 				return err
 			}
 		default:
@@ -376,7 +532,7 @@ func (l Path) writeIndexToFile(indexFile string, ii v1.ImageIndex) error {
 			if err != nil {
 				return err
 			}
-			if err := l.WriteBlob(desc.Digest, blob); err != nil {
+			if err := l.writeBlob(desc.Digest, blob, o); err != nil {
 				return err
 			}
 		}
@@ -397,7 +553,13 @@ func (l Path) writeIndexToFile(indexFile string, ii v1.ImageIndex) error {
 // This function does *not* update the `index.json` file. If you want to write the
 // index and also update the `index.json`, call AppendIndex(), which wraps this
 // and also updates the `index.json`.
-func (l Path) WriteIndex(ii v1.ImageIndex) error {
+//
+// Of the options, only WithBlobVerification applies.
+func (l Path) WriteIndex(ii v1.ImageIndex, options ...Option) error {
+	return l.writeIndex(ii, makeOptions(options...))
+}
+
+func (l Path) writeIndex(ii v1.ImageIndex, o *options) error {
 	// Always just write oci-layout file, since it's small.
 	if err := l.WriteFile("oci-layout", []byte(layoutFile), os.ModePerm); err != nil {
 		return err
@@ -409,7 +571,7 @@ func (l Path) WriteIndex(ii v1.ImageIndex) error {
 	}
 
 	indexFile := filepath.Join("blobs", h.Algorithm, h.Hex)
-	return l.writeIndexToFile(indexFile, ii)
+	return l.writeIndexToFile(indexFile, ii, o)
 
 }
 
@@ -432,5 +594,5 @@ func Write(path string, ii v1.ImageIndex) (Path, error) {
 
 	// TODO create blobs/ in case there is a blobs file which would prevent the directory from being created
 
-	return lp, lp.writeIndexToFile("index.json", ii)
+	return lp, lp.writeIndexToFile("index.json", ii, makeOptions())
 }
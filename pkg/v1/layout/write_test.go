@@ -6,15 +6,20 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/match"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
+	"golang.org/x/sync/errgroup"
 )
 
 func TestWrite(t *testing.T) {
@@ -185,6 +190,79 @@ func TestOptions(t *testing.T) {
 	}
 }
 
+func TestNestedPlatforms(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "write-index-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	l, err := Write(tmp, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A top index with a sub-index per OS, with an image per architecture.
+	arm64 := v1.Platform{Architecture: "arm64", OS: "linux"}
+	var want v1.Hash
+	var top v1.ImageIndex = empty.Index
+	for _, goos := range []string{"linux", "windows"} {
+		var sub v1.ImageIndex = empty.Index
+		for _, arch := range []string{"amd64", "arm64"} {
+			img, err := random.Image(5, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := v1.Platform{Architecture: arch, OS: goos}
+			sub = mutate.AppendManifests(sub, mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: &p}})
+			if p.Equals(arm64) {
+				if want, err = img.Digest(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		top = mutate.AppendManifests(top, mutate.IndexAddendum{Add: sub, Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: goos}}})
+	}
+	if err := l.AppendIndex(top, WithPlatform(v1.Platform{OS: "any"})); err != nil {
+		t.Fatal(err)
+	}
+
+	ii, err := l.ImageIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := ii.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := im.Manifests[0].Platform; got == nil || got.OS != "any" {
+		t.Errorf("index.json platform = %v, want any", got)
+	}
+
+	got, err := ii.ImageIndex(im.Manifests[0].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subs, err := partial.FindIndexes(got, match.NestedPlatforms(arm64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 {
+		t.Fatalf("FindIndexes(linux/arm64) = %d indexes, want 1", len(subs))
+	}
+	imgs, err := partial.FindImages(subs[0], match.Platforms(arm64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imgs) != 1 {
+		t.Fatalf("FindImages(linux/arm64) = %d images, want 1", len(imgs))
+	}
+	if got, err := imgs[0].Digest(); err != nil {
+		t.Fatal(err)
+	} else if got != want {
+		t.Errorf("FindImages(linux/arm64) = %s, want %s", got, want)
+	}
+}
+
 func TestDeduplicatedWrites(t *testing.T) {
 	lp, err := FromPath(testPath)
 	if err != nil {
@@ -463,3 +541,148 @@ func TestRemoveBlob(t *testing.T) {
 		t.Fatal("still existed after deletion")
 	}
 }
+
+func TestWriteBlobVerification(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "write-blob-verification-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	l, err := Write(tmp, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.WriteImage(img); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the config blob.
+	cfgName, err := img.ConfigName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfgFile := filepath.Join(tmp, "blobs", cfgName.Algorithm, cfgName.Hex)
+	if err := ioutil.WriteFile(cfgFile, []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// By default, existing blobs are trusted.
+	if err := l.WriteImage(img); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := l.Bytes(cfgName); err != nil || string(b) != "corrupt" {
+		t.Errorf("Bytes() = %q, %v, wanted the trusted blob", b, err)
+	}
+
+	// With verification, corrupt blobs are rewritten.
+	if err := l.WriteImage(img, WithBlobVerification()); err != nil {
+		t.Fatal(err)
+	}
+	want, err := img.RawConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := l.Bytes(cfgName); err != nil || !bytes.Equal(b, want) {
+		t.Errorf("Bytes() = %q, %v, wanted %q", b, err, want)
+	}
+
+	// Writing content that doesn't match the digest fails, without leaving
+	// anything behind.
+	hash, _, err := v1.SHA256(strings.NewReader("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.writeBlob(hash, ioutil.NopCloser(strings.NewReader("bar")), makeOptions(WithBlobVerification())); err == nil {
+		t.Error("writeBlob() = nil, wanted digest mismatch")
+	}
+	fis, err := ioutil.ReadDir(filepath.Join(tmp, "blobs", hash.Algorithm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range fis {
+		if strings.HasPrefix(fi.Name(), hash.Hex) {
+			t.Errorf("found %s after failed write", fi.Name())
+		}
+	}
+}
+
+func TestWriteBlobConcurrent(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "write-blob-concurrent-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	l := Path(tmp)
+	b := bytes.Repeat([]byte("abcdefghijklmnop"), 1<<16)
+	hash, _, err := v1.SHA256(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var g errgroup.Group
+	for i := 0; i < 10; i++ {
+		g.Go(func() error {
+			return l.WriteBlob(hash, ioutil.NopCloser(bytes.NewReader(b)))
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := l.Bytes(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, b) {
+		t.Error("concurrent writes corrupted the blob")
+	}
+	fis, err := ioutil.ReadDir(filepath.Join(tmp, "blobs", hash.Algorithm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 1 {
+		t.Errorf("found %d files, wanted only the blob", len(fis))
+	}
+}
+
+func TestWriteBlobMode(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "write-blob-mode-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	l := Path(tmp)
+	b := []byte("blob")
+	hash, _, err := v1.SHA256(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.WriteBlob(hash, ioutil.NopCloser(bytes.NewReader(b))); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.Stat(filepath.Join(tmp, "blobs", hash.Algorithm, hash.Hex))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Blobs get the same mode as other files, subject to the umask.
+	f, err := os.Create(filepath.Join(tmp, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	want, err := os.Stat(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Mode() != want.Mode() {
+		t.Errorf("blob has mode %s, want %s", got.Mode(), want.Mode())
+	}
+}
@@ -44,15 +44,53 @@ func Annotation(key, value string) Matcher {
 	}
 }
 
+// Annotations returns a match.Matcher that matches descriptors that have all
+// of the provided annotations, with the same values.
+func Annotations(annotations map[string]string) Matcher {
+	return func(desc v1.Descriptor) bool {
+		for k, v := range annotations {
+			if aValue, ok := desc.Annotations[k]; !ok || aValue != v {
+				return false
+			}
+		}
+		return true
+	}
+}
+
 // Platforms returns a match.Matcher that matches on any one of the provided platforms.
 // Ignores any descriptors that do not have a platform.
+//
+// A descriptor's platform matches if it satisfies the provided one, see
+// v1.Platform.Satisfies, so that e.g. linux/arm matches linux/arm/v7.
 func Platforms(platforms ...v1.Platform) Matcher {
 	return func(desc v1.Descriptor) bool {
 		if desc.Platform == nil {
 			return false
 		}
 		for _, platform := range platforms {
-			if desc.Platform.Equals(platform) {
+			if desc.Platform.Satisfies(platform) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// NestedPlatforms returns a match.Matcher that matches the descriptors of
+// nested indexes that might contain an image for any one of the provided
+// platforms. Ignores any descriptors that are not indexes or that do not have
+// a platform.
+//
+// The platform of a nested index only narrows down those of its children,
+// e.g. to linux, so it matches if it doesn't contradict the provided one.
+// Callers are expected to look for the image inside, e.g. with Platforms.
+func NestedPlatforms(platforms ...v1.Platform) Matcher {
+	return func(desc v1.Descriptor) bool {
+		if !desc.MediaType.IsIndex() || desc.Platform == nil {
+			return false
+		}
+		for _, platform := range platforms {
+			if overlaps(*desc.Platform, platform) {
 				return true
 			}
 		}
@@ -60,6 +98,19 @@ func Platforms(platforms ...v1.Platform) Matcher {
 	}
 }
 
+// overlaps returns whether some platform can satisfy both a and b, ignoring
+// features.
+func overlaps(a, b v1.Platform) bool {
+	agree := func(x, y string) bool {
+		return x == "" || y == "" || x == y
+	}
+	return agree(a.Architecture, b.Architecture) &&
+		agree(a.OS, b.OS) &&
+		agree(a.Variant, b.Variant) &&
+		(v1.Platform{OSVersion: a.OSVersion}.Satisfies(v1.Platform{OSVersion: b.OSVersion}) ||
+			v1.Platform{OSVersion: b.OSVersion}.Satisfies(v1.Platform{OSVersion: a.OSVersion}))
+}
+
 // MediaTypes returns a match.Matcher that matches at least one of the provided media types.
 func MediaTypes(mediaTypes ...string) Matcher {
 	mts := map[string]bool{}
@@ -64,6 +64,28 @@ func TestAnnotation(t *testing.T) {
 	}
 }
 
+func TestAnnotations(t *testing.T) {
+	desc := v1.Descriptor{Annotations: map[string]string{"foo": "bar", "baz": "quux"}}
+	tests := []struct {
+		desc        v1.Descriptor
+		annotations map[string]string
+		match       bool
+	}{
+		{desc, map[string]string{"foo": "bar"}, true},
+		{desc, map[string]string{"foo": "bar", "baz": "quux"}, true},
+		{desc, map[string]string{"foo": "bar", "baz": "bar"}, false},
+		{desc, map[string]string{"foo": "bar", "other": "bar"}, false},
+		{desc, nil, true},
+		{v1.Descriptor{}, map[string]string{"foo": "bar"}, false},
+	}
+	for i, tt := range tests {
+		f := match.Annotations(tt.annotations)
+		if match := f(tt.desc); match != tt.match {
+			t.Errorf("%d: mismatched, got %v expected %v for desc %#v annotations %v", i, match, tt.match, tt.desc, tt.annotations)
+		}
+	}
+}
+
 func TestPlatforms(t *testing.T) {
 	tests := []struct {
 		desc      v1.Descriptor
@@ -76,6 +98,10 @@ func TestPlatforms(t *testing.T) {
 		{v1.Descriptor{Platform: &v1.Platform{}}, []v1.Platform{{Architecture: "arm64", OS: "linux"}}, false},
 		{v1.Descriptor{Platform: nil}, []v1.Platform{{Architecture: "arm64", OS: "linux"}}, false},
 		{v1.Descriptor{}, []v1.Platform{{Architecture: "arm64", OS: "linux"}}, false},
+		{v1.Descriptor{Platform: &v1.Platform{Architecture: "arm", OS: "linux", Variant: "v7"}}, []v1.Platform{{Architecture: "arm", OS: "linux"}}, true},
+		{v1.Descriptor{Platform: &v1.Platform{Architecture: "arm", OS: "linux", Variant: "v7"}}, []v1.Platform{{Architecture: "arm", OS: "linux", Variant: "v6"}}, false},
+		{v1.Descriptor{Platform: &v1.Platform{Architecture: "amd64", OS: "windows", OSVersion: "10.0.17763.1879"}}, []v1.Platform{{Architecture: "amd64", OS: "windows", OSVersion: "10.0.17763.1879"}}, true},
+		{v1.Descriptor{Platform: &v1.Platform{Architecture: "amd64", OS: "windows", OSVersion: "10.0.20348.643"}}, []v1.Platform{{Architecture: "amd64", OS: "windows", OSVersion: "10.0.17763"}}, false},
 	}
 	for i, tt := range tests {
 		f := match.Platforms(tt.platforms...)
@@ -85,6 +111,29 @@ func TestPlatforms(t *testing.T) {
 	}
 }
 
+func TestNestedPlatforms(t *testing.T) {
+	tests := []struct {
+		desc      v1.Descriptor
+		platforms []v1.Platform
+		match     bool
+	}{
+		{v1.Descriptor{MediaType: types.OCIImageIndex, Platform: &v1.Platform{OS: "linux"}}, []v1.Platform{{Architecture: "arm64", OS: "linux"}}, true},
+		{v1.Descriptor{MediaType: types.DockerManifestList, Platform: &v1.Platform{OS: "linux"}}, []v1.Platform{{Architecture: "arm64", OS: "windows"}}, false},
+		{v1.Descriptor{MediaType: types.OCIImageIndex, Platform: &v1.Platform{OS: "windows", OSVersion: "10.0.17763"}}, []v1.Platform{{OS: "windows", OSVersion: "10.0.17763.1879"}}, true},
+		{v1.Descriptor{MediaType: types.OCIImageIndex, Platform: &v1.Platform{OS: "windows", OSVersion: "10.0.17763"}}, []v1.Platform{{OS: "windows", OSVersion: "10.0.20348"}}, false},
+		{v1.Descriptor{MediaType: types.OCIImageIndex, Platform: &v1.Platform{Architecture: "arm", OS: "linux"}}, []v1.Platform{{OS: "linux", Variant: "v7"}}, true},
+		{v1.Descriptor{MediaType: types.OCIImageIndex}, []v1.Platform{{Architecture: "arm64", OS: "linux"}}, false},
+		// Images don't match, see Platforms.
+		{v1.Descriptor{MediaType: types.OCIManifestSchema1, Platform: &v1.Platform{Architecture: "arm64", OS: "linux"}}, []v1.Platform{{Architecture: "arm64", OS: "linux"}}, false},
+	}
+	for i, tt := range tests {
+		f := match.NestedPlatforms(tt.platforms...)
+		if match := f(tt.desc); match != tt.match {
+			t.Errorf("%d: mismatched, got %v expected %v for desc %#v platform %#v", i, match, tt.match, tt.desc, tt.platforms)
+		}
+	}
+}
+
 func TestMediaTypes(t *testing.T) {
 	tests := []struct {
 		desc       v1.Descriptor
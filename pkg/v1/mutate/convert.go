@@ -0,0 +1,128 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// toOCI maps the media types of Docker manifests, configs and layers to their
+// OCI equivalents. OCI media types map to themselves.
+var toOCI = map[types.MediaType]types.MediaType{
+	types.DockerManifestSchema2:   types.OCIManifestSchema1,
+	types.DockerConfigJSON:        types.OCIConfigJSON,
+	types.DockerLayer:             types.OCILayer,
+	types.DockerUncompressedLayer: types.OCIUncompressedLayer,
+	types.DockerForeignLayer:      types.OCIRestrictedLayer,
+
+	types.OCIManifestSchema1:             types.OCIManifestSchema1,
+	types.OCIConfigJSON:                  types.OCIConfigJSON,
+	types.OCILayer:                       types.OCILayer,
+	types.OCILayerZStd:                   types.OCILayerZStd,
+	types.OCIUncompressedLayer:           types.OCIUncompressedLayer,
+	types.OCIRestrictedLayer:             types.OCIRestrictedLayer,
+	types.OCIUncompressedRestrictedLayer: types.OCIUncompressedRestrictedLayer,
+}
+
+// toDocker maps the media types of OCI manifests, configs and layers to their
+// Docker equivalents. Docker media types map to themselves.
+var toDocker = map[types.MediaType]types.MediaType{
+	types.OCIManifestSchema1:   types.DockerManifestSchema2,
+	types.OCIConfigJSON:        types.DockerConfigJSON,
+	types.OCILayer:             types.DockerLayer,
+	types.OCIUncompressedLayer: types.DockerUncompressedLayer,
+	types.OCIRestrictedLayer:   types.DockerForeignLayer,
+
+	types.DockerManifestSchema2:   types.DockerManifestSchema2,
+	types.DockerConfigJSON:        types.DockerConfigJSON,
+	types.DockerLayer:             types.DockerLayer,
+	types.DockerUncompressedLayer: types.DockerUncompressedLayer,
+	types.DockerForeignLayer:      types.DockerForeignLayer,
+}
+
+// ConvertToOCI returns an image with the OCI media types equivalent to the
+// Docker media types of the given image's manifest, config and layers, e.g.
+// types.OCILayer for types.DockerLayer. Foreign layers become
+// non-distributable OCI layers and keep their urls.
+//
+// The blobs are unchanged, only the manifest and thus the digest of the image
+// differ. It is an error if the image has a manifest, config or layer media
+// type without an OCI equivalent, like that of a Docker schema 1 manifest.
+func ConvertToOCI(img v1.Image) (v1.Image, error) {
+	return convert(img, toOCI, "OCI")
+}
+
+// ConvertToDocker is the inverse of ConvertToOCI. It is an error if the image
+// has a media type without a Docker equivalent, like types.OCILayerZStd or that
+// of an artifact's config.
+func ConvertToDocker(img v1.Image) (v1.Image, error) {
+	return convert(img, toDocker, "Docker")
+}
+
+func convert(img v1.Image, mts map[types.MediaType]types.MediaType, flavor string) (v1.Image, error) {
+	mt, err := img.MediaType()
+	if err != nil {
+		return nil, err
+	}
+	manifestMediaType, ok := mts[mt]
+	if !ok {
+		return nil, fmt.Errorf("cannot convert %s manifest to %s", mt, flavor)
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	configMediaType, ok := mts[m.Config.MediaType]
+	if !ok {
+		return nil, fmt.Errorf("cannot convert %s config to %s", m.Config.MediaType, flavor)
+	}
+	layerMediaTypes := map[v1.Hash]types.MediaType{}
+	for _, desc := range m.Layers {
+		lmt, ok := mts[desc.MediaType]
+		if !ok {
+			return nil, fmt.Errorf("cannot convert layer %s of type %s to %s", desc.Digest, desc.MediaType, flavor)
+		}
+		if lmt != desc.MediaType {
+			layerMediaTypes[desc.Digest] = lmt
+		}
+	}
+
+	return &image{
+		base:            img,
+		mediaType:       &manifestMediaType,
+		configMediaType: &configMediaType,
+		layerMediaTypes: layerMediaTypes,
+	}, nil
+}
+
+// mediaTypeLayer overrides the MediaType of a v1.Layer.
+type mediaTypeLayer struct {
+	v1.Layer
+	mediaType types.MediaType
+}
+
+// MediaType implements v1.Layer
+func (l *mediaTypeLayer) MediaType() (types.MediaType, error) {
+	return l.mediaType, nil
+}
+
+// Unwrap returns the underlying layer, so that remote.Write can still mount a
+// remote.MountableLayer, whose blob is the same.
+func (l *mediaTypeLayer) Unwrap() v1.Layer {
+	return l.Layer
+}
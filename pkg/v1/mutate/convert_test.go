@@ -0,0 +1,145 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate_test
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+func checkMediaTypes(t *testing.T, img v1.Image, manifest, config, layer types.MediaType) {
+	t.Helper()
+	if err := validate.Image(img); err != nil {
+		t.Fatalf("validate.Image() = %v", err)
+	}
+	if mt, err := img.MediaType(); err != nil {
+		t.Fatal(err)
+	} else if mt != manifest {
+		t.Errorf("MediaType() = %s, want %s", mt, manifest)
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Config.MediaType; got != config {
+		t.Errorf("Config.MediaType = %s, want %s", got, config)
+	}
+	for _, desc := range m.Layers {
+		if desc.MediaType != layer {
+			t.Errorf("layer %s MediaType = %s, want %s", desc.Digest, desc.MediaType, layer)
+		}
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range layers {
+		if mt, err := l.MediaType(); err != nil {
+			t.Fatal(err)
+		} else if mt != layer {
+			t.Errorf("Layer.MediaType() = %s, want %s", mt, layer)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oci, err := mutate.ConvertToOCI(img)
+	if err != nil {
+		t.Fatalf("ConvertToOCI() = %v", err)
+	}
+	checkMediaTypes(t, oci, types.OCIManifestSchema1, types.OCIConfigJSON, types.OCILayer)
+
+	docker, err := mutate.ConvertToDocker(oci)
+	if err != nil {
+		t.Fatalf("ConvertToDocker() = %v", err)
+	}
+	checkMediaTypes(t, docker, types.DockerManifestSchema2, types.DockerConfigJSON, types.DockerLayer)
+
+	want, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := docker.Digest(); err != nil {
+		t.Fatal(err)
+	} else if got != want {
+		t.Errorf("round trip Digest() = %s, want %s", got, want)
+	}
+}
+
+func TestConvertForeignLayer(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := random.Layer(1024, types.DockerForeignLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err = mutate.Append(img, mutate.Addendum{
+		Layer: layer,
+		URLs:  []string{"https://example.com/layer"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oci, err := mutate.ConvertToOCI(img)
+	if err != nil {
+		t.Fatalf("ConvertToOCI() = %v", err)
+	}
+	m, err := oci.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign := m.Layers[1]
+	if got, want := foreign.MediaType, types.OCIRestrictedLayer; got != want {
+		t.Errorf("MediaType = %s, want %s", got, want)
+	}
+	if len(foreign.URLs) != 1 {
+		t.Errorf("URLs = %v, want preserved", foreign.URLs)
+	}
+}
+
+func TestConvertUnsupported(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := random.Layer(1024, types.OCILayerZStd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err = mutate.Append(img, mutate.Addendum{Layer: layer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mutate.ConvertToDocker(img); err == nil {
+		t.Error("ConvertToDocker() with zstd layer: expected error")
+	}
+
+	if _, err := mutate.ConvertToOCI(mutate.MediaType(img, types.DockerManifestSchema1)); err == nil {
+		t.Error("ConvertToOCI() of schema 1: expected error")
+	}
+}
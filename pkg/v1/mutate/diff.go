@@ -0,0 +1,241 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ImageDiff describes the differences between two images, as returned by Diff.
+type ImageDiff struct {
+	// Layers describes the layer-level differences.
+	Layers LayerDiff `json:"layers"`
+
+	// Files describes the file-level differences between the flattened
+	// filesystems, sorted by path. It is only populated if Diff is called
+	// with WithFileDiff.
+	Files []FileDiff `json:"files,omitempty"`
+}
+
+// LayerDiff describes the differences between the layers of two images,
+// comparing them by DiffID and position.
+type LayerDiff struct {
+	// Added contains the layers at the top of b, beyond the layer count of a.
+	Added []v1.Hash `json:"added,omitempty"`
+
+	// Removed contains the layers at the top of a, beyond the layer count of b.
+	Removed []v1.Hash `json:"removed,omitempty"`
+
+	// Changed contains the positions at which both images have a layer, but
+	// not the same one.
+	Changed []LayerChange `json:"changed,omitempty"`
+}
+
+// LayerChange describes a layer position with different layers in a and b.
+type LayerChange struct {
+	Index int     `json:"index"`
+	Old   v1.Hash `json:"old"`
+	New   v1.Hash `json:"new"`
+}
+
+// FileDiff describes a path whose attributes differ between a and b.
+type FileDiff struct {
+	Path string `json:"path"`
+
+	// Old is nil if the path was added.
+	Old *FileInfo `json:"old,omitempty"`
+
+	// New is nil if the path was removed.
+	New *FileInfo `json:"new,omitempty"`
+}
+
+// FileInfo contains the attributes of a file that Diff compares.
+type FileInfo struct {
+	// Mode contains the permission and type bits.
+	Mode os.FileMode `json:"mode"`
+	Size int64       `json:"size"`
+
+	// Digest is the sha256 of the content of regular files and hardlinks.
+	Digest *v1.Hash `json:"digest,omitempty"`
+
+	// Linkname is the target of symlinks and hardlinks.
+	Linkname string `json:"linkname,omitempty"`
+}
+
+func (fi *FileInfo) equal(other *FileInfo) bool {
+	if fi.Mode != other.Mode || fi.Size != other.Size || fi.Linkname != other.Linkname {
+		return false
+	}
+	if fi.Digest == nil || other.Digest == nil {
+		return fi.Digest == other.Digest
+	}
+	return *fi.Digest == *other.Digest
+}
+
+type diffOptions struct {
+	files bool
+}
+
+// DiffOption is a functional option for Diff.
+type DiffOption func(*diffOptions)
+
+// WithFileDiff makes Diff compare the flattened filesystems of the images,
+// which requires reading every layer of both.
+func WithFileDiff() DiffOption {
+	return func(o *diffOptions) {
+		o.files = true
+	}
+}
+
+// Diff reports the differences between the images a and b.
+func Diff(a, b v1.Image, opts ...DiffOption) (*ImageDiff, error) {
+	o := &diffOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	aLayers, err := a.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("retrieving image layers: %v", err)
+	}
+	bLayers, err := b.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("retrieving image layers: %v", err)
+	}
+
+	aDiffIDs, err := diffIDs(aLayers)
+	if err != nil {
+		return nil, err
+	}
+	bDiffIDs, err := diffIDs(bLayers)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &ImageDiff{}
+	for i := 0; i < len(aDiffIDs) || i < len(bDiffIDs); i++ {
+		switch {
+		case i >= len(aDiffIDs):
+			d.Layers.Added = append(d.Layers.Added, bDiffIDs[i])
+		case i >= len(bDiffIDs):
+			d.Layers.Removed = append(d.Layers.Removed, aDiffIDs[i])
+		case aDiffIDs[i] != bDiffIDs[i]:
+			d.Layers.Changed = append(d.Layers.Changed, LayerChange{
+				Index: i,
+				Old:   aDiffIDs[i],
+				New:   bDiffIDs[i],
+			})
+		}
+	}
+
+	if !o.files {
+		return d, nil
+	}
+
+	aFiles, err := flattenedFiles(aLayers)
+	if err != nil {
+		return nil, err
+	}
+	bFiles, err := flattenedFiles(bLayers)
+	if err != nil {
+		return nil, err
+	}
+	for name, aFile := range aFiles {
+		if bFile, ok := bFiles[name]; !ok {
+			d.Files = append(d.Files, FileDiff{Path: name, Old: aFile})
+		} else if !aFile.equal(bFile) {
+			d.Files = append(d.Files, FileDiff{Path: name, Old: aFile, New: bFile})
+		}
+	}
+	for name, bFile := range bFiles {
+		if _, ok := aFiles[name]; !ok {
+			d.Files = append(d.Files, FileDiff{Path: name, New: bFile})
+		}
+	}
+	sort.Slice(d.Files, func(i, j int) bool {
+		return d.Files[i].Path < d.Files[j].Path
+	})
+
+	return d, nil
+}
+
+func diffIDs(layers []v1.Layer) ([]v1.Hash, error) {
+	hs := make([]v1.Hash, 0, len(layers))
+	for _, l := range layers {
+		h, err := l.DiffID()
+		if err != nil {
+			return nil, fmt.Errorf("getting layer diffid: %v", err)
+		}
+		hs = append(hs, h)
+	}
+	return hs, nil
+}
+
+// flattenedFiles returns the attributes of every path in the flattened
+// filesystem of layers.
+func flattenedFiles(layers []v1.Layer) (map[string]*FileInfo, error) {
+	f, err := newFlattener(layers)
+	if err != nil {
+		return nil, err
+	}
+	rc := f.reader()
+	defer rc.Close()
+
+	files := map[string]*FileInfo{}
+	tr := tar.NewReader(rc)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading tar: %v", err)
+		}
+
+		name := clean(header.Name)
+		if name == "" {
+			// Skip the root directory.
+			continue
+		}
+		fi := &FileInfo{
+			Mode: header.FileInfo().Mode(),
+			Size: header.Size,
+		}
+		switch header.Typeflag {
+		case tar.TypeReg:
+			h, _, err := v1.SHA256(tr)
+			if err != nil {
+				return nil, err
+			}
+			fi.Digest = &h
+		case tar.TypeLink:
+			// Hardlink targets precede their links in the flattened layer.
+			fi.Linkname = clean(header.Linkname)
+			if target, ok := files[fi.Linkname]; ok {
+				fi.Size = target.Size
+				fi.Digest = target.Digest
+			}
+		case tar.TypeSymlink:
+			fi.Linkname = header.Linkname
+		}
+		files[name] = fi
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate_test
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestDiffLayers(t *testing.T) {
+	base, err := random.Image(100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := random.Layer(100, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.AppendLayers(base, top)
+	if err != nil {
+		t.Fatal(err)
+	}
+	topDiffID, err := top.DiffID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := mutate.Diff(base, img)
+	if err != nil {
+		t.Fatalf("Diff() = %v", err)
+	}
+	if diff := cmp.Diff(mutate.LayerDiff{Added: []v1.Hash{topDiffID}}, d.Layers); diff != "" {
+		t.Errorf("Diff().Layers (-want +got) = %s", diff)
+	}
+	if d.Files != nil {
+		t.Errorf("Diff().Files = %v, want nil without WithFileDiff", d.Files)
+	}
+
+	d, err = mutate.Diff(img, base)
+	if err != nil {
+		t.Fatalf("Diff() = %v", err)
+	}
+	if diff := cmp.Diff(mutate.LayerDiff{Removed: []v1.Hash{topDiffID}}, d.Layers); diff != "" {
+		t.Errorf("Diff().Layers (-want +got) = %s", diff)
+	}
+
+	d, err = mutate.Diff(img, img)
+	if err != nil {
+		t.Fatalf("Diff() = %v", err)
+	}
+	if diff := cmp.Diff(mutate.LayerDiff{}, d.Layers); diff != "" {
+		t.Errorf("Diff().Layers (-want +got) = %s", diff)
+	}
+}
+
+func TestDiffFiles(t *testing.T) {
+	symlink := entry{header: tar.Header{Name: "s", Typeflag: tar.TypeSymlink, Linkname: "a/x"}}
+	common := layerFromEntries(t,
+		dir("a/"),
+		file("a/x", "abc"),
+		file("a/y", "hello"),
+		file("a/z", "zzz"),
+		symlink,
+	)
+	old := layerFromEntries(t,
+		file("keep", "k"),
+	)
+	executable := file("a/x", "abc")
+	executable.header.Mode = 0755
+	changed := layerFromEntries(t,
+		executable,
+		file("a/y", "jello"),
+		file("a/.wh.z", ""),
+		file("a/n", "new"),
+		link("h", "a/y"),
+	)
+
+	a, err := mutate.AppendLayers(empty.Image, common, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := mutate.AppendLayers(empty.Image, common, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := mutate.Diff(a, b, mutate.WithFileDiff())
+	if err != nil {
+		t.Fatalf("Diff() = %v", err)
+	}
+
+	oldDiffID, err := old.DiffID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	changedDiffID, err := changed.DiffID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLayers := mutate.LayerDiff{
+		Changed: []mutate.LayerChange{{Index: 1, Old: oldDiffID, New: changedDiffID}},
+	}
+	if diff := cmp.Diff(wantLayers, d.Layers); diff != "" {
+		t.Errorf("Diff().Layers (-want +got) = %s", diff)
+	}
+
+	hash := func(content string) *v1.Hash {
+		h, _, err := v1.SHA256(strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &h
+	}
+	wantFiles := []mutate.FileDiff{{
+		Path: "a/n",
+		New:  &mutate.FileInfo{Mode: 0644, Size: 3, Digest: hash("new")},
+	}, {
+		// Permission-only change.
+		Path: "a/x",
+		Old:  &mutate.FileInfo{Mode: 0644, Size: 3, Digest: hash("abc")},
+		New:  &mutate.FileInfo{Mode: 0755, Size: 3, Digest: hash("abc")},
+	}, {
+		// Content change without a size change.
+		Path: "a/y",
+		Old:  &mutate.FileInfo{Mode: 0644, Size: 5, Digest: hash("hello")},
+		New:  &mutate.FileInfo{Mode: 0644, Size: 5, Digest: hash("jello")},
+	}, {
+		Path: "a/z",
+		Old:  &mutate.FileInfo{Mode: 0644, Size: 3, Digest: hash("zzz")},
+	}, {
+		Path: "h",
+		New:  &mutate.FileInfo{Size: 5, Digest: hash("jello"), Linkname: "a/y"},
+	}, {
+		Path: "keep",
+		Old:  &mutate.FileInfo{Mode: 0644, Size: 1, Digest: hash("k")},
+	}}
+	if diff := cmp.Diff(wantFiles, d.Files); diff != "" {
+		t.Errorf("Diff().Files (-want +got) = %s", diff)
+	}
+
+	// The diff can be serialized for tooling.
+	b2, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v", err)
+	}
+	var got mutate.ImageDiff
+	if err := json.Unmarshal(b2, &got); err != nil {
+		t.Fatalf("json.Unmarshal() = %v", err)
+	}
+	if diff := cmp.Diff(*d, got); diff != "" {
+		t.Errorf("JSON round trip (-want +got) = %s", diff)
+	}
+	if !strings.Contains(string(b2), `"path":"a/x"`) {
+		t.Errorf("json.Marshal() = %s, want a/x path", b2)
+	}
+}
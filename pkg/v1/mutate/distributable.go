@@ -0,0 +1,82 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate
+
+import (
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// distributable maps the media types of non-distributable (foreign) layers to
+// their distributable equivalents.
+var distributable = map[types.MediaType]types.MediaType{
+	types.DockerForeignLayer:             types.DockerLayer,
+	types.OCIRestrictedLayer:             types.OCILayer,
+	types.OCIUncompressedRestrictedLayer: types.OCIUncompressedLayer,
+}
+
+// Distributable returns a new v1.Image in which the non-distributable
+// (foreign) layers of img are regular layers: their media types are replaced
+// by the distributable equivalents, e.g. types.DockerLayer for
+// types.DockerForeignLayer, and their urls are removed, so that clients fetch
+// them from the registry the image is pushed to, like the other layers.
+//
+// This is meant for mirroring images with foreign layers, e.g. Windows base
+// images, to a private registry, together with remote.WithNondistributable to
+// upload the layers. The layers themselves don't change, but the image gets a
+// new digest, since its manifest does.
+func Distributable(img v1.Image) (v1.Image, error) {
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	layerMediaTypes := map[v1.Hash]types.MediaType{}
+	layerURLs := map[v1.Hash][]string{}
+	for _, desc := range m.Layers {
+		mt, ok := distributable[desc.MediaType]
+		if !ok {
+			continue
+		}
+		layerMediaTypes[desc.Digest] = mt
+		if len(desc.URLs) != 0 {
+			layerURLs[desc.Digest] = nil
+		}
+	}
+	if len(layerMediaTypes) == 0 {
+		return img, nil
+	}
+	return &image{
+		base:            img,
+		layerMediaTypes: layerMediaTypes,
+		layerURLs:       layerURLs,
+	}, nil
+}
+
+// IndexDistributable is like Distributable, but for the images in base,
+// recursively. Those with foreign layers get new digests, so their descriptors
+// in the new index are updated, keeping their platforms and annotations.
+func IndexDistributable(base v1.ImageIndex) (v1.ImageIndex, error) {
+	replace, err := rewriteChildren(base, Distributable, IndexDistributable)
+	if err != nil {
+		return nil, err
+	}
+	if len(replace) == 0 {
+		return base, nil
+	}
+	return &index{
+		base:    base,
+		replace: replace,
+	}, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate_test
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+func TestDistributable(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fl, err := random.Layer(1024, types.DockerLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := mutate.Append(base, mutate.Addendum{
+		Layer:     fl,
+		MediaType: types.DockerForeignLayer,
+		URLs:      []string{"https://mcr.microsoft.com/layer"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := mutate.Distributable(foreign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validate.Image(img); err != nil {
+		t.Fatalf("validate.Image() = %v", err)
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := fl.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := m.Layers[1]
+	if got.Digest != want {
+		t.Errorf("layer digest = %s, want %s", got.Digest, want)
+	}
+	if got.MediaType != types.DockerLayer {
+		t.Errorf("layer media type = %s, want %s", got.MediaType, types.DockerLayer)
+	}
+	if len(got.URLs) != 0 {
+		t.Errorf("layer urls = %v, want none", got.URLs)
+	}
+	l, err := img.LayerByDigest(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mt, err := l.MediaType(); err != nil {
+		t.Fatal(err)
+	} else if mt != types.DockerLayer {
+		t.Errorf("layer.MediaType() = %s, want %s", mt, types.DockerLayer)
+	}
+
+	// Images without foreign layers are left alone.
+	same, err := mutate.Distributable(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same != base {
+		t.Errorf("Distributable() of image without foreign layers = %v, want %v", same, base)
+	}
+
+	idx, err := mutate.IndexDistributable(mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: base},
+		mutate.IndexAddendum{
+			Add:        foreign,
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "windows", Architecture: "amd64"}},
+		},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validate.Index(idx); err != nil {
+		t.Fatalf("validate.Index() = %v", err)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDigest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := im.Manifests[1]; got.Digest != wantDigest || got.Platform == nil || got.Platform.OS != "windows" {
+		t.Errorf("descriptor = %+v, want digest %s with platform", got, wantDigest)
+	}
+}
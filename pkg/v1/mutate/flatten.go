@@ -0,0 +1,447 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const opaqueWhiteout = whiteoutPrefix + whiteoutPrefix + ".opq"
+
+// Flatten collapses all of the layers of img into a single layer containing
+// the resulting filesystem, with whiteouts applied.
+//
+// The config's rootfs and history are rewritten to describe the single
+// flattened layer. Hardlinks whose target was removed or replaced by a later
+// layer are converted into regular files with the target's contents.
+func Flatten(img v1.Image, opts ...Option) (v1.Image, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("retrieving image layers: %v", err)
+	}
+
+	f, err := newFlattener(layers)
+	if err != nil {
+		return nil, err
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return f.reader(), nil
+	}, makeOptions(opts...).layerOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating flattened layer: %v", err)
+	}
+
+	// Start from a layerless copy of img, so that appending the flattened
+	// layer replaces the original ones.
+	base, err := withoutLayers(img)
+	if err != nil {
+		return nil, err
+	}
+	cfg := base.configFile
+
+	add := Addendum{
+		Layer: layer,
+		History: v1.History{
+			Created:   cfg.Created,
+			CreatedBy: "mutate.Flatten",
+		},
+	}
+	mt, err := img.MediaType()
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(string(mt), types.OCIVendorPrefix) {
+		add.MediaType = types.OCILayer
+	}
+
+	return Append(base, add)
+}
+
+// withoutLayers returns a copy of img without any layers or history, to
+// append replacement layers to.
+func withoutLayers(img v1.Image) (*image, error) {
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	cfg := cf.DeepCopy()
+	cfg.RootFS.DiffIDs = []v1.Hash{}
+	cfg.History = []v1.History{}
+
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	manifest := m.DeepCopy()
+	manifest.Layers = []v1.Descriptor{}
+
+	return &image{
+		base:       img,
+		manifest:   manifest,
+		configFile: cfg,
+		diffIDMap:  map[v1.Hash]v1.Layer{},
+		digestMap:  map[v1.Hash]v1.Layer{},
+		computed:   true,
+	}, nil
+}
+
+// position identifies a tar entry by its layer and its index within the layer.
+type position struct {
+	layer, entry int
+}
+
+// flattener computes which entries of which layers make it into the
+// flattened filesystem, so that the layer can be (re)written on demand.
+type flattener struct {
+	layers []v1.Layer
+
+	// survivors maps each path in the flattened filesystem to the entry
+	// that provides it, i.e. the last writer.
+	survivors map[string]position
+
+	// materialize contains the hardlinks that must be converted to regular
+	// files, because their target doesn't survive as it was.
+	materialize map[string]bool
+
+	// needed contains the targets of the hardlinks in materialize.
+	needed map[string]bool
+
+	// symlinks and hardlinks map the surviving links to their targets.
+	symlinks  map[string]string
+	hardlinks map[string]string
+
+	// included, if not nil, restricts the output to these paths, see
+	// include. implied are their parent directories that no layer has an
+	// entry for.
+	included map[string]bool
+	implied  []string
+}
+
+// newFlattener walks the layers from the top down to determine the surviving
+// entries, which requires reading every layer once.
+func newFlattener(layers []v1.Layer) (*flattener, error) {
+	f := &flattener{
+		layers:      layers,
+		survivors:   map[string]position{},
+		materialize: map[string]bool{},
+		needed:      map[string]bool{},
+		symlinks:    map[string]string{},
+		hardlinks:   map[string]string{},
+	}
+
+	// Paths whose descendants in lower layers are hidden: whited out paths,
+	// opaque directories and paths replaced by a non-directory.
+	hidden := map[string]bool{}
+	// Paths that have been whited out, hiding the path itself in lower layers.
+	deleted := map[string]bool{}
+	links := map[string]position{}
+	linknames := map[string]string{}
+
+	for i := len(layers) - 1; i >= 0; i-- {
+		// Whiteouts only apply to lower layers, so stage them until we are
+		// done with this one.
+		var pendingHidden, pendingDeleted []string
+
+		err := forEachEntry(layers[i], func(j int, header *tar.Header, _ io.Reader) error {
+			name := clean(header.Name)
+			dir, base := path.Split(name)
+			dir = clean(dir)
+
+			if hiddenBy(hidden, name) {
+				return nil
+			}
+			if base == opaqueWhiteout {
+				pendingHidden = append(pendingHidden, dir)
+				return nil
+			}
+			if strings.HasPrefix(base, whiteoutPrefix) {
+				target := path.Join(dir, base[len(whiteoutPrefix):])
+				pendingHidden = append(pendingHidden, target)
+				pendingDeleted = append(pendingDeleted, target)
+				return nil
+			}
+			if deleted[name] {
+				return nil
+			}
+			// Upper layers win; within a layer, the last entry wins.
+			if pos, ok := f.survivors[name]; ok && pos.layer != i {
+				return nil
+			}
+
+			pos := position{layer: i, entry: j}
+			f.survivors[name] = pos
+			if header.Typeflag == tar.TypeLink {
+				links[name] = pos
+				linknames[name] = clean(header.Linkname)
+			} else {
+				delete(links, name)
+			}
+			if header.Typeflag == tar.TypeSymlink {
+				f.symlinks[name] = header.Linkname
+			} else {
+				delete(f.symlinks, name)
+			}
+			if header.Typeflag != tar.TypeDir {
+				pendingHidden = append(pendingHidden, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range pendingHidden {
+			hidden[name] = true
+		}
+		for _, name := range pendingDeleted {
+			deleted[name] = true
+		}
+	}
+
+	// A hardlink remains valid as long as its target survives from the same
+	// or a lower layer, since then nothing has touched the target since the
+	// link was created.
+	for name, pos := range links {
+		target := linknames[name]
+		f.hardlinks[name] = target
+		if tpos, ok := f.survivors[target]; !ok || tpos.layer > pos.layer {
+			f.materialize[name] = true
+			f.needed[target] = true
+		}
+	}
+
+	return f, nil
+}
+
+// maxSymlinks is how many symlinks resolve follows, like Linux' MAXSYMLINKS.
+const maxSymlinks = 40
+
+// resolve follows the symlinks in the flattened filesystem along name, which
+// must be clean. It returns the symlinks it followed and the resolved path.
+func (f *flattener) resolve(name string) (followed []string, resolved string) {
+	parts := strings.Split(name, "/")
+	for len(parts) != 0 {
+		next := path.Join(resolved, parts[0])
+		parts = parts[1:]
+		target, ok := f.symlinks[next]
+		if !ok || len(followed) == maxSymlinks {
+			resolved = next
+			continue
+		}
+		followed = append(followed, next)
+		if !path.IsAbs(target) {
+			target = path.Join(resolved, target)
+		}
+		parts = append(strings.Split(clean(target), "/"), parts...)
+		resolved = ""
+	}
+	return followed, resolved
+}
+
+// include restricts the flattened filesystem to the given paths and their
+// descendants, following symlinks along the paths, and the parent directories
+// of all of them.
+func (f *flattener) include(prefixes []string) {
+	f.included = map[string]bool{}
+	implied := map[string]bool{}
+	add := func(name string) {
+		f.included[name] = true
+		for dir := clean(path.Dir(name)); dir != ""; dir = clean(path.Dir(dir)) {
+			if _, ok := f.survivors[dir]; ok {
+				f.included[dir] = true
+			} else {
+				implied[dir] = true
+			}
+		}
+	}
+
+	for _, prefix := range prefixes {
+		followed, resolved := f.resolve(clean(prefix))
+		for _, name := range followed {
+			add(name)
+		}
+		for name := range f.survivors {
+			if resolved == "" || name == resolved || strings.HasPrefix(name, resolved+"/") {
+				add(name)
+			}
+		}
+	}
+
+	// Hardlinks to paths that aren't included have to become regular files.
+	for name, target := range f.hardlinks {
+		if f.included[name] && !f.included[target] {
+			f.materialize[name] = true
+			f.needed[target] = true
+		}
+	}
+
+	for dir := range implied {
+		f.implied = append(f.implied, dir)
+	}
+	sort.Strings(f.implied)
+}
+
+// write produces the flattened filesystem as tar entries. Layers are walked
+// from the bottom up so that hardlink targets are seen before their links.
+func (f *flattener) write(tw *tar.Writer) error {
+	// The current contents of hardlink targets that must be materialized.
+	contents := map[string][]byte{}
+
+	// Sorted, parents come before their children.
+	for _, dir := range f.implied {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     dir + "/",
+			Typeflag: tar.TypeDir,
+			Mode:     0755,
+		}); err != nil {
+			return err
+		}
+	}
+
+	for i, layer := range f.layers {
+		err := forEachEntry(layer, func(j int, header *tar.Header, r io.Reader) error {
+			name := clean(header.Name)
+			dir, base := path.Split(name)
+			if strings.HasPrefix(base, whiteoutPrefix) {
+				delete(contents, path.Join(clean(dir), base[len(whiteoutPrefix):]))
+				return nil
+			}
+
+			if f.needed[name] {
+				switch header.Typeflag {
+				case tar.TypeReg:
+					b, err := ioutil.ReadAll(r)
+					if err != nil {
+						return err
+					}
+					contents[name] = b
+					r = bytes.NewReader(b)
+				case tar.TypeLink:
+					if b, ok := contents[clean(header.Linkname)]; ok {
+						contents[name] = b
+					} else {
+						delete(contents, name)
+					}
+				default:
+					delete(contents, name)
+				}
+			}
+
+			if pos, ok := f.survivors[name]; !ok || pos != (position{layer: i, entry: j}) {
+				return nil
+			}
+			if f.included != nil && !f.included[name] {
+				return nil
+			}
+
+			if f.materialize[name] {
+				b, ok := contents[clean(header.Linkname)]
+				if !ok {
+					// The link was dangling in the original image, too.
+					return nil
+				}
+				hdr := *header
+				hdr.Typeflag = tar.TypeReg
+				hdr.Linkname = ""
+				hdr.Size = int64(len(b))
+				if err := tw.WriteHeader(&hdr); err != nil {
+					return err
+				}
+				_, err := tw.Write(b)
+				return err
+			}
+
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if header.Size > 0 {
+				if _, err := io.Copy(tw, r); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reader returns the flattened filesystem as a tarball.
+func (f *flattener) reader() io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := f.write(tw)
+		if err == nil {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// forEachEntry calls fn with every entry in the layer's uncompressed tarball.
+func forEachEntry(layer v1.Layer, fn func(int, *tar.Header, io.Reader) error) error {
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return fmt.Errorf("reading layer contents: %v", err)
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	for i := 0; ; i++ {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar: %v", err)
+		}
+		if err := fn(i, header, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// hiddenBy returns true if any parent of name is hidden.
+func hiddenBy(hidden map[string]bool, name string) bool {
+	for name != "" {
+		name = clean(path.Dir(name))
+		if hidden[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// clean normalizes tar entry names, so that "./foo/", "/foo" and "foo" are
+// all the same path, and the root is "".
+func clean(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
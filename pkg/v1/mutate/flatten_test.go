@@ -0,0 +1,255 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+type entry struct {
+	header  tar.Header
+	content string
+}
+
+func dir(name string) entry {
+	return entry{header: tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755}}
+}
+
+func file(name, content string) entry {
+	return entry{header: tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644}, content: content}
+}
+
+func link(name, target string) entry {
+	return entry{header: tar.Header{Name: name, Typeflag: tar.TypeLink, Linkname: target}}
+}
+
+func layerFromEntries(t *testing.T, entries ...entry) v1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := e.header
+		hdr.Size = int64(len(e.content))
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layer
+}
+
+func TestFlatten(t *testing.T) {
+	keep := file("a/keep", "keep2")
+	keep.header.Mode = 0600
+	keep.header.PAXRecords = map[string]string{"SCHILY.xattr.user.foo": "bar"}
+
+	img, err := mutate.AppendLayers(empty.Image,
+		layerFromEntries(t,
+			dir("a/"),
+			file("a/keep", "keep"),
+			file("a/gone", "gone"),
+			dir("b/"),
+			file("b/x", "x"),
+			dir("c/"),
+			file("c/old", "old"),
+			file("target", "T"),
+			link("link0", "target"),
+			file("victim", "V"),
+			link("lnk", "victim"),
+		),
+		layerFromEntries(t,
+			keep,
+			file("a/.wh.gone", ""),
+			dir("b/"),
+			file("b/.wh..wh..opq", ""),
+			file("b/y", "y"),
+			file("target", "T2"),
+			file(".wh.victim", ""),
+		),
+		layerFromEntries(t,
+			file(".wh.c", ""),
+			link("link1", "target"),
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flat, err := mutate.Flatten(img)
+	if err != nil {
+		t.Fatalf("Flatten() = %v", err)
+	}
+
+	layers, err := flat.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 1 {
+		t.Fatalf("len(Layers()) = %d, want 1", len(layers))
+	}
+	if err := validate.Layer(layers[0]); err != nil {
+		t.Errorf("validate.Layer: %v", err)
+	}
+
+	cf, err := flat.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffID, err := layers[0].DiffID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]v1.Hash{diffID}, cf.RootFS.DiffIDs); diff != "" {
+		t.Errorf("DiffIDs (-want +got) = %s", diff)
+	}
+	if len(cf.History) != 1 {
+		t.Errorf("len(History) = %d, want 1", len(cf.History))
+	}
+	m, err := flat.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Layers) != 1 {
+		t.Errorf("len(Manifest().Layers) = %d, want 1", len(m.Layers))
+	}
+
+	type got struct {
+		typeflag byte
+		mode     int64
+		content  string
+		linkname string
+		xattr    string
+	}
+	want := map[string]got{
+		"a/":     {typeflag: tar.TypeDir, mode: 0755},
+		"a/keep": {typeflag: tar.TypeReg, mode: 0600, content: "keep2", xattr: "bar"},
+		"b/":     {typeflag: tar.TypeDir, mode: 0755},
+		"b/y":    {typeflag: tar.TypeReg, mode: 0644, content: "y"},
+		"target": {typeflag: tar.TypeReg, mode: 0644, content: "T2"},
+		// The target was replaced, so the link keeps the old contents.
+		"link0": {typeflag: tar.TypeReg, content: "T"},
+		"link1": {typeflag: tar.TypeLink, linkname: "target"},
+		// The target was deleted, so the link keeps the contents.
+		"lnk": {typeflag: tar.TypeReg, content: "V"},
+	}
+
+	rc, err := layers[0].Uncompressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	entries := map[string]got{}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := entries[hdr.Name]; ok {
+			t.Errorf("duplicate entry %q", hdr.Name)
+		}
+		entries[hdr.Name] = got{
+			typeflag: hdr.Typeflag,
+			mode:     hdr.Mode,
+			content:  string(b),
+			linkname: hdr.Linkname,
+			xattr:    hdr.PAXRecords["SCHILY.xattr.user.foo"],
+		}
+	}
+	if diff := cmp.Diff(want, entries, cmp.AllowUnexported(got{})); diff != "" {
+		t.Errorf("Flatten() (-want +got) = %s", diff)
+	}
+}
+
+func TestFlattenCompressionLevel(t *testing.T) {
+	img, err := mutate.AppendLayers(empty.Image,
+		layerFromEntries(t, file("a", "a")),
+		layerFromEntries(t, file("b", "b")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def, err := mutate.Flatten(img)
+	if err != nil {
+		t.Fatalf("Flatten() = %v", err)
+	}
+	none, err := mutate.Flatten(img, mutate.WithCompressionLevel(gzip.NoCompression))
+	if err != nil {
+		t.Fatalf("Flatten(NoCompression) = %v", err)
+	}
+	if err := validate.Image(none); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+
+	defLayers, err := def.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	noneLayers, err := none.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defDigest, err := defLayers[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	noneDigest, err := noneLayers[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defDigest == noneDigest {
+		t.Errorf("Digest() = %s for both compression levels, wanted them to differ", defDigest)
+	}
+	defDiffID, err := defLayers[0].DiffID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	noneDiffID, err := noneLayers[0].DiffID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defDiffID != noneDiffID {
+		t.Errorf("DiffID() = %s, want %s", noneDiffID, defDiffID)
+	}
+}
@@ -18,9 +18,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"strings"
 
+	"github.com/google/go-containerregistry/internal/verify"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/stream"
 	"github.com/google/go-containerregistry/pkg/v1/types"
@@ -30,13 +34,20 @@ type image struct {
 	base v1.Image
 	adds []Addendum
 
-	computed    bool
-	configFile  *v1.ConfigFile
-	manifest    *v1.Manifest
-	annotations map[string]string
-	mediaType   *types.MediaType
-	diffIDMap   map[v1.Hash]v1.Layer
-	digestMap   map[v1.Hash]v1.Layer
+	computed        bool
+	configFile      *v1.ConfigFile
+	rawConfigFile   []byte
+	manifest        *v1.Manifest
+	annotations     map[string]string
+	subject         *v1.Descriptor
+	artifactType    *string
+	mediaType       *types.MediaType
+	configMediaType *types.MediaType
+	inlineMax       *int64
+	layerURLs       map[v1.Hash][]string
+	layerMediaTypes map[v1.Hash]types.MediaType
+	diffIDMap       map[v1.Hash]v1.Layer
+	digestMap       map[v1.Hash]v1.Layer
 }
 
 var _ v1.Image = (*image)(nil)
@@ -53,8 +64,30 @@ func (i *image) compute() error {
 	if i.computed {
 		return nil
 	}
+	m, err := i.base.Manifest()
+	if err != nil {
+		return err
+	}
+
+	// Artifacts keep their config as it is, and list their layers only in the
+	// manifest. Without a config, they keep the empty one.
+	configMediaType := m.Config.MediaType
+	if i.configMediaType != nil {
+		configMediaType = *i.configMediaType
+	}
+	var rawConfigFile []byte
+	if configMediaType == types.OCIEmptyJSON {
+		rawConfigFile = []byte(empty.JSON)
+	} else if configMediaType != "" && !configMediaType.IsConfig() && i.configFile == nil {
+		if rawConfigFile, err = i.base.RawConfigFile(); err != nil {
+			return err
+		}
+	}
+
 	var configFile *v1.ConfigFile
-	if i.configFile != nil {
+	if rawConfigFile != nil {
+		configFile = &v1.ConfigFile{}
+	} else if i.configFile != nil {
 		configFile = i.configFile
 	} else {
 		cf, err := i.base.ConfigFile()
@@ -81,10 +114,6 @@ func (i *image) compute() error {
 		}
 	}
 
-	m, err := i.base.Manifest()
-	if err != nil {
-		return err
-	}
 	manifest := m.DeepCopy()
 	manifestLayers := manifest.Layers
 	for _, add := range i.adds {
@@ -98,9 +127,17 @@ func (i *image) compute() error {
 			return err
 		}
 
-		// Fields in the addendum override the original descriptor.
+		// Fields in the addendum override the original descriptor. Annotations
+		// are merged, so that e.g. the estargz TOC digest of a layer survives.
 		if len(add.Annotations) != 0 {
-			desc.Annotations = add.Annotations
+			annotations := make(map[string]string, len(desc.Annotations)+len(add.Annotations))
+			for k, v := range desc.Annotations {
+				annotations[k] = v
+			}
+			for k, v := range add.Annotations {
+				annotations[k] = v
+			}
+			desc.Annotations = annotations
 		}
 		if len(add.URLs) != 0 {
 			desc.URLs = add.URLs
@@ -119,16 +156,81 @@ func (i *image) compute() error {
 
 	manifest.Layers = manifestLayers
 
-	rcfg, err := json.Marshal(configFile)
-	if err != nil {
-		return err
+	rcfg := rawConfigFile
+	if rcfg == nil {
+		if rcfg, err = json.Marshal(configFile); err != nil {
+			return err
+		}
 	}
 	d, sz, err := v1.SHA256(bytes.NewBuffer(rcfg))
 	if err != nil {
 		return err
 	}
+	if manifest.Config.Digest != d {
+		// The embedded copy of the original config is stale.
+		manifest.Config.Data = nil
+	}
 	manifest.Config.Digest = d
 	manifest.Config.Size = sz
+	if i.configMediaType != nil {
+		manifest.Config.MediaType = *i.configMediaType
+	}
+
+	if i.layerURLs != nil {
+		found := map[v1.Hash]bool{}
+		for j, desc := range manifest.Layers {
+			if urls, ok := i.layerURLs[desc.Digest]; ok {
+				manifest.Layers[j].URLs = urls
+				found[desc.Digest] = true
+			}
+		}
+		for h := range i.layerURLs {
+			if !found[h] {
+				return fmt.Errorf("setting urls: layer %s not found", h)
+			}
+		}
+	}
+
+	for j, desc := range manifest.Layers {
+		mt, ok := i.layerMediaTypes[desc.Digest]
+		if !ok {
+			continue
+		}
+		l, ok := digestMap[desc.Digest]
+		if !ok {
+			if l, err = i.base.LayerByDigest(desc.Digest); err != nil {
+				return err
+			}
+		}
+		diffID, err := l.DiffID()
+		if err != nil {
+			return err
+		}
+		l = &mediaTypeLayer{Layer: l, mediaType: mt}
+		manifest.Layers[j].MediaType = mt
+		digestMap[desc.Digest] = l
+		diffIDMap[diffID] = l
+	}
+
+	if i.inlineMax != nil {
+		if sz <= *i.inlineMax {
+			manifest.Config.Data = rcfg
+		}
+		for j, desc := range manifest.Layers {
+			if desc.Size > *i.inlineMax || desc.Data != nil {
+				continue
+			}
+			l, ok := digestMap[desc.Digest]
+			if !ok {
+				if l, err = i.base.LayerByDigest(desc.Digest); err != nil {
+					return err
+				}
+			}
+			if manifest.Layers[j].Data, err = inlineLayer(l, desc); err != nil {
+				return err
+			}
+		}
+	}
 
 	// With OCI media types, this should not be set, see discussion:
 	// https://github.com/opencontainers/image-spec/pull/795
@@ -150,7 +252,39 @@ func (i *image) compute() error {
 		}
 	}
 
+	if i.subject != nil {
+		mt, err := i.MediaType()
+		if err != nil {
+			return err
+		}
+		switch mt {
+		case types.DockerManifestSchema1, types.DockerManifestSchema1Signed:
+			return fmt.Errorf("cannot set subject on %s manifest", mt)
+		}
+		manifest.Subject = i.subject
+	}
+
+	if i.artifactType != nil {
+		mt, err := i.MediaType()
+		if err != nil {
+			return err
+		}
+		switch mt {
+		case types.DockerManifestSchema1, types.DockerManifestSchema1Signed:
+			return fmt.Errorf("cannot set artifactType on %s manifest", mt)
+		}
+		manifest.ArtifactType = *i.artifactType
+
+		// Some registries reject manifests without layers, so use the empty
+		// descriptor as the spec recommends.
+		if len(manifest.Layers) == 0 {
+			manifest.Layers = []v1.Descriptor{empty.Descriptor}
+			digestMap[empty.Descriptor.Digest] = empty.Config
+		}
+	}
+
 	i.configFile = configFile
+	i.rawConfigFile = rawConfigFile
 	i.manifest = manifest
 	i.diffIDMap = diffIDMap
 	i.digestMap = digestMap
@@ -177,6 +311,18 @@ func (i *image) Layers() ([]v1.Layer, error) {
 		return nil, err
 	}
 
+	if i.rawConfigFile != nil {
+		ls := make([]v1.Layer, 0, len(i.manifest.Layers))
+		for _, desc := range i.manifest.Layers {
+			l, err := i.LayerByDigest(desc.Digest)
+			if err != nil {
+				return nil, err
+			}
+			ls = append(ls, l)
+		}
+		return ls, nil
+	}
+
 	diffIDs, err := partial.DiffIDs(i)
 	if err != nil {
 		return nil, err
@@ -208,11 +354,15 @@ func (i *image) ConfigFile() (*v1.ConfigFile, error) {
 	return i.configFile, nil
 }
 
-// RawConfigFile returns the serialized bytes of ConfigFile()
+// RawConfigFile returns the serialized bytes of ConfigFile(), or the config
+// of artifacts as it is.
 func (i *image) RawConfigFile() ([]byte, error) {
 	if err := i.compute(); err != nil {
 		return nil, err
 	}
+	if i.rawConfigFile != nil {
+		return i.rawConfigFile, nil
+	}
 	return json.Marshal(i.configFile)
 }
 
@@ -279,3 +429,22 @@ func validate(adds []Addendum) error {
 	}
 	return nil
 }
+
+// inlineLayer returns the compressed contents of l, verified against desc,
+// to embed in desc.
+func inlineLayer(l v1.Layer, desc v1.Descriptor) ([]byte, error) {
+	rc, err := l.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	desc.Data = b
+	if err := verify.Descriptor(desc); err != nil {
+		return nil, fmt.Errorf("inlining layer %s: %w", desc.Digest, err)
+	}
+	return b, nil
+}
@@ -60,6 +60,19 @@ type index struct {
 	adds []IndexAddendum
 	// remove is removed before adds
 	remove match.Matcher
+	// subject is set on the resulting manifest, if non-nil
+	subject *v1.Descriptor
+	// annotations are merged into the resulting manifest's annotations
+	annotations map[string]string
+	// childAnnotations are merged into the descriptors that match annotateMatcher
+	annotateMatcher  match.Matcher
+	childAnnotations map[string]string
+	// platformFromConfig fills in missing platforms from the images' configs
+	platformFromConfig bool
+	// replace maps the digests of children to what replaces them in place
+	replace map[v1.Hash]partial.Describable
+	// rewriteURLs rewrites the hosts of the urls of the descriptors, see RewriteURLs
+	rewriteURLs func(host string) string
 
 	computed  bool
 	manifest  *v1.IndexManifest
@@ -125,6 +138,59 @@ func (i *index) compute() error {
 		}
 	}
 
+	for j, m := range manifests {
+		if i.rewriteURLs != nil {
+			manifests[j].URLs, _ = rewriteURLs(m.URLs, i.rewriteURLs)
+		}
+		r, ok := i.replace[m.Digest]
+		if !ok {
+			continue
+		}
+		desc, err := partial.Descriptor(r)
+		if err != nil {
+			return err
+		}
+		manifests[j].MediaType = desc.MediaType
+		manifests[j].Digest = desc.Digest
+		manifests[j].Size = desc.Size
+		manifests[j].Data = nil
+		switch r := r.(type) {
+		case v1.ImageIndex:
+			i.indexMap[desc.Digest] = r
+		case v1.Image:
+			i.imageMap[desc.Digest] = r
+		}
+	}
+
+	if i.platformFromConfig {
+		for j, m := range manifests {
+			if m.Platform != nil || !m.MediaType.IsImage() {
+				continue
+			}
+			platform, err := i.configPlatform(m.Digest)
+			if err != nil {
+				return err
+			}
+			manifests[j].Platform = platform
+		}
+	}
+
+	if i.annotateMatcher != nil {
+		for j, m := range manifests {
+			if !i.annotateMatcher(m) {
+				continue
+			}
+			annotations := make(map[string]string, len(m.Annotations)+len(i.childAnnotations))
+			for k, v := range m.Annotations {
+				annotations[k] = v
+			}
+			for k, v := range i.childAnnotations {
+				annotations[k] = v
+			}
+			manifests[j].Annotations = annotations
+		}
+	}
+
 	manifest.Manifests = manifests
 
 	// With OCI media types, this should not be set, see discussion:
@@ -137,6 +203,20 @@ func (i *index) compute() error {
 		}
 	}
 
+	if i.subject != nil {
+		manifest.Subject = i.subject
+	}
+
+	if i.annotations != nil {
+		if manifest.Annotations == nil {
+			manifest.Annotations = map[string]string{}
+		}
+
+		for k, v := range i.annotations {
+			manifest.Annotations[k] = v
+		}
+	}
+
 	i.manifest = manifest
 	i.computed = true
 	return nil
@@ -149,6 +229,27 @@ func (i *index) Image(h v1.Hash) (v1.Image, error) {
 	return i.base.Image(h)
 }
 
+// configPlatform returns the platform from the config of the image with digest
+// h, or nil if the image isn't a container image, e.g. an artifact.
+func (i *index) configPlatform(h v1.Hash) (*v1.Platform, error) {
+	img, err := i.Image(h)
+	if err != nil {
+		return nil, err
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	if mt := m.Config.MediaType; mt != types.DockerConfigJSON && mt != types.OCIConfigJSON {
+		return nil, nil
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	return cf.Platform(), nil
+}
+
 func (i *index) ImageIndex(h v1.Hash) (v1.ImageIndex, error) {
 	if idx, ok := i.indexMap[h]; ok {
 		return idx, nil
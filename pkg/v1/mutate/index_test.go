@@ -15,13 +15,17 @@
 package mutate_test
 
 import (
+	"bytes"
 	"log"
 	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/match"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
@@ -137,3 +141,222 @@ func TestAppendIndex(t *testing.T) {
 		t.Errorf("Validate() = %v", err)
 	}
 }
+
+func TestIndexSubject(t *testing.T) {
+	base, err := random.Index(1024, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := partial.Descriptor(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx := mutate.IndexSubject(base, *subject)
+	if err := validate.Index(idx); err != nil {
+		t.Fatalf("validate.Index() = %v", err)
+	}
+
+	b, err := idx.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := v1.ParseIndexManifest(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(subject, im.Subject); diff != "" {
+		t.Errorf("Subject (-want +got) = %s", diff)
+	}
+
+	want, err := base.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want.Manifests, im.Manifests); diff != "" {
+		t.Errorf("setting the subject MUST NOT mutate the manifests (-want +got) = %s", diff)
+	}
+}
+
+func TestIndexAnnotations(t *testing.T) {
+	base, err := random.Index(1024, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base = mutate.IndexAnnotations(base, map[string]string{"foo": "bar", "baz": "quux"})
+
+	idx := mutate.IndexAnnotations(base, map[string]string{"foo": "override"})
+	if err := validate.Index(idx); err != nil {
+		t.Fatalf("validate.Index() = %v", err)
+	}
+
+	im, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"foo": "override", "baz": "quux"}
+	if diff := cmp.Diff(want, im.Annotations); diff != "" {
+		t.Errorf("Annotations (-want +got) = %s", diff)
+	}
+
+	bm, err := base.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(bm.Manifests, im.Manifests); diff != "" {
+		t.Errorf("annotating MUST NOT mutate the manifests (-want +got) = %s", diff)
+	}
+}
+
+func TestChildAnnotations(t *testing.T) {
+	base, err := random.Index(1024, 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm, err := base.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	child := bm.Manifests[1].Digest
+
+	annotations := map[string]string{"foo": "bar"}
+	idx, err := mutate.ChildAnnotations(base, match.Digests(child), annotations)
+	if err != nil {
+		t.Fatalf("ChildAnnotations() = %v", err)
+	}
+	// Merged with existing annotations.
+	idx, err = mutate.ChildAnnotations(idx, match.Digests(child), map[string]string{"baz": "quux"})
+	if err != nil {
+		t.Fatalf("ChildAnnotations() = %v", err)
+	}
+	if err := validate.Index(idx); err != nil {
+		t.Fatalf("validate.Index() = %v", err)
+	}
+
+	im, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bm.DeepCopy()
+	want.Manifests[1].Annotations = map[string]string{"foo": "bar", "baz": "quux"}
+	if diff := cmp.Diff(want, im); diff != "" {
+		t.Errorf("IndexManifest() (-want +got) = %s", diff)
+	}
+
+	// The round trip through RawManifest is stable.
+	b, err := idx.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := v1.ParseIndexManifest(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt, err := mutate.ChildAnnotations(base, match.Digests(child), parsed.Manifests[1].Annotations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := rt.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, b2) {
+		t.Errorf("RawManifest() not stable: %s != %s", b, b2)
+	}
+
+	// The child itself is untouched.
+	img, err := idx.Image(child)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err := img.Digest(); err != nil || d != child {
+		t.Errorf("Image(%s).Digest() = %v, %v", child, d, err)
+	}
+
+	// Nothing matches.
+	if _, err := mutate.ChildAnnotations(base, match.Platforms(v1.Platform{OS: "plan9", Architecture: "mips"}), annotations); err == nil {
+		t.Error("ChildAnnotations(no match) = nil, want error")
+	}
+}
+
+func TestWithPlatformFromConfig(t *testing.T) {
+	platformImage := func(os, arch, variant string) v1.Image {
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cf, err := img.ConfigFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cf.OS, cf.Architecture, cf.Variant = os, arch, variant
+		img, err = mutate.ConfigFile(img, cf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img
+	}
+	amd64 := platformImage("linux", "amd64", "")
+	arm64 := platformImage("linux", "arm64", "v8")
+	explicit := platformImage("linux", "arm", "v7")
+	artifact := mutate.ArtifactType(empty.Image, "application/vnd.example")
+
+	explicitPlatform := &v1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"}
+	idx := mutate.WithPlatformFromConfig(mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: amd64},
+		mutate.IndexAddendum{Add: arm64},
+		mutate.IndexAddendum{Add: explicit, Descriptor: v1.Descriptor{Platform: explicitPlatform}},
+		mutate.IndexAddendum{Add: artifact},
+	))
+	if err := validate.Index(idx); err != nil {
+		t.Errorf("validate.Index() = %v", err)
+	}
+
+	m, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []*v1.Platform
+	for _, desc := range m.Manifests {
+		got = append(got, desc.Platform)
+	}
+	want := []*v1.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		explicitPlatform,
+		nil,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("platforms (-want +got) = %s", diff)
+	}
+
+	// The images can be selected by platform.
+	for _, img := range []v1.Image{amd64, arm64} {
+		cf, err := img.ConfigFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		found, err := partial.FindImages(idx, match.Platforms(*cf.Platform()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != 1 {
+			t.Fatalf("FindImages(%v) = %d images, want 1", cf.Platform(), len(found))
+		}
+		got, err := found[0].Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := img.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("FindImages(%v) = %s, want %s", cf.Platform(), got, want)
+		}
+	}
+}
@@ -17,14 +17,16 @@ package mutate
 import (
 	"archive/tar"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"path/filepath"
+	"path"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/google/go-containerregistry/internal/gzip"
+	"github.com/google/go-containerregistry/pkg/compression"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/match"
@@ -37,7 +39,13 @@ const whiteoutPrefix = ".wh."
 // Addendum contains layers and history to be appended
 // to a base image
 type Addendum struct {
-	Layer       v1.Layer
+	// Layer is appended to the image's layers. It may be nil if History is
+	// an empty layer, e.g. for a change to the config like ENV or CMD.
+	Layer v1.Layer
+	// History is appended to the config's history, e.g. to record who
+	// created the layer, when and how, for `docker history`. Its EmptyLayer
+	// must be set if Layer is nil. Entries are only aligned with the layers
+	// if the base image's history already is.
 	History     v1.History
 	URLs        []string
 	Annotations map[string]string
@@ -93,6 +101,23 @@ func AppendManifests(base v1.ImageIndex, adds ...IndexAddendum) v1.ImageIndex {
 	}
 }
 
+// WithPlatformFromConfig mutates the provided v1.ImageIndex to fill in the
+// platform of the image descriptors that don't have one, e.g. those appended
+// with AppendManifests, from the os, architecture, variant and os.version of
+// the images' config files. Images whose config sets neither os nor
+// architecture, like artifacts, are left without a platform.
+//
+//	idx := mutate.WithPlatformFromConfig(mutate.AppendManifests(empty.Index,
+//		mutate.IndexAddendum{Add: amd64},
+//		mutate.IndexAddendum{Add: arm64},
+//	))
+func WithPlatformFromConfig(base v1.ImageIndex) v1.ImageIndex {
+	return &index{
+		base:               base,
+		platformFromConfig: true,
+	}
+}
+
 // RemoveManifests removes any descriptors that match the match.Matcher.
 func RemoveManifests(base v1.ImageIndex, matcher match.Matcher) v1.ImageIndex {
 	return &index{
@@ -102,17 +127,85 @@ func RemoveManifests(base v1.ImageIndex, matcher match.Matcher) v1.ImageIndex {
 }
 
 // Config mutates the provided v1.Image to have the provided v1.Config
+//
+// The whole v1.Config is replaced, including fields like Healthcheck,
+// StopSignal, Shell, OnBuild and Volumes, so to change one field, modify a
+// copy of the base's config and pass that. Zero fields are omitted from the
+// resulting config file, which clears them.
 func Config(base v1.Image, cfg v1.Config) (v1.Image, error) {
 	cf, err := base.ConfigFile()
 	if err != nil {
 		return nil, err
 	}
 
+	// Don't modify the config file of base, which may be cached.
+	cf = cf.DeepCopy()
 	cf.Config = cfg
 
 	return ConfigFile(base, cf)
 }
 
+// Labels mutates the provided v1.Image to have the provided labels in its
+// config. If merge is true, they are merged into the labels it already has,
+// and a label whose value is "" is removed instead. Otherwise, they replace
+// all of its labels.
+func Labels(base v1.Image, labels map[string]string, merge bool) (v1.Image, error) {
+	cf, err := base.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't modify the config file of base, which may be cached.
+	cf = cf.DeepCopy()
+	if !merge {
+		cf.Config.Labels = make(map[string]string, len(labels))
+	} else if cf.Config.Labels == nil {
+		cf.Config.Labels = map[string]string{}
+	}
+	for k, v := range labels {
+		if merge && v == "" {
+			delete(cf.Config.Labels, k)
+			continue
+		}
+		cf.Config.Labels[k] = v
+	}
+	if len(cf.Config.Labels) == 0 {
+		cf.Config.Labels = nil
+	}
+
+	return ConfigFile(base, cf)
+}
+
+// AnnotationsFromLabels mutates the provided v1.Image to have the labels in
+// its config whose keys have one of the given prefixes as annotations of its
+// manifest, too, so that clients can see them without fetching the config.
+// Without prefixes, the labels of the pre-defined annotation keys, like
+// "org.opencontainers.image.source", are copied, see:
+// https://github.com/opencontainers/image-spec/blob/master/annotations.md
+func AnnotationsFromLabels(base v1.Image, prefixes ...string) (v1.Image, error) {
+	cf, err := base.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if len(prefixes) == 0 {
+		prefixes = []string{"org.opencontainers.image."}
+	}
+
+	annotations := map[string]string{}
+	for k, v := range cf.Config.Labels {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(k, prefix) {
+				annotations[k] = v
+				break
+			}
+		}
+	}
+	if len(annotations) == 0 {
+		return base, nil
+	}
+	return Annotations(base, annotations), nil
+}
+
 // Annotations mutates the provided v1.Image to have the provided annotations
 func Annotations(base v1.Image, annotations map[string]string) v1.Image {
 	return &image{
@@ -121,12 +214,88 @@ func Annotations(base v1.Image, annotations map[string]string) v1.Image {
 	}
 }
 
+// Subject mutates the provided v1.Image to refer to the given subject
+// descriptor, e.g. to attach a signature or SBOM to another image.
+//
+// Schema 1 images have no notion of a subject, so they will produce an error
+// when the result is accessed.
+func Subject(base v1.Image, subject v1.Descriptor) v1.Image {
+	return &image{
+		base:    base,
+		subject: &subject,
+	}
+}
+
+// ArtifactType mutates the provided v1.Image to have the given artifactType,
+// which tells clients what kind of artifact, e.g. a signature or an SBOM, the
+// manifest describes.
+//
+// An artifact without layers gets the empty descriptor as its only layer, so
+// apply ArtifactType after appending any layers.
+func ArtifactType(base v1.Image, mt string) v1.Image {
+	return &image{
+		base:         base,
+		artifactType: &mt,
+	}
+}
+
+// IndexSubject mutates the provided v1.ImageIndex to refer to the given
+// subject descriptor.
+func IndexSubject(base v1.ImageIndex, subject v1.Descriptor) v1.ImageIndex {
+	return &index{
+		base:    base,
+		subject: &subject,
+	}
+}
+
+// IndexAnnotations mutates the provided v1.ImageIndex to have the provided
+// annotations, merged into any it already has. Unlike ChildAnnotations, only
+// the index manifest itself is annotated.
+func IndexAnnotations(base v1.ImageIndex, annotations map[string]string) v1.ImageIndex {
+	return &index{
+		base:        base,
+		annotations: annotations,
+	}
+}
+
+// ChildAnnotations mutates the provided v1.ImageIndex to merge the provided
+// annotations into the descriptors of the children that match the
+// match.Matcher, e.g. match.Digests or match.Platforms. The child manifests
+// themselves are not modified.
+//
+// It returns an error if no child of the index matches.
+func ChildAnnotations(base v1.ImageIndex, matcher match.Matcher, annotations map[string]string) (v1.ImageIndex, error) {
+	m, err := base.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, desc := range m.Manifests {
+		if matcher(desc) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errors.New("no child of the index matches")
+	}
+
+	return &index{
+		base:             base,
+		annotateMatcher:  matcher,
+		childAnnotations: annotations,
+	}, nil
+}
+
 // ConfigFile mutates the provided v1.Image to have the provided v1.ConfigFile
 func ConfigFile(base v1.Image, cfg *v1.ConfigFile) (v1.Image, error) {
 	m, err := base.Manifest()
 	if err != nil {
 		return nil, err
 	}
+	if m.Config.MediaType == types.OCIEmptyJSON {
+		return nil, errors.New("unable to set the config of an image with an empty config, see ConfigMediaType")
+	}
 
 	image := &image{
 		base:       base,
@@ -151,14 +320,21 @@ func CreatedAt(base v1.Image, created v1.Time) (v1.Image, error) {
 }
 
 // Extract takes an image and returns an io.ReadCloser containing the image's
-// flattened filesystem.
+// flattened filesystem, with whiteouts (including opaque directories) applied.
 //
 // Callers can read the filesystem contents by passing the reader to
 // tar.NewReader, or io.Copy it directly to some output.
 //
 // If a caller doesn't read the full contents, they should Close it to free up
 // resources used during extraction.
-func Extract(img v1.Image) io.ReadCloser {
+//
+// If any prefixes are given, only the paths under them are extracted, e.g.
+// "/usr/local/bin", along with their parent directories. Symlinks along the
+// prefixes are followed, so "/bin/sh" also extracts "/usr/bin/sh" if "/bin"
+// links to "/usr/bin"; symlinks under them are extracted as they are, and
+// dangle if they point elsewhere. Hardlinks to paths that aren't extracted
+// become regular files.
+func Extract(img v1.Image, prefixes ...string) io.ReadCloser {
 	pr, pw := io.Pipe()
 
 	go func() {
@@ -166,23 +342,37 @@ func Extract(img v1.Image) io.ReadCloser {
 		// extraction. These errors will be returned by the reader end
 		// on subsequent reads. If err == nil, the reader will return
 		// EOF.
-		pw.CloseWithError(extract(img, pw))
+		pw.CloseWithError(extract(img, pw, prefixes))
 	}()
 
 	return pr
 }
 
 // Adapted from https://github.com/google/containerregistry/blob/da03b395ccdc4e149e34fbb540483efce962dc64/client/v2_2/docker_image_.py#L816
-func extract(img v1.Image, w io.Writer) error {
+func extract(img v1.Image, w io.Writer, prefixes []string) error {
 	tarWriter := tar.NewWriter(w)
 	defer tarWriter.Close()
 
-	fileMap := map[string]bool{}
-
 	layers, err := img.Layers()
 	if err != nil {
 		return fmt.Errorf("retrieving image layers: %v", err)
 	}
+	if len(prefixes) != 0 {
+		// Following symlinks along the prefixes and materializing hardlinks
+		// needs a first pass over the layers, see flattener.
+		f, err := newFlattener(layers)
+		if err != nil {
+			return err
+		}
+		f.include(prefixes)
+		return f.write(tarWriter)
+	}
+
+	fileMap := map[string]bool{}
+	// opaque contains the directories whose contents in lower layers are
+	// hidden by an opaque whiteout.
+	opaque := map[string]bool{}
+
 	// we iterate through the layers in reverse order because it makes handling
 	// whiteout layers more efficient, since we can just keep track of the removed
 	// files as we see .wh. layers and ignore those in previous layers.
@@ -194,6 +384,9 @@ func extract(img v1.Image, w io.Writer) error {
 		}
 		defer layerReader.Close()
 		tarReader := tar.NewReader(layerReader)
+
+		// Opaque whiteouts only apply to lower layers, not their own.
+		var opaqueDirs []string
 		for {
 			header, err := tarReader.Next()
 			if err == io.EOF {
@@ -203,28 +396,24 @@ func extract(img v1.Image, w io.Writer) error {
 				return fmt.Errorf("reading tar: %v", err)
 			}
 
-			basename := filepath.Base(header.Name)
-			dirname := filepath.Dir(header.Name)
+			name := clean(header.Name)
+			basename := path.Base(name)
+			if basename == opaqueWhiteout {
+				opaqueDirs = append(opaqueDirs, clean(path.Dir(name)))
+				continue
+			}
 			tombstone := strings.HasPrefix(basename, whiteoutPrefix)
 			if tombstone {
-				basename = basename[len(whiteoutPrefix):]
+				name = clean(path.Join(path.Dir(name), basename[len(whiteoutPrefix):]))
 			}
 
 			// check if we have seen value before
-			// if we're checking a directory, don't filepath.Join names
-			var name string
-			if header.Typeflag == tar.TypeDir {
-				name = header.Name
-			} else {
-				name = filepath.Join(dirname, basename)
-			}
-
 			if _, ok := fileMap[name]; ok {
 				continue
 			}
 
-			// check for a whited out parent directory
-			if inWhiteoutDir(fileMap, name) {
+			// check for a whited out or opaque parent directory
+			if hiddenBy(fileMap, name) || hiddenBy(opaque, name) {
 				continue
 			}
 
@@ -232,7 +421,9 @@ func extract(img v1.Image, w io.Writer) error {
 			// any entries with a matching (or child) name
 			fileMap[name] = tombstone || !(header.Typeflag == tar.TypeDir)
 			if !tombstone {
-				tarWriter.WriteHeader(header)
+				if err := tarWriter.WriteHeader(header); err != nil {
+					return err
+				}
 				if header.Size > 0 {
 					if _, err := io.Copy(tarWriter, tarReader); err != nil {
 						return err
@@ -240,30 +431,17 @@ func extract(img v1.Image, w io.Writer) error {
 				}
 			}
 		}
-	}
-	return nil
-}
-
-func inWhiteoutDir(fileMap map[string]bool, file string) bool {
-	for {
-		if file == "" {
-			break
+		for _, dir := range opaqueDirs {
+			opaque[dir] = true
 		}
-		dirname := filepath.Dir(file)
-		if file == dirname {
-			break
-		}
-		if val, ok := fileMap[dirname]; ok && val {
-			return true
-		}
-		file = dirname
 	}
-	return false
+	return nil
 }
 
 // Time sets all timestamps in an image to the given timestamp.
-func Time(img v1.Image, t time.Time) (v1.Image, error) {
+func Time(img v1.Image, t time.Time, opts ...Option) (v1.Image, error) {
 	newImage := empty.Image
+	o := makeOptions(opts...)
 
 	layers, err := img.Layers()
 	if err != nil {
@@ -273,7 +451,7 @@ func Time(img v1.Image, t time.Time) (v1.Image, error) {
 	// Strip away all timestamps from layers
 	var newLayers []v1.Layer
 	for _, layer := range layers {
-		newLayer, err := layerTime(layer, t)
+		newLayer, err := layerTime(layer, t, o)
 		if err != nil {
 			return nil, fmt.Errorf("setting layer times: %v", err)
 		}
@@ -306,15 +484,59 @@ func Time(img v1.Image, t time.Time) (v1.Image, error) {
 	// Strip away timestamps from the config file
 	cfg.Created = v1.Time{Time: t}
 
-	for _, h := range cfg.History {
-		h.Created = v1.Time{Time: t}
+	for i := range cfg.History {
+		cfg.History[i].Created = v1.Time{Time: t}
 	}
 
 	return ConfigFile(newImage, cfg)
 }
 
-func layerTime(layer v1.Layer, t time.Time) (v1.Layer, error) {
-	layerReader, err := layer.Uncompressed()
+// CanonicalizeTimestamps sets all timestamps in an image to t, for
+// reproducible builds: the config's created time, the created time of every
+// history entry, and the modification time of every entry in every layer.
+// Access and change times, which only PAX and GNU tars record, are set to t
+// where present.
+//
+// Unlike Time, the rest of the config, the history and the media types are
+// kept. The same image contents always produce the same image, byte for byte.
+func CanonicalizeTimestamps(img v1.Image, t time.Time, opts ...Option) (v1.Image, error) {
+	o := makeOptions(opts...)
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("getting image layers: %v", err)
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("getting original config file: %v", err)
+	}
+	adds := createAddendums(0, 0, cf.History, layers)
+	for i, add := range adds {
+		adds[i].History.Created = v1.Time{Time: t}
+		if add.Layer == nil {
+			continue
+		}
+		layer, err := layerTime(add.Layer, t, o)
+		if err != nil {
+			return nil, fmt.Errorf("setting layer times: %v", err)
+		}
+		adds[i].Layer = layer
+	}
+
+	base, err := withoutLayers(img)
+	if err != nil {
+		return nil, err
+	}
+	base.configFile.Created = v1.Time{Time: t}
+	return Append(base, adds...)
+}
+
+// paxTimes are the PAX records that hold timestamps. Those for the typed
+// header fields are ignored when writing, but would stick around in
+// PAXRecords.
+var paxTimes = []string{"mtime", "atime", "ctime", "LIBARCHIVE.creationtime"}
+
+func layerTime(original v1.Layer, t time.Time, o *options) (v1.Layer, error) {
+	layerReader, err := original.Uncompressed()
 	if err != nil {
 		return nil, fmt.Errorf("getting layer: %v", err)
 	}
@@ -334,14 +556,22 @@ func layerTime(layer v1.Layer, t time.Time) (v1.Layer, error) {
 		}
 
 		header.ModTime = t
+		if !header.AccessTime.IsZero() {
+			header.AccessTime = t
+		}
+		if !header.ChangeTime.IsZero() {
+			header.ChangeTime = t
+		}
+		for _, k := range paxTimes {
+			delete(header.PAXRecords, k)
+		}
 		if err := tarWriter.WriteHeader(header); err != nil {
 			return nil, fmt.Errorf("writing tar header: %v", err)
 		}
 
-		if header.Typeflag == tar.TypeReg {
-			if _, err = io.Copy(tarWriter, tarReader); err != nil {
-				return nil, fmt.Errorf("writing layer file: %v", err)
-			}
+		// Header-only entries, like symlinks, have no contents to copy.
+		if _, err = io.Copy(tarWriter, tarReader); err != nil {
+			return nil, fmt.Errorf("writing layer file: %v", err)
 		}
 	}
 
@@ -350,11 +580,24 @@ func layerTime(layer v1.Layer, t time.Time) (v1.Layer, error) {
 	}
 
 	b := w.Bytes()
-	// gzip the contents, then create the layer
+	// tarball compresses the contents when creating the layer.
 	opener := func() (io.ReadCloser, error) {
-		return gzip.ReadCloser(ioutil.NopCloser(bytes.NewReader(b))), nil
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+
+	// Preserve zstd compression of the original layer.
+	mt, err := original.MediaType()
+	if err != nil {
+		return nil, fmt.Errorf("getting layer media type: %v", err)
 	}
-	layer, err = tarball.LayerFromOpener(opener)
+	var opts []tarball.LayerOption
+	if mt == types.OCILayerZStd {
+		opts = append(opts, tarball.WithCompression(compression.ZStd))
+	} else if o.ociLayers || strings.Contains(string(mt), types.OCIVendorPrefix) {
+		opts = append(opts, tarball.WithMediaType(types.OCILayer))
+	}
+
+	layer, err := tarball.LayerFromOpener(opener, append(opts, o.layerOpts...)...)
 	if err != nil {
 		return nil, fmt.Errorf("creating layer: %v", err)
 	}
@@ -362,12 +605,29 @@ func layerTime(layer v1.Layer, t time.Time) (v1.Layer, error) {
 	return layer, nil
 }
 
-// Canonical is a helper function to combine Time and configFile
-// to remove any randomness during a docker build.
-func Canonical(img v1.Image) (v1.Image, error) {
+// Canonical normalizes img, so that images built from the same inputs have
+// the same digest, no matter when, where or by which tool they were built:
+//
+//   - All timestamps are zeroed, as by Time: the config's created time, the
+//     created time of every history entry and the modification time of every
+//     entry in every layer.
+//   - The history is replaced by one entry per layer, without any of the
+//     original created_by, author or comment fields, as by Time.
+//   - The manifest, config and layers get OCI media types. Layers compressed
+//     with zstd stay zstd, all others are gzip.
+//   - The host-dependent container, docker_version and config.Hostname fields
+//     are cleared. container_config isn't part of v1.ConfigFile, so it is
+//     always dropped.
+//   - config.Env is sorted by variable name, keeping the order of variables
+//     set more than once. config.Labels, like all maps, are always written
+//     sorted by key.
+//
+// The architecture, OS, OS version and the rest of config are kept.
+func Canonical(img v1.Image, opts ...Option) (v1.Image, error) {
 	// Set all timestamps to 0
 	created := time.Time{}
-	img, err := Time(img, created)
+	opts = append(opts, func(o *options) { o.ociLayers = true })
+	img, err := Time(img, created, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -384,7 +644,21 @@ func Canonical(img v1.Image) (v1.Image, error) {
 	cfg.Config.Hostname = ""
 	cfg.DockerVersion = ""
 
-	return ConfigFile(img, cfg)
+	sort.SliceStable(cfg.Config.Env, func(i, j int) bool {
+		return envName(cfg.Config.Env[i]) < envName(cfg.Config.Env[j])
+	})
+
+	img, err = ConfigFile(img, cfg)
+	if err != nil {
+		return nil, err
+	}
+	img = MediaType(img, types.OCIManifestSchema1)
+	return ConfigMediaType(img, types.OCIConfigJSON), nil
+}
+
+// envName returns the name of the variable set by an Env entry "NAME=value".
+func envName(env string) string {
+	return strings.SplitN(env, "=", 2)[0]
 }
 
 // MediaType modifies the MediaType() of the given image.
@@ -395,6 +669,48 @@ func MediaType(img v1.Image, mt types.MediaType) v1.Image {
 	}
 }
 
+// InlineData embeds the contents of the config and of the layers of the given
+// image that are at most maxSize bytes in the Data field of their descriptors,
+// so that clients can read them without fetching the blobs.
+//
+// The inlined layers are read and verified against their digests. Since the
+// manifest grows by more than the size of the inlined blobs, maxSize should be
+// small, e.g. a few kilobytes. The blobs are still written as usual.
+func InlineData(img v1.Image, maxSize int64) v1.Image {
+	return &image{
+		base:      img,
+		inlineMax: &maxSize,
+	}
+}
+
+// LayerURLs sets the urls of the descriptor of the layer with the given digest
+// in the Manifest() of the given image, replacing any it had, i.e. the
+// locations clients can fetch a foreign layer from, like the Microsoft-hosted
+// base layers of Windows images.
+//
+// Layers with a non-distributable media type, e.g.
+// types.DockerForeignLayer, are not uploaded by remote.Write, so clients fetch
+// them from their urls.
+func LayerURLs(img v1.Image, layer v1.Hash, urls ...string) v1.Image {
+	return &image{
+		base:      img,
+		layerURLs: map[v1.Hash][]string{layer: urls},
+	}
+}
+
+// ConfigMediaType modifies the MediaType of the config descriptor in the
+// Manifest() of the given image.
+//
+// With types.OCIEmptyJSON, the config becomes empty.Descriptor, for artifacts
+// that have no config, and stays empty when the image is mutated further.
+// Setting its config, e.g. with ConfigFile, is an error.
+func ConfigMediaType(img v1.Image, mt types.MediaType) v1.Image {
+	return &image{
+		base:            img,
+		configMediaType: &mt,
+	}
+}
+
 // IndexMediaType modifies the MediaType() of the given index.
 func IndexMediaType(idx v1.ImageIndex, mt types.MediaType) v1.ImageIndex {
 	return &index{
@@ -17,21 +17,26 @@ package mutate_test
 import (
 	"archive/tar"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/compression"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/match"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/stream"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
@@ -83,6 +88,173 @@ func TestExtractOverwrittenFile(t *testing.T) {
 	}
 }
 
+func TestExtractOpaqueAndOverwrittenTypes(t *testing.T) {
+	symlink := entry{header: tar.Header{Name: "file", Typeflag: tar.TypeSymlink, Linkname: "dir/new"}}
+
+	img, err := mutate.AppendLayers(empty.Image,
+		layerFromEntries(t,
+			dir("dir/"),
+			file("dir/old", "old"),
+			file("file", "file"),
+			file("becomesdir", "file"),
+			dir("becomesfile/"),
+			file("becomesfile/child", "child"),
+		),
+		layerFromEntries(t,
+			file("dir/.wh..wh..opq", ""),
+			file("dir/new", "new"),
+			symlink,
+			dir("becomesdir/"),
+			file("becomesfile", "file"),
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]byte{
+		"dir/":        tar.TypeDir,
+		"dir/new":     tar.TypeReg,
+		"file":        tar.TypeSymlink,
+		"becomesdir/": tar.TypeDir,
+		"becomesfile": tar.TypeReg,
+	}
+	got := map[string]byte{}
+	tr := tar.NewReader(mutate.Extract(img))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[header.Name] = header.Typeflag
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Extract() (-want +got) = %s", diff)
+	}
+}
+
+func TestExtractPrefixes(t *testing.T) {
+	symlink := entry{header: tar.Header{Name: "bin", Typeflag: tar.TypeSymlink, Linkname: "/usr/bin"}}
+
+	img, err := mutate.AppendLayers(empty.Image,
+		layerFromEntries(t,
+			dir("usr/"),
+			dir("usr/bin/"),
+			file("usr/bin/sh", "sh"),
+			file("usr/bin/old", "old"),
+			symlink,
+			dir("etc/"),
+			file("etc/passwd", "root"),
+			link("usr/bin/hard", "etc/passwd"),
+			file("opt/tool", "tool"),
+		),
+		layerFromEntries(t,
+			file("usr/bin/.wh.old", ""),
+			file("usr/local/bin/tool", "tool"),
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type got struct {
+		typeflag byte
+		content  string
+	}
+	extract := func(prefixes ...string) ([]string, map[string]got) {
+		t.Helper()
+		var names []string
+		entries := map[string]got{}
+		tr := tar.NewReader(mutate.Extract(img, prefixes...))
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, header.Name)
+			entries[header.Name] = got{header.Typeflag, string(b)}
+		}
+		return names, entries
+	}
+
+	names, entries := extract("/bin/sh", "usr/local/bin")
+	if diff := cmp.Diff(map[string]got{
+		"usr/local/":         {tar.TypeDir, ""},
+		"usr/local/bin/":     {tar.TypeDir, ""},
+		"usr/":               {tar.TypeDir, ""},
+		"usr/bin/":           {tar.TypeDir, ""},
+		"usr/bin/sh":         {tar.TypeReg, "sh"},
+		"bin":                {tar.TypeSymlink, ""},
+		"usr/local/bin/tool": {tar.TypeReg, "tool"},
+	}, entries, cmp.AllowUnexported(got{})); diff != "" {
+		t.Errorf("Extract() (-want +got) = %s", diff)
+	}
+	// Directories that no layer has an entry for come before their children.
+	if len(names) < 2 || names[0] != "usr/local/" || names[1] != "usr/local/bin/" {
+		t.Errorf("Extract() = %v, want usr/local/ and usr/local/bin/ first", names)
+	}
+
+	// The hardlink's target isn't extracted, so it becomes a regular file.
+	_, entries = extract("usr/bin/hard")
+	if diff := cmp.Diff(map[string]got{
+		"usr/":         {tar.TypeDir, ""},
+		"usr/bin/":     {tar.TypeDir, ""},
+		"usr/bin/hard": {tar.TypeReg, "root"},
+	}, entries, cmp.AllowUnexported(got{})); diff != "" {
+		t.Errorf("Extract() (-want +got) = %s", diff)
+	}
+}
+
+// uncompressedCounter counts the calls to Uncompressed.
+type uncompressedCounter struct {
+	v1.Layer
+	calls int
+}
+
+func (l *uncompressedCounter) Uncompressed() (io.ReadCloser, error) {
+	l.calls++
+	return l.Layer.Uncompressed()
+}
+
+func TestExtractSinglePass(t *testing.T) {
+	bottom := &uncompressedCounter{Layer: layerFromEntries(t, file("bottom", "bottom"))}
+	top := &uncompressedCounter{Layer: layerFromEntries(t, file("top", "top"))}
+	img, err := mutate.AppendLayers(empty.Image, bottom, top)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	tr := tar.NewReader(mutate.Extract(img))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+	// The top layer comes first, since the layers are walked top down.
+	if diff := cmp.Diff([]string{"top", "bottom"}, names); diff != "" {
+		t.Errorf("Extract() (-want +got) = %s", diff)
+	}
+	if bottom.calls != 1 || top.calls != 1 {
+		t.Errorf("Uncompressed called %d and %d times, want once per layer", bottom.calls, top.calls)
+	}
+}
+
 // TestExtractError tests that if there are any errors encountered
 func TestExtractError(t *testing.T) {
 	rc := mutate.Extract(invalidImage{})
@@ -188,6 +360,61 @@ func TestAppendWithAddendum(t *testing.T) {
 	}
 }
 
+// annotatedLayer is a layer whose descriptor carries annotations, like the
+// estargz layers produced by tarball.WithEstargz.
+type annotatedLayer struct {
+	v1.Layer
+	annotations map[string]string
+}
+
+func (l annotatedLayer) Descriptor() (*v1.Descriptor, error) {
+	desc, err := partial.Descriptor(l.Layer)
+	if err != nil {
+		return nil, err
+	}
+	desc.Annotations = l.annotations
+	return desc, nil
+}
+
+func TestAppendPreservesLayerAnnotations(t *testing.T) {
+	source := sourceImage(t)
+	rl, err := random.Layer(100, types.DockerLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer := annotatedLayer{
+		Layer: rl,
+		annotations: map[string]string{
+			estargz.TOCJSONDigestAnnotation: "sha256:deadbeef",
+		},
+	}
+
+	result, err := mutate.Append(source, mutate.Addendum{
+		Layer:       layer,
+		Annotations: map[string]string{"foo": "bar"},
+	})
+	if err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	m, err := result.Manifest()
+	if err != nil {
+		t.Fatalf("failed to get manifest: %v", err)
+	}
+	want := map[string]string{
+		estargz.TOCJSONDigestAnnotation: "sha256:deadbeef",
+		"foo":                           "bar",
+	}
+	if diff := cmp.Diff(want, m.Layers[1].Annotations); diff != "" {
+		t.Errorf("the appended Annotations are not merged (-want, +got) %s", diff)
+	}
+	if layer.annotations["foo"] != "" {
+		t.Error("Append() modified the layer's annotations")
+	}
+	if err := validate.Image(result); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+}
+
 func TestAppendLayers(t *testing.T) {
 	source := sourceImage(t)
 	layer, err := random.Layer(100, types.DockerLayer)
@@ -227,6 +454,73 @@ func TestAppendLayers(t *testing.T) {
 	}
 }
 
+func TestAppendHistory(t *testing.T) {
+	img, err := random.Image(100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Some tools don't record any history, which we leave alone.
+	cf = cf.DeepCopy()
+	cf.History = nil
+	noHistory, err := mutate.ConfigFile(img, cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer, err := random.Layer(100, types.DockerLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := v1.Time{Time: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)}
+	copyHistory := v1.History{
+		Author:    "dave",
+		Created:   created,
+		CreatedBy: "COPY app /app",
+		Comment:   "the app",
+	}
+	envHistory := v1.History{
+		Created:    created,
+		CreatedBy:  "ENV PATH=/app",
+		EmptyLayer: true,
+	}
+
+	for _, tc := range []struct {
+		name string
+		base v1.Image
+		want []v1.History
+	}{{
+		name: "with history",
+		base: img,
+		want: append(getConfigFile(t, img).History, copyHistory, envHistory),
+	}, {
+		name: "without history",
+		base: noHistory,
+		want: []v1.History{copyHistory, envHistory},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := mutate.Append(tc.base,
+				mutate.Addendum{Layer: layer, History: copyHistory},
+				mutate.Addendum{History: envHistory},
+			)
+			if err != nil {
+				t.Fatalf("Append() = %v", err)
+			}
+
+			got := getConfigFile(t, result).History
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("History (-want +got) = %s", diff)
+			}
+			if err := validate.Image(result); err != nil {
+				t.Errorf("validate.Image() = %v", err)
+			}
+		})
+	}
+}
+
 func TestMutateConfig(t *testing.T) {
 	source := sourceImage(t)
 	cfg, err := source.ConfigFile()
@@ -266,6 +560,82 @@ func TestMutateConfig(t *testing.T) {
 	}
 }
 
+func TestMutateConfigRuntimeFields(t *testing.T) {
+	want := v1.Config{
+		Cmd: []string{"/bin/server"},
+		Healthcheck: &v1.HealthConfig{
+			Test:          []string{"CMD-SHELL", "curl -f http://localhost/ || exit 1"},
+			Interval:      30 * time.Second,
+			Timeout:       5 * time.Second,
+			StartPeriod:   time.Minute,
+			StartInterval: time.Second,
+			Retries:       3,
+		},
+		OnBuild:    []string{"RUN make"},
+		Volumes:    map[string]struct{}{"/data": {}},
+		StopSignal: "SIGQUIT",
+		Shell:      []string{"/bin/bash", "-c"},
+	}
+	img, err := mutate.Config(empty.Image, want)
+	if err != nil {
+		t.Fatalf("mutate.Config() = %v", err)
+	}
+	raw, err := img.RawConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cf struct {
+		Config json.RawMessage `json:"config"`
+	}
+	if err := json.Unmarshal(raw, &cf); err != nil {
+		t.Fatal(err)
+	}
+	wantRaw, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cf.Config, wantRaw) {
+		t.Errorf("config = %s, want %s", cf.Config, wantRaw)
+	}
+
+	// Setting the config of an image to its own config doesn't change it.
+	got, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	same, err := mutate.Config(img, got.Config)
+	if err != nil {
+		t.Fatalf("mutate.Config() = %v", err)
+	}
+	if !configDigestsAreEqual(t, img, same) {
+		t.Error("setting the same config changed the config digest")
+	}
+
+	// Clearing a field removes it from the config file.
+	cleared := got.Config.DeepCopy()
+	cleared.Healthcheck = nil
+	cleared.StopSignal = ""
+	result, err := mutate.Config(img, *cleared)
+	if err != nil {
+		t.Fatalf("mutate.Config() = %v", err)
+	}
+	raw, err = result.RawConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"Healthcheck", "StopSignal"} {
+		if bytes.Contains(raw, []byte(field)) {
+			t.Errorf("config file still has %s: %s", field, raw)
+		}
+	}
+	if !bytes.Contains(raw, []byte("Shell")) {
+		t.Errorf("config file lost Shell: %s", raw)
+	}
+	if got.Config.Healthcheck == nil {
+		t.Error("clearing the Healthcheck modified the base config")
+	}
+}
+
 func TestAnnotations(t *testing.T) {
 	source := sourceImage(t)
 
@@ -284,6 +654,390 @@ func TestAnnotations(t *testing.T) {
 	}
 }
 
+func TestLabels(t *testing.T) {
+	base, err := mutate.Labels(sourceImage(t), map[string]string{"foo": "bar", "baz": "quux"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		desc   string
+		labels map[string]string
+		merge  bool
+		want   map[string]string
+	}{
+		{"merge", map[string]string{"maintainer": "x", "foo": "override"}, true, map[string]string{"maintainer": "x", "foo": "override", "baz": "quux"}},
+		{"merge removes empty", map[string]string{"foo": ""}, true, map[string]string{"baz": "quux"}},
+		{"merge removes all", map[string]string{"foo": "", "baz": ""}, true, nil},
+		{"replace", map[string]string{"maintainer": "x"}, false, map[string]string{"maintainer": "x"}},
+		{"replace keeps empty", map[string]string{"maintainer": ""}, false, map[string]string{"maintainer": ""}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			result, err := mutate.Labels(base, tc.labels, tc.merge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := validate.Image(result); err != nil {
+				t.Errorf("validate.Image() = %v", err)
+			}
+			cf, err := result.ConfigFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, cf.Config.Labels); diff != "" {
+				t.Errorf("Labels (-want +got) = %s", diff)
+			}
+		})
+	}
+
+	// The base is left as it is.
+	cf, err := base.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]string{"foo": "bar", "baz": "quux"}, cf.Config.Labels); diff != "" {
+		t.Errorf("base Labels (-want +got) = %s", diff)
+	}
+}
+
+func TestAnnotationsFromLabels(t *testing.T) {
+	base, err := mutate.Labels(sourceImage(t), map[string]string{
+		"org.opencontainers.image.source": "https://example.com/repo",
+		"com.example.team":                "foo",
+		"maintainer":                      "x",
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base = mutate.Annotations(base, map[string]string{"existing": "annotation"})
+
+	for _, tc := range []struct {
+		prefixes []string
+		want     map[string]string
+	}{{
+		want: map[string]string{
+			"existing":                        "annotation",
+			"org.opencontainers.image.source": "https://example.com/repo",
+		},
+	}, {
+		prefixes: []string{"com.example.", "maintainer"},
+		want: map[string]string{
+			"existing":         "annotation",
+			"com.example.team": "foo",
+			"maintainer":       "x",
+		},
+	}} {
+		result, err := mutate.AnnotationsFromLabels(base, tc.prefixes...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := result.Manifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(tc.want, m.Annotations); diff != "" {
+			t.Errorf("AnnotationsFromLabels(%v) (-want +got) = %s", tc.prefixes, diff)
+		}
+		if err := validate.Image(result); err != nil {
+			t.Errorf("validate.Image() = %v", err)
+		}
+	}
+}
+
+func TestLayerURLs(t *testing.T) {
+	source := sourceImage(t)
+	ls, err := source.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := ls[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls := []string{"https://example.com/layer"}
+
+	result := mutate.LayerURLs(source, digest, urls...)
+	m, err := result.Manifest()
+	if err != nil {
+		t.Fatalf("Manifest() = %v", err)
+	}
+	if diff := cmp.Diff(urls, m.Layers[0].URLs); diff != "" {
+		t.Errorf("URLs (-want +got) = %s", diff)
+	}
+	if err := validate.Image(result); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+
+	if _, err := mutate.LayerURLs(source, v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("a", 64)}, urls...).Manifest(); err == nil {
+		t.Error("Manifest() = nil, wanted error for unknown layer")
+	}
+}
+
+func TestSubject(t *testing.T) {
+	source := sourceImage(t)
+	target, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := partial.Descriptor(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject.Annotations = map[string]string{"foo": "bar"}
+
+	result := mutate.Subject(source, *subject)
+
+	if err := validate.Image(result); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+	if manifestsAreEqual(t, source, result) {
+		t.Errorf("setting the subject MUST mutate the manifest")
+	}
+
+	// The subject should survive a round trip through the raw manifest.
+	b, err := result.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := v1.ParseManifest(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(subject, m.Subject); diff != "" {
+		t.Errorf("Subject (-want +got) = %s", diff)
+	}
+	if want, got := getManifest(t, source).Layers, m.Layers; !reflect.DeepEqual(want, got) {
+		t.Errorf("setting the subject MUST NOT mutate the layers: got %v, want %v", got, want)
+	}
+}
+
+func TestSubjectSchema1(t *testing.T) {
+	source := mutate.MediaType(sourceImage(t), types.DockerManifestSchema1)
+	result := mutate.Subject(source, v1.Descriptor{})
+	if _, err := result.Digest(); err == nil {
+		t.Error("Digest() = nil, wanted error for schema 1 manifest")
+	}
+}
+
+func TestArtifactType(t *testing.T) {
+	source := sourceImage(t)
+	result := mutate.ArtifactType(source, "application/vnd.example+type")
+
+	if err := validate.Image(result); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+	if manifestsAreEqual(t, source, result) {
+		t.Errorf("setting the artifactType MUST mutate the manifest")
+	}
+
+	b, err := result.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := v1.ParseManifest(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.ArtifactType, "application/vnd.example+type"; got != want {
+		t.Errorf("ArtifactType = %q, want %q", got, want)
+	}
+	if want, got := getManifest(t, source).Layers, m.Layers; !reflect.DeepEqual(want, got) {
+		t.Errorf("setting the artifactType MUST NOT mutate the layers: got %v, want %v", got, want)
+	}
+}
+
+func TestArtifactTypeWithoutLayers(t *testing.T) {
+	result := mutate.ArtifactType(empty.Image, "application/vnd.example+type")
+
+	m, err := result.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Layers) != 1 {
+		t.Fatalf("len(Layers) = %d, want the empty descriptor", len(m.Layers))
+	}
+	desc := m.Layers[0]
+	if desc.MediaType != types.OCIEmptyJSON || desc.Size != 2 {
+		t.Errorf("Layers[0] = %v, want the empty descriptor", desc)
+	}
+
+	l, err := result.LayerByDigest(desc.Digest)
+	if err != nil {
+		t.Fatalf("LayerByDigest() = %v", err)
+	}
+	rc, err := l.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	d, size, err := v1.SHA256(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != desc.Digest || size != desc.Size {
+		t.Errorf("empty blob has digest %s and size %d, want %s and %d", d, size, desc.Digest, desc.Size)
+	}
+}
+
+func TestEmptyConfig(t *testing.T) {
+	base := mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), types.OCIEmptyJSON)
+	layer, err := random.Layer(1024, "application/vnd.example.blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.Append(base, mutate.Addendum{Layer: layer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img = mutate.ArtifactType(img, "application/vnd.example+type")
+
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m.Config, empty.Descriptor) {
+		t.Errorf("Config = %v, want %v", m.Config, empty.Descriptor)
+	}
+	if got, want := len(m.Layers), 1; got != want {
+		t.Errorf("len(Layers) = %d, want %d", got, want)
+	}
+	b, err := img.RawConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), empty.JSON; got != want {
+		t.Errorf("RawConfigFile() = %q, want %q", got, want)
+	}
+	cl, err := img.LayerByDigest(empty.Descriptor.Digest)
+	if err != nil {
+		t.Fatalf("LayerByDigest(config) = %v", err)
+	}
+	if size, err := cl.Size(); err != nil {
+		t.Fatal(err)
+	} else if size != empty.Descriptor.Size {
+		t.Errorf("config Size() = %d, want %d", size, empty.Descriptor.Size)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 1 {
+		t.Fatalf("len(Layers()) = %d, want 1", len(layers))
+	}
+	if d, err := layers[0].Digest(); err != nil {
+		t.Fatal(err)
+	} else if d != m.Layers[0].Digest {
+		t.Errorf("Layers()[0].Digest() = %s, want %s", d, m.Layers[0].Digest)
+	}
+
+	// There's no config to change.
+	if _, err := mutate.Config(img, v1.Config{Env: []string{"FOO=bar"}}); err == nil {
+		t.Error("Config() = nil, wanted error")
+	}
+}
+
+// attestation is an artifact whose config isn't an image config.
+type attestation struct {
+	v1.Image
+	config []byte
+}
+
+func (a attestation) RawConfigFile() ([]byte, error) {
+	return a.config, nil
+}
+
+func (a attestation) ConfigFile() (*v1.ConfigFile, error) {
+	return partial.ConfigFile(a)
+}
+
+func (a attestation) ConfigName() (v1.Hash, error) {
+	return partial.ConfigName(a)
+}
+
+func (a attestation) Manifest() (*v1.Manifest, error) {
+	m, err := a.Image.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	m = m.DeepCopy()
+	h, sz, err := v1.SHA256(bytes.NewReader(a.config))
+	if err != nil {
+		return nil, err
+	}
+	m.Config = v1.Descriptor{
+		MediaType: "application/vnd.in-toto+json",
+		Digest:    h,
+		Size:      sz,
+	}
+	return m, nil
+}
+
+func (a attestation) RawManifest() ([]byte, error) {
+	return partial.RawManifest(a)
+}
+
+func (a attestation) Digest() (v1.Hash, error) {
+	return partial.Digest(a)
+}
+
+func TestArtifactConfig(t *testing.T) {
+	// Doesn't parse as a v1.ConfigFile.
+	config := []byte(`{"history":"not an image"}`)
+	base := attestation{Image: mutate.MediaType(empty.Image, types.OCIManifestSchema1), config: config}
+	if _, err := base.ConfigFile(); err == nil {
+		t.Fatal("ConfigFile() = nil, want error")
+	}
+
+	layer, err := random.Layer(1024, "application/vnd.example.blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.Append(base, mutate.Addendum{Layer: layer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img = mutate.Annotations(img, map[string]string{"foo": "bar"})
+
+	b, err := img.RawConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), string(config); got != want {
+		t.Errorf("RawConfigFile() = %q, want %q", got, want)
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Config.MediaType, types.MediaType("application/vnd.in-toto+json"); got != want {
+		t.Errorf("Config.MediaType = %s, want %s", got, want)
+	}
+	if got, want := len(m.Layers), 1; got != want {
+		t.Fatalf("len(Layers) = %d, want %d", got, want)
+	}
+	if cf, err := partial.ConfigFileOrNil(img); err != nil || cf != nil {
+		t.Errorf("ConfigFileOrNil() = %v, %v, want nil", cf, err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != 1 {
+		t.Fatalf("len(Layers()) = %d, want 1", len(layers))
+	}
+	if err := validate.Image(img); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+}
+
+func TestArtifactTypeSchema1(t *testing.T) {
+	source := mutate.MediaType(sourceImage(t), types.DockerManifestSchema1)
+	result := mutate.ArtifactType(source, "application/vnd.example+type")
+	if _, err := result.Digest(); err == nil {
+		t.Error("Digest() = nil, wanted error for schema 1 manifest")
+	}
+}
+
 func TestMutateCreatedAt(t *testing.T) {
 	source := sourceImage(t)
 	want := time.Now().Add(-2 * time.Minute)
@@ -504,6 +1258,309 @@ func TestCanonical(t *testing.T) {
 	}
 }
 
+func TestCanonicalReproducible(t *testing.T) {
+	// build returns the same image as built by a different tool, at ts.
+	build := func(ts time.Time, env []string, docker bool) v1.Image {
+		img := timestampedImage(t, ts)
+		cf, err := img.ConfigFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cf = cf.DeepCopy()
+		cf.Config.Env = env
+		cf.Config.Labels = map[string]string{"b": "2", "a": "1"}
+		if docker {
+			cf.Container = "0123456789ab"
+			cf.DockerVersion = "20.10.7"
+			cf.Config.Hostname = "0123456789ab"
+		}
+		img, err = mutate.ConfigFile(img, cf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if docker {
+			img = mutate.MediaType(img, types.DockerManifestSchema2)
+			img = mutate.ConfigMediaType(img, types.DockerConfigJSON)
+		}
+		return img
+	}
+
+	first, err := mutate.Canonical(build(time.Unix(1000, 0), []string{"PATH=/bin", "A=1", "PATH=/usr/bin"}, true))
+	if err != nil {
+		t.Fatalf("Canonical() = %v", err)
+	}
+	second, err := mutate.Canonical(build(time.Unix(2000, 0), []string{"A=1", "PATH=/bin", "PATH=/usr/bin"}, false))
+	if err != nil {
+		t.Fatalf("Canonical() = %v", err)
+	}
+	if !manifestsAreEqual(t, first, second) {
+		t.Errorf("Canonical() manifests differ: %+v != %+v", getManifest(t, first), getManifest(t, second))
+	}
+	if !configFilesAreEqual(t, first, second) {
+		t.Errorf("Canonical() configs differ: %+v != %+v", getConfigFile(t, first), getConfigFile(t, second))
+	}
+
+	m := getManifest(t, first)
+	if mt, err := first.MediaType(); err != nil {
+		t.Fatal(err)
+	} else if mt != types.OCIManifestSchema1 {
+		t.Errorf("MediaType() = %s, want %s", mt, types.OCIManifestSchema1)
+	}
+	if m.Config.MediaType != types.OCIConfigJSON {
+		t.Errorf("config MediaType = %s, want %s", m.Config.MediaType, types.OCIConfigJSON)
+	}
+	for _, l := range m.Layers {
+		if l.MediaType != types.OCILayer {
+			t.Errorf("layer MediaType = %s, want %s", l.MediaType, types.OCILayer)
+		}
+	}
+	want := []string{"A=1", "PATH=/bin", "PATH=/usr/bin"}
+	if diff := cmp.Diff(want, getConfigFile(t, first).Config.Env); diff != "" {
+		t.Errorf("Env (-want +got) = %s", diff)
+	}
+}
+
+func TestInlineData(t *testing.T) {
+	source, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := getManifest(t, source)
+	if m.Config.Data != nil {
+		t.Fatal("random.Image() inlined the config")
+	}
+
+	// Inline the config and the smaller layer.
+	max := m.Layers[0].Size
+	if m.Layers[1].Size < max {
+		max = m.Layers[1].Size
+	}
+	if m.Config.Size > max {
+		max = m.Config.Size
+	}
+	img := mutate.InlineData(source, max)
+	if err := validate.Image(img); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+	got := getManifest(t, img)
+	rcfg, err := source.RawConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(rcfg, got.Config.Data); diff != "" {
+		t.Errorf("config Data (-want +got) = %s", diff)
+	}
+	for _, desc := range got.Layers {
+		if desc.Size > max {
+			if desc.Data != nil {
+				t.Errorf("layer %s of size %d > %d was inlined", desc.Digest, desc.Size, max)
+			}
+			continue
+		}
+		l, err := source.LayerByDigest(desc.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := l.Compressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want, desc.Data) {
+			t.Errorf("layer %s Data = %d bytes, want %d", desc.Digest, len(desc.Data), len(want))
+		}
+	}
+
+	// Changing the config drops the stale embedded config.
+	cf := getConfigFile(t, img).DeepCopy()
+	cf.Author = "someone"
+	changed, err := mutate.ConfigFile(img, cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := getManifest(t, changed).Config.Data; data != nil {
+		t.Errorf("config Data = %s, want nil", data)
+	}
+}
+
+func TestTimeZstd(t *testing.T) {
+	rnd, err := random.Layer(1024, types.DockerLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zl, err := tarball.LayerFromOpener(rnd.Uncompressed, tarball.WithCompression(compression.ZStd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := mutate.AppendLayers(empty.Image, zl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedLayerTime := time.Unix(0, 0)
+	img, err := mutate.Time(source, expectedLayerTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, layer := range getLayers(t, img) {
+		if err := validate.Layer(layer); err != nil {
+			t.Errorf("validate.Layer: %v", err)
+		}
+		assertMTime(t, layer, expectedLayerTime)
+		if mt, err := layer.MediaType(); err != nil {
+			t.Fatal(err)
+		} else if mt != types.OCILayerZStd {
+			t.Errorf("MediaType() = %s, want %s", mt, types.OCILayerZStd)
+		}
+	}
+}
+
+// timestampedImage returns an OCI image whose layer and config carry the
+// given timestamp, with a PAX entry, a symlink and a whiteout.
+func timestampedImage(t *testing.T, ts time.Time) v1.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range []*tar.Header{{
+		Name:       "file",
+		Typeflag:   tar.TypeReg,
+		Size:       4,
+		Mode:       0644,
+		ModTime:    ts,
+		AccessTime: ts,
+		ChangeTime: ts,
+		Format:     tar.FormatPAX,
+		PAXRecords: map[string]string{"LIBARCHIVE.creationtime": strconv.FormatInt(ts.Unix(), 10)},
+	}, {
+		Name:     "link",
+		Typeflag: tar.TypeSymlink,
+		Linkname: "file",
+		ModTime:  ts,
+	}, {
+		Name:     ".wh.gone",
+		Typeflag: tar.TypeReg,
+		ModTime:  ts,
+	}} {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size != 0 {
+			if _, err := tw.Write([]byte("data")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}, tarball.WithMediaType(types.OCILayer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := mutate.Append(mutate.MediaType(empty.Image, types.OCIManifestSchema1), mutate.Addendum{
+		Layer:   layer,
+		History: v1.History{Created: v1.Time{Time: ts}, CreatedBy: "COPY file"},
+	}, mutate.Addendum{
+		History: v1.History{Created: v1.Time{Time: ts}, CreatedBy: "ENV foo=bar", EmptyLayer: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf = cf.DeepCopy()
+	cf.Created = v1.Time{Time: ts}
+	cf.Config.Env = []string{"foo=bar"}
+	img, err = mutate.ConfigFile(img, cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestCanonicalizeTimestamps(t *testing.T) {
+	want := time.Unix(1000, 0).UTC()
+	var digests []v1.Hash
+	for _, ts := range []time.Time{time.Unix(1600000000, 0), time.Unix(1700000000, 123)} {
+		img, err := mutate.CanonicalizeTimestamps(timestampedImage(t, ts), want)
+		if err != nil {
+			t.Fatalf("CanonicalizeTimestamps() = %v", err)
+		}
+		if err := validate.Image(img); err != nil {
+			t.Errorf("validate.Image() = %v", err)
+		}
+		d, err := img.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests = append(digests, d)
+
+		cf := getConfigFile(t, img)
+		if !cf.Created.Time.Equal(want) {
+			t.Errorf("Created = %v, want %v", cf.Created.Time, want)
+		}
+		if len(cf.History) != 2 {
+			t.Fatalf("len(History) = %d, want 2", len(cf.History))
+		}
+		for _, h := range cf.History {
+			if !h.Created.Time.Equal(want) {
+				t.Errorf("History[%q].Created = %v, want %v", h.CreatedBy, h.Created.Time, want)
+			}
+		}
+		if got := cf.Config.Env; len(got) != 1 || got[0] != "foo=bar" {
+			t.Errorf("Env = %v, want [foo=bar]", got)
+		}
+		if mt := getManifest(t, img).Layers[0].MediaType; mt != types.OCILayer {
+			t.Errorf("layer MediaType = %s, want %s", mt, types.OCILayer)
+		}
+
+		for _, layer := range getLayers(t, img) {
+			rc, err := layer.Uncompressed()
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr := tar.NewReader(rc)
+			var names []string
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				names = append(names, hdr.Name)
+				if !hdr.ModTime.Equal(want) {
+					t.Errorf("%s: ModTime = %v, want %v", hdr.Name, hdr.ModTime, want)
+				}
+				for _, ts := range []time.Time{hdr.AccessTime, hdr.ChangeTime} {
+					if !ts.IsZero() && !ts.Equal(want) {
+						t.Errorf("%s: AccessTime/ChangeTime = %v, want %v", hdr.Name, ts, want)
+					}
+				}
+				if _, ok := hdr.PAXRecords["LIBARCHIVE.creationtime"]; ok {
+					t.Errorf("%s: LIBARCHIVE.creationtime was kept", hdr.Name)
+				}
+			}
+			rc.Close()
+			if diff := cmp.Diff([]string{"file", "link", ".wh.gone"}, names); diff != "" {
+				t.Errorf("entries (-want +got) = %s", diff)
+			}
+		}
+	}
+	if digests[0] != digests[1] {
+		t.Errorf("CanonicalizeTimestamps() is not reproducible: %s != %s", digests[0], digests[1])
+	}
+}
+
 func TestRemoveManifests(t *testing.T) {
 	// Load up the registry.
 	count := 3
@@ -0,0 +1,47 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate
+
+import "github.com/google/go-containerregistry/pkg/v1/tarball"
+
+// Option is a functional option for the functions that create new layers,
+// like Flatten, Time and CanonicalizeTimestamps.
+type Option func(*options)
+
+type options struct {
+	layerOpts []tarball.LayerOption
+
+	// ociLayers gives the new layers OCI media types, see Canonical.
+	ociLayers bool
+}
+
+func makeOptions(opts ...Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithCompressionLevel sets the compression level of the new layers, like
+// tarball.WithCompressionLevel, e.g. gzip.BestCompression.
+//
+// Changing the level changes the compressed bytes, and with them the digests
+// of the layers, but not their DiffIDs.
+func WithCompressionLevel(level int) Option {
+	return func(o *options) {
+		o.layerOpts = append(o.layerOpts, tarball.WithCompressionLevel(level))
+	}
+}
@@ -22,6 +22,10 @@ import (
 )
 
 // Rebase returns a new v1.Image where the oldBase in orig is replaced by newBase.
+//
+// The bottom layers of orig must match the layers of oldBase, by DiffID. The
+// config of orig (e.g. its Env and Entrypoint) is preserved, except for the
+// os/arch properties, which come from newBase.
 func Rebase(orig, oldBase, newBase v1.Image) (v1.Image, error) {
 	// Verify that oldBase's layers are present in orig, otherwise orig is
 	// not based on oldBase at all.
@@ -37,16 +41,17 @@ func Rebase(orig, oldBase, newBase v1.Image) (v1.Image, error) {
 		return nil, fmt.Errorf("image %q is not based on %q (too few layers)", orig, oldBase)
 	}
 	for i, l := range oldBaseLayers {
-		oldLayerDigest, err := l.Digest()
+		// Compare DiffIDs, so that recompressed layers still match.
+		oldLayerDiffID, err := l.DiffID()
 		if err != nil {
-			return nil, fmt.Errorf("failed to get digest of layer %d of %q: %v", i, oldBase, err)
+			return nil, fmt.Errorf("failed to get diffid of layer %d of %q: %v", i, oldBase, err)
 		}
-		origLayerDigest, err := origLayers[i].Digest()
+		origLayerDiffID, err := origLayers[i].DiffID()
 		if err != nil {
-			return nil, fmt.Errorf("failed to get digest of layer %d of %q: %v", i, orig, err)
+			return nil, fmt.Errorf("failed to get diffid of layer %d of %q: %v", i, orig, err)
 		}
-		if oldLayerDigest != origLayerDigest {
-			return nil, fmt.Errorf("image %q is not based on %q (layer %d mismatch)", orig, oldBase, i)
+		if oldLayerDiffID != origLayerDiffID {
+			return nil, fmt.Errorf("image %q is not based on %q (layer %d mismatch: diffid %s, want %s)", orig, oldBase, i, origLayerDiffID, oldLayerDiffID)
 		}
 	}
 
@@ -135,8 +140,9 @@ func createAddendums(startHistory, startLayer int, history []v1.History, layers
 	}
 	// In the event history was malformed or non-existent, append the remaining layers.
 	for i := layerIndex; i < len(layers); i++ {
-		if i >= startLayer {
-			adds = append(adds, Addendum{Layer: layers[layerIndex]})
+		// Like layerIndex above, startLayer counts layers from 1.
+		if i+1 >= startLayer {
+			adds = append(adds, Addendum{Layer: layers[i]})
 		}
 	}
 
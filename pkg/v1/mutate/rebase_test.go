@@ -15,12 +15,16 @@
 package mutate_test
 
 import (
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/go-containerregistry/pkg/compression"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
 )
 
 func layerDigests(t *testing.T, img v1.Image) []string {
@@ -177,3 +181,173 @@ func TestRebase(t *testing.T) {
 		t.Errorf("ConfigFile property OSVersion mismatch, got %q, want %q", rebasedConfig.OSVersion, newBaseConfig.OSVersion)
 	}
 }
+
+// TestRebaseRecompressed tests that base layers are matched by DiffID, and
+// that the original config is preserved.
+func TestRebaseRecompressed(t *testing.T) {
+	oldBase, err := random.Image(100, 3)
+	if err != nil {
+		t.Fatalf("random.Image (oldBase): %v", err)
+	}
+	oldBaseLayers, err := oldBase.Layers()
+	if err != nil {
+		t.Fatalf("oldBase.Layers: %v", err)
+	}
+
+	// Recompress the old base layers, as if they had been pulled and pushed
+	// by a registry that converts them to zstd.
+	orig := empty.Image
+	for i, l := range oldBaseLayers {
+		zl, err := tarball.LayerFromOpener(l.Uncompressed, tarball.WithCompression(compression.ZStd))
+		if err != nil {
+			t.Fatalf("LayerFromOpener %d: %v", i, err)
+		}
+		orig, err = mutate.AppendLayers(orig, zl)
+		if err != nil {
+			t.Fatalf("AppendLayers: %v", err)
+		}
+	}
+	top, err := random.Layer(100, "")
+	if err != nil {
+		t.Fatalf("random.Layer: %v", err)
+	}
+	orig, err = mutate.AppendLayers(orig, top)
+	if err != nil {
+		t.Fatalf("AppendLayers: %v", err)
+	}
+	cfg, err := orig.ConfigFile()
+	if err != nil {
+		t.Fatalf("orig.ConfigFile: %v", err)
+	}
+	cfg = cfg.DeepCopy()
+	cfg.Config.Env = []string{"FOO=bar"}
+	cfg.Config.Entrypoint = []string{"/app"}
+	orig, err = mutate.ConfigFile(orig, cfg)
+	if err != nil {
+		t.Fatalf("ConfigFile: %v", err)
+	}
+
+	newBase, err := random.Image(100, 2)
+	if err != nil {
+		t.Fatalf("random.Image (newBase): %v", err)
+	}
+	newBaseCfg, err := newBase.ConfigFile()
+	if err != nil {
+		t.Fatalf("newBase.ConfigFile: %v", err)
+	}
+	newBaseCfg = newBaseCfg.DeepCopy()
+	newBaseCfg.Config.Env = []string{"BASE=1"}
+	newBase, err = mutate.ConfigFile(newBase, newBaseCfg)
+	if err != nil {
+		t.Fatalf("ConfigFile (newBase): %v", err)
+	}
+
+	rebased, err := mutate.Rebase(orig, oldBase, newBase)
+	if err != nil {
+		t.Fatalf("Rebase: %v", err)
+	}
+
+	got := layerDigests(t, rebased)
+	want := append(layerDigests(t, newBase), layerDigests(t, orig)[3:]...)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Rebased layers = %v, want %v", got, want)
+	}
+
+	rebasedCfg, err := rebased.ConfigFile()
+	if err != nil {
+		t.Fatalf("rebased.ConfigFile: %v", err)
+	}
+	if got, want := strings.Join(rebasedCfg.Config.Env, ","), "FOO=bar"; got != want {
+		t.Errorf("Env = %q, want %q", got, want)
+	}
+	if got, want := strings.Join(rebasedCfg.Config.Entrypoint, ","), "/app"; got != want {
+		t.Errorf("Entrypoint = %q, want %q", got, want)
+	}
+	if got, want := len(rebasedCfg.RootFS.DiffIDs), 3; got != want {
+		t.Errorf("len(DiffIDs) = %d, want %d", got, want)
+	}
+}
+
+// TestRebaseMismatch tests that the first divergent layer is reported.
+func TestRebaseMismatch(t *testing.T) {
+	oldBase, err := random.Image(100, 3)
+	if err != nil {
+		t.Fatalf("random.Image (oldBase): %v", err)
+	}
+	oldBaseLayers, err := oldBase.Layers()
+	if err != nil {
+		t.Fatalf("oldBase.Layers: %v", err)
+	}
+	other, err := random.Layer(100, "")
+	if err != nil {
+		t.Fatalf("random.Layer: %v", err)
+	}
+	orig, err := mutate.AppendLayers(empty.Image, oldBaseLayers[0], other, oldBaseLayers[2])
+	if err != nil {
+		t.Fatalf("AppendLayers: %v", err)
+	}
+	diffID, err := other.DiffID()
+	if err != nil {
+		t.Fatalf("DiffID: %v", err)
+	}
+
+	_, err = mutate.Rebase(orig, oldBase, empty.Image)
+	if err == nil {
+		t.Fatal("Rebase() = nil, wanted error")
+	}
+	if !strings.Contains(err.Error(), "layer 1 mismatch") || !strings.Contains(err.Error(), diffID.String()) {
+		t.Errorf("Rebase() = %v, want error naming layer 1 (%s)", err, diffID)
+	}
+}
+
+// TestRebaseNoHistory tests rebasing images without any history.
+func TestRebaseNoHistory(t *testing.T) {
+	withoutHistory := func(img v1.Image) v1.Image {
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			t.Fatalf("ConfigFile: %v", err)
+		}
+		cfg = cfg.DeepCopy()
+		cfg.History = nil
+		img, err = mutate.ConfigFile(img, cfg)
+		if err != nil {
+			t.Fatalf("ConfigFile: %v", err)
+		}
+		return img
+	}
+
+	oldBase, err := random.Image(100, 2)
+	if err != nil {
+		t.Fatalf("random.Image (oldBase): %v", err)
+	}
+	oldBase = withoutHistory(oldBase)
+	top, err := random.Image(100, 2)
+	if err != nil {
+		t.Fatalf("random.Image (top): %v", err)
+	}
+	topLayers, err := top.Layers()
+	if err != nil {
+		t.Fatalf("top.Layers: %v", err)
+	}
+	orig, err := mutate.AppendLayers(oldBase, topLayers...)
+	if err != nil {
+		t.Fatalf("AppendLayers: %v", err)
+	}
+	orig = withoutHistory(orig)
+	newBase, err := random.Image(100, 1)
+	if err != nil {
+		t.Fatalf("random.Image (newBase): %v", err)
+	}
+	newBase = withoutHistory(newBase)
+
+	rebased, err := mutate.Rebase(orig, oldBase, newBase)
+	if err != nil {
+		t.Fatalf("Rebase: %v", err)
+	}
+
+	got := layerDigests(t, rebased)
+	want := append(layerDigests(t, newBase), layerDigests(t, top)...)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Rebased layers = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// RemoveLayer returns a new v1.Image without the layer of img whose digest
+// or diffID is target, e.g. to strip a layer that shouldn't have been there.
+//
+// The layer's rootfs.diff_ids entry and its history entry are removed, too.
+// If the layer appears more than once, every occurrence is removed. It is an
+// error if img has no such layer.
+func RemoveLayer(img v1.Image, target v1.Hash) (v1.Image, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("retrieving image layers: %v", err)
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	var adds []Addendum
+	found := false
+	for _, add := range createAddendums(0, 0, cf.History, layers) {
+		if add.Layer != nil {
+			match, err := layerMatches(add.Layer, target)
+			if err != nil {
+				return nil, err
+			}
+			if match {
+				found = true
+				continue
+			}
+		}
+		adds = append(adds, add)
+	}
+	if !found {
+		return nil, fmt.Errorf("layer %s not found in image", target)
+	}
+
+	base, err := withoutLayers(img)
+	if err != nil {
+		return nil, err
+	}
+	return Append(base, adds...)
+}
+
+// layerMatches returns whether l has target as its digest or diffID.
+func layerMatches(l v1.Layer, target v1.Hash) (bool, error) {
+	digest, err := l.Digest()
+	if err != nil {
+		return false, err
+	}
+	if digest == target {
+		return true, nil
+	}
+	diffID, err := l.DiffID()
+	if err != nil {
+		return false, err
+	}
+	return diffID == target, nil
+}
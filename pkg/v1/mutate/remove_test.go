@@ -0,0 +1,97 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+func TestRemoveLayer(t *testing.T) {
+	var adds []mutate.Addendum
+	var diffIDs []v1.Hash
+	for i, createdBy := range []string{"keep", "secret", "env", "keep too"} {
+		add := mutate.Addendum{History: v1.History{CreatedBy: createdBy}}
+		if i == 2 {
+			add.History.EmptyLayer = true
+		} else {
+			l, err := random.Layer(100, types.DockerLayer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := l.DiffID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			add.Layer = l
+			diffIDs = append(diffIDs, d)
+		}
+		adds = append(adds, add)
+	}
+	img, err := mutate.Append(empty.Image, adds...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := adds[1].Layer.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range []v1.Hash{secret, diffIDs[1]} {
+		result, err := mutate.RemoveLayer(img, target)
+		if err != nil {
+			t.Fatalf("RemoveLayer(%s) = %v", target, err)
+		}
+		if err := validate.Image(result); err != nil {
+			t.Errorf("validate.Image() = %v", err)
+		}
+
+		cf, err := result.ConfigFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]v1.Hash{diffIDs[0], diffIDs[2]}, cf.RootFS.DiffIDs); diff != "" {
+			t.Errorf("RemoveLayer(%s) diff_ids (-want +got) = %s", target, diff)
+		}
+		var createdBy []string
+		for _, h := range cf.History {
+			createdBy = append(createdBy, h.CreatedBy)
+		}
+		if diff := cmp.Diff([]string{"keep", "env", "keep too"}, createdBy); diff != "" {
+			t.Errorf("RemoveLayer(%s) history (-want +got) = %s", target, diff)
+		}
+
+		m, err := result.Manifest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, desc := range m.Layers {
+			if desc.Digest == secret {
+				t.Errorf("RemoveLayer(%s) kept layer %s in the manifest", target, secret)
+			}
+		}
+	}
+
+	if _, err := mutate.RemoveLayer(img, v1.Hash{Algorithm: "sha256", Hex: "deadbeef"}); err == nil {
+		t.Error("RemoveLayer(missing) = nil, wanted error")
+	}
+}
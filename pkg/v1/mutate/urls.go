@@ -0,0 +1,135 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate
+
+import (
+	"net/url"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+)
+
+// RewriteURLs returns a new v1.ImageIndex in which the host of every url of
+// a descriptor, e.g. of a foreign layer, is replaced by rewrite(host), so that
+// clients fetch it from e.g. an internal mirror instead. To keep a url as it
+// is, rewrite returns the host it was given.
+//
+// The images and indexes in base are rewritten recursively. Those whose urls
+// change get new digests, so their descriptors in the new index are updated,
+// keeping their platforms and annotations. The layers themselves don't change.
+func RewriteURLs(base v1.ImageIndex, rewrite func(host string) string) (v1.ImageIndex, error) {
+	replace, err := rewriteChildren(base, func(img v1.Image) (v1.Image, error) {
+		return rewriteImageURLs(img, rewrite)
+	}, func(idx v1.ImageIndex) (v1.ImageIndex, error) {
+		return RewriteURLs(idx, rewrite)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &index{
+		base:        base,
+		replace:     replace,
+		rewriteURLs: rewrite,
+	}, nil
+}
+
+// rewriteChildren applies rewriteImage and rewriteIndex to the images and
+// indexes in base, and returns the results whose digests changed, by the
+// digests they replace.
+func rewriteChildren(base v1.ImageIndex, rewriteImage func(v1.Image) (v1.Image, error), rewriteIndex func(v1.ImageIndex) (v1.ImageIndex, error)) (map[v1.Hash]partial.Describable, error) {
+	m, err := base.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	replace := map[v1.Hash]partial.Describable{}
+	for _, desc := range m.Manifests {
+		var (
+			child partial.Describable
+			err   error
+		)
+		switch {
+		case desc.MediaType.IsIndex():
+			var idx v1.ImageIndex
+			if idx, err = base.ImageIndex(desc.Digest); err == nil {
+				child, err = rewriteIndex(idx)
+			}
+		case desc.MediaType.IsImage():
+			var img v1.Image
+			if img, err = base.Image(desc.Digest); err == nil {
+				child, err = rewriteImage(img)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if d, err := child.Digest(); err != nil {
+			return nil, err
+		} else if d != desc.Digest {
+			replace[desc.Digest] = child
+		}
+	}
+	return replace, nil
+}
+
+// rewriteImageURLs returns img with the urls of its layers rewritten, see
+// RewriteURLs.
+func rewriteImageURLs(img v1.Image, rewrite func(host string) string) (v1.Image, error) {
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	layerURLs := map[v1.Hash][]string{}
+	for _, desc := range m.Layers {
+		if urls, changed := rewriteURLs(desc.URLs, rewrite); changed {
+			layerURLs[desc.Digest] = urls
+		}
+	}
+	if len(layerURLs) == 0 {
+		return img, nil
+	}
+	return &image{
+		base:      img,
+		layerURLs: layerURLs,
+	}, nil
+}
+
+// rewriteURLs returns urls with their hosts rewritten, and whether any of
+// them changed. Urls that don't parse are kept as they are.
+func rewriteURLs(urls []string, rewrite func(host string) string) ([]string, bool) {
+	changed := false
+	rewritten := make([]string, 0, len(urls))
+	for _, s := range urls {
+		u, err := url.Parse(s)
+		if err != nil {
+			rewritten = append(rewritten, s)
+			continue
+		}
+		host := rewrite(u.Host)
+		if host == u.Host {
+			rewritten = append(rewritten, s)
+			continue
+		}
+		u.Host = host
+		rewritten = append(rewritten, u.String())
+		changed = true
+	}
+	if !changed {
+		return urls, false
+	}
+	return rewritten, true
+}
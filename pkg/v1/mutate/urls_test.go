@@ -0,0 +1,130 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mutate_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+func TestRewriteURLs(t *testing.T) {
+	plain, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := foreign.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign = mutate.LayerURLs(foreign, m.Layers[0].Digest, "https://mcr.microsoft.com/layer", "https://other.example.com/layer")
+
+	nested := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: foreign})
+	platform := &v1.Platform{OS: "windows", Architecture: "amd64"}
+	base := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: plain},
+		mutate.IndexAddendum{
+			Add: foreign,
+			Descriptor: v1.Descriptor{
+				Platform:    platform,
+				Annotations: map[string]string{"foo": "bar"},
+			},
+		},
+		mutate.IndexAddendum{Add: nested},
+	)
+
+	idx, err := mutate.RewriteURLs(base, func(host string) string {
+		if host == "mcr.microsoft.com" {
+			return "mirror.example.com"
+		}
+		return host
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validate.Index(idx); err != nil {
+		t.Fatalf("validate.Index() = %v", err)
+	}
+
+	bm, err := base.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(im.Manifests) != 3 {
+		t.Fatalf("len(Manifests) = %d, want 3", len(im.Manifests))
+	}
+	if diff := cmp.Diff(bm.Manifests[0], im.Manifests[0]); diff != "" {
+		t.Errorf("image without urls changed (-want +got) = %s", diff)
+	}
+	for i := 1; i < 3; i++ {
+		if im.Manifests[i].Digest == bm.Manifests[i].Digest {
+			t.Errorf("Manifests[%d] wasn't rewritten", i)
+		}
+	}
+	if diff := cmp.Diff(platform, im.Manifests[1].Platform); diff != "" {
+		t.Errorf("Platform (-want +got) = %s", diff)
+	}
+	if got := im.Manifests[1].Annotations["foo"]; got != "bar" {
+		t.Errorf("Annotations[foo] = %q, want bar", got)
+	}
+
+	want := []string{"https://mirror.example.com/layer", "https://other.example.com/layer"}
+	img, err := idx.Image(im.Manifests[1].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, rm.Layers[0].URLs); diff != "" {
+		t.Errorf("URLs (-want +got) = %s", diff)
+	}
+	if rm.Layers[1].URLs != nil {
+		t.Errorf("URLs = %v, want none", rm.Layers[1].URLs)
+	}
+
+	child, err := idx.ImageIndex(im.Manifests[2].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm, err := child.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err = child.Image(cm.Manifests[0].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rm, err = img.Manifest(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, rm.Layers[0].URLs); diff != "" {
+		t.Errorf("nested URLs (-want +got) = %s", diff)
+	}
+}
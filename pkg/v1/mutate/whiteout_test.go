@@ -19,7 +19,7 @@ import (
 )
 
 func TestWhiteoutDir(t *testing.T) {
-	fsMap := map[string]bool{
+	hidden := map[string]bool{
 		"baz":      true,
 		"red/blue": true,
 	}
@@ -32,10 +32,12 @@ func TestWhiteoutDir(t *testing.T) {
 		{"baz/bar/foo.txt", true},
 		{"red/green", false},
 		{"red/yellow.txt", false},
+		{"red/blue/foo.txt", true},
+		{"./baz/foo.txt", true},
 	}
 
 	for _, tt := range tests {
-		whiteout := inWhiteoutDir(fsMap, tt.path)
+		whiteout := hiddenBy(hidden, tt.path)
 		if whiteout != tt.whiteout {
 			t.Errorf("Whiteout %s: expected %v, but got %v", tt.path, tt.whiteout, whiteout)
 		}
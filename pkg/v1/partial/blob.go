@@ -0,0 +1,88 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package partial
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/google/go-containerregistry/internal/verify"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// WithBlob defines the subset of a content-addressable store for reading blobs
+// by their digest. Notable implementations are layout.Path and
+// remote.BlobStore; ImageBlobs adapts any v1.Image, e.g. from a tarball.
+//
+// If the blob doesn't exist, the error is that of the implementation, e.g. a
+// *fs.PathError or *transport.Error.
+type WithBlob interface {
+	Blob(v1.Hash) (io.ReadCloser, error)
+}
+
+// WithWriteBlob defines the subset of a content-addressable store for writing
+// blobs with a known digest. Notable implementations are layout.Path and
+// remote.BlobStore. Writing a blob that already exists is not an error.
+type WithWriteBlob interface {
+	WriteBlob(v1.Hash, io.ReadCloser) error
+}
+
+// CopyBlob copies the blob with digest h from src to dst, without assembling
+// an image, e.g. from a layout to a registry. The contents are verified against
+// h as they are written, so that dst doesn't end up with a corrupt blob.
+func CopyBlob(dst WithWriteBlob, src WithBlob, h v1.Hash) error {
+	rc, err := src.Blob(h)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	vrc, err := verify.ReadCloser(rc, verify.SizeUnknown, h)
+	if err != nil {
+		return err
+	}
+	return dst.WriteBlob(h, vrc)
+}
+
+type imageBlobs struct {
+	img v1.Image
+}
+
+// ImageBlobs returns a WithBlob for the config and layers of img, e.g. to copy
+// the blobs of an image read with tarball.ImageFromPath.
+func ImageBlobs(img v1.Image) WithBlob {
+	return &imageBlobs{img: img}
+}
+
+// Blob implements WithBlob.
+func (i *imageBlobs) Blob(h v1.Hash) (io.ReadCloser, error) {
+	cfg, err := i.img.ConfigName()
+	if err != nil {
+		return nil, err
+	}
+	if h == cfg {
+		b, err := i.img.RawConfigFile()
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+	l, err := i.img.LayerByDigest(h)
+	if err != nil {
+		return nil, fmt.Errorf("blob %s: %v", h, err)
+	}
+	return l.Compressed()
+}
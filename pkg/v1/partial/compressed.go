@@ -17,7 +17,11 @@ package partial
 import (
 	"io"
 
+	"github.com/google/go-containerregistry/internal/and"
+	icompression "github.com/google/go-containerregistry/internal/compression"
 	"github.com/google/go-containerregistry/internal/gzip"
+	"github.com/google/go-containerregistry/internal/zstd"
+	"github.com/google/go-containerregistry/pkg/compression"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 )
@@ -49,7 +53,19 @@ func (cle *compressedLayerExtender) Uncompressed() (io.ReadCloser, error) {
 	if err != nil {
 		return nil, err
 	}
-	return gzip.UnzipReadCloser(r)
+
+	// Peek at the magic bytes to determine how to decompress the blob,
+	// rather than trusting the MediaType.
+	comp, pr, err := icompression.PeekReader(r)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	prc := &and.ReadCloser{Reader: pr, CloseFunc: r.Close}
+	if comp == compression.ZStd {
+		return zstd.UnzipReadCloser(prc)
+	}
+	return gzip.UnzipReadCloser(prc)
 }
 
 // DiffID implements v1.Layer
@@ -156,8 +172,12 @@ func (i *compressedImageExtender) Size() (int64, error) {
 }
 
 // CompressedToImage fills in the missing methods from a CompressedImageCore so that it implements v1.Image
-func CompressedToImage(cic CompressedImageCore) (v1.Image, error) {
-	return &compressedImageExtender{
+func CompressedToImage(cic CompressedImageCore, opts ...ImageOption) (v1.Image, error) {
+	img := &compressedImageExtender{
 		CompressedImageCore: cic,
-	}, nil
+	}
+	if err := makeImageOptions(opts...).verify(img); err != nil {
+		return nil, err
+	}
+	return img, nil
 }
@@ -20,12 +20,14 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-containerregistry/internal/compare"
+	"github.com/google/go-containerregistry/pkg/compression"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/registry"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
 )
@@ -133,6 +135,28 @@ func TestCompressedLayerExtender(t *testing.T) {
 	}
 }
 
+func TestCompressedLayerExtenderZstd(t *testing.T) {
+	rnd, err := random.Layer(1000, types.DockerLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zl, err := tarball.LayerFromOpener(rnd.Uncompressed, tarball.WithCompression(compression.ZStd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := partial.CompressedToLayer(&noDiffID{zl})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := compare.Layers(zl, l); err != nil {
+		t.Fatalf("compare.Layers: %v", err)
+	}
+	if err := validate.Layer(l); err != nil {
+		t.Fatalf("validate.Layer: %v", err)
+	}
+}
+
 type compressedImage struct {
 	img v1.Image
 }
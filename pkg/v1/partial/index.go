@@ -22,6 +22,10 @@ import (
 )
 
 // FindManifests given a v1.ImageIndex, find the manifests that fit the matcher.
+//
+// The matcher is given the descriptors in the index manifest, so e.g.
+// match.Annotations matches on the annotations of the descriptors, not on
+// those of the child manifests themselves.
 func FindManifests(index v1.ImageIndex, matcher match.Matcher) ([]v1.Descriptor, error) {
 	// get the actual manifest list
 	indexManifest, err := index.IndexManifest()
@@ -83,3 +87,83 @@ func FindIndexes(index v1.ImageIndex, matcher match.Matcher) ([]v1.ImageIndex, e
 	}
 	return matches, nil
 }
+
+// FindManifestsRecursive is like FindManifests, but also finds the matching
+// manifests of nested indexes, depth first, i.e. the children of a
+// sub-index come right after it.
+//
+// Unlike those of FindManifests, the descriptors returned might not be
+// children of index itself. Use FindImagesRecursive or FindIndexesRecursive to
+// get them from the index they are in.
+func FindManifestsRecursive(index v1.ImageIndex, matcher match.Matcher) ([]v1.Descriptor, error) {
+	manifests := []v1.Descriptor{}
+	err := walkIndex(index, map[v1.Hash]bool{}, func(_ v1.ImageIndex, desc v1.Descriptor) error {
+		if matcher(desc) {
+			manifests = append(manifests, desc)
+		}
+		return nil
+	})
+	return manifests, err
+}
+
+// FindImagesRecursive is like FindImages, but also finds the matching images
+// in nested indexes, depth first.
+func FindImagesRecursive(index v1.ImageIndex, matcher match.Matcher) ([]v1.Image, error) {
+	matches := []v1.Image{}
+	err := walkIndex(index, map[v1.Hash]bool{}, func(parent v1.ImageIndex, desc v1.Descriptor) error {
+		if !desc.MediaType.IsImage() || !matcher(desc) {
+			return nil
+		}
+		img, err := parent.Image(desc.Digest)
+		if err != nil {
+			return err
+		}
+		matches = append(matches, img)
+		return nil
+	})
+	return matches, err
+}
+
+// FindIndexesRecursive is like FindIndexes, but also finds the matching
+// indexes nested in other indexes, depth first.
+func FindIndexesRecursive(index v1.ImageIndex, matcher match.Matcher) ([]v1.ImageIndex, error) {
+	matches := []v1.ImageIndex{}
+	err := walkIndex(index, map[v1.Hash]bool{}, func(parent v1.ImageIndex, desc v1.Descriptor) error {
+		if !desc.MediaType.IsIndex() || !matcher(desc) {
+			return nil
+		}
+		idx, err := parent.ImageIndex(desc.Digest)
+		if err != nil {
+			return err
+		}
+		matches = append(matches, idx)
+		return nil
+	})
+	return matches, err
+}
+
+// walkIndex calls fn with each child of index and its parent, descending into
+// nested indexes, each of which is visited once.
+func walkIndex(index v1.ImageIndex, seen map[v1.Hash]bool, fn func(v1.ImageIndex, v1.Descriptor) error) error {
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return fmt.Errorf("unable to get raw index: %v", err)
+	}
+	for _, desc := range indexManifest.Manifests {
+		if err := fn(index, desc); err != nil {
+			return err
+		}
+		if !desc.MediaType.IsIndex() || seen[desc.Digest] {
+			continue
+		}
+		seen[desc.Digest] = true
+		child, err := index.ImageIndex(desc.Digest)
+		if err != nil {
+			return err
+		}
+		if err := walkIndex(child, seen, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
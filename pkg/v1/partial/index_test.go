@@ -18,10 +18,13 @@ import (
 	"testing"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/match"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/types"
+	imagespec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 func TestFindManifests(t *testing.T) {
@@ -47,6 +50,47 @@ func TestFindManifests(t *testing.T) {
 	}
 }
 
+func TestFindManifestsByAnnotation(t *testing.T) {
+	want, err := random.Image(100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := random.Image(100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ii := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+		Add: want,
+		Descriptor: v1.Descriptor{
+			Annotations: map[string]string{imagespec.AnnotationRefName: "v1.2.3"},
+		},
+	}, mutate.IndexAddendum{
+		Add: other,
+		Descriptor: v1.Descriptor{
+			Annotations: map[string]string{imagespec.AnnotationRefName: "v1.2.4"},
+		},
+	})
+	// The annotation of the child manifest itself doesn't count.
+	ii = mutate.AppendManifests(ii, mutate.IndexAddendum{
+		Add: mutate.Annotations(other, map[string]string{imagespec.AnnotationRefName: "v1.2.3"}).(v1.Image),
+	})
+
+	descriptors, err := partial.FindManifests(ii, match.Annotations(map[string]string{imagespec.AnnotationRefName: "v1.2.3"}))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(descriptors) != 1 {
+		t.Fatalf("FindManifests() = %d descriptors, want 1", len(descriptors))
+	}
+	wantDigest, err := want.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := descriptors[0].Digest; got != wantDigest {
+		t.Errorf("FindManifests() = %s, want %s", got, wantDigest)
+	}
+}
+
 func TestFindImages(t *testing.T) {
 	// create our imageindex with which to work
 	ii, err := random.Index(100, 5, 6) // random image of 6 manifests, each having 5 layers of size 100
@@ -120,3 +164,56 @@ func TestFindIndexes(t *testing.T) {
 		t.Errorf("failed on index, actual %d, expected %d", len(idxes), indexCount)
 	}
 }
+
+func TestFindRecursive(t *testing.T) {
+	img, err := random.Image(100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := random.Index(100, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := mutate.AppendManifests(leaf, mutate.IndexAddendum{Add: img})
+	root := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: sub})
+
+	if descs, err := partial.FindManifests(root, match.MediaTypes(string(types.DockerManifestSchema2))); err != nil {
+		t.Fatal(err)
+	} else if len(descs) != 0 {
+		t.Errorf("FindManifests() = %d manifests, want 0", len(descs))
+	}
+
+	descs, err := partial.FindManifestsRecursive(root, func(v1.Descriptor) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	subDigest, err := sub.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The sub-index, then its children.
+	if len(descs) != 4 || descs[0].Digest != subDigest {
+		t.Errorf("FindManifestsRecursive() = %v, want sub-index and its 3 images", descs)
+	}
+
+	images, err := partial.FindImagesRecursive(root, func(v1.Descriptor) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 3 {
+		t.Errorf("FindImagesRecursive() = %d images, want 3", len(images))
+	}
+
+	indexes, err := partial.FindIndexesRecursive(root, func(v1.Descriptor) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(indexes) != 1 {
+		t.Fatalf("FindIndexesRecursive() = %d indexes, want 1", len(indexes))
+	}
+	if d, err := indexes[0].Digest(); err != nil {
+		t.Fatal(err)
+	} else if d != subDigest {
+		t.Errorf("FindIndexesRecursive()[0] = %s, want %s", d, subDigest)
+	}
+}
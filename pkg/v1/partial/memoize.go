@@ -0,0 +1,282 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package partial
+
+import (
+	"sync"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// memo holds the result of a function that is called until it succeeds.
+type memo struct {
+	mu    sync.Mutex
+	done  bool
+	value interface{}
+}
+
+func (m *memo) do(f func() (interface{}, error)) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.done {
+		return m.value, nil
+	}
+	v, err := f()
+	if err != nil {
+		return nil, err
+	}
+	m.value, m.done = v, true
+	return v, nil
+}
+
+type memoizedImage struct {
+	base v1.Image
+
+	rawManifest, rawConfigFile, manifest, configFile memo
+	mediaType, digest, configName, size, layers      memo
+	descriptor                                       memo
+
+	mu           sync.Mutex
+	layersByHash map[v1.Hash]v1.Layer
+}
+
+var _ v1.Image = (*memoizedImage)(nil)
+
+// MemoizeImage returns a v1.Image that calls each method of img until it
+// succeeds once, and returns the same result from then on, e.g. for an image
+// that is passed through several stages that each read its manifest, config
+// and layers. It is safe for concurrent use.
+//
+// Errors aren't memoized, so that calls failing with transient errors, or with
+// stream.ErrNotComputed before a stream.Layer is consumed, are retried the
+// next time. The layers are memoized with MemoizeLayer;
+// their contents are read from img every time. Manifest and ConfigFile return
+// copies, so that callers can modify them.
+func MemoizeImage(img v1.Image) v1.Image {
+	if _, ok := img.(*memoizedImage); ok {
+		return img
+	}
+	return &memoizedImage{
+		base:         img,
+		layersByHash: map[v1.Hash]v1.Layer{},
+	}
+}
+
+// RawManifest implements v1.Image.
+func (i *memoizedImage) RawManifest() ([]byte, error) {
+	v, err := i.rawManifest.do(func() (interface{}, error) { return i.base.RawManifest() })
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// RawConfigFile implements v1.Image.
+func (i *memoizedImage) RawConfigFile() ([]byte, error) {
+	v, err := i.rawConfigFile.do(func() (interface{}, error) { return i.base.RawConfigFile() })
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// Manifest implements v1.Image.
+func (i *memoizedImage) Manifest() (*v1.Manifest, error) {
+	v, err := i.manifest.do(func() (interface{}, error) { return i.base.Manifest() })
+	if err != nil {
+		return nil, err
+	}
+	return v.(*v1.Manifest).DeepCopy(), nil
+}
+
+// ConfigFile implements v1.Image.
+func (i *memoizedImage) ConfigFile() (*v1.ConfigFile, error) {
+	v, err := i.configFile.do(func() (interface{}, error) { return i.base.ConfigFile() })
+	if err != nil {
+		return nil, err
+	}
+	return v.(*v1.ConfigFile).DeepCopy(), nil
+}
+
+// MediaType implements v1.Image.
+func (i *memoizedImage) MediaType() (types.MediaType, error) {
+	v, err := i.mediaType.do(func() (interface{}, error) { return i.base.MediaType() })
+	if err != nil {
+		return "", err
+	}
+	return v.(types.MediaType), nil
+}
+
+// Digest implements v1.Image.
+func (i *memoizedImage) Digest() (v1.Hash, error) {
+	v, err := i.digest.do(func() (interface{}, error) { return i.base.Digest() })
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	return v.(v1.Hash), nil
+}
+
+// ConfigName implements v1.Image.
+func (i *memoizedImage) ConfigName() (v1.Hash, error) {
+	v, err := i.configName.do(func() (interface{}, error) { return i.base.ConfigName() })
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	return v.(v1.Hash), nil
+}
+
+// Size implements v1.Image.
+func (i *memoizedImage) Size() (int64, error) {
+	v, err := i.size.do(func() (interface{}, error) { return i.base.Size() })
+	if err != nil {
+		return -1, err
+	}
+	return v.(int64), nil
+}
+
+// Descriptor implements withDescriptor, so that Descriptor returns that of the
+// underlying image, e.g. with its platform.
+func (i *memoizedImage) Descriptor() (*v1.Descriptor, error) {
+	v, err := i.descriptor.do(func() (interface{}, error) { return Descriptor(i.base) })
+	if err != nil {
+		return nil, err
+	}
+	desc := *v.(*v1.Descriptor)
+	return &desc, nil
+}
+
+// Layers implements v1.Image.
+func (i *memoizedImage) Layers() ([]v1.Layer, error) {
+	v, err := i.layers.do(func() (interface{}, error) {
+		ls, err := i.base.Layers()
+		if err != nil {
+			return nil, err
+		}
+		memoized := make([]v1.Layer, 0, len(ls))
+		for _, l := range ls {
+			memoized = append(memoized, MemoizeLayer(l))
+		}
+		return memoized, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]v1.Layer{}, v.([]v1.Layer)...), nil
+}
+
+// LayerByDigest implements v1.Image.
+func (i *memoizedImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	return i.layerByHash(h, i.base.LayerByDigest)
+}
+
+// LayerByDiffID implements v1.Image.
+func (i *memoizedImage) LayerByDiffID(h v1.Hash) (v1.Layer, error) {
+	return i.layerByHash(h, i.base.LayerByDiffID)
+}
+
+// layerByHash memoizes the layers that were found, digests and diffids being
+// distinct.
+func (i *memoizedImage) layerByHash(h v1.Hash, get func(v1.Hash) (v1.Layer, error)) (v1.Layer, error) {
+	i.mu.Lock()
+	l, ok := i.layersByHash[h]
+	i.mu.Unlock()
+	if ok {
+		return l, nil
+	}
+
+	l, err := get(h)
+	if err != nil {
+		return nil, err
+	}
+	l = MemoizeLayer(l)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if cached, ok := i.layersByHash[h]; ok {
+		return cached, nil
+	}
+	i.layersByHash[h] = l
+	return l, nil
+}
+
+type memoizedLayer struct {
+	v1.Layer
+
+	digest, diffID, size, mediaType, descriptor memo
+}
+
+// MemoizeLayer returns a v1.Layer that calls the Digest, DiffID, Size and
+// MediaType methods of l until they succeed, like MemoizeImage. Compressed and
+// Uncompressed read from l every time.
+func MemoizeLayer(l v1.Layer) v1.Layer {
+	if _, ok := l.(*memoizedLayer); ok {
+		return l
+	}
+	return &memoizedLayer{Layer: l}
+}
+
+// Unwrap returns the memoized layer, so that callers can find out what it is,
+// e.g. remote.Write, which mounts a remote.MountableLayer from its repository.
+func (l *memoizedLayer) Unwrap() v1.Layer {
+	return l.Layer
+}
+
+// Digest implements v1.Layer.
+func (l *memoizedLayer) Digest() (v1.Hash, error) {
+	v, err := l.digest.do(func() (interface{}, error) { return l.Layer.Digest() })
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	return v.(v1.Hash), nil
+}
+
+// DiffID implements v1.Layer.
+func (l *memoizedLayer) DiffID() (v1.Hash, error) {
+	v, err := l.diffID.do(func() (interface{}, error) { return l.Layer.DiffID() })
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	return v.(v1.Hash), nil
+}
+
+// Size implements v1.Layer.
+func (l *memoizedLayer) Size() (int64, error) {
+	v, err := l.size.do(func() (interface{}, error) { return l.Layer.Size() })
+	if err != nil {
+		return -1, err
+	}
+	return v.(int64), nil
+}
+
+// MediaType implements v1.Layer.
+func (l *memoizedLayer) MediaType() (types.MediaType, error) {
+	v, err := l.mediaType.do(func() (interface{}, error) { return l.Layer.MediaType() })
+	if err != nil {
+		return "", err
+	}
+	return v.(types.MediaType), nil
+}
+
+// Descriptor implements withDescriptor, so that Descriptor returns that of the
+// underlying layer, e.g. with the URLs of a foreign layer.
+func (l *memoizedLayer) Descriptor() (*v1.Descriptor, error) {
+	v, err := l.descriptor.do(func() (interface{}, error) { return Descriptor(l.Layer) })
+	if err != nil {
+		return nil, err
+	}
+	desc := *v.(*v1.Descriptor)
+	return &desc, nil
+}
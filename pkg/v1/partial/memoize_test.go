@@ -0,0 +1,227 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package partial_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/stream"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+// countingImage counts the calls to some of the methods of v1.Image.
+type countingImage struct {
+	v1.Image
+
+	mu                                 sync.Mutex
+	rawManifest, rawConfigFile, layers int
+	err                                error
+	counted                            []*countingLayer
+}
+
+func (i *countingImage) RawManifest() ([]byte, error) {
+	i.mu.Lock()
+	i.rawManifest++
+	i.mu.Unlock()
+	if i.err != nil {
+		return nil, i.err
+	}
+	return i.Image.RawManifest()
+}
+
+func (i *countingImage) RawConfigFile() ([]byte, error) {
+	i.mu.Lock()
+	i.rawConfigFile++
+	i.mu.Unlock()
+	return i.Image.RawConfigFile()
+}
+
+func (i *countingImage) Layers() ([]v1.Layer, error) {
+	i.mu.Lock()
+	i.layers++
+	i.mu.Unlock()
+	ls, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	var counted []v1.Layer
+	for _, l := range ls {
+		cl := &countingLayer{Layer: l}
+		i.counted = append(i.counted, cl)
+		counted = append(counted, cl)
+	}
+	return counted, nil
+}
+
+// countingLayer counts the calls to DiffID.
+type countingLayer struct {
+	v1.Layer
+
+	mu     sync.Mutex
+	diffID int
+}
+
+func (l *countingLayer) DiffID() (v1.Hash, error) {
+	l.mu.Lock()
+	l.diffID++
+	l.mu.Unlock()
+	return l.Layer.DiffID()
+}
+
+func TestMemoizeImage(t *testing.T) {
+	rnd, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counting := &countingImage{Image: rnd}
+	img := partial.MemoizeImage(counting)
+
+	var wg sync.WaitGroup
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := img.RawManifest(); err != nil {
+				t.Error(err)
+			}
+			if _, err := img.RawConfigFile(); err != nil {
+				t.Error(err)
+			}
+			ls, err := img.Layers()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for _, l := range ls {
+				if _, err := l.DiffID(); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if counting.rawManifest != 1 || counting.rawConfigFile != 1 || counting.layers != 1 {
+		t.Errorf("calls: RawManifest %d, RawConfigFile %d, Layers %d, want 1 each", counting.rawManifest, counting.rawConfigFile, counting.layers)
+	}
+	if err := validate.Image(img); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+	for i, l := range counting.counted {
+		if l.diffID != 1 {
+			t.Errorf("layer %d: DiffID called %d times, want 1", i, l.diffID)
+		}
+	}
+
+	// Callers can modify the manifest without affecting the memoized one.
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Layers = nil
+	if m, err := img.Manifest(); err != nil {
+		t.Fatal(err)
+	} else if len(m.Layers) != 3 {
+		t.Errorf("len(Manifest().Layers) = %d, want 3", len(m.Layers))
+	}
+
+	if partial.MemoizeImage(img) != img {
+		t.Error("MemoizeImage(MemoizeImage(img)) wrapped again")
+	}
+}
+
+func TestMemoizeImageError(t *testing.T) {
+	rnd, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := errors.New("boom")
+	counting := &countingImage{Image: rnd, err: want}
+	img := partial.MemoizeImage(counting)
+
+	// Errors are retried.
+	for n := 0; n < 3; n++ {
+		if _, err := img.RawManifest(); err != want {
+			t.Errorf("RawManifest() = %v, want %v", err, want)
+		}
+	}
+	if counting.rawManifest != 3 {
+		t.Errorf("RawManifest called %d times, want 3", counting.rawManifest)
+	}
+
+	// Until they succeed.
+	counting.err = nil
+	for n := 0; n < 3; n++ {
+		if _, err := img.RawManifest(); err != nil {
+			t.Errorf("RawManifest() = %v", err)
+		}
+	}
+	if counting.rawManifest != 4 {
+		t.Errorf("RawManifest called %d times, want 4", counting.rawManifest)
+	}
+}
+
+func TestMemoizeStreamLayer(t *testing.T) {
+	l := partial.MemoizeLayer(stream.NewLayer(ioutil.NopCloser(strings.NewReader("hello"))))
+	if _, err := l.Digest(); err != stream.ErrNotComputed {
+		t.Fatalf("Digest() = %v, want %v", err, stream.ErrNotComputed)
+	}
+
+	rc, err := l.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Digest(); err != nil {
+		t.Errorf("Digest() after consuming the layer = %v", err)
+	}
+}
+
+func TestMemoizeLayer(t *testing.T) {
+	rnd, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls, err := rnd.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	counting := &countingLayer{Layer: ls[0]}
+	l := partial.MemoizeLayer(counting)
+	for n := 0; n < 3; n++ {
+		if _, err := l.DiffID(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if counting.diffID != 1 {
+		t.Errorf("DiffID called %d times, want 1", counting.diffID)
+	}
+	if err := validate.Layer(l); err != nil {
+		t.Errorf("validate.Layer() = %v", err)
+	}
+}
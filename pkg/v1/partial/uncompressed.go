@@ -20,6 +20,7 @@ import (
 	"sync"
 
 	"github.com/google/go-containerregistry/internal/gzip"
+	"github.com/google/go-containerregistry/internal/zstd"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 )
@@ -54,6 +55,14 @@ func (ule *uncompressedLayerExtender) Compressed() (io.ReadCloser, error) {
 	if err != nil {
 		return nil, err
 	}
+	mt, err := ule.MediaType()
+	if err != nil {
+		u.Close()
+		return nil, err
+	}
+	if mt == types.OCILayerZStd {
+		return zstd.ReadCloser(u), nil
+	}
 	return gzip.ReadCloser(u), nil
 }
 
@@ -97,10 +106,14 @@ type UncompressedImageCore interface {
 }
 
 // UncompressedToImage fills in the missing methods from an UncompressedImageCore so that it implements v1.Image.
-func UncompressedToImage(uic UncompressedImageCore) (v1.Image, error) {
-	return &uncompressedImageExtender{
+func UncompressedToImage(uic UncompressedImageCore, opts ...ImageOption) (v1.Image, error) {
+	img := &uncompressedImageExtender{
 		UncompressedImageCore: uic,
-	}, nil
+	}
+	if err := makeImageOptions(opts...).verify(img); err != nil {
+		return nil, err
+	}
+	return img, nil
 }
 
 // uncompressedImageExtender implements v1.Image by extending UncompressedImageCore with the
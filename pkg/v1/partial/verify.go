@@ -0,0 +1,95 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package partial
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ImageOption is a functional option for CompressedToImage and
+// UncompressedToImage.
+type ImageOption func(*imageOptions)
+
+type imageOptions struct {
+	verifyDiffIDs bool
+}
+
+func makeImageOptions(opts ...ImageOption) *imageOptions {
+	o := &imageOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithDiffIDVerification verifies, when the image is constructed, that the
+// uncompressed contents of each layer hash to the corresponding diff_id in
+// the config file's rootfs, and that there are as many layers as diff_ids.
+//
+// This decompresses every layer, so it's off by default. Non-distributable
+// layers, which usually can't be fetched, are only counted.
+func WithDiffIDVerification() ImageOption {
+	return func(o *imageOptions) {
+		o.verifyDiffIDs = true
+	}
+}
+
+func (o *imageOptions) verify(img v1.Image) error {
+	if !o.verifyDiffIDs {
+		return nil
+	}
+	return verifyDiffIDs(img)
+}
+
+// verifyDiffIDs checks the layers of img against its config file.
+func verifyDiffIDs(img v1.Image) error {
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return err
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		return err
+	}
+	diffIDs := cf.RootFS.DiffIDs
+	if len(m.Layers) != len(diffIDs) {
+		return fmt.Errorf("manifest has %d layers, but config has %d diff_ids", len(m.Layers), len(diffIDs))
+	}
+
+	for i, desc := range m.Layers {
+		if !desc.MediaType.IsDistributable() {
+			continue
+		}
+		l, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return err
+		}
+		rc, err := l.Uncompressed()
+		if err != nil {
+			return err
+		}
+		got, _, err := v1.Compute(diffIDs[i].Algorithm, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("computing diff_id of layer %d (%s): %v", i, desc.Digest, err)
+		}
+		if got != diffIDs[i] {
+			return fmt.Errorf("layer %d (%s) has diff_id %s, but config has %s", i, desc.Digest, got, diffIDs[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package partial_test
+
+import (
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// compressedCore exposes a v1.Image as a partial.CompressedImageCore, serving
+// the contents of other layers in place of the ones in swap.
+type compressedCore struct {
+	img  v1.Image
+	swap map[v1.Hash]v1.Layer
+}
+
+func (c *compressedCore) RawConfigFile() ([]byte, error) { return c.img.RawConfigFile() }
+
+func (c *compressedCore) MediaType() (types.MediaType, error) { return c.img.MediaType() }
+
+func (c *compressedCore) RawManifest() ([]byte, error) { return c.img.RawManifest() }
+
+func (c *compressedCore) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	if l, ok := c.swap[h]; ok {
+		return l, nil
+	}
+	return c.img.LayerByDigest(h)
+}
+
+func TestWithDiffIDVerification(t *testing.T) {
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := partial.CompressedToImage(&compressedCore{img: img}, partial.WithDiffIDVerification()); err != nil {
+		t.Errorf("CompressedToImage() = %v", err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := layers[0].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	core := &compressedCore{
+		img:  img,
+		swap: map[v1.Hash]v1.Layer{digest: layers[1]},
+	}
+
+	// The misassembled image is only caught when asked to.
+	if _, err := partial.CompressedToImage(core); err != nil {
+		t.Errorf("CompressedToImage() = %v", err)
+	}
+	_, err = partial.CompressedToImage(core, partial.WithDiffIDVerification())
+	if err == nil {
+		t.Fatal("CompressedToImage() = nil, wanted diff_id mismatch")
+	}
+	if !strings.Contains(err.Error(), digest.String()) {
+		t.Errorf("CompressedToImage() = %v, wanted error mentioning %s", err, digest)
+	}
+}
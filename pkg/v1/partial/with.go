@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"strings"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/types"
@@ -120,7 +121,39 @@ func DiffIDs(i WithConfigFile) ([]v1.Hash, error) {
 	return cfg.RootFS.DiffIDs, nil
 }
 
+// ChainIDs is a helper for computing the chain ID of each layer, i.e. of the
+// filesystem it and the layers below it make up, by which containerd and the
+// kubelet identify the snapshots of an image:
+//
+//	ChainID(L0) = DiffID(L0)
+//	ChainID(L0|...|Ln) = SHA256(ChainID(L0|...|Ln-1) + " " + DiffID(Ln))
+//
+// See https://github.com/opencontainers/image-spec/blob/master/config.md#layer-chainid
+func ChainIDs(i WithConfigFile) ([]v1.Hash, error) {
+	diffIDs, err := DiffIDs(i)
+	if err != nil {
+		return nil, err
+	}
+	chainIDs := make([]v1.Hash, 0, len(diffIDs))
+	for j, diffID := range diffIDs {
+		if j == 0 {
+			chainIDs = append(chainIDs, diffID)
+			continue
+		}
+		h, _, err := v1.SHA256(strings.NewReader(chainIDs[j-1].String() + " " + diffID.String()))
+		if err != nil {
+			return nil, err
+		}
+		chainIDs = append(chainIDs, h)
+	}
+	return chainIDs, nil
+}
+
 // RawConfigFile is a helper for implementing v1.Image
+//
+// It only works for image configs, since it serializes ConfigFile. Artifacts
+// with other configs should implement RawConfigFile by returning the bytes of
+// their config as they are, see ConfigFileOrNil.
 func RawConfigFile(i WithConfigFile) ([]byte, error) {
 	cfg, err := i.ConfigFile()
 	if err != nil {
@@ -136,12 +169,25 @@ type WithRawManifest interface {
 }
 
 // Digest is a helper for implementing v1.Image
+//
+// The digest is computed with sha256, unless i has a Descriptor (see
+// withDescriptor) that declares a different algorithm.
 func Digest(i WithRawManifest) (v1.Hash, error) {
 	mb, err := i.RawManifest()
 	if err != nil {
 		return v1.Hash{}, err
 	}
-	digest, _, err := v1.SHA256(bytes.NewReader(mb))
+	algorithm := "sha256"
+	if wd, ok := i.(withDescriptor); ok {
+		desc, err := wd.Descriptor()
+		if err != nil {
+			return v1.Hash{}, err
+		}
+		if desc != nil && desc.Digest.Algorithm != "" {
+			algorithm = desc.Digest.Algorithm
+		}
+	}
+	digest, _, err := v1.Compute(algorithm, bytes.NewReader(mb))
 	return digest, err
 }
 
@@ -271,6 +317,27 @@ func DiffIDToBlob(wm WithManifestAndConfigFile, h v1.Hash) (v1.Hash, error) {
 	return v1.Hash{}, fmt.Errorf("unknown diffID %v", h)
 }
 
+// ConfigFileOrNil is like ConfigFile, but returns nil without an error for
+// artifacts whose config has a media type other than an image config, e.g.
+// an attestation, which may not parse as a v1.ConfigFile.
+//
+// For such artifacts, everything derived from the config is meaningless:
+// DiffIDs, BlobToDiffID, DiffIDToBlob and LayerByDiffID, as well as the
+// history, platform and runtime configuration. Their blobs are only listed in
+// the manifest and accessed with LayerByDigest, and their config is accessed
+// with RawConfigFile, which returns it as it is.
+func ConfigFileOrNil(i WithManifestAndConfigFile) (*v1.ConfigFile, error) {
+	m, err := i.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	// Some old images don't set the config media type at all.
+	if mt := m.Config.MediaType; mt != "" && !mt.IsConfig() {
+		return nil, nil
+	}
+	return i.ConfigFile()
+}
+
 // WithDiffID defines the subset of v1.Layer for exposing the DiffID method.
 type WithDiffID interface {
 	DiffID() (v1.Hash, error)
@@ -295,6 +362,10 @@ type Describable interface {
 // some logic for unwrapping things that have been wrapped by
 // CompressedToLayer, UncompressedToLayer, CompressedToImage, or
 // UncompressedToImage.
+//
+// Both v1.Image and v1.Layer are Describable. For layers whose digest and
+// size aren't known until they have been read, like stream.Layer, the error
+// of Size or Digest is returned, e.g. stream.ErrNotComputed.
 func Descriptor(d Describable) (*v1.Descriptor, error) {
 	// If Describable implements Descriptor itself, return that.
 	if wd, ok := unwrap(d).(withDescriptor); ok {
@@ -320,6 +391,28 @@ func Descriptor(d Describable) (*v1.Descriptor, error) {
 	return &desc, nil
 }
 
+// ImageDescriptor returns the v1.Descriptor of img like Descriptor, with the
+// Platform set from its config file, as needed for the manifests of an index.
+// See v1.ConfigFile.Platform.
+func ImageDescriptor(img v1.Image) (*v1.Descriptor, error) {
+	d, err := Descriptor(img)
+	if err != nil {
+		return nil, err
+	}
+	// Don't modify the descriptor of the underlying implementation.
+	desc := *d
+	if desc.Platform != nil {
+		return &desc, nil
+	}
+
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	desc.Platform = cf.Platform()
+	return &desc, nil
+}
+
 type withUncompressedSize interface {
 	UncompressedSize() (int64, error)
 }
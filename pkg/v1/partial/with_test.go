@@ -15,12 +15,19 @@
 package partial_test
 
 import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/stream"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
@@ -45,6 +52,77 @@ func TestRawConfigFile(t *testing.T) {
 	}
 }
 
+func TestConfigFileOrNil(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := partial.ConfigFileOrNil(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cf == nil {
+		t.Error("ConfigFileOrNil(image) = nil")
+	}
+
+	artifact := mutate.ConfigMediaType(img, "application/vnd.in-toto+json")
+	cf, err = partial.ConfigFileOrNil(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cf != nil {
+		t.Errorf("ConfigFileOrNil(artifact) = %v, want nil", cf)
+	}
+}
+
+func TestChainIDs(t *testing.T) {
+	// Computed with ChainIDs from github.com/opencontainers/image-spec/identity,
+	// which containerd uses.
+	diffIDs := []v1.Hash{
+		mustHash(t, "sha256:54db133a109fd7f0d6eb72da16df1af078f2bf86e917ae3c780a13d811d6aa6f"),
+		mustHash(t, "sha256:0c6eea24ed5f3274df121af2d789e43839b3bcfb328db8deb86b46896d57be67"),
+		mustHash(t, "sha256:ffcc470fc39ff18296430efbde2a2d832944bb84220e235a99f76742d6bccbd4"),
+	}
+	want := []v1.Hash{
+		mustHash(t, "sha256:54db133a109fd7f0d6eb72da16df1af078f2bf86e917ae3c780a13d811d6aa6f"),
+		mustHash(t, "sha256:331cf69a5e42a61e3645ccd6f7963c333d64ca1f850f6190d98a6ad75c7606de"),
+		mustHash(t, "sha256:e98ce6bf1cf401b5454f040d3c54010716976289963493c43fc37108ab19d384"),
+	}
+
+	for i := range diffIDs {
+		img, err := mutate.ConfigFile(empty.Image, &v1.ConfigFile{
+			RootFS: v1.RootFS{Type: "layers", DiffIDs: diffIDs[:i+1]},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := partial.ChainIDs(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want[:i+1], got); diff != "" {
+			t.Errorf("ChainIDs() with %d layers (-want +got) = %s", i+1, diff)
+		}
+	}
+
+	got, err := partial.ChainIDs(empty.Image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("ChainIDs(empty.Image) = %v", got)
+	}
+}
+
+func mustHash(t *testing.T, s string) v1.Hash {
+	t.Helper()
+	h, err := v1.NewHash(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
 func TestDigest(t *testing.T) {
 	img, err := random.Image(1024, 1)
 	if err != nil {
@@ -66,6 +144,35 @@ func TestDigest(t *testing.T) {
 	}
 }
 
+type describedManifest struct {
+	raw  []byte
+	desc *v1.Descriptor
+}
+
+func (d *describedManifest) RawManifest() ([]byte, error)        { return d.raw, nil }
+func (d *describedManifest) Descriptor() (*v1.Descriptor, error) { return d.desc, nil }
+
+func TestDigestAlgorithm(t *testing.T) {
+	raw := []byte(`{"schemaVersion":2}`)
+	want, _, err := v1.SHA512(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := partial.Digest(&describedManifest{raw: raw, desc: &v1.Descriptor{Digest: want}})
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+	if got != want {
+		t.Errorf("Digest() = %s, want %s", got, want)
+	}
+
+	unknown := &v1.Descriptor{Digest: v1.Hash{Algorithm: "md5", Hex: "abcd"}}
+	if _, err := partial.Digest(&describedManifest{raw: raw, desc: unknown}); err == nil || !strings.Contains(err.Error(), "unsupported algorithm") {
+		t.Errorf("Digest() = %v, want unsupported algorithm error", err)
+	}
+}
+
 func TestManifest(t *testing.T) {
 	img, err := random.Image(1024, 1)
 	if err != nil {
@@ -244,3 +351,65 @@ func TestExists(t *testing.T) {
 		t.Errorf("Exists() = %t != %t", got, want)
 	}
 }
+
+func TestImageDescriptor(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf.OS = "windows"
+	cf.Architecture = "amd64"
+	cf.OSVersion = "10.0.17763.1879"
+	img, err = mutate.ConfigFile(img, cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc, err := partial.ImageDescriptor(img)
+	if err != nil {
+		t.Fatalf("ImageDescriptor() = %v", err)
+	}
+	d, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := img.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &v1.Descriptor{
+		MediaType: types.DockerManifestSchema2,
+		Size:      size,
+		Digest:    d,
+		Platform: &v1.Platform{
+			Architecture: "amd64",
+			OS:           "windows",
+			OSVersion:    "10.0.17763.1879",
+		},
+	}
+	if diff := cmp.Diff(want, desc); diff != "" {
+		t.Errorf("ImageDescriptor() (-want +got) = %s", diff)
+	}
+
+	// random.Image doesn't set a platform.
+	img, err = random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc, err := partial.ImageDescriptor(img); err != nil {
+		t.Errorf("ImageDescriptor() = %v", err)
+	} else if desc.Platform != nil {
+		t.Errorf("ImageDescriptor().Platform = %v, want nil", desc.Platform)
+	}
+}
+
+func TestDescriptorStreamingLayer(t *testing.T) {
+	l := stream.NewLayer(ioutil.NopCloser(strings.NewReader("not read yet")))
+	if _, err := partial.Descriptor(l); !errors.Is(err, stream.ErrNotComputed) {
+		t.Errorf("Descriptor() = %v, want %v", err, stream.ErrNotComputed)
+	}
+}
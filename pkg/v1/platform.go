@@ -16,6 +16,7 @@ package v1
 
 import (
 	"sort"
+	"strings"
 )
 
 // Platform represents the target os/arch for an image.
@@ -35,6 +36,46 @@ func (p Platform) Equals(o Platform) bool {
 		stringSliceEqualIgnoreOrder(p.OSFeatures, o.OSFeatures) && stringSliceEqualIgnoreOrder(p.Features, o.Features)
 }
 
+// Satisfies returns true if this platform satisfies the spec, e.g. a platform
+// requested by the user.
+//
+// Empty fields of the spec match anything. Otherwise, the architecture, OS
+// and variant must be identical, e.g. arm/v6 doesn't satisfy arm/v7, and the
+// features and OS features of the spec must be a subset of this platform's.
+// An OS version of the spec is satisfied by the same version or a more
+// specific one, so that Windows' "10.0.17763" is satisfied by "10.0.17763.1879",
+// but not by "10.0.20348.643".
+func (p Platform) Satisfies(spec Platform) bool {
+	return satisfies(spec.Architecture, p.Architecture) &&
+		satisfies(spec.OS, p.OS) &&
+		satisfies(spec.Variant, p.Variant) &&
+		satisfiesOSVersion(spec.OSVersion, p.OSVersion) &&
+		isSubset(p.OSFeatures, spec.OSFeatures) &&
+		isSubset(p.Features, spec.Features)
+}
+
+func satisfies(want, have string) bool {
+	return want == "" || want == have
+}
+
+func satisfiesOSVersion(want, have string) bool {
+	return satisfies(want, have) || strings.HasPrefix(have, want+".")
+}
+
+// isSubset checks if the required strings are a subset of lst.
+func isSubset(lst, required []string) bool {
+	set := make(map[string]bool)
+	for _, value := range lst {
+		set[value] = true
+	}
+	for _, value := range required {
+		if !set[value] {
+			return false
+		}
+	}
+	return true
+}
+
 // stringSliceEqual compares 2 string slices and returns if their contents are identical.
 func stringSliceEqual(a, b []string) bool {
 	if len(a) != len(b) {
@@ -50,7 +91,8 @@ func stringSliceEqual(a, b []string) bool {
 
 // stringSliceEqualIgnoreOrder compares 2 string slices and returns if their contents are identical, ignoring order
 func stringSliceEqualIgnoreOrder(a, b []string) bool {
-	a1, b1 := a[:], b[:]
+	// Copy the slices, so that sorting them doesn't modify the platforms.
+	a1, b1 := append([]string(nil), a...), append([]string(nil), b...)
 	if a1 != nil && b1 != nil {
 		sort.Strings(a1)
 		sort.Strings(b1)
@@ -51,3 +51,50 @@ func TestPlatformEquals(t *testing.T) {
 		}
 	}
 }
+
+func TestPlatformSatisfies(t *testing.T) {
+	ltsc2019 := v1.Platform{Architecture: "amd64", OS: "windows", OSVersion: "10.0.17763.1879"}
+	ltsc2022 := v1.Platform{Architecture: "amd64", OS: "windows", OSVersion: "10.0.20348.643"}
+	armv6 := v1.Platform{Architecture: "arm", OS: "linux", Variant: "v6"}
+	armv7 := v1.Platform{Architecture: "arm", OS: "linux", Variant: "v7"}
+
+	tests := []struct {
+		p    v1.Platform
+		spec v1.Platform
+		want bool
+	}{
+		{ltsc2019, v1.Platform{Architecture: "amd64", OS: "windows"}, true},
+		{ltsc2019, v1.Platform{Architecture: "amd64", OS: "windows", OSVersion: "10.0.17763.1879"}, true},
+		{ltsc2019, v1.Platform{Architecture: "amd64", OS: "windows", OSVersion: "10.0.17763"}, true},
+		{ltsc2022, v1.Platform{Architecture: "amd64", OS: "windows", OSVersion: "10.0.17763"}, false},
+		{ltsc2022, v1.Platform{Architecture: "amd64", OS: "windows", OSVersion: "10.0.20348"}, true},
+		{ltsc2022, v1.Platform{Architecture: "amd64", OS: "windows", OSVersion: "10.0.2"}, false},
+		{ltsc2019, v1.Platform{Architecture: "amd64", OS: "linux"}, false},
+
+		{armv6, v1.Platform{Architecture: "arm", OS: "linux"}, true},
+		{armv6, v1.Platform{Architecture: "arm", OS: "linux", Variant: "v7"}, false},
+		{armv7, v1.Platform{Architecture: "arm", OS: "linux", Variant: "v7"}, true},
+		{v1.Platform{Architecture: "arm", OS: "linux"}, v1.Platform{Architecture: "arm", OS: "linux", Variant: "v7"}, false},
+
+		{v1.Platform{Architecture: "amd64", OS: "linux", OSFeatures: []string{"a", "b"}}, v1.Platform{OSFeatures: []string{"b"}}, true},
+		{v1.Platform{Architecture: "amd64", OS: "linux", OSFeatures: []string{"a"}}, v1.Platform{OSFeatures: []string{"b"}}, false},
+		{v1.Platform{Architecture: "amd64", OS: "linux", Features: []string{"sse4"}}, v1.Platform{Features: []string{"sse4"}}, true},
+		{v1.Platform{Architecture: "amd64", OS: "linux"}, v1.Platform{}, true},
+	}
+	for i, tt := range tests {
+		if got := tt.p.Satisfies(tt.spec); got != tt.want {
+			t.Errorf("%d: %v.Satisfies(%v) = %v, want %v", i, tt.p, tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestPlatformEqualsDoesNotSort(t *testing.T) {
+	a := v1.Platform{OSFeatures: []string{"b", "a"}}
+	b := v1.Platform{OSFeatures: []string{"a", "b"}}
+	if !a.Equals(b) {
+		t.Fatal("Equals() = false, want true")
+	}
+	if diff := cmp.Diff([]string{"b", "a"}, a.OSFeatures); diff != "" {
+		t.Errorf("Equals() modified OSFeatures (-want +got) = %s", diff)
+	}
+}
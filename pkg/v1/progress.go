@@ -22,4 +22,9 @@ type Update struct {
 	Total    int64
 	Complete int64
 	Error    error
+
+	// Mounted is set to the digest of a blob when this update reports that
+	// blob as having been mounted from another repository, rather than
+	// uploaded.
+	Mounted *Hash
 }
@@ -58,10 +58,23 @@ func (ul *uncompressedLayer) MediaType() (types.MediaType, error) {
 var _ partial.UncompressedLayer = (*uncompressedLayer)(nil)
 
 // Image returns a pseudo-randomly generated Image.
-func Image(byteSize, layers int64) (v1.Image, error) {
+func Image(byteSize, layers int64, opts ...Option) (v1.Image, error) {
+	o := makeOptions(opts...)
+	layerType := types.DockerLayer
+	if o.mediaType == types.OCIManifestSchema1 {
+		layerType = types.OCILayer
+	}
+
+	created := v1.Time{Time: time.Now()}
+	var layerOpts []Option
+	if o.source != nil {
+		created = v1.Time{}
+		layerOpts = append(layerOpts, WithSource(o.source))
+	}
+
 	adds := make([]mutate.Addendum, 0, 5)
 	for i := int64(0); i < layers; i++ {
-		layer, err := Layer(byteSize, types.DockerLayer)
+		layer, err := Layer(byteSize, layerType, layerOpts...)
 		if err != nil {
 			return nil, err
 		}
@@ -71,17 +84,56 @@ func Image(byteSize, layers int64) (v1.Image, error) {
 				Author:    "random.Image",
 				Comment:   fmt.Sprintf("this is a random history %d of %d", i, layers),
 				CreatedBy: "random",
-				Created:   v1.Time{Time: time.Now()},
+				Created:   created,
 			},
 		})
 	}
 
-	return mutate.Append(empty.Image, adds...)
+	img, err := mutate.Append(empty.Image, adds...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(o.platforms) != 0 {
+		p := o.platforms[len(o.platforms)-1]
+		cf, err := img.ConfigFile()
+		if err != nil {
+			return nil, err
+		}
+		cf = cf.DeepCopy()
+		cf.OS = p.OS
+		cf.Architecture = p.Architecture
+		cf.Variant = p.Variant
+		cf.OSVersion = p.OSVersion
+		img, err = mutate.ConfigFile(img, cf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if o.mediaType != "" {
+		img = mutate.MediaType(img, o.mediaType)
+		if o.mediaType == types.OCIManifestSchema1 {
+			img = mutate.ConfigMediaType(img, types.OCIConfigJSON)
+		}
+	}
+	return img, nil
 }
 
 // Layer returns a layer with pseudo-randomly generated content.
-func Layer(byteSize int64, mt types.MediaType) (v1.Layer, error) {
-	fileName := fmt.Sprintf("random_file_%d.txt", mrand.Int())
+//
+// Only WithSource and WithSeed apply to Layer; other options are ignored.
+func Layer(byteSize int64, mt types.MediaType, opts ...Option) (v1.Layer, error) {
+	o := makeOptions(opts...)
+	var (
+		fileName = fmt.Sprintf("random_file_%d.txt", mrand.Int())
+		content  = rand.Reader
+	)
+	if o.source != nil {
+		rnd := mrand.New(o.source)
+		fileName = fmt.Sprintf("random_file_%d.txt", rnd.Int())
+		content = rnd
+	}
 
 	// Hash the contents as we write it out to the buffer.
 	var b bytes.Buffer
@@ -97,7 +149,7 @@ func Layer(byteSize int64, mt types.MediaType) (v1.Layer, error) {
 	}); err != nil {
 		return nil, err
 	}
-	if _, err := io.CopyN(tw, rand.Reader, byteSize); err != nil {
+	if _, err := io.CopyN(tw, content, byteSize); err != nil {
 		return nil, err
 	}
 	if err := tw.Close(); err != nil {
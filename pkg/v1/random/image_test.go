@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"testing"
 
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
 )
@@ -127,3 +128,69 @@ func TestRandomLayer(t *testing.T) {
 		t.Errorf("Layer contained more files; got %v, want EOF", err)
 	}
 }
+
+func TestImageOptions(t *testing.T) {
+	platform := v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+	img, err := Image(1024, 2, WithPlatform(platform), WithMediaType(types.OCIManifestSchema1))
+	if err != nil {
+		t.Fatalf("Image: %v", err)
+	}
+	if err := validate.Image(img); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cf.Platform(); !got.Equals(platform) {
+		t.Errorf("Platform() = %v, want %v", got, platform)
+	}
+
+	if mt, err := img.MediaType(); err != nil {
+		t.Fatal(err)
+	} else if want := types.OCIManifestSchema1; mt != want {
+		t.Errorf("MediaType() = %v, want %v", mt, want)
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Config.MediaType, types.OCIConfigJSON; got != want {
+		t.Errorf("Config.MediaType = %v, want %v", got, want)
+	}
+	for _, l := range m.Layers {
+		if got, want := l.MediaType, types.OCILayer; got != want {
+			t.Errorf("layer MediaType = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestImageSeed(t *testing.T) {
+	digest := func(opts ...Option) v1.Hash {
+		t.Helper()
+		img, err := Image(1024, 3, opts...)
+		if err != nil {
+			t.Fatalf("Image: %v", err)
+		}
+		d, err := img.Digest()
+		if err != nil {
+			t.Fatalf("Digest: %v", err)
+		}
+		return d
+	}
+
+	if got, want := digest(WithSeed(42)), digest(WithSeed(42)); got != want {
+		t.Errorf("same seed: got %v, want %v", got, want)
+	}
+	seed := WithSeed(42)
+	if got, want := digest(seed), digest(seed); got != want {
+		t.Errorf("reused seed: got %v, want %v", got, want)
+	}
+	if a, b := digest(WithSeed(42)), digest(WithSeed(43)); a == b {
+		t.Errorf("different seeds produced the same digest %v", a)
+	}
+	if a, b := digest(), digest(); a == b {
+		t.Errorf("unseeded images produced the same digest %v", a)
+	}
+}
@@ -25,21 +25,55 @@ import (
 )
 
 type randomIndex struct {
-	images   map[v1.Hash]v1.Image
-	manifest *v1.IndexManifest
+	images    map[v1.Hash]v1.Image
+	manifest  *v1.IndexManifest
+	mediaType types.MediaType
 }
 
 // Index returns a pseudo-randomly generated ImageIndex with count images, each
 // having the given number of layers of size byteSize.
-func Index(byteSize, layers, count int64) (v1.ImageIndex, error) {
+//
+// With WithPlatform, the index has one image per platform instead, and their
+// descriptors carry the platform, like those of a multi-arch image.
+func Index(byteSize, layers, count int64, opts ...Option) (v1.ImageIndex, error) {
+	o := makeOptions(opts...)
+	mt := types.OCIImageIndex
+	var imgOpts []Option
+	switch o.mediaType {
+	case "":
+	case types.DockerManifestList:
+		mt = o.mediaType
+		imgOpts = append(imgOpts, WithMediaType(types.DockerManifestSchema2))
+	case types.OCIImageIndex:
+		imgOpts = append(imgOpts, WithMediaType(types.OCIManifestSchema1))
+	default:
+		return nil, fmt.Errorf("unsupported index media type: %s", o.mediaType)
+	}
+	if o.source != nil {
+		imgOpts = append(imgOpts, WithSource(o.source))
+	}
+
+	var platforms []*v1.Platform
+	for i := range o.platforms {
+		platforms = append(platforms, &o.platforms[i])
+	}
+	if len(platforms) == 0 {
+		platforms = make([]*v1.Platform, count)
+	}
+
 	manifest := v1.IndexManifest{
 		SchemaVersion: 2,
+		MediaType:     o.mediaType,
 		Manifests:     []v1.Descriptor{},
 	}
 
 	images := make(map[v1.Hash]v1.Image)
-	for i := int64(0); i < count; i++ {
-		img, err := Image(byteSize, layers)
+	for _, platform := range platforms {
+		opts := imgOpts
+		if platform != nil {
+			opts = append(opts[:len(opts):len(opts)], WithPlatform(*platform))
+		}
+		img, err := Image(byteSize, layers, opts...)
 		if err != nil {
 			return nil, err
 		}
@@ -61,19 +95,21 @@ func Index(byteSize, layers, count int64) (v1.ImageIndex, error) {
 			Digest:    digest,
 			Size:      size,
 			MediaType: mediaType,
+			Platform:  platform,
 		})
 
 		images[digest] = img
 	}
 
 	return &randomIndex{
-		images:   images,
-		manifest: &manifest,
+		images:    images,
+		manifest:  &manifest,
+		mediaType: mt,
 	}, nil
 }
 
 func (i *randomIndex) MediaType() (types.MediaType, error) {
-	return types.OCIImageIndex, nil
+	return i.mediaType, nil
 }
 
 func (i *randomIndex) Digest() (v1.Hash, error) {
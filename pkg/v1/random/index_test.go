@@ -17,6 +17,7 @@ package random
 import (
 	"testing"
 
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
 )
@@ -53,3 +54,81 @@ func TestRandomIndex(t *testing.T) {
 		t.Errorf("MediaType(): got: %v, want: %v", got, want)
 	}
 }
+
+func TestRandomIndexPlatforms(t *testing.T) {
+	platforms := []v1.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm", Variant: "v7"},
+		{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.1040"},
+	}
+	opts := []Option{WithMediaType(types.DockerManifestList)}
+	for _, p := range platforms {
+		opts = append(opts, WithPlatform(p))
+	}
+	// The count is ignored in favor of the platforms.
+	ii, err := Index(1024, 1, 1, opts...)
+	if err != nil {
+		t.Fatalf("Error loading index: %v", err)
+	}
+	if err := validate.Index(ii); err != nil {
+		t.Errorf("validate.Index() = %v", err)
+	}
+
+	if mt, err := ii.MediaType(); err != nil {
+		t.Fatal(err)
+	} else if mt != types.DockerManifestList {
+		t.Errorf("MediaType(): got: %v, want: %v", mt, types.DockerManifestList)
+	}
+
+	im, err := ii.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(im.Manifests), len(platforms); got != want {
+		t.Fatalf("len(Manifests) = %d, want %d", got, want)
+	}
+	for i, desc := range im.Manifests {
+		if desc.Platform == nil || !desc.Platform.Equals(platforms[i]) {
+			t.Errorf("Manifests[%d].Platform = %v, want %v", i, desc.Platform, platforms[i])
+		}
+		if got, want := desc.MediaType, types.DockerManifestSchema2; got != want {
+			t.Errorf("Manifests[%d].MediaType = %v, want %v", i, got, want)
+		}
+		img, err := ii.Image(desc.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cf, err := img.ConfigFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cf.Platform(); !got.Equals(platforms[i]) {
+			t.Errorf("config platform = %v, want %v", got, platforms[i])
+		}
+	}
+}
+
+func TestRandomIndexSeed(t *testing.T) {
+	digest := func(seed int64) v1.Hash {
+		t.Helper()
+		ii, err := Index(1024, 2, 3, WithSeed(seed))
+		if err != nil {
+			t.Fatalf("Index: %v", err)
+		}
+		if err := validate.Index(ii); err != nil {
+			t.Errorf("validate.Index() = %v", err)
+		}
+		d, err := ii.Digest()
+		if err != nil {
+			t.Fatalf("Digest: %v", err)
+		}
+		return d
+	}
+
+	if got, want := digest(7), digest(7); got != want {
+		t.Errorf("same seed: got %v, want %v", got, want)
+	}
+	if a, b := digest(7), digest(8); a == b {
+		t.Errorf("different seeds produced the same digest %v", a)
+	}
+}
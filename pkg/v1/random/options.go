@@ -0,0 +1,87 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package random
+
+import (
+	"math/rand"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Option is a functional option for Image and Index.
+type Option func(*options)
+
+type options struct {
+	platforms []v1.Platform
+	mediaType types.MediaType
+	source    rand.Source
+	seed      *int64
+}
+
+func makeOptions(opts ...Option) options {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	// Each call gets its own source, so that reusing the option reproduces
+	// the same content.
+	if o.seed != nil {
+		o.source = rand.NewSource(*o.seed)
+	}
+	return o
+}
+
+// WithPlatform sets the os, architecture and variant in the config of the
+// image, e.g. for testing platform matching.
+//
+// For Index, each WithPlatform adds one image for that platform, and the index
+// has those images instead of count random ones.
+func WithPlatform(platform v1.Platform) Option {
+	return func(o *options) {
+		o.platforms = append(o.platforms, platform)
+	}
+}
+
+// WithMediaType sets the media type of the manifest, e.g. to
+// types.OCIManifestSchema1 for an OCI image with OCI layers and config.
+//
+// For Index, it sets the media type of the index, e.g. to
+// types.DockerManifestList, and its images are of the matching kind.
+func WithMediaType(mt types.MediaType) Option {
+	return func(o *options) {
+		o.mediaType = mt
+	}
+}
+
+// WithSource sets the source of randomness for the generated content, so that
+// calls with equivalent sources and the same options produce byte-identical
+// results. Timestamps in the history are zero instead of the current time.
+//
+// By default, content is read from crypto/rand.
+func WithSource(source rand.Source) Option {
+	return func(o *options) {
+		o.source = source
+		o.seed = nil
+	}
+}
+
+// WithSeed is like WithSource(rand.NewSource(seed)), but each call that it's
+// passed to starts from a new source, so it can be reused.
+func WithSeed(seed int64) Option {
+	return func(o *options) {
+		o.seed = &seed
+	}
+}
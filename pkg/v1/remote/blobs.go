@@ -0,0 +1,131 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/google/go-containerregistry/internal/redact"
+	"github.com/google/go-containerregistry/internal/verify"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// BlobStore reads and writes the blobs of a repository by digest, see
+// partial.WithBlob and partial.WithWriteBlob. E.g. partial.CopyBlob copies a
+// blob between a layout.Path and a BlobStore.
+type BlobStore struct {
+	repo name.Repository
+	o    *options
+
+	fetcherOnce sync.Once
+	fetcher     *fetcher
+	fetcherErr  error
+
+	writerOnce sync.Once
+	writer     *writer
+	writerErr  error
+}
+
+var (
+	_ partial.WithBlob      = (*BlobStore)(nil)
+	_ partial.WithWriteBlob = (*BlobStore)(nil)
+)
+
+// Blobs returns a BlobStore for the blobs of repo. The registry is only
+// contacted, with pull or push scope, once blobs are read or written.
+func Blobs(repo name.Repository, options ...Option) (*BlobStore, error) {
+	o, err := makeOptions(repo, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &BlobStore{repo: repo, o: o}, nil
+}
+
+// Blob implements partial.WithBlob. The contents are verified against h as
+// they are read.
+func (b *BlobStore) Blob(h v1.Hash) (io.ReadCloser, error) {
+	f, err := b.makeFetcher(h)
+	if err != nil {
+		return nil, err
+	}
+	// We don't want to log binary layers -- this can break terminals.
+	ctx := redact.NewContext(f.context, "omitting binary blobs from logs")
+	return f.fetchBlob(ctx, verify.SizeUnknown, h)
+}
+
+// Exists returns whether the blob h exists in the repository, by issuing a
+// HEAD request, like BlobExists, but reusing the connection to the registry.
+func (b *BlobStore) Exists(h v1.Hash) (bool, error) {
+	f, err := b.makeFetcher(h)
+	if err != nil {
+		return false, err
+	}
+	return f.blobExists(h)
+}
+
+// makeFetcher returns the fetcher for reading blobs, creating it on first use
+// with a reference to h, although it's used for other blobs of the
+// repository, too.
+func (b *BlobStore) makeFetcher(h v1.Hash) (*fetcher, error) {
+	b.fetcherOnce.Do(func() {
+		b.fetcher, b.fetcherErr = makeFetcher(b.repo.Digest(h.String()), b.o)
+	})
+	return b.fetcher, b.fetcherErr
+}
+
+// WriteBlob implements partial.WithWriteBlob. The blob is not uploaded if it
+// already exists in the repository.
+func (b *BlobStore) WriteBlob(h v1.Hash, rc io.ReadCloser) error {
+	defer rc.Close()
+	b.writerOnce.Do(func() {
+		scopes := []string{b.repo.Scope(transport.PushScope)}
+		tr, err := b.o.newTransport(b.repo.Registry, scopes)
+		if err != nil {
+			b.writerErr = err
+			return
+		}
+		b.writer = &writer{
+			repo:    b.repo,
+			client:  &http.Client{Transport: tr},
+			context: b.o.context,
+		}
+	})
+	if b.writerErr != nil {
+		return b.writerErr
+	}
+
+	w := b.writer
+	existing, err := w.checkExistingBlob(h)
+	if err != nil {
+		return err
+	}
+	if existing {
+		return nil
+	}
+	location, _, err := w.initiateUpload("", "")
+	if err != nil {
+		return err
+	}
+	ctx := redact.NewContext(w.context, "omitting binary blobs from logs")
+	if location, err = w.streamBlob(ctx, rc, location); err != nil {
+		return err
+	}
+	return w.commitBlob(location, h.String())
+}
@@ -0,0 +1,194 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+// imageDigests returns the digests of the config and layers of img.
+func imageDigests(t *testing.T, img v1.Image) []v1.Hash {
+	t.Helper()
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digests := []v1.Hash{m.Config.Digest}
+	for _, l := range m.Layers {
+		digests = append(digests, l.Digest)
+	}
+	return digests
+}
+
+func tempLayout(t *testing.T) layout.Path {
+	t.Helper()
+	tmp, err := ioutil.TempDir("", "remote-blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmp) })
+	p, err := layout.Write(tmp, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestBlobStoreCopyBlob(t *testing.T) {
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := tempLayout(t)
+	if err := src.WriteImage(img); err != nil {
+		t.Fatal(err)
+	}
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := name.NewTag(fmt.Sprintf("%s/blobs/copy:latest", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs, err := Blobs(tag.Context())
+	if err != nil {
+		t.Fatalf("Blobs() = %v", err)
+	}
+
+	// Copy the blobs from the layout to the registry, twice to check that
+	// existing blobs are fine, then push just the manifest.
+	for i := 0; i < 2; i++ {
+		for _, h := range imageDigests(t, img) {
+			if err := partial.CopyBlob(blobs, src, h); err != nil {
+				t.Fatalf("CopyBlob(%s) = %v", h, err)
+			}
+		}
+	}
+	if err := Put(tag, img); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Image(tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validate.Image(got); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+
+	// And back into another layout, from the registry and an image.
+	for _, from := range []partial.WithBlob{blobs, partial.ImageBlobs(img)} {
+		dst := tempLayout(t)
+		for _, h := range imageDigests(t, img) {
+			if err := partial.CopyBlob(dst, from, h); err != nil {
+				t.Fatalf("CopyBlob(%s) = %v", h, err)
+			}
+			want, err := src.Bytes(h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := dst.Bytes(h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("blob %s differs after copying", h)
+			}
+		}
+	}
+}
+
+// corruptBlobs returns the wrong contents for every digest.
+type corruptBlobs struct{}
+
+func (corruptBlobs) Blob(v1.Hash) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader("corrupt")), nil
+}
+
+func TestCopyBlobCorrupt(t *testing.T) {
+	h, _, err := v1.SHA256(strings.NewReader("original"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := tempLayout(t)
+	if err := partial.CopyBlob(dst, corruptBlobs{}, h); err == nil {
+		t.Error("CopyBlob() = nil, wanted digest mismatch")
+	}
+	if _, err := dst.Blob(h); !os.IsNotExist(err) {
+		t.Errorf("Blob() = %v, wanted corrupt blob to be removed", err)
+	}
+}
+
+func TestBlobStoreExists(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := name.NewRepository(u.Host + "/foo/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := random.Layer(1024, types.OCILayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteLayer(repo, l); err != nil {
+		t.Fatal(err)
+	}
+	present, err := l.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing, _, err := v1.SHA256(strings.NewReader("missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blobs, err := Blobs(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for h, want := range map[v1.Hash]bool{present: true, missing: false} {
+		if got, err := blobs.Exists(h); err != nil {
+			t.Errorf("Exists(%s) = %v", h, err)
+		} else if got != want {
+			t.Errorf("Exists(%s) = %t, want %t", h, got, want)
+		}
+	}
+}
@@ -75,7 +75,43 @@ func CatalogPage(target name.Registry, last string, n int, options ...Option) ([
 }
 
 // Catalog calls /_catalog, returning the list of repositories on the registry.
+//
+// See NewCatalogger to process the repositories one page at a time.
 func Catalog(ctx context.Context, target name.Registry, options ...Option) ([]string, error) {
+	c, err := NewCatalogger(target, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	// WithContext overrides the ctx passed directly.
+	if c.context != context.Background() {
+		ctx = c.context
+	}
+
+	var repoList []string
+
+	// get responses until there is no next page
+	for c.HasNext() {
+		page, err := c.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		repoList = append(repoList, page...)
+	}
+	return repoList, nil
+}
+
+// Catalogger lists the repositories on a registry lazily, one page at a time,
+// by following the registry's Link headers.
+type Catalogger struct {
+	pager
+	context context.Context
+}
+
+// NewCatalogger returns a Catalogger for the repositories on the registry.
+//
+// See WithPageSize to control how many repositories are requested per page.
+func NewCatalogger(target name.Registry, options ...Option) (*Catalogger, error) {
 	o, err := makeOptions(target, options...)
 	if err != nil {
 		return nil, err
@@ -87,65 +123,37 @@ func Catalog(ctx context.Context, target name.Registry, options ...Option) ([]st
 		return nil, err
 	}
 
+	n := 10000
+	if o.pageSize > 0 {
+		n = o.pageSize
+	}
 	uri := &url.URL{
 		Scheme:   target.Scheme(),
 		Host:     target.RegistryStr(),
 		Path:     "/v2/_catalog",
-		RawQuery: "n=10000",
+		RawQuery: fmt.Sprintf("n=%d", n),
 	}
 
-	client := http.Client{Transport: tr}
-
-	// WithContext overrides the ctx passed directly.
-	if o.context != context.Background() {
-		ctx = o.context
-	}
-
-	var (
-		parsed   catalog
-		repoList []string
-	)
-
-	// get responses until there is no next page
-	for {
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		default:
-		}
-
-		req, err := http.NewRequest("GET", uri.String(), nil)
-		if err != nil {
-			return nil, err
-		}
-		req = req.WithContext(ctx)
-
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, err
-		}
-
-		if err := transport.CheckError(resp, http.StatusOK); err != nil {
-			return nil, err
-		}
-
-		if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-			return nil, err
-		}
-		if err := resp.Body.Close(); err != nil {
-			return nil, err
-		}
+	return &Catalogger{
+		pager: pager{
+			client: http.Client{Transport: tr},
+			next:   uri,
+		},
+		context: o.context,
+	}, nil
+}
 
-		repoList = append(repoList, parsed.Repos...)
+// HasNext returns true if there are more pages of repositories.
+func (c *Catalogger) HasNext() bool {
+	return c.hasNext()
+}
 
-		uri, err = getNextPageURL(resp)
-		if err != nil {
-			return nil, err
-		}
-		// no next page
-		if uri == nil {
-			break
-		}
+// Next returns the next page of repositories. It returns an error if there
+// are no more pages, see HasNext.
+func (c *Catalogger) Next(ctx context.Context) ([]string, error) {
+	var parsed catalog
+	if err := c.fetch(ctx, &parsed); err != nil {
+		return nil, err
 	}
-	return repoList, nil
+	return parsed.Repos, nil
 }
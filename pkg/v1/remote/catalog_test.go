@@ -152,6 +152,56 @@ func TestCatalog(t *testing.T) {
 	}
 }
 
+func TestCatalogger(t *testing.T) {
+	all := []string{"test/a", "test/b", "test/c", "test/d", "test/e"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/_catalog":
+			paginate(t, w, r, all, "repositories")
+		default:
+			t.Fatalf("Unexpected path: %v", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse(%v) = %v", server.URL, err)
+	}
+	reg, err := name.NewRegistry(u.Host)
+	if err != nil {
+		t.Fatalf("name.NewRegistry(%v) = %v", u.Host, err)
+	}
+
+	c, err := NewCatalogger(reg, WithPageSize(2))
+	if err != nil {
+		t.Fatalf("NewCatalogger() = %v", err)
+	}
+
+	// Stop after the first two pages.
+	var got []string
+	for i := 0; i < 2 && c.HasNext(); i++ {
+		page, err := c.Next(context.Background())
+		if err != nil {
+			t.Fatalf("Next() = %v", err)
+		}
+		got = append(got, page...)
+	}
+	if diff := cmp.Diff(all[:4], got); diff != "" {
+		t.Errorf("Next() wrong repos (-want +got) = %s", diff)
+	}
+	if !c.HasNext() {
+		t.Error("HasNext() = false, want true")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Next(ctx); err != context.Canceled {
+		t.Errorf("Next() = %v, want %v", err, context.Canceled)
+	}
+}
+
 func TestCancelledCatalog(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
@@ -15,6 +15,7 @@
 package remote
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -24,13 +25,39 @@ import (
 )
 
 // Delete removes the specified image reference from the remote registry.
+//
+// A name.Tag is deleted by DELETE /v2/<name>/manifests/<tag>, which many
+// registries refuse. Use WithDigestFallback to delete the manifest that the
+// tag points to instead in that case, along with every other tag that points
+// to it.
 func Delete(ref name.Reference, options ...Option) error {
 	o, err := makeOptions(ref.Context(), options...)
 	if err != nil {
 		return err
 	}
+	err = deleteManifest(ref, o)
+	if _, ok := ref.(name.Tag); !ok || !refusedTagDeletion(err) {
+		return err
+	}
+	if !o.digestFallback {
+		return fmt.Errorf("registry refused to delete tag %s, delete its digest instead: %w", ref, err)
+	}
+
+	desc, err := Head(ref, options...)
+	if err != nil {
+		// Some registries don't return the digest for HEAD requests.
+		rdesc, gerr := Get(ref, options...)
+		if gerr != nil {
+			return fmt.Errorf("resolving %s: %v", ref, gerr)
+		}
+		desc = &rdesc.Descriptor
+	}
+	return deleteManifest(ref.Context().Digest(desc.Digest.String()), o)
+}
+
+func deleteManifest(ref name.Reference, o *options) error {
 	scopes := []string{ref.Scope(transport.DeleteScope)}
-	tr, err := transport.NewWithContext(o.context, ref.Context().Registry, o.auth, o.transport, scopes)
+	tr, err := o.newTransport(ref.Context().Registry, scopes)
 	if err != nil {
 		return err
 	}
@@ -55,3 +82,22 @@ func Delete(ref name.Reference, options ...Option) error {
 
 	return transport.CheckError(resp, http.StatusOK, http.StatusAccepted)
 }
+
+// refusedTagDeletion returns whether err is the response of a registry that
+// doesn't support deleting tags.
+func refusedTagDeletion(err error) bool {
+	var terr *transport.Error
+	if !errors.As(err, &terr) {
+		return false
+	}
+	switch terr.StatusCode {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	}
+	for _, d := range terr.Errors {
+		if d.Code == transport.UnsupportedErrorCode {
+			return true
+		}
+	}
+	return false
+}
@@ -24,6 +24,7 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/google/go-containerregistry/internal/and"
 	"github.com/google/go-containerregistry/internal/verify"
 	"github.com/google/go-containerregistry/pkg/logs"
 	"github.com/google/go-containerregistry/pkg/name"
@@ -36,6 +37,9 @@ import (
 // ErrSchema1 indicates that we received a schema1 manifest from the registry.
 // This library doesn't have plans to support this legacy image format:
 // https://github.com/google/go-containerregistry/issues/377
+//
+// To convert such an image to schema 2, pass the Manifest of the Descriptor
+// returned by Get to legacy.ImageFromSchema1.
 type ErrSchema1 struct {
 	schema string
 }
@@ -61,6 +65,10 @@ type Descriptor struct {
 
 	// So we can share this implementation with Image..
 	platform v1.Platform
+
+	// See WithLayerConcurrency.
+	layerConcurrency int
+	layerDir         string
 }
 
 // RawManifest exists to satisfy the Taggable interface.
@@ -88,7 +96,9 @@ func Get(ref name.Reference, options ...Option) (*Descriptor, error) {
 // request.
 //
 // Note that the server response will not have a body, so any errors encountered
-// should be retried with Get to get more details.
+// should be retried with Get to get more details. If the manifest doesn't
+// exist, the error is a *transport.Error with a StatusCode of
+// http.StatusNotFound.
 func Head(ref name.Reference, options ...Option) (*v1.Descriptor, error) {
 	acceptable := []types.MediaType{
 		// Just to look at them.
@@ -127,10 +137,12 @@ func get(ref name.Reference, acceptable []types.MediaType, options ...Option) (*
 		return nil, err
 	}
 	return &Descriptor{
-		fetcher:    *f,
-		Manifest:   b,
-		Descriptor: *desc,
-		platform:   o.platform,
+		fetcher:          *f,
+		Manifest:         b,
+		Descriptor:       *desc,
+		platform:         o.platform,
+		layerConcurrency: o.layerConcurrency,
+		layerDir:         o.layerDir,
 	}, nil
 }
 
@@ -159,6 +171,88 @@ func (d *Descriptor) Image() (v1.Image, error) {
 		logs.Warn.Printf("Unexpected media type for Image(): %s", d.MediaType)
 	}
 
+	return d.image()
+}
+
+// Kind classifies what a Descriptor refers to, see Descriptor.MediaTypeKind.
+type Kind int
+
+const (
+	// KindUnknown is anything else, e.g. a manifest with an unexpected media
+	// type, which may still be an image or index, see Descriptor.Image.
+	KindUnknown Kind = iota
+	// KindImage is an image manifest with an image config.
+	KindImage
+	// KindIndex is an index or manifest list.
+	KindIndex
+	// KindArtifact is an image manifest that describes something other than a
+	// runnable image, because it has an artifactType or a config that isn't an
+	// image config, like a signature, an SBOM or a Helm chart.
+	KindArtifact
+	// KindSchema1 is a Docker schema 1 manifest, see ErrSchema1.
+	KindSchema1
+)
+
+// String implements fmt.Stringer.
+func (k Kind) String() string {
+	switch k {
+	case KindImage:
+		return "image"
+	case KindIndex:
+		return "index"
+	case KindArtifact:
+		return "artifact"
+	case KindSchema1:
+		return "schema1"
+	default:
+		return "unknown"
+	}
+}
+
+// MediaTypeKind classifies the fetched manifest by its media type and, for
+// image manifests, its artifactType and config media type, so callers can
+// tell whether to call Image, ImageIndex or AsArtifact.
+func (d *Descriptor) MediaTypeKind() Kind {
+	switch d.MediaType {
+	case types.DockerManifestSchema1, types.DockerManifestSchema1Signed:
+		return KindSchema1
+	case types.OCIImageIndex, types.DockerManifestList:
+		return KindIndex
+	case types.OCIManifestSchema1, types.DockerManifestSchema2:
+	default:
+		return KindUnknown
+	}
+
+	m, err := v1.ParseManifest(bytes.NewReader(d.Manifest))
+	if err != nil {
+		return KindUnknown
+	}
+	if m.ArtifactType != "" {
+		return KindArtifact
+	}
+	if m.Config.MediaType.IsConfig() {
+		return KindImage
+	}
+	return KindArtifact
+}
+
+// AsArtifact converts the Descriptor into a v1.Image for an artifact, see
+// KindArtifact. Its blobs can be accessed with LayerByDigest and its config
+// with RawConfigFile, which need not be an image config.
+//
+// It returns an error if the Descriptor isn't an artifact.
+func (d *Descriptor) AsArtifact() (v1.Image, error) {
+	if k := d.MediaTypeKind(); k != KindArtifact {
+		return nil, fmt.Errorf("cannot access %s %s as an artifact", k, d.MediaType)
+	}
+	return d.image()
+}
+
+func (d *Descriptor) image() (v1.Image, error) {
+	if d.layerConcurrency > 0 {
+		return d.prefetch()
+	}
+
 	// Wrap the v1.Layers returned by this v1.Image in a hint for downstream
 	// remote.Write calls to facilitate cross-repo "mounting".
 	imgCore, err := partial.CompressedToImage(d.remoteImage())
@@ -168,6 +262,7 @@ func (d *Descriptor) Image() (v1.Image, error) {
 	return &mountableImage{
 		Image:     imgCore,
 		Reference: d.Ref,
+		budget:    newBudget(d.limits.maxImageSize),
 	}, nil
 }
 
@@ -202,10 +297,12 @@ func (d *Descriptor) remoteImage() *remoteImage {
 
 func (d *Descriptor) remoteIndex() *remoteIndex {
 	return &remoteIndex{
-		fetcher:    d.fetcher,
-		manifest:   d.Manifest,
-		mediaType:  d.MediaType,
-		descriptor: &d.Descriptor,
+		fetcher:          d.fetcher,
+		manifest:         d.Manifest,
+		mediaType:        d.MediaType,
+		descriptor:       &d.Descriptor,
+		layerConcurrency: d.layerConcurrency,
+		layerDir:         d.layerDir,
 	}
 }
 
@@ -214,17 +311,49 @@ type fetcher struct {
 	Ref     name.Reference
 	Client  *http.Client
 	context context.Context
+
+	// See WithDigestVerification.
+	verifyDigests bool
+
+	// See WithStrictContentType.
+	strictContentType bool
+
+	// See WithMirrors.
+	mirrors []mirror
+
+	// See WithManifestAccept.
+	manifestAccept []types.MediaType
+
+	// See WithMaxManifestSize, WithMaxLayers and WithMaxImageSize.
+	limits limits
 }
 
 func makeFetcher(ref name.Reference, o *options) (*fetcher, error) {
-	tr, err := transport.NewWithContext(o.context, ref.Context().Registry, o.auth, o.transport, []string{ref.Scope(transport.PullScope)})
-	if err != nil {
-		return nil, err
+	newTransport := func() (http.RoundTripper, error) {
+		return o.newTransport(ref.Context().Registry, []string{ref.Scope(transport.PullScope)})
+	}
+
+	var tr http.RoundTripper
+	if len(o.mirrors) != 0 {
+		// The canonical registry might not be reachable at all, so wait
+		// until we actually need it.
+		tr = &lazyTransport{init: newTransport}
+	} else {
+		var err error
+		tr, err = newTransport()
+		if err != nil {
+			return nil, err
+		}
 	}
 	return &fetcher{
-		Ref:     ref,
-		Client:  &http.Client{Transport: tr},
-		context: o.context,
+		Ref:               ref,
+		Client:            &http.Client{Transport: tr},
+		context:           o.context,
+		verifyDigests:     o.verifyDigests,
+		strictContentType: o.strictContentType,
+		mirrors:           makeMirrors(ref, o),
+		manifestAccept:    o.manifestAccept,
+		limits:            o.limits,
 	}, nil
 }
 
@@ -237,19 +366,38 @@ func (f *fetcher) url(resource, identifier string) url.URL {
 	}
 }
 
+// accept returns the Accept header for a manifest request that can handle the
+// acceptable media types, in the order set with WithManifestAccept.
+func (f *fetcher) accept(acceptable []types.MediaType) string {
+	ordered := []string{}
+	for _, want := range f.manifestAccept {
+		for _, mt := range acceptable {
+			if want == mt {
+				ordered = append(ordered, string(mt))
+				break
+			}
+		}
+	}
+	if len(ordered) != 0 {
+		return strings.Join(ordered, ",")
+	}
+
+	accept := []string{}
+	for _, mt := range acceptable {
+		accept = append(accept, string(mt))
+	}
+	return strings.Join(accept, ",")
+}
+
 func (f *fetcher) fetchManifest(ref name.Reference, acceptable []types.MediaType) ([]byte, *v1.Descriptor, error) {
 	u := f.url("manifests", ref.Identifier())
 	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
 	if err != nil {
 		return nil, nil, err
 	}
-	accept := []string{}
-	for _, mt := range acceptable {
-		accept = append(accept, string(mt))
-	}
-	req.Header.Set("Accept", strings.Join(accept, ","))
+	req.Header.Set("Accept", f.accept(acceptable))
 
-	resp, err := f.Client.Do(req.WithContext(f.context))
+	resp, err := f.do(req.WithContext(f.context))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -259,17 +407,23 @@ func (f *fetcher) fetchManifest(ref name.Reference, acceptable []types.MediaType
 		return nil, nil, err
 	}
 
-	manifest, err := ioutil.ReadAll(resp.Body)
+	manifest, err := f.limits.readManifest(resp.Body)
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := f.limits.checkManifest(manifest); err != nil {
+		return nil, nil, err
+	}
 
 	digest, size, err := v1.SHA256(bytes.NewReader(manifest))
 	if err != nil {
 		return nil, nil, err
 	}
 
-	mediaType := types.MediaType(resp.Header.Get("Content-Type"))
+	mediaType, err := f.manifestMediaType(types.MediaType(resp.Header.Get("Content-Type")), manifest)
+	if err != nil {
+		return nil, nil, err
+	}
 	contentDigest, err := v1.NewHash(resp.Header.Get("Docker-Content-Digest"))
 	if err == nil && mediaType == types.DockerManifestSchema1Signed {
 		// If we can parse the digest from the header, and it's a signed schema 1
@@ -282,14 +436,17 @@ func (f *fetcher) fetchManifest(ref name.Reference, acceptable []types.MediaType
 		if digest.String() != dgst.DigestStr() {
 			return nil, nil, fmt.Errorf("manifest digest: %q does not match requested digest: %q for %q", digest, dgst.DigestStr(), f.Ref)
 		}
+	} else if f.verifyDigests && err == nil && mediaType != types.DockerManifestSchema1Signed {
+		// For tags, we only validate the "Docker-Content-Digest" header if asked to,
+		// because so many registries implement this incorrectly that it's not worth
+		// checking by default.
+		//
+		// For reference:
+		// https://github.com/GoogleContainerTools/kaniko/issues/298
+		if digest != contentDigest {
+			return nil, nil, fmt.Errorf("manifest digest: %q does not match Docker-Content-Digest header: %q for %q", digest, contentDigest, f.Ref)
+		}
 	}
-	// Do nothing for tags; I give up.
-	//
-	// We'd like to validate that the "Docker-Content-Digest" header matches what is returned by the registry,
-	// but so many registries implement this incorrectly that it's not worth checking.
-	//
-	// For reference:
-	// https://github.com/GoogleContainerTools/kaniko/issues/298
 
 	// Return all this info since we have to calculate it anyway.
 	desc := v1.Descriptor{
@@ -301,17 +458,62 @@ func (f *fetcher) fetchManifest(ref name.Reference, acceptable []types.MediaType
 	return manifest, &desc, nil
 }
 
+// manifestMediaType reconciles the Content-Type that the registry served
+// manifest with and what manifest says it is, see WithStrictContentType.
+func (f *fetcher) manifestMediaType(contentType types.MediaType, manifest []byte) (types.MediaType, error) {
+	generic := genericContentType(contentType)
+	if !generic {
+		contentType = types.MediaType(strings.TrimSpace(strings.SplitN(string(contentType), ";", 2)[0]))
+	}
+	detected := types.DetectManifest(manifest)
+	switch {
+	case detected == "":
+		if generic && f.strictContentType {
+			return "", fmt.Errorf("manifest for %q has Content-Type %q", f.Ref, contentType)
+		}
+		return contentType, nil
+	case !generic && sameManifestKind(contentType, detected):
+		return contentType, nil
+	case f.strictContentType:
+		return "", fmt.Errorf("manifest for %q has Content-Type %q, but is %s", f.Ref, contentType, detected)
+	case !generic:
+		logs.Warn.Printf("manifest for %q has Content-Type %q, but is %s", f.Ref, contentType, detected)
+	}
+	return detected, nil
+}
+
+// sameManifestKind returns whether a manifest detected as detected can have
+// the media type mt. Manifests without a mediaType field are detected as OCI
+// types, but could just as well be the Docker equivalents.
+func sameManifestKind(mt, detected types.MediaType) bool {
+	switch detected {
+	case mt:
+		return true
+	case types.OCIManifestSchema1:
+		return mt == types.DockerManifestSchema2
+	case types.OCIImageIndex:
+		return mt == types.DockerManifestList
+	}
+	return false
+}
+
+// genericContentType returns whether mt says nothing about what kind of
+// manifest a response holds.
+func genericContentType(mt types.MediaType) bool {
+	switch strings.TrimSpace(strings.SplitN(string(mt), ";", 2)[0]) {
+	case "", "application/octet-stream", "application/json", "text/plain":
+		return true
+	}
+	return false
+}
+
 func (f *fetcher) headManifest(ref name.Reference, acceptable []types.MediaType) (*v1.Descriptor, error) {
 	u := f.url("manifests", ref.Identifier())
 	req, err := http.NewRequest(http.MethodHead, u.String(), nil)
 	if err != nil {
 		return nil, err
 	}
-	accept := []string{}
-	for _, mt := range acceptable {
-		accept = append(accept, string(mt))
-	}
-	req.Header.Set("Accept", strings.Join(accept, ","))
+	req.Header.Set("Accept", f.accept(acceptable))
 
 	resp, err := f.Client.Do(req.WithContext(f.context))
 	if err != nil {
@@ -365,7 +567,7 @@ func (f *fetcher) fetchBlob(ctx context.Context, size int64, h v1.Hash) (io.Read
 		return nil, err
 	}
 
-	resp, err := f.Client.Do(req.WithContext(ctx))
+	resp, err := f.do(req.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -389,6 +591,45 @@ func (f *fetcher) fetchBlob(ctx context.Context, size int64, h v1.Hash) (io.Read
 	return verify.ReadCloser(resp.Body, size, h)
 }
 
+func (f *fetcher) fetchBlobRange(ctx context.Context, h v1.Hash, offset, length int64) (io.ReadCloser, error) {
+	u := f.url("blobs", h.String())
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+	resp, err := f.do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := transport.CheckError(resp, http.StatusOK, http.StatusPartialContent); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusPartialContent {
+		var start int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-", &start); err != nil || start != offset {
+			resp.Body.Close()
+			return nil, fmt.Errorf("GET %s: unexpected Content-Range %q for range starting at %d", u.String(), resp.Header.Get("Content-Range"), offset)
+		}
+	} else if _, err := io.CopyN(ioutil.Discard, resp.Body, offset); err != nil {
+		// The registry ignored the Range header, so skip to the offset ourselves.
+		resp.Body.Close()
+		if err == io.EOF {
+			return nil, fmt.Errorf("GET %s: offset %d is beyond the end of the blob", u.String(), offset)
+		}
+		return nil, err
+	}
+
+	return &and.ReadCloser{
+		Reader:    io.LimitReader(resp.Body, length),
+		CloseFunc: resp.Body.Close,
+	}, nil
+}
+
 func (f *fetcher) headBlob(h v1.Hash) (*http.Response, error) {
 	u := f.url("blobs", h.String())
 	req, err := http.NewRequest(http.MethodHead, u.String(), nil)
@@ -24,6 +24,13 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
@@ -214,3 +221,304 @@ func TestHead_MissingHeaders(t *testing.T) {
 		}
 	}
 }
+
+func TestHeadNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if r.Method != http.MethodHead {
+			t.Errorf("Method; got %v, want %v", r.Method, http.MethodHead)
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse(%v) = %v", server.URL, err)
+	}
+
+	tag := mustNewTag(t, fmt.Sprintf("%s/foo:latest", u.Host))
+	_, err = Head(tag)
+	terr, ok := err.(*transport.Error)
+	if !ok {
+		t.Fatalf("Head(%q) = %v, want *transport.Error", tag, err)
+	}
+	if terr.StatusCode != http.StatusNotFound {
+		t.Errorf("StatusCode = %d, want %d", terr.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestGetGenericContentType(t *testing.T) {
+	img := randomImage(t)
+	manifestPath := "/v2/foo/bar/manifests/latest"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case manifestPath:
+			// Like a static file server would.
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(mustRawManifest(t, img))
+		default:
+			t.Fatalf("Unexpected path: %v", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse(%v) = %v", server.URL, err)
+	}
+
+	desc, err := Get(mustNewTag(t, fmt.Sprintf("%s/foo/bar:latest", u.Host)))
+	if err != nil {
+		t.Fatalf("Get() = %v", err)
+	}
+	if want := mustManifest(t, img).MediaType; desc.MediaType != want {
+		t.Errorf("MediaType = %s, want %s", desc.MediaType, want)
+	}
+}
+
+func TestManifestContentType(t *testing.T) {
+	const (
+		dockerManifest = `{"schemaVersion": 2, "mediaType": "application/vnd.docker.distribution.manifest.v2+json", "config": {}, "layers": []}`
+		ociManifest    = `{"schemaVersion": 2, "config": {}, "layers": []}`
+		ociIndex       = `{"schemaVersion": 2, "mediaType": "application/vnd.oci.image.index.v1+json", "manifests": []}`
+		schema1        = `{"schemaVersion": 1, "fsLayers": []}`
+		notManifest    = `{"foo": "bar"}`
+	)
+	for _, tc := range []struct {
+		desc        string
+		contentType string
+		body        string
+		strict      bool
+		want        types.MediaType
+		wantErr     bool
+	}{
+		{desc: "matching", contentType: string(types.DockerManifestSchema2), body: dockerManifest, want: types.DockerManifestSchema2},
+		{desc: "parameters", contentType: string(types.OCIImageIndex) + "; charset=utf-8", body: ociIndex, want: types.OCIImageIndex},
+		{desc: "index as manifest", contentType: string(types.DockerManifestSchema2), body: ociIndex, want: types.OCIImageIndex},
+		{desc: "docker as oci", contentType: string(types.OCIManifestSchema1), body: dockerManifest, want: types.DockerManifestSchema2},
+		{desc: "schema 1 as json", contentType: "application/json", body: schema1, want: types.DockerManifestSchema1},
+		{desc: "octet-stream", contentType: "application/octet-stream", body: ociIndex, want: types.OCIImageIndex},
+		{desc: "no mediaType as docker", contentType: string(types.DockerManifestSchema2), body: ociManifest, want: types.DockerManifestSchema2},
+		{desc: "no mediaType as text", contentType: "text/plain", body: ociManifest, want: types.OCIManifestSchema1},
+		{desc: "unrecognized", contentType: string(types.DockerManifestSchema2), body: notManifest, want: types.DockerManifestSchema2},
+		{desc: "strict matching", contentType: string(types.OCIImageIndex), body: ociIndex, strict: true, want: types.OCIImageIndex},
+		{desc: "strict no mediaType", contentType: string(types.DockerManifestSchema2), body: ociManifest, strict: true, want: types.DockerManifestSchema2},
+		{desc: "strict index as manifest", contentType: string(types.DockerManifestSchema2), body: ociIndex, strict: true, wantErr: true},
+		{desc: "strict docker as oci", contentType: string(types.OCIManifestSchema1), body: dockerManifest, strict: true, wantErr: true},
+		{desc: "strict octet-stream", contentType: "application/octet-stream", body: ociIndex, strict: true, wantErr: true},
+		{desc: "strict missing", body: notManifest, strict: true, wantErr: true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v2/":
+					w.WriteHeader(http.StatusOK)
+				case "/v2/foo/bar/manifests/latest":
+					w.Header()["Content-Type"] = []string{tc.contentType}
+					w.Write([]byte(tc.body))
+				default:
+					t.Fatalf("Unexpected path: %v", r.URL.Path)
+				}
+			}))
+			defer server.Close()
+			u, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatalf("url.Parse(%v) = %v", server.URL, err)
+			}
+
+			opts := []Option{}
+			if tc.strict {
+				opts = append(opts, WithStrictContentType)
+			}
+			desc, err := Get(mustNewTag(t, fmt.Sprintf("%s/foo/bar:latest", u.Host)), opts...)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Get() = %s, wanted error", desc.MediaType)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get() = %v", err)
+			}
+			if desc.MediaType != tc.want {
+				t.Errorf("MediaType = %s, want %s", desc.MediaType, tc.want)
+			}
+		})
+	}
+}
+
+func TestWithManifestAccept(t *testing.T) {
+	expectedRepo := "foo/bar"
+	manifestPath := fmt.Sprintf("/v2/%s/manifests/latest", expectedRepo)
+	formats := map[types.MediaType]string{
+		types.DockerManifestSchema2: "schema 2",
+		types.DockerManifestList:    "manifest list",
+		types.OCIImageIndex:         "oci index",
+	}
+
+	var gotAccept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case manifestPath:
+			// Content-negotiate: serve the first acceptable format we have.
+			gotAccept = r.Header.Get("Accept")
+			for _, mt := range strings.Split(gotAccept, ",") {
+				if body, ok := formats[types.MediaType(mt)]; ok {
+					digest, _, err := v1.SHA256(strings.NewReader(body))
+					if err != nil {
+						t.Fatal(err)
+					}
+					w.Header().Set("Content-Type", mt)
+					w.Header().Set("Docker-Content-Digest", digest.String())
+					w.Write([]byte(body))
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNotAcceptable)
+		default:
+			t.Fatalf("Unexpected path: %v", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse(%v) = %v", server.URL, err)
+	}
+
+	tag := mustNewTag(t, fmt.Sprintf("%s/%s:latest", u.Host, expectedRepo))
+
+	for _, tc := range []struct {
+		desc       string
+		accept     []types.MediaType
+		wantAccept string
+		want       types.MediaType
+	}{{
+		desc: "default",
+		want: types.DockerManifestSchema2,
+	}, {
+		desc:       "prefer oci index",
+		accept:     []types.MediaType{types.OCIImageIndex, types.DockerManifestList, types.DockerManifestSchema2},
+		wantAccept: "application/vnd.oci.image.index.v1+json,application/vnd.docker.distribution.manifest.list.v2+json,application/vnd.docker.distribution.manifest.v2+json",
+		want:       types.OCIImageIndex,
+	}, {
+		desc:       "prefer manifest list",
+		accept:     []types.MediaType{types.DockerManifestList, types.OCIImageIndex},
+		wantAccept: "application/vnd.docker.distribution.manifest.list.v2+json,application/vnd.oci.image.index.v1+json",
+		want:       types.DockerManifestList,
+	}, {
+		desc:       "force schema 2",
+		accept:     []types.MediaType{types.DockerManifestSchema2},
+		wantAccept: "application/vnd.docker.distribution.manifest.v2+json",
+		want:       types.DockerManifestSchema2,
+	}, {
+		desc:   "unacceptable",
+		accept: []types.MediaType{"application/unknown"},
+		want:   types.DockerManifestSchema2,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := []Option{}
+			if tc.accept != nil {
+				opts = append(opts, WithManifestAccept(tc.accept))
+			}
+
+			desc, err := Get(tag, opts...)
+			if err != nil {
+				t.Fatalf("Get(%s) = %v", tag, err)
+			}
+			if desc.MediaType != tc.want {
+				t.Errorf("Get(%s).MediaType = %s, want %s", tag, desc.MediaType, tc.want)
+			}
+			if got, want := string(desc.Manifest), formats[tc.want]; got != want {
+				t.Errorf("Get(%s).Manifest = %q, want %q", tag, got, want)
+			}
+			if tc.wantAccept != "" && gotAccept != tc.wantAccept {
+				t.Errorf("Accept = %q, want %q", gotAccept, tc.wantAccept)
+			}
+
+			hdesc, err := Head(tag, opts...)
+			if err != nil {
+				t.Fatalf("Head(%s) = %v", tag, err)
+			}
+			if hdesc.MediaType != tc.want {
+				t.Errorf("Head(%s).MediaType = %s, want %s", tag, hdesc.MediaType, tc.want)
+			}
+		})
+	}
+}
+
+func TestMediaTypeKind(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := random.Index(1024, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbom, err := random.Layer(1024, "application/spdx+json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifact, err := mutate.AppendLayers(empty.Image, sbom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifact = mutate.ConfigMediaType(mutate.MediaType(artifact, types.OCIManifestSchema1), types.OCIEmptyJSON)
+	typed := mutate.ArtifactType(mutate.MediaType(img, types.OCIManifestSchema1), "application/vnd.example.signature")
+
+	for _, tc := range []struct {
+		tag  string
+		t    Taggable
+		want Kind
+	}{
+		{"image", img, KindImage},
+		{"index", idx, KindIndex},
+		{"artifact", artifact, KindArtifact},
+		{"typed", typed, KindArtifact},
+	} {
+		t.Run(tc.tag, func(t *testing.T) {
+			ref := mustNewTag(t, fmt.Sprintf("%s/repo:%s", u.Host, tc.tag))
+			if err := MultiWrite(map[name.Reference]Taggable{ref: tc.t}); err != nil {
+				t.Fatal(err)
+			}
+			desc, err := Get(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := desc.MediaTypeKind(); got != tc.want {
+				t.Errorf("MediaTypeKind() = %s, want %s", got, tc.want)
+			}
+
+			a, err := desc.AsArtifact()
+			if tc.want != KindArtifact {
+				if err == nil {
+					t.Error("AsArtifact() = nil, wanted error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AsArtifact() = %v", err)
+			}
+			m, err := a.Manifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := a.LayerByDigest(m.Layers[0].Digest); err != nil {
+				t.Errorf("LayerByDigest() = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/google/go-containerregistry/internal/redact"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ErrNoTOC is returned by LayerTOC for layers that aren't estargz, and so
+// have no table of contents.
+var ErrNoTOC = errors.New("layer has no estargz table of contents")
+
+// TOC is the table of contents of an estargz layer, which lists its files
+// and where their contents are in the compressed blob.
+type TOC struct {
+	r *estargz.Reader
+}
+
+// LayerTOC reads the estargz table of contents of the layer referenced by
+// ref, with Range requests for the footer and the TOC itself, without
+// downloading the rest of the layer. If the layer isn't estargz, the
+// returned error wraps ErrNoTOC.
+//
+// Like BlobRange, the partial contents can't be verified against the
+// layer's digest.
+func LayerTOC(ref name.Digest, options ...Option) (*TOC, error) {
+	o, err := makeOptions(ref.Context(), options...)
+	if err != nil {
+		return nil, err
+	}
+	f, err := makeFetcher(ref, o)
+	if err != nil {
+		return nil, err
+	}
+	h, err := v1.NewHash(ref.Identifier())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.headBlob(h)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	size := resp.ContentLength
+	if size < 0 {
+		return nil, fmt.Errorf("HEAD %s: missing Content-Length", ref)
+	}
+
+	// We don't want to log binary layers -- this can break terminals.
+	ctx := redact.NewContext(f.context, "omitting binary blobs from logs")
+	sr := io.NewSectionReader(&blobReaderAt{fetcher: f, ctx: ctx, digest: h}, 0, size)
+	if err := openFooter(sr); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrNoTOC, ref, err)
+	}
+	r, err := estargz.Open(sr)
+	if err != nil {
+		return nil, err
+	}
+	return &TOC{r: r}, nil
+}
+
+// estargzExtraSize is the size of the gzip extra field of an estargz footer:
+// the subfield ID and length, followed by the TOC offset and "STARGZ".
+const estargzExtraSize = 4 + 16 + len("STARGZ")
+
+// openFooter checks that sr ends in an estargz footer.
+func openFooter(sr *io.SectionReader) error {
+	if sr.Size() < estargz.FooterSize {
+		return fmt.Errorf("blob size %d is smaller than the footer size", sr.Size())
+	}
+	footer := make([]byte, estargz.FooterSize)
+	if _, err := sr.ReadAt(footer, sr.Size()-estargz.FooterSize); err != nil {
+		return fmt.Errorf("reading footer: %v", err)
+	}
+	// The footer parser indexes into the gzip extra field without checking its
+	// length, so reject short ones before handing the footer to it.
+	if zr, err := gzip.NewReader(bytes.NewReader(footer)); err == nil && len(zr.Header.Extra) < estargzExtraSize {
+		return fmt.Errorf("gzip extra field of %d bytes is too short for an estargz footer", len(zr.Header.Extra))
+	}
+	_, _, err := estargz.OpenFooter(io.NewSectionReader(bytes.NewReader(footer), 0, int64(len(footer))))
+	return err
+}
+
+// Files returns the names of all entries in the TOC, in lexical order.
+// Directories are included, even if they are only implied by their children.
+func (t *TOC) Files() []string {
+	var names []string
+	var walk func(e *estargz.TOCEntry)
+	walk = func(e *estargz.TOCEntry) {
+		e.ForeachChild(func(_ string, child *estargz.TOCEntry) bool {
+			names = append(names, child.Name)
+			if child.Type == "dir" {
+				walk(child)
+			}
+			return true
+		})
+	}
+	if root, ok := t.r.Lookup(""); ok {
+		walk(root)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stat returns information about the named entry. The os.FileInfo's Sys
+// method returns the *estargz.TOCEntry.
+func (t *TOC) Stat(name string) (os.FileInfo, error) {
+	e, ok := t.r.Lookup(name)
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return e.Stat(), nil
+}
+
+// Open returns the contents of the named regular file. Reading it fetches
+// only the chunks of the layer that hold the range being read.
+func (t *TOC) Open(name string) (*io.SectionReader, error) {
+	return t.r.OpenFile(name)
+}
+
+// blobReaderAt implements io.ReaderAt for a blob with Range requests.
+type blobReaderAt struct {
+	*fetcher
+	ctx    context.Context
+	digest v1.Hash
+}
+
+func (b *blobReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	rc, err := b.fetchBlobRange(b.ctx, b.digest, off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	n, err := io.ReadFull(rc, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
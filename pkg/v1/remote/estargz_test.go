@@ -0,0 +1,267 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// estargzBlob lays out files like estargz does: every tar header and every
+// file's contents in their own gzip stream, followed by the TOC and footer.
+// The contents aren't padded, since only the estargz reader reads it.
+// estargz.Build can't be used, since it panics with newer versions of
+// compress/gzip, which write a shorter footer.
+func estargzBlob(t *testing.T, files map[string][]byte, order []string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := func(write func(zw *gzip.Writer) error) {
+		zw := gzip.NewWriter(&buf)
+		if err := write(zw); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var entries []*estargz.TOCEntry
+	for _, name := range order {
+		contents := files[name]
+		gz(func(zw *gzip.Writer) error {
+			// The header is written as soon as WriteHeader is called, but
+			// the contents go in the next gzip stream.
+			var hdr bytes.Buffer
+			if err := tar.NewWriter(&hdr).WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Size: int64(len(contents)), Mode: 0644}); err != nil {
+				return err
+			}
+			_, err := zw.Write(hdr.Bytes())
+			return err
+		})
+		entries = append(entries, &estargz.TOCEntry{
+			Name:   name,
+			Type:   "reg",
+			Size:   int64(len(contents)),
+			Mode:   0644,
+			Offset: int64(buf.Len()),
+		})
+		gz(func(zw *gzip.Writer) error {
+			_, err := zw.Write(contents)
+			return err
+		})
+	}
+
+	toc, err := json.Marshal(map[string]interface{}{"version": 1, "entries": entries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tocOff := buf.Len()
+	gz(func(zw *gzip.Writer) error {
+		tw := tar.NewWriter(zw)
+		if err := tw.WriteHeader(&tar.Header{Name: estargz.TOCTarName, Typeflag: tar.TypeReg, Size: int64(len(toc)), Mode: 0644}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(toc); err != nil {
+			return err
+		}
+		return tw.Close()
+	})
+
+	// The footer is an empty gzip stream, uncompressed, whose extra field
+	// holds the offset of the TOC.
+	buf.Write([]byte{0x1f, 0x8b, 8, 4, 0, 0, 0, 0, 0, 0xff})
+	subfield := fmt.Sprintf("%016xSTARGZ", tocOff)
+	binary.Write(&buf, binary.LittleEndian, uint16(4+len(subfield)))
+	buf.WriteString("SG")
+	binary.Write(&buf, binary.LittleEndian, uint16(len(subfield)))
+	buf.WriteString(subfield)
+	buf.Write([]byte{1, 0, 0, 0xff, 0xff})
+	buf.Write(make([]byte, 8))
+	return buf.Bytes()
+}
+
+// blobServer serves blob with support for Range requests, counting the
+// bytes it sends.
+func blobServer(t *testing.T, repo string, blob []byte, sent *int) name.Digest {
+	t.Helper()
+	h, _, err := v1.SHA256(bytes.NewReader(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobPath := fmt.Sprintf("/v2/%s/blobs/%s", repo, h)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case blobPath:
+			http.ServeContent(&countingWriter{ResponseWriter: w, n: sent}, r, "", time.Time{}, bytes.NewReader(blob))
+		default:
+			t.Errorf("Unexpected path: %v", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.NewDigest(fmt.Sprintf("%s/%s@%s", u.Host, repo, h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *int
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	*w.n += len(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func TestLayerTOC(t *testing.T) {
+	big := make([]byte, 1<<20)
+	if _, err := rand.Read(big); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"big":       big,
+		"etc/hello": []byte("hello, world"),
+	}
+	blob := estargzBlob(t, files, []string{"big", "etc/hello"})
+
+	var sent int
+	ref := blobServer(t, "foo/bar", blob, &sent)
+	toc, err := LayerTOC(ref)
+	if err != nil {
+		t.Fatalf("LayerTOC() = %v", err)
+	}
+
+	if diff := cmp.Diff([]string{"big", "etc", "etc/hello"}, toc.Files()); diff != "" {
+		t.Errorf("Files() (-want +got) = %s", diff)
+	}
+	if fi, err := toc.Stat("etc/hello"); err != nil {
+		t.Errorf("Stat() = %v", err)
+	} else if fi.Size() != int64(len(files["etc/hello"])) || fi.IsDir() {
+		t.Errorf("Stat() = size %d, dir %t; want size %d, file", fi.Size(), fi.IsDir(), len(files["etc/hello"]))
+	}
+	if _, err := toc.Stat("nope"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat(nope) = %v, want %v", err, os.ErrNotExist)
+	}
+
+	sr, err := toc.Open("etc/hello")
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	got, err := ioutil.ReadAll(sr)
+	if err != nil {
+		t.Fatalf("ReadAll() = %v", err)
+	}
+	if !bytes.Equal(got, files["etc/hello"]) {
+		t.Errorf("Open() = %q, want %q", got, files["etc/hello"])
+	}
+	if sent >= len(big) {
+		t.Errorf("sent %d bytes, want less than the big file (%d bytes)", sent, len(big))
+	}
+
+	sr, err = toc.Open("big")
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	got, err = ioutil.ReadAll(sr)
+	if err != nil {
+		t.Fatalf("ReadAll() = %v", err)
+	}
+	if !bytes.Equal(got, big) {
+		t.Errorf("Open(big) returned %d different bytes", len(got))
+	}
+}
+
+func TestLayerTOCNotEstargz(t *testing.T) {
+	l, err := random.Layer(1024, types.DockerLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := l.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sent int
+	ref := blobServer(t, "foo/bar", blob, &sent)
+	if _, err := LayerTOC(ref); !errors.Is(err, ErrNoTOC) {
+		t.Errorf("LayerTOC() = %v, want %v", err, ErrNoTOC)
+	} else if !strings.Contains(err.Error(), ref.String()) {
+		t.Errorf("LayerTOC() = %v, want it to mention %s", err, ref)
+	}
+}
+
+func TestLayerTOCShortExtra(t *testing.T) {
+	// A gzip blob of exactly FooterSize bytes, whose extra field is too short
+	// for an estargz footer.
+	var blob []byte
+	for n := 0; len(blob) < estargz.FooterSize; n++ {
+		var buf bytes.Buffer
+		zw, err := gzip.NewWriterLevel(&buf, gzip.NoCompression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw.Header.Extra = []byte("SG")
+		if _, err := zw.Write(make([]byte, n)); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		blob = buf.Bytes()
+	}
+	if len(blob) != estargz.FooterSize {
+		t.Fatalf("gzip blob has %d bytes, want %d", len(blob), estargz.FooterSize)
+	}
+
+	var sent int
+	ref := blobServer(t, "foo/bar", blob, &sent)
+	if _, err := LayerTOC(ref); !errors.Is(err, ErrNoTOC) {
+		t.Errorf("LayerTOC() = %v, want %v", err, ErrNoTOC)
+	}
+}
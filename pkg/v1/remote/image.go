@@ -15,6 +15,7 @@
 package remote
 
 import (
+	"bytes"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -100,6 +101,14 @@ func (r *remoteImage) RawConfigFile() ([]byte, error) {
 		return nil, err
 	}
 
+	if m.Config.Data != nil {
+		if err := verify.Descriptor(m.Config); err != nil {
+			return nil, err
+		}
+		r.config = m.Config.Data
+		return r.config, nil
+	}
+
 	body, err := r.fetchBlob(r.context, m.Config.Size, m.Config.Digest)
 	if err != nil {
 		return nil, err
@@ -143,6 +152,11 @@ func (rl *remoteImageLayer) Compressed() (io.ReadCloser, error) {
 		return nil, err
 	}
 
+	// Small blobs may be embedded in the manifest, which saves a request.
+	if d.Data != nil {
+		return verify.ReadCloser(ioutil.NopCloser(bytes.NewReader(d.Data)), d.Size, d.Digest)
+	}
+
 	// We don't want to log binary layers -- this can break terminals.
 	ctx := redact.NewContext(rl.ri.context, "omitting binary blobs from logs")
 
@@ -153,27 +167,44 @@ func (rl *remoteImageLayer) Compressed() (io.ReadCloser, error) {
 		}
 		urls = append(urls, *u)
 	}
+	// Foreign layers usually aren't in the registry at all, so try their
+	// urls first and the registry last.
+	registry := 0
+	if !d.MediaType.IsDistributable() && len(urls) > 1 {
+		urls = append(urls[1:], urls[0])
+		registry = len(urls) - 1
+	}
 
-	// The lastErr for most pulls will be the same (the first error), but for
-	// foreign layers we'll want to surface the last one, since we try to pull
-	// from the registry first, which would often fail.
-	// TODO: Maybe we don't want to try pulling from the registry first?
+	// The lastErr for most pulls will be that of the registry, but for foreign
+	// layers we'll want to surface that of their last url, since the registry
+	// would often just say that the blob is unknown.
 	var lastErr error
-	for _, u := range urls {
+	fail := func(i int, err error) {
+		if i != registry || lastErr == nil {
+			lastErr = err
+		}
+	}
+	for i, u := range urls {
 		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
 		if err != nil {
 			return nil, err
 		}
 
-		resp, err := rl.ri.Client.Do(req.WithContext(ctx))
+		var resp *http.Response
+		if i == registry {
+			// Only the registry itself is mirrored.
+			resp, err = rl.ri.do(req.WithContext(ctx))
+		} else {
+			resp, err = rl.ri.Client.Do(req.WithContext(ctx))
+		}
 		if err != nil {
-			lastErr = err
+			fail(i, err)
 			continue
 		}
 
 		if err := transport.CheckError(resp, http.StatusOK); err != nil {
 			resp.Body.Close()
-			lastErr = err
+			fail(i, err)
 			continue
 		}
 
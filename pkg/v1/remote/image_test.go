@@ -116,6 +116,7 @@ func TestRawManifestDigests(t *testing.T) {
 		ref           string
 		responseBody  []byte
 		contentDigest string
+		verifyDigests bool
 		wantErr       bool
 	}{{
 		name:          "normal pull, by tag",
@@ -148,6 +149,34 @@ func TestRawManifestDigests(t *testing.T) {
 		responseBody:  mustRawManifest(t, img),
 		contentDigest: bogusDigest,
 		wantErr:       false,
+	}, {
+		name:          "right body, right content-digest, by tag, verified",
+		ref:           "latest",
+		responseBody:  mustRawManifest(t, img),
+		contentDigest: mustDigest(t, img).String(),
+		verifyDigests: true,
+		wantErr:       false,
+	}, {
+		name:          "right body, wrong content-digest, by tag, verified",
+		ref:           "latest",
+		responseBody:  mustRawManifest(t, img),
+		contentDigest: bogusDigest,
+		verifyDigests: true,
+		wantErr:       true,
+	}, {
+		// Without a header, there's nothing to verify against.
+		name:          "right body, missing content-digest, by tag, verified",
+		ref:           "latest",
+		responseBody:  mustRawManifest(t, img),
+		verifyDigests: true,
+		wantErr:       false,
+	}, {
+		name:          "right body, wrong content-digest, by digest, verified",
+		ref:           mustDigest(t, img).String(),
+		responseBody:  mustRawManifest(t, img),
+		contentDigest: bogusDigest,
+		verifyDigests: true,
+		wantErr:       false,
 	}}
 
 	for _, tc := range cases {
@@ -179,9 +208,10 @@ func TestRawManifestDigests(t *testing.T) {
 
 			rmt := remoteImage{
 				fetcher: fetcher{
-					Ref:     ref,
-					Client:  http.DefaultClient,
-					context: context.Background(),
+					Ref:           ref,
+					Client:        http.DefaultClient,
+					context:       context.Background(),
+					verifyDigests: tc.verifyDigests,
 				},
 			}
 
@@ -632,7 +662,8 @@ func TestPullingForeignLayer(t *testing.T) {
 			}
 			w.WriteHeader(http.StatusOK)
 		case foreignLayerPath:
-			// Not here!
+			// Not here, and we shouldn't ask before trying its url.
+			t.Errorf("Unexpected request for foreign layer: %v", r.URL.Path)
 			w.WriteHeader(http.StatusNotFound)
 		default:
 			t.Fatalf("Unexpected path: %v", r.URL.Path)
@@ -673,4 +704,78 @@ func TestPullingForeignLayer(t *testing.T) {
 	if err := Write(ref, rmt); err != nil {
 		t.Errorf("failed to Write: %v", err)
 	}
+
+	// The foreign layer isn't uploaded, but its urls are kept.
+	fl, err := Layer(ref.Context().Digest(foreignLayerDigest.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fl.Compressed(); err == nil {
+		t.Error("foreign layer was uploaded")
+	}
+	pushed, err := Image(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(mustManifest(t, img).Layers[1].URLs, mustManifest(t, pushed).Layers[1].URLs); diff != "" {
+		t.Errorf("URLs (-want +got) = %s", diff)
+	}
+}
+
+func TestPullingInlineData(t *testing.T) {
+	expectedRepo := "foo/bar"
+	manifestPath := fmt.Sprintf("/v2/%s/manifests/latest", expectedRepo)
+
+	inlined := mutate.InlineData(randomImage(t), 1<<20)
+	corrupt := mustManifest(t, inlined).DeepCopy()
+	corrupt.Config.Data = []byte("{}")
+	rawCorrupt, err := json.Marshal(corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		desc     string
+		manifest []byte
+		wantErr  bool
+	}{
+		{"inlined", mustRawManifest(t, inlined), false},
+		{"corrupt", rawCorrupt, true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			// Set up a fake registry that only serves the manifest.
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v2/":
+					w.WriteHeader(http.StatusOK)
+				case manifestPath:
+					w.Header().Set("Content-Type", string(types.DockerManifestSchema2))
+					w.Write(tc.manifest)
+				default:
+					t.Errorf("Unexpected path: %v", r.URL.Path)
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+			u, err := url.Parse(server.URL)
+			if err != nil {
+				t.Fatalf("url.Parse(%v) = %v", server.URL, err)
+			}
+
+			tag := mustNewTag(t, fmt.Sprintf("%s/%s:latest", u.Host, expectedRepo))
+			rmt, err := Image(tag, WithTransport(http.DefaultTransport))
+			if err != nil {
+				t.Fatalf("Image() = %v", err)
+			}
+			if tc.wantErr {
+				if _, err := rmt.RawConfigFile(); err == nil {
+					t.Error("RawConfigFile() = nil, wanted error")
+				}
+				return
+			}
+			if err := validate.Image(rmt); err != nil {
+				t.Errorf("validate.Image() = %v", err)
+			}
+		})
+	}
 }
@@ -21,6 +21,7 @@ import (
 
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/match"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 )
@@ -37,6 +38,10 @@ type remoteIndex struct {
 	manifest     []byte
 	mediaType    types.MediaType
 	descriptor   *v1.Descriptor
+
+	// See WithLayerConcurrency.
+	layerConcurrency int
+	layerDir         string
 }
 
 // Index provides access to a remote index reference.
@@ -164,11 +169,41 @@ func (r *remoteIndex) imageByPlatform(platform v1.Platform) (v1.Image, error) {
 // But first we'd need to migrate to:
 //   github.com/opencontainers/image-spec/specs-go/v1
 func (r *remoteIndex) childByPlatform(platform v1.Platform) (*Descriptor, error) {
+	desc, err := r.findChildByPlatform(platform)
+	if err != nil {
+		return nil, err
+	}
+	if desc == nil {
+		return nil, fmt.Errorf("no child with platform %s/%s in index %s", platform.OS, platform.Architecture, r.Ref)
+	}
+	return desc, nil
+}
+
+// findChildByPlatform is like childByPlatform, but returns nil if there is no
+// such child.
+func (r *remoteIndex) findChildByPlatform(platform v1.Platform) (*Descriptor, error) {
 	index, err := r.IndexManifest()
 	if err != nil {
 		return nil, err
 	}
 	for _, childDesc := range index.Manifests {
+		if childDesc.MediaType.IsIndex() && childDesc.Platform != nil {
+			// The platform of a nested index only narrows down those of its
+			// children, so look for a match inside of it.
+			if !match.NestedPlatforms(platform)(childDesc) {
+				continue
+			}
+			child, err := r.childDescriptor(childDesc, platform)
+			if err != nil {
+				return nil, err
+			}
+			desc, err := child.remoteIndex().findChildByPlatform(platform)
+			if err != nil || desc != nil {
+				return desc, err
+			}
+			continue
+		}
+
 		// If platform is missing from child descriptor, assume it's amd64/linux.
 		p := defaultPlatform
 		if childDesc.Platform != nil {
@@ -179,7 +214,7 @@ func (r *remoteIndex) childByPlatform(platform v1.Platform) (*Descriptor, error)
 			return r.childDescriptor(childDesc, platform)
 		}
 	}
-	return nil, fmt.Errorf("no child with platform %s/%s in index %s", platform.OS, platform.Architecture, r.Ref)
+	return nil, nil
 }
 
 func (r *remoteIndex) childByHash(h v1.Hash) (*Descriptor, error) {
@@ -204,58 +239,25 @@ func (r *remoteIndex) childDescriptor(child v1.Descriptor, platform v1.Platform)
 	}
 	return &Descriptor{
 		fetcher: fetcher{
-			Ref:     ref,
-			Client:  r.Client,
-			context: r.context,
+			Ref:               ref,
+			Client:            r.Client,
+			context:           r.context,
+			verifyDigests:     r.verifyDigests,
+			strictContentType: r.strictContentType,
+			mirrors:           r.mirrors,
+			manifestAccept:    r.manifestAccept,
+			limits:            r.limits,
 		},
-		Manifest:   manifest,
-		Descriptor: child,
-		platform:   platform,
+		Manifest:         manifest,
+		Descriptor:       child,
+		platform:         platform,
+		layerConcurrency: r.layerConcurrency,
+		layerDir:         r.layerDir,
 	}, nil
 }
 
-// matchesPlatform checks if the given platform matches the required platforms.
-// The given platform matches the required platform if
-// - architecture and OS are identical.
-// - OS version and variant are identical if provided.
-// - features and OS features of the required platform are subsets of those of the given platform.
+// matchesPlatform checks if the given platform matches the required platform,
+// see v1.Platform.Satisfies.
 func matchesPlatform(given, required v1.Platform) bool {
-	// Required fields that must be identical.
-	if given.Architecture != required.Architecture || given.OS != required.OS {
-		return false
-	}
-
-	// Optional fields that may be empty, but must be identical if provided.
-	if required.OSVersion != "" && given.OSVersion != required.OSVersion {
-		return false
-	}
-	if required.Variant != "" && given.Variant != required.Variant {
-		return false
-	}
-
-	// Verify required platform's features are a subset of given platform's features.
-	if !isSubset(given.OSFeatures, required.OSFeatures) {
-		return false
-	}
-	if !isSubset(given.Features, required.Features) {
-		return false
-	}
-
-	return true
-}
-
-// isSubset checks if the required array of strings is a subset of the given lst.
-func isSubset(lst, required []string) bool {
-	set := make(map[string]bool)
-	for _, value := range lst {
-		set[value] = true
-	}
-
-	for _, value := range required {
-		if _, ok := set[value]; !ok {
-			return false
-		}
-	}
-
-	return true
+	return given.Satisfies(required)
 }
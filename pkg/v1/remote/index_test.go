@@ -24,7 +24,11 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 )
@@ -503,3 +507,154 @@ func TestMatchesPlatform(t *testing.T) {
 	}
 
 }
+
+func TestImageByPlatform(t *testing.T) {
+	platforms := map[string]v1.Platform{
+		"ltsc2019": {Architecture: "amd64", OS: "windows", OSVersion: "10.0.17763.1879"},
+		"ltsc2022": {Architecture: "amd64", OS: "windows", OSVersion: "10.0.20348.643"},
+		"armv6":    {Architecture: "arm", OS: "linux", Variant: "v6"},
+		"armv7":    {Architecture: "arm", OS: "linux", Variant: "v7"},
+	}
+	digests := map[string]v1.Hash{}
+	var idx v1.ImageIndex = empty.Index
+	for key, p := range platforms {
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := p
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &p},
+		})
+		if digests[key], err = img.Digest(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(u.Host + "/multi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteIndex(ref, idx); err != nil {
+		t.Fatalf("WriteIndex() = %v", err)
+	}
+
+	for _, tc := range []struct {
+		platform v1.Platform
+		want     string
+	}{
+		{v1.Platform{Architecture: "amd64", OS: "windows", OSVersion: "10.0.17763"}, "ltsc2019"},
+		{v1.Platform{Architecture: "amd64", OS: "windows", OSVersion: "10.0.20348.643"}, "ltsc2022"},
+		{v1.Platform{Architecture: "arm", OS: "linux", Variant: "v6"}, "armv6"},
+		{v1.Platform{Architecture: "arm", OS: "linux", Variant: "v7"}, "armv7"},
+	} {
+		img, err := Image(ref, WithPlatform(tc.platform))
+		if err != nil {
+			t.Errorf("Image(%v) = %v", tc.platform, err)
+			continue
+		}
+		if got := mustDigest(t, img); got != digests[tc.want] {
+			t.Errorf("Image(%v) = %s, want %s (%s)", tc.platform, got, digests[tc.want], tc.want)
+		}
+	}
+
+	if _, err := Image(ref, WithPlatform(v1.Platform{Architecture: "amd64", OS: "windows", OSVersion: "10.0.14393"})); err == nil {
+		t.Error("Image(ltsc2016) = nil, wanted error")
+	}
+}
+
+func TestImageByNestedPlatform(t *testing.T) {
+	// Sub-indexes by OS.
+	subIndexes := map[string]map[string]v1.Platform{
+		"linux": {
+			"amd64": {Architecture: "amd64", OS: "linux"},
+			"arm64": {Architecture: "arm64", OS: "linux"},
+		},
+		"windows": {
+			"ltsc2019": {Architecture: "amd64", OS: "windows", OSVersion: "10.0.17763.1879"},
+			"ltsc2022": {Architecture: "amd64", OS: "windows", OSVersion: "10.0.20348.643"},
+		},
+	}
+	digests := map[string]v1.Hash{}
+	var idx v1.ImageIndex = empty.Index
+	for goos, platforms := range subIndexes {
+		var sub v1.ImageIndex = empty.Index
+		for key, p := range platforms {
+			img, err := random.Image(1024, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := p
+			sub = mutate.AppendManifests(sub, mutate.IndexAddendum{
+				Add:        img,
+				Descriptor: v1.Descriptor{Platform: &p},
+			})
+			if digests[key], err = img.Digest(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{
+			Add:        sub,
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: goos}},
+		})
+	}
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(u.Host + "/nested")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteIndex(ref, idx); err != nil {
+		t.Fatalf("WriteIndex() = %v", err)
+	}
+
+	// The platforms of the sub-indexes survive the round trip.
+	got, err := Index(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := got.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, desc := range m.Manifests {
+		if desc.Platform == nil || subIndexes[desc.Platform.OS] == nil {
+			t.Errorf("sub-index %s has platform %v", desc.Digest, desc.Platform)
+		}
+	}
+
+	for _, tc := range []struct {
+		platform v1.Platform
+		want     string
+	}{
+		{v1.Platform{Architecture: "amd64", OS: "linux"}, "amd64"},
+		{v1.Platform{Architecture: "arm64", OS: "linux"}, "arm64"},
+		{v1.Platform{Architecture: "amd64", OS: "windows", OSVersion: "10.0.17763"}, "ltsc2019"},
+		{v1.Platform{Architecture: "amd64", OS: "windows", OSVersion: "10.0.20348"}, "ltsc2022"},
+	} {
+		img, err := Image(ref, WithPlatform(tc.platform))
+		if err != nil {
+			t.Errorf("Image(%v) = %v", tc.platform, err)
+			continue
+		}
+		if got := mustDigest(t, img); got != digests[tc.want] {
+			t.Errorf("Image(%v) = %s, want %s (%s)", tc.platform, got, digests[tc.want], tc.want)
+		}
+	}
+
+	if _, err := Image(ref, WithPlatform(v1.Platform{Architecture: "s390x", OS: "linux"})); err == nil {
+		t.Error("Image(linux/s390x) = nil, wanted error")
+	}
+}
@@ -15,7 +15,9 @@
 package remote
 
 import (
+	"fmt"
 	"io"
+	"sync"
 
 	"github.com/google/go-containerregistry/internal/redact"
 	"github.com/google/go-containerregistry/internal/verify"
@@ -29,6 +31,18 @@ import (
 type remoteLayer struct {
 	fetcher
 	digest v1.Hash
+
+	// Guards the fields below, which are only set once they're known.
+	mu sync.Mutex
+	// From a single HEAD request, see head.
+	size      *int64
+	mediaType types.MediaType
+
+	// Guards diffID separately, so that computing it doesn't block the
+	// methods above behind a download.
+	diffIDMu sync.Mutex
+	// See WithDiffID, or computed by decompressing the layer once.
+	diffID *v1.Hash
 }
 
 // Compressed implements partial.CompressedLayer
@@ -38,14 +52,48 @@ func (rl *remoteLayer) Compressed() (io.ReadCloser, error) {
 	return rl.fetchBlob(ctx, verify.SizeUnknown, rl.digest)
 }
 
-// Compressed implements partial.CompressedLayer
-func (rl *remoteLayer) Size() (int64, error) {
+// head sets the size and media type of the layer from a HEAD request, unless
+// they're known.
+func (rl *remoteLayer) head() error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.size != nil {
+		return nil
+	}
 	resp, err := rl.headBlob(rl.digest)
 	if err != nil {
-		return -1, err
+		return err
 	}
 	defer resp.Body.Close()
-	return resp.ContentLength, nil
+
+	// Most registries serve blobs as application/octet-stream, so only trust
+	// the Content-Type if it's that of a layer.
+	rl.mediaType = types.DockerLayer
+	if mt := types.MediaType(resp.Header.Get("Content-Type")); layerMediaTypes[mt] {
+		rl.mediaType = mt
+	}
+	rl.size = &resp.ContentLength
+	return nil
+}
+
+// layerMediaTypes are the media types of layers, see remoteLayer.head.
+var layerMediaTypes = map[types.MediaType]bool{
+	types.DockerLayer:                    true,
+	types.DockerUncompressedLayer:        true,
+	types.DockerForeignLayer:             true,
+	types.OCILayer:                       true,
+	types.OCILayerZStd:                   true,
+	types.OCIUncompressedLayer:           true,
+	types.OCIRestrictedLayer:             true,
+	types.OCIUncompressedRestrictedLayer: true,
+}
+
+// Size implements partial.CompressedLayer
+func (rl *remoteLayer) Size() (int64, error) {
+	if err := rl.head(); err != nil {
+		return -1, err
+	}
+	return *rl.size, nil
 }
 
 // Digest implements partial.CompressedLayer
@@ -55,7 +103,37 @@ func (rl *remoteLayer) Digest() (v1.Hash, error) {
 
 // MediaType implements v1.Layer
 func (rl *remoteLayer) MediaType() (types.MediaType, error) {
-	return types.DockerLayer, nil
+	if err := rl.head(); err != nil {
+		return "", err
+	}
+	return rl.mediaType, nil
+}
+
+// DiffID implements partial.WithDiffID, so that the layer is downloaded at
+// most once to compute it.
+func (rl *remoteLayer) DiffID() (v1.Hash, error) {
+	rl.diffIDMu.Lock()
+	defer rl.diffIDMu.Unlock()
+	if rl.diffID != nil {
+		return *rl.diffID, nil
+	}
+
+	// Only Uncompressed, which doesn't call DiffID, is used.
+	l, err := partial.CompressedToLayer(rl)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	rc, err := l.Uncompressed()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	defer rc.Close()
+	h, _, err := v1.SHA256(rc)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	rl.diffID = &h
+	return h, nil
 }
 
 // See partial.Exists.
@@ -67,6 +145,12 @@ func (rl *remoteLayer) Exists() (bool, error) {
 // reference here is just a punned name.Digest where the digest portion is the
 // digest of the blob to be read and the repository portion is the repo where
 // that blob lives.
+//
+// The layer is lazy: nothing is read until it's needed. Its Size and
+// MediaType come from a HEAD request, and Compressed streams the blob. Its
+// DiffID is computed by downloading the blob once, unless it's given with
+// WithDiffID. Writing the layer, or an image that contains it, to another
+// repository on the same registry mounts the blob instead of uploading it.
 func Layer(ref name.Digest, options ...Option) (v1.Layer, error) {
 	o, err := makeOptions(ref.Context(), options...)
 	if err != nil {
@@ -83,6 +167,7 @@ func Layer(ref name.Digest, options ...Option) (v1.Layer, error) {
 	l, err := partial.CompressedToLayer(&remoteLayer{
 		fetcher: *f,
 		digest:  h,
+		diffID:  o.diffID,
 	})
 	if err != nil {
 		return nil, err
@@ -92,3 +177,49 @@ func Layer(ref name.Digest, options ...Option) (v1.Layer, error) {
 		Reference: ref,
 	}, nil
 }
+
+// BlobExists returns whether the blob referenced by ref exists in the
+// registry, by issuing a HEAD request, without downloading it.
+func BlobExists(ref name.Digest, options ...Option) (bool, error) {
+	o, err := makeOptions(ref.Context(), options...)
+	if err != nil {
+		return false, err
+	}
+	f, err := makeFetcher(ref, o)
+	if err != nil {
+		return false, err
+	}
+	h, err := v1.NewHash(ref.Identifier())
+	if err != nil {
+		return false, err
+	}
+	return f.blobExists(h)
+}
+
+// BlobRange reads length bytes of the blob referenced by ref, starting at
+// offset, by issuing a Range request, e.g. to read part of an estargz layer
+// without downloading all of it. If the registry ignores the Range header and
+// responds with the whole blob, the range is sliced out of it as it is read.
+//
+// Fewer than length bytes are returned if the blob ends before offset+length.
+// Unlike Layer, the partial content can't be verified against the digest.
+func BlobRange(ref name.Digest, offset, length int64, options ...Option) (io.ReadCloser, error) {
+	if offset < 0 || length <= 0 {
+		return nil, fmt.Errorf("invalid range: offset %d, length %d", offset, length)
+	}
+	o, err := makeOptions(ref.Context(), options...)
+	if err != nil {
+		return nil, err
+	}
+	f, err := makeFetcher(ref, o)
+	if err != nil {
+		return nil, err
+	}
+	h, err := v1.NewHash(ref.Identifier())
+	if err != nil {
+		return nil, err
+	}
+	// We don't want to log binary layers -- this can break terminals.
+	ctx := redact.NewContext(f.context, "omitting binary blobs from logs")
+	return f.fetchBlobRange(ctx, h, offset, length)
+}
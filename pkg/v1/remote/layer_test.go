@@ -15,10 +15,16 @@
 package remote
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-containerregistry/internal/compare"
 	"github.com/google/go-containerregistry/pkg/name"
@@ -86,6 +92,93 @@ func TestRemoteLayer(t *testing.T) {
 	}
 }
 
+func TestRemoteLayerMount(t *testing.T) {
+	reg := registry.New()
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer, err := random.Layer(1024, types.OCILayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := layer.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffID, err := layer.DiffID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := name.NewDigest(fmt.Sprintf("%s/src@%s", u.Host, digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteLayer(src.Context(), layer); err != nil {
+		t.Fatal(err)
+	}
+	dst, err := name.ParseReference(fmt.Sprintf("%s/dst:latest", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	requests = nil
+	mu.Unlock()
+
+	l, err := Layer(src, WithDiffID(diffID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.AppendLayers(empty.Image, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(dst, img); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	got := requests
+	mu.Unlock()
+	heads := 0
+	blob := "/v2/src/blobs/" + digest.String()
+	for _, r := range got {
+		switch r {
+		case http.MethodGet + " " + blob:
+			t.Errorf("read the blob: %v", got)
+		case http.MethodHead + " " + blob:
+			heads++
+		}
+	}
+	if heads != 1 {
+		t.Errorf("sent %d HEAD requests for the blob, want 1: %v", heads, got)
+	}
+	if ok, err := BlobExists(dst.Context().Digest(digest.String())); err != nil || !ok {
+		t.Errorf("BlobExists() = %t, %v, wanted mounted blob", ok, err)
+	}
+
+	// The Content-Type of the blob isn't that of a layer, so this is the default.
+	if mt, err := l.MediaType(); err != nil || mt != types.DockerLayer {
+		t.Errorf("MediaType() = %s, %v", mt, err)
+	}
+	if d, err := l.DiffID(); err != nil || d != diffID {
+		t.Errorf("DiffID() = %s, %v, want %s", d, err, diffID)
+	}
+}
+
 func TestRemoteLayerDescriptor(t *testing.T) {
 	layer, err := random.Layer(1024, types.DockerLayer)
 	if err != nil {
@@ -146,3 +239,215 @@ func TestRemoteLayerDescriptor(t *testing.T) {
 		t.Errorf("Exists() = %t != %t", got, want)
 	}
 }
+
+func TestBlobExists(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer, err := random.Layer(1024, types.DockerLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := layer.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := fmt.Sprintf("%s/some/path@%s", u.Host, h)
+	ref, err := name.NewDigest(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, err := BlobExists(ref); err != nil {
+		t.Fatalf("BlobExists() = %v", err)
+	} else if exists {
+		t.Error("BlobExists() = true before write, want false")
+	}
+
+	if err := WriteLayer(ref.Context(), layer); err != nil {
+		t.Fatalf("WriteLayer() = %v", err)
+	}
+
+	if exists, err := BlobExists(ref); err != nil {
+		t.Fatalf("BlobExists() = %v", err)
+	} else if !exists {
+		t.Error("BlobExists() = false after write, want true")
+	}
+}
+
+// rangeRegistry serves Range requests for blobs, which registry.New ignores.
+type rangeRegistry struct {
+	http.Handler
+}
+
+func (rr *rangeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || !strings.Contains(r.URL.Path, "/blobs/sha256:") {
+		rr.Handler.ServeHTTP(w, r)
+		return
+	}
+	full := r.Clone(r.Context())
+	full.Header.Del("Range")
+	rec := httptest.NewRecorder()
+	rr.Handler.ServeHTTP(rec, full)
+	if rec.Code != http.StatusOK {
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+		return
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(rec.Body.Bytes()))
+}
+
+func TestBlobRange(t *testing.T) {
+	layer, err := random.Layer(1024, types.DockerLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := layer.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := layer.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(blob))
+
+	for _, tc := range []struct {
+		name    string
+		handler http.Handler
+	}{{
+		name:    "ignores Range",
+		handler: registry.New(),
+	}, {
+		name:    "supports Range",
+		handler: &rangeRegistry{registry.New()},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := httptest.NewServer(tc.handler)
+			defer s.Close()
+			u, err := url.Parse(s.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ref, err := name.NewDigest(fmt.Sprintf("%s/some/path@%s", u.Host, h))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := WriteLayer(ref.Context(), layer); err != nil {
+				t.Fatalf("WriteLayer() = %v", err)
+			}
+
+			for _, r := range []struct {
+				offset, length int64
+			}{
+				{0, 10},
+				{100, 50},
+				{size - 1, 1},
+				// Past the end of the blob.
+				{size - 10, 100},
+			} {
+				rc, err := BlobRange(ref, r.offset, r.length)
+				if err != nil {
+					t.Errorf("BlobRange(%d, %d) = %v", r.offset, r.length, err)
+					continue
+				}
+				got, err := ioutil.ReadAll(rc)
+				if err != nil {
+					t.Errorf("ReadAll() = %v", err)
+				}
+				rc.Close()
+				end := r.offset + r.length
+				if end > size {
+					end = size
+				}
+				if want := blob[r.offset:end]; !bytes.Equal(got, want) {
+					t.Errorf("BlobRange(%d, %d) = %x, want %x", r.offset, r.length, got, want)
+				}
+			}
+
+			for _, r := range []struct {
+				offset, length int64
+			}{
+				{size + 10, 10},
+				{-1, 10},
+				{0, 0},
+			} {
+				if _, err := BlobRange(ref, r.offset, r.length); err == nil {
+					t.Errorf("BlobRange(%d, %d) = nil, want error", r.offset, r.length)
+				}
+			}
+		})
+	}
+}
+
+func TestRemoteLayerDiffIDDoesNotBlock(t *testing.T) {
+	layer, err := random.Layer(1024, types.DockerLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := layer.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := layer.DiffID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg := registry.New()
+	downloading, unblock := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+			once.Do(func() { close(downloading) })
+			<-unblock
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.NewDigest(fmt.Sprintf("%s/some/path@%s", u.Host, digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteLayer(ref.Context(), layer); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Layer(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error)
+	go func() {
+		got, err := l.DiffID()
+		if err == nil && got != want {
+			err = fmt.Errorf("DiffID() = %s, want %s", got, want)
+		}
+		errs <- err
+	}()
+
+	// Size and MediaType don't wait for the download of DiffID.
+	<-downloading
+	if _, err := l.Size(); err != nil {
+		t.Errorf("Size() = %v", err)
+	}
+	if _, err := l.MediaType(); err != nil {
+		t.Errorf("MediaType() = %v", err)
+	}
+	close(unblock)
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+)
+
+// ErrLimitExceeded is wrapped by the errors returned when a manifest or image
+// is larger than allowed by WithMaxManifestSize, WithMaxLayers or
+// WithMaxImageSize.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// limits are the sizes set by WithMaxManifestSize, WithMaxLayers and
+// WithMaxImageSize; zero means unlimited.
+type limits struct {
+	maxManifestSize int64
+	maxLayers       int
+	maxImageSize    int64
+}
+
+// readManifest reads the body of a manifest response, giving up once it's
+// larger than maxManifestSize.
+func (l limits) readManifest(r io.Reader) ([]byte, error) {
+	if l.maxManifestSize == 0 {
+		return ioutil.ReadAll(r)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r, l.maxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > l.maxManifestSize {
+		return nil, fmt.Errorf("manifest is larger than %d bytes: %w", l.maxManifestSize, ErrLimitExceeded)
+	}
+	return b, nil
+}
+
+// checkManifest checks the number of layers and the size of the blobs that an
+// image manifest refers to.
+func (l limits) checkManifest(manifest []byte) error {
+	if l.maxLayers == 0 && l.maxImageSize == 0 {
+		return nil
+	}
+	var m v1.Manifest
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		// Not an image manifest, or a broken one, which fails when it's parsed
+		// later anyway.
+		return nil
+	}
+	if l.maxLayers != 0 && len(m.Layers) > l.maxLayers {
+		return fmt.Errorf("image has %d layers, more than %d: %w", len(m.Layers), l.maxLayers, ErrLimitExceeded)
+	}
+	if l.maxImageSize != 0 {
+		var size int64
+		for _, desc := range append([]v1.Descriptor{m.Config}, m.Layers...) {
+			// Written this way around, the sum can't overflow.
+			if desc.Size > l.maxImageSize-size {
+				return fmt.Errorf("image is larger than %d bytes: %w", l.maxImageSize, ErrLimitExceeded)
+			}
+			size += desc.Size
+		}
+	}
+	return nil
+}
+
+// budget tracks how much has been decompressed from the layers of an image,
+// to enforce WithMaxImageSize. Reading a layer again doesn't count twice.
+type budget struct {
+	max int64
+
+	mu    sync.Mutex
+	read  map[v1.Hash]int64
+	total int64
+}
+
+// newBudget returns nil, which doesn't limit anything, if max is zero.
+func newBudget(max int64) *budget {
+	if max == 0 {
+		return nil
+	}
+	return &budget{
+		max:  max,
+		read: map[v1.Hash]int64{},
+	}
+}
+
+// layer wraps l so that reading it decompressed draws from b.
+func (b *budget) layer(l v1.Layer) v1.Layer {
+	if b == nil {
+		return l
+	}
+	return &limitedLayer{Layer: l, budget: b}
+}
+
+// spend records that n bytes have been read from the layer h.
+func (b *budget) spend(h v1.Hash, n int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n > b.read[h] {
+		b.total += n - b.read[h]
+		b.read[h] = n
+	}
+	if b.total > b.max {
+		return fmt.Errorf("image is larger than %d bytes decompressed: %w", b.max, ErrLimitExceeded)
+	}
+	return nil
+}
+
+type limitedLayer struct {
+	v1.Layer
+	budget *budget
+}
+
+// Uncompressed implements v1.Layer
+func (l *limitedLayer) Uncompressed() (io.ReadCloser, error) {
+	d, err := l.Digest()
+	if err != nil {
+		return nil, err
+	}
+	rc, err := l.Layer.Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	return &limitedReader{ReadCloser: rc, budget: l.budget, digest: d}, nil
+}
+
+// Descriptor retains the original descriptor from an image manifest.
+// See partial.Descriptor.
+func (l *limitedLayer) Descriptor() (*v1.Descriptor, error) {
+	return partial.Descriptor(l.Layer)
+}
+
+// Exists is a hack. See partial.Exists.
+func (l *limitedLayer) Exists() (bool, error) {
+	return partial.Exists(l.Layer)
+}
+
+type limitedReader struct {
+	io.ReadCloser
+	budget *budget
+	digest v1.Hash
+	n      int64
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	if berr := r.budget.spend(r.digest, r.n); berr != nil {
+		return n, berr
+	}
+	return n, err
+}
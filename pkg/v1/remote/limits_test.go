@@ -0,0 +1,154 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// zeroLayer returns a layer with a file of size zeros, which compresses to
+// almost nothing.
+func zeroLayer(t *testing.T, size int64) v1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "zeros", Typeflag: tar.TypeReg, Mode: 0644, Size: size}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(make([]byte, size)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	l, err := tarball.LayerFromReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func readAll(l v1.Layer) error {
+	rc, err := l.Uncompressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.Copy(ioutil.Discard, rc)
+	return err
+}
+
+func TestLimits(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := mustNewTag(t, fmt.Sprintf("%s/repo:random", u.Host))
+	if err := Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		desc    string
+		opt     Option
+		wantErr bool
+	}{
+		{"manifest too large", WithMaxManifestSize(100), true},
+		{"manifest", WithMaxManifestSize(1 << 20), false},
+		{"too many layers", WithMaxLayers(2), true},
+		{"layers", WithMaxLayers(3), false},
+		{"image too large", WithMaxImageSize(1024), true},
+		{"image", WithMaxImageSize(1 << 20), false},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := Image(ref, tc.opt)
+			if tc.wantErr {
+				if !errors.Is(err, ErrLimitExceeded) {
+					t.Errorf("Image() = %v, want %v", err, ErrLimitExceeded)
+				}
+			} else if err != nil {
+				t.Errorf("Image() = %v", err)
+			}
+		})
+	}
+}
+
+func TestMaxImageSizeDecompressed(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := mutate.AppendLayers(empty.Image, zeroLayer(t, 1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := mustNewTag(t, fmt.Sprintf("%s/repo:zeros", u.Host))
+	if err := Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	// The compressed layer is small enough, but not what it expands to.
+	small, err := Image(ref, WithMaxImageSize(64<<10))
+	if err != nil {
+		t.Fatalf("Image() = %v", err)
+	}
+	ls, err := small.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := readAll(ls[0]); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("reading layer = %v, want %v", err, ErrLimitExceeded)
+	}
+
+	// Reading the same layer again doesn't count against the limit.
+	large, err := Image(ref, WithMaxImageSize(3<<19))
+	if err != nil {
+		t.Fatalf("Image() = %v", err)
+	}
+	ls, err = large.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := readAll(ls[0]); err != nil {
+			t.Errorf("reading layer = %v", err)
+		}
+	}
+}
@@ -16,7 +16,6 @@ package remote
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -38,81 +37,91 @@ func List(repo name.Repository, options ...Option) ([]string, error) {
 
 // ListWithContext calls /tags/list for the given repository, returning the list of tags
 // in the "tags" property.
+//
+// See NewLister to process the tags one page at a time.
 func ListWithContext(ctx context.Context, repo name.Repository, options ...Option) ([]string, error) {
-	o, err := makeOptions(repo, options...)
-	if err != nil {
-		return nil, err
-	}
-	scopes := []string{repo.Scope(transport.PullScope)}
-	tr, err := transport.NewWithContext(o.context, repo.Registry, o.auth, o.transport, scopes)
+	l, err := NewLister(repo, options...)
 	if err != nil {
 		return nil, err
 	}
 
-	uri := &url.URL{
-		Scheme: repo.Registry.Scheme(),
-		Host:   repo.Registry.RegistryStr(),
-		Path:   fmt.Sprintf("/v2/%s/tags/list", repo.RepositoryStr()),
-		// ECR returns an error if n > 1000:
-		// https://github.com/google/go-containerregistry/issues/681
-		RawQuery: "n=1000",
-	}
-
 	// This is lazy, but I want to make sure List(..., WithContext(ctx)) works
 	// without calling makeOptions() twice (which can have side effects).
 	// This means ListWithContext(ctx, ..., WithContext(ctx2)) prefers ctx2.
-	if o.context != context.Background() {
-		ctx = o.context
+	if l.context != context.Background() {
+		ctx = l.context
 	}
 
-	client := http.Client{Transport: tr}
 	tagList := []string{}
-	parsed := tags{}
 
 	// get responses until there is no next page
-	for {
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		default:
-		}
-
-		req, err := http.NewRequest("GET", uri.String(), nil)
+	for l.HasNext() {
+		page, err := l.Next(ctx)
 		if err != nil {
 			return nil, err
 		}
-		req = req.WithContext(ctx)
+		tagList = append(tagList, page...)
+	}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, err
-		}
+	return tagList, nil
+}
 
-		if err := transport.CheckError(resp, http.StatusOK); err != nil {
-			return nil, err
-		}
+// Lister lists the tags of a repository lazily, one page at a time, by
+// following the registry's Link headers.
+type Lister struct {
+	pager
+	context context.Context
+}
 
-		if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-			return nil, err
-		}
+// NewLister returns a Lister for the tags of the given repository.
+//
+// See WithPageSize to control how many tags are requested per page.
+func NewLister(repo name.Repository, options ...Option) (*Lister, error) {
+	o, err := makeOptions(repo, options...)
+	if err != nil {
+		return nil, err
+	}
+	scopes := []string{repo.Scope(transport.PullScope)}
+	tr, err := o.newTransport(repo.Registry, scopes)
+	if err != nil {
+		return nil, err
+	}
 
-		if err := resp.Body.Close(); err != nil {
-			return nil, err
-		}
+	// ECR returns an error if n > 1000:
+	// https://github.com/google/go-containerregistry/issues/681
+	n := 1000
+	if o.pageSize > 0 {
+		n = o.pageSize
+	}
+	uri := &url.URL{
+		Scheme:   repo.Registry.Scheme(),
+		Host:     repo.Registry.RegistryStr(),
+		Path:     fmt.Sprintf("/v2/%s/tags/list", repo.RepositoryStr()),
+		RawQuery: fmt.Sprintf("n=%d", n),
+	}
 
-		tagList = append(tagList, parsed.Tags...)
+	return &Lister{
+		pager: pager{
+			client: http.Client{Transport: tr},
+			next:   uri,
+		},
+		context: o.context,
+	}, nil
+}
 
-		uri, err = getNextPageURL(resp)
-		if err != nil {
-			return nil, err
-		}
-		// no next page
-		if uri == nil {
-			break
-		}
-	}
+// HasNext returns true if there are more pages of tags.
+func (l *Lister) HasNext() bool {
+	return l.hasNext()
+}
 
-	return tagList, nil
+// Next returns the next page of tags. It returns an error if there are no
+// more pages, see HasNext.
+func (l *Lister) Next(ctx context.Context) ([]string, error) {
+	parsed := tags{}
+	if err := l.fetch(ctx, &parsed); err != nil {
+		return nil, err
+	}
+	return parsed.Tags, nil
 }
 
 // getNextPageURL checks if there is a Link header in a http.Response which
@@ -16,10 +16,12 @@ package remote
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -85,6 +87,95 @@ func TestList(t *testing.T) {
 	}
 }
 
+// paginate serves a paginated list of results.
+func paginate(t *testing.T, w http.ResponseWriter, r *http.Request, all []string, field string) {
+	t.Helper()
+	n, err := strconv.Atoi(r.URL.Query().Get("n"))
+	if err != nil {
+		t.Fatalf("bad n: %v", err)
+	}
+	start := 0
+	if last := r.URL.Query().Get("last"); last != "" {
+		for i, item := range all {
+			if item == last {
+				start = i + 1
+			}
+		}
+	}
+	end := start + n
+	if end >= len(all) {
+		end = len(all)
+	} else {
+		next := url.Values{"n": []string{strconv.Itoa(n)}, "last": []string{all[end-1]}}
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, next.Encode()))
+	}
+	json.NewEncoder(w).Encode(map[string][]string{field: all[start:end]})
+}
+
+func TestLister(t *testing.T) {
+	repoName := "ubuntu"
+	all := []string{"a", "b", "c", "d", "e", "f", "g"}
+	tagsPath := fmt.Sprintf("/v2/%s/tags/list", repoName)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case tagsPath:
+			requests++
+			paginate(t, w, r, all, "tags")
+		default:
+			t.Fatalf("Unexpected path: %v", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse(%v) = %v", server.URL, err)
+	}
+	repo, err := name.NewRepository(fmt.Sprintf("%s/%s", u.Host, repoName), name.WeakValidation)
+	if err != nil {
+		t.Fatalf("name.NewRepository(%v) = %v", repoName, err)
+	}
+
+	l, err := NewLister(repo, WithPageSize(3))
+	if err != nil {
+		t.Fatalf("NewLister() = %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("NewLister() made %d requests, want 0", requests)
+	}
+
+	var pages [][]string
+	for l.HasNext() {
+		page, err := l.Next(context.Background())
+		if err != nil {
+			t.Fatalf("Next() = %v", err)
+		}
+		pages = append(pages, page)
+	}
+	want := [][]string{{"a", "b", "c"}, {"d", "e", "f"}, {"g"}}
+	if diff := cmp.Diff(want, pages); diff != "" {
+		t.Errorf("Next() wrong pages (-want +got) = %s", diff)
+	}
+	if _, err := l.Next(context.Background()); err == nil {
+		t.Error("Next() after last page = nil, wanted error")
+	}
+
+	// List follows all the pages, too.
+	tags, err := List(repo, WithPageSize(2))
+	if err != nil {
+		t.Fatalf("List() = %v", err)
+	}
+	if diff := cmp.Diff(all, tags); diff != "" {
+		t.Errorf("List() wrong tags (-want +got) = %s", diff)
+	}
+
+	if _, err := NewLister(repo, WithPageSize(0)); err == nil {
+		t.Error("NewLister(WithPageSize(0)) = nil, wanted error")
+	}
+}
+
 func TestCancelledList(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
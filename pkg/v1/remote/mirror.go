@@ -0,0 +1,110 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/logs"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// mirror is a registry that is tried before the canonical one when pulling.
+type mirror struct {
+	reg    name.Registry
+	client *http.Client
+}
+
+func makeMirrors(ref name.Reference, o *options) []mirror {
+	mirrors := make([]mirror, 0, len(o.mirrors))
+	for _, reg := range o.mirrors {
+		reg := reg
+		tr := &lazyTransport{init: func() (http.RoundTripper, error) {
+			// Don't send the canonical registry's credentials to mirrors.
+			auth := authn.Anonymous
+			if o.keychain != nil {
+				var err error
+				auth, err = o.keychain.Resolve(reg)
+				if err != nil {
+					return nil, err
+				}
+			}
+			return transport.NewWithContext(o.context, reg, auth, o.transport, []string{ref.Scope(transport.PullScope)})
+		}}
+		mirrors = append(mirrors, mirror{
+			reg:    reg,
+			client: &http.Client{Transport: tr},
+		})
+	}
+	return mirrors
+}
+
+// do sends the GET request req, which targets the canonical registry, to
+// each of the mirrors in turn. If a mirror can't be reached or doesn't have
+// what we're looking for, we move on to the next one and eventually fall
+// back to the canonical registry.
+func (f *fetcher) do(req *http.Request) (*http.Response, error) {
+	if len(f.mirrors) == 0 {
+		return f.Client.Do(req)
+	}
+
+	for _, m := range f.mirrors {
+		mreq := req.Clone(req.Context())
+		mreq.URL.Scheme = m.reg.Scheme()
+		mreq.URL.Host = m.reg.RegistryStr()
+		mreq.Host = mreq.URL.Host
+
+		resp, err := m.client.Do(mreq)
+		if err != nil {
+			logs.Debug.Printf("Mirror %s failed for %s: %v", m.reg, req.URL, err)
+			continue
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			logs.Debug.Printf("Mirror %s does not have %s", m.reg, req.URL)
+			continue
+		}
+		logs.Debug.Printf("Resolved %s to %s", req.URL, mreq.URL)
+		return resp, nil
+	}
+
+	logs.Debug.Printf("Resolved %s to the canonical registry", req.URL)
+	return f.Client.Do(req)
+}
+
+// lazyTransport defers setting up its inner transport, which pings the
+// registry, until the first request. This lets us skip unreachable mirrors
+// and unreachable canonical registries, if a mirror can serve everything.
+type lazyTransport struct {
+	init func() (http.RoundTripper, error)
+
+	once  sync.Once
+	inner http.RoundTripper
+	err   error
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *lazyTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	t.once.Do(func() {
+		t.inner, t.err = t.init()
+	})
+	if t.err != nil {
+		return nil, t.err
+	}
+	return t.inner.RoundTrip(in)
+}
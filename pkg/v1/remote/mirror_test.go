@@ -0,0 +1,181 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+// requestCounter counts the manifest and blob requests served by a registry.
+type requestCounter struct {
+	handler http.Handler
+
+	sync.Mutex
+	gets, writes int
+}
+
+func (rc *requestCounter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.Contains(r.URL.Path, "/manifests/") || strings.Contains(r.URL.Path, "/blobs/") {
+		rc.Lock()
+		switch r.Method {
+		case http.MethodGet:
+			rc.gets++
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+			rc.writes++
+		}
+		rc.Unlock()
+	}
+	rc.handler.ServeHTTP(w, r)
+}
+
+func (rc *requestCounter) counts() (gets, writes int) {
+	rc.Lock()
+	defer rc.Unlock()
+	return rc.gets, rc.writes
+}
+
+// setupMirror starts a registry and returns its name, its request counter,
+// and a function to shut it down.
+func setupMirror(t *testing.T) (name.Registry, *requestCounter, func()) {
+	t.Helper()
+	rc := &requestCounter{handler: registry.New()}
+	s := httptest.NewServer(rc)
+	t.Cleanup(s.Close)
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, err := name.NewRegistry(u.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg, rc, s.Close
+}
+
+func fooRef(t *testing.T, reg name.Registry) name.Reference {
+	t.Helper()
+	ref, err := name.ParseReference(reg.RegistryStr() + "/foo:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref
+}
+
+func pushTo(t *testing.T, reg name.Registry, img v1.Image) {
+	t.Helper()
+	if err := Write(fooRef(t, reg), img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkPull(t *testing.T, ref name.Reference, want v1.Image, mirrors []name.Registry) {
+	t.Helper()
+	img, err := Image(ref, WithMirrors(mirrors))
+	if err != nil {
+		t.Fatalf("Image() = %v", err)
+	}
+	if err := validate.Image(img); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+	got, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDigest, err := want.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != wantDigest {
+		t.Errorf("Digest() = %s, want %s", got, wantDigest)
+	}
+}
+
+func TestMirrors(t *testing.T) {
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("served by mirror", func(t *testing.T) {
+		canonical, canonicalCounter, shutdown := setupMirror(t)
+		empty, emptyCounter, _ := setupMirror(t)
+		full, fullCounter, _ := setupMirror(t)
+		pushTo(t, full, img)
+		ref := fooRef(t, canonical)
+
+		// The canonical registry doesn't need to be reachable.
+		shutdown()
+		checkPull(t, ref, img, []name.Registry{empty, full})
+
+		if gets, _ := canonicalCounter.counts(); gets != 0 {
+			t.Errorf("canonical GETs = %d, want 0", gets)
+		}
+		// Mirrors are tried for every request, not just the first one.
+		emptyGets, _ := emptyCounter.counts()
+		fullGets, _ := fullCounter.counts()
+		if emptyGets != fullGets {
+			t.Errorf("empty mirror GETs = %d, want %d", emptyGets, fullGets)
+		}
+		if fullGets == 0 {
+			t.Error("mirror GETs = 0, want some")
+		}
+	})
+
+	t.Run("fallback to canonical", func(t *testing.T) {
+		canonical, canonicalCounter, _ := setupMirror(t)
+		empty, _, _ := setupMirror(t)
+		down, _, shutdown := setupMirror(t)
+		shutdown()
+		pushTo(t, canonical, img)
+		_, writes := canonicalCounter.counts()
+
+		ref := fooRef(t, canonical)
+		checkPull(t, ref, img, []name.Registry{down, empty})
+
+		if gets, _ := canonicalCounter.counts(); gets == 0 {
+			t.Error("canonical GETs = 0, want some")
+		}
+		if _, after := canonicalCounter.counts(); after != writes {
+			t.Errorf("canonical writes = %d, want %d", after, writes)
+		}
+	})
+
+	t.Run("push ignores mirrors", func(t *testing.T) {
+		canonical, canonicalCounter, _ := setupMirror(t)
+		mirror, mirrorCounter, _ := setupMirror(t)
+		ref := fooRef(t, canonical)
+
+		if err := Write(ref, img, WithMirrors([]name.Registry{mirror})); err != nil {
+			t.Fatalf("Write() = %v", err)
+		}
+		if gets, writes := mirrorCounter.counts(); gets != 0 || writes != 0 {
+			t.Errorf("mirror GETs, writes = %d, %d, want 0, 0", gets, writes)
+		}
+		if _, writes := canonicalCounter.counts(); writes == 0 {
+			t.Error("canonical writes = 0, want some")
+		}
+	})
+}
@@ -39,6 +39,22 @@ func (ml *MountableLayer) Exists() (bool, error) {
 	return partial.Exists(ml.Layer)
 }
 
+// asMountable returns the MountableLayer that l is, or wraps, e.g. after
+// partial.MemoizeLayer or mutate.ConvertToOCI, which implement Unwrap to
+// return the layer they wrap.
+func asMountable(l v1.Layer) (*MountableLayer, bool) {
+	for {
+		switch t := l.(type) {
+		case *MountableLayer:
+			return t, true
+		case interface{ Unwrap() v1.Layer }:
+			l = t.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
 // mountableImage wraps the v1.Layer references returned by the embedded v1.Image
 // in MountableLayer's so that remote.Write might attempt to mount them from their
 // source repository.
@@ -46,6 +62,9 @@ type mountableImage struct {
 	v1.Image
 
 	Reference name.Reference
+
+	// See WithMaxImageSize.
+	budget *budget
 }
 
 // Layers implements v1.Image
@@ -57,7 +76,7 @@ func (mi *mountableImage) Layers() ([]v1.Layer, error) {
 	mls := make([]v1.Layer, 0, len(ls))
 	for _, l := range ls {
 		mls = append(mls, &MountableLayer{
-			Layer:     l,
+			Layer:     mi.budget.layer(l),
 			Reference: mi.Reference,
 		})
 	}
@@ -71,7 +90,7 @@ func (mi *mountableImage) LayerByDigest(d v1.Hash) (v1.Layer, error) {
 		return nil, err
 	}
 	return &MountableLayer{
-		Layer:     l,
+		Layer:     mi.budget.layer(l),
 		Reference: mi.Reference,
 	}, nil
 }
@@ -83,7 +102,7 @@ func (mi *mountableImage) LayerByDiffID(d v1.Hash) (v1.Layer, error) {
 		return nil, err
 	}
 	return &MountableLayer{
-		Layer:     l,
+		Layer:     mi.budget.layer(l),
 		Reference: mi.Reference,
 	}, nil
 }
@@ -15,9 +15,19 @@
 package remote
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
 )
@@ -53,3 +63,77 @@ func TestMountableImage(t *testing.T) {
 		}
 	}
 }
+
+func TestMountWrappedLayers(t *testing.T) {
+	reg := registry.New()
+	var (
+		mu     sync.Mutex
+		mounts int
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The registry shares blobs between repositories, so hide them from
+		// dst to make Write upload or mount them.
+		if r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/v2/dst/blobs/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodPost && r.URL.Query().Get("mount") != "" {
+			mu.Lock()
+			mounts++
+			mu.Unlock()
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := name.ParseReference(fmt.Sprintf("%s/src:latest", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := name.ParseReference(fmt.Sprintf("%s/dst:latest", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(src, want); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := Image(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oci, err := mutate.ConvertToOCI(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		desc string
+		img  v1.Image
+	}{
+		{"memoized", partial.MemoizeImage(img)},
+		{"converted", oci},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			mu.Lock()
+			mounts = 0
+			mu.Unlock()
+			if err := Write(dst, tc.img); err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if mounts != 3 {
+				t.Errorf("mounted %d layers, want 3", mounts)
+			}
+		})
+	}
+}
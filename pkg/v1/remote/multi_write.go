@@ -15,8 +15,13 @@
 package remote
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
@@ -28,7 +33,13 @@ import (
 
 // MultiWrite writes the given Images or ImageIndexes to the given refs, as
 // efficiently as possible, by deduping shared layer blobs and uploading layers
-// in parallel, then uploading all manifests in parallel.
+// in parallel, then uploading all manifests in parallel. All of them share a
+// single authenticated transport.
+//
+// If some of the refs can't be written, e.g. because one of their blobs failed
+// to upload, the others are still written, and a *MultiWriteError reports the
+// ones that failed. If we aren't authorized to push, MultiWrite gives up on the
+// first error.
 //
 // Current limitations:
 // - All refs must share the same repository.
@@ -80,17 +91,20 @@ func MultiWrite(m map[name.Reference]Taggable, options ...Option) (rerr error) {
 	for _, l := range blobs {
 		ls = append(ls, l)
 	}
-	scopes := scopesForUploadingImage(repo, ls)
-	tr, err := transport.NewWithContext(o.context, repo.Registry, o.auth, o.transport, scopes)
+	scopes := scopesForUploadingImage(repo, ls, o.mountFrom...)
+	tr, err := o.newTransport(repo.Registry, scopes)
 	if err != nil {
 		return err
 	}
 	w := writer{
-		repo:       repo,
-		client:     &http.Client{Transport: tr},
-		context:    o.context,
-		updates:    o.updates,
-		lastUpdate: &v1.Update{},
+		repo:              repo,
+		client:            &http.Client{Transport: tr},
+		context:           o.context,
+		updates:           o.updates,
+		lastUpdate:        &v1.Update{},
+		chunkSize:         o.chunkSize,
+		mountFrom:         o.mountFrom,
+		strictContentType: o.strictContentType,
 	}
 
 	// Collect the total size of blobs and manifests we're about to write.
@@ -131,15 +145,25 @@ func MultiWrite(m map[name.Reference]Taggable, options ...Option) (rerr error) {
 		}
 	}
 
-	// Upload individual blobs and collect any errors.
-	blobChan := make(chan v1.Layer, 2*o.jobs)
+	// Upload individual blobs, remembering which ones failed so that only
+	// the manifests referring to them fail, too.
+	var mu sync.Mutex
+	failed := map[v1.Hash]error{}
+	errs := map[name.Reference]error{}
+
+	blobChan := make(chan v1.Hash, 2*o.jobs)
 	g, ctx := errgroup.WithContext(o.context)
 	for i := 0; i < o.jobs; i++ {
 		// Start N workers consuming blobs to upload.
 		g.Go(func() error {
-			for b := range blobChan {
-				if err := w.uploadOne(b); err != nil {
-					return err
+			for h := range blobChan {
+				if err := w.uploadOne(blobs[h]); err != nil {
+					if isFatal(err) {
+						return err
+					}
+					mu.Lock()
+					failed[h] = err
+					mu.Unlock()
 				}
 			}
 			return nil
@@ -147,9 +171,9 @@ func MultiWrite(m map[name.Reference]Taggable, options ...Option) (rerr error) {
 	}
 	g.Go(func() error {
 		defer close(blobChan)
-		for _, b := range blobs {
+		for h := range blobs {
 			select {
-			case blobChan <- b:
+			case blobChan <- h:
 			case <-ctx.Done():
 				return ctx.Err()
 			}
@@ -160,7 +184,24 @@ func MultiWrite(m map[name.Reference]Taggable, options ...Option) (rerr error) {
 		return err
 	}
 
-	commitMany := func(m map[name.Reference]Taggable) error {
+	// commitOne uploads the manifest of t, unless one of the blobs or
+	// manifests it refers to failed to upload.
+	commitOne := func(t Taggable, ref name.Reference) error {
+		deps, err := dependencies(t)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		for _, d := range deps {
+			if err, ok := failed[d]; ok {
+				mu.Unlock()
+				return fmt.Errorf("uploading %s: %w", d, err)
+			}
+		}
+		mu.Unlock()
+		return w.commitManifest(t, ref)
+	}
+	commitMany := func(m map[name.Reference]Taggable, requested bool) error {
 		// With all of the constituent elements uploaded, upload the manifests
 		// to commit the images and indexes, and collect any errors.
 		type task struct {
@@ -168,40 +209,138 @@ func MultiWrite(m map[name.Reference]Taggable, options ...Option) (rerr error) {
 			ref name.Reference
 		}
 		taskChan := make(chan task, 2*o.jobs)
+		g, ctx := errgroup.WithContext(o.context)
 		for i := 0; i < o.jobs; i++ {
 			// Start N workers consuming tasks to upload manifests.
 			g.Go(func() error {
 				for t := range taskChan {
-					if err := w.commitManifest(t.i, t.ref); err != nil {
+					err := commitOne(t.i, t.ref)
+					if err == nil {
+						continue
+					}
+					if isFatal(err) {
 						return err
 					}
+					d, derr := partial.Digest(t.i)
+					if derr != nil {
+						return derr
+					}
+					mu.Lock()
+					failed[d] = err
+					if requested {
+						errs[t.ref] = err
+					}
+					mu.Unlock()
 				}
 				return nil
 			})
 		}
-		go func() {
+		g.Go(func() error {
+			defer close(taskChan)
 			for ref, i := range m {
-				taskChan <- task{i, ref}
+				select {
+				case taskChan <- task{i, ref}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
 			}
-			close(taskChan)
-		}()
+			return nil
+		})
 		return g.Wait()
 	}
 	// Push originally requested image manifests. These have no
 	// dependencies.
-	if err := commitMany(images); err != nil {
+	if err := commitMany(images, true); err != nil {
 		return err
 	}
 	// Push new manifests from lowest levels up.
 	for i := len(newManifests) - 1; i >= 0; i-- {
-		if err := commitMany(newManifests[i]); err != nil {
+		if err := commitMany(newManifests[i], false); err != nil {
 			return err
 		}
 	}
 	// Push originally requested index manifests, which might depend on
 	// newly discovered manifests.
+	if err := commitMany(indexes, true); err != nil {
+		return err
+	}
+
+	if len(errs) != 0 {
+		return &MultiWriteError{Errors: errs}
+	}
+	return nil
+}
+
+// MultiWriteError is returned by MultiWrite when some of the refs couldn't be
+// written. The other refs were written successfully.
+type MultiWriteError struct {
+	// Errors holds the error for each ref that wasn't written.
+	Errors map[name.Reference]error
+}
+
+// Error implements error.
+func (e *MultiWriteError) Error() string {
+	refs := make([]string, 0, len(e.Errors))
+	msgs := make(map[string]string, len(e.Errors))
+	for ref, err := range e.Errors {
+		refs = append(refs, ref.String())
+		msgs[ref.String()] = err.Error()
+	}
+	sort.Strings(refs)
+	for i, ref := range refs {
+		refs[i] = fmt.Sprintf("%s: %s", ref, msgs[ref])
+	}
+	return fmt.Sprintf("failed to write %d of the refs: %s", len(refs), strings.Join(refs, "; "))
+}
 
-	return commitMany(indexes)
+// isFatal returns whether err means that writing any other ref would fail,
+// too, i.e. we aren't authorized to push to the repository or the context was
+// cancelled.
+func isFatal(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var terr *transport.Error
+	if !errors.As(err, &terr) {
+		return false
+	}
+	if terr.StatusCode == http.StatusUnauthorized || terr.StatusCode == http.StatusForbidden {
+		return true
+	}
+	for _, d := range terr.Errors {
+		if d.Code == transport.UnauthorizedErrorCode || d.Code == transport.DeniedErrorCode {
+			return true
+		}
+	}
+	return false
+}
+
+// dependencies returns the digests of the blobs and manifests referred to by
+// the manifest of t.
+func dependencies(t Taggable) ([]v1.Hash, error) {
+	if img, ok := t.(v1.Image); ok {
+		m, err := img.Manifest()
+		if err != nil {
+			return nil, err
+		}
+		deps := []v1.Hash{m.Config.Digest}
+		for _, desc := range m.Layers {
+			deps = append(deps, desc.Digest)
+		}
+		return deps, nil
+	}
+	if idx, ok := t.(v1.ImageIndex); ok {
+		im, err := idx.IndexManifest()
+		if err != nil {
+			return nil, err
+		}
+		deps := []v1.Hash{}
+		for _, desc := range im.Manifests {
+			deps = append(deps, desc.Digest)
+		}
+		return deps, nil
+	}
+	return nil, fmt.Errorf("pushable resource was not Image or ImageIndex: %T", t)
 }
 
 // addIndexBlobs adds blobs to the set of blobs we intend to upload, and
@@ -278,7 +417,7 @@ func addLayerBlob(l v1.Layer, blobs map[v1.Hash]v1.Layer, allowNondistributableA
 }
 
 func addImageBlobs(img v1.Image, blobs map[v1.Hash]v1.Layer, allowNondistributableArtifacts bool) error {
-	ls, err := img.Layers()
+	ls, err := imageBlobs(img)
 	if err != nil {
 		return err
 	}
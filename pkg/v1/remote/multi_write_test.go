@@ -15,12 +15,14 @@
 package remote
 
 import (
+	"errors"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/google/go-containerregistry/pkg/name"
@@ -28,6 +30,7 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
 )
@@ -110,6 +113,113 @@ func TestMultiWrite(t *testing.T) {
 	}
 }
 
+func TestMultiWrite_PartialFailure(t *testing.T) {
+	img1, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal("random.Image:", err)
+	}
+	bad, err := random.Layer(1024, types.DockerLayer)
+	if err != nil {
+		t.Fatal("random.Layer:", err)
+	}
+	img2, err := mutate.AppendLayers(img1, bad)
+	if err != nil {
+		t.Fatal("mutate.AppendLayers:", err)
+	}
+	badDigest, err := bad.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img1})
+	broken := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img2})
+
+	// Reject the upload of the bad layer.
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("digest") == badDigest.String() {
+			http.Error(w, "bad layer", http.StatusBadRequest)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag1, tag2 := mustNewTag(t, u.Host+"/repo:tag1"), mustNewTag(t, u.Host+"/repo:tag2")
+	tag3, tag4 := mustNewTag(t, u.Host+"/repo:tag3"), mustNewTag(t, u.Host+"/repo:tag4")
+	err = MultiWrite(map[name.Reference]Taggable{
+		tag1: img1,
+		tag2: img2,
+		tag3: good,
+		tag4: broken,
+	})
+	var merr *MultiWriteError
+	if !errors.As(err, &merr) {
+		t.Fatalf("MultiWrite() = %v, want *MultiWriteError", err)
+	}
+	if len(merr.Errors) != 2 || merr.Errors[tag2] == nil || merr.Errors[tag4] == nil {
+		t.Errorf("MultiWrite() = %v, want errors for %s and %s", err, tag2, tag4)
+	}
+
+	if got, err := Image(tag1); err != nil {
+		t.Errorf("Image(%s) = %v", tag1, err)
+	} else if err := validate.Image(got); err != nil {
+		t.Error("Validate() =", err)
+	}
+	if got, err := Index(tag3); err != nil {
+		t.Errorf("Index(%s) = %v", tag3, err)
+	} else if err := validate.Index(got); err != nil {
+		t.Error("Validate() =", err)
+	}
+	for _, tag := range []name.Tag{tag2, tag4} {
+		if _, err := Head(tag); err == nil {
+			t.Errorf("Head(%s) = nil, want error", tag)
+		}
+	}
+}
+
+func TestMultiWrite_Unauthorized(t *testing.T) {
+	img1, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal("random.Image:", err)
+	}
+	img2, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal("random.Image:", err)
+	}
+
+	reg := registry.New()
+	var writes int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost || r.Method == http.MethodPut {
+			atomic.AddInt32(&writes, 1)
+			http.Error(w, "denied", http.StatusForbidden)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = MultiWrite(map[name.Reference]Taggable{
+		mustNewTag(t, u.Host+"/repo:tag1"): img1,
+		mustNewTag(t, u.Host+"/repo:tag2"): img2,
+	}, WithJobs(1))
+	var terr *transport.Error
+	if !errors.As(err, &terr) || terr.StatusCode != http.StatusForbidden {
+		t.Fatalf("MultiWrite() = %v, want %d", err, http.StatusForbidden)
+	}
+	if writes != 1 {
+		t.Errorf("MultiWrite() attempted %d writes after the first was denied, want 0", writes-1)
+	}
+}
+
 func TestMultiWriteWithNondistributableLayer(t *testing.T) {
 	// Create a random image.
 	img1, err := random.Image(1024, 2)
@@ -16,13 +16,22 @@ package remote
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"time"
 
+	"github.com/google/go-containerregistry/internal/retry"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/logs"
+	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"golang.org/x/time/rate"
 )
 
 // Option is a functional option for remote operations.
@@ -32,12 +41,38 @@ type options struct {
 	auth                           authn.Authenticator
 	keychain                       authn.Keychain
 	transport                      http.RoundTripper
+	customTransport                bool
+	tlsConfig                      *tls.Config
 	platform                       v1.Platform
 	context                        context.Context
 	jobs                           int
 	userAgent                      string
 	allowNondistributableArtifacts bool
 	updates                        chan<- v1.Update
+	chunkSize                      int64
+	filter                         map[string]string
+	layerConcurrency               int
+	layerDir                       string
+	pageSize                       int
+	warningHandler                 func(string)
+	tracer                         func(transport.RequestTrace)
+	tokenCache                     *transport.TokenCache
+	scopes                         []string
+	tokenMethod                    string
+	diffID                         *v1.Hash
+	verifyDigests                  bool
+	strictContentType              bool
+	mirrors                        []name.Registry
+	mountFrom                      []name.Repository
+	platformFilter                 []v1.Platform
+	retryOptions                   []transport.Option
+	rateLimiter                    *rate.Limiter
+	hostRateLimiters               map[string]*rate.Limiter
+	headers                        http.Header
+	childResults                   func(ChildResult)
+	manifestAccept                 []types.MediaType
+	digestFallback                 bool
+	limits                         limits
 }
 
 var defaultPlatform = v1.Platform{
@@ -47,6 +82,29 @@ var defaultPlatform = v1.Platform{
 
 const defaultJobs = 4
 
+// DefaultTransport is a transport for remote operations, e.g. with
+// WithTransport(remote.DefaultTransport). It's like http.DefaultTransport, but
+// keeps more idle connections to each host, since we make lots of requests,
+// often in parallel, to the few hosts of a registry.
+//
+// All wrappers that remote operations add, e.g. for auth and retries, share
+// the transport they are given, so passing the same transport to every call
+// reuses its connections, saving TCP and TLS handshakes. To customize it, e.g.
+// the TLS config, Clone it once, not for every call.
+var DefaultTransport http.RoundTripper = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	ForceAttemptHTTP2:     true,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   32,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
 func makeOptions(target authn.Resource, opts ...Option) (*options, error) {
 	o := &options{
 		auth:      authn.Anonymous,
@@ -62,6 +120,26 @@ func makeOptions(target authn.Resource, opts ...Option) (*options, error) {
 		}
 	}
 
+	if o.tlsConfig != nil {
+		if o.customTransport {
+			return nil, errors.New("TLS options cannot be combined with WithTransport")
+		}
+		t, ok := http.DefaultTransport.(*http.Transport)
+		if !ok {
+			return nil, fmt.Errorf("TLS options need http.DefaultTransport to be an *http.Transport, got %T", http.DefaultTransport)
+		}
+		t = t.Clone()
+		t.TLSClientConfig = o.tlsConfig
+		o.transport = t
+	}
+
+	if o.tokenCache != nil {
+		o.context = transport.NewContextWithTokenCache(o.context, o.tokenCache)
+	}
+	if o.tokenMethod != "" {
+		o.context = transport.NewContextWithTokenMethod(o.context, o.tokenMethod)
+	}
+
 	if o.keychain != nil {
 		auth, err := o.keychain.Resolve(target)
 		if err != nil {
@@ -77,8 +155,28 @@ func makeOptions(target authn.Resource, opts ...Option) (*options, error) {
 		o.transport = transport.NewLogger(o.transport)
 	}
 
+	// Surface warnings from every response, including retried ones.
+	if o.warningHandler != nil {
+		o.transport = transport.NewWarningHandler(o.transport, o.warningHandler)
+	}
+
+	// Trace every attempt, including retried ones and token exchanges.
+	if o.tracer != nil {
+		o.transport = transport.NewTracer(o.transport, o.tracer)
+	}
+
+	// Wait on the rate limiters for every attempt, including retried ones.
+	if o.rateLimiter != nil || o.hostRateLimiters != nil {
+		o.transport = transport.NewRateLimiter(o.transport, o.rateLimiter, o.hostRateLimiters)
+	}
+
 	// Wrap the transport in something that can retry network flakes.
-	o.transport = transport.NewRetry(o.transport)
+	o.transport = transport.NewRetry(o.transport, o.retryOptions...)
+
+	// Set the headers on every request, including redirected ones.
+	if len(o.headers) != 0 {
+		o.transport = transport.NewRequestHeaders(o.transport, target.RegistryStr(), o.headers)
+	}
 
 	// Wrap this last to prevent transport.New from double-wrapping.
 	if o.userAgent != "" {
@@ -89,12 +187,73 @@ func makeOptions(target authn.Resource, opts ...Option) (*options, error) {
 }
 
 // WithTransport is a functional option for overriding the default transport
-// for remote operations.
+// for remote operations. Pass the same transport to every call to reuse its
+// connections.
 //
-// The default transport its http.DefaultTransport.
+// The default transport is http.DefaultTransport.
 func WithTransport(t http.RoundTripper) Option {
 	return func(o *options) error {
 		o.transport = t
+		o.customTransport = true
+		return nil
+	}
+}
+
+// tls returns the TLS config that the TLS options modify, which the transport
+// is built with in makeOptions.
+func (o *options) tls() *tls.Config {
+	if o.tlsConfig == nil {
+		o.tlsConfig = &tls.Config{}
+	}
+	return o.tlsConfig
+}
+
+// WithCABundle is a functional option for trusting the PEM-encoded
+// certificates in caBundle, in addition to the system's, when connecting to
+// registries over TLS, e.g. those with certificates signed by an internal CA.
+// Calling it multiple times trusts all the bundles.
+//
+// The TLS options, i.e. WithCABundle, WithClientCert and
+// WithInsecureSkipTLSVerify, apply to a clone of http.DefaultTransport made for
+// each call, and are an error with WithTransport. To reuse connections
+// between calls, set TLSClientConfig on a transport and pass that to
+// WithTransport instead.
+func WithCABundle(caBundle []byte) Option {
+	return func(o *options) error {
+		c := o.tls()
+		if c.RootCAs == nil {
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			c.RootCAs = pool
+		}
+		if !c.RootCAs.AppendCertsFromPEM(caBundle) {
+			return errors.New("CA bundle contains no PEM-encoded certificates")
+		}
+		return nil
+	}
+}
+
+// WithClientCert is a functional option for presenting cert to registries
+// that require TLS client authentication (mTLS). Calling it multiple times
+// offers all the certificates, of which the first one that the registry
+// accepts is used. See WithCABundle for how it combines with WithTransport.
+func WithClientCert(cert tls.Certificate) Option {
+	return func(o *options) error {
+		c := o.tls()
+		c.Certificates = append(c.Certificates, cert)
+		return nil
+	}
+}
+
+// WithInsecureSkipTLSVerify is a functional option for not verifying the
+// certificates of registries, if skip is true. This is insecure and should
+// only be used for testing; prefer WithCABundle. See WithCABundle for how it
+// combines with WithTransport.
+func WithInsecureSkipTLSVerify(skip bool) Option {
+	return func(o *options) error {
+		o.tls().InsecureSkipVerify = skip
 		return nil
 	}
 }
@@ -114,10 +273,13 @@ func WithAuth(auth authn.Authenticator) Option {
 // authenticator for remote operations, using an authn.Keychain to find
 // credentials.
 //
+// If the registry rejects the credentials, e.g. because they expired, they
+// are resolved again using keys, once, before failing.
+//
 // The default authenticator is authn.Anonymous.
 func WithAuthFromKeychain(keys authn.Keychain) Option {
 	return func(o *options) error {
-		o.keychain = keys
+		o.keychain = authn.RefreshingKeychain(keys)
 		return nil
 	}
 }
@@ -173,18 +335,208 @@ func WithUserAgent(ua string) Option {
 	}
 }
 
+// WithRequestHeaders adds the given headers, e.g. X-Request-Id, to any HTTP
+// requests that don't set them already. Calling it multiple times adds more
+// headers.
+//
+// Headers carrying credentials, like Authorization, are not sent to the hosts
+// that the registry redirects us to.
+func WithRequestHeaders(h http.Header) Option {
+	return func(o *options) error {
+		if o.headers == nil {
+			o.headers = http.Header{}
+		}
+		for k, vs := range h {
+			for _, v := range vs {
+				o.headers.Add(k, v)
+			}
+		}
+		return nil
+	}
+}
+
 // WithNondistributable includes non-distributable (foreign) layers
 // when writing images, see:
 // https://github.com/opencontainers/image-spec/blob/master/layer.md#non-distributable-layers
 //
-// The default behaviour is to skip these layers
+// The default behaviour is to skip these layers. The manifests are pushed as
+// they are, so the layers keep their foreign media types and urls. To have
+// clients fetch them from the registry instead, e.g. when mirroring Windows
+// images into a private registry, turn them into regular layers first:
+//
+//	img, err := mutate.Distributable(img)
+//	if err != nil {
+//		return err
+//	}
+//	err = remote.Write(ref, img, remote.WithNondistributable)
 func WithNondistributable(o *options) error {
 	o.allowNondistributableArtifacts = true
 	return nil
 }
 
+// WithDigestVerification verifies that manifests fetched by tag hash to the
+// digest in the registry's Docker-Content-Digest response header, if present.
+//
+// Manifests fetched by digest, and all blobs, are always verified against the
+// requested digest. This is off by default for tags because many registries
+// don't populate the header correctly.
+func WithDigestVerification(o *options) error {
+	o.verifyDigests = true
+	return nil
+}
+
+// WithStrictContentType makes manifests' Content-Type headers authoritative:
+// fetching a manifest fails if the registry's Content-Type doesn't match the
+// mediaType and schemaVersion of the manifest itself, or says nothing about
+// it, like application/octet-stream, and pushing one fails if its media type
+// doesn't match its contents.
+//
+// By default, the manifest's contents win over a mismatched or generic
+// Content-Type, since some registries, e.g. static file servers, mislabel
+// what they serve. Contents without a mediaType field can't tell OCI and
+// Docker types apart, so the Content-Type decides between those.
+func WithStrictContentType(o *options) error {
+	o.strictContentType = true
+	return nil
+}
+
+// Backoff describes how requests are retried, see WithRetryBackoff.
+type Backoff = retry.Backoff
+
+// WithRetryBackoff is a functional option for overriding the backoff with
+// which requests are retried after temporary network errors and responses
+// with the status codes given to WithRetryStatusCodes. Steps is the maximum
+// number of attempts, and the delay between attempts grows from Duration by
+// Factor, plus up to Jitter times the delay, but never beyond Cap, if set.
+//
+// The default backoff makes five attempts, 0.1s, 0.3s, 0.9s and 2.7s apart.
+func WithRetryBackoff(backoff Backoff) Option {
+	return func(o *options) error {
+		if backoff.Steps < 1 {
+			return errors.New("retry backoff must have at least one step")
+		}
+		o.retryOptions = append(o.retryOptions, transport.WithRetryBackoff(backoff))
+		return nil
+	}
+}
+
+// WithRetryStatusCodes is a functional option for retrying requests whose
+// responses have one of the given status codes, e.g.
+// http.StatusTooManyRequests or http.StatusServiceUnavailable, using the
+// backoff set by WithRetryBackoff. If such a response has a Retry-After
+// header, the next attempt is delayed by at least that long.
+//
+// By default, only network errors are retried, not responses.
+func WithRetryStatusCodes(codes []int) Option {
+	return func(o *options) error {
+		o.retryOptions = append(o.retryOptions, transport.WithRetryStatusCodes(codes...))
+		return nil
+	}
+}
+
+// WithRateLimiter is a functional option for waiting on the given limiter
+// before each HTTP request, including token exchanges and retries, until the
+// context passed to WithContext is done.
+//
+// Share the limiter between calls to limit the overall rate of requests.
+func WithRateLimiter(limiter *rate.Limiter) Option {
+	return func(o *options) error {
+		o.rateLimiter = limiter
+		return nil
+	}
+}
+
+// WithHostRateLimiters is a functional option for limiting the rate of
+// requests to each host separately, like WithRateLimiter, so that a
+// rate-limited registry doesn't slow down requests to others. The keys are
+// hosts, including the port if any, e.g. "index.docker.io" or
+// "localhost:5000", which may differ from the registry for token exchanges.
+//
+// Requests to other hosts wait on the limiter passed to WithRateLimiter, if
+// any, which is not consulted for hosts in limiters.
+func WithHostRateLimiters(limiters map[string]*rate.Limiter) Option {
+	return func(o *options) error {
+		o.hostRateLimiters = limiters
+		return nil
+	}
+}
+
+// WithMirrors is a functional option for pulling manifests and blobs from a
+// list of mirror registries, which are tried in order before the canonical
+// registry of the reference. If a mirror can't be reached or responds with a
+// 404, the next mirror (and eventually the canonical registry) is tried.
+//
+// Mirrors are only used for pulling; pushes always go to the canonical
+// registry. Mirrors are accessed anonymously, unless WithAuthFromKeychain is
+// used, in which case the keychain is consulted for each mirror.
+func WithMirrors(mirrors []name.Registry) Option {
+	return func(o *options) error {
+		o.mirrors = mirrors
+		return nil
+	}
+}
+
+// WithMountFrom is a functional option for mounting blobs from the given
+// repositories when writing, rather than uploading them. For each blob that
+// doesn't already exist, each repository on the same registry as the target
+// is tried in order, before falling back to a regular upload.
+//
+// Blobs that were mounted are reported via the Mounted field of the updates
+// sent to WithProgress.
+func WithMountFrom(repos []name.Repository) Option {
+	return func(o *options) error {
+		o.mountFrom = repos
+		return nil
+	}
+}
+
+// WithDigestFallback is a functional option for Delete to delete the manifest
+// that a name.Tag points to, if the registry refuses to delete the tag itself.
+// This also deletes every other tag that points to the manifest.
+func WithDigestFallback(o *options) error {
+	o.digestFallback = true
+	return nil
+}
+
+// WithManifestAccept is a functional option for setting the order of the
+// media types in the Accept header of manifest requests, most preferred first,
+// for registries that return the first format they have, e.g. to prefer
+// types.OCIImageIndex over types.DockerManifestList.
+//
+// Each request still only accepts the media types it can handle: those that
+// aren't in mediaTypes are dropped, e.g. passing only
+// types.DockerManifestSchema2 forces a schema 2 response from Get. If none of
+// mediaTypes can be handled, the default Accept header is sent.
+func WithManifestAccept(mediaTypes []types.MediaType) Option {
+	return func(o *options) error {
+		o.manifestAccept = mediaTypes
+		return nil
+	}
+}
+
+// WithPlatformFilter is a functional option for WriteIndex that drops the
+// child manifests of the index that don't match any of platforms, and writes
+// the index with the remaining ones. The filtered index keeps the media type
+// and annotations of the original. Platforms match as for WithPlatform, so
+// e.g. linux/arm64 matches children with any variant.
+//
+// Only the top-level index is filtered, and children without a platform are
+// dropped. If none of the children match, WriteIndex returns an error.
+func WithPlatformFilter(platforms []v1.Platform) Option {
+	return func(o *options) error {
+		if len(platforms) == 0 {
+			return errors.New("platform filter must contain at least one platform")
+		}
+		o.platformFilter = platforms
+		return nil
+	}
+}
+
 // WithProgress takes a channel that will receive progress updates as bytes are written.
 //
+// The size of a stream.Layer isn't known until it has been written, so the
+// Total of the updates grows as streaming layers are uploaded.
+//
 // Sending updates to an unbuffered channel will block writes, so callers
 // should provide a buffered channel to avoid potential deadlocks.
 func WithProgress(updates chan<- v1.Update) Option {
@@ -193,3 +545,236 @@ func WithProgress(updates chan<- v1.Update) Option {
 		return nil
 	}
 }
+
+// WithChildResults sets a function that WriteIndex calls with the outcome of
+// pushing each child of the index, including those of nested indexes, e.g.
+// to report which children failed.
+func WithChildResults(f func(ChildResult)) Option {
+	return func(o *options) error {
+		o.childResults = f
+		return nil
+	}
+}
+
+// WithChunkSize is a functional option for uploading blobs larger than n bytes
+// using the registry's chunked upload protocol, sending at most n bytes per
+// PATCH request. If a chunk fails to upload, the retry resumes from the last
+// offset acknowledged by the registry rather than restarting the blob.
+//
+// Registries that don't advertise support for chunked uploads (by omitting
+// the Range header when an upload is initiated) fall back to a monolithic
+// upload.
+//
+// The default behaviour is to upload each blob in a single request.
+func WithChunkSize(n int64) Option {
+	return func(o *options) error {
+		if n <= 0 {
+			return errors.New("chunk size must be greater than zero")
+		}
+		o.chunkSize = n
+		return nil
+	}
+}
+
+// WithFilter sets the filter querystring for HTTP operations that support
+// filtering, currently only Referrers, which supports filtering by
+// "artifactType". Registries that don't apply the filter themselves will have
+// it applied to their response instead.
+func WithFilter(key string, value string) Option {
+	return func(o *options) error {
+		if o.filter == nil {
+			o.filter = map[string]string{}
+		}
+		o.filter[key] = value
+		return nil
+	}
+}
+
+// WithLayerConcurrency is a functional option for eagerly fetching all of the
+// layers of an image returned by Image, using at most n concurrent downloads.
+// The layers are stored in dir, see cache.NewFilesystemCache, which the
+// returned image reads from instead of the registry. The caller owns dir, and
+// removes it once it's done with the image, e.g.:
+//
+//	dir, err := ioutil.TempDir("", "layers")
+//	if err != nil {
+//		return err
+//	}
+//	defer os.RemoveAll(dir)
+//	img, err := remote.Image(ref, remote.WithLayerConcurrency(8, dir))
+//
+// Fetching respects the context passed to WithContext. The first error
+// cancels any other downloads in flight, and is returned from Image.
+//
+// The default behaviour is to fetch layers lazily, as they are read.
+func WithLayerConcurrency(n int, dir string) Option {
+	return func(o *options) error {
+		if n <= 0 {
+			return errors.New("layer concurrency must be greater than zero")
+		}
+		if dir == "" {
+			return errors.New("layer concurrency requires a directory")
+		}
+		o.layerConcurrency = n
+		o.layerDir = dir
+		return nil
+	}
+}
+
+// WithPageSize sets the number of results to request per page (the "n" query
+// parameter) for paginated APIs, i.e. List, Catalog, NewLister and
+// NewCatalogger. Registries may return fewer results per page than requested.
+func WithPageSize(size int) Option {
+	return func(o *options) error {
+		if size <= 0 {
+			return errors.New("page size must be greater than zero")
+		}
+		o.pageSize = size
+		return nil
+	}
+}
+
+// WithWarningHandler sets a function to be called with the value of each
+// Warning header (e.g. deprecation notices) that the registry sends in
+// response to any request made by a remote operation.
+//
+// The default behaviour is to ignore warnings.
+func WithWarningHandler(handler func(string)) Option {
+	return func(o *options) error {
+		o.warningHandler = handler
+		return nil
+	}
+}
+
+// WithTracer sets a function to be called with a transport.RequestTrace for
+// every HTTP request made by a remote operation, including retried requests and
+// those made to exchange credentials for a token. Traces never include
+// credentials, see transport.NewTracer.
+//
+// The function may be called concurrently.
+func WithTracer(tracer func(transport.RequestTrace)) Option {
+	return func(o *options) error {
+		o.tracer = tracer
+		return nil
+	}
+}
+
+// WithTokenCache is a functional option for sharing the bearer tokens that
+// remote operations obtain, see transport.TokenCache. Pass the same cache to
+// the operations that make up a larger one, like reading an image and writing
+// it elsewhere, so that they exchange credentials for tokens less often.
+func WithTokenCache(cache *transport.TokenCache) Option {
+	return func(o *options) error {
+		o.tokenCache = cache
+		return nil
+	}
+}
+
+// WithScopes is a functional option for requesting additional scopes, like
+// "repository:foo:push,pull", along with those that remote operations need
+// themselves. Together with WithTokenCache, this lets one token cover several
+// operations against the same registry, e.g. the read and the write of a copy
+// within a registry.
+//
+// If the registry rejects the additional scopes, they are dropped.
+func WithScopes(scopes ...string) Option {
+	return func(o *options) error {
+		o.scopes = append(o.scopes, scopes...)
+		return nil
+	}
+}
+
+// WithTokenMethod is a functional option for forcing the HTTP method used to
+// exchange credentials for bearer tokens: http.MethodGet for the Docker
+// registry token endpoint, or http.MethodPost for the OAuth2 one.
+//
+// By default, the GET form is tried first, or the POST form if there is an
+// identity token, and the other one if the token server doesn't implement it.
+// This is for registries that respond confusingly to the wrong one.
+func WithTokenMethod(method string) Option {
+	return func(o *options) error {
+		if method != http.MethodGet && method != http.MethodPost {
+			return fmt.Errorf("token method must be %s or %s, got %q", http.MethodGet, http.MethodPost, method)
+		}
+		o.tokenMethod = method
+		return nil
+	}
+}
+
+// newTransport returns a transport that authenticates to reg for the given
+// scopes and those requested with WithScopes.
+func (o *options) newTransport(reg name.Registry, scopes []string) (http.RoundTripper, error) {
+	if len(o.scopes) != 0 {
+		all := append([]string{}, scopes...)
+		seen := map[string]bool{}
+		for _, scope := range scopes {
+			seen[scope] = true
+		}
+		for _, scope := range o.scopes {
+			if !seen[scope] {
+				seen[scope] = true
+				all = append(all, scope)
+			}
+		}
+		tr, err := transport.NewWithContext(o.context, reg, o.auth, o.transport, all)
+		var terr *transport.Error
+		if !errors.As(err, &terr) {
+			return tr, err
+		}
+		// Some token services reject requests for scopes that the credentials
+		// don't grant, so try again with only the scopes we need.
+		logs.Debug.Printf("Dropping scopes %v for %s: %v", o.scopes, reg, err)
+	}
+	return transport.NewWithContext(o.context, reg, o.auth, o.transport, scopes)
+}
+
+// WithDiffID sets the DiffID of the layer returned by Layer, so that it
+// doesn't have to be downloaded to compute it, e.g. to append it to an image
+// with mutate.AppendLayers. It is trusted rather than verified.
+//
+// Other functions ignore it.
+func WithDiffID(diffID v1.Hash) Option {
+	return func(o *options) error {
+		o.diffID = &diffID
+		return nil
+	}
+}
+
+// WithMaxManifestSize rejects manifests larger than size bytes, without reading
+// more of them than that, to protect against untrusted registries.
+//
+// Errors caused by this and the other limits wrap ErrLimitExceeded.
+func WithMaxManifestSize(size int64) Option {
+	return func(o *options) error {
+		if size <= 0 {
+			return errors.New("max manifest size must be greater than zero")
+		}
+		o.limits.maxManifestSize = size
+		return nil
+	}
+}
+
+// WithMaxLayers rejects image manifests with more than n layers.
+func WithMaxLayers(n int) Option {
+	return func(o *options) error {
+		if n <= 0 {
+			return errors.New("max layers must be greater than zero")
+		}
+		o.limits.maxLayers = n
+		return nil
+	}
+}
+
+// WithMaxImageSize rejects image manifests whose config and layers add up to
+// more than size bytes, and fails reading the layers of an image once more
+// than size bytes have been decompressed from them in total, so that a small
+// compressed layer can't expand into an arbitrarily large one.
+func WithMaxImageSize(size int64) Option {
+	return func(o *options) error {
+		if size <= 0 {
+			return errors.New("max image size must be greater than zero")
+		}
+		o.limits.maxImageSize = size
+		return nil
+	}
+}
@@ -0,0 +1,653 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	ihttptest "github.com/google/go-containerregistry/internal/httptest"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"golang.org/x/time/rate"
+)
+
+func TestWithWarningHandler(t *testing.T) {
+	reg := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Warning", fmt.Sprintf(`299 - "%s %s"`, r.Method, r.URL.Path))
+		reg.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(fmt.Sprintf("%s/foo:latest", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu       sync.Mutex
+		warnings []string
+	)
+	opt := WithWarningHandler(func(warning string) {
+		mu.Lock()
+		defer mu.Unlock()
+		warnings = append(warnings, warning)
+	})
+	// expect asserts that a warning was surfaced for the given request.
+	expect := func(want string) {
+		t.Helper()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, w := range warnings {
+			if strings.Contains(w, want) {
+				warnings = nil
+				return
+			}
+		}
+		t.Errorf("no warning for %q in %v", want, warnings)
+		warnings = nil
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(ref, img, opt); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	expect("PUT /v2/foo/manifests/latest")
+
+	if _, err := Image(ref, opt); err != nil {
+		t.Fatalf("Image() = %v", err)
+	}
+	expect("GET /v2/foo/manifests/latest")
+
+	if _, err := List(ref.Context(), opt); err != nil {
+		t.Fatalf("List() = %v", err)
+	}
+	expect("GET /v2/foo/tags/list")
+
+	if err := Delete(ref, opt); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+	expect("DELETE /v2/foo/manifests/latest")
+}
+
+func TestWithTracer(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(fmt.Sprintf("%s/foo:latest", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu     sync.Mutex
+		traces []transport.RequestTrace
+	)
+	opt := WithTracer(func(trace transport.RequestTrace) {
+		mu.Lock()
+		defer mu.Unlock()
+		traces = append(traces, trace)
+	})
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(ref, img, opt); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if _, err := Image(ref, opt); err != nil {
+		t.Fatalf("Image() = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	seen := map[string]bool{}
+	for _, trace := range traces {
+		// The ping tries https first, which fails against this server.
+		if trace.Err != nil {
+			continue
+		}
+		if strings.Contains(trace.URL, "?") {
+			t.Errorf("URL %q has a query", trace.URL)
+		}
+		seen[fmt.Sprintf("%s %s %d", trace.Method, trace.URL, trace.StatusCode)] = true
+	}
+	for _, want := range []string{
+		fmt.Sprintf("GET %s/v2/ 200", s.URL),
+		fmt.Sprintf("PUT %s/v2/foo/manifests/latest 201", s.URL),
+		fmt.Sprintf("GET %s/v2/foo/manifests/latest 200", s.URL),
+	} {
+		if !seen[want] {
+			t.Errorf("no trace for %q in %v", want, seen)
+		}
+	}
+}
+
+func TestWithScopesFallback(t *testing.T) {
+	reg := registry.New()
+	var (
+		mu     sync.Mutex
+		scopes [][]string
+		s      *httptest.Server
+	)
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			got := r.URL.Query()["scope"]
+			mu.Lock()
+			scopes = append(scopes, got)
+			mu.Unlock()
+			for _, scope := range got {
+				if scope == "repository:other:push,pull" {
+					http.Error(w, "denied", http.StatusForbidden)
+					return
+				}
+			}
+			w.Write([]byte(`{"token": "secret"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token"`, s.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(fmt.Sprintf("%s/foo:latest", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	scopes = nil
+	mu.Unlock()
+	cache := transport.NewTokenCache()
+	opts := []Option{WithTokenCache(cache), WithScopes("repository:other:push,pull")}
+	if _, err := Image(ref, opts...); err != nil {
+		t.Fatalf("Image() = %v", err)
+	}
+	// The fallback reuses the token for only the scopes we need.
+	if _, err := Image(ref, opts...); err != nil {
+		t.Fatalf("Image() = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := [][]string{
+		{"repository:foo:pull", "repository:other:push,pull"},
+		{"repository:foo:pull"},
+		{"repository:foo:pull", "repository:other:push,pull"},
+	}
+	if diff := cmp.Diff(want, scopes); diff != "" {
+		t.Errorf("scopes (-want +got): %s", diff)
+	}
+}
+
+func TestWithTokenMethod(t *testing.T) {
+	reg := registry.New()
+	var (
+		mu      sync.Mutex
+		methods []string
+		s       *httptest.Server
+	)
+	// The token server only implements the oauth2 form.
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			mu.Lock()
+			methods = append(methods, r.Method)
+			mu.Unlock()
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Write([]byte(`{"access_token": "secret"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token"`, s.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(fmt.Sprintf("%s/foo:latest", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := WithAuth(&authn.Basic{Username: "user", Password: "pass"})
+
+	for _, tc := range []struct {
+		opts []Option
+		want []string
+	}{
+		{[]Option{auth}, []string{http.MethodGet, http.MethodPost}},
+		{[]Option{auth, WithTokenMethod(http.MethodPost)}, []string{http.MethodPost}},
+	} {
+		mu.Lock()
+		methods = nil
+		mu.Unlock()
+		if _, err := Head(ref, tc.opts...); err == nil {
+			t.Fatal("Head() = nil, wanted not found")
+		} else if terr, ok := err.(*transport.Error); !ok || terr.StatusCode != http.StatusNotFound {
+			t.Fatalf("Head() = %v, wanted not found", err)
+		}
+		mu.Lock()
+		if diff := cmp.Diff(tc.want, methods); diff != "" {
+			t.Errorf("token requests (-want +got): %s", diff)
+		}
+		mu.Unlock()
+	}
+
+	if _, err := Head(ref, WithTokenMethod(http.MethodPut)); err == nil {
+		t.Error("WithTokenMethod(PUT) = nil, wanted error")
+	}
+}
+
+func TestWithDigestVerification(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := img.RawManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mt, err := img.MediaType()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bogusDigest := "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/foo/manifests/latest":
+			w.Header().Set("Content-Type", string(mt))
+			w.Header().Set("Docker-Content-Digest", bogusDigest)
+			w.Write(raw)
+		default:
+			t.Fatalf("Unexpected path: %v", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(fmt.Sprintf("%s/foo:latest", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Get(ref); err != nil {
+		t.Errorf("Get() = %v", err)
+	}
+	_, err = Get(ref, WithDigestVerification)
+	if err == nil {
+		t.Fatal("Get(WithDigestVerification) = nil, wanted error")
+	}
+	if !strings.Contains(err.Error(), bogusDigest) {
+		t.Errorf("Get(WithDigestVerification) = %v, want error mentioning %s", err, bogusDigest)
+	}
+}
+
+func TestWithRetryStatusCodes(t *testing.T) {
+	reg := registry.New()
+	var (
+		mu       sync.Mutex
+		failures int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fail := failures > 0 && strings.Contains(r.URL.Path, "/manifests/")
+		if fail {
+			failures--
+		}
+		mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(fmt.Sprintf("%s/foo:latest", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(ref, img); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+
+	setFailures := func(n int) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures = n
+	}
+
+	setFailures(1)
+	if _, err := Get(ref); err == nil {
+		t.Error("Get() = nil, wanted error without retries")
+	}
+
+	backoff := WithRetryBackoff(Backoff{Duration: time.Millisecond, Factor: 2, Steps: 3})
+	retryCodes := WithRetryStatusCodes([]int{http.StatusServiceUnavailable})
+
+	setFailures(2)
+	if _, err := Get(ref, backoff, retryCodes); err != nil {
+		t.Errorf("Get() = %v", err)
+	}
+
+	setFailures(3)
+	if _, err := Get(ref, backoff, retryCodes); err == nil {
+		t.Error("Get() = nil, wanted error after running out of retries")
+	}
+
+	if _, err := Get(ref, WithRetryBackoff(Backoff{})); err == nil {
+		t.Error("Get(WithRetryBackoff(Backoff{})) = nil, wanted error")
+	}
+}
+
+func TestWithRateLimiter(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(fmt.Sprintf("%s/foo:latest", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(ref, img); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+
+	// head gives up if the rate limit delays it by more than a second.
+	head := func(opt Option) error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err := Head(ref, opt, WithContext(ctx))
+		return err
+	}
+
+	// Allow a single request, which isn't enough to ping the registry and then
+	// fetch the manifest.
+	for _, opt := range []Option{
+		WithRateLimiter(rate.NewLimiter(rate.Every(time.Hour), 1)),
+		WithHostRateLimiters(map[string]*rate.Limiter{
+			u.Host: rate.NewLimiter(rate.Every(time.Hour), 1),
+		}),
+	} {
+		if err := head(opt); err == nil {
+			t.Error("Head() = nil, wanted rate limit to exceed the context deadline")
+		}
+	}
+
+	// A limit that allows bursts of requests doesn't get in the way.
+	opt := WithRateLimiter(rate.NewLimiter(rate.Every(time.Millisecond), 10))
+	for i := 0; i < 3; i++ {
+		if err := head(opt); err != nil {
+			t.Errorf("Head() = %v", err)
+		}
+	}
+
+	// Limiters for other hosts don't apply.
+	opt = WithHostRateLimiters(map[string]*rate.Limiter{
+		"example.com": rate.NewLimiter(rate.Every(time.Hour), 0),
+	})
+	for i := 0; i < 3; i++ {
+		if err := head(opt); err != nil {
+			t.Errorf("Head() = %v", err)
+		}
+	}
+}
+
+func TestWithRequestHeaders(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	reg := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, r.Header.Get("X-Request-Id"))
+		mu.Unlock()
+		reg.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(fmt.Sprintf("%s/foo:latest", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opt := WithRequestHeaders(http.Header{"X-Request-Id": []string{"abc"}})
+	if err := Write(ref, img, opt); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if _, err := Head(ref, opt); err != nil {
+		t.Fatalf("Head() = %v", err)
+	}
+
+	if len(got) == 0 {
+		t.Fatal("no requests made")
+	}
+	for i, id := range got {
+		if id != "abc" {
+			t.Errorf("request %d: X-Request-Id = %q, want %q", i, id, "abc")
+		}
+	}
+}
+
+// BenchmarkTransportReuse pulls the blobs of an image over TLS, counting the
+// connections, and thereby handshakes, made per pull, with one transport for
+// all calls vs. a new one for each call.
+func BenchmarkTransportReuse(b *testing.B) {
+	s, err := ihttptest.NewTLSServer("registry.example.com", registry.New())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer s.Close()
+	base := s.Client().Transport.(*http.Transport)
+
+	var dials int64
+	newTransport := func() *http.Transport {
+		t := DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = base.TLSClientConfig
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			atomic.AddInt64(&dials, 1)
+			return base.DialContext(ctx, network, addr)
+		}
+		return t
+	}
+
+	ref, err := name.ParseReference("registry.example.com/repo:latest")
+	if err != nil {
+		b.Fatal(err)
+	}
+	img, err := random.Image(1024, 10)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := Write(ref, img, WithTransport(newTransport())); err != nil {
+		b.Fatal(err)
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		b.Fatal(err)
+	}
+	digests := []v1.Hash{m.Config.Digest}
+	for _, desc := range m.Layers {
+		digests = append(digests, desc.Digest)
+	}
+
+	for _, tc := range []struct {
+		desc   string
+		shared bool
+	}{
+		{"shared", true},
+		{"fresh", false},
+	} {
+		b.Run(tc.desc, func(b *testing.B) {
+			shared := newTransport()
+			defer shared.CloseIdleConnections()
+			atomic.StoreInt64(&dials, 0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, h := range digests {
+					t := shared
+					if !tc.shared {
+						t = newTransport()
+					}
+					l, err := Layer(ref.Context().Digest(h.String()), WithTransport(t))
+					if err != nil {
+						b.Fatal(err)
+					}
+					rc, err := l.Compressed()
+					if err != nil {
+						b.Fatal(err)
+					}
+					io.Copy(ioutil.Discard, rc)
+					rc.Close()
+					if !tc.shared {
+						t.CloseIdleConnections()
+					}
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&dials))/float64(b.N), "handshakes/op")
+		})
+	}
+}
+
+func TestTLSOptions(t *testing.T) {
+	s := httptest.NewUnstartedServer(registry.New())
+	s.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	s.StartTLS()
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(fmt.Sprintf("%s/foo:latest", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The self-signed server certificate doubles as the client certificate.
+	cert := s.TLS.Certificates[0]
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+
+	for _, tc := range []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{{
+		name:    "untrusted",
+		opts:    []Option{WithClientCert(cert)},
+		wantErr: true,
+	}, {
+		name:    "no client cert",
+		opts:    []Option{WithCABundle(ca)},
+		wantErr: true,
+	}, {
+		name: "ca bundle",
+		opts: []Option{WithCABundle(ca), WithClientCert(cert)},
+	}, {
+		name: "skip verify",
+		opts: []Option{WithInsecureSkipTLSVerify(true), WithClientCert(cert)},
+	}, {
+		name:    "with transport",
+		opts:    []Option{WithCABundle(ca), WithClientCert(cert), WithTransport(http.DefaultTransport)},
+		wantErr: true,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Write(ref, img, tc.opts...)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Write() = %v, wantErr %t", err, tc.wantErr)
+			}
+		})
+	}
+
+	if _, err := makeOptions(ref.Context(), WithCABundle([]byte("not pem"))); err == nil {
+		t.Error("WithCABundle(not pem): expected error")
+	}
+}
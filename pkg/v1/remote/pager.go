@@ -0,0 +1,76 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// errNoMorePages is returned when fetching past the last page.
+var errNoMorePages = errors.New("no more pages")
+
+// pager follows the Link headers of paginated registry APIs, one page at a
+// time.
+type pager struct {
+	client http.Client
+	next   *url.URL
+}
+
+// hasNext returns true if there is another page to fetch.
+func (p *pager) hasNext() bool {
+	return p.next != nil
+}
+
+// fetch decodes the next page into v, and advances to the page after it.
+func (p *pager) fetch(ctx context.Context, v interface{}) error {
+	if p.next == nil {
+		return errNoMorePages
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	req, err := http.NewRequest(http.MethodGet, p.next.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := transport.CheckError(resp, http.StatusOK); err != nil {
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return err
+	}
+
+	next, err := getNextPageURL(resp)
+	if err != nil {
+		return err
+	}
+	p.next = next
+	return nil
+}
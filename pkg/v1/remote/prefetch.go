@@ -0,0 +1,120 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"io"
+	"io/ioutil"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/cache"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"golang.org/x/sync/errgroup"
+)
+
+// prefetch downloads all of the (distributable) layers of the image into a
+// filesystem cache in d.layerDir, using at most d.layerConcurrency concurrent
+// requests, and returns an image that serves its layers from that cache.
+func (d *Descriptor) prefetch() (v1.Image, error) {
+	c := cache.NewFilesystemCache(d.layerDir)
+
+	// Fetch the layers with a context that we can cancel on the first error.
+	g, ctx := errgroup.WithContext(d.context)
+	ri := d.remoteImage()
+	ri.fetcher.context = ctx
+	img, err := partial.CompressedToImage(ri)
+	if err != nil {
+		return nil, err
+	}
+	ls, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	layerChan := make(chan v1.Layer, 2*d.layerConcurrency)
+	for i := 0; i < d.layerConcurrency; i++ {
+		// Start N workers consuming layers to fetch.
+		g.Go(func() error {
+			for l := range layerChan {
+				if err := fetchInto(c, l); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	g.Go(func() error {
+		defer close(layerChan)
+		fetched := map[v1.Hash]bool{}
+		for _, l := range ls {
+			// Foreign layers are only fetched if somebody asks for them.
+			mt, err := l.MediaType()
+			if err != nil {
+				return err
+			}
+			if !mt.IsDistributable() {
+				continue
+			}
+
+			h, err := l.Digest()
+			if err != nil {
+				return err
+			}
+			if fetched[h] {
+				continue
+			}
+			fetched[h] = true
+
+			select {
+			case layerChan <- l:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// Use the original context for anything that isn't cached.
+	imgCore, err := partial.CompressedToImage(d.remoteImage())
+	if err != nil {
+		return nil, err
+	}
+	return &mountableImage{
+		Image:     cache.Image(imgCore, c),
+		Reference: d.Ref,
+		budget:    newBudget(d.limits.maxImageSize),
+	}, nil
+}
+
+// fetchInto populates the cache with the compressed contents of l.
+func fetchInto(c cache.Cache, l v1.Layer) error {
+	cl, err := c.Put(l)
+	if err != nil {
+		return err
+	}
+	rc, err := cl.Compressed()
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+		rc.Close()
+		return err
+	}
+	return rc.Close()
+}
@@ -0,0 +1,248 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+// blobCounter tracks blob GETs that pass through it to the registry.
+type blobCounter struct {
+	handler http.Handler
+	latency time.Duration
+	fail    string
+
+	sync.Mutex
+	count, inflight, max int
+}
+
+func (b *blobCounter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || !strings.Contains(r.URL.Path, "/blobs/sha256:") {
+		b.handler.ServeHTTP(w, r)
+		return
+	}
+	b.Lock()
+	b.count++
+	b.inflight++
+	if b.inflight > b.max {
+		b.max = b.inflight
+	}
+	fail := b.fail != "" && strings.HasSuffix(r.URL.Path, b.fail)
+	b.Unlock()
+	defer func() {
+		b.Lock()
+		b.inflight--
+		b.Unlock()
+	}()
+
+	time.Sleep(b.latency)
+	if fail {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	b.handler.ServeHTTP(w, r)
+}
+
+func (b *blobCounter) counts() (count, max int) {
+	b.Lock()
+	defer b.Unlock()
+	return b.count, b.max
+}
+
+// layerDir returns a directory for WithLayerConcurrency, which is removed
+// after the test.
+func layerDir(t testing.TB) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "prefetch-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func setupPrefetch(t testing.TB, layers int64, bc *blobCounter) (name.Reference, v1.Image) {
+	t.Helper()
+
+	bc.handler = registry.New()
+	s := httptest.NewServer(bc)
+	t.Cleanup(s.Close)
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(fmt.Sprintf("%s/foo:latest", u.Host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(1024, layers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	return ref, img
+}
+
+func TestLayerConcurrency(t *testing.T) {
+	bc := &blobCounter{latency: 10 * time.Millisecond}
+	ref, want := setupPrefetch(t, 8, bc)
+
+	img, err := Image(ref, WithLayerConcurrency(3, layerDir(t)))
+	if err != nil {
+		t.Fatalf("Image() = %v", err)
+	}
+
+	// The config and all of the layers have been fetched already.
+	count, max := bc.counts()
+	if count != 9 {
+		t.Errorf("blob GETs = %d, want 9", count)
+	}
+	if max > 3 {
+		t.Errorf("concurrent blob GETs = %d, want at most 3", max)
+	}
+
+	wantLayers, err := want.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(layers) != len(wantLayers) {
+		t.Fatalf("len(Layers()) = %d, want %d", len(layers), len(wantLayers))
+	}
+	for i, l := range layers {
+		got, err := l.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := wantLayers[i].Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("layer %d Digest() = %s, want %s", i, got, want)
+		}
+		rc, err := l.Compressed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, _, err := v1.SHA256(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc.Close()
+		if h != want {
+			t.Errorf("layer %d contents hash = %s, want %s", i, h, want)
+		}
+	}
+
+	// Reading the layers is served from the cache.
+	if after, _ := bc.counts(); after != count {
+		t.Errorf("blob GETs after reading layers = %d, want %d", after, count)
+	}
+}
+
+func TestLayerConcurrencyError(t *testing.T) {
+	bc := &blobCounter{}
+	ref, img := setupPrefetch(t, 4, bc)
+
+	layers, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := layers[2].Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.Lock()
+	bc.fail = h.String()
+	bc.Unlock()
+
+	if _, err := Image(ref, WithLayerConcurrency(2, layerDir(t))); err == nil {
+		t.Error("Image() = nil, wanted error")
+	}
+}
+
+func TestLayerConcurrencyCancel(t *testing.T) {
+	bc := &blobCounter{}
+	ref, _ := setupPrefetch(t, 4, bc)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Image(ref, WithLayerConcurrency(2, layerDir(t)), WithContext(ctx)); err == nil {
+		t.Error("Image() = nil, wanted error")
+	}
+}
+
+func TestLayerConcurrencyInvalid(t *testing.T) {
+	ref, err := name.ParseReference("example.com/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Image(ref, WithLayerConcurrency(0, layerDir(t))); err == nil {
+		t.Error("Image() = nil, wanted error")
+	}
+	if _, err := Image(ref, WithLayerConcurrency(2, "")); err == nil {
+		t.Error("Image() = nil, wanted error")
+	}
+}
+
+func BenchmarkLayerConcurrency(b *testing.B) {
+	for _, n := range []int{1, 4, 16} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			bc := &blobCounter{latency: 20 * time.Millisecond}
+			ref, _ := setupPrefetch(b, 30, bc)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				img, err := Image(ref, WithLayerConcurrency(n, layerDir(b)))
+				if err != nil {
+					b.Fatal(err)
+				}
+				layers, err := img.Layers()
+				if err != nil {
+					b.Fatal(err)
+				}
+				for _, l := range layers {
+					rc, err := l.Compressed()
+					if err != nil {
+						b.Fatal(err)
+					}
+					io.Copy(ioutil.Discard, rc)
+					rc.Close()
+				}
+			}
+		})
+	}
+}
@@ -17,6 +17,7 @@ package remote
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -31,6 +32,7 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/stream"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
@@ -62,6 +64,35 @@ func TestWriteLayer_Progress(t *testing.T) {
 	}
 }
 
+func TestWriteLayer_Progress_Streaming(t *testing.T) {
+	l := stream.NewLayer(ioutil.NopCloser(strings.NewReader(strings.Repeat("a", 100000))))
+	c := make(chan v1.Update, 200)
+
+	// Set up a fake registry.
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := fmt.Sprintf("%s/test/progress/upload", u.Host)
+	ref, err := name.ParseReference(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error)
+	go func() {
+		errs <- checkGrowingUpdates(c)
+	}()
+	if err := WriteLayer(ref.Context(), l, WithProgress(c)); err != nil {
+		t.Fatalf("WriteLayer: %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+}
+
 // TestWriteLayer_Progress_Exists tests progress reporting behavior when the
 // layer already exists in the registry, so writes are skipped, but progress
 // should still be reported in one update.
@@ -165,6 +196,44 @@ func TestWrite_Progress_DedupeLayers(t *testing.T) {
 	}
 }
 
+// Streaming layers are added to the total as they're uploaded.
+func TestWrite_Progress_Streaming(t *testing.T) {
+	img, err := random.Image(100000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := stream.NewLayer(ioutil.NopCloser(strings.NewReader(strings.Repeat("a", 100000))))
+	img, err = mutate.AppendLayers(img, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := make(chan v1.Update, 200)
+
+	// Set up a fake registry.
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := fmt.Sprintf("%s/test/progress/upload", u.Host)
+	ref, err := name.ParseReference(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error)
+	go func() {
+		errs <- checkGrowingUpdates(c)
+	}()
+	if err := Write(ref, img, WithProgress(c)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestWriteIndex_Progress(t *testing.T) {
 	idx, err := random.Index(100000, 3, 10)
 	if err != nil {
@@ -461,3 +530,36 @@ func checkUpdates(updates <-chan v1.Update) error {
 
 	return nil
 }
+
+// checkGrowingUpdates is like checkUpdates, but allows the total to grow as
+// streaming layers are uploaded.
+func checkGrowingUpdates(updates <-chan v1.Update) error {
+	var high, total int64
+	for u := range updates {
+		if u.Error != nil {
+			return u.Error
+		}
+
+		if u.Total < total {
+			return fmt.Errorf("total shrank: was %d, saw %d", total, u.Total)
+		}
+		total = u.Total
+
+		if u.Complete < high {
+			return fmt.Errorf("saw progress revert: was high of %d, saw %d", high, u.Complete)
+		}
+		high = u.Complete
+
+		if high > total {
+			return fmt.Errorf("progress (%d) exceeded total (%d) by %d", high, total, high-total)
+		}
+	}
+
+	if total == 0 {
+		return errors.New("saw zero total")
+	} else if high < total {
+		return fmt.Errorf("final progress (%d) did not reach total (%d) by %d", high, total, total-high)
+	}
+
+	return nil
+}
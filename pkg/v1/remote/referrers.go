@@ -0,0 +1,209 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Referrers returns an index of the manifests that refer to the given subject
+// digest, using the OCI referrers API:
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#listing-referrers
+//
+// If the registry doesn't support the referrers API, this falls back to the
+// tag schema, where referrers are found via tags of the form
+// "<alg>-<hex>[.<suffix>]" for the subject digest.
+//
+// The subject manifest doesn't have to exist in the registry for there to be
+// manifests that refer to it.
+//
+// See WithFilter to filter the results by artifactType.
+func Referrers(d name.Digest, options ...Option) (v1.ImageIndex, error) {
+	o, err := makeOptions(d.Context(), options...)
+	if err != nil {
+		return nil, err
+	}
+	f, err := makeFetcher(d, o)
+	if err != nil {
+		return nil, err
+	}
+
+	im, supported, err := f.fetchReferrers(d, o.filter)
+	if err != nil {
+		return nil, err
+	}
+	if !supported {
+		tags, err := List(d.Context(), options...)
+		var terr *transport.Error
+		if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+			// No tags just means there are no referrers yet.
+			tags = nil
+		} else if err != nil {
+			return nil, err
+		}
+		im, err = f.fallbackReferrers(d, tags)
+		if err != nil {
+			return nil, err
+		}
+	}
+	im = filterReferrers(im, o.filter)
+
+	b, err := json.Marshal(im)
+	if err != nil {
+		return nil, err
+	}
+	h, sz, err := v1.SHA256(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	return &remoteIndex{
+		fetcher:   *f,
+		manifest:  b,
+		mediaType: types.OCIImageIndex,
+		descriptor: &v1.Descriptor{
+			MediaType: types.OCIImageIndex,
+			Digest:    h,
+			Size:      sz,
+		},
+	}, nil
+}
+
+// fetchReferrers queries the referrers API for the given subject digest. If
+// the registry doesn't support the referrers API, supported is false.
+func (f *fetcher) fetchReferrers(d name.Digest, filter map[string]string) (im *v1.IndexManifest, supported bool, err error) {
+	u := f.url("referrers", d.DigestStr())
+	if at, ok := filter["artifactType"]; ok {
+		u.RawQuery = url.Values{"artifactType": []string{at}}.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Accept", string(types.OCIImageIndex))
+
+	resp, err := f.Client.Do(req.WithContext(f.context))
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if err := transport.CheckError(resp, http.StatusOK, http.StatusNotFound); err != nil {
+		return nil, false, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+
+	im, err = v1.ParseIndexManifest(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	return im, true, nil
+}
+
+// fallbackReferrers implements the referrers tag schema, by looking for tags
+// derived from the subject digest. A tag that exactly matches the schema is
+// expected to be an index of referrers, so all of its children are included.
+// Other matching tags (e.g. "sha256-<hex>.sig") are only included if their
+// manifest's subject is the given digest.
+func (f *fetcher) fallbackReferrers(d name.Digest, tags []string) (*v1.IndexManifest, error) {
+	prefix := strings.Replace(d.DigestStr(), ":", "-", 1)
+	im := &v1.IndexManifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIImageIndex,
+		Manifests:     []v1.Descriptor{},
+	}
+	seen := map[v1.Hash]bool{}
+	add := func(desc v1.Descriptor) {
+		if seen[desc.Digest] {
+			return
+		}
+		seen[desc.Digest] = true
+		im.Manifests = append(im.Manifests, desc)
+	}
+
+	acceptable := append([]types.MediaType{}, acceptableImageMediaTypes...)
+	acceptable = append(acceptable, acceptableIndexMediaTypes...)
+	for _, tag := range tags {
+		if tag != prefix && !strings.HasPrefix(tag, prefix+".") {
+			continue
+		}
+		b, desc, err := f.fetchManifest(d.Context().Tag(tag), acceptable)
+		if err != nil {
+			return nil, err
+		}
+
+		if desc.MediaType.IsIndex() {
+			if tag != prefix {
+				continue
+			}
+			idx, err := v1.ParseIndexManifest(bytes.NewReader(b))
+			if err != nil {
+				return nil, err
+			}
+			for _, child := range idx.Manifests {
+				add(child)
+			}
+			continue
+		}
+
+		m, err := v1.ParseManifest(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		if m.Subject == nil || m.Subject.Digest.String() != d.DigestStr() {
+			continue
+		}
+		// Per the spec, the artifactType falls back to the config's mediaType.
+		at := m.ArtifactType
+		if at == "" {
+			at = string(m.Config.MediaType)
+		}
+		add(v1.Descriptor{
+			MediaType:    desc.MediaType,
+			Size:         desc.Size,
+			Digest:       desc.Digest,
+			Annotations:  m.Annotations,
+			ArtifactType: at,
+		})
+	}
+	return im, nil
+}
+
+// filterReferrers applies the filter client-side, in case the registry didn't.
+func filterReferrers(im *v1.IndexManifest, filter map[string]string) *v1.IndexManifest {
+	at, ok := filter["artifactType"]
+	if !ok {
+		return im
+	}
+	out := *im
+	out.Manifests = []v1.Descriptor{}
+	for _, desc := range im.Manifests {
+		if desc.ArtifactType == at {
+			out.Manifests = append(out.Manifests, desc)
+		}
+	}
+	return &out
+}
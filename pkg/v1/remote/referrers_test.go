@@ -0,0 +1,273 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// rawManifest is a Taggable for pushing hand-crafted manifests.
+type rawManifest struct {
+	mediaType types.MediaType
+	manifest  interface{}
+}
+
+func (r *rawManifest) RawManifest() ([]byte, error) {
+	return json.Marshal(r.manifest)
+}
+
+func (r *rawManifest) MediaType() (types.MediaType, error) {
+	return r.mediaType, nil
+}
+
+func mustDescriptor(t *testing.T, tg Taggable) v1.Descriptor {
+	t.Helper()
+	_, desc, err := unpackTaggable(tg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *desc
+}
+
+func TestReferrers(t *testing.T) {
+	subject := "sha256:" + strings.Repeat("a", 64)
+	sbom := v1.Descriptor{
+		MediaType:    types.OCIManifestSchema1,
+		Size:         123,
+		Digest:       v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("b", 64)},
+		ArtifactType: "application/spdx+json",
+		Annotations:  map[string]string{"foo": "bar"},
+	}
+	sig := v1.Descriptor{
+		MediaType:    types.OCIManifestSchema1,
+		Size:         456,
+		Digest:       v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("c", 64)},
+		ArtifactType: "application/vnd.dev.cosign.simplesigning.v1+json",
+	}
+	referrersPath := fmt.Sprintf("/v2/foo/referrers/%s", subject)
+
+	for _, tc := range []struct {
+		name   string
+		filter string
+		want   []v1.Descriptor
+	}{{
+		name: "unfiltered",
+		want: []v1.Descriptor{sbom, sig},
+	}, {
+		name:   "filtered",
+		filter: sig.ArtifactType,
+		want:   []v1.Descriptor{sig},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v2/":
+					w.WriteHeader(http.StatusOK)
+				case referrersPath:
+					if got, want := r.URL.Query().Get("artifactType"), tc.filter; got != want {
+						t.Errorf("artifactType query; got %q, want %q", got, want)
+					}
+					// Ignore the filter, since registries aren't required to apply it.
+					w.Header().Set("Content-Type", string(types.OCIImageIndex))
+					json.NewEncoder(w).Encode(v1.IndexManifest{
+						SchemaVersion: 2,
+						MediaType:     types.OCIImageIndex,
+						Manifests:     []v1.Descriptor{sbom, sig},
+					})
+				default:
+					t.Fatalf("Unexpected path: %v", r.URL.Path)
+				}
+			}))
+			defer s.Close()
+			u, err := url.Parse(s.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d, err := name.NewDigest(fmt.Sprintf("%s/foo@%s", u.Host, subject))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var opts []Option
+			if tc.filter != "" {
+				opts = append(opts, WithFilter("artifactType", tc.filter))
+			}
+			idx, err := Referrers(d, opts...)
+			if err != nil {
+				t.Fatalf("Referrers() = %v", err)
+			}
+			im, err := idx.IndexManifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, im.Manifests); diff != "" {
+				t.Errorf("Referrers() (-want +got) = %s", diff)
+			}
+		})
+	}
+}
+
+func TestReferrersFallback(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := name.NewRepository(u.Host + "/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(repo.Tag("latest"), img); err != nil {
+		t.Fatal(err)
+	}
+	h, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := repo.Digest(h.String())
+	prefix := strings.Replace(h.String(), ":", "-", 1)
+
+	// Nothing refers to the image yet.
+	idx, err := Referrers(d)
+	if err != nil {
+		t.Fatalf("Referrers() = %v", err)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(im.Manifests) != 0 {
+		t.Errorf("Referrers() = %v, want none", im.Manifests)
+	}
+
+	subject, err := Head(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifact := func(configType types.MediaType, subject *v1.Descriptor, annotations map[string]string) *rawManifest {
+		return &rawManifest{
+			mediaType: types.OCIManifestSchema1,
+			manifest: v1.Manifest{
+				SchemaVersion: 2,
+				MediaType:     types.OCIManifestSchema1,
+				Config: v1.Descriptor{
+					MediaType: configType,
+					Size:      2,
+					Digest:    v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("0", 64)},
+				},
+				Layers:      []v1.Descriptor{},
+				Annotations: annotations,
+				Subject:     subject,
+			},
+		}
+	}
+
+	sig := artifact("application/vnd.dev.cosign.simplesigning.v1+json", subject, map[string]string{"foo": "bar"})
+	if err := Put(repo.Tag(prefix+".sig"), sig); err != nil {
+		t.Fatal(err)
+	}
+	// Matching tag, but no subject: not a referrer.
+	if err := Put(repo.Tag(prefix+".att"), artifact("application/vnd.in-toto+json", nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+	// Unrelated tag with the right subject: not found via the tag schema.
+	if err := Put(repo.Tag("unrelated"), artifact("application/vnd.in-toto+json", subject, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	// An index maintained at the fallback tag.
+	sbom := artifact("application/spdx+json", subject, nil)
+	sbomDesc := mustDescriptor(t, sbom)
+	if err := Put(repo.Digest(sbomDesc.Digest.String()), sbom); err != nil {
+		t.Fatal(err)
+	}
+	sbomDesc.ArtifactType = "application/spdx+json"
+	if err := Put(repo.Tag(prefix), &rawManifest{
+		mediaType: types.OCIImageIndex,
+		manifest: v1.IndexManifest{
+			SchemaVersion: 2,
+			MediaType:     types.OCIImageIndex,
+			Manifests:     []v1.Descriptor{sbomDesc},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	sigDesc := mustDescriptor(t, sig)
+	sigDesc.ArtifactType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	sigDesc.Annotations = map[string]string{"foo": "bar"}
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		want []v1.Descriptor
+	}{{
+		name: "unfiltered",
+		want: []v1.Descriptor{sbomDesc, sigDesc},
+	}, {
+		name: "filtered",
+		opts: []Option{WithFilter("artifactType", "application/spdx+json")},
+		want: []v1.Descriptor{sbomDesc},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			idx, err := Referrers(d, tc.opts...)
+			if err != nil {
+				t.Fatalf("Referrers() = %v", err)
+			}
+			im, err := idx.IndexManifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, im.Manifests); diff != "" {
+				t.Errorf("Referrers() (-want +got) = %s", diff)
+			}
+
+			// The referrers themselves are accessible through the index.
+			for _, desc := range im.Manifests {
+				child, err := idx.Image(desc.Digest)
+				if err != nil {
+					t.Fatalf("Image(%s) = %v", desc.Digest, err)
+				}
+				b, err := child.RawManifest()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Contains(b, []byte(h.String())) {
+					t.Errorf("referrer %s does not refer to %s", desc.Digest, h)
+				}
+			}
+		})
+	}
+}
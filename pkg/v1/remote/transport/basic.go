@@ -32,6 +32,27 @@ var _ http.RoundTripper = (*basicTransport)(nil)
 
 // RoundTrip implements http.RoundTripper
 func (bt *basicTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	res, err := bt.roundTrip(in)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	// The credentials might have expired, so get new ones and try once more.
+	r, ok := bt.auth.(authn.Refresher)
+	if !ok || !rewindable(in) {
+		return res, nil
+	}
+	res.Body.Close()
+	if err := r.Refresh(); err != nil {
+		return nil, err
+	}
+	if in, err = rewind(in); err != nil {
+		return nil, err
+	}
+	return bt.roundTrip(in)
+}
+
+func (bt *basicTransport) roundTrip(in *http.Request) (*http.Response, error) {
 	if bt.auth != authn.Anonymous {
 		auth, err := bt.auth.Authorization()
 		if err != nil {
@@ -136,3 +136,36 @@ func TestBasicTransportWithEmptyAuthnCred(t *testing.T) {
 		t.Errorf("Unexpected error during Get: %v", err)
 	}
 }
+
+func TestBasicTransportRefreshCredentials(t *testing.T) {
+	valid := "two"
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, pass, _ := r.BasicAuth(); pass != valid {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := &rotatingAuth{passwords: []string{"one", "two"}}
+	client := http.Client{Transport: &basicTransport{inner: http.DefaultTransport, auth: auth, target: u.Host}}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL + "/v2/foo/manifests/latest")
+		if err != nil {
+			t.Fatalf("Get() = %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("StatusCode = %d, want %d", resp.StatusCode, http.StatusOK)
+		}
+	}
+	if auth.refreshes != 1 {
+		t.Errorf("refreshes = %d, want 1", auth.refreshes)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 
 	authchallenge "github.com/docker/distribution/registry/client/auth/challenge"
 	"github.com/google/go-containerregistry/internal/redact"
@@ -34,8 +35,12 @@ import (
 type bearerTransport struct {
 	// Wrapped by bearerTransport.
 	inner http.RoundTripper
+	// Guards basic, which is replaced when refreshing, possibly concurrently.
+	mx sync.RWMutex
 	// Basic credentials that we exchange for bearer tokens.
 	basic authn.Authenticator
+	// The original credentials, if they can be refreshed.
+	refresher authn.Refresher
 	// Holds the bearer response from the token service.
 	bearer authn.AuthConfig
 	// Registry to which we send bearer tokens.
@@ -47,6 +52,8 @@ type bearerTransport struct {
 	scopes  []string
 	// Scheme we should use, determined by ping response.
 	scheme string
+	// HTTP method of the token request, or empty to pick one, see refresh.
+	method string
 }
 
 var _ http.RoundTripper = (*bearerTransport)(nil)
@@ -109,7 +116,23 @@ func (bt *bearerTransport) RoundTrip(in *http.Request) (*http.Response, error) {
 		// TODO(jonjohnsonjr): Teach transport.Error about "error" and "error_description" from challenge.
 
 		// Retry the request to attempt to get a valid token.
-		if err = bt.refresh(in.Context()); err != nil {
+		if err = bt.refresh(in.Context()); err == nil {
+			res, err = sendRequest()
+			if err != nil || res.StatusCode != http.StatusUnauthorized || bt.refresher == nil {
+				return res, err
+			}
+		} else if !isUnauthorized(err) || bt.refresher == nil {
+			return nil, err
+		}
+
+		// The credentials themselves might have expired, so get new ones and
+		// try once more.
+		res.Body.Close()
+		if err := bt.refresher.Refresh(); err != nil {
+			return nil, err
+		}
+		bt.setBasic(bt.refresher)
+		if err := bt.refresh(in.Context()); err != nil {
 			return nil, err
 		}
 		return sendRequest()
@@ -118,12 +141,45 @@ func (bt *bearerTransport) RoundTrip(in *http.Request) (*http.Response, error) {
 	return res, err
 }
 
+// tokenMethodKey is the context key of the method set by
+// NewContextWithTokenMethod.
+type tokenMethodKey struct{}
+
+// NewContextWithTokenMethod returns a context that makes NewWithContext only
+// request bearer tokens with the given HTTP method: http.MethodGet for the
+// token endpoint of the Docker registry token authentication, or
+// http.MethodPost for the OAuth2 one. By default, both are tried, see
+// https://docs.docker.com/registry/spec/auth/oauth/
+func NewContextWithTokenMethod(ctx context.Context, method string) context.Context {
+	return context.WithValue(ctx, tokenMethodKey{}, method)
+}
+
+func tokenMethodFromContext(ctx context.Context) string {
+	method, _ := ctx.Value(tokenMethodKey{}).(string)
+	return method
+}
+
+// isUnsupportedMethod returns true if the token server doesn't implement the
+// method of the request that got err.
+func isUnsupportedMethod(err error) bool {
+	terr, ok := err.(*Error)
+	return ok && (terr.StatusCode == http.StatusNotFound || terr.StatusCode == http.StatusMethodNotAllowed)
+}
+
+// isUnauthorized returns whether err is a 401 from the token service.
+func isUnauthorized(err error) bool {
+	terr, ok := err.(*Error)
+	return ok && terr.StatusCode == http.StatusUnauthorized
+}
+
 // It's unclear which authentication flow to use based purely on the protocol,
 // so we rely on heuristics and fallbacks to support as many registries as possible.
 // The basic token exchange is attempted first, falling back to the oauth flow.
 // If the IdentityToken is set, this indicates that we should start with the oauth flow.
+// Either flow falls back to the other one if the token server doesn't implement it,
+// unless bt.method forces one.
 func (bt *bearerTransport) refresh(ctx context.Context) error {
-	auth, err := bt.basic.Authorization()
+	auth, err := bt.getBasic().Authorization()
 	if err != nil {
 		return err
 	}
@@ -134,19 +190,29 @@ func (bt *bearerTransport) refresh(ctx context.Context) error {
 	}
 
 	var content []byte
-	if auth.IdentityToken != "" {
+	switch {
+	case bt.method == http.MethodGet:
+		content, err = bt.refreshBasic(ctx)
+	case bt.method == http.MethodPost:
+		content, err = bt.refreshOauth(ctx)
+	case auth.IdentityToken != "":
 		// If the secret being stored is an identity token,
 		// the Username should be set to <token>, which indicates
 		// we are using an oauth flow.
 		content, err = bt.refreshOauth(ctx)
-		if terr, ok := err.(*Error); ok && terr.StatusCode == http.StatusNotFound {
+		if isUnsupportedMethod(err) {
 			// Note: Not all token servers implement oauth2.
-			// If the request to the endpoint returns 404 using the HTTP POST method,
+			// If the request to the endpoint returns 404 (or 405) using the HTTP POST method,
 			// refer to Token Documentation for using the HTTP GET method supported by all token servers.
 			content, err = bt.refreshBasic(ctx)
 		}
-	} else {
+	default:
 		content, err = bt.refreshBasic(ctx)
+		if isUnsupportedMethod(err) {
+			// Some token servers, e.g. of certain Artifactory setups, only
+			// implement oauth2.
+			content, err = bt.refreshOauth(ctx)
+		}
 	}
 	if err != nil {
 		return err
@@ -178,15 +244,31 @@ func (bt *bearerTransport) refresh(ctx context.Context) error {
 	}
 
 	// If we obtained a refresh token from the oauth flow, use that for refresh() now.
+	// Keep the other credentials, in case we have to fall back to the basic flow.
 	if response.RefreshToken != "" {
-		bt.basic = authn.FromConfig(authn.AuthConfig{
+		bt.setBasic(authn.FromConfig(authn.AuthConfig{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			Auth:          auth.Auth,
 			IdentityToken: response.RefreshToken,
-		})
+		}))
 	}
 
 	return nil
 }
 
+func (bt *bearerTransport) getBasic() authn.Authenticator {
+	bt.mx.RLock()
+	defer bt.mx.RUnlock()
+	return bt.basic
+}
+
+func (bt *bearerTransport) setBasic(basic authn.Authenticator) {
+	bt.mx.Lock()
+	defer bt.mx.Unlock()
+	bt.basic = basic
+}
+
 func matchesHost(reg name.Registry, in *http.Request, scheme string) bool {
 	canonicalHeaderHost := canonicalAddress(in.Host, scheme)
 	canonicalURLHost := canonicalAddress(in.URL.Host, scheme)
@@ -221,7 +303,7 @@ func canonicalAddress(host, scheme string) (address string) {
 
 // https://docs.docker.com/registry/spec/auth/oauth/
 func (bt *bearerTransport) refreshOauth(ctx context.Context) ([]byte, error) {
-	auth, err := bt.basic.Authorization()
+	auth, err := bt.getBasic().Authorization()
 	if err != nil {
 		return nil, err
 	}
@@ -239,7 +321,6 @@ func (bt *bearerTransport) refreshOauth(ctx context.Context) ([]byte, error) {
 		v.Set("grant_type", "refresh_token")
 		v.Set("refresh_token", auth.IdentityToken)
 	} else if auth.Username != "" && auth.Password != "" {
-		// TODO(#629): This is unreachable.
 		v.Set("grant_type", "password")
 		v.Set("username", auth.Username)
 		v.Set("password", auth.Password)
@@ -278,7 +359,7 @@ func (bt *bearerTransport) refreshBasic(ctx context.Context) ([]byte, error) {
 	}
 	b := &basicTransport{
 		inner:  bt.inner,
-		auth:   bt.basic,
+		auth:   bt.getBasic(),
 		target: u.Host,
 	}
 	client := http.Client{Transport: b}
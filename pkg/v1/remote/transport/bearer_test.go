@@ -23,6 +23,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 )
@@ -344,6 +345,154 @@ func TestBearerTransportOauth404Fallback(t *testing.T) {
 	}
 }
 
+// tokenServer is a token service that implements the refresh_token grant of
+// the oauth2 flow, rotating the refresh token on every use, and, unless oauth is
+// false, the basic flow for user:pass. It remembers the scopes of each access
+// token it hands out.
+type tokenServer struct {
+	t       *testing.T
+	oauth   bool
+	refresh string
+	issued  map[string][]string
+}
+
+func (ts *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if !ts.oauth {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			ts.t.Fatal(err)
+		}
+		if got := r.PostForm.Get("grant_type"); got != "refresh_token" {
+			ts.t.Errorf("grant_type = %q, want refresh_token", got)
+		}
+		if r.PostForm.Get("client_id") == "" {
+			ts.t.Error("missing client_id")
+		}
+		if r.PostForm.Get("refresh_token") != ts.refresh {
+			http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		access := ts.issue(strings.Split(r.PostForm.Get("scope"), " "))
+		ts.refresh = fmt.Sprintf("refresh-%d", len(ts.issued))
+		fmt.Fprintf(w, `{"access_token": %q, "refresh_token": %q}`, access, ts.refresh)
+		return
+	}
+	if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	fmt.Fprintf(w, `{"token": %q}`, ts.issue(r.URL.Query()["scope"]))
+}
+
+func (ts *tokenServer) issue(scopes []string) string {
+	access := fmt.Sprintf("access-%d", len(ts.issued))
+	ts.issued[access] = scopes
+	return access
+}
+
+// registryServer requires a bearer token from ts with pull scope for the
+// repository of the request.
+func registryServer(t *testing.T, realm string, tokens map[string][]string) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := ""
+		if r.URL.Path != "/v2/" {
+			repo := strings.Split(strings.TrimPrefix(r.URL.Path, "/v2/"), "/manifests/")[0]
+			scope = fmt.Sprintf("repository:%s:pull", repo)
+		}
+		if scopes, ok := tokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]; ok {
+			for _, s := range append(scopes, "") {
+				if s == scope {
+					return
+				}
+			}
+		}
+		challenge := fmt.Sprintf(`Bearer realm=%q,service="test"`, realm)
+		if scope != "" {
+			challenge += fmt.Sprintf(`,scope=%q`, scope)
+		}
+		w.Header().Set("WWW-Authenticate", challenge)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestBearerIdentityToken(t *testing.T) {
+	for _, tc := range []struct {
+		desc  string
+		oauth bool
+	}{
+		{"refresh_token grant", true},
+		{"basic fallback", false},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ts := &tokenServer{t: t, oauth: tc.oauth, refresh: "refresh-0", issued: map[string][]string{}}
+			tokens := httptest.NewServer(ts)
+			defer tokens.Close()
+			s := registryServer(t, tokens.URL, ts.issued)
+
+			reg, err := name.NewRegistry(strings.TrimPrefix(s.URL, "http://"), name.Insecure)
+			if err != nil {
+				t.Fatal(err)
+			}
+			auth := authn.FromConfig(authn.AuthConfig{
+				Username:      "user",
+				Password:      "pass",
+				IdentityToken: "refresh-0",
+			})
+			tr, err := NewWithContext(context.Background(), reg, auth, http.DefaultTransport, []string{"repository:foo/bar:pull"})
+			if err != nil {
+				t.Fatalf("NewWithContext() = %v", err)
+			}
+			client := http.Client{Transport: tr}
+
+			// The second repository needs a new token, which uses the rotated
+			// refresh token.
+			for _, repo := range []string{"foo/bar", "foo/baz"} {
+				resp, err := client.Get(fmt.Sprintf("%s/v2/%s/manifests/latest", s.URL, repo))
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("GET %s = %d, want %d", repo, resp.StatusCode, http.StatusOK)
+				}
+			}
+		})
+	}
+}
+
+func TestBearerRegistryToken(t *testing.T) {
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected token request: %s %v", r.Method, r.URL)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer tokens.Close()
+	s := registryServer(t, tokens.URL, map[string][]string{"static": {"repository:foo/bar:pull"}})
+
+	reg, err := name.NewRegistry(strings.TrimPrefix(s.URL, "http://"), name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := authn.FromConfig(authn.AuthConfig{Username: "user", Password: "pass", RegistryToken: "static"})
+	tr, err := NewWithContext(context.Background(), reg, auth, http.DefaultTransport, []string{"repository:foo/bar:pull"})
+	if err != nil {
+		t.Fatalf("NewWithContext() = %v", err)
+	}
+	resp, err := (&http.Client{Transport: tr}).Get(s.URL + "/v2/foo/bar/manifests/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
 type recorder struct {
 	reqs []*http.Request
 	resp *http.Response
@@ -557,3 +706,187 @@ func TestInsufficientScope(t *testing.T) {
 		t.Error("didn't refresh insufficient scope")
 	}
 }
+
+// rotatingAuth is an authn.Refresher that moves on to the next password
+// whenever it is refreshed.
+type rotatingAuth struct {
+	passwords []string
+	refreshes int
+}
+
+func (a *rotatingAuth) Authorization() (*authn.AuthConfig, error) {
+	return &authn.AuthConfig{Username: "foo", Password: a.passwords[a.refreshes]}, nil
+}
+
+func (a *rotatingAuth) Refresh() error {
+	if a.refreshes+1 >= len(a.passwords) {
+		return fmt.Errorf("no more passwords")
+	}
+	a.refreshes++
+	return nil
+}
+
+func TestBearerTransportRefreshCredentials(t *testing.T) {
+	// Only the current password can be exchanged for a token, and only the
+	// token for the current password is accepted.
+	var valid string
+	server := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/token" {
+				if _, pass, _ := r.BasicAuth(); pass != valid {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.Write([]byte(fmt.Sprintf(`{"token": "token-%s"}`, valid)))
+				return
+			}
+			if r.Header.Get("Authorization") != "Bearer token-"+valid {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token"`, r.Host))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := name.NewRegistry(u.Host, name.WeakValidation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(tr http.RoundTripper) (int, error) {
+		t.Helper()
+		client := http.Client{Transport: tr}
+		resp, err := client.Get(fmt.Sprintf("http://%s/v2/foo/manifests/latest", u.Host))
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	// The credentials have already expired when the transport is created.
+	valid = "two"
+	auth := &rotatingAuth{passwords: []string{"one", "two", "three"}}
+	tr, err := NewWithContext(context.Background(), registry, auth, http.DefaultTransport, nil)
+	if err != nil {
+		t.Fatalf("NewWithContext() = %v", err)
+	}
+	if auth.refreshes != 1 {
+		t.Errorf("refreshes = %d, want 1", auth.refreshes)
+	}
+	if code, err := get(tr); err != nil || code != http.StatusOK {
+		t.Errorf("Get() = %d, %v", code, err)
+	}
+
+	// The credentials expire mid-session.
+	valid = "three"
+	if code, err := get(tr); err != nil || code != http.StatusOK {
+		t.Errorf("Get() = %d, %v", code, err)
+	}
+	if auth.refreshes != 2 {
+		t.Errorf("refreshes = %d, want 2", auth.refreshes)
+	}
+
+	// Give up if there are no new credentials.
+	valid = "four"
+	if _, err := get(tr); err == nil {
+		t.Error("Get() = nil, wanted error")
+	}
+
+	// Credentials that can't be refreshed still fail.
+	valid = "two"
+	tr, err = NewWithContext(context.Background(), registry, &authn.Basic{Username: "foo", Password: "two"}, http.DefaultTransport, nil)
+	if err != nil {
+		t.Fatalf("NewWithContext() = %v", err)
+	}
+	valid = "three"
+	if _, err := get(tr); err == nil {
+		t.Error("Get() = nil, wanted error")
+	}
+}
+
+func TestBearerTokenMethod(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		// The only method that the token server implements.
+		serves string
+		// The method that the transport is forced to use, if any.
+		forced string
+		want   []string
+		err    bool
+	}{
+		{"get", http.MethodGet, "", []string{http.MethodGet}, false},
+		{"post fallback", http.MethodPost, "", []string{http.MethodGet, http.MethodPost}, false},
+		{"forced post", http.MethodPost, http.MethodPost, []string{http.MethodPost}, false},
+		{"forced get", http.MethodGet, http.MethodGet, []string{http.MethodGet}, false},
+		{"forced wrong method", http.MethodGet, http.MethodPost, []string{http.MethodPost}, true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			issued := map[string][]string{}
+			var methods []string
+			tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				methods = append(methods, r.Method)
+				if r.Method != tc.serves {
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				user, pass, scopes := "", "", r.URL.Query()["scope"]
+				if r.Method == http.MethodPost {
+					if err := r.ParseForm(); err != nil {
+						t.Fatal(err)
+					}
+					if got := r.PostForm.Get("grant_type"); got != "password" {
+						t.Errorf("grant_type = %q, want password", got)
+					}
+					user, pass = r.PostForm.Get("username"), r.PostForm.Get("password")
+					scopes = strings.Split(r.PostForm.Get("scope"), " ")
+				} else {
+					user, pass, _ = r.BasicAuth()
+				}
+				if user != "user" || pass != "pass" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				token := fmt.Sprintf("token-%d", len(issued))
+				issued[token] = scopes
+				fmt.Fprintf(w, `{"access_token": %q}`, token)
+			}))
+			defer tokens.Close()
+			s := registryServer(t, tokens.URL, issued)
+
+			reg, err := name.NewRegistry(strings.TrimPrefix(s.URL, "http://"), name.Insecure)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			if tc.forced != "" {
+				ctx = NewContextWithTokenMethod(ctx, tc.forced)
+			}
+			auth := authn.FromConfig(authn.AuthConfig{Username: "user", Password: "pass"})
+			tr, err := NewWithContext(ctx, reg, auth, http.DefaultTransport, []string{"repository:foo/bar:pull"})
+			if tc.err {
+				if err == nil {
+					t.Error("NewWithContext() = nil, wanted error")
+				}
+			} else if err != nil {
+				t.Fatalf("NewWithContext() = %v", err)
+			} else {
+				resp, err := (&http.Client{Transport: tr}).Get(s.URL + "/v2/foo/bar/manifests/latest")
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("GET = %d, want %d", resp.StatusCode, http.StatusOK)
+				}
+			}
+			if diff := cmp.Diff(tc.want, methods); diff != "" {
+				t.Errorf("token requests (-want +got) = %s", diff)
+			}
+		})
+	}
+}
@@ -38,6 +38,8 @@ var paramAllowlist = map[string]struct{}{
 	// Listing tags and catalog
 	"n":    {},
 	"last": {},
+	// Referrers filtering
+	"artifactType": {},
 }
 
 // Error implements error to support the following error specification:
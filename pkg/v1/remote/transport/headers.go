@@ -0,0 +1,70 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"net/http"
+)
+
+// sensitiveHeaders are only sent to the registry itself, like the
+// Authorization header that http.Client strips on cross-host redirects.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Cookie2":             true,
+	"Www-Authenticate":    true,
+}
+
+type headerTransport struct {
+	inner   http.RoundTripper
+	target  string
+	headers http.Header
+}
+
+// NewRequestHeaders returns an http.RoundTripper that adds headers to every
+// request that doesn't already have a value for them.
+//
+// Credentials, i.e. the Authorization, Proxy-Authorization and Cookie headers,
+// are only added to requests to target, the registry's host, so that they
+// don't leak to the hosts we are redirected to, e.g. for blob storage.
+func NewRequestHeaders(inner http.RoundTripper, target string, headers http.Header) http.RoundTripper {
+	canonical := http.Header{}
+	for k, vs := range headers {
+		k = http.CanonicalHeaderKey(k)
+		canonical[k] = append(canonical[k], vs...)
+	}
+	return &headerTransport{
+		inner:   inner,
+		target:  target,
+		headers: canonical,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (ht *headerTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	// In case of redirect http.Client can use an empty Host, check URL too.
+	toTarget := in.Host == ht.target || in.URL.Host == ht.target
+	for k, vs := range ht.headers {
+		if sensitiveHeaders[k] && !toTarget {
+			continue
+		}
+		if _, ok := in.Header[k]; ok {
+			continue
+		}
+		in.Header[k] = append([]string{}, vs...)
+	}
+	return ht.inner.RoundTrip(in)
+}
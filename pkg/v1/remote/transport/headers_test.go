@@ -0,0 +1,76 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRequestHeaders(t *testing.T) {
+	var storage http.Header
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		storage = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer other.Close()
+
+	var registry http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registry = r.Header.Clone()
+		http.Redirect(w, r, other.URL, http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := http.Client{Transport: NewRequestHeaders(http.DefaultTransport, u.Host, http.Header{
+		"x-request-id":  []string{"abc"},
+		"Authorization": []string{"Bearer secret"},
+		"Accept":        []string{"ignored"},
+	})}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "text/plain")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	for _, tc := range []struct {
+		desc string
+		got  http.Header
+		key  string
+		want string
+	}{
+		{"registry", registry, "X-Request-Id", "abc"},
+		{"registry", registry, "Authorization", "Bearer secret"},
+		{"registry", registry, "Accept", "text/plain"},
+		{"redirect", storage, "X-Request-Id", "abc"},
+		{"redirect", storage, "Authorization", ""},
+		{"redirect", storage, "Accept", "text/plain"},
+	} {
+		if got := tc.got.Get(tc.key); got != tc.want {
+			t.Errorf("%s: %s = %q, want %q", tc.desc, tc.key, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+type rateLimitTransport struct {
+	inner   http.RoundTripper
+	limiter *rate.Limiter
+	hosts   map[string]*rate.Limiter
+}
+
+// NewRateLimiter returns an http.RoundTripper that waits on a rate.Limiter
+// before sending each request, until the request's context is done.
+//
+// The limiter for a request is looked up by the host (and port) of its URL in
+// hosts, falling back to limiter, which may be nil to not limit the requests
+// to other hosts.
+func NewRateLimiter(inner http.RoundTripper, limiter *rate.Limiter, hosts map[string]*rate.Limiter) http.RoundTripper {
+	return &rateLimitTransport{
+		inner:   inner,
+		limiter: limiter,
+		hosts:   hosts,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (rt *rateLimitTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	limiter, ok := rt.hosts[in.URL.Host]
+	if !ok {
+		limiter = rt.limiter
+	}
+	if limiter != nil {
+		if err := limiter.Wait(in.Context()); err != nil {
+			return nil, err
+		}
+	}
+	return rt.inner.RoundTrip(in)
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimiter(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	limited := httptest.NewServer(handler)
+	defer limited.Close()
+	other := httptest.NewServer(handler)
+	defer other.Close()
+	u, err := url.Parse(limited.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Allow a single request to the limited host.
+	hosts := map[string]*rate.Limiter{
+		u.Host: rate.NewLimiter(rate.Every(time.Hour), 1),
+	}
+	tr := NewRateLimiter(http.DefaultTransport, nil, hosts)
+
+	get := func(server *httptest.Server) error {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := tr.RoundTrip(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	if err := get(limited); err != nil {
+		t.Errorf("RoundTrip() = %v", err)
+	}
+	if err := get(limited); err == nil {
+		t.Error("RoundTrip() = nil, wanted rate limit to exceed the context deadline")
+	}
+	// Other hosts aren't limited.
+	for i := 0; i < 3; i++ {
+		if err := get(other); err != nil {
+			t.Errorf("RoundTrip(other) = %v", err)
+		}
+	}
+
+	// Unless they fall back to a global limiter.
+	tr = NewRateLimiter(http.DefaultTransport, rate.NewLimiter(rate.Every(time.Hour), 1), hosts)
+	if err := get(other); err != nil {
+		t.Errorf("RoundTrip(other) = %v", err)
+	}
+	if err := get(other); err == nil {
+		t.Error("RoundTrip(other) = nil, wanted rate limit to exceed the context deadline")
+	}
+}
@@ -15,7 +15,11 @@
 package transport
 
 import (
+	"context"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/google/go-containerregistry/internal/retry"
@@ -31,11 +35,13 @@ var defaultBackoff = retry.Backoff{
 
 var _ http.RoundTripper = (*retryTransport)(nil)
 
-// retryTransport wraps a RoundTripper and retries temporary network errors.
+// retryTransport wraps a RoundTripper and retries temporary network errors,
+// as well as responses with certain status codes.
 type retryTransport struct {
 	inner     http.RoundTripper
 	backoff   retry.Backoff
 	predicate retry.Predicate
+	codes     []int
 }
 
 // Option is a functional option for retryTransport.
@@ -44,6 +50,7 @@ type Option func(*options)
 type options struct {
 	backoff   retry.Backoff
 	predicate retry.Predicate
+	codes     []int
 }
 
 // WithRetryBackoff sets the backoff for retry operations.
@@ -60,6 +67,17 @@ func WithRetryPredicate(predicate func(error) bool) Option {
 	}
 }
 
+// WithRetryStatusCodes sets the status codes of responses that are retried,
+// e.g. http.StatusTooManyRequests. If such a response has a Retry-After
+// header, the next attempt waits at least that long.
+//
+// By default, responses are never retried, only network errors are.
+func WithRetryStatusCodes(codes ...int) Option {
+	return func(o *options) {
+		o.codes = codes
+	}
+}
+
 // NewRetry returns a transport that retries errors.
 func NewRetry(inner http.RoundTripper, opts ...Option) http.RoundTripper {
 	o := &options{
@@ -75,14 +93,99 @@ func NewRetry(inner http.RoundTripper, opts ...Option) http.RoundTripper {
 		inner:     inner,
 		backoff:   o.backoff,
 		predicate: o.predicate,
+		codes:     o.codes,
 	}
 }
 
 func (t *retryTransport) RoundTrip(in *http.Request) (out *http.Response, err error) {
-	roundtrip := func() error {
-		out, err = t.inner.RoundTrip(in)
-		return err
+	ctx := context.Background()
+	if in != nil {
+		ctx = in.Context()
+	}
+
+	// This follows wait.ExponentialBackoff, but lets the response determine
+	// the delay before the next attempt.
+	backoff := t.backoff
+	req := in
+	for backoff.Steps > 0 {
+		out, err = t.inner.RoundTrip(req)
+
+		var delay time.Duration
+		if err != nil {
+			if !t.predicate(err) {
+				return out, err
+			}
+		} else if t.retryStatus(out.StatusCode) && rewindable(in) {
+			delay = retryAfter(out)
+		} else {
+			return out, nil
+		}
+		if backoff.Steps == 1 {
+			break
+		}
+		if step := backoff.Step(); step > delay {
+			delay = step
+		}
+
+		if out != nil {
+			// Drain the response so that the connection can be reused.
+			io.Copy(ioutil.Discard, io.LimitReader(out.Body, 4096))
+			out.Body.Close()
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if req, err = rewind(in); err != nil {
+			return nil, err
+		}
+	}
+	return out, err
+}
+
+func (t *retryTransport) retryStatus(code int) bool {
+	for _, c := range t.codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfter returns the delay requested by the Retry-After header of resp,
+// which is either a number of seconds or an HTTP date, or zero.
+func retryAfter(resp *http.Response) time.Duration {
+	h := resp.Header.Get("Retry-After")
+	if h == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(h); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(h); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// rewindable returns whether the body of in can be sent again.
+func rewindable(in *http.Request) bool {
+	return in == nil || in.Body == nil || in.Body == http.NoBody || in.GetBody != nil
+}
+
+// rewind returns a copy of in with a fresh body, if it has one.
+func rewind(in *http.Request) (*http.Request, error) {
+	if in == nil || in.GetBody == nil {
+		return in, nil
+	}
+	body, err := in.GetBody()
+	if err != nil {
+		return nil, err
 	}
-	retry.Retry(roundtrip, t.predicate, t.backoff)
-	return
+	req := in.Clone(in.Context())
+	req.Body = body
+	return req, nil
 }
@@ -16,8 +16,11 @@ package transport
 
 import (
 	"context"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -129,3 +132,128 @@ func TestTimeoutContext(t *testing.T) {
 		t.Fatalf("deadline was not recognized by transport")
 	}
 }
+
+// statusServer responds with the given status codes in order, and then with
+// the last one, recording the bodies of the requests.
+type statusServer struct {
+	sync.Mutex
+	codes  []int
+	bodies []string
+}
+
+func (s *statusServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := ioutil.ReadAll(r.Body)
+	s.Lock()
+	defer s.Unlock()
+	s.bodies = append(s.bodies, string(b))
+	code := s.codes[len(s.codes)-1]
+	if len(s.bodies) <= len(s.codes) {
+		code = s.codes[len(s.bodies)-1]
+	}
+	if code == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", "1")
+	}
+	w.WriteHeader(code)
+}
+
+func (s *statusServer) requests() []string {
+	s.Lock()
+	defer s.Unlock()
+	return s.bodies
+}
+
+func TestRetryStatusCodes(t *testing.T) {
+	tr := NewRetry(http.DefaultTransport,
+		WithRetryBackoff(retry.Backoff{Duration: time.Millisecond, Steps: 3}),
+		WithRetryStatusCodes(http.StatusTooManyRequests, http.StatusServiceUnavailable))
+
+	for _, tc := range []struct {
+		name       string
+		tr         http.RoundTripper
+		codes      []int
+		wantCode   int
+		wantCount  int
+		wantMinDur time.Duration
+	}{{
+		name:       "honors Retry-After",
+		tr:         tr,
+		codes:      []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK},
+		wantCode:   http.StatusOK,
+		wantCount:  3,
+		wantMinDur: time.Second,
+	}, {
+		name:      "gives up after Steps",
+		tr:        tr,
+		codes:     []int{http.StatusServiceUnavailable},
+		wantCode:  http.StatusServiceUnavailable,
+		wantCount: 3,
+	}, {
+		name:      "other codes",
+		tr:        tr,
+		codes:     []int{http.StatusInternalServerError},
+		wantCode:  http.StatusInternalServerError,
+		wantCount: 1,
+	}, {
+		name:      "not retried by default",
+		tr:        NewRetry(http.DefaultTransport),
+		codes:     []int{http.StatusServiceUnavailable},
+		wantCode:  http.StatusServiceUnavailable,
+		wantCount: 1,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			ss := &statusServer{codes: tc.codes}
+			server := httptest.NewServer(ss)
+			defer server.Close()
+
+			req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("hello"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			resp, err := tc.tr.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("RoundTrip() = %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.wantCode {
+				t.Errorf("StatusCode = %d, want %d", resp.StatusCode, tc.wantCode)
+			}
+			if elapsed := time.Since(start); elapsed < tc.wantMinDur {
+				t.Errorf("RoundTrip() took %v, want at least %v", elapsed, tc.wantMinDur)
+			}
+			bodies := ss.requests()
+			if len(bodies) != tc.wantCount {
+				t.Errorf("wrong count, wanted %d, got %d", tc.wantCount, len(bodies))
+			}
+			// The body is sent again for every attempt.
+			for _, b := range bodies {
+				if b != "hello" {
+					t.Errorf("request body = %q, want %q", b, "hello")
+				}
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 2 * time.Minute, 2 * time.Minute},
+		{"-1", 0, 0},
+		{"soon", 0, 0},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 59 * time.Minute, time.Hour},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+	} {
+		resp := &http.Response{Header: http.Header{}}
+		if tc.header != "" {
+			resp.Header.Set("Retry-After", tc.header)
+		}
+		if got := retryAfter(resp); got < tc.min || got > tc.max {
+			t.Errorf("retryAfter(%q) = %v, want between %v and %v", tc.header, got, tc.min, tc.max)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// TokenCache holds the bearer tokens that transports obtain, so that
+// transports for the same registry and credentials reuse a token, instead of
+// exchanging the credentials again, if it was issued for all of their scopes.
+//
+// Tokens expire, so a TokenCache is meant to be shared by the transports of a
+// single operation, like a copy, see NewContextWithTokenCache.
+type TokenCache struct {
+	mu     sync.Mutex
+	tokens map[string][]cachedToken
+}
+
+type cachedToken struct {
+	scopes map[string]struct{}
+	token  string
+}
+
+// NewTokenCache returns an empty TokenCache.
+func NewTokenCache() *TokenCache {
+	return &TokenCache{
+		tokens: map[string][]cachedToken{},
+	}
+}
+
+type tokenCacheKey struct{}
+
+// NewContextWithTokenCache returns a context that makes NewWithContext look up
+// the initial bearer token in cache, and store the ones it obtains there.
+func NewContextWithTokenCache(ctx context.Context, cache *TokenCache) context.Context {
+	return context.WithValue(ctx, tokenCacheKey{}, cache)
+}
+
+func tokenCacheFromContext(ctx context.Context) *TokenCache {
+	cache, _ := ctx.Value(tokenCacheKey{}).(*TokenCache)
+	return cache
+}
+
+// get returns a token that was issued for key and at least the given scopes.
+func (c *TokenCache) get(key string, scopes []string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+outer:
+	for _, ct := range c.tokens[key] {
+		for _, scope := range scopes {
+			if _, ok := ct.scopes[scope]; !ok {
+				continue outer
+			}
+		}
+		return ct.token, true
+	}
+	return "", false
+}
+
+// put stores a token that was issued for key and the given scopes.
+func (c *TokenCache) put(key string, scopes []string, token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[key] = append(c.tokens[key], cachedToken{
+		scopes: stringSet(scopes),
+		token:  token,
+	})
+}
+
+// cacheKey identifies the token service and credentials that bt exchanges for
+// tokens, without holding on to the credentials.
+func (bt *bearerTransport) cacheKey() (string, error) {
+	auth, err := bt.getBasic().Authorization()
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(struct {
+		Registry, Realm, Service string
+		Auth                     *authn.AuthConfig
+	}{bt.registry.RegistryStr(), bt.realm, bt.service, auth})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestTokenCache(t *testing.T) {
+	tokens := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Header().Set("WWW-Authenticate", `Bearer realm="http://`+r.Host+`/token"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		case "/token":
+			tokens++
+			fmt.Fprintf(w, `{"token": "token-%d"}`, tokens)
+		default:
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg, err := name.NewRegistry(u.Host, name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := NewContextWithTokenCache(context.Background(), NewTokenCache())
+	basic := &authn.Basic{Username: "foo", Password: "bar"}
+	for _, tc := range []struct {
+		auth   authn.Authenticator
+		scopes []string
+		want   string
+	}{
+		{basic, []string{"repository:a:pull", "repository:b:push,pull"}, "token-1"},
+		// A subset of the scopes reuses the token.
+		{basic, []string{"repository:b:push,pull"}, "token-1"},
+		{basic, []string{"repository:c:pull"}, "token-2"},
+		// Other credentials don't.
+		{&authn.Basic{Username: "baz", Password: "bar"}, []string{"repository:a:pull"}, "token-3"},
+	} {
+		tr, err := NewWithContext(ctx, reg, tc.auth, http.DefaultTransport, tc.scopes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bt, ok := tr.(*bearerTransport)
+		if !ok {
+			t.Fatalf("NewWithContext(); got %T, want *bearerTransport", tr)
+		}
+		if got := bt.bearer.RegistryToken; got != tc.want {
+			t.Errorf("token for %v = %q, want %q", tc.scopes, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RequestTrace describes an HTTP request and its response, see NewTracer.
+// It never includes headers or query parameters, which may hold credentials.
+type RequestTrace struct {
+	// Method is the method of the request, e.g. "GET".
+	Method string
+	// URL is the URL of the request, without user info or query.
+	URL string
+	// StatusCode is the status code of the response, or 0 if Err is set.
+	StatusCode int
+	// Duration is the time from sending the request until its response body
+	// was read to the end or closed, or until it failed.
+	Duration time.Duration
+	// BytesSent is the size of the request body, or -1 if unknown.
+	BytesSent int64
+	// BytesReceived is the number of bytes read from the response body.
+	BytesReceived int64
+	// Err is the error that the request failed with, if any.
+	Err error
+}
+
+type traceTransport struct {
+	inner http.RoundTripper
+	hook  func(RequestTrace)
+}
+
+// NewTracer returns an http.RoundTripper that calls hook once for each
+// request, when its response body has been read to the end or closed, or when
+// it failed, e.g. to correlate a slow pull with the requests that it made.
+//
+// The hook may be called concurrently for concurrent requests.
+func NewTracer(inner http.RoundTripper, hook func(RequestTrace)) http.RoundTripper {
+	return &traceTransport{
+		inner: inner,
+		hook:  hook,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (tt *traceTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	// Strip anything that may be a credential, like the signature in the
+	// query of a redirect to blob storage.
+	u := *in.URL
+	u.User = nil
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	trace := RequestTrace{
+		Method:    in.Method,
+		URL:       u.String(),
+		BytesSent: in.ContentLength,
+	}
+	if in.Body == nil || in.Body == http.NoBody {
+		trace.BytesSent = 0
+	}
+
+	start := time.Now()
+	resp, err := tt.inner.RoundTrip(in)
+	if err != nil {
+		trace.Duration = time.Since(start)
+		trace.Err = err
+		tt.hook(trace)
+		return resp, err
+	}
+	trace.StatusCode = resp.StatusCode
+	resp.Body = &traceBody{
+		inner: resp.Body,
+		done: func(n int64, err error) {
+			trace.Duration = time.Since(start)
+			trace.BytesReceived = n
+			trace.Err = err
+			tt.hook(trace)
+		},
+	}
+	return resp, nil
+}
+
+// traceBody counts the bytes read from inner, and calls done once, at EOF or
+// when it's closed.
+type traceBody struct {
+	inner io.ReadCloser
+	n     int64
+	once  sync.Once
+	done  func(int64, error)
+}
+
+// Read implements io.Reader
+func (tb *traceBody) Read(p []byte) (int, error) {
+	n, err := tb.inner.Read(p)
+	tb.n += int64(n)
+	if err == io.EOF {
+		tb.once.Do(func() { tb.done(tb.n, nil) })
+	} else if err != nil {
+		tb.once.Do(func() { tb.done(tb.n, err) })
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (tb *traceBody) Close() error {
+	err := tb.inner.Close()
+	tb.once.Do(func() { tb.done(tb.n, nil) })
+	return err
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTracer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	var got []RequestTrace
+	client := http.Client{Transport: NewTracer(http.DefaultTransport, func(trace RequestTrace) {
+		got = append(got, trace)
+	})}
+	u := strings.Replace(server.URL, "http://", "http://user:secret@", 1) + "/v2/foo?signature=secret"
+	resp, err := client.Post(u, "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("traced %d requests before reading the body, want 0", len(got))
+	}
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if len(got) != 1 {
+		t.Fatalf("traced %d requests, want 1", len(got))
+	}
+	trace := got[0]
+	if trace.Method != http.MethodPost || trace.StatusCode != http.StatusAccepted {
+		t.Errorf("trace = %+v, want POST with status 202", trace)
+	}
+	if want := server.URL + "/v2/foo"; trace.URL != want {
+		t.Errorf("URL = %q, want %q", trace.URL, want)
+	}
+	if trace.BytesSent != 4 || trace.BytesReceived != 5 {
+		t.Errorf("BytesSent, BytesReceived = %d, %d, want 4, 5", trace.BytesSent, trace.BytesReceived)
+	}
+	if trace.Duration <= 0 || trace.Err != nil {
+		t.Errorf("Duration, Err = %v, %v", trace.Duration, trace.Err)
+	}
+
+	// Failed requests are traced, too.
+	got = nil
+	wantErr := errors.New("boom")
+	client.Transport = NewTracer(roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return nil, wantErr
+	}), func(trace RequestTrace) {
+		got = append(got, trace)
+	})
+	if _, err := client.Get(server.URL); err == nil {
+		t.Fatal("Get() = nil, wanted error")
+	}
+	if len(got) != 1 || !errors.Is(got[0].Err, wantErr) {
+		t.Errorf("traces = %+v, want one with %v", got, wantErr)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
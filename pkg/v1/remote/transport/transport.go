@@ -92,10 +92,37 @@ func NewWithContext(ctx context.Context, reg name.Registry, auth authn.Authentic
 			service:  service,
 			scopes:   scopes,
 			scheme:   pr.scheme,
+			method:   tokenMethodFromContext(ctx),
 		}
-		if err := bt.refresh(ctx); err != nil {
+		bt.refresher, _ = auth.(authn.Refresher)
+
+		// Reuse a token from this operation that covers our scopes, if any.
+		cache := tokenCacheFromContext(ctx)
+		var key string
+		if cache != nil {
+			if key, err = bt.cacheKey(); err != nil {
+				return nil, err
+			}
+			if token, ok := cache.get(key, scopes); ok {
+				bt.bearer.RegistryToken = token
+				return bt, nil
+			}
+		}
+
+		err := bt.refresh(ctx)
+		if isUnauthorized(err) && bt.refresher != nil {
+			// The credentials might have expired since they were resolved.
+			if err := bt.refresher.Refresh(); err != nil {
+				return nil, err
+			}
+			err = bt.refresh(ctx)
+		}
+		if err != nil {
 			return nil, err
 		}
+		if cache != nil {
+			cache.put(key, scopes, bt.bearer.RegistryToken)
+		}
 		return bt, nil
 	default:
 		return nil, fmt.Errorf("unrecognized challenge: %s", pr.challenge)
@@ -0,0 +1,47 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"net/http"
+)
+
+type warningTransport struct {
+	inner   http.RoundTripper
+	handler func(string)
+}
+
+// NewWarningHandler returns an http.RoundTripper that calls handler with each
+// Warning header value (RFC 7234) of every response, e.g.:
+//
+// Warning: 299 - "this registry endpoint is deprecated"
+func NewWarningHandler(inner http.RoundTripper, handler func(string)) http.RoundTripper {
+	return &warningTransport{
+		inner:   inner,
+		handler: handler,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (wt *warningTransport) RoundTrip(in *http.Request) (*http.Response, error) {
+	resp, err := wt.inner.RoundTrip(in)
+	if err != nil {
+		return resp, err
+	}
+	for _, warning := range resp.Header.Values("Warning") {
+		wt.handler(warning)
+	}
+	return resp, nil
+}
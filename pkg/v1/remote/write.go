@@ -17,6 +17,7 @@ package remote
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -61,25 +62,38 @@ func Write(ref name.Reference, img v1.Image, options ...Option) (rerr error) {
 		defer close(o.updates)
 		defer func() { sendError(o.updates, rerr) }()
 	}
-	return writeImage(ref, img, o, lastUpdate)
+	return writeImage(ref, img, o, lastUpdate, nil)
 }
 
-func writeImage(ref name.Reference, img v1.Image, o *options, lastUpdate *v1.Update) error {
-	ls, err := img.Layers()
+func writeImage(ref name.Reference, img v1.Image, o *options, lastUpdate *v1.Update, stats *blobStats) error {
+	ls, err := imageBlobs(img)
 	if err != nil {
 		return err
 	}
-	scopes := scopesForUploadingImage(ref.Context(), ls)
-	tr, err := transport.NewWithContext(o.context, ref.Context().Registry, o.auth, o.transport, scopes)
+	scopes := scopesForUploadingImage(ref.Context(), ls, o.mountFrom...)
+	tr, err := o.newTransport(ref.Context().Registry, scopes)
 	if err != nil {
 		return err
 	}
 	w := writer{
-		repo:       ref.Context(),
-		client:     &http.Client{Transport: tr},
-		context:    o.context,
-		updates:    o.updates,
-		lastUpdate: lastUpdate,
+		repo:              ref.Context(),
+		client:            &http.Client{Transport: tr},
+		context:           o.context,
+		updates:           o.updates,
+		lastUpdate:        lastUpdate,
+		chunkSize:         o.chunkSize,
+		mountFrom:         o.mountFrom,
+		stats:             stats,
+		strictContentType: o.strictContentType,
+	}
+
+	// See countImage.
+	streaming := false
+	for _, l := range ls {
+		if isStreaming(l) {
+			streaming = true
+			break
+		}
 	}
 
 	// Upload individual blobs and collect any errors.
@@ -138,6 +152,20 @@ func writeImage(ref name.Reference, img v1.Image, o *options, lastUpdate *v1.Upd
 		return err
 	}
 
+	if streaming && w.updates != nil {
+		// Now that the streaming layers have been uploaded, we can count the
+		// config and manifest.
+		b, err := img.RawConfigFile()
+		if err != nil {
+			return err
+		}
+		size, err := img.Size()
+		if err != nil {
+			return err
+		}
+		atomic.AddInt64(&w.lastUpdate.Total, int64(len(b))+size)
+	}
+
 	if l, err := partial.ConfigLayer(img); err != nil {
 		// We can't read the ConfigLayer, possibly because of streaming layers,
 		// since the layer DiffIDs haven't been calculated yet. Attempt to wait
@@ -179,6 +207,38 @@ type writer struct {
 
 	updates    chan<- v1.Update
 	lastUpdate *v1.Update
+
+	// chunkSize is the maximum number of bytes to send per PATCH request
+	// when the registry supports chunked uploads, or zero to disable them.
+	chunkSize int64
+
+	// mountFrom lists the repositories to try mounting blobs from, see
+	// WithMountFrom.
+	mountFrom []name.Repository
+
+	// stats, if set, counts the blobs that were uploaded or mounted.
+	stats *blobStats
+
+	// See WithStrictContentType.
+	strictContentType bool
+}
+
+// blobStats counts the blobs that a writer uploaded or mounted, so that
+// WriteIndex can tell whether a child was mounted.
+type blobStats struct {
+	uploaded, mounted int64
+}
+
+func (s *blobStats) countUploaded() {
+	if s != nil {
+		atomic.AddInt64(&s.uploaded, 1)
+	}
+}
+
+func (s *blobStats) countMounted() {
+	if s != nil {
+		atomic.AddInt64(&s.mounted, 1)
+	}
 }
 
 func sendError(ch chan<- v1.Update, err error) error {
@@ -269,6 +329,14 @@ func (w *writer) checkExistingManifest(h v1.Hash, mt types.MediaType) (bool, err
 // upload was initiated and the body of that blob should be sent to the returned
 // location.
 func (w *writer) initiateUpload(from, mount string) (location string, mounted bool, err error) {
+	location, mounted, _, err = w.initiate(from, mount)
+	return location, mounted, err
+}
+
+// initiate does the work of initiateUpload, additionally reporting whether the
+// registry supports chunked uploads, as indicated by the presence of a Range
+// or OCI-Chunk-Min-Length header in the response.
+func (w *writer) initiate(from, mount string) (location string, mounted, chunked bool, err error) {
 	u := w.url(fmt.Sprintf("/v2/%s/blobs/uploads/", w.repo.RepositoryStr()))
 	uv := url.Values{}
 	if mount != "" && from != "" {
@@ -281,28 +349,29 @@ func (w *writer) initiateUpload(from, mount string) (location string, mounted bo
 	// Make the request to initiate the blob upload.
 	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
 	if err != nil {
-		return "", false, err
+		return "", false, false, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := w.client.Do(req.WithContext(w.context))
 	if err != nil {
-		return "", false, err
+		return "", false, false, err
 	}
 	defer resp.Body.Close()
 
 	if err := transport.CheckError(resp, http.StatusCreated, http.StatusAccepted); err != nil {
-		return "", false, err
+		return "", false, false, err
 	}
 
 	// Check the response code to determine the result.
 	switch resp.StatusCode {
 	case http.StatusCreated:
 		// We're done, we were able to fast-path.
-		return "", true, nil
+		return "", true, false, nil
 	case http.StatusAccepted:
 		// Proceed to PATCH, upload has begun.
 		loc, err := w.nextLocation(resp)
-		return loc, false, err
+		chunked := resp.Header.Get("Range") != "" || resp.Header.Get("OCI-Chunk-Min-Length") != ""
+		return loc, false, chunked, err
 	default:
 		panic("Unreachable: initiateUpload")
 	}
@@ -324,7 +393,7 @@ func (r *progressReader) Read(b []byte) (int, error) {
 	atomic.AddInt64(r.count, int64(n))
 	// TODO: warn/debug log if sending takes too long, or if sending is blocked while context is cancelled.
 	r.updates <- v1.Update{
-		Total:    r.lastUpdate.Total,
+		Total:    atomic.LoadInt64(&r.lastUpdate.Total),
 		Complete: atomic.AddInt64(&r.lastUpdate.Complete, int64(n)),
 	}
 	return n, nil
@@ -332,6 +401,21 @@ func (r *progressReader) Read(b []byte) (int, error) {
 
 func (r *progressReader) Close() error { return r.rc.Close() }
 
+// totalReader adds the bytes read from a streaming layer, whose size isn't
+// known up front, to the total of the progress updates.
+type totalReader struct {
+	rc    io.ReadCloser
+	total *int64
+}
+
+func (r *totalReader) Read(b []byte) (int, error) {
+	n, err := r.rc.Read(b)
+	atomic.AddInt64(r.total, int64(n))
+	return n, err
+}
+
+func (r *totalReader) Close() error { return r.rc.Close() }
+
 // streamBlob streams the contents of the blob to the specified location.
 // On failure, this will return an error.  On success, this will return the location
 // header indicating how to commit the streamed blob.
@@ -346,8 +430,10 @@ func (w *writer) streamBlob(ctx context.Context, blob io.ReadCloser, streamLocat
 		var count int64
 		blob = &progressReader{rc: blob, updates: w.updates, lastUpdate: w.lastUpdate, count: &count}
 		reset = func() {
-			atomic.AddInt64(&w.lastUpdate.Complete, -count)
-			w.updates <- *w.lastUpdate
+			w.updates <- v1.Update{
+				Total:    atomic.LoadInt64(&w.lastUpdate.Total),
+				Complete: atomic.AddInt64(&w.lastUpdate.Complete, -count),
+			}
 		}
 	}
 
@@ -372,6 +458,137 @@ func (w *writer) streamBlob(ctx context.Context, blob io.ReadCloser, streamLocat
 	return w.nextLocation(resp)
 }
 
+// streamChunks uploads the contents of the blob to the specified location in
+// chunks of at most w.chunkSize bytes. Each chunk is retried independently,
+// resuming from the last offset acknowledged by the registry. On success, this
+// will return the location header indicating how to commit the streamed blob.
+func (w *writer) streamChunks(ctx context.Context, blob io.Reader, location string) (string, error) {
+	buf := make([]byte, w.chunkSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(blob, buf)
+		if err == io.EOF {
+			return location, nil
+		} else if err != nil && err != io.ErrUnexpectedEOF {
+			return "", err
+		}
+		start, end := offset, offset+int64(n)
+
+		tryChunk := func() error {
+			if offset == end {
+				// A previous attempt failed after the registry received everything.
+				return nil
+			}
+			loc, committed, err := w.patchChunk(ctx, location, buf[offset-start:n], offset)
+			if err != nil {
+				// Find out how much of this chunk the registry actually received
+				// so that the retry can pick up where it left off.
+				if loc, committed, serr := w.uploadStatus(ctx, location); serr == nil && committed >= start && committed <= end {
+					// Some registries report "0-0" for an upload that hasn't
+					// received anything yet, so don't trust it for a byte that
+					// was never acknowledged; resend the chunk instead.
+					if committed == 1 && offset == 0 {
+						committed = start
+					}
+					location, offset = loc, committed
+				}
+				return err
+			}
+			if committed <= offset || committed > end {
+				return fmt.Errorf("chunked upload: registry acknowledged offset %d, expected %d", committed, end)
+			}
+			location, offset = loc, committed
+			return nil
+		}
+		for offset < end {
+			before := offset
+			if err := retry.Retry(tryChunk, shouldRetry, backoff); err != nil {
+				return "", err
+			}
+			w.incrProgress(offset - before)
+		}
+
+		if n < len(buf) {
+			return location, nil
+		}
+	}
+}
+
+// patchChunk sends a single chunk of a blob, starting at offset, to the given
+// upload location. On success, it returns the location for the next request
+// and the offset up to which the registry has committed the blob.
+func (w *writer) patchChunk(ctx context.Context, location string, chunk []byte, offset int64) (string, int64, error) {
+	req, err := http.NewRequest(http.MethodPatch, location, bytes.NewReader(chunk))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Range", fmt.Sprintf("%d-%d", offset, offset+int64(len(chunk))-1))
+
+	resp, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	if err := transport.CheckError(resp, http.StatusNoContent, http.StatusAccepted); err != nil {
+		return "", 0, err
+	}
+	return w.nextCommitted(resp)
+}
+
+// uploadStatus queries the registry for the progress of an in-flight upload.
+func (w *writer) uploadStatus(ctx context.Context, location string) (string, int64, error) {
+	req, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		return "", 0, err
+	}
+
+	resp, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	if err := transport.CheckError(resp, http.StatusNoContent); err != nil {
+		return "", 0, err
+	}
+	return w.nextCommitted(resp)
+}
+
+// nextCommitted extracts the next upload location and the committed offset
+// (derived from the Range header) from a chunked upload response.
+func (w *writer) nextCommitted(resp *http.Response) (string, int64, error) {
+	loc, err := w.nextLocation(resp)
+	if err != nil {
+		return "", 0, err
+	}
+	committed, err := parseRange(resp.Header.Get("Range"))
+	if err != nil {
+		return "", 0, err
+	}
+	return loc, committed, nil
+}
+
+// parseRange parses a Range header of the form "0-<end>" (optionally prefixed
+// with "bytes="), returning the number of bytes the registry has received.
+// The range is inclusive, so "0-0" is the first byte. Without a Range header,
+// the registry hasn't received anything.
+func parseRange(header string) (int64, error) {
+	if header == "" {
+		return 0, nil
+	}
+	rng := strings.TrimPrefix(header, "bytes=")
+	var start, end int64
+	if _, err := fmt.Sscanf(rng, "%d-%d", &start, &end); err != nil {
+		return 0, fmt.Errorf("failed to parse Range header %q: %w", header, err)
+	}
+	if start != 0 || end < 0 {
+		return 0, fmt.Errorf("unexpected Range header %q: want range starting at 0", header)
+	}
+	return end + 1, nil
+}
+
 // commitBlob commits this blob by sending a PUT to the location returned from
 // streaming the blob.
 func (w *writer) commitBlob(location, digest string) error {
@@ -404,11 +621,24 @@ func (w *writer) incrProgress(written int64) {
 		return
 	}
 	w.updates <- v1.Update{
-		Total:    w.lastUpdate.Total,
+		Total:    atomic.LoadInt64(&w.lastUpdate.Total),
 		Complete: atomic.AddInt64(&w.lastUpdate.Complete, int64(written)),
 	}
 }
 
+// mountedProgress sends a progress update for the blob h of the given size,
+// which was mounted rather than uploaded, if WithProgress is used.
+func (w *writer) mountedProgress(h v1.Hash, size int64) {
+	if w.updates == nil {
+		return
+	}
+	w.updates <- v1.Update{
+		Total:    atomic.LoadInt64(&w.lastUpdate.Total),
+		Complete: atomic.AddInt64(&w.lastUpdate.Complete, size),
+		Mounted:  &h,
+	}
+}
+
 var shouldRetry retry.Predicate = func(err error) bool {
 	// Various failure modes here, as we're often reading from and writing to
 	// the network.
@@ -429,8 +659,10 @@ var backoff = retry.Backoff{
 
 // uploadOne performs a complete upload of a single layer.
 func (w *writer) uploadOne(l v1.Layer) error {
-	var from, mount string
+	var mount string
+	streaming := true
 	if h, err := l.Digest(); err == nil {
+		streaming = false
 		// If we know the digest, this isn't a streaming layer. Do an existence
 		// check so we can skip uploading the layer if possible.
 		existing, err := w.checkExistingBlob(h)
@@ -449,28 +681,25 @@ func (w *writer) uploadOne(l v1.Layer) error {
 
 		mount = h.String()
 	}
-	if ml, ok := l.(*MountableLayer); ok {
-		if w.repo.RegistryStr() == ml.Reference.Context().RegistryStr() {
-			from = ml.Reference.Context().RepositoryStr()
-		}
-	}
+	froms := w.mountSources(l)
 
 	ctx := w.context
 
 	tryUpload := func() error {
-		location, mounted, err := w.initiateUpload(from, mount)
+		location, mounted, chunked, err := w.mount(froms, mount)
 		if err != nil {
 			return err
 		} else if mounted {
-			size, err := l.Size()
+			h, err := l.Digest()
 			if err != nil {
 				return err
 			}
-			w.incrProgress(size)
-			h, err := l.Digest()
+			size, err := l.Size()
 			if err != nil {
 				return err
 			}
+			w.mountedProgress(h, size)
+			w.stats.countMounted()
 			logs.Progress.Printf("mounted blob: %s", h.String())
 			return nil
 		}
@@ -490,7 +719,17 @@ func (w *writer) uploadOne(l v1.Layer) error {
 		if err != nil {
 			return err
 		}
-		location, err = w.streamBlob(ctx, blob, location)
+		if streaming && w.updates != nil {
+			// We didn't know the size of this layer in advance, so grow the
+			// total as we go.
+			blob = &totalReader{rc: blob, total: &w.lastUpdate.Total}
+		}
+		if w.useChunks(l, chunked) {
+			location, err = w.streamChunks(ctx, blob, location)
+			blob.Close()
+		} else {
+			location, err = w.streamBlob(ctx, blob, location)
+		}
 		if err != nil {
 			return err
 		}
@@ -504,6 +743,7 @@ func (w *writer) uploadOne(l v1.Layer) error {
 		if err := w.commitBlob(location, digest); err != nil {
 			return err
 		}
+		w.stats.countUploaded()
 		logs.Progress.Printf("pushed blob: %s", digest)
 		return nil
 	}
@@ -511,6 +751,60 @@ func (w *writer) uploadOne(l v1.Layer) error {
 	return retry.Retry(tryUpload, shouldRetry, backoff)
 }
 
+// mountSources returns the repositories to try mounting l from: the source
+// of a MountableLayer, followed by those given to WithMountFrom. Blobs can
+// only be mounted from repositories on the same registry.
+func (w *writer) mountSources(l v1.Layer) []string {
+	var candidates []name.Repository
+	if ml, ok := asMountable(l); ok {
+		candidates = append(candidates, ml.Reference.Context())
+	}
+	candidates = append(candidates, w.mountFrom...)
+
+	seen := map[string]bool{w.repo.RepositoryStr(): true}
+	froms := []string{}
+	for _, repo := range candidates {
+		if repo.RegistryStr() != w.repo.RegistryStr() || seen[repo.RepositoryStr()] {
+			continue
+		}
+		seen[repo.RepositoryStr()] = true
+		froms = append(froms, repo.RepositoryStr())
+	}
+	return froms
+}
+
+// mount tries to mount the blob with the digest mount from each of froms in
+// order, falling back to initiating a regular upload, as initiate does.
+func (w *writer) mount(froms []string, mount string) (location string, mounted, chunked bool, err error) {
+	if mount == "" || len(froms) == 0 {
+		return w.initiate("", mount)
+	}
+	for i, from := range froms {
+		location, mounted, chunked, err = w.initiate(from, mount)
+		if err != nil || mounted || i == len(froms)-1 {
+			return location, mounted, chunked, err
+		}
+		// The registry initiated an upload instead, which we don't need if
+		// the next repository works out, so cancel it.
+		w.cancelUpload(location)
+	}
+	return location, mounted, chunked, err
+}
+
+// useChunks determines whether l should be uploaded in chunks, which requires
+// WithChunkSize, registry support, and a layer larger than the chunk size.
+// Streaming layers don't know their size up front, so are never chunked.
+func (w *writer) useChunks(l v1.Layer, chunked bool) bool {
+	if !chunked || w.chunkSize <= 0 {
+		return false
+	}
+	size, err := l.Size()
+	if err != nil {
+		return false
+	}
+	return size > w.chunkSize
+}
+
 type withLayer interface {
 	Layer(v1.Hash) (v1.Layer, error)
 }
@@ -526,52 +820,133 @@ func (w *writer) writeIndex(ref name.Reference, ii v1.ImageIndex, options ...Opt
 		return err
 	}
 
+	// Push every child, even if some fail, so that a retry only has to push
+	// the failed ones.
 	// TODO(#803): Pipe through remote.WithJobs and upload these in parallel.
+	var failed []ChildResult
 	for _, desc := range index.Manifests {
-		ref := ref.Context().Digest(desc.Digest.String())
-		exists, err := w.checkExistingManifest(desc.Digest, desc.MediaType)
+		state, err := w.writeChild(ref.Context().Digest(desc.Digest.String()), ii, desc, o, options...)
+		result := ChildResult{Descriptor: desc, State: state, Err: err}
 		if err != nil {
-			return err
+			result.State = ChildFailed
+			failed = append(failed, result)
 		}
-		if exists {
-			logs.Progress.Print("existing manifest: ", desc.Digest)
-			continue
+		if o.childResults != nil {
+			o.childResults(result)
 		}
+	}
+	if len(failed) != 0 {
+		return &IndexError{Ref: ref, Failed: failed}
+	}
 
-		switch desc.MediaType {
-		case types.OCIImageIndex, types.DockerManifestList:
-			ii, err := ii.ImageIndex(desc.Digest)
-			if err != nil {
-				return err
-			}
-			if err := w.writeIndex(ref, ii); err != nil {
-				return err
-			}
-		case types.OCIManifestSchema1, types.DockerManifestSchema2:
-			img, err := ii.Image(desc.Digest)
+	// With all of the constituent elements uploaded, upload the manifest
+	// to commit the image.
+	return w.commitManifest(ii, ref)
+}
+
+// writeChild pushes the child of ii described by desc, unless it exists.
+func (w *writer) writeChild(ref name.Digest, ii v1.ImageIndex, desc v1.Descriptor, o *options, options ...Option) (ChildState, error) {
+	exists, err := w.checkExistingManifest(desc.Digest, desc.MediaType)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		logs.Progress.Print("existing manifest: ", desc.Digest)
+		return ChildExisting, nil
+	}
+
+	switch desc.MediaType {
+	case types.OCIImageIndex, types.DockerManifestList:
+		ii, err := ii.ImageIndex(desc.Digest)
+		if err != nil {
+			return "", err
+		}
+		if err := w.writeIndex(ref, ii, options...); err != nil {
+			return "", err
+		}
+	case types.OCIManifestSchema1, types.DockerManifestSchema2:
+		img, err := ii.Image(desc.Digest)
+		if err != nil {
+			return "", err
+		}
+		stats := &blobStats{}
+		if err := writeImage(ref, img, o, w.lastUpdate, stats); err != nil {
+			return "", err
+		}
+		if stats.uploaded == 0 && stats.mounted != 0 {
+			return ChildMounted, nil
+		}
+	default:
+		// Workaround for #819.
+		if wl, ok := ii.(withLayer); ok {
+			layer, err := wl.Layer(desc.Digest)
 			if err != nil {
-				return err
+				return "", err
 			}
-			if err := writeImage(ref, img, o, w.lastUpdate); err != nil {
-				return err
-			}
-		default:
-			// Workaround for #819.
-			if wl, ok := ii.(withLayer); ok {
-				layer, err := wl.Layer(desc.Digest)
-				if err != nil {
-					return err
-				}
-				if err := w.uploadOne(layer); err != nil {
-					return err
-				}
+			if err := w.uploadOne(layer); err != nil {
+				return "", err
 			}
 		}
 	}
+	return ChildPushed, nil
+}
 
-	// With all of the constituent elements uploaded, upload the manifest
-	// to commit the image.
-	return w.commitManifest(ii, ref)
+// ChildState describes what WriteIndex did with a child of the index.
+type ChildState string
+
+const (
+	// ChildExisting means the child was already in the registry, so it was
+	// skipped.
+	ChildExisting ChildState = "existing"
+	// ChildPushed means the child was pushed.
+	ChildPushed ChildState = "pushed"
+	// ChildMounted means the child was pushed, but none of its blobs had to
+	// be uploaded, because they were mounted from other repositories.
+	ChildMounted ChildState = "mounted"
+	// ChildFailed means the child could not be pushed.
+	ChildFailed ChildState = "failed"
+)
+
+// ChildResult is the outcome of pushing one child of an index, see
+// WithChildResults.
+type ChildResult struct {
+	Descriptor v1.Descriptor
+	State      ChildState
+	// Err is set if State is ChildFailed.
+	Err error
+}
+
+// IndexError is returned by WriteIndex if some children of the index could
+// not be pushed. The index itself isn't pushed then, but the other children
+// are, so a retry only has to push the failed ones.
+type IndexError struct {
+	Ref    name.Reference
+	Failed []ChildResult
+}
+
+// Error implements error.
+func (e *IndexError) Error() string {
+	var children []string
+	for _, c := range e.Failed {
+		children = append(children, fmt.Sprintf("%s: %v", describeChild(c.Descriptor), c.Err))
+	}
+	return fmt.Sprintf("pushing %s: failed to push %d children: %s", e.Ref, len(e.Failed), strings.Join(children, "; "))
+}
+
+// describeChild identifies a child by its platform, if any, and digest.
+func describeChild(desc v1.Descriptor) string {
+	p := desc.Platform
+	if p == nil {
+		return desc.Digest.String()
+	}
+	platform := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		platform += "/" + p.Variant
+	}
+	if p.OSVersion != "" {
+		platform += ":" + p.OSVersion
+	}
+	return fmt.Sprintf("%s (%s)", platform, desc.Digest)
 }
 
 type withMediaType interface {
@@ -623,6 +998,11 @@ func (w *writer) commitManifest(t Taggable, ref name.Reference) error {
 		if err != nil {
 			return err
 		}
+		if w.strictContentType {
+			if detected := types.DetectManifest(raw); detected != "" && !sameManifestKind(desc.MediaType, detected) {
+				return fmt.Errorf("manifest for %s has media type %q, but is %s", ref, desc.MediaType, detected)
+			}
+		}
 
 		u := w.url(fmt.Sprintf("/v2/%s/manifests/%s", w.repo.RepositoryStr(), ref.Identifier()))
 
@@ -652,12 +1032,12 @@ func (w *writer) commitManifest(t Taggable, ref name.Reference) error {
 	return retry.Retry(tryUpload, shouldRetry, backoff)
 }
 
-func scopesForUploadingImage(repo name.Repository, layers []v1.Layer) []string {
+func scopesForUploadingImage(repo name.Repository, layers []v1.Layer, mountFrom ...name.Repository) []string {
 	// use a map as set to remove duplicates scope strings
 	scopeSet := map[string]struct{}{}
 
 	for _, l := range layers {
-		if ml, ok := l.(*MountableLayer); ok {
+		if ml, ok := asMountable(l); ok {
 			// we will add push scope for ref.Context() after the loop.
 			// for now we ask pull scope for references of the same registry
 			if ml.Reference.Context().String() != repo.String() && ml.Reference.Context().Registry.String() == repo.Registry.String() {
@@ -665,6 +1045,11 @@ func scopesForUploadingImage(repo name.Repository, layers []v1.Layer) []string {
 			}
 		}
 	}
+	for _, from := range mountFrom {
+		if from.String() != repo.String() && from.Registry.String() == repo.Registry.String() {
+			scopeSet[from.Scope(transport.PullScope)] = struct{}{}
+		}
+	}
 
 	scopes := make([]string, 0)
 	// Push scope should be the first element because a few registries just look at the first scope to determine access.
@@ -680,22 +1065,35 @@ func scopesForUploadingImage(repo name.Repository, layers []v1.Layer) []string {
 // WriteIndex pushes the provided ImageIndex to the specified image reference.
 // WriteIndex will attempt to push all of the referenced manifests before
 // attempting to push the ImageIndex, to retain referential integrity.
+//
+// Children that are already in the registry are skipped. If any child fails,
+// the others are still pushed, and an *IndexError listing the failed children
+// is returned, so that retrying the push is cheap. See WithChildResults to
+// follow the progress per child.
 func WriteIndex(ref name.Reference, ii v1.ImageIndex, options ...Option) (rerr error) {
 	o, err := makeOptions(ref.Context(), options...)
 	if err != nil {
 		return err
 	}
+	if o.platformFilter != nil {
+		if ii, err = filterPlatforms(ii, o.platformFilter); err != nil {
+			return err
+		}
+	}
 
-	scopes := []string{ref.Scope(transport.PushScope)}
-	tr, err := transport.NewWithContext(o.context, ref.Context().Registry, o.auth, o.transport, scopes)
+	scopes := scopesForUploadingImage(ref.Context(), nil, o.mountFrom...)
+	tr, err := o.newTransport(ref.Context().Registry, scopes)
 	if err != nil {
 		return err
 	}
 	w := writer{
-		repo:    ref.Context(),
-		client:  &http.Client{Transport: tr},
-		context: o.context,
-		updates: o.updates,
+		repo:              ref.Context(),
+		client:            &http.Client{Transport: tr},
+		context:           o.context,
+		updates:           o.updates,
+		chunkSize:         o.chunkSize,
+		mountFrom:         o.mountFrom,
+		strictContentType: o.strictContentType,
 	}
 
 	if o.updates != nil {
@@ -715,11 +1113,12 @@ func WriteIndex(ref name.Reference, ii v1.ImageIndex, options ...Option) (rerr e
 // an image. It de-dupes duplicate layers.
 func countImage(img v1.Image, allowNondistributableArtifacts bool) (int64, error) {
 	var total int64
-	ls, err := img.Layers()
+	ls, err := imageBlobs(img)
 	if err != nil {
 		return 0, err
 	}
 	seen := map[v1.Hash]bool{}
+	streaming := false
 	for _, l := range ls {
 		// Handle foreign layers.
 		mt, err := l.MediaType()
@@ -730,9 +1129,10 @@ func countImage(img v1.Image, allowNondistributableArtifacts bool) (int64, error
 			continue
 		}
 
-		// TODO: support streaming layers which update the total count as they write.
-		if _, ok := l.(*stream.Layer); ok {
-			return 0, errors.New("cannot use stream.Layer and WithProgress")
+		// Streaming layers are added to the total as they're uploaded.
+		if isStreaming(l) {
+			streaming = true
+			continue
 		}
 
 		// Dedupe layers.
@@ -751,6 +1151,11 @@ func countImage(img v1.Image, allowNondistributableArtifacts bool) (int64, error
 		}
 		total += size
 	}
+	if streaming {
+		// The config and manifest depend on the streaming layers, so they are
+		// counted by writeImage once those have been uploaded.
+		return total, nil
+	}
 	b, err := img.RawConfigFile()
 	if err != nil {
 		return 0, err
@@ -764,6 +1169,49 @@ func countImage(img v1.Image, allowNondistributableArtifacts bool) (int64, error
 	return total, nil
 }
 
+// imageBlobs returns the layers of img, plus any blobs that only the manifest
+// refers to, like the empty descriptor of an artifact without layers.
+func imageBlobs(img v1.Image) ([]v1.Layer, error) {
+	ls, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		// The manifest of an image with streaming layers isn't known until
+		// they are uploaded; any other error surfaces when committing it.
+		return ls, nil
+	}
+	if len(m.Layers) == len(ls) {
+		return ls, nil
+	}
+	seen := map[v1.Hash]bool{}
+	for _, l := range ls {
+		if d, err := l.Digest(); err == nil {
+			seen[d] = true
+		}
+	}
+	for _, desc := range m.Layers {
+		if seen[desc.Digest] {
+			continue
+		}
+		seen[desc.Digest] = true
+		l, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		ls = append(ls, l)
+	}
+	return ls, nil
+}
+
+// isStreaming returns true if l is a streaming layer that hasn't been
+// consumed yet, so its size isn't known.
+func isStreaming(l v1.Layer) bool {
+	_, err := l.Size()
+	return errors.Is(err, stream.ErrNotComputed)
+}
+
 // countIndex counts the total size of all images + sub-indexes for an index.
 // It does not attempt to de-dupe duplicate images, etc.
 func countIndex(idx v1.ImageIndex, allowNondistributableArtifacts bool) (int64, error) {
@@ -819,37 +1267,128 @@ func countIndex(idx v1.ImageIndex, allowNondistributableArtifacts bool) (int64,
 	return total, nil
 }
 
+// filterPlatforms removes the children of idx that don't match any of
+// platforms, see WithPlatformFilter.
+func filterPlatforms(idx v1.ImageIndex, platforms []v1.Platform) (v1.ImageIndex, error) {
+	matches := func(desc v1.Descriptor) bool {
+		if desc.Platform == nil {
+			return false
+		}
+		for _, p := range platforms {
+			if matchesPlatform(*desc.Platform, p) {
+				return true
+			}
+		}
+		return false
+	}
+
+	m, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	m = m.DeepCopy()
+	children := m.Manifests
+	m.Manifests = nil
+	for _, desc := range children {
+		if matches(desc) {
+			m.Manifests = append(m.Manifests, desc)
+		}
+	}
+	if len(m.Manifests) == 0 {
+		want := make([]string, 0, len(platforms))
+		for _, p := range platforms {
+			want = append(want, fmt.Sprintf("%s/%s", p.OS, p.Architecture))
+		}
+		return nil, fmt.Errorf("no child of index matches platforms %s", strings.Join(want, ", "))
+	}
+
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return &filteredIndex{
+		base:     idx,
+		manifest: m,
+		raw:      raw,
+	}, nil
+}
+
+// filteredIndex is a v1.ImageIndex with only some of the children of base,
+// see filterPlatforms.
+type filteredIndex struct {
+	base     v1.ImageIndex
+	manifest *v1.IndexManifest
+	raw      []byte
+}
+
+// MediaType implements v1.ImageIndex.
+func (i *filteredIndex) MediaType() (types.MediaType, error) {
+	return i.base.MediaType()
+}
+
+// IndexManifest implements v1.ImageIndex.
+func (i *filteredIndex) IndexManifest() (*v1.IndexManifest, error) {
+	return i.manifest.DeepCopy(), nil
+}
+
+// RawManifest implements v1.ImageIndex.
+func (i *filteredIndex) RawManifest() ([]byte, error) {
+	return i.raw, nil
+}
+
+// Digest implements v1.ImageIndex.
+func (i *filteredIndex) Digest() (v1.Hash, error) {
+	return partial.Digest(i)
+}
+
+// Size implements v1.ImageIndex.
+func (i *filteredIndex) Size() (int64, error) {
+	return partial.Size(i)
+}
+
+// Image implements v1.ImageIndex.
+func (i *filteredIndex) Image(h v1.Hash) (v1.Image, error) {
+	return i.base.Image(h)
+}
+
+// ImageIndex implements v1.ImageIndex.
+func (i *filteredIndex) ImageIndex(h v1.Hash) (v1.ImageIndex, error) {
+	return i.base.ImageIndex(h)
+}
+
 // WriteLayer uploads the provided Layer to the specified repo.
 func WriteLayer(repo name.Repository, layer v1.Layer, options ...Option) (rerr error) {
 	o, err := makeOptions(repo, options...)
 	if err != nil {
 		return err
 	}
-	scopes := scopesForUploadingImage(repo, []v1.Layer{layer})
-	tr, err := transport.NewWithContext(o.context, repo.Registry, o.auth, o.transport, scopes)
+	scopes := scopesForUploadingImage(repo, []v1.Layer{layer}, o.mountFrom...)
+	tr, err := o.newTransport(repo.Registry, scopes)
 	if err != nil {
 		return err
 	}
 	w := writer{
-		repo:    repo,
-		client:  &http.Client{Transport: tr},
-		context: o.context,
-		updates: o.updates,
+		repo:      repo,
+		client:    &http.Client{Transport: tr},
+		context:   o.context,
+		updates:   o.updates,
+		chunkSize: o.chunkSize,
+		mountFrom: o.mountFrom,
 	}
 
 	if o.updates != nil {
 		defer close(o.updates)
 		defer func() { sendError(o.updates, rerr) }()
 
-		// TODO: support streaming layers which update the total count as they write.
-		if _, ok := layer.(*stream.Layer); ok {
-			return errors.New("cannot use stream.Layer and WithProgress")
-		}
-		size, err := layer.Size()
-		if err != nil {
-			return err
+		// Streaming layers are added to the total as they're uploaded.
+		w.lastUpdate = &v1.Update{}
+		if !isStreaming(layer) {
+			size, err := layer.Size()
+			if err != nil {
+				return err
+			}
+			w.lastUpdate.Total = size
 		}
-		w.lastUpdate = &v1.Update{Total: size}
 	}
 	return w.uploadOne(layer)
 }
@@ -893,14 +1432,15 @@ func Put(ref name.Reference, t Taggable, options ...Option) error {
 	// * Allow callers to pass in a transport.Transport, typecheck
 	//   it to allow them to reuse the transport across multiple calls.
 	// * WithTag option to do multiple manifest PUTs in commitManifest.
-	tr, err := transport.NewWithContext(o.context, ref.Context().Registry, o.auth, o.transport, scopes)
+	tr, err := o.newTransport(ref.Context().Registry, scopes)
 	if err != nil {
 		return err
 	}
 	w := writer{
-		repo:    ref.Context(),
-		client:  &http.Client{Transport: tr},
-		context: o.context,
+		repo:              ref.Context(),
+		client:            &http.Client{Transport: tr},
+		context:           o.context,
+		strictContentType: o.strictContentType,
 	}
 
 	return w.commitManifest(t, ref)
@@ -20,6 +20,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -714,6 +715,149 @@ func TestUploadOne(t *testing.T) {
 	}
 }
 
+func TestUploadOneMountFrom(t *testing.T) {
+	img := setupImage(t)
+	h := mustConfigName(t, img)
+	expectedRepo := "baz/blah"
+	headPath := fmt.Sprintf("/v2/%s/blobs/%s", expectedRepo, h.String())
+	initiatePath := fmt.Sprintf("/v2/%s/blobs/uploads/", expectedRepo)
+	cancelPath := "/path/to/cancel"
+
+	var froms []string
+	cancelled := false
+	w, closer, err := setupWriter(expectedRepo, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case headPath:
+			http.Error(w, "NotFound", http.StatusNotFound)
+		case initiatePath:
+			if got, want := r.URL.Query().Get("mount"), h.String(); got != want {
+				t.Errorf("mount; got %v, want %v", got, want)
+			}
+			from := r.URL.Query().Get("from")
+			froms = append(froms, from)
+			if from == "second/repo" {
+				http.Error(w, "Mounted", http.StatusCreated)
+				return
+			}
+			w.Header().Set("Location", cancelPath)
+			http.Error(w, "Initiated", http.StatusAccepted)
+		case cancelPath:
+			if r.Method != http.MethodDelete {
+				t.Errorf("Method; got %v, want %v", r.Method, http.MethodDelete)
+			}
+			cancelled = true
+		default:
+			t.Fatalf("Unexpected path: %v", r.URL.Path)
+		}
+	}))
+	if err != nil {
+		t.Fatalf("setupWriter() = %v", err)
+	}
+	defer closer.Close()
+
+	mustRepo := func(s string) name.Repository {
+		repo, err := name.NewRepository(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	}
+	w.mountFrom = []name.Repository{
+		mustRepo("other.example.com/first/repo"),
+		mustRepo(w.repo.RegistryStr() + "/first/repo"),
+		w.repo,
+		mustRepo(w.repo.RegistryStr() + "/second/repo"),
+		mustRepo(w.repo.RegistryStr() + "/third/repo"),
+	}
+	updates := make(chan v1.Update, 10)
+	w.updates = updates
+	w.lastUpdate = &v1.Update{}
+
+	l, err := partial.ConfigLayer(img)
+	if err != nil {
+		t.Fatalf("ConfigLayer: %v", err)
+	}
+	if err := w.uploadOne(l); err != nil {
+		t.Fatalf("uploadOne() = %v", err)
+	}
+
+	// Other registries and the target repository are skipped, and we stop
+	// once the blob is mounted.
+	if diff := cmp.Diff([]string{"first/repo", "second/repo"}, froms); diff != "" {
+		t.Errorf("mount sources (-want +got) = %s", diff)
+	}
+	if !cancelled {
+		t.Error("unused upload was not cancelled")
+	}
+	close(updates)
+	update := <-updates
+	if update.Mounted == nil || *update.Mounted != h {
+		t.Errorf("Update.Mounted = %v, want %v", update.Mounted, h)
+	}
+}
+
+func TestUploadOneMountFromFallback(t *testing.T) {
+	img := setupImage(t)
+	h := mustConfigName(t, img)
+	expectedRepo := "baz/blah"
+	headPath := fmt.Sprintf("/v2/%s/blobs/%s", expectedRepo, h.String())
+	initiatePath := fmt.Sprintf("/v2/%s/blobs/uploads/", expectedRepo)
+	cancelPath := "/path/to/cancel"
+	streamPath := "/path/to/upload"
+	commitPath := "/path/to/commit"
+
+	uploaded := false
+	w, closer, err := setupWriter(expectedRepo, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case headPath:
+			http.Error(w, "NotFound", http.StatusNotFound)
+		case initiatePath:
+			// Neither repository has the blob, so upload to the last session.
+			if r.URL.Query().Get("from") == "first/repo" {
+				w.Header().Set("Location", cancelPath)
+			} else {
+				w.Header().Set("Location", streamPath)
+			}
+			http.Error(w, "Initiated", http.StatusAccepted)
+		case cancelPath:
+		case streamPath:
+			if r.Method != http.MethodPatch {
+				t.Errorf("Method; got %v, want %v", r.Method, http.MethodPatch)
+			}
+			w.Header().Set("Location", commitPath)
+			http.Error(w, "Initiated", http.StatusAccepted)
+		case commitPath:
+			uploaded = true
+			http.Error(w, "Created", http.StatusCreated)
+		default:
+			t.Fatalf("Unexpected path: %v", r.URL.Path)
+		}
+	}))
+	if err != nil {
+		t.Fatalf("setupWriter() = %v", err)
+	}
+	defer closer.Close()
+
+	for _, s := range []string{"first/repo", "second/repo"} {
+		repo, err := name.NewRepository(w.repo.RegistryStr() + "/" + s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.mountFrom = append(w.mountFrom, repo)
+	}
+
+	l, err := partial.ConfigLayer(img)
+	if err != nil {
+		t.Fatalf("ConfigLayer: %v", err)
+	}
+	if err := w.uploadOne(l); err != nil {
+		t.Fatalf("uploadOne() = %v", err)
+	}
+	if !uploaded {
+		t.Error("blob was not uploaded")
+	}
+}
+
 func TestUploadOneStreamedLayer(t *testing.T) {
 	expectedRepo := "baz/blah"
 	initiatePath := fmt.Sprintf("/v2/%s/blobs/uploads/", expectedRepo)
@@ -927,6 +1071,201 @@ func TestWriteWithErrors(t *testing.T) {
 	}
 }
 
+// zeroRangeWriter reports "0-0" in upload status responses for uploads that
+// haven't received anything yet, as some registries do.
+type zeroRangeWriter struct {
+	http.ResponseWriter
+	r *http.Request
+}
+
+func (w *zeroRangeWriter) WriteHeader(code int) {
+	if w.r.Method == http.MethodGet && w.Header().Get("Range") == "" {
+		w.Header().Set("Range", "0-0")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func TestWriteChunked(t *testing.T) {
+	img, err := random.Image(10000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ls, err := img.Layers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := ls[0].Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chunkSize int64 = 1024
+
+	for _, tc := range []struct {
+		desc string
+		// fail is the number of the chunked PATCH request to fail.
+		fail int32
+		// keep is the number of bytes of the failed chunk that the registry
+		// sees before the request fails.
+		keep int64
+		// zeroRange reports an empty upload's status as "0-0".
+		zeroRange bool
+	}{{
+		desc: "second chunk fails midway",
+		fail: 2,
+		keep: chunkSize / 2,
+	}, {
+		desc: "first chunk fails",
+		fail: 1,
+	}, {
+		desc:      "first chunk fails with zero range status",
+		fail:      1,
+		zeroRange: true,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			reg := registry.New()
+			var patches int32
+			var received int64
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.zeroRange {
+					w = &zeroRangeWriter{w, r}
+				}
+				cr := r.Header.Get("Content-Range")
+				if r.Method != http.MethodPatch || cr == "" {
+					reg.ServeHTTP(w, r)
+					return
+				}
+				b, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					t.Errorf("ReadAll(Body) = %v", err)
+				}
+				atomic.AddInt64(&received, int64(len(b)))
+				r.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+				if atomic.AddInt32(&patches, 1) != tc.fail {
+					reg.ServeHTTP(w, r)
+					return
+				}
+
+				// Let the registry see only the start of the chunk, then fail the
+				// request as though the connection dropped mid-stream.
+				if tc.keep > 0 {
+					var start int64
+					if _, err := fmt.Sscanf(cr, "%d-", &start); err != nil {
+						t.Errorf("Sscanf(%q) = %v", cr, err)
+					}
+					kept := b[:tc.keep]
+					r.Body = ioutil.NopCloser(bytes.NewReader(kept))
+					r.ContentLength = int64(len(kept))
+					r.Header.Set("Content-Range", fmt.Sprintf("%d-%d", start, start+int64(len(kept))-1))
+					reg.ServeHTTP(httptest.NewRecorder(), r)
+				}
+				http.Error(w, "connection reset", http.StatusInternalServerError)
+			}))
+			defer s.Close()
+			u, err := url.Parse(s.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tag, err := name.NewTag(fmt.Sprintf("%s/%s:latest", u.Host, "write/chunked"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := Write(tag, img, WithChunkSize(chunkSize)); err != nil {
+				t.Fatalf("Write() = %v", err)
+			}
+
+			// Only the unacknowledged part of the failed chunk should be resent.
+			if want := size + chunkSize - tc.keep; received != want {
+				t.Errorf("registry received %d chunked bytes, want %d", received, want)
+			}
+
+			got, err := Image(tag)
+			if err != nil {
+				t.Fatalf("Image() = %v", err)
+			}
+			if err := validate.Image(got); err != nil {
+				t.Errorf("validate.Image() = %v", err)
+			}
+		})
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		want   int64
+	}{
+		{"", 0},
+		{"0-0", 1},
+		{"bytes=0-0", 1},
+		{"0-1023", 1024},
+	} {
+		got, err := parseRange(tc.header)
+		if err != nil {
+			t.Errorf("parseRange(%q) = %v", tc.header, err)
+		} else if got != tc.want {
+			t.Errorf("parseRange(%q) = %d, want %d", tc.header, got, tc.want)
+		}
+	}
+
+	for _, header := range []string{"junk", "1-10", "0--1"} {
+		if _, err := parseRange(header); err == nil {
+			t.Errorf("parseRange(%q) = nil, want error", header)
+		}
+	}
+}
+
+// noRangeWriter hides the headers advertising chunked uploads in responses to
+// initiate an upload, to simulate registries that don't support them.
+type noRangeWriter struct {
+	http.ResponseWriter
+	r *http.Request
+}
+
+func (w *noRangeWriter) WriteHeader(code int) {
+	if w.r.Method == http.MethodPost {
+		w.Header().Del("Range")
+		w.Header().Del("OCI-Chunk-Min-Length")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func TestWriteChunkedFallback(t *testing.T) {
+	img, err := random.Image(10000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPatch && r.Header.Get("Content-Range") != "" {
+			t.Errorf("unexpected chunked PATCH: %s", r.Header.Get("Content-Range"))
+		}
+		reg.ServeHTTP(&noRangeWriter{w, r}, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := name.NewTag(fmt.Sprintf("%s/%s:latest", u.Host, "write/monolithic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Write(tag, img, WithChunkSize(1024)); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	got, err := Image(tag)
+	if err != nil {
+		t.Fatalf("Image() = %v", err)
+	}
+	if err := validate.Image(got); err != nil {
+		t.Errorf("validate.Image() = %v", err)
+	}
+}
+
 func TestDockerhubScopes(t *testing.T) {
 	src, err := name.ParseReference("busybox")
 	if err != nil {
@@ -1131,6 +1470,26 @@ func TestScopesForUploadingImage(t *testing.T) {
 	}
 }
 
+func TestScopesForMountFrom(t *testing.T) {
+	repo, err := name.NewRepository("example.com/sample/sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mountFrom []name.Repository
+	for _, s := range []string{"example.com/sample/sample", "example.com/sample/other", "other.example.com/sample/other"} {
+		from, err := name.NewRepository(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mountFrom = append(mountFrom, from)
+	}
+
+	want := []string{repo.Scope(transport.PushScope), mountFrom[1].Scope(transport.PullScope)}
+	if diff := cmp.Diff(want, scopesForUploadingImage(repo, nil, mountFrom...)); diff != "" {
+		t.Errorf("scopesForUploadingImage() (-want +got) = %s", diff)
+	}
+}
+
 func TestCheckExistingManifest(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -1286,6 +1645,110 @@ func (l *fakeForeignLayer) Uncompressed() (io.ReadCloser, error) {
 	return nil, nil
 }
 
+// baseIndex is embedded by annotatedIndex, where v1.ImageIndex would clash
+// with its ImageIndex method.
+type baseIndex = v1.ImageIndex
+
+// annotatedIndex sets annotations on the manifest of an index.
+type annotatedIndex struct {
+	baseIndex
+	annotations map[string]string
+}
+
+func (i *annotatedIndex) IndexManifest() (*v1.IndexManifest, error) {
+	m, err := i.baseIndex.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	m = m.DeepCopy()
+	m.Annotations = i.annotations
+	return m, nil
+}
+
+func (i *annotatedIndex) RawManifest() ([]byte, error) {
+	m, err := i.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+func (i *annotatedIndex) Digest() (v1.Hash, error) { return partial.Digest(i) }
+func (i *annotatedIndex) Size() (int64, error)     { return partial.Size(i) }
+
+func TestWriteIndexPlatformFilter(t *testing.T) {
+	var adds []mutate.IndexAddendum
+	for _, p := range []v1.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		{OS: "linux", Architecture: "s390x"},
+	} {
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := p
+		adds = append(adds, mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: &p}})
+	}
+	annotations := map[string]string{"foo": "bar"}
+	base := mutate.IndexMediaType(empty.Index, types.DockerManifestList)
+	idx := &annotatedIndex{baseIndex: mutate.AppendManifests(base, adds...), annotations: annotations}
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(u.Host + "/filtered")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter := []v1.Platform{{OS: "linux", Architecture: "amd64"}, {OS: "linux", Architecture: "arm64"}}
+	if err := WriteIndex(ref, idx, WithPlatformFilter(filter)); err != nil {
+		t.Fatalf("WriteIndex() = %v", err)
+	}
+
+	got, err := Index(ref)
+	if err != nil {
+		t.Fatalf("Index() = %v", err)
+	}
+	if err := validate.Index(got); err != nil {
+		t.Errorf("validate.Index() = %v", err)
+	}
+	mt, err := got.MediaType()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mt != types.DockerManifestList {
+		t.Errorf("MediaType() = %s, want %s", mt, types.DockerManifestList)
+	}
+	m, err := got.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(annotations, m.Annotations); diff != "" {
+		t.Errorf("Annotations (-want +got) = %s", diff)
+	}
+	var archs []string
+	for _, desc := range m.Manifests {
+		archs = append(archs, desc.Platform.Architecture)
+	}
+	if diff := cmp.Diff([]string{"amd64", "arm64"}, archs); diff != "" {
+		t.Errorf("filtered platforms (-want +got) = %s", diff)
+	}
+
+	// Matching nothing is an error.
+	err = WriteIndex(ref, idx, WithPlatformFilter([]v1.Platform{{OS: "windows", Architecture: "amd64"}}))
+	if err == nil || !strings.Contains(err.Error(), "windows/amd64") {
+		t.Errorf("WriteIndex(windows/amd64) = %v, want error naming the platform", err)
+	}
+	if err := WriteIndex(ref, idx, WithPlatformFilter(nil)); err == nil {
+		t.Error("WriteIndex(WithPlatformFilter(nil)) = nil, want error")
+	}
+}
+
 func TestSkipForeignLayersByDefault(t *testing.T) {
 	// Set up an image with a foreign layer.
 	base := setupImage(t)
@@ -1384,6 +1847,104 @@ func TestWriteForeignLayerIfOptionSet(t *testing.T) {
 	}
 }
 
+func TestWriteDistributable(t *testing.T) {
+	base, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fl, err := random.Layer(1024, types.DockerLayer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.Append(base, mutate.Addendum{
+		Layer:     fl,
+		MediaType: types.DockerForeignLayer,
+		URLs:      []string{"https://mcr.microsoft.com/layer"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	platform := v1.Platform{OS: "windows", Architecture: "amd64"}
+	idx := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+		Add:        img,
+		Descriptor: v1.Descriptor{Platform: &platform},
+	})
+	want, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dimg, err := mutate.Distributable(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	didx, err := mutate.IndexDistributable(idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		write func(ref name.Reference) error
+	}{{
+		name: "Write",
+		write: func(ref name.Reference) error {
+			return Write(ref, dimg, WithNondistributable)
+		},
+	}, {
+		name: "WriteIndex",
+		write: func(ref name.Reference) error {
+			return WriteIndex(ref, didx, WithNondistributable)
+		},
+	}, {
+		name: "MultiWrite",
+		write: func(ref name.Reference) error {
+			return MultiWrite(map[name.Reference]Taggable{ref: didx}, WithNondistributable)
+		},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			ref := mustNewTag(t, fmt.Sprintf("%s/test/%s:latest", u.Host, strings.ToLower(tc.name)))
+			if err := tc.write(ref); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+
+			pulled, err := Image(ref, WithPlatform(platform))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Pulling all the layers from the registry only works if the
+			// foreign layer was uploaded.
+			if err := validate.Image(pulled); err != nil {
+				t.Fatalf("validate.Image() = %v", err)
+			}
+			got, err := pulled.Manifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Layers) != len(want.Layers) {
+				t.Fatalf("got %d layers, want %d", len(got.Layers), len(want.Layers))
+			}
+			for i, l := range got.Layers {
+				if l.Digest != want.Layers[i].Digest {
+					t.Errorf("layer %d digest = %s, want %s", i, l.Digest, want.Layers[i].Digest)
+				}
+				if l.MediaType != types.DockerLayer {
+					t.Errorf("layer %d media type = %s, want %s", i, l.MediaType, types.DockerLayer)
+				}
+				if len(l.URLs) != 0 {
+					t.Errorf("layer %d urls = %v, want none", i, l.URLs)
+				}
+			}
+		})
+	}
+}
+
 func TestTag(t *testing.T) {
 	idx := setupIndex(t, 3)
 	// Set up a fake registry.
@@ -1556,3 +2117,252 @@ func BenchmarkWrite(b *testing.B) {
 		}
 	}
 }
+
+func TestWriteArtifact(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(u.Host + "/artifact")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	artifact := mutate.ArtifactType(base, "application/vnd.example+type")
+	if err := Write(ref, artifact); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+
+	got, err := Image(ref)
+	if err != nil {
+		t.Fatalf("Image() = %v", err)
+	}
+	if want, got := mustDigest(t, artifact), mustDigest(t, got); want != got {
+		t.Errorf("Digest() = %s, want %s", got, want)
+	}
+	m, err := got.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.ArtifactType != "application/vnd.example+type" {
+		t.Errorf("ArtifactType = %q, want %q", m.ArtifactType, "application/vnd.example+type")
+	}
+	if len(m.Layers) != 1 {
+		t.Fatalf("len(Layers) = %d, want the empty descriptor", len(m.Layers))
+	}
+	if _, err := Layer(ref.Context().Digest(m.Layers[0].Digest.String())); err != nil {
+		t.Errorf("Layer(empty descriptor) = %v", err)
+	}
+
+	// Copying the artifact keeps it intact.
+	dst, err := name.ParseReference(u.Host + "/copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(dst, got); err != nil {
+		t.Fatalf("Write(copy) = %v", err)
+	}
+	cp, err := Image(dst)
+	if err != nil {
+		t.Fatalf("Image(copy) = %v", err)
+	}
+	if want, got := mustDigest(t, artifact), mustDigest(t, cp); want != got {
+		t.Errorf("Digest(copy) = %s, want %s", got, want)
+	}
+}
+
+func TestWriteEmptyConfig(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(u.Host + "/artifact")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := mutate.ConfigMediaType(mutate.MediaType(empty.Image, types.OCIManifestSchema1), types.OCIEmptyJSON)
+	artifact := mutate.ArtifactType(base, "application/vnd.example+type")
+	if err := Write(ref, artifact); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+
+	got, err := Image(ref)
+	if err != nil {
+		t.Fatalf("Image() = %v", err)
+	}
+	if want, got := mustDigest(t, artifact), mustDigest(t, got); want != got {
+		t.Errorf("Digest() = %s, want %s", got, want)
+	}
+	m, err := got.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(empty.Descriptor, m.Config); diff != "" {
+		t.Errorf("Config (-want +got) = %s", diff)
+	}
+	b, err := got.RawConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != empty.JSON {
+		t.Errorf("RawConfigFile() = %q, want %q", b, empty.JSON)
+	}
+
+	// Copying the artifact keeps it intact.
+	dst, err := name.ParseReference(u.Host + "/copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(dst, got); err != nil {
+		t.Fatalf("Write(copy) = %v", err)
+	}
+	cp, err := Image(dst)
+	if err != nil {
+		t.Fatalf("Image(copy) = %v", err)
+	}
+	if want, got := mustDigest(t, artifact), mustDigest(t, cp); want != got {
+		t.Errorf("Digest(copy) = %s, want %s", got, want)
+	}
+}
+
+func TestWriteIndexChildResults(t *testing.T) {
+	var adds []mutate.IndexAddendum
+	for _, arch := range []string{"amd64", "arm64", "s390x"} {
+		img, err := random.Image(1024, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		adds = append(adds, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: arch}},
+		})
+	}
+	idx := mutate.AppendManifests(empty.Index, adds...)
+	children := mustIndexManifest(t, idx).Manifests
+
+	// Fail to push the arm64 child until it is fixed.
+	var fixed int32
+	failPath := "/v2/repo/manifests/" + children[1].Digest.String()
+	reg := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Path == failPath && atomic.LoadInt32(&fixed) == 0 {
+			http.Error(w, "nope", http.StatusForbidden)
+			return
+		}
+		// Pretend that blobs can be mounted into the "mounted" repo.
+		if strings.HasPrefix(r.URL.Path, "/v2/mounted/blobs/") {
+			if r.Method == http.MethodHead {
+				http.NotFound(w, r)
+				return
+			}
+			if r.Method == http.MethodPost && r.URL.Query().Get("mount") != "" {
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(repo string, options ...Option) (map[v1.Hash]ChildState, error) {
+		t.Helper()
+		ref, err := name.ParseReference(u.Host + "/" + repo + ":latest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[v1.Hash]ChildState{}
+		options = append(options, WithChildResults(func(r ChildResult) {
+			if (r.State == ChildFailed) != (r.Err != nil) {
+				t.Errorf("%s: State = %s, but Err = %v", r.Descriptor.Digest, r.State, r.Err)
+			}
+			got[r.Descriptor.Digest] = r.State
+		}))
+		return got, WriteIndex(ref, idx, options...)
+	}
+
+	got, err := write("repo")
+	var ierr *IndexError
+	if !errors.As(err, &ierr) {
+		t.Fatalf("WriteIndex() = %v, want *IndexError", err)
+	}
+	if len(ierr.Failed) != 1 || ierr.Failed[0].Descriptor.Digest != children[1].Digest {
+		t.Errorf("IndexError.Failed = %v, want only %s", ierr.Failed, children[1].Digest)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "linux/arm64 ("+children[1].Digest.String()+")") {
+		t.Errorf("Error() = %q, want it to name the failed child", msg)
+	}
+	want := map[v1.Hash]ChildState{
+		children[0].Digest: ChildPushed,
+		children[1].Digest: ChildFailed,
+		children[2].Digest: ChildPushed,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("results (-want +got) = %s", diff)
+	}
+
+	// Retrying only pushes the failed child.
+	atomic.StoreInt32(&fixed, 1)
+	got, err = write("repo")
+	if err != nil {
+		t.Fatalf("WriteIndex() = %v", err)
+	}
+	want = map[v1.Hash]ChildState{
+		children[0].Digest: ChildExisting,
+		children[1].Digest: ChildPushed,
+		children[2].Digest: ChildExisting,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("results (-want +got) = %s", diff)
+	}
+
+	from, err := name.NewRepository(u.Host + "/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = write("mounted", WithMountFrom([]name.Repository{from}))
+	if err != nil {
+		t.Fatalf("WriteIndex() = %v", err)
+	}
+	for _, c := range children {
+		if got[c.Digest] != ChildMounted {
+			t.Errorf("%s: State = %s, want %s", c.Digest, got[c.Digest], ChildMounted)
+		}
+	}
+}
+
+func TestPutStrictContentType(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := mustNewTag(t, fmt.Sprintf("%s/foo/bar:latest", u.Host))
+
+	index := map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     types.OCIImageIndex,
+		"manifests":     []interface{}{},
+	}
+	mislabeled := &rawManifest{mediaType: types.DockerManifestSchema2, manifest: index}
+	if err := Put(ref, mislabeled, WithStrictContentType); err == nil {
+		t.Error("Put() with mislabeled manifest = nil, wanted error")
+	}
+	if err := Put(ref, mislabeled); err != nil {
+		t.Errorf("Put() without WithStrictContentType = %v", err)
+	}
+	labeled := &rawManifest{mediaType: types.OCIImageIndex, manifest: index}
+	if err := Put(ref, labeled, WithStrictContentType); err != nil {
+		t.Errorf("Put() = %v", err)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"hash"
 	"io"
 	"os"
@@ -37,6 +38,10 @@ var (
 	// ErrConsumed is returned by Compressed when the underlying stream has
 	// already been consumed and closed.
 	ErrConsumed = errors.New("stream was already consumed")
+
+	// errClosedEarly stops the compressing goroutine when the consumer
+	// closes the stream before reading all of it.
+	errClosedEarly = errors.New("stream closed before it was consumed")
 )
 
 // Layer is a streaming implementation of v1.Layer.
@@ -44,6 +49,7 @@ type Layer struct {
 	blob        io.ReadCloser
 	consumed    bool
 	compression int
+	expected    *v1.Hash
 
 	mu             sync.Mutex
 	digest, diffID *v1.Hash
@@ -62,6 +68,16 @@ func WithCompressionLevel(level int) LayerOption {
 	}
 }
 
+// WithExpectedDigest makes the layer verify that the digest of its compressed
+// stream matches h. If it doesn't, the final Read of the stream returns an
+// error, as does Close. Closing the stream before it has been read completely
+// also returns an error, since the digest can't be verified.
+func WithExpectedDigest(h v1.Hash) LayerOption {
+	return func(l *Layer) {
+		l.expected = &h
+	}
+}
+
 // NewLayer creates a Layer from an io.ReadCloser.
 func NewLayer(rc io.ReadCloser, opts ...LayerOption) *Layer {
 	layer := &Layer{
@@ -130,11 +146,14 @@ type compressedReader struct {
 	closer io.Closer // original blob's Closer.
 
 	h, zh hash.Hash // collects digests of compressed and uncompressed stream.
-	pr    io.Reader
+	pr    *io.PipeReader
 	bw    *bufio.Writer
 	count *countWriter
 
 	l *Layer // stream.Layer to update upon Close.
+
+	done chan struct{} // closed when the goroutine has finished.
+	err  error         // the goroutine's result, set before done is closed.
 }
 
 func newCompressedReader(l *Layer) (*compressedReader, error) {
@@ -166,17 +185,22 @@ func newCompressedReader(l *Layer) (*compressedReader, error) {
 		zh:     zh,
 		count:  count,
 		l:      l,
+		done:   make(chan struct{}),
 	}
 	go func() {
+		defer close(cr.done)
 		if _, err := io.Copy(io.MultiWriter(h, zw), l.blob); err != nil {
+			cr.closer.Close()
+			cr.err = err
 			pw.CloseWithError(err)
 			return
 		}
-		// Now close the compressed reader, to flush the gzip stream
+		// Now finish the compressed reader, to flush the gzip stream
 		// and calculate digest/diffID/size. This will cause pr to
-		// return EOF which will cause readers of the Compressed stream
-		// to finish reading.
-		pw.CloseWithError(cr.Close())
+		// return EOF (or a verification error) which will cause
+		// readers of the Compressed stream to finish reading.
+		cr.err = cr.finish()
+		pw.CloseWithError(cr.err)
 	}()
 
 	return cr, nil
@@ -184,7 +208,35 @@ func newCompressedReader(l *Layer) (*compressedReader, error) {
 
 func (cr *compressedReader) Read(b []byte) (int, error) { return cr.pr.Read(b) }
 
+// Close waits for the stream to be finished, stopping it if it hasn't been
+// read completely, and returns any error encountered while producing it.
 func (cr *compressedReader) Close() error {
+	select {
+	case <-cr.done:
+	default:
+		// The consumer stopped reading early, so unblock the goroutine
+		// and wait for it to give up.
+		cr.pr.CloseWithError(errClosedEarly)
+		cr.l.blob.Close()
+		<-cr.done
+	}
+
+	cr.l.mu.Lock()
+	cr.l.consumed = true
+	cr.l.mu.Unlock()
+
+	if errors.Is(cr.err, errClosedEarly) || errors.Is(cr.err, os.ErrClosed) {
+		if cr.l.expected != nil {
+			return fmt.Errorf("stream closed before its digest could be verified against %s", *cr.l.expected)
+		}
+		return nil
+	}
+	return cr.err
+}
+
+// finish flushes the compressed stream once the blob has been read
+// completely, and records the digest, diffID and size on the layer.
+func (cr *compressedReader) finish() error {
 	cr.l.mu.Lock()
 	defer cr.l.mu.Unlock()
 
@@ -202,14 +254,17 @@ func (cr *compressedReader) Close() error {
 	if err != nil {
 		return err
 	}
-	cr.l.diffID = &diffID
 
 	digest, err := v1.NewHash("sha256:" + hex.EncodeToString(cr.zh.Sum(nil)))
 	if err != nil {
 		return err
 	}
-	cr.l.digest = &digest
+	if cr.l.expected != nil && digest != *cr.l.expected {
+		return fmt.Errorf("stream digest %s does not match expected digest %s", digest, *cr.l.expected)
+	}
 
+	cr.l.diffID = &diffID
+	cr.l.digest = &digest
 	cr.l.size = cr.count.n
 	cr.l.consumed = true
 	return nil
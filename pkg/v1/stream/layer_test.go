@@ -234,3 +234,92 @@ func TestMediaType(t *testing.T) {
 		t.Errorf("MediaType(): want %q, got %q", want, got)
 	}
 }
+
+func TestExpectedDigest(t *testing.T) {
+	want := NewLayer(ioutil.NopCloser(strings.NewReader("hello")))
+	rc, err := want.Compressed()
+	if err != nil {
+		t.Fatalf("Compressed: %v", err)
+	}
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	h, err := want.Digest()
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+	wrong, _, err := v1.SHA256(strings.NewReader("goodbye"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("match", func(t *testing.T) {
+		l := NewLayer(ioutil.NopCloser(strings.NewReader("hello")), WithExpectedDigest(h))
+		rc, err := l.Compressed()
+		if err != nil {
+			t.Fatalf("Compressed: %v", err)
+		}
+		if _, err := io.Copy(ioutil.Discard, rc); err != nil {
+			t.Errorf("Read: %v", err)
+		}
+		if err := rc.Close(); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+		if got, err := l.Digest(); err != nil || got != h {
+			t.Errorf("Digest() = %v, %v, want %v", got, err, h)
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		l := NewLayer(ioutil.NopCloser(strings.NewReader("hello")), WithExpectedDigest(wrong))
+		rc, err := l.Compressed()
+		if err != nil {
+			t.Fatalf("Compressed: %v", err)
+		}
+		if _, err := io.Copy(ioutil.Discard, rc); err == nil {
+			t.Error("Read: wanted error")
+		}
+		if err := rc.Close(); err == nil {
+			t.Error("Close: wanted error")
+		}
+		if _, err := l.Digest(); err != ErrNotComputed {
+			t.Errorf("Digest: got %v, want %v", err, ErrNotComputed)
+		}
+	})
+
+	t.Run("mismatch without final read", func(t *testing.T) {
+		l := NewLayer(ioutil.NopCloser(strings.NewReader("hello")), WithExpectedDigest(wrong))
+		rc, err := l.Compressed()
+		if err != nil {
+			t.Fatalf("Compressed: %v", err)
+		}
+		// Read exactly the compressed bytes, but not the EOF.
+		if _, err := io.ReadFull(rc, make([]byte, len(b))); err != nil {
+			t.Fatalf("ReadFull: %v", err)
+		}
+		if err := rc.Close(); err == nil {
+			t.Error("Close: wanted error")
+		}
+	})
+
+	t.Run("closed early", func(t *testing.T) {
+		l := NewLayer(ioutil.NopCloser(strings.NewReader("hello")), WithExpectedDigest(h))
+		rc, err := l.Compressed()
+		if err != nil {
+			t.Fatalf("Compressed: %v", err)
+		}
+		if _, err := rc.Read(make([]byte, 1)); err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		if err := rc.Close(); err == nil {
+			t.Error("Close: wanted error")
+		}
+		if _, err := l.Compressed(); err != ErrConsumed {
+			t.Errorf("Compressed() after closing; got %v, want %v", err, ErrConsumed)
+		}
+	})
+}
@@ -15,7 +15,6 @@
 package tarball
 
 import (
-	"archive/tar"
 	"bytes"
 	"encoding/json"
 	"errors"
@@ -23,11 +22,11 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"path"
-	"path/filepath"
 	"sync"
 
-	"github.com/google/go-containerregistry/internal/gzip"
+	icompression "github.com/google/go-containerregistry/internal/compression"
+	"github.com/google/go-containerregistry/internal/tarfile"
+	"github.com/google/go-containerregistry/pkg/compression"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
@@ -72,7 +71,7 @@ func ImageFromPath(path string, tag *name.Tag) (v1.Image, error) {
 
 // LoadManifest load manifest
 func LoadManifest(opener Opener) (Manifest, error) {
-	m, err := extractFileFromTar(opener, "manifest.json")
+	m, err := tarfile.Open(opener, "manifest.json")
 	if err != nil {
 		return nil, err
 	}
@@ -161,16 +160,20 @@ func (i *image) areLayersCompressed() (bool, error) {
 		return false, errors.New("0 layers found in image")
 	}
 	layer := i.imgDescriptor.Layers[0]
-	blob, err := extractFileFromTar(i.opener, layer)
+	blob, err := tarfile.Open(i.opener, layer)
 	if err != nil {
 		return false, err
 	}
 	defer blob.Close()
-	return gzip.Is(blob)
+	comp, err := icompression.Peek(blob)
+	if err != nil {
+		return false, err
+	}
+	return comp != compression.None, nil
 }
 
 func (i *image) loadTarDescriptorAndConfig() error {
-	m, err := extractFileFromTar(i.opener, "manifest.json")
+	m, err := tarfile.Open(i.opener, "manifest.json")
 	if err != nil {
 		return err
 	}
@@ -189,7 +192,7 @@ func (i *image) loadTarDescriptorAndConfig() error {
 		return err
 	}
 
-	cfg, err := extractFileFromTar(i.opener, i.imgDescriptor.Config)
+	cfg, err := tarfile.Open(i.opener, i.imgDescriptor.Config)
 	if err != nil {
 		return err
 	}
@@ -206,48 +209,6 @@ func (i *image) RawConfigFile() ([]byte, error) {
 	return i.config, nil
 }
 
-// tarFile represents a single file inside a tar. Closing it closes the tar itself.
-type tarFile struct {
-	io.Reader
-	io.Closer
-}
-
-func extractFileFromTar(opener Opener, filePath string) (io.ReadCloser, error) {
-	f, err := opener()
-	if err != nil {
-		return nil, err
-	}
-	close := true
-	defer func() {
-		if close {
-			f.Close()
-		}
-	}()
-
-	tf := tar.NewReader(f)
-	for {
-		hdr, err := tf.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-		if hdr.Name == filePath {
-			if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink {
-				currentDir := filepath.Dir(filePath)
-				return extractFileFromTar(opener, path.Join(currentDir, hdr.Linkname))
-			}
-			close = false
-			return tarFile{
-				Reader: tf,
-				Closer: f,
-			}, nil
-		}
-	}
-	return nil, fmt.Errorf("file %s not found in tar", filePath)
-}
-
 // uncompressedLayerFromTarball implements partial.UncompressedLayer
 type uncompressedLayerFromTarball struct {
 	diffID    v1.Hash
@@ -275,7 +236,7 @@ func (ulft *uncompressedLayerFromTarball) DiffID() (v1.Hash, error) {
 
 // Uncompressed implements partial.UncompressedLayer
 func (ulft *uncompressedLayerFromTarball) Uncompressed() (io.ReadCloser, error) {
-	return extractFileFromTar(ulft.opener, ulft.filePath)
+	return tarfile.Open(ulft.opener, ulft.filePath)
 }
 
 func (ulft *uncompressedLayerFromTarball) MediaType() (types.MediaType, error) {
@@ -354,17 +315,25 @@ func (c *compressedImage) Manifest() (*v1.Manifest, error) {
 			// reading the entire file.
 			c.manifest.Layers = append(c.manifest.Layers, d)
 		} else {
-			l, err := extractFileFromTar(c.opener, p)
+			l, err := tarfile.Open(c.opener, p)
 			if err != nil {
 				return nil, err
 			}
 			defer l.Close()
-			sha, size, err := v1.SHA256(l)
+			comp, r, err := icompression.PeekReader(l)
+			if err != nil {
+				return nil, err
+			}
+			mt := types.DockerLayer
+			if comp == compression.ZStd {
+				mt = types.OCILayerZStd
+			}
+			sha, size, err := v1.SHA256(r)
 			if err != nil {
 				return nil, err
 			}
 			c.manifest.Layers = append(c.manifest.Layers, v1.Descriptor{
-				MediaType: types.DockerLayer,
+				MediaType: mt,
 				Size:      size,
 				Digest:    sha,
 			})
@@ -391,7 +360,7 @@ func (clft *compressedLayerFromTarball) Digest() (v1.Hash, error) {
 
 // Compressed implements partial.CompressedLayer
 func (clft *compressedLayerFromTarball) Compressed() (io.ReadCloser, error) {
-	return extractFileFromTar(clft.opener, clft.filePath)
+	return tarfile.Open(clft.opener, clft.filePath)
 }
 
 // MediaType implements partial.CompressedLayer
@@ -17,6 +17,7 @@ package tarball
 import (
 	"bytes"
 	"compress/gzip"
+	"encoding/hex"
 	"io"
 	"io/ioutil"
 	"os"
@@ -24,8 +25,11 @@ import (
 
 	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/google/go-containerregistry/internal/and"
+	icompression "github.com/google/go-containerregistry/internal/compression"
 	gestargz "github.com/google/go-containerregistry/internal/estargz"
 	ggzip "github.com/google/go-containerregistry/internal/gzip"
+	"github.com/google/go-containerregistry/internal/zstd"
+	"github.com/google/go-containerregistry/pkg/compression"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 )
@@ -36,9 +40,15 @@ type layer struct {
 	size               int64
 	compressedopener   Opener
 	uncompressedopener Opener
-	compression        int
-	annotations        map[string]string
-	estgzopts          []estargz.Option
+	// recompress is whether compressedopener compresses the output of
+	// uncompressedopener, see compress.
+	recompress       bool
+	compression      compression.Compression
+	compressionLevel int
+	annotations      map[string]string
+	estgzopts        []estargz.Option
+	mediaType        types.MediaType
+	algorithm        string
 }
 
 // Descriptor implements partial.withDescriptor.
@@ -47,12 +57,16 @@ func (l *layer) Descriptor() (*v1.Descriptor, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &v1.Descriptor{
-		Size:        l.size,
-		Digest:      digest,
-		Annotations: l.annotations,
-		MediaType:   types.DockerLayer,
-	}, nil
+	desc := &v1.Descriptor{
+		Size:      l.size,
+		Digest:    digest,
+		MediaType: l.mediaType,
+	}
+	// Leave out empty annotations, which wouldn't survive serialization.
+	if len(l.annotations) != 0 {
+		desc.Annotations = l.annotations
+	}
+	return desc, nil
 }
 
 // Digest implements v1.Layer
@@ -82,17 +96,73 @@ func (l *layer) Size() (int64, error) {
 
 // MediaType implements v1.Layer
 func (l *layer) MediaType() (types.MediaType, error) {
-	return types.DockerLayer, nil
+	return l.mediaType, nil
 }
 
 // LayerOption applies options to layer
 type LayerOption func(*layer)
 
 // WithCompressionLevel is a functional option for overriding the default
-// compression level used for compressing uncompressed tarballs.
+// compression level used for compressing uncompressed tarballs, e.g.
+// gzip.BestCompression or gzip.NoCompression. The default is gzip.BestSpeed.
+// Layers that are already compressed are used as-is.
+//
+// Changing the level changes the compressed bytes, and therefore the layer's
+// Digest and Size, but not its DiffID.
 func WithCompressionLevel(level int) LayerOption {
 	return func(l *layer) {
-		l.compression = level
+		l.compressionLevel = level
+	}
+}
+
+// WithCompression is a functional option for overriding the default
+// compression algorithm (gzip) used for compressing uncompressed tarballs.
+// Passing compression.ZStd produces a layer with the OCILayerZStd media type.
+//
+// If the tarball is already compressed with a different algorithm, it will be
+// recompressed.
+func WithCompression(comp compression.Compression) LayerOption {
+	return func(l *layer) {
+		if comp == l.compression {
+			return
+		}
+		switch comp {
+		case compression.ZStd:
+			l.mediaType = types.OCILayerZStd
+		case compression.GZip:
+			l.mediaType = types.DockerLayer
+		default:
+			// We always need to compress layers, so there's nothing to do.
+			return
+		}
+
+		uncompressed := l.uncompressedopener
+		l.compressedopener = func() (io.ReadCloser, error) {
+			urc, err := uncompressed()
+			if err != nil {
+				return nil, err
+			}
+			return l.compress(urc), nil
+		}
+		l.recompress = true
+		l.compression = comp
+	}
+}
+
+// WithDigestAlgorithm is a functional option for overriding the default
+// algorithm (sha256) used to compute the layer's digest and diffid, e.g.
+// "sha512". See v1.Hasher for the supported algorithms.
+func WithDigestAlgorithm(algorithm string) LayerOption {
+	return func(l *layer) {
+		l.algorithm = algorithm
+	}
+}
+
+// WithMediaType is a functional option for overriding the layer's media type,
+// e.g. to produce a types.OCILayer instead of the default types.DockerLayer.
+func WithMediaType(mt types.MediaType) LayerOption {
+	return func(l *layer) {
+		l.mediaType = mt
 	}
 }
 
@@ -121,6 +191,7 @@ func WithCompressedCaching(l *layer) {
 
 		return ioutil.NopCloser(bytes.NewBuffer(buf.Bytes())), nil
 	}
+	l.recompress = false
 }
 
 // WithEstargzOptions is a functional option that allow the caller to pass
@@ -133,6 +204,11 @@ func WithEstargzOptions(opts ...estargz.Option) LayerOption {
 }
 
 // WithEstargz is a functional option that explicitly enables estargz support.
+//
+// The layer is compressed into a seekable estargz blob, and its descriptor is
+// annotated with the digest of the estargz table of contents. The DiffID is
+// that of the decompressed blob, including the estargz TOC and landmark
+// entries, which is what containerd computes when it unpacks the layer.
 func WithEstargz(l *layer) {
 	oguncompressed := l.uncompressedopener
 	estargz := func() (io.ReadCloser, error) {
@@ -140,7 +216,7 @@ func WithEstargz(l *layer) {
 		if err != nil {
 			return nil, err
 		}
-		eopts := append(l.estgzopts, estargz.WithCompressionLevel(l.compression))
+		eopts := append(l.estgzopts, estargz.WithCompressionLevel(l.compressionLevel))
 		rc, h, err := gestargz.ReadCloser(crc, eopts...)
 		if err != nil {
 			return nil, err
@@ -169,6 +245,9 @@ func WithEstargz(l *layer) {
 
 	l.compressedopener = estargz
 	l.uncompressedopener = uncompressed
+	l.recompress = false
+	l.compression = compression.GZip
+	l.mediaType = types.DockerLayer
 }
 
 // LayerFromFile returns a v1.Layer given a tarball
@@ -181,12 +260,13 @@ func LayerFromFile(path string, opts ...LayerOption) (v1.Layer, error) {
 
 // LayerFromOpener returns a v1.Layer given an Opener function.
 // The Opener may return either an uncompressed tarball (common),
-// or a compressed tarball (uncommon).
+// or a gzip or zstd compressed tarball (uncommon).
 //
 // When using this in conjunction with something like remote.Write
 // the uncompressed path may end up gzipping things multiple times:
 //  1. Compute the layer SHA256
 //  2. Upload the compressed layer.
+//
 // Since gzip can be expensive, we support an option to memoize the
 // compression that can be passed here: tarball.WithCompressedCaching
 func LayerFromOpener(opener Opener, opts ...LayerOption) (v1.Layer, error) {
@@ -196,21 +276,25 @@ func LayerFromOpener(opener Opener, opts ...LayerOption) (v1.Layer, error) {
 	}
 	defer rc.Close()
 
-	compressed, err := ggzip.Is(rc)
+	comp, err := icompression.Peek(rc)
 	if err != nil {
 		return nil, err
 	}
 
 	layer := &layer{
-		compression: gzip.BestSpeed,
-		annotations: make(map[string]string, 1),
+		compression:      compression.GZip,
+		compressionLevel: gzip.BestSpeed,
+		annotations:      make(map[string]string, 1),
+		mediaType:        types.DockerLayer,
+		algorithm:        "sha256",
 	}
 
 	if estgz := os.Getenv("GGCR_EXPERIMENT_ESTARGZ"); estgz == "1" {
 		opts = append([]LayerOption{WithEstargz}, opts...)
 	}
 
-	if compressed {
+	switch comp {
+	case compression.GZip:
 		layer.compressedopener = opener
 		layer.uncompressedopener = func() (io.ReadCloser, error) {
 			urc, err := opener()
@@ -219,32 +303,37 @@ func LayerFromOpener(opener Opener, opts ...LayerOption) (v1.Layer, error) {
 			}
 			return ggzip.UnzipReadCloser(urc)
 		}
-	} else {
+	case compression.ZStd:
+		layer.compressedopener = opener
+		layer.uncompressedopener = func() (io.ReadCloser, error) {
+			urc, err := opener()
+			if err != nil {
+				return nil, err
+			}
+			return zstd.UnzipReadCloser(urc)
+		}
+		layer.compression = compression.ZStd
+		layer.mediaType = types.OCILayerZStd
+	default:
 		layer.uncompressedopener = opener
 		layer.compressedopener = func() (io.ReadCloser, error) {
 			crc, err := opener()
 			if err != nil {
 				return nil, err
 			}
-			return ggzip.ReadCloserLevel(crc, layer.compression), nil
+			return layer.compress(crc), nil
 		}
+		layer.recompress = true
 	}
 
 	for _, opt := range opts {
 		opt(layer)
 	}
 
-	if layer.digest, layer.size, err = computeDigest(layer.compressedopener); err != nil {
+	if err := layer.computeHashes(); err != nil {
 		return nil, err
 	}
 
-	empty := v1.Hash{}
-	if layer.diffID == empty {
-		if layer.diffID, err = computeDiffID(layer.uncompressedopener); err != nil {
-			return nil, err
-		}
-	}
-
 	return layer, nil
 }
 
@@ -255,28 +344,103 @@ func LayerFromReader(reader io.Reader, opts ...LayerOption) (v1.Layer, error) {
 	if err != nil {
 		return nil, err
 	}
+	return LayerFromBytes(a, opts...)
+}
+
+// LayerFromBytes returns a v1.Layer given the bytes of a tarball, which may be
+// uncompressed or gzip or zstd compressed, like LayerFromOpener. The digest
+// and diffid are computed up front.
+//
+// Use WithMediaType to set a media type other than the default for the
+// compression, e.g. types.OCILayer.
+func LayerFromBytes(b []byte, opts ...LayerOption) (v1.Layer, error) {
 	return LayerFromOpener(func() (io.ReadCloser, error) {
-		return ioutil.NopCloser(bytes.NewReader(a)), nil
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
 	}, opts...)
 }
 
-func computeDigest(opener Opener) (v1.Hash, int64, error) {
-	rc, err := opener()
-	if err != nil {
-		return v1.Hash{}, 0, err
+// compress compresses rc with the layer's compression and level.
+func (l *layer) compress(rc io.ReadCloser) io.ReadCloser {
+	if l.compression == compression.ZStd {
+		return zstd.ReadCloserLevel(rc, l.compressionLevel)
 	}
-	defer rc.Close()
+	return ggzip.ReadCloserLevel(rc, l.compressionLevel)
+}
 
-	return v1.SHA256(rc)
+// decompress decompresses rc with the layer's compression.
+func (l *layer) decompress(rc io.ReadCloser) (io.ReadCloser, error) {
+	if l.compression == compression.ZStd {
+		return zstd.UnzipReadCloser(rc)
+	}
+	return ggzip.UnzipReadCloser(rc)
 }
 
-func computeDiffID(opener Opener) (v1.Hash, error) {
-	rc, err := opener()
+// computeHashes computes the digest, size and diffid of the layer in a single
+// pass over the blob, hashing the compressed and uncompressed bytes as they
+// stream through the compressor or decompressor, so that the blob is read
+// once, however large it is.
+func (l *layer) computeHashes() error {
+	digester, err := v1.Hasher(l.algorithm)
 	if err != nil {
-		return v1.Hash{}, err
+		return err
 	}
-	defer rc.Close()
+	differ, err := v1.Hasher(l.algorithm)
+	if err != nil {
+		return err
+	}
+	var size int64
+
+	if l.recompress {
+		urc, err := l.uncompressedopener()
+		if err != nil {
+			return err
+		}
+		defer urc.Close()
+		crc := l.compress(ioutil.NopCloser(io.TeeReader(urc, differ)))
+		defer crc.Close()
+		if size, err = io.Copy(digester, crc); err != nil {
+			return err
+		}
+	} else {
+		crc, err := l.compressedopener()
+		if err != nil {
+			return err
+		}
+		defer crc.Close()
+		counter := &countWriter{}
+		tee := io.TeeReader(crc, io.MultiWriter(digester, counter))
+		urc, err := l.decompress(ioutil.NopCloser(tee))
+		if err != nil {
+			return err
+		}
+		defer urc.Close()
+		if _, err := io.Copy(differ, urc); err != nil {
+			return err
+		}
+		// Hash anything after the end of the compressed stream, too.
+		if _, err := io.Copy(ioutil.Discard, tee); err != nil {
+			return err
+		}
+		// Close before setting the hashes, since closing may set the diffid
+		// of estargz layers, which is the same anyway.
+		if err := crc.Close(); err != nil {
+			return err
+		}
+		size = counter.n
+	}
+
+	l.digest = v1.Hash{Algorithm: l.algorithm, Hex: hex.EncodeToString(digester.Sum(nil))}
+	l.diffID = v1.Hash{Algorithm: l.algorithm, Hex: hex.EncodeToString(differ.Sum(nil))}
+	l.size = size
+	return nil
+}
+
+// countWriter counts the bytes written to it.
+type countWriter struct {
+	n int64
+}
 
-	digest, _, err := v1.SHA256(rc)
-	return digest, err
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
 }
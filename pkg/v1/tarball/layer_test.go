@@ -20,10 +20,13 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/google/go-containerregistry/internal/compare"
+	"github.com/google/go-containerregistry/pkg/compression"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
 )
 
@@ -78,6 +81,84 @@ func TestLayerFromFile(t *testing.T) {
 	}
 }
 
+func TestLayerFromFileNoCompression(t *testing.T) {
+	want, err := ioutil.ReadFile("testdata/content.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer, err := LayerFromFile("testdata/content.tar", WithCompressionLevel(gzip.NoCompression))
+	if err != nil {
+		t.Fatalf("LayerFromFile() = %v", err)
+	}
+	if err := validate.Layer(layer); err != nil {
+		t.Errorf("validate.Layer() = %v", err)
+	}
+
+	rc, err := layer.Compressed()
+	if err != nil {
+		t.Fatalf("Compressed() = %v", err)
+	}
+	defer rc.Close()
+	zr, err := gzip.NewReader(rc)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() = %v", err)
+	}
+	got, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("ReadAll() = %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("decompressed layer differs from the tar: got %d bytes, want %d", len(got), len(want))
+	}
+
+	defaultLayer, err := LayerFromFile("testdata/content.tar")
+	if err != nil {
+		t.Fatalf("LayerFromFile() = %v", err)
+	}
+	if err := compare.Layers(layer, defaultLayer); err == nil {
+		t.Error("compare.Layers() = nil, wanted the digests to differ")
+	}
+	gotDiffID, err := layer.DiffID()
+	if err != nil {
+		t.Fatalf("DiffID() = %v", err)
+	}
+	wantDiffID, err := defaultLayer.DiffID()
+	if err != nil {
+		t.Fatalf("DiffID() = %v", err)
+	}
+	if gotDiffID != wantDiffID {
+		t.Errorf("DiffID() = %s, want %s", gotDiffID, wantDiffID)
+	}
+}
+
+func TestLayerFromFileDigestAlgorithm(t *testing.T) {
+	layer, err := LayerFromFile("testdata/content.tar", WithDigestAlgorithm("sha512"))
+	if err != nil {
+		t.Fatalf("Unable to create layer from tar file: %v", err)
+	}
+
+	digest, err := layer.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffID, err := layer.DiffID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest.Algorithm != "sha512" || diffID.Algorithm != "sha512" {
+		t.Errorf("Digest() = %s, DiffID() = %s, want sha512", digest, diffID)
+	}
+
+	if err := validate.Layer(layer); err != nil {
+		t.Errorf("validate.Layer: %v", err)
+	}
+
+	if _, err := LayerFromFile("testdata/content.tar", WithDigestAlgorithm("md5")); err == nil || !strings.Contains(err.Error(), "unsupported algorithm") {
+		t.Errorf("LayerFromFile(md5) = %v, want unsupported algorithm error", err)
+	}
+}
+
 func TestLayerFromFileEstargz(t *testing.T) {
 	setupFixtures(t)
 	defer teardownFixtures(t)
@@ -167,6 +248,67 @@ func TestLayerFromFileEstargz(t *testing.T) {
 	}
 }
 
+func TestLayerFromFileZstd(t *testing.T) {
+	tarLayer, err := LayerFromFile("testdata/content.tar")
+	if err != nil {
+		t.Fatalf("Unable to create layer from tar file: %v", err)
+	}
+
+	zstdLayer, err := LayerFromFile("testdata/content.tar", WithCompression(compression.ZStd))
+	if err != nil {
+		t.Fatalf("Unable to create zstd layer from tar file: %v", err)
+	}
+
+	if err := validate.Layer(zstdLayer); err != nil {
+		t.Errorf("validate.Layer(zstdLayer): %v", err)
+	}
+
+	if mt, err := zstdLayer.MediaType(); err != nil {
+		t.Fatal(err)
+	} else if mt != types.OCILayerZStd {
+		t.Errorf("MediaType() = %s, want %s", mt, types.OCILayerZStd)
+	}
+
+	tarDiffID, err := tarLayer.DiffID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	zstdDiffID, err := zstdLayer.DiffID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tarDiffID != zstdDiffID {
+		t.Errorf("DiffID() = %s, want %s", zstdDiffID, tarDiffID)
+	}
+
+	// A zstd compressed tarball should be detected as such.
+	rc, err := zstdLayer.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	zstdBytes, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	detectedLayer, err := LayerFromReader(bytes.NewReader(zstdBytes))
+	if err != nil {
+		t.Fatalf("Unable to create layer from zstd tarball: %v", err)
+	}
+	if err := compare.Layers(zstdLayer, detectedLayer); err != nil {
+		t.Errorf("compare.Layers: %v", err)
+	}
+
+	// Recompressing with gzip gets us back to the default layer.
+	gzipLayer, err := LayerFromReader(bytes.NewReader(zstdBytes), WithCompression(compression.GZip))
+	if err != nil {
+		t.Fatalf("Unable to create gzip layer from zstd tarball: %v", err)
+	}
+	if err := compare.Layers(tarLayer, gzipLayer); err != nil {
+		t.Errorf("compare.Layers: %v", err)
+	}
+}
+
 func TestLayerFromOpenerReader(t *testing.T) {
 	setupFixtures(t)
 	defer teardownFixtures(t)
@@ -200,9 +342,10 @@ func TestLayerFromOpenerReader(t *testing.T) {
 		tarLayer.Compressed()
 	}
 
-	// We expect three calls: gzip sniff, diffid computation, cached compression
-	if cachedCount != 3 {
-		t.Errorf("cached count = %d, wanted %d", cachedCount, 3)
+	// We expect two calls: gzip sniff, and computing the digest and diffid
+	// in one pass, which fills the cache.
+	if cachedCount != 2 {
+		t.Errorf("cached count = %d, wanted %d", cachedCount, 2)
 	}
 	if cachedCount+10 != count {
 		t.Errorf("count = %d, wanted %d", count, cachedCount+10)
@@ -289,3 +432,162 @@ func teardownFixtures(t *testing.T) {
 		t.Errorf("Error tearing down fixtures: %v", err)
 	}
 }
+
+func TestLayerFromBytes(t *testing.T) {
+	setupFixtures(t)
+	defer teardownFixtures(t)
+
+	ucBytes, err := ioutil.ReadFile("testdata/content.tar")
+	if err != nil {
+		t.Fatalf("Unable to read tar file: %v", err)
+	}
+	gzBytes, err := ioutil.ReadFile("gzip_content.tgz")
+	if err != nil {
+		t.Fatalf("Unable to read tar file: %v", err)
+	}
+	want, err := LayerFromFile("gzip_content.tgz")
+	if err != nil {
+		t.Fatalf("Unable to create layer from tar file: %v", err)
+	}
+
+	for _, tc := range []struct {
+		desc string
+		b    []byte
+		opts []LayerOption
+		mt   types.MediaType
+	}{
+		{"uncompressed", ucBytes, nil, types.DockerLayer},
+		{"gzip", gzBytes, nil, types.DockerLayer},
+		{"media type", gzBytes, []LayerOption{WithMediaType(types.OCILayer)}, types.OCILayer},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			layer, err := LayerFromBytes(tc.b, tc.opts...)
+			if err != nil {
+				t.Fatalf("LayerFromBytes() = %v", err)
+			}
+			if err := validate.Layer(layer); err != nil {
+				t.Errorf("validate.Layer() = %v", err)
+			}
+			if mt, err := layer.MediaType(); err != nil {
+				t.Errorf("MediaType() = %v", err)
+			} else if mt != tc.mt {
+				t.Errorf("MediaType() = %s, want %s", mt, tc.mt)
+			}
+
+			gotDiffID, err := layer.DiffID()
+			if err != nil {
+				t.Fatalf("DiffID() = %v", err)
+			}
+			wantDiffID, err := want.DiffID()
+			if err != nil {
+				t.Fatalf("DiffID() = %v", err)
+			}
+			if gotDiffID != wantDiffID {
+				t.Errorf("DiffID() = %s, want %s", gotDiffID, wantDiffID)
+			}
+		})
+	}
+
+	// Compressed bytes are used as-is.
+	layer, err := LayerFromBytes(gzBytes)
+	if err != nil {
+		t.Fatalf("LayerFromBytes() = %v", err)
+	}
+	if err := compare.Layers(layer, want); err != nil {
+		t.Errorf("compare.Layers: %v", err)
+	}
+}
+
+func TestLayerFromOpenerSinglePass(t *testing.T) {
+	setupFixtures(t)
+	defer teardownFixtures(t)
+
+	ucBytes, err := ioutil.ReadFile("testdata/content.tar")
+	if err != nil {
+		t.Fatalf("Unable to read tar file: %v", err)
+	}
+	gzBytes, err := ioutil.ReadFile("gzip_content.tgz")
+	if err != nil {
+		t.Fatalf("Unable to read tar file: %v", err)
+	}
+
+	for _, tc := range []struct {
+		desc string
+		b    []byte
+		opts []LayerOption
+	}{
+		{"uncompressed", ucBytes, nil},
+		{"gzip", gzBytes, nil},
+		{"zstd", ucBytes, []LayerOption{WithCompression(compression.ZStd)}},
+		{"recompressed", gzBytes, []LayerOption{WithCompression(compression.ZStd)}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			count := 0
+			opener := func() (io.ReadCloser, error) {
+				count++
+				return ioutil.NopCloser(bytes.NewReader(tc.b)), nil
+			}
+			layer, err := LayerFromOpener(opener, tc.opts...)
+			if err != nil {
+				t.Fatalf("LayerFromOpener() = %v", err)
+			}
+			if _, err := layer.Digest(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := layer.DiffID(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := layer.Size(); err != nil {
+				t.Fatal(err)
+			}
+
+			// One call to sniff the compression, one to hash the blob.
+			if count != 2 {
+				t.Errorf("opened %d times, want 2", count)
+			}
+			if err := validate.Layer(layer); err != nil {
+				t.Errorf("validate.Layer() = %v", err)
+			}
+		})
+	}
+}
+
+// BenchmarkLayerFromOpener computes the hashes of a 2GiB uncompressed layer,
+// reporting how many times the blob is read.
+func BenchmarkLayerFromOpener(b *testing.B) {
+	const size = 2 << 30
+
+	var read int64
+	opener := func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(&countingReader{r: io.LimitReader(zeroReader{}, size), n: &read}), nil
+	}
+
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := LayerFromOpener(opener); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(read)/float64(size)/float64(b.N), "reads/op")
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
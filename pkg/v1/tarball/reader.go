@@ -0,0 +1,94 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tarball
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Store holds the contents of the stream passed to ImageFromReader, so that
+// they can be read again. An empty *os.File is a Store.
+type Store interface {
+	io.Writer
+	io.ReaderAt
+}
+
+// ReaderOption is a functional option for ImageFromReader.
+type ReaderOption func(*readerOptions)
+
+type readerOptions struct {
+	store Store
+	tag   *name.Tag
+}
+
+// WithStore sets the Store that ImageFromReader copies the stream to.
+//
+// By default, the stream is held in memory, which is fast, but needs as much
+// memory as the tarball is large. To use the disk instead, pass an empty
+// temporary file, which the caller is responsible for removing once the image
+// is no longer used.
+func WithStore(store Store) ReaderOption {
+	return func(o *readerOptions) {
+		o.store = store
+	}
+}
+
+// WithTag selects the image with tag from a tarball with multiple images.
+func WithTag(tag *name.Tag) ReaderOption {
+	return func(o *readerOptions) {
+		o.tag = tag
+	}
+}
+
+// ImageFromReader returns a v1.Image from a tarball that can only be read
+// once, e.g. the output of `docker save` on stdin.
+//
+// The whole stream is read up front, into memory or the Store passed with
+// WithStore, and the image's blobs are served from there.
+func ImageFromReader(r io.Reader, opts ...ReaderOption) (v1.Image, error) {
+	o := &readerOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.store == nil {
+		o.store = &memoryStore{}
+	}
+
+	size, err := io.Copy(o.store, r)
+	if err != nil {
+		return nil, err
+	}
+	return Image(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(io.NewSectionReader(o.store, 0, size)), nil
+	}, o.tag)
+}
+
+// memoryStore is the default Store.
+type memoryStore struct {
+	buf bytes.Buffer
+}
+
+func (m *memoryStore) Write(p []byte) (int, error) {
+	return m.buf.Write(p)
+}
+
+func (m *memoryStore) ReadAt(p []byte, off int64) (int, error) {
+	return bytes.NewReader(m.buf.Bytes()).ReadAt(p, off)
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tarball
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+// stream opens path as a plain io.Reader, which can't be seeked or reopened.
+func stream(t *testing.T, path string) io.Reader {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return struct{ io.Reader }{f}
+}
+
+func mustDigest(t *testing.T, img v1.Image) v1.Hash {
+	t.Helper()
+	d, err := img.Digest()
+	if err != nil {
+		t.Fatalf("Digest() = %v", err)
+	}
+	return d
+}
+
+func TestImageFromReader(t *testing.T) {
+	want, err := ImageFromPath("testdata/test_image_1.tar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmp, err := ioutil.TempFile("", "tarball-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	for _, tc := range []struct {
+		desc string
+		opts []ReaderOption
+	}{
+		{"memory", nil},
+		{"file", []ReaderOption{WithStore(tmp)}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			img, err := ImageFromReader(stream(t, "testdata/test_image_1.tar"), tc.opts...)
+			if err != nil {
+				t.Fatalf("ImageFromReader() = %v", err)
+			}
+			if err := validate.Image(img); err != nil {
+				t.Errorf("validate.Image() = %v", err)
+			}
+			if got, want := mustDigest(t, img), mustDigest(t, want); got != want {
+				t.Errorf("Digest() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestImageFromReaderWithTag(t *testing.T) {
+	tag, err := name.NewTag("test_image_2", name.WeakValidation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ImageFromPath("testdata/test_bundle.tar", &tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := ImageFromReader(stream(t, "testdata/test_bundle.tar"), WithTag(&tag))
+	if err != nil {
+		t.Fatalf("ImageFromReader() = %v", err)
+	}
+	if got, want := mustDigest(t, img), mustDigest(t, want); got != want {
+		t.Errorf("Digest() = %s, want %s", got, want)
+	}
+
+	if _, err := ImageFromReader(stream(t, "testdata/test_bundle.tar")); err == nil {
+		t.Error("ImageFromReader(bundle) = nil, wanted error without a tag")
+	}
+}
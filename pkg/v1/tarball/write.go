@@ -87,6 +87,10 @@ func MultiWrite(tagToImage map[name.Tag]v1.Image, w io.Writer, opts ...WriteOpti
 // One manifest.json file at the top level containing information about several images.
 // One file for each layer, named after the layer's SHA.
 // One file for the config blob, named after its SHA.
+//
+// Layers are streamed from Compressed into the tarball one at a time, without
+// buffering them in memory, and manifest.json is written after them, as the
+// last entry of the tarball.
 func MultiRefWrite(refToImage map[name.Reference]v1.Image, w io.Writer, opts ...WriteOption) error {
 	// process options
 	o := &writeOptions{
@@ -148,7 +152,10 @@ func writeImagesToTar(refToImage map[name.Reference]v1.Image, m []byte, size int
 	tf := tar.NewWriter(tw)
 	defer tf.Close()
 
+	// Images commonly share layers, or even configs, so write every blob
+	// only once and have the manifest.json entries refer to the same file.
 	seenLayerDigests := make(map[string]struct{})
+	seenConfigs := make(map[v1.Hash]struct{})
 
 	for img := range imageToTags {
 		// Write the config.
@@ -156,12 +163,15 @@ func writeImagesToTar(refToImage map[name.Reference]v1.Image, m []byte, size int
 		if err != nil {
 			return sendProgressWriterReturn(pw, err)
 		}
-		cfgBlob, err := img.RawConfigFile()
-		if err != nil {
-			return sendProgressWriterReturn(pw, err)
-		}
-		if err := writeTarEntry(tf, cfgName.String(), bytes.NewReader(cfgBlob), int64(len(cfgBlob))); err != nil {
-			return sendProgressWriterReturn(pw, err)
+		if _, ok := seenConfigs[cfgName]; !ok {
+			seenConfigs[cfgName] = struct{}{}
+			cfgBlob, err := img.RawConfigFile()
+			if err != nil {
+				return sendProgressWriterReturn(pw, err)
+			}
+			if err := writeTarEntry(tf, cfgName.String(), bytes.NewReader(cfgBlob), int64(len(cfgBlob))); err != nil {
+				return sendProgressWriterReturn(pw, err)
+			}
 		}
 
 		// Write the layers.
@@ -200,7 +210,11 @@ func writeImagesToTar(refToImage map[name.Reference]v1.Image, m []byte, size int
 				return sendProgressWriterReturn(pw, err)
 			}
 
-			if err := writeTarEntry(tf, layerFiles[i], r, blobSize); err != nil {
+			err = writeTarEntry(tf, layerFiles[i], r, blobSize)
+			if cerr := r.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
 				return sendProgressWriterReturn(pw, err)
 			}
 		}
@@ -315,14 +329,19 @@ func getSizeAndManifest(refToImage map[name.Reference]v1.Image) (size int64, m M
 func calculateTarballSize(refToImage map[name.Reference]v1.Image, mBytes []byte) (size int64, err error) {
 	imageToTags := dedupRefToImage(refToImage)
 
+	// Shared blobs are only written once, see writeImagesToTar.
+	seen := make(map[v1.Hash]struct{})
 	for img, name := range imageToTags {
 		manifest, err := img.Manifest()
 		if err != nil {
 			return size, fmt.Errorf("unable to get manifest for img %s: %v", name, err)
 		}
-		size += calculateSingleFileInTarSize(manifest.Config.Size)
-		for _, l := range manifest.Layers {
-			size += calculateSingleFileInTarSize(l.Size)
+		for _, desc := range append([]v1.Descriptor{manifest.Config}, manifest.Layers...) {
+			if _, ok := seen[desc.Digest]; ok {
+				continue
+			}
+			seen[desc.Digest] = struct{}{}
+			size += calculateSingleFileInTarSize(desc.Size)
 		}
 	}
 	// add the manifest
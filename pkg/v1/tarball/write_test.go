@@ -28,6 +28,7 @@ import (
 	"github.com/google/go-containerregistry/internal/compare"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
@@ -85,6 +86,77 @@ func TestWrite(t *testing.T) {
 	}
 }
 
+// closeTrackingLayer records whether the readers returned by Compressed have
+// been closed.
+type closeTrackingLayer struct {
+	v1.Layer
+	open *int
+}
+
+func (l *closeTrackingLayer) Compressed() (io.ReadCloser, error) {
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	*l.open++
+	return &closeTrackingReader{ReadCloser: rc, open: l.open}, nil
+}
+
+type closeTrackingReader struct {
+	io.ReadCloser
+	open *int
+}
+
+func (r *closeTrackingReader) Close() error {
+	*r.open--
+	return r.ReadCloser.Close()
+}
+
+func TestWriteStreamsLayers(t *testing.T) {
+	open := 0
+	var layers []v1.Layer
+	for i := 0; i < 3; i++ {
+		l, err := random.Layer(1024, types.DockerLayer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		layers = append(layers, &closeTrackingLayer{Layer: l, open: &open})
+	}
+	img, err := mutate.AppendLayers(empty.Image, layers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, err := name.NewTag("gcr.io/foo/bar:latest", name.StrictValidation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := tarball.Write(tag, img, &buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if open != 0 {
+		t.Errorf("%d layer readers left open", open)
+	}
+
+	// The manifest is written after the blobs it refers to.
+	tr := tar.NewReader(&buf)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if len(names) != 5 || names[len(names)-1] != "manifest.json" {
+		t.Errorf("tarball entries = %v, want config, 3 layers and manifest.json last", names)
+	}
+}
+
 func TestMultiWriteSameImage(t *testing.T) {
 	// Make a tempfile for tarball writes.
 	fp, err := ioutil.TempFile("", "")
@@ -377,6 +449,90 @@ func TestWriteSharedLayers(t *testing.T) {
 	}
 }
 
+func TestMultiRefWriteSharedBase(t *testing.T) {
+	base, err := random.Image(1024, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refToImage := make(map[name.Reference]v1.Image)
+	var first v1.Image
+	for i := 0; i < 10; i++ {
+		layer, err := random.Layer(256, types.DockerLayer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := mutate.AppendLayers(base, layer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tag, err := name.NewTag(fmt.Sprintf("gcr.io/foo/bar:%d", i), name.StrictValidation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refToImage[tag] = img
+		if first == nil {
+			first = img
+		}
+	}
+	// A distinct image with the same config and layers as another one.
+	tag, err := name.NewTag("gcr.io/foo/bar:annotated", name.StrictValidation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refToImage[tag] = mutate.Annotations(first, map[string]string{"foo": "bar"})
+
+	buf := bytes.NewBuffer(nil)
+	if err := tarball.MultiRefWrite(refToImage, buf); err != nil {
+		t.Fatalf("MultiRefWrite() = %v", err)
+	}
+	size, err := tarball.CalculateSize(refToImage)
+	if err != nil {
+		t.Fatalf("CalculateSize() = %v", err)
+	}
+	if int64(buf.Len()) != size {
+		t.Errorf("CalculateSize() = %d, but wrote %d bytes", size, buf.Len())
+	}
+
+	// 3 shared layers, 10 distinct layers, 10 distinct configs and the manifest.
+	seen := map[string]bool{}
+	r := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		hdr, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Next() = %v", err)
+		}
+		if seen[hdr.Name] {
+			t.Errorf("%s was written more than once", hdr.Name)
+		}
+		seen[hdr.Name] = true
+	}
+	if got, want := len(seen), 3+10+10+1; got != want {
+		t.Errorf("got %d files, want %d", got, want)
+	}
+
+	for ref, img := range refToImage {
+		tag := ref.(name.Tag)
+		tarImage, err := tarball.Image(func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
+		}, &tag)
+		if err != nil {
+			t.Fatalf("tarball.Image(%s) = %v", tag, err)
+		}
+		if err := validate.Image(tarImage); err != nil {
+			t.Errorf("validate.Image(%s) = %v", tag, err)
+		}
+		if tag.TagStr() == "annotated" {
+			// The annotations are lost.
+			continue
+		}
+		if err := compare.Images(img, tarImage); err != nil {
+			t.Errorf("compare.Images(%s) = %v", tag, err)
+		}
+	}
+}
+
 func TestComputeManifest(t *testing.T) {
 	var randomTag, mutatedTag = "ubuntu", "gcr.io/baz/bat:latest"
 
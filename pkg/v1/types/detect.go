@@ -0,0 +1,137 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// detectSize is how much of a blob Detect peeks at, enough for the start of
+// the largest manifests.
+const detectSize = 64 << 10
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b, 0x08}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	// tarMagic is at offset 257 of the first header, followed by "\x00" or
+	// " " for POSIX and GNU tars.
+	tarMagic = []byte("ustar")
+)
+
+// Detect classifies a blob of unknown type by peeking at its leading bytes,
+// and, for JSON, at its mediaType and schemaVersion fields.
+//
+// It recognizes gzip and zstd compressed layers, as OCILayer and OCILayerZStd,
+// uncompressed tars, as OCIUncompressedLayer, image configs, as
+// OCIConfigJSON, and image manifests and indexes, by their mediaType or as
+// their OCI types. Other blobs get an empty MediaType.
+//
+// The returned reader yields the whole blob, including the peeked bytes, and
+// must be read instead of r.
+func Detect(r io.Reader) (MediaType, io.Reader, error) {
+	br := bufio.NewReaderSize(r, detectSize)
+	b, err := br.Peek(detectSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", br, err
+	}
+	return detect(b), br, nil
+}
+
+func detect(b []byte) MediaType {
+	switch {
+	case bytes.HasPrefix(b, gzipMagic):
+		return OCILayer
+	case bytes.HasPrefix(b, zstdMagic):
+		return OCILayerZStd
+	case len(b) >= 262 && bytes.Equal(b[257:262], tarMagic):
+		return OCIUncompressedLayer
+	case bytes.HasPrefix(bytes.TrimLeft(b, " \t\r\n"), []byte("{")):
+		return detectJSON(b)
+	}
+	return ""
+}
+
+// detectJSON looks at the top-level fields of a JSON object, which might be
+// cut off, to tell manifests, indexes and configs apart.
+func detectJSON(b []byte) MediaType {
+	var (
+		mediaType     MediaType
+		schemaVersion int
+		keys          = map[string]bool{}
+	)
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if _, err := dec.Token(); err != nil {
+		return ""
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		key, ok := tok.(string)
+		if !ok {
+			break
+		}
+		keys[key] = true
+		switch key {
+		case "mediaType":
+			err = dec.Decode(&mediaType)
+		case "schemaVersion":
+			err = dec.Decode(&schemaVersion)
+		default:
+			err = dec.Decode(&json.RawMessage{})
+		}
+		if err != nil {
+			// Probably cut off, go with what we have.
+			break
+		}
+	}
+
+	switch {
+	case mediaType != "":
+		return mediaType
+	case schemaVersion == 1 && keys["fsLayers"]:
+		if keys["signatures"] {
+			return DockerManifestSchema1Signed
+		}
+		return DockerManifestSchema1
+	case schemaVersion == 2 && keys["manifests"]:
+		return OCIImageIndex
+	case schemaVersion == 2 && (keys["config"] || keys["layers"]):
+		return OCIManifestSchema1
+	case keys["rootfs"]:
+		return OCIConfigJSON
+	}
+	return ""
+}
+
+// DetectManifest classifies a manifest by its mediaType and schemaVersion
+// fields, the way registries that don't trust Content-Type headers do. It
+// returns an empty MediaType if the manifest isn't recognizably an image
+// manifest or index.
+func DetectManifest(manifest []byte) MediaType {
+	switch mt := detectJSON(manifest); mt {
+	case DockerManifestSchema1, DockerManifestSchema1Signed:
+		return mt
+	default:
+		if mt.IsImage() || mt.IsIndex() {
+			return mt
+		}
+	}
+	return ""
+}
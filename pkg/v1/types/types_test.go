@@ -1,6 +1,13 @@
 package types
 
-import "testing"
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
 
 func TestIsDistributable(t *testing.T) {
 	for _, mt := range []MediaType{
@@ -96,3 +103,116 @@ func TestIsIndex(t *testing.T) {
 		}
 	}
 }
+
+func TestDetect(t *testing.T) {
+	var tarball bytes.Buffer
+	tw := tar.NewWriter(&tarball)
+	if err := tw.WriteHeader(&tar.Header{Name: "file", Typeflag: tar.TypeReg, Mode: 0644}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	if _, err := zw.Write(tarball.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Larger than what Detect peeks at, which cuts off the layers.
+	many := `{"schemaVersion": 2, "config": {}, "layers": [` + strings.Repeat(`{"size": 1},`, 1<<14) + `{}]}`
+
+	for _, tc := range []struct {
+		desc string
+		blob []byte
+		want MediaType
+	}{
+		{"gzip", gzipped.Bytes(), OCILayer},
+		{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, OCILayerZStd},
+		{"tar", tarball.Bytes(), OCIUncompressedLayer},
+		{"docker manifest", []byte(`{"schemaVersion": 2, "mediaType": "application/vnd.docker.distribution.manifest.v2+json", "config": {}}`), DockerManifestSchema2},
+		{"oci manifest", []byte(` {"schemaVersion": 2, "config": {}, "layers": []}`), OCIManifestSchema1},
+		{"cut off manifest", []byte(many), OCIManifestSchema1},
+		{"oci index", []byte(`{"schemaVersion": 2, "manifests": []}`), OCIImageIndex},
+		{"schema 1", []byte(`{"schemaVersion": 1, "fsLayers": []}`), DockerManifestSchema1},
+		{"signed schema 1", []byte(`{"schemaVersion": 1, "fsLayers": [], "signatures": []}`), DockerManifestSchema1Signed},
+		{"config", []byte(`{"architecture": "amd64", "os": "linux", "rootfs": {"type": "layers"}}`), OCIConfigJSON},
+		{"other json", []byte(`{"foo": "bar"}`), ""},
+		{"text", []byte("hello"), ""},
+		{"empty", nil, ""},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, r, err := Detect(bytes.NewReader(tc.blob))
+			if err != nil {
+				t.Fatalf("Detect() = %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Detect() = %q, want %q", got, tc.want)
+			}
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, tc.blob) {
+				t.Errorf("Detect() lost some of the blob: got %d bytes, want %d", len(b), len(tc.blob))
+			}
+		})
+	}
+}
+
+func TestIsConfig(t *testing.T) {
+	for _, mt := range []MediaType{
+		OCIConfigJSON, DockerConfigJSON,
+	} {
+		if !mt.IsConfig() {
+			t.Errorf("%s: should be config", mt)
+		}
+	}
+
+	for _, mt := range []MediaType{
+		OCIContentDescriptor,
+		OCIImageIndex,
+		OCIManifestSchema1,
+		OCIEmptyJSON,
+		OCILayer,
+		OCIUncompressedLayer,
+
+		DockerManifestSchema2,
+		DockerManifestList,
+		DockerLayer,
+		DockerPluginConfig,
+		DockerUncompressedLayer,
+		"application/vnd.in-toto+json",
+	} {
+		if mt.IsConfig() {
+			t.Errorf("%s: should not be config", mt)
+		}
+	}
+}
+
+func TestDetectManifest(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		manifest string
+		want     MediaType
+	}{
+		{"docker manifest", `{"schemaVersion": 2, "mediaType": "application/vnd.docker.distribution.manifest.v2+json", "config": {}}`, DockerManifestSchema2},
+		{"docker list", `{"schemaVersion": 2, "mediaType": "application/vnd.docker.distribution.manifest.list.v2+json", "manifests": []}`, DockerManifestList},
+		{"oci manifest", `{"schemaVersion": 2, "config": {}, "layers": []}`, OCIManifestSchema1},
+		{"oci index", `{"schemaVersion": 2, "manifests": []}`, OCIImageIndex},
+		{"schema 1", `{"schemaVersion": 1, "fsLayers": []}`, DockerManifestSchema1},
+		{"signed schema 1", `{"schemaVersion": 1, "fsLayers": [], "signatures": []}`, DockerManifestSchema1Signed},
+		{"config", `{"architecture": "amd64", "os": "linux", "rootfs": {"type": "layers"}}`, ""},
+		{"other mediaType", `{"mediaType": "application/vnd.example+json"}`, ""},
+		{"other json", `{"foo": "bar"}`, ""},
+		{"text", "hello", ""},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := DetectManifest([]byte(tc.manifest)); got != tc.want {
+				t.Errorf("DetectManifest() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
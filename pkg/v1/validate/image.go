@@ -26,6 +26,10 @@ import (
 )
 
 // Image validates that img does not violate any invariants of the image format.
+//
+// For artifacts whose config isn't an image config, see
+// partial.ConfigFileOrNil, only the digests and sizes of the config and blobs
+// are validated, since they need not be layers.
 func Image(img v1.Image, opt ...Option) error {
 	errs := []string{}
 	if err := validateLayers(img, opt...); err != nil {
@@ -36,6 +40,12 @@ func Image(img v1.Image, opt ...Option) error {
 		errs = append(errs, fmt.Sprintf("validating config: %v", err))
 	}
 
+	if o := makeOptions(opt...); o.historyCheck {
+		if err := validateHistory(img); err != nil {
+			errs = append(errs, fmt.Sprintf("validating history: %v", err))
+		}
+	}
+
 	if err := validateManifest(img); err != nil {
 		errs = append(errs, fmt.Sprintf("validating manifest: %v", err))
 	}
@@ -57,7 +67,7 @@ func validateConfig(img v1.Image) error {
 		return err
 	}
 
-	hash, size, err := v1.SHA256(bytes.NewReader(rc))
+	hash, size, err := v1.Compute(cn.Algorithm, bytes.NewReader(rc))
 	if err != nil {
 		return err
 	}
@@ -67,23 +77,30 @@ func validateConfig(img v1.Image) error {
 		return err
 	}
 
-	cf, err := img.ConfigFile()
-	if err != nil {
-		return err
+	errs := []string{}
+	if cn != hash {
+		errs = append(errs, fmt.Sprintf("mismatched config digest: ConfigName()=%s, Hash(RawConfigFile())=%s", cn, hash))
 	}
 
-	pcf, err := v1.ParseConfigFile(bytes.NewReader(rc))
+	if want, got := m.Config.Size, size; want != got {
+		errs = append(errs, fmt.Sprintf("mismatched config size: Manifest.Config.Size()=%d, len(RawConfigFile())=%d", want, got))
+	}
+
+	cf, err := partial.ConfigFileOrNil(img)
 	if err != nil {
 		return err
 	}
-
-	errs := []string{}
-	if cn != hash {
-		errs = append(errs, fmt.Sprintf("mismatched config digest: ConfigName()=%s, SHA256(RawConfigFile())=%s", cn, hash))
+	if cf == nil {
+		// The config of an artifact is opaque.
+		if len(errs) != 0 {
+			return errors.New(strings.Join(errs, "\n"))
+		}
+		return nil
 	}
 
-	if want, got := m.Config.Size, size; want != got {
-		errs = append(errs, fmt.Sprintf("mismatched config size: Manifest.Config.Size()=%d, len(RawConfigFile())=%d", want, got))
+	pcf, err := v1.ParseConfigFile(bytes.NewReader(rc))
+	if err != nil {
+		return err
 	}
 
 	if diff := cmp.Diff(pcf, cf); diff != "" {
@@ -101,6 +118,60 @@ func validateConfig(img v1.Image) error {
 	return nil
 }
 
+func validateHistory(img v1.Image) error {
+	cf, err := partial.ConfigFileOrNil(img)
+	if err != nil {
+		return err
+	}
+	if cf == nil || len(cf.History) == 0 {
+		return nil
+	}
+
+	errs := []string{}
+	layer := 0
+	for i, h := range cf.History {
+		if !h.EmptyLayer {
+			// Each entry that isn't an empty_layer produces the next diff_id.
+			if layer >= len(cf.RootFS.DiffIDs) {
+				errs = append(errs, fmt.Sprintf("history[%d] %s has no layer: ConfigFile.RootFS.DiffIDs has %d entries", i, describe(h), len(cf.RootFS.DiffIDs)))
+			}
+			layer++
+		}
+		if i == 0 || h.Created.IsZero() {
+			continue
+		}
+		// Compare with the last entry before this one that has a timestamp.
+		for j := i - 1; j >= 0; j-- {
+			prev := cf.History[j].Created
+			if prev.IsZero() {
+				continue
+			}
+			if h.Created.Before(prev.Time) {
+				errs = append(errs, fmt.Sprintf("history[%d] %s created at %s, before history[%d] %s at %s", i, describe(h), h.Created.UTC(), j, describe(cf.History[j]), prev.UTC()))
+			}
+			break
+		}
+	}
+
+	for ; layer < len(cf.RootFS.DiffIDs); layer++ {
+		errs = append(errs, fmt.Sprintf("ConfigFile.RootFS.DiffIDs[%d]=%s has no history entry without empty_layer", layer, cf.RootFS.DiffIDs[layer]))
+	}
+
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
+
+// describe identifies a history entry by the command that created it.
+func describe(h v1.History) string {
+	if h.CreatedBy == "" {
+		return "(no created_by)"
+	}
+	return fmt.Sprintf("(created_by %q)", h.CreatedBy)
+}
+
 func validateLayers(img v1.Image, opt ...Option) error {
 	o := makeOptions(opt...)
 
@@ -113,10 +184,12 @@ func validateLayers(img v1.Image, opt ...Option) error {
 		return layersExist(layers)
 	}
 
-	digests := []v1.Hash{}
-	diffids := []v1.Hash{}
-	udiffids := []v1.Hash{}
-	sizes := []int64{}
+	// Images with stream.Layers can't tell yet, but they aren't artifacts.
+	if cf, err := partial.ConfigFileOrNil(img); err == nil && cf == nil {
+		return validateBlobs(img, layers)
+	}
+
+	computed := []*computedLayer{}
 	for _, layer := range layers {
 		cl, err := computeLayer(layer)
 		if err != nil {
@@ -124,10 +197,7 @@ func validateLayers(img v1.Image, opt ...Option) error {
 		}
 		// Compute all of these first before we call Config() and Manifest() to allow
 		// for lazy access e.g. for stream.Layer.
-		digests = append(digests, cl.digest)
-		diffids = append(diffids, cl.diffid)
-		udiffids = append(udiffids, cl.uncompressedDiffid)
-		sizes = append(sizes, cl.size)
+		computed = append(computed, cl)
 	}
 
 	cf, err := img.ConfigFile()
@@ -167,32 +237,55 @@ func validateLayers(img v1.Image, opt ...Option) error {
 			return err
 		}
 
-		if digest != digests[i] {
-			errs = append(errs, fmt.Sprintf("mismatched layer[%d] digest: Digest()=%s, SHA256(Compressed())=%s", i, digest, digests[i]))
+		// Verify the algorithms that the layer, manifest and config declare.
+		cl := computed[i]
+		gotDigest, err := cl.digest.hash(digest.Algorithm)
+		if err != nil {
+			return err
+		}
+		gotManifestDigest, err := cl.digest.hash(m.Layers[i].Digest.Algorithm)
+		if err != nil {
+			return err
+		}
+		gotDiffid, err := cl.diffid.hash(diffid.Algorithm)
+		if err != nil {
+			return err
+		}
+		gotUncompressedDiffid, err := cl.uncompressedDiffid.hash(diffid.Algorithm)
+		if err != nil {
+			return err
+		}
+		gotConfigDiffid, err := cl.diffid.hash(cf.RootFS.DiffIDs[i].Algorithm)
+		if err != nil {
+			return err
 		}
 
-		if m.Layers[i].Digest != digests[i] {
-			errs = append(errs, fmt.Sprintf("mismatched layer[%d] digest: Manifest.Layers[%d].Digest=%s, SHA256(Compressed())=%s", i, i, m.Layers[i].Digest, digests[i]))
+		if digest != gotDigest {
+			errs = append(errs, fmt.Sprintf("mismatched layer[%d] digest: Digest()=%s, Hash(Compressed())=%s", i, digest, gotDigest))
 		}
 
-		if diffid != diffids[i] {
-			errs = append(errs, fmt.Sprintf("mismatched layer[%d] diffid: DiffID()=%s, SHA256(Gunzip(Compressed()))=%s", i, diffid, diffids[i]))
+		if m.Layers[i].Digest != gotManifestDigest {
+			errs = append(errs, fmt.Sprintf("mismatched layer[%d] digest: Manifest.Layers[%d].Digest=%s, Hash(Compressed())=%s", i, i, m.Layers[i].Digest, gotManifestDigest))
 		}
 
-		if diffid != udiffids[i] {
-			errs = append(errs, fmt.Sprintf("mismatched layer[%d] diffid: DiffID()=%s, SHA256(Uncompressed())=%s", i, diffid, udiffids[i]))
+		if diffid != gotDiffid {
+			errs = append(errs, fmt.Sprintf("mismatched layer[%d] diffid: DiffID()=%s, Hash(Gunzip(Compressed()))=%s", i, diffid, gotDiffid))
 		}
 
-		if cf.RootFS.DiffIDs[i] != diffids[i] {
-			errs = append(errs, fmt.Sprintf("mismatched layer[%d] diffid: ConfigFile.RootFS.DiffIDs[%d]=%s, SHA256(Gunzip(Compressed()))=%s", i, i, cf.RootFS.DiffIDs[i], diffids[i]))
+		if diffid != gotUncompressedDiffid {
+			errs = append(errs, fmt.Sprintf("mismatched layer[%d] diffid: DiffID()=%s, Hash(Uncompressed())=%s", i, diffid, gotUncompressedDiffid))
 		}
 
-		if size != sizes[i] {
-			errs = append(errs, fmt.Sprintf("mismatched layer[%d] size: Size()=%d, len(Compressed())=%d", i, size, sizes[i]))
+		if cf.RootFS.DiffIDs[i] != gotConfigDiffid {
+			errs = append(errs, fmt.Sprintf("mismatched layer[%d] diffid: ConfigFile.RootFS.DiffIDs[%d]=%s, Hash(Gunzip(Compressed()))=%s", i, i, cf.RootFS.DiffIDs[i], gotConfigDiffid))
 		}
 
-		if m.Layers[i].Size != sizes[i] {
-			errs = append(errs, fmt.Sprintf("mismatched layer[%d] size: Manifest.Layers[%d].Size=%d, len(Compressed())=%d", i, i, m.Layers[i].Size, sizes[i]))
+		if size != computed[i].size {
+			errs = append(errs, fmt.Sprintf("mismatched layer[%d] size: Size()=%d, len(Compressed())=%d", i, size, computed[i].size))
+		}
+
+		if m.Layers[i].Size != computed[i].size {
+			errs = append(errs, fmt.Sprintf("mismatched layer[%d] size: Manifest.Layers[%d].Size=%d, len(Compressed())=%d", i, i, m.Layers[i].Size, computed[i].size))
 		}
 
 		if m.Layers[i].MediaType != mediaType {
@@ -222,7 +315,7 @@ func validateManifest(img v1.Image) error {
 		return err
 	}
 
-	hash, _, err := v1.SHA256(bytes.NewReader(rm))
+	hash, _, err := v1.Compute(digest.Algorithm, bytes.NewReader(rm))
 	if err != nil {
 		return err
 	}
@@ -239,7 +332,7 @@ func validateManifest(img v1.Image) error {
 
 	errs := []string{}
 	if digest != hash {
-		errs = append(errs, fmt.Sprintf("mismatched manifest digest: Digest()=%s, SHA256(RawManifest())=%s", digest, hash))
+		errs = append(errs, fmt.Sprintf("mismatched manifest digest: Digest()=%s, Hash(RawManifest())=%s", digest, hash))
 	}
 
 	if diff := cmp.Diff(pm, m); diff != "" {
@@ -257,6 +350,60 @@ func validateManifest(img v1.Image) error {
 	return nil
 }
 
+// validateBlobs validates the blobs of an artifact, which aren't necessarily
+// compressed tarballs, so only their digests and sizes are checked.
+func validateBlobs(img v1.Image, blobs []v1.Layer) error {
+	m, err := img.Manifest()
+	if err != nil {
+		return err
+	}
+	if len(blobs) != len(m.Layers) {
+		return fmt.Errorf("mismatched blob count: len(Layers())=%d, len(Manifest.Layers)=%d", len(blobs), len(m.Layers))
+	}
+
+	errs := []string{}
+	for i, blob := range blobs {
+		digest, err := blob.Digest()
+		if err != nil {
+			return err
+		}
+		size, err := blob.Size()
+		if err != nil {
+			return err
+		}
+		rc, err := blob.Compressed()
+		if err != nil {
+			return err
+		}
+		gotDigest, gotSize, err := v1.Compute(digest.Algorithm, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+
+		if digest != gotDigest {
+			errs = append(errs, fmt.Sprintf("mismatched blob[%d] digest: Digest()=%s, Hash(Compressed())=%s", i, digest, gotDigest))
+		}
+
+		if m.Layers[i].Digest != gotDigest {
+			errs = append(errs, fmt.Sprintf("mismatched blob[%d] digest: Manifest.Layers[%d].Digest=%s, Hash(Compressed())=%s", i, i, m.Layers[i].Digest, gotDigest))
+		}
+
+		if size != gotSize {
+			errs = append(errs, fmt.Sprintf("mismatched blob[%d] size: Size()=%d, len(Compressed())=%d", i, size, gotSize))
+		}
+
+		if m.Layers[i].Size != gotSize {
+			errs = append(errs, fmt.Sprintf("mismatched blob[%d] size: Manifest.Layers[%d].Size=%d, len(Compressed())=%d", i, i, m.Layers[i].Size, gotSize))
+		}
+	}
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
+
 func layersExist(layers []v1.Layer) error {
 	errs := []string{}
 	for _, layer := range layers {
@@ -0,0 +1,137 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+func history(createdBy string, created time.Time, emptyLayer bool) v1.History {
+	return v1.History{
+		CreatedBy:  createdBy,
+		Created:    v1.Time{Time: created},
+		EmptyLayer: emptyLayer,
+	}
+}
+
+// withHistory returns an image with the given number of random layers, whose
+// config's history is h.
+func withHistory(t *testing.T, layers int, h ...v1.History) v1.Image {
+	t.Helper()
+	img := empty.Image
+	for i := 0; i < layers; i++ {
+		l, err := random.Layer(64, types.DockerLayer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err = mutate.AppendLayers(img, l)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	cf, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf = cf.DeepCopy()
+	cf.History = h
+	img, err = mutate.ConfigFile(img, cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestHistoryCheck(t *testing.T) {
+	t0 := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Hour)
+	t2 := t1.Add(time.Hour)
+
+	for _, tc := range []struct {
+		name    string
+		img     v1.Image
+		wantErr []string
+	}{{
+		name: "matching",
+		img: withHistory(t, 2,
+			history("ADD rootfs.tar /", t0, false),
+			history("RUN make", t1, false),
+		),
+	}, {
+		name: "empty_layer",
+		img: withHistory(t, 2,
+			history("ADD rootfs.tar /", t0, false),
+			history("ENV PATH=/bin", t1, true),
+			history("RUN make", t1, false),
+			history("CMD [\"/bin/sh\"]", t2, true),
+		),
+	}, {
+		name: "no history",
+		img:  withHistory(t, 2),
+	}, {
+		name: "extra history entry",
+		img: withHistory(t, 1,
+			history("ADD rootfs.tar /", t0, false),
+			history("ENV PATH=/bin", t1, false),
+		),
+		wantErr: []string{`history[1] (created_by "ENV PATH=/bin") has no layer`},
+	}, {
+		name: "missing history entry",
+		img: withHistory(t, 2,
+			history("ADD rootfs.tar /", t0, false),
+			history("RUN make", t1, true),
+		),
+		wantErr: []string{"ConfigFile.RootFS.DiffIDs[1]=sha256:", "has no history entry"},
+	}, {
+		name: "out of order",
+		img: withHistory(t, 2,
+			history("ADD rootfs.tar /", t1, false),
+			history("RUN make", t0, false),
+		),
+		wantErr: []string{`history[1] (created_by "RUN make") created at`, `before history[0] (created_by "ADD rootfs.tar /")`},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Without the option, the history isn't checked.
+			if err := validate.Image(tc.img); err != nil {
+				t.Fatalf("validate.Image() = %v", err)
+			}
+
+			err := validate.Image(tc.img, validate.WithHistoryCheck)
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("validate.Image(WithHistoryCheck) = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("validate.Image(WithHistoryCheck) = nil, want error")
+			}
+			for _, want := range tc.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("validate.Image(WithHistoryCheck) = %v, want %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -27,6 +27,11 @@ import (
 )
 
 // Index validates that idx does not violate any invariants of the index format.
+//
+// It recurses into every child image and index, checking that the content of
+// each child matches the digest, size and media type of its descriptor, and
+// that no two children declare the same platform. All of the problems found
+// are reported together, rather than stopping at the first one.
 func Index(idx v1.ImageIndex, opt ...Option) error {
 	errs := []string{}
 
@@ -55,27 +60,39 @@ func validateChildren(idx v1.ImageIndex, opt ...Option) error {
 	}
 
 	errs := []string{}
+	if err := validatePlatforms(manifest); err != nil {
+		errs = append(errs, err.Error())
+	}
+
 	for i, desc := range manifest.Manifests {
 		switch desc.MediaType {
 		case types.OCIImageIndex, types.DockerManifestList:
 			idx, err := idx.ImageIndex(desc.Digest)
 			if err != nil {
-				return err
+				errs = append(errs, fmt.Sprintf("failed to get index Manifests[%d](%s): %v", i, desc.Digest, err))
+				continue
 			}
 			if err := Index(idx, opt...); err != nil {
 				errs = append(errs, fmt.Sprintf("failed to validate index Manifests[%d](%s): %v", i, desc.Digest, err))
 			}
+			if err := validateDescriptor(idx, desc); err != nil {
+				errs = append(errs, fmt.Sprintf("failed to validate index Descriptor[%d](%s): %v", i, desc.Digest, err))
+			}
 			if err := validateMediaType(idx, desc.MediaType); err != nil {
 				errs = append(errs, fmt.Sprintf("failed to validate index MediaType[%d](%s): %v", i, desc.Digest, err))
 			}
 		case types.OCIManifestSchema1, types.DockerManifestSchema2:
 			img, err := idx.Image(desc.Digest)
 			if err != nil {
-				return err
+				errs = append(errs, fmt.Sprintf("failed to get image Manifests[%d](%s): %v", i, desc.Digest, err))
+				continue
 			}
 			if err := Image(img, opt...); err != nil {
 				errs = append(errs, fmt.Sprintf("failed to validate image Manifests[%d](%s): %v", i, desc.Digest, err))
 			}
+			if err := validateDescriptor(img, desc); err != nil {
+				errs = append(errs, fmt.Sprintf("failed to validate image Descriptor[%d](%s): %v", i, desc.Digest, err))
+			}
 			if err := validateMediaType(img, desc.MediaType); err != nil {
 				errs = append(errs, fmt.Sprintf("failed to validate image MediaType[%d](%s): %v", i, desc.Digest, err))
 			}
@@ -84,7 +101,8 @@ func validateChildren(idx v1.ImageIndex, opt ...Option) error {
 			if wl, ok := idx.(withLayer); ok {
 				layer, err := wl.Layer(desc.Digest)
 				if err != nil {
-					return fmt.Errorf("failed to get layer Manifests[%d]: %v", i, err)
+					errs = append(errs, fmt.Sprintf("failed to get layer Manifests[%d]: %v", i, err))
+					continue
 				}
 				if err := Layer(layer, opt...); err != nil {
 					lerr := fmt.Sprintf("failed to validate layer Manifests[%d](%s): %v", i, desc.Digest, err)
@@ -107,6 +125,67 @@ func validateChildren(idx v1.ImageIndex, opt ...Option) error {
 	return nil
 }
 
+// validatePlatforms checks that no two children of an index declare the same
+// platform, which would make selecting a child for that platform ambiguous.
+//
+// Children without a real platform, e.g. the unknown/unknown attestation
+// manifests that buildx adds, may repeat.
+func validatePlatforms(manifest *v1.IndexManifest) error {
+	errs := []string{}
+	for i, desc := range manifest.Manifests {
+		if !hasPlatform(desc) {
+			continue
+		}
+		for j := 0; j < i; j++ {
+			other := manifest.Manifests[j]
+			if hasPlatform(other) && desc.Platform.Equals(*other.Platform) {
+				errs = append(errs, fmt.Sprintf("duplicate platform: Manifests[%d].Platform = Manifests[%d].Platform = %+v", i, j, *desc.Platform))
+				break
+			}
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+func hasPlatform(desc v1.Descriptor) bool {
+	p := desc.Platform
+	return p != nil && !(p.OS == "unknown" && p.Architecture == "unknown")
+}
+
+type withRawManifest interface {
+	RawManifest() ([]byte, error)
+}
+
+// validateDescriptor checks that the content of a child matches the digest
+// and size that its parent's descriptor declares.
+func validateDescriptor(child withRawManifest, desc v1.Descriptor) error {
+	rm, err := child.RawManifest()
+	if err != nil {
+		return err
+	}
+	hash, size, err := v1.Compute(desc.Digest.Algorithm, bytes.NewReader(rm))
+	if err != nil {
+		return err
+	}
+
+	errs := []string{}
+	if hash != desc.Digest {
+		errs = append(errs, fmt.Sprintf("mismatched digest: Descriptor.Digest=%s, Hash(RawManifest())=%s", desc.Digest, hash))
+	}
+	if size != desc.Size {
+		errs = append(errs, fmt.Sprintf("mismatched size: Descriptor.Size=%d, len(RawManifest())=%d", desc.Size, size))
+	}
+
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
 type withMediaType interface {
 	MediaType() (types.MediaType, error)
 }
@@ -139,7 +218,7 @@ func validateIndexManifest(idx v1.ImageIndex) error {
 		return err
 	}
 
-	hash, _, err := v1.SHA256(bytes.NewReader(rm))
+	hash, _, err := v1.Compute(digest.Algorithm, bytes.NewReader(rm))
 	if err != nil {
 		return err
 	}
@@ -156,7 +235,7 @@ func validateIndexManifest(idx v1.ImageIndex) error {
 
 	errs := []string{}
 	if digest != hash {
-		errs = append(errs, fmt.Sprintf("mismatched manifest digest: Digest()=%s, SHA256(RawManifest())=%s", digest, hash))
+		errs = append(errs, fmt.Sprintf("mismatched manifest digest: Digest()=%s, Hash(RawManifest())=%s", digest, hash))
 	}
 
 	if diff := cmp.Diff(pm, m); diff != "" {
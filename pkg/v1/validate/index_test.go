@@ -0,0 +1,84 @@
+// Copyright 2021 Google LLC All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate_test
+
+import (
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+)
+
+// withPlatforms returns an index with a random image for each of platforms.
+func withPlatforms(t *testing.T, platforms ...*v1.Platform) v1.ImageIndex {
+	t.Helper()
+	adds := []mutate.IndexAddendum{}
+	for _, p := range platforms {
+		img, err := random.Image(64, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		adds = append(adds, mutate.IndexAddendum{
+			Add: img,
+			Descriptor: v1.Descriptor{
+				Platform: p,
+			},
+		})
+	}
+	return mutate.AppendManifests(empty.Index, adds...)
+}
+
+func TestIndexPlatforms(t *testing.T) {
+	amd64 := &v1.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := &v1.Platform{OS: "linux", Architecture: "arm64"}
+	unknown := &v1.Platform{OS: "unknown", Architecture: "unknown"}
+
+	for _, tc := range []struct {
+		name    string
+		idx     v1.ImageIndex
+		wantErr bool
+	}{{
+		name: "distinct",
+		idx:  withPlatforms(t, amd64, arm64),
+	}, {
+		name: "no platforms",
+		idx:  withPlatforms(t, nil, nil),
+	}, {
+		// buildx adds an attestation manifest for each image.
+		name: "attestations",
+		idx:  withPlatforms(t, amd64, arm64, unknown, unknown),
+	}, {
+		name:    "duplicate",
+		idx:     withPlatforms(t, amd64, arm64, amd64),
+		wantErr: true,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validate.Index(tc.idx)
+			if !tc.wantErr {
+				if err != nil {
+					t.Errorf("validate.Index() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "duplicate platform: Manifests[2].Platform = Manifests[0].Platform") {
+				t.Errorf("validate.Index() = %v, want duplicate platform", err)
+			}
+		})
+	}
+}
@@ -18,13 +18,18 @@ import (
 	"archive/tar"
 	"compress/gzip"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"strings"
 
+	icompression "github.com/google/go-containerregistry/internal/compression"
+	"github.com/google/go-containerregistry/internal/zstd"
+	"github.com/google/go-containerregistry/pkg/compression"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/partial"
 )
@@ -64,16 +69,30 @@ func Layer(layer v1.Layer, opt ...Option) error {
 		return err
 	}
 
-	if digest != cl.digest {
-		errs = append(errs, fmt.Sprintf("mismatched digest: Digest()=%s, SHA256(Compressed())=%s", digest, cl.digest))
+	// Verify the algorithms that the layer declares.
+	gotDigest, err := cl.digest.hash(digest.Algorithm)
+	if err != nil {
+		return err
+	}
+	gotDiffid, err := cl.diffid.hash(diffid.Algorithm)
+	if err != nil {
+		return err
+	}
+	gotUncompressedDiffid, err := cl.uncompressedDiffid.hash(diffid.Algorithm)
+	if err != nil {
+		return err
 	}
 
-	if diffid != cl.diffid {
-		errs = append(errs, fmt.Sprintf("mismatched diffid: DiffID()=%s, SHA256(Gunzip(Compressed()))=%s", diffid, cl.diffid))
+	if digest != gotDigest {
+		errs = append(errs, fmt.Sprintf("mismatched digest: Digest()=%s, Hash(Compressed())=%s", digest, gotDigest))
 	}
 
-	if diffid != cl.uncompressedDiffid {
-		errs = append(errs, fmt.Sprintf("mismatched diffid: DiffID()=%s, SHA256(Uncompressed())=%s", diffid, cl.uncompressedDiffid))
+	if diffid != gotDiffid {
+		errs = append(errs, fmt.Sprintf("mismatched diffid: DiffID()=%s, Hash(Gunzip(Compressed()))=%s", diffid, gotDiffid))
+	}
+
+	if diffid != gotUncompressedDiffid {
+		errs = append(errs, fmt.Sprintf("mismatched diffid: DiffID()=%s, Hash(Uncompressed())=%s", diffid, gotUncompressedDiffid))
 	}
 
 	if size != cl.size {
@@ -89,15 +108,46 @@ func Layer(layer v1.Layer, opt ...Option) error {
 
 type computedLayer struct {
 	// Calculated from Compressed stream.
-	digest v1.Hash
+	digest digester
 	size   int64
-	diffid v1.Hash
+	diffid digester
 
 	// Calculated from Uncompressed stream.
-	uncompressedDiffid v1.Hash
+	uncompressedDiffid digester
 	uncompressedSize   int64
 }
 
+// digester hashes everything written to it with each supported algorithm,
+// since we can't know which one a layer uses until after we've consumed it,
+// e.g. for stream.Layer.
+type digester map[string]hash.Hash
+
+func newDigester() digester {
+	return digester{
+		"sha256": sha256.New(),
+		"sha512": sha512.New(),
+	}
+}
+
+func (d digester) Write(p []byte) (int, error) {
+	for _, h := range d {
+		h.Write(p)
+	}
+	return len(p), nil
+}
+
+// hash returns the digest computed with the given algorithm.
+func (d digester) hash(algorithm string) (v1.Hash, error) {
+	h, ok := d[algorithm]
+	if !ok {
+		return v1.Hash{}, fmt.Errorf("unsupported algorithm: %q", algorithm)
+	}
+	return v1.Hash{
+		Algorithm: algorithm,
+		Hex:       hex.EncodeToString(h.Sum(make([]byte, 0, h.Size()))),
+	}, nil
+}
+
 func computeLayer(layer v1.Layer) (*computedLayer, error) {
 	compressed, err := layer.Compressed()
 	if err != nil {
@@ -105,7 +155,7 @@ func computeLayer(layer v1.Layer) (*computedLayer, error) {
 	}
 
 	// Keep track of compressed digest.
-	digester := sha256.New()
+	digester := newDigester()
 	// Everything read from compressed is written to digester to compute digest.
 	hashCompressed := io.TeeReader(compressed, digester)
 
@@ -128,12 +178,21 @@ func computeLayer(layer v1.Layer) (*computedLayer, error) {
 		pw.CloseWithError(compressed.Close())
 	}()
 
-	// Read the bytes through gzip.Reader to compute the DiffID.
-	uncompressed, err := gzip.NewReader(pr)
+	// Read the bytes through a decompressor to compute the DiffID.
+	comp, r, err := icompression.PeekReader(pr)
+	if err != nil {
+		return nil, err
+	}
+	var uncompressed io.ReadCloser
+	if comp == compression.ZStd {
+		uncompressed, err = zstd.UnzipReadCloser(ioutil.NopCloser(r))
+	} else {
+		uncompressed, err = gzip.NewReader(r)
+	}
 	if err != nil {
 		return nil, err
 	}
-	diffider := sha256.New()
+	diffider := newDigester()
 	hashUncompressed := io.TeeReader(uncompressed, diffider)
 
 	// Ensure there aren't duplicate file paths.
@@ -162,31 +221,22 @@ func computeLayer(layer v1.Layer) (*computedLayer, error) {
 		return nil, err
 	}
 
-	digest := v1.Hash{
-		Algorithm: "sha256",
-		Hex:       hex.EncodeToString(digester.Sum(make([]byte, 0, digester.Size()))),
-	}
-
-	diffid := v1.Hash{
-		Algorithm: "sha256",
-		Hex:       hex.EncodeToString(diffider.Sum(make([]byte, 0, diffider.Size()))),
-	}
-
 	ur, err := layer.Uncompressed()
 	if err != nil {
 		return nil, err
 	}
 	defer ur.Close()
-	udiffid, usize, err := v1.SHA256(ur)
+	udiffider := newDigester()
+	usize, err := io.Copy(udiffider, ur)
 	if err != nil {
 		return nil, err
 	}
 
 	return &computedLayer{
-		digest:             digest,
-		diffid:             diffid,
+		digest:             digester,
+		diffid:             diffider,
 		size:               size,
-		uncompressedDiffid: udiffid,
+		uncompressedDiffid: udiffider,
 		uncompressedSize:   usize,
 	}, nil
 }
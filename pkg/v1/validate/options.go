@@ -18,7 +18,8 @@ package validate
 type Option func(*options)
 
 type options struct {
-	fast bool
+	fast         bool
+	historyCheck bool
 }
 
 func makeOptions(opts ...Option) options {
@@ -35,3 +36,12 @@ func makeOptions(opts ...Option) options {
 func Fast(o *options) {
 	o.fast = true
 }
+
+// WithHistoryCheck causes validate to check that the history in the config
+// of images is consistent with their layers: that there is one entry that
+// isn't an empty_layer for each of the config's diff_ids, and that the
+// entries are in chronological order. Errors name the offending entries by
+// their created_by. Images without history pass.
+func WithHistoryCheck(o *options) {
+	o.historyCheck = true
+}